@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+
+	"backend_mini/internal/db"
+)
+
+func main() {
+	dbPath := flag.String("db", "data/sona_mini.db", "path to the sqlite database")
+	fix := flag.Bool("fix", false, "repair detected issues")
+	deleteOrphans := flag.Bool("delete-orphans", false, "with -fix, delete kids whose parent no longer exists")
+	flag.Parse()
+
+	ctx := context.Background()
+	database, err := db.Open(ctx, *dbPath)
+	if err != nil {
+		log.Fatalf("failed opening db: %v", err)
+	}
+	defer database.Close()
+
+	if err := database.Migrate(ctx); err != nil {
+		log.Fatalf("failed migrating db: %v", err)
+	}
+
+	issues, err := database.Doctor(ctx, db.DoctorOptions{Repair: *fix, DeleteOrphans: *deleteOrphans})
+	if err != nil {
+		log.Fatalf("doctor failed: %v", err)
+	}
+	if len(issues) == 0 {
+		fmt.Println("✓ no issues found")
+		return
+	}
+	for _, is := range issues {
+		status := "found"
+		if is.Repaired {
+			status = "repaired"
+		}
+		fmt.Printf("[%s] %s %s %s: %s\n", status, is.Kind, is.Table, is.RowID, is.Detail)
+	}
+	if !*fix {
+		fmt.Println("run with -fix to repair")
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+
+	"backend_mini/internal/db"
+	"backend_mini/internal/fixtures"
+)
+
+func main() {
+	dbPath := flag.String("db", "data/sona_mini.db", "path to the sqlite database")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: seed [-db path] fixtures.yaml...")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		return
+	}
+
+	ctx := context.Background()
+	database, err := db.Open(ctx, *dbPath)
+	if err != nil {
+		log.Fatalf("failed opening db: %v", err)
+	}
+	defer database.Close()
+
+	if err := database.Migrate(ctx); err != nil {
+		log.Fatalf("failed migrating db: %v", err)
+	}
+
+	for _, path := range flag.Args() {
+		res, err := fixtures.LoadFile(ctx, database, path)
+		if err != nil {
+			log.Fatalf("failed loading %s: %v", path, err)
+		}
+		fmt.Printf("✓ %s: %d parents, %d kids, %d chores, %d limits\n", path, res.Parents, res.Kids, res.Chores, res.Limits)
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+)
+
+// listenFDsStart is the first file descriptor systemd passes to a
+// socket-activated service.
+const listenFDsStart = 3
+
+// listen returns the API listener. Under systemd socket activation the
+// socket is inherited, so it stays open across restarts and connections
+// queue instead of being refused. With REUSE_PORT=1 the socket is opened
+// with SO_REUSEPORT, so a new process can bind next to the old one while
+// the old one drains.
+func listen(ctx context.Context, addr string) (net.Listener, string, error) {
+	if pid, _ := strconv.Atoi(os.Getenv("LISTEN_PID")); pid == os.Getpid() {
+		if n, _ := strconv.Atoi(os.Getenv("LISTEN_FDS")); n >= 1 {
+			f := os.NewFile(listenFDsStart, "systemd-socket")
+			l, err := net.FileListener(f)
+			f.Close()
+			if err != nil {
+				return nil, "", fmt.Errorf("socket activation: %w", err)
+			}
+			return l, "systemd socket", nil
+		}
+	}
+	if os.Getenv("REUSE_PORT") == "1" {
+		l, err := listenReusePort(ctx, addr)
+		return l, "SO_REUSEPORT", err
+	}
+	l, err := net.Listen("tcp", addr)
+	return l, "", err
+}
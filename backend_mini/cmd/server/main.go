@@ -2,19 +2,31 @@ package main
 
 import (
 	"context"
+	"database/sql"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"backend_mini/internal/config"
 	"backend_mini/internal/db"
 	"backend_mini/internal/handlers"
+	"backend_mini/internal/jobs"
 	"backend_mini/internal/middleware"
+	"backend_mini/internal/notify"
+	"backend_mini/internal/ops"
+	"backend_mini/internal/redis"
+	"backend_mini/internal/slo"
+	"backend_mini/internal/state"
 )
 
 func main() {
-	ctx := context.Background()
+	// done on SIGTERM or SIGINT: jobs and background loops stop, and the
+	// server drains
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
 
 	if err := config.LoadServerWallet(); err != nil {
 		log.Fatalf("failed to load server wallet: %v", err)
@@ -36,9 +48,73 @@ func main() {
 	if err := database.Migrate(ctx); err != nil {
 		log.Fatalf("failed migrating db: %v", err)
 	}
+	database.SetQuotas(db.Quotas{
+		db.QuotaKids:       config.QuotaMaxKids(),
+		db.QuotaOpenChores: config.QuotaMaxOpenChores(),
+		db.QuotaLimits:     config.QuotaMaxLimits(),
+		db.QuotaWebhooks:   config.QuotaMaxWebhooks(),
+	})
+	database.SetPremiumQuotas(db.Quotas{db.QuotaKids: config.PremiumMaxKids()})
+	database.SetTrashRetention(config.TrashRetention())
+	database.SetAnalyticsSnapshot(dataDir+"/sona_mini_analytics.db", 3*config.AnalyticsSnapshotInterval())
 
-	api := handlers.NewAPI(database)
+	notifier := notify.New(database)
+	sched := jobs.NewScheduler()
+	for _, j := range []struct {
+		name     string
+		interval time.Duration
+		run      func(context.Context) error
+	}{
+		{"balance_alerts", config.AlertCheckInterval(), func(ctx context.Context) error { return jobs.CheckBalanceAlerts(ctx, database, notifier) }},
+		{"location_purge", config.LocationPurgeInterval(), func(ctx context.Context) error { return jobs.PurgeLocations(ctx, database) }},
+		{"trash_purge", config.TrashPurgeInterval(), func(ctx context.Context) error { return jobs.PurgeTrash(ctx, database) }},
+		{"calendar_sync", config.CalendarSyncInterval(), func(ctx context.Context) error { return jobs.SyncCalendars(ctx, database) }},
+		{"statement_close", config.StatementCloseInterval(), func(ctx context.Context) error { return jobs.CloseStatements(ctx, database) }},
+		{"anomaly_scan", config.AnomalyScanInterval(), func(ctx context.Context) error { return jobs.ScanTransfers(ctx, database, notifier) }},
+		{"ata_provision", config.ATAProvisionInterval(), func(ctx context.Context) error { return jobs.ProvisionATAs(ctx, database, config.ServerWallet) }},
+		{"ledger_anchor", config.LedgerAnchorInterval(), func(ctx context.Context) error { return jobs.AnchorLedger(ctx, database, config.ServerWallet) }},
+		{"chore_claim_sweep", config.ChoreClaimSweepInterval(), func(ctx context.Context) error { return jobs.ReleaseClaims(ctx, database, notifier) }},
+		{"chore_auto_approve", config.ChoreAutoApproveInterval(), func(ctx context.Context) error { return jobs.AutoApproveChores(ctx, database, notifier) }},
+		{"gift_watch", config.GiftWatchInterval(), func(ctx context.Context) error { return jobs.WatchGifts(ctx, database, notifier) }},
+		{"analytics_snapshot", config.AnalyticsSnapshotInterval(), database.RefreshAnalyticsSnapshot},
+		{"warehouse_export", config.WarehouseExportInterval(), func(ctx context.Context) error {
+			return jobs.ExportWarehouse(ctx, database, config.WarehouseExportDir())
+		}},
+	} {
+		if err := sched.Add(j.name, config.JobSchedule(j.name), j.interval, j.run); err != nil {
+			log.Fatalf("invalid schedule: %v", err)
+		}
+	}
+	sched.Run(ctx)
+
+	var limits state.Limiter = state.NewLocalLimiter()
+	switch backend := config.StateBackend(); backend {
+	case "local":
+	case "redis":
+		rc, err := redis.New(config.RedisURL())
+		if err != nil {
+			log.Fatalf("invalid REDIS_URL: %v", err)
+		}
+		if err := rc.Ping(ctx); err != nil {
+			log.Fatalf("failed reaching redis: %v", err)
+		}
+		limits = state.NewRedisLimiter(rc)
+		go state.RunRedisBus(ctx, rc, notifier.Hub())
+		log.Println("✓ Shared state in redis")
+	default:
+		log.Fatalf("unknown STATE_BACKEND %q; use local or redis", backend)
+	}
+
+	api := handlers.NewAPI(database, notifier, limits)
 	mux := http.NewServeMux()
+	shedder := middleware.NewShedder(config.ShedMaxInFlight(), config.ShedMaxDBWaits(), config.LowPriorityRoutes(), database.ConnWaits)
+	go shedder.Run(ctx)
+	killSwitches := middleware.NewKillSwitches(database.KillSwitches, config.MoneyRoutes(), config.MaintenanceReadRoutes(), config.KillSwitchMessage())
+	if err := killSwitches.Reload(ctx); err != nil {
+		log.Fatalf("load kill switches: %v", err)
+	}
+	go killSwitches.Run(ctx, config.KillSwitchRefresh())
+	slos := slo.New(config.SLOTargets(), config.SLOAlertBurnRate(), func(a slo.Alert) { notify.OpsAlert("slo.burn_rate", a) })
 
 	mux.Handle("/get_parent", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.GetParent)))
 	mux.Handle("/get_child", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.GetChild)))
@@ -47,14 +123,174 @@ func main() {
 	mux.Handle("/mint_nft", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.MintNFT)))
 	mux.Handle("/upd_nft", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.UpdNFT)))
 	mux.Handle("/accept_nft", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.AcceptNFT)))
-	mux.Handle("/create_chore", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.CreateChore)))
-	mux.Handle("/update_chore", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.UpdateChore)))
-	mux.Handle("/get_chores", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.GetChores)))
-	mux.Handle("/set_limit", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.SetLimit)))
-	mux.Handle("/get_limits", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.GetLimits)))
+	mux.Handle("/create_chore", middleware.RequireBearerOr("SonaBetaTestAPi", api.PersonalToken(handlers.ScopeChoresWrite), http.HandlerFunc(api.CreateChore)))
+	mux.Handle("/update_chore", middleware.RequireBearerOr("SonaBetaTestAPi", api.PersonalToken(handlers.ScopeChoresWrite), api.DeviceSigned(http.HandlerFunc(api.UpdateChore))))
+	mux.Handle("/get_chores", middleware.RequireBearerOr("SonaBetaTestAPi", api.PersonalToken(handlers.ScopeChoresRead), http.HandlerFunc(api.GetChores)))
+	mux.Handle("/chore/{id}/timeline", middleware.RequireBearerOr("SonaBetaTestAPi", api.PersonalTokenPath(handlers.ScopeChoresRead, "chore_id"), http.HandlerFunc(api.ChoreTimeline)))
+	mux.Handle("/set_limit", middleware.RequireBearerOr("SonaBetaTestAPi", api.PersonalToken(handlers.ScopeLimitsWrite), http.HandlerFunc(api.SetLimit)))
+	mux.Handle("/set_limits_bulk", middleware.RequireBearerOr("SonaBetaTestAPi", api.PersonalToken(handlers.ScopeLimitsWrite), http.HandlerFunc(api.SetLimitsBulk)))
+	mux.Handle("/limit_history", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.LimitHistory)))
+	mux.Handle("/list_scheduled_limits", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.ListScheduledLimits)))
+	mux.Handle("/cancel_scheduled_limit", middleware.RequireBearerOr("SonaBetaTestAPi", api.PersonalToken(handlers.ScopeLimitsWrite), http.HandlerFunc(api.CancelScheduledLimit)))
+	mux.Handle("/list_app_alerts", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.ListAppAlerts)))
+	mux.Handle("/resolve_app_alert", middleware.RequireBearerOr("SonaBetaTestAPi", api.PersonalToken(handlers.ScopeLimitsWrite), http.HandlerFunc(api.ResolveAppAlert)))
+	mux.Handle("/get_limits", middleware.RequireBearerOr("SonaBetaTestAPi", api.PersonalToken(handlers.ScopeLimitsRead), http.HandlerFunc(api.GetLimits)))
+	mux.Handle("/list_kids", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.ListKids)))
+	mux.Handle("/kid_login", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.KidLogin)))
+	mux.Handle("/reset_login_code", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.ResetLoginCode)))
+	mux.Handle("/oauth_exchange", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.OAuthExchange)))
+	mux.Handle("/set_webhook", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.SetWebhook)))
+	mux.Handle("/update_webhook", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.UpdateWebhook)))
+	mux.Handle("/get_webhooks", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.GetWebhooks)))
+	mux.Handle("/webhook_test", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.WebhookTest)))
+	mux.Handle("/create_thread", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.CreateThread)))
+	mux.Handle("/send_message", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.SendMessage)))
+	mux.Handle("/messages", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.ListMessages)))
+	mux.Handle("/mark_read", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.MarkRead)))
+	mux.Handle("/crypto/publish_key", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.PublishKey)))
+	mux.Handle("/crypto/public_key", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.PublicKey)))
+	mux.Handle("/rotate_keys", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.RotateKeys)))
+	mux.Handle("/set_alerts", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.SetAlerts)))
+	mux.Handle("/list_alerts", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.ListAlerts)))
+	mux.Handle("/set_split_rule", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.SetSplitRule)))
+	mux.Handle("/get_split_rule", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.GetSplitRule)))
+	mux.Handle("/set_override", middleware.RequireBearerOr("SonaBetaTestAPi", api.PersonalToken(handlers.ScopeLimitsWrite), http.HandlerFunc(api.SetOverride)))
+	mux.Handle("/clear_override", middleware.RequireBearerOr("SonaBetaTestAPi", api.PersonalToken(handlers.ScopeLimitsWrite), http.HandlerFunc(api.ClearOverride)))
+	mux.Handle("/pair_device", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.PairDevice)))
+	mux.Handle("/redeem_pairing", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.RedeemPairing)))
+	mux.Handle("/list_devices", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.ListDevices)))
+	mux.Handle("/rename_device", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.RenameDevice)))
+	mux.Handle("/unpair_device", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.UnpairDevice)))
+	mux.Handle("/device_heartbeat", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.DeviceHeartbeat)))
+	mux.Handle("/send_command", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.SendCommand)))
+	mux.Handle("/poll_commands", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.PollCommands)))
+	mux.Handle("/ack_command", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.AckCommand)))
+	mux.Handle("/list_commands", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.ListCommands)))
+	mux.Handle("/location_settings", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.LocationSettings)))
+	mux.Handle("/set_geofence", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.SetGeofence)))
+	mux.Handle("/delete_geofence", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.DeleteGeofence)))
+	mux.Handle("/list_geofences", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.ListGeofences)))
+	mux.Handle("/report_location", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.ReportLocation)))
+	mux.Handle("/add_calendar", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.AddCalendar)))
+	mux.Handle("/list_calendars", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.ListCalendars)))
+	mux.Handle("/sync_calendar", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.SyncCalendar)))
+	mux.Handle("/delete_calendar", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.DeleteCalendar)))
+	mux.Handle("/school_days", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.SchoolDays)))
+	mux.Handle("/set_schedule_rule", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.SetScheduleRule)))
+	mux.Handle("/delete_schedule_rule", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.DeleteScheduleRule)))
+	mux.Handle("/list_schedule_rules", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.ListScheduleRules)))
+	mux.Handle("/poll_events", middleware.RequireBearerOr("SonaBetaTestAPi", api.PersonalToken(handlers.ScopeEventsRead), http.HandlerFunc(api.PollEvents)))
+	mux.Handle("/report_usage", middleware.RequireBearer("SonaBetaTestAPi", api.DeviceSigned(http.HandlerFunc(api.ReportUsage))))
+	mux.Handle("/get_usage", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.GetUsage)))
+	mux.Handle("/create_token", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.CreateToken)))
+	mux.Handle("/list_tokens", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.ListTokens)))
+	mux.Handle("/revoke_token", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.RevokeToken)))
+	mux.Handle("/set_integration", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.SetIntegration)))
+	mux.Handle("/list_integrations", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.ListIntegrations)))
+	mux.Handle("/delete_integration", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.DeleteIntegration)))
+	mux.Handle("/test_integration", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.TestIntegration)))
+	mux.Handle("/set_policy", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.SetPolicy)))
+	mux.Handle("/get_policy", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.GetPolicy)))
+	mux.Handle("/policy_history", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.PolicyHistory)))
+	mux.Handle("/evaluate_policy", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.EvaluatePolicy)))
+	mux.Handle("/statements", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.Statements)))
+	mux.Handle("/statements/", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.Statement)))
+	mux.Handle("/rebuild_tx/", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.RebuildTx)))
+	mux.Handle("/decode_tx", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.DecodeTx)))
+	mux.Handle("/verify_signed", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.VerifySigned)))
+	mux.Handle("/kid_balance", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.KidBalance)))
+	mux.Handle("/claim_chore", middleware.RequireBearerOr("SonaBetaTestAPi", api.PersonalToken(handlers.ScopeChoresWrite), http.HandlerFunc(api.ClaimChore)))
+	mux.Handle("/lock_savings", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.LockSavings)))
+	mux.Handle("/list_savings_locks", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.ListSavingsLocks)))
+	mux.Handle("/request_unlock", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.RequestUnlock)))
+	mux.Handle("/decide_unlock", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.DecideUnlock)))
+	mux.Handle("/create_gift", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.CreateGift)))
+	mux.Handle("/list_gifts", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.ListGifts)))
+	mux.Handle("/cancel_gift", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.CancelGift)))
+	// relatives have no account; the link token is the credential
+	mux.Handle("/gift/{token}", http.HandlerFunc(api.GiftLink))
+	mux.Handle("/claim_handle", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.ClaimHandle)))
+	mux.Handle("/handle_history", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.HandleHistory)))
+	// public: a code or @handle only says which family, never anything about it
+	mux.Handle("/share/{code}", http.HandlerFunc(api.Share))
+	mux.Handle("/share/{code}/gift/{token}", http.HandlerFunc(api.ShareGift))
+	mux.Handle("/pause", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.Pause)))
+	mux.Handle("/list_pauses", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.ListPauses)))
+	mux.Handle("/end_pause", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.EndPause)))
+	mux.Handle("/delete_chore", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.DeleteChore)))
+	mux.Handle("/delete_limit", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.DeleteLimit)))
+	mux.Handle("/trash", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.Trash)))
+	mux.Handle("/restore", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.Restore)))
+	mux.Handle("/delegate_chores", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.DelegateChores)))
+	mux.Handle("/list_delegations", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.ListDelegations)))
+	mux.Handle("/revoke_delegation", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.RevokeDelegation)))
+	// delegates have no account; their delegation token is the credential
+	mux.Handle("/delegate/chores", http.HandlerFunc(api.DelegatedChores))
+	mux.Handle("/delegate/verify", http.HandlerFunc(api.VerifyDelegatedChore))
+	mux.Handle("/iap/validate", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.ValidateIAP)))
+	mux.Handle("/entitlements", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.Entitlements)))
+	mux.Handle("/billing/checkout", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.BillingCheckout)))
+	mux.Handle("/billing/change_plan", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.ChangeBillingPlan)))
+	mux.Handle("/billing/cancel", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.CancelBilling)))
+	// Stripe signs its events with the endpoint secret instead
+	mux.Handle("/stripe/webhook", http.HandlerFunc(api.StripeWebhook))
+	mux.Handle("/reverse_tx", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.ReverseTx)))
+	mux.Handle("/acknowledge_reversal", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.AcknowledgeReversal)))
+	mux.Handle("/list_reversals", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.ListReversals)))
+	mux.Handle("/parse_chore", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.ParseChore)))
+	// the inbound mail provider posts with the secret in the path
+	mux.Handle("/inbound/email/{secret}", http.HandlerFunc(api.InboundEmail))
+	mux.Handle("/assistant/authorize", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.AssistantAuthorize)))
+	// the assistant platform authenticates with its client credentials and
+	// then its access token, never the app key
+	mux.Handle("/assistant/token", http.HandlerFunc(api.AssistantToken))
+	mux.Handle("/assistant/intent", http.HandlerFunc(api.AssistantIntent))
+	mux.Handle("/list_assistant_links", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.ListAssistantLinks)))
+	mux.Handle("/unlink_assistant", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.UnlinkAssistant)))
+	mux.Handle("/create_action_token", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.CreateActionToken)))
+	// the action token is the bearer
+	mux.Handle("/run_action", http.HandlerFunc(api.RunAction))
+	mux.Handle("/verify_ledger", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.VerifyLedger)))
+	mux.Handle("/set_kid_pin", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.SetKidPIN)))
+	mux.Handle("/clear_kid_pin", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.ClearKidPIN)))
+	mux.Handle("/suggest_bounty", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.SuggestBounty)))
+	mux.Handle("/anomaly_settings", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.AnomalySettings)))
+	mux.Handle("/admin/flags", middleware.RequireAdmin(config.AdminAPIKey(), http.HandlerFunc(api.ListFlags)))
+	mux.Handle("/admin/resolve_flag", middleware.RequireAdmin(config.AdminAPIKey(), http.HandlerFunc(api.ResolveFlag)))
+	mux.Handle("/admin/import_catalog", middleware.RequireAdmin(config.AdminAPIKey(), http.HandlerFunc(api.ImportCatalog)))
+	mux.Handle("/start_recovery", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.StartRecovery)))
+	mux.Handle("/cancel_recovery", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.CancelRecovery)))
+	mux.Handle("/admin/recoveries", middleware.RequireAdmin(config.AdminAPIKey(), http.HandlerFunc(api.ListRecoveries)))
+	mux.Handle("/admin/review_recovery", middleware.RequireAdmin(config.AdminAPIKey(), http.HandlerFunc(api.ReviewRecovery)))
+	mux.Handle("/settings", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.Settings)))
+	mux.Handle("/admin/load", middleware.RequireAdmin(config.AdminAPIKey(), shedder))
+	mux.Handle("/admin/slo", middleware.RequireAdmin(config.AdminAPIKey(), slos))
+	mux.Handle("/admin/schedules", middleware.RequireAdmin(config.AdminAPIKey(), sched))
+	mux.Handle("/admin/templates", middleware.RequireAdmin(config.AdminAPIKey(), http.HandlerFunc(api.ListTemplates)))
+	mux.Handle("/admin/save_template", middleware.RequireAdmin(config.AdminAPIKey(), http.HandlerFunc(api.SaveTemplate)))
+	mux.Handle("/admin/preview_template", middleware.RequireAdmin(config.AdminAPIKey(), http.HandlerFunc(api.PreviewTemplate)))
+	mux.Handle("/admin/promote_template", middleware.RequireAdmin(config.AdminAPIKey(), http.HandlerFunc(api.PromoteTemplate)))
+	mux.Handle("/admin/partners", middleware.RequireAdmin(config.AdminAPIKey(), http.HandlerFunc(api.ListPartners)))
+	mux.Handle("/admin/create_partner", middleware.RequireAdmin(config.AdminAPIKey(), http.HandlerFunc(api.CreatePartner)))
+	mux.Handle("/admin/revoke_partner", middleware.RequireAdmin(config.AdminAPIKey(), http.HandlerFunc(api.RevokePartner)))
+	mux.Handle("/partner/v1/chore_completion", api.RequirePartner(http.HandlerFunc(api.PartnerChoreCompletion)))
+	mux.Handle("/partner/v1/screen_time", api.RequirePartner(http.HandlerFunc(api.PartnerScreenTime)))
+	mux.Handle("/admin/family_as_of", middleware.RequireAdmin(config.AdminAPIKey(), http.HandlerFunc(api.FamilyAsOf)))
+	mux.Handle("/admin/chore_history", middleware.RequireAdmin(config.AdminAPIKey(), http.HandlerFunc(api.ChoreHistory)))
+	mux.Handle("/admin/quotas", middleware.RequireAdmin(config.AdminAPIKey(), http.HandlerFunc(api.FamilyQuotas)))
+	mux.Handle("/admin/set_quota", middleware.RequireAdmin(config.AdminAPIKey(), http.HandlerFunc(api.SetQuota)))
+	mux.Handle("/admin/analytics", middleware.RequireAdmin(config.AdminAPIKey(), http.HandlerFunc(api.AnalyticsStatus)))
+	mux.Handle("/admin/device_sequences", middleware.RequireAdmin(config.AdminAPIKey(), http.HandlerFunc(api.DeviceSeqStats)))
+	mux.Handle("/admin/kill_switches", middleware.RequireAdmin(config.AdminAPIKey(), killSwitches))
+	mux.Handle("/admin/set_kill_switch", middleware.RequireAdmin(config.AdminAPIKey(), killSwitches.ReloadAfter(http.HandlerFunc(api.SetKillSwitch))))
+	mux.Handle("/admin/feature_flags", middleware.RequireAdmin(config.AdminAPIKey(), http.HandlerFunc(api.FeatureFlags)))
+	mux.Handle("/content_filter", middleware.RequireBearer("SonaBetaTestAPi", http.HandlerFunc(api.ContentFilter)))
+	mux.Handle("/admin/content_flags", middleware.RequireAdmin(config.AdminAPIKey(), http.HandlerFunc(api.ListContentFlags)))
+	mux.Handle("/admin/review_content_flag", middleware.RequireAdmin(config.AdminAPIKey(), http.HandlerFunc(api.ReviewContentFlag)))
 
 	// wrap with logging middleware
-	handler := middleware.LogRequests(mux)
+	// /v1 routes are rewritten to the legacy routes before the rest sees them
+	handler := middleware.LogRequests(api.V1("SonaBetaTestAPi", middleware.TrackSLO(slos, middleware.Instrument(shedder.Middleware(killSwitches.Middleware(mux))))), config.AdminAPIKey(), config.OpsAPIKey())
 
 	srv := &http.Server{
 		Addr:              "127.0.0.1:33777",
@@ -65,8 +301,66 @@ func main() {
 		IdleTimeout:       60 * time.Second,
 	}
 
-	log.Printf("backend_mini listening on %s", srv.Addr)
-	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+	var opsSrv *http.Server
+	if key := config.OpsAPIKey(); key != "" {
+		opsSrv = &http.Server{
+			Addr:              config.OpsListenAddr(),
+			Handler:           middleware.RequireAdmin(key, ops.Handler(map[string]*sql.DB{"writer": database.SQL, "reader": database.Read})),
+			ReadHeaderTimeout: 10 * time.Second,
+			// CPU profiles and traces stream for up to two minutes
+			WriteTimeout: 3 * time.Minute,
+		}
+		go func() {
+			log.Printf("ops listening on %s", opsSrv.Addr)
+			if err := opsSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Printf("ops server error: %v", err)
+			}
+		}()
+	}
+
+	ln, via, err := listen(ctx, srv.Addr)
+	if err != nil {
+		log.Fatalf("failed to listen on %s: %v", srv.Addr, err)
+	}
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		<-ctx.Done()
+		// back to the default handlers, so a second signal exits at once
+		// instead of waiting out the drain
+		stop()
+		// stop accepting and let in-flight requests finish, so a restart
+		// next to a new process drops nothing
+		log.Printf("draining connections (up to %s)", config.DrainTimeout())
+		drainCtx, cancel := context.WithTimeout(context.Background(), config.DrainTimeout())
+		defer cancel()
+		if err := srv.Shutdown(drainCtx); err != nil {
+			// cancel the stragglers' request contexts so their
+			// transactions roll back before the db closes
+			log.Printf("drain incomplete: %v", err)
+			srv.Close()
+		}
+		if opsSrv != nil {
+			opsSrv.Close()
+		}
+		// jobs saw ctx end; deliveries already started get the rest of
+		// the drain window
+		if err := sched.Wait(drainCtx); err != nil {
+			log.Printf("jobs still running at shutdown: %v", err)
+		}
+		if err := notifier.Wait(drainCtx); err != nil {
+			log.Printf("deliveries still pending at shutdown: %v", err)
+		}
+	}()
+
+	if via != "" {
+		log.Printf("backend_mini listening on %s (%s)", ln.Addr(), via)
+	} else {
+		log.Printf("backend_mini listening on %s", ln.Addr())
+	}
+	if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
 		log.Fatalf("server error: %v", err)
 	}
+	<-drained
+	log.Println("server stopped")
 }
@@ -0,0 +1,13 @@
+//go:build !(linux || darwin || freebsd)
+
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+)
+
+func listenReusePort(ctx context.Context, addr string) (net.Listener, error) {
+	return nil, errors.New("REUSE_PORT is not supported on this platform")
+}
@@ -0,0 +1,283 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Provider struct {
+	Name    string
+	Issuers []string
+	JWKSURL string
+}
+
+var (
+	Apple = Provider{
+		Name:    "apple",
+		Issuers: []string{"https://appleid.apple.com"},
+		JWKSURL: "https://appleid.apple.com/auth/keys",
+	}
+	Google = Provider{
+		Name:    "google",
+		Issuers: []string{"https://accounts.google.com", "accounts.google.com"},
+		JWKSURL: "https://www.googleapis.com/oauth2/v3/certs",
+	}
+)
+
+func ProviderByName(name string) (Provider, bool) {
+	switch strings.ToLower(name) {
+	case Apple.Name:
+		return Apple, true
+	case Google.Name:
+		return Google, true
+	}
+	return Provider{}, false
+}
+
+type IDClaims struct {
+	Issuer        string `json:"iss"`
+	Subject       string `json:"sub"`
+	Audience      any    `json:"aud"`
+	ExpiresAt     int64  `json:"exp"`
+	IssuedAt      int64  `json:"iat"`
+	Email         string `json:"email"`
+	EmailVerified any    `json:"email_verified"`
+	Name          string `json:"name"`
+}
+
+// apple sends email_verified as a string, google as a bool
+func (c IDClaims) IsEmailVerified() bool {
+	switch v := c.EmailVerified.(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	}
+	return false
+}
+
+func (c IDClaims) hasAudience(allowed []string) bool {
+	var auds []string
+	switch v := c.Audience.(type) {
+	case string:
+		auds = []string{v}
+	case []any:
+		for _, a := range v {
+			if s, ok := a.(string); ok {
+				auds = append(auds, s)
+			}
+		}
+	}
+	for _, a := range auds {
+		for _, want := range allowed {
+			if a == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type keyCache struct {
+	mu      sync.Mutex
+	keys    map[string]map[string]*rsa.PublicKey
+	fetched map[string]time.Time
+	// tried is the last fetch started per URL, successful or not;
+	// inflight is the fetch under way, which every caller waits on
+	tried    map[string]time.Time
+	inflight map[string]*jwksFetch
+}
+
+type jwksFetch struct {
+	done chan struct{}
+	keys map[string]*rsa.PublicKey
+	err  error
+}
+
+var jwks = &keyCache{
+	keys:     map[string]map[string]*rsa.PublicKey{},
+	fetched:  map[string]time.Time{},
+	tried:    map[string]time.Time{},
+	inflight: map[string]*jwksFetch{},
+}
+
+const (
+	jwksTTL = time.Hour
+	// jwksMinRefetch spaces out fetches per URL, so tokens with made-up
+	// key ids cannot make every sign-in wait on the provider, or flood it
+	jwksMinRefetch = time.Minute
+)
+
+func (kc *keyCache) get(ctx context.Context, url, kid string) (*rsa.PublicKey, error) {
+	kc.mu.Lock()
+	keys := kc.keys[url]
+	if k, ok := keys[kid]; ok && time.Since(kc.fetched[url]) < jwksTTL {
+		kc.mu.Unlock()
+		return k, nil
+	}
+	// refetch on expiry or unknown kid (provider rotated keys), at most
+	// once per jwksMinRefetch; keys past their TTL serve until then
+	f := kc.inflight[url]
+	if f == nil && time.Since(kc.tried[url]) < jwksMinRefetch {
+		kc.mu.Unlock()
+		if k, ok := keys[kid]; ok {
+			return k, nil
+		}
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if f == nil {
+		f = &jwksFetch{done: make(chan struct{})}
+		kc.inflight[url] = f
+		kc.tried[url] = time.Now()
+		// not tied to ctx: other callers wait on the same fetch
+		go kc.fetch(url, f)
+	}
+	kc.mu.Unlock()
+
+	select {
+	case <-f.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if f.err != nil {
+		return nil, f.err
+	}
+	if k, ok := f.keys[kid]; ok {
+		return k, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+func (kc *keyCache) fetch(url string, f *jwksFetch) {
+	f.keys, f.err = fetchJWKS(context.Background(), url)
+	kc.mu.Lock()
+	if f.err == nil {
+		kc.keys[url] = f.keys
+		kc.fetched[url] = time.Now()
+	}
+	delete(kc.inflight, url)
+	kc.mu.Unlock()
+	close(f.done)
+}
+
+func fetchJWKS(ctx context.Context, url string) (map[string]*rsa.PublicKey, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch jwks: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch jwks: status %d", resp.StatusCode)
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("failed to parse jwks: %w", err)
+	}
+	out := make(map[string]*rsa.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		nb, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			continue
+		}
+		eb, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			continue
+		}
+		out[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(nb), E: int(new(big.Int).SetBytes(eb).Int64())}
+	}
+	return out, nil
+}
+
+// VerifyIDToken checks signature, issuer, audience and expiry of an
+// Apple/Google ID token and returns its claims.
+func VerifyIDToken(ctx context.Context, p Provider, token string, audiences []string) (*IDClaims, error) {
+	if len(audiences) == 0 {
+		return nil, fmt.Errorf("%s sign-in is not configured", p.Name)
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed id token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, errors.New("malformed id token header")
+	}
+	if header.Alg != "RS256" {
+		return nil, fmt.Errorf("unsupported id token alg %q", header.Alg)
+	}
+	key, err := jwks.get(ctx, p.JWKSURL, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("malformed id token signature")
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig); err != nil {
+		return nil, errors.New("invalid id token signature")
+	}
+
+	var claims IDClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, errors.New("malformed id token claims")
+	}
+	validIssuer := false
+	for _, iss := range p.Issuers {
+		if claims.Issuer == iss {
+			validIssuer = true
+			break
+		}
+	}
+	if !validIssuer {
+		return nil, errors.New("invalid id token issuer")
+	}
+	if !claims.hasAudience(audiences) {
+		return nil, errors.New("invalid id token audience")
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, errors.New("id token expired")
+	}
+	return &claims, nil
+}
+
+func decodeSegment(seg string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
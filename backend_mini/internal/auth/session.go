@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+const SessionTTL = 30 * 24 * time.Hour
+
+type SessionClaims struct {
+	Subject   string `json:"sub"`
+	Email     string `json:"email"`
+	Role      string `json:"role"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// IssueSession signs an HS256 session JWT for the given subject.
+func IssueSession(secret []byte, subject, email, role string) (string, time.Time, error) {
+	if len(secret) == 0 {
+		return "", time.Time{}, errors.New("session secret not configured")
+	}
+	now := time.Now().UTC()
+	exp := now.Add(SessionTTL)
+	claims := SessionClaims{Subject: subject, Email: strings.ToLower(email), Role: role, IssuedAt: now.Unix(), ExpiresAt: exp.Unix()}
+	header, _ := json.Marshal(map[string]string{"alg": "HS256", "typ": "JWT"})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	signing := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signing + "." + sign(secret, signing), exp, nil
+}
+
+// ParseSession verifies a session JWT issued by IssueSession.
+func ParseSession(secret []byte, token string) (*SessionClaims, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("session secret not configured")
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed session token")
+	}
+	expected := sign(secret, parts[0]+"."+parts[1])
+	if !hmac.Equal([]byte(expected), []byte(parts[2])) {
+		return nil, errors.New("invalid session signature")
+	}
+	var claims SessionClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, errors.New("malformed session claims")
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, errors.New("session expired")
+	}
+	return &claims, nil
+}
+
+func sign(secret []byte, signing string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signing))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,56 @@
+// Package balance derives a wallet's EURC balance from the chain and the
+// ledger together: the confirmed on-chain amount, adjusted for transfers
+// that were built but may not have landed yet.
+package balance
+
+import (
+	"context"
+	"time"
+
+	"backend_mini/internal/db"
+	"backend_mini/internal/util"
+)
+
+// Balance amounts are EURC micro-units. Available is what can be spent
+// without counting on pending incoming transfers; Projected assumes every
+// pending transfer lands. Locked is held by savings locks and Spendable is
+// what remains of Available once they are set aside.
+type Balance struct {
+	Wallet     string `json:"wallet"`
+	Confirmed  uint64 `json:"confirmed"`
+	PendingIn  uint64 `json:"pending_in"`
+	PendingOut uint64 `json:"pending_out"`
+	Available  uint64 `json:"available"`
+	Projected  uint64 `json:"projected"`
+	Locked     uint64 `json:"locked_savings"`
+	Spendable  uint64 `json:"spendable"`
+}
+
+// Get reads wallet's confirmed balance from the RPC and its pending
+// transfers and savings locks from the database.
+func Get(ctx context.Context, d *db.DB, wallet string) (*Balance, error) {
+	confirmed, err := util.GetEURCBalance(ctx, wallet)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	in, out, err := d.PendingTotals(ctx, wallet, now)
+	if err != nil {
+		return nil, err
+	}
+	locked, err := d.LockedSavings(ctx, wallet, now)
+	if err != nil {
+		return nil, err
+	}
+	b := &Balance{Wallet: wallet, Confirmed: confirmed, PendingIn: in, PendingOut: out, Locked: locked}
+	if out < confirmed {
+		b.Available = confirmed - out
+	}
+	if out < confirmed+in {
+		b.Projected = confirmed + in - out
+	}
+	if locked < b.Available {
+		b.Spendable = b.Available - locked
+	}
+	return b, nil
+}
@@ -0,0 +1,175 @@
+// Package choretext turns a parent's free text, such as "Emma: clean room
+// by Friday for 3 euros", into a chore draft. Drafts are only suggestions:
+// the client shows them and the parent confirms before the chore is
+// created.
+package choretext
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"backend_mini/internal/util"
+)
+
+// Draft is what a parser read from the text. Missing lists the fields it
+// could not find, named as in Draft's JSON.
+type Draft struct {
+	ChoreName string `json:"chore_name"`
+	KidName   string `json:"kid_name,omitempty"`
+	// BountyAmount is in EURC micro-units.
+	BountyAmount uint64   `json:"bounty_amount,omitempty"`
+	DueDate      string   `json:"due_date,omitempty"`
+	Missing      []string `json:"missing,omitempty"`
+	// Parser names the parser that produced the draft.
+	Parser string `json:"parser"`
+}
+
+// Hints are what the parser may rely on besides the text.
+type Hints struct {
+	// Kids are the names of the family's kids.
+	Kids []string
+	// Now is the current time in the family's time zone; relative due
+	// dates are resolved against it.
+	Now time.Time
+}
+
+// Parser reads one chore from free text.
+type Parser interface {
+	Name() string
+	Parse(ctx context.Context, text string, h Hints) (*Draft, error)
+}
+
+var (
+	amountPattern = regexp.MustCompile(`(?i)(?:\bfor\s+)?(?:€\s*([0-9]+(?:[.,][0-9]{1,6})?)|\b([0-9]+(?:[.,][0-9]{1,6})?)\s*(?:€|eurc?\b|euros?\b))`)
+	duePattern    = regexp.MustCompile(`(?i)\b(?:(?:by|before|on|until|due)\s+)?(?:(today|tonight|tomorrow)|(?:next\s+)?(monday|tuesday|wednesday|thursday|friday|saturday|sunday)|(\d{4}-\d{2}-\d{2}))\b`)
+)
+
+var weekdays = map[string]time.Weekday{
+	"sunday": time.Sunday, "monday": time.Monday, "tuesday": time.Tuesday, "wednesday": time.Wednesday,
+	"thursday": time.Thursday, "friday": time.Friday, "saturday": time.Saturday,
+}
+
+// Rules parses with patterns for amounts and dates and the family's kid
+// names. It needs nothing external and is always available.
+type Rules struct{}
+
+func (Rules) Name() string { return "rules" }
+
+func (r Rules) Parse(_ context.Context, text string, h Hints) (*Draft, error) {
+	d := Draft{Parser: r.Name()}
+	text = " " + strings.TrimSpace(text) + " "
+
+	if m := amountPattern.FindStringSubmatchIndex(text); m != nil {
+		num := ""
+		if m[2] >= 0 {
+			num = text[m[2]:m[3]]
+		} else {
+			num = text[m[4]:m[5]]
+		}
+		if amount, err := util.ParseTokenAmount(num, util.EURCDecimals); err == nil {
+			d.BountyAmount = amount
+			text = text[:m[0]] + " " + text[m[1]:]
+		}
+	}
+	if m := duePattern.FindStringSubmatchIndex(text); m != nil {
+		d.DueDate = dueDate(text, m, h.Now)
+		text = text[:m[0]] + " " + text[m[1]:]
+	}
+	d.KidName, text = findKid(text, h.Kids)
+
+	d.ChoreName = tidyName(text)
+	d.Missing = missing(&d)
+	return &d, nil
+}
+
+// dueDate resolves the match m of duePattern: a weekday is its next
+// occurrence, today included unless "next" was said.
+func dueDate(text string, m []int, now time.Time) string {
+	switch {
+	case m[2] >= 0:
+		if strings.EqualFold(text[m[2]:m[3]], "tomorrow") {
+			return now.AddDate(0, 0, 1).Format("2006-01-02")
+		}
+		return now.Format("2006-01-02")
+	case m[4] >= 0:
+		days := (int(weekdays[strings.ToLower(text[m[4]:m[5]])]) - int(now.Weekday()) + 7) % 7
+		if days == 0 && strings.Contains(strings.ToLower(text[m[0]:m[1]]), "next") {
+			days = 7
+		}
+		return now.AddDate(0, 0, days).Format("2006-01-02")
+	}
+	if _, err := time.Parse("2006-01-02", text[m[6]:m[7]]); err != nil {
+		return ""
+	}
+	return text[m[6]:m[7]]
+}
+
+// findKid looks for a kid's name as a whole word, preferring "Emma:" at the
+// start and then "for Emma", and returns the text without it.
+func findKid(text string, kids []string) (string, string) {
+	lower := strings.ToLower(text)
+	for _, k := range kids {
+		prefix := " " + strings.ToLower(k) + ":"
+		if strings.HasPrefix(lower, prefix) {
+			return k, text[len(prefix):]
+		}
+	}
+	for _, form := range []string{" for %s ", " %s should ", " %s to ", " %s "} {
+		for _, k := range kids {
+			needle := strings.Replace(form, "%s", strings.ToLower(k), 1)
+			if i := indexWord(lower, needle); i >= 0 {
+				return k, text[:i] + " " + text[i+len(needle):]
+			}
+		}
+	}
+	return "", text
+}
+
+// indexWord finds needle, which starts and ends with a space, treating
+// punctuation next to a name as a space.
+func indexWord(s, needle string) int {
+	return strings.Index(strings.Map(func(r rune) rune {
+		if r < utf8.RuneSelf && unicode.IsPunct(r) && r != '-' && r != '\'' {
+			return ' '
+		}
+		return r
+	}, s), needle)
+}
+
+var fillers = map[string]bool{"please": true, "for": true, "by": true, "and": true, "to": true, "should": true}
+
+// tidyName is what is left of the text once the amount, due date and kid
+// are taken out, without the words that joined them.
+func tidyName(text string) string {
+	words := strings.Fields(text)
+	bare := func(w string) string { return strings.ToLower(strings.Trim(w, ",.;:!-–—")) }
+	for len(words) > 0 && (fillers[bare(words[0])] || bare(words[0]) == "") {
+		words = words[1:]
+	}
+	for len(words) > 0 && (fillers[bare(words[len(words)-1])] || bare(words[len(words)-1]) == "") {
+		words = words[:len(words)-1]
+	}
+	text = strings.Trim(strings.Join(words, " "), ",.;:!-–— ")
+	if r, size := utf8.DecodeRuneInString(text); size > 0 {
+		text = string(unicode.ToUpper(r)) + text[size:]
+	}
+	return text
+}
+
+func missing(d *Draft) []string {
+	var out []string
+	if d.ChoreName == "" {
+		out = append(out, "chore_name")
+	}
+	if d.KidName == "" {
+		out = append(out, "kid_name")
+	}
+	if d.BountyAmount == 0 {
+		out = append(out, "bounty_amount")
+	}
+	return out
+}
@@ -0,0 +1,122 @@
+package choretext
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"backend_mini/internal/util"
+)
+
+const llmInstructions = `You turn a parent's note into one chore for a family chores app.
+Answer with a JSON object only: {"chore_name": string, "kid_name": string, "bounty_eur": number, "due_date": "YYYY-MM-DD"}.
+chore_name is a short imperative title without the kid, amount or date. kid_name must be one of the kids listed, or "".
+bounty_eur is the reward in euros, 0 when none is given. due_date is "" when no date is given; resolve relative dates against today.`
+
+// LLM asks a chat completions endpoint (the OpenAI API or one compatible
+// with it) to read the text. Its answer is checked against the hints, so a
+// kid it made up or a date it mangled is dropped rather than trusted.
+type LLM struct {
+	Base    string
+	APIKey  string
+	Model   string
+	Timeout time.Duration
+}
+
+func (LLM) Name() string { return "llm" }
+
+func (l LLM) Parse(ctx context.Context, text string, h Hints) (*Draft, error) {
+	ctx, cancel := context.WithTimeout(ctx, l.Timeout)
+	defer cancel()
+	prompt := fmt.Sprintf("Today is %s (%s). Kids: %s.\nNote: %s", h.Now.Format("2006-01-02"), h.Now.Weekday(), strings.Join(h.Kids, ", "), text)
+	body, err := json.Marshal(map[string]any{
+		"model":           l.Model,
+		"temperature":     0,
+		"response_format": map[string]string{"type": "json_object"},
+		"messages": []map[string]string{
+			{"role": "system", "content": llmInstructions},
+			{"role": "user", "content": prompt},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(l.Base, "/")+"/v1/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if l.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+l.APIKey)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("llm: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("llm: http %d", resp.StatusCode)
+	}
+	var out struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("llm: %w", err)
+	}
+	if len(out.Choices) == 0 {
+		return nil, errors.New("llm: no answer")
+	}
+	var ans struct {
+		ChoreName string      `json:"chore_name"`
+		KidName   string      `json:"kid_name"`
+		BountyEUR json.Number `json:"bounty_eur"`
+		DueDate   string      `json:"due_date"`
+	}
+	if err := json.Unmarshal([]byte(out.Choices[0].Message.Content), &ans); err != nil {
+		return nil, fmt.Errorf("llm: answer is not the asked json: %w", err)
+	}
+
+	d := Draft{ChoreName: strings.TrimSpace(ans.ChoreName), Parser: l.Name()}
+	for _, k := range h.Kids {
+		if strings.EqualFold(k, strings.TrimSpace(ans.KidName)) {
+			d.KidName = k
+		}
+	}
+	if ans.BountyEUR != "" {
+		if amount, err := util.ParseTokenAmount(ans.BountyEUR.String(), util.EURCDecimals); err == nil {
+			d.BountyAmount = amount
+		}
+	}
+	if _, err := time.Parse("2006-01-02", ans.DueDate); err == nil && ans.DueDate >= h.Now.Format("2006-01-02") {
+		d.DueDate = ans.DueDate
+	}
+	d.Missing = missing(&d)
+	return &d, nil
+}
+
+// Fallback tries Primary and, when it fails, Secondary, so an outage of an
+// external parser degrades drafts rather than the endpoint.
+type Fallback struct {
+	Primary, Secondary Parser
+}
+
+func (f Fallback) Name() string { return f.Primary.Name() }
+
+func (f Fallback) Parse(ctx context.Context, text string, h Hints) (*Draft, error) {
+	d, err := f.Primary.Parse(ctx, text, h)
+	if err == nil {
+		return d, nil
+	}
+	log.Printf("choretext: %s parser failed, using %s: %v", f.Primary.Name(), f.Secondary.Name(), err)
+	return f.Secondary.Parse(ctx, text, h)
+}
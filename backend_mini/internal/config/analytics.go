@@ -0,0 +1,11 @@
+package config
+
+import "time"
+
+// AnalyticsSnapshotInterval controls how often the database is copied to
+// the snapshot that partner statistics and the warehouse export read.
+// Analytics fall back to the live database once the snapshot is three
+// intervals old.
+func AnalyticsSnapshotInterval() time.Duration {
+	return durationEnv("ANALYTICS_SNAPSHOT_INTERVAL", 15*time.Minute)
+}
@@ -0,0 +1,29 @@
+package config
+
+import (
+	"os"
+	"strings"
+	"time"
+)
+
+// AssistantClientID and AssistantClientSecret are the OAuth client
+// credentials entered in the Alexa or Google Assistant console for account
+// linking. Account linking is off while either is unset.
+func AssistantClientID() string {
+	return strings.TrimSpace(os.Getenv("ASSISTANT_CLIENT_ID"))
+}
+
+func AssistantClientSecret() string {
+	return strings.TrimSpace(os.Getenv("ASSISTANT_CLIENT_SECRET"))
+}
+
+// AssistantRedirectURIs lists the redirect URIs the assistant platforms
+// give for the skill; authorization codes are only sent to these.
+func AssistantRedirectURIs() []string {
+	return splitList(os.Getenv("ASSISTANT_REDIRECT_URIS"))
+}
+
+// AssistantCodeTTL is how long an authorization code can be exchanged.
+func AssistantCodeTTL() time.Duration {
+	return durationEnv("ASSISTANT_CODE_TTL", 5*time.Minute)
+}
@@ -0,0 +1,45 @@
+package config
+
+import (
+	"os"
+	"strings"
+	"time"
+)
+
+// SessionSecret is the HMAC key used to sign session JWTs.
+func SessionSecret() []byte {
+	return []byte(os.Getenv("SESSION_JWT_SECRET"))
+}
+
+// AppleClientIDs lists accepted audiences for Sign in with Apple ID tokens.
+func AppleClientIDs() []string {
+	return splitList(os.Getenv("APPLE_CLIENT_IDS"))
+}
+
+// GoogleClientIDs lists accepted audiences for Google ID tokens.
+func GoogleClientIDs() []string {
+	return splitList(os.Getenv("GOOGLE_CLIENT_IDS"))
+}
+
+// AdminAPIKey is the bearer token for support/admin endpoints. Admin
+// endpoints refuse every request while it is unset.
+func AdminAPIKey() string {
+	return os.Getenv("ADMIN_API_KEY")
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// AccountRecoveryCoolingOff is how long an account recovery waits after it
+// is requested before an admin may complete it, giving the owner of the old
+// email time to notice and cancel.
+func AccountRecoveryCoolingOff() time.Duration {
+	return durationEnv("ACCOUNT_RECOVERY_COOLING_OFF", 72*time.Hour)
+}
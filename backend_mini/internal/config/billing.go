@@ -0,0 +1,100 @@
+package config
+
+import (
+	"os"
+	"strings"
+	"time"
+)
+
+// AppStoreSharedSecret is the app-specific shared secret verifyReceipt
+// needs for auto-renewable subscriptions.
+func AppStoreSharedSecret() string {
+	return strings.TrimSpace(os.Getenv("APP_STORE_SHARED_SECRET"))
+}
+
+// AppStoreBundleID, when set, is the only bundle receipts are accepted for.
+func AppStoreBundleID() string {
+	return strings.TrimSpace(os.Getenv("APP_STORE_BUNDLE_ID"))
+}
+
+// AppStoreVerifyURL and AppStoreSandboxVerifyURL override Apple's
+// verifyReceipt endpoints, for staging against a stub.
+func AppStoreVerifyURL() string {
+	return strings.TrimSpace(os.Getenv("APP_STORE_VERIFY_URL"))
+}
+
+func AppStoreSandboxVerifyURL() string {
+	return strings.TrimSpace(os.Getenv("APP_STORE_SANDBOX_VERIFY_URL"))
+}
+
+// PlayPackageName is the Android application id purchases are looked up
+// under.
+func PlayPackageName() string {
+	return strings.TrimSpace(os.Getenv("PLAY_PACKAGE_NAME"))
+}
+
+// PlayServiceAccountFile is the JSON key of a service account with access
+// to the app in the Play Console. Unset, Play purchases cannot be validated.
+func PlayServiceAccountFile() string {
+	return strings.TrimSpace(os.Getenv("PLAY_SERVICE_ACCOUNT_FILE"))
+}
+
+// PlayAPIBase overrides the Android Publisher API base URL.
+func PlayAPIBase() string {
+	return strings.TrimSpace(os.Getenv("PLAY_API_BASE"))
+}
+
+// PremiumMaxKids is the kids quota of premium families.
+func PremiumMaxKids() int {
+	return intEnv("QUOTA_MAX_KIDS_PREMIUM", 50)
+}
+
+// FreeUsageRangeDays is the longest usage history a family without
+// premium can ask for at once; longer ranges are advanced analytics.
+func FreeUsageRangeDays() int {
+	return intEnv("USAGE_FREE_RANGE_DAYS", 31)
+}
+
+// StripeSecretKey is the API key web subscriptions are managed with.
+// Unset, web checkout is off.
+func StripeSecretKey() string {
+	return strings.TrimSpace(os.Getenv("STRIPE_SECRET_KEY"))
+}
+
+// StripeWebhookSecret is the signing secret of the Stripe webhook
+// endpoint. Unset, Stripe events are refused.
+func StripeWebhookSecret() string {
+	return strings.TrimSpace(os.Getenv("STRIPE_WEBHOOK_SECRET"))
+}
+
+// StripeAPIBase overrides the Stripe API base URL.
+func StripeAPIBase() string {
+	return strings.TrimSpace(os.Getenv("STRIPE_API_BASE"))
+}
+
+// StripePrices are the price ids families may subscribe or switch to; the
+// first is the default at checkout.
+func StripePrices() []string {
+	return splitList(os.Getenv("STRIPE_PRICES"))
+}
+
+// StripeSuccessURL and StripeCancelURL are where Checkout sends the parent
+// back to after paying or giving up.
+func StripeSuccessURL() string {
+	if v := strings.TrimSpace(os.Getenv("STRIPE_SUCCESS_URL")); v != "" {
+		return v
+	}
+	return "https://sona.app/billing/success"
+}
+
+func StripeCancelURL() string {
+	if v := strings.TrimSpace(os.Getenv("STRIPE_CANCEL_URL")); v != "" {
+		return v
+	}
+	return "https://sona.app/billing/canceled"
+}
+
+// StripeWebhookTolerance is how old a signed Stripe event may be.
+func StripeWebhookTolerance() time.Duration {
+	return durationEnv("STRIPE_WEBHOOK_TOLERANCE", 5*time.Minute)
+}
@@ -0,0 +1,44 @@
+package config
+
+import (
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// AgeBaseline is the typical chore bounty, in EURC micro-units, for kids of
+// at least MinAge.
+type AgeBaseline struct {
+	MinAge int    `json:"min_age"`
+	Amount uint64 `json:"amount"`
+}
+
+var defaultBountyBaselines = []AgeBaseline{
+	{MinAge: 0, Amount: 500000},
+	{MinAge: 8, Amount: 1000000},
+	{MinAge: 12, Amount: 2000000},
+	{MinAge: 15, Amount: 3000000},
+}
+
+// BountyBaselines reads BOUNTY_BASELINES as "age:amount,age:amount", e.g.
+// "0:500000,10:1500000". Entries are sorted by age; an unparsable value
+// falls back to the defaults.
+func BountyBaselines() []AgeBaseline {
+	v := os.Getenv("BOUNTY_BASELINES")
+	if v == "" {
+		return defaultBountyBaselines
+	}
+	var out []AgeBaseline
+	for _, part := range strings.Split(v, ",") {
+		age, amount, ok := strings.Cut(strings.TrimSpace(part), ":")
+		a, err1 := strconv.Atoi(age)
+		n, err2 := strconv.ParseUint(amount, 10, 64)
+		if !ok || err1 != nil || err2 != nil || a < 0 {
+			return defaultBountyBaselines
+		}
+		out = append(out, AgeBaseline{MinAge: a, Amount: n})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].MinAge < out[j].MinAge })
+	return out
+}
@@ -0,0 +1,48 @@
+package config
+
+import (
+	"os"
+	"strings"
+	"time"
+)
+
+// ChoreClaimTTL is how long a kid who claimed an open chore has to start it
+// (move it past assigned) before it is reopened to the family.
+func ChoreClaimTTL() time.Duration {
+	return durationEnv("CHORE_CLAIM_TTL", 24*time.Hour)
+}
+
+// ChoreNameMaxLen caps chore names, in characters after sanitization.
+func ChoreNameMaxLen() int {
+	return intEnv("CHORE_NAME_MAX_LEN", 100)
+}
+
+// ChoreDescriptionMaxLen caps chore descriptions, in characters after
+// sanitization. Descriptions end up in NFT metadata, so keep this small.
+func ChoreDescriptionMaxLen() int {
+	return intEnv("CHORE_DESCRIPTION_MAX_LEN", 1000)
+}
+
+// ChoreParserLLMURL is the base URL of a chat completions API (the OpenAI
+// API or one compatible with it) /parse_chore reads free text with. Unset,
+// only the built-in rules parser is used.
+func ChoreParserLLMURL() string {
+	return strings.TrimSpace(os.Getenv("CHORE_PARSER_LLM_URL"))
+}
+
+func ChoreParserLLMKey() string {
+	return strings.TrimSpace(os.Getenv("CHORE_PARSER_LLM_KEY"))
+}
+
+func ChoreParserLLMModel() string {
+	if v := strings.TrimSpace(os.Getenv("CHORE_PARSER_LLM_MODEL")); v != "" {
+		return v
+	}
+	return "gpt-4o-mini"
+}
+
+// ChoreParserLLMTimeout bounds one LLM call; past it the rules parser
+// answers instead.
+func ChoreParserLLMTimeout() time.Duration {
+	return durationEnv("CHORE_PARSER_LLM_TIMEOUT", 8*time.Second)
+}
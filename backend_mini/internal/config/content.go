@@ -0,0 +1,28 @@
+package config
+
+import (
+	"os"
+	"strings"
+)
+
+// defaultProfanity is deliberately short: families that need more set
+// PROFANITY_WORDS, and the admin review queue catches what slips through.
+var defaultProfanity = []string{"fuck", "shit", "bitch", "asshole", "bastard", "cunt", "dick", "piss", "wanker", "slut", "whore", "crap", "damn"}
+
+// ProfanityWords is the word list the kid content filter masks, lower
+// case. PROFANITY_WORDS replaces the built-in list.
+func ProfanityWords() []string {
+	if v := splitList(os.Getenv("PROFANITY_WORDS")); len(v) > 0 {
+		for i := range v {
+			v[i] = strings.ToLower(v[i])
+		}
+		return v
+	}
+	return defaultProfanity
+}
+
+// SubmissionNoteMaxLen caps the note a kid attaches when submitting a
+// chore, in characters after sanitization.
+func SubmissionNoteMaxLen() int {
+	return intEnv("SUBMISSION_NOTE_MAX_LEN", 500)
+}
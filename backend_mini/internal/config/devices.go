@@ -0,0 +1,22 @@
+package config
+
+import (
+	"os"
+	"strings"
+	"time"
+)
+
+// DeviceSigningRequired makes usage reports and chore submissions from kid
+// devices carry a valid device signature (DEVICE_SIGNING=required).
+// Otherwise unsigned requests are still accepted while apps roll out
+// signing, though a signature that is present must be valid.
+func DeviceSigningRequired() bool {
+	return strings.EqualFold(strings.TrimSpace(os.Getenv("DEVICE_SIGNING")), "required")
+}
+
+// DeviceSignatureSkew is how far a signed request's timestamp may be from
+// the server clock, which bounds how long a captured request can be
+// replayed.
+func DeviceSignatureSkew() time.Duration {
+	return durationEnv("DEVICE_SIGNATURE_SKEW", 5*time.Minute)
+}
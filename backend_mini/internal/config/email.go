@@ -0,0 +1,30 @@
+package config
+
+import (
+	"os"
+	"strings"
+)
+
+// SMTPAddr is the host:port of the mail relay emails go out through.
+// Unset, emails are only logged.
+func SMTPAddr() string {
+	return strings.TrimSpace(os.Getenv("SMTP_ADDR"))
+}
+
+// SMTPFrom is the sender address of outgoing email.
+func SMTPFrom() string {
+	if v := strings.TrimSpace(os.Getenv("SMTP_FROM")); v != "" {
+		return v
+	}
+	return "Sona <no-reply@sona.app>"
+}
+
+// SMTPUsername and SMTPPassword authenticate to the relay with PLAIN auth
+// when set.
+func SMTPUsername() string {
+	return strings.TrimSpace(os.Getenv("SMTP_USERNAME"))
+}
+
+func SMTPPassword() string {
+	return os.Getenv("SMTP_PASSWORD")
+}
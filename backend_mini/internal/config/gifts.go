@@ -0,0 +1,40 @@
+package config
+
+import (
+	"os"
+	"strings"
+	"time"
+)
+
+// GiftTTL is how long a gift link stays open.
+func GiftTTL() time.Duration {
+	return durationEnv("GIFT_TTL", 30*24*time.Hour)
+}
+
+// GiftLinkBase is prepended to a gift's token to make the link sent to the
+// relative, e.g. "https://gift.example.com/g/". Unset, links point at this
+// server's /gift/ endpoint.
+func GiftLinkBase() string {
+	if v := strings.TrimSpace(os.Getenv("GIFT_LINK_BASE")); v != "" {
+		return v
+	}
+	return "/gift/"
+}
+
+// GiftOnrampURL is a card on-ramp URL template with {wallet} and {amount}
+// (in EURC, empty when the relative chooses) placeholders. Unset, gift
+// links offer Solana Pay only.
+func GiftOnrampURL() string {
+	return strings.TrimSpace(os.Getenv("GIFT_ONRAMP_URL"))
+}
+
+// GiftMessageMaxLen caps a relative's message to the kid, in characters
+// after sanitization.
+func GiftMessageMaxLen() int {
+	return intEnv("GIFT_MESSAGE_MAX_LEN", 500)
+}
+
+// GiftWatchInterval controls how often waiting gifts are checked on chain.
+func GiftWatchInterval() time.Duration {
+	return durationEnv("GIFT_WATCH_INTERVAL", time.Minute)
+}
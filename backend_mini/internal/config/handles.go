@@ -0,0 +1,43 @@
+package config
+
+import (
+	"os"
+	"strings"
+	"time"
+)
+
+// defaultReservedHandles are words no family may take as a handle because
+// they name the product, its pages or its staff.
+var defaultReservedHandles = []string{
+	"about", "admin", "administrator", "api", "app", "apps", "billing", "blog", "careers", "contact",
+	"dashboard", "docs", "download", "family", "gift", "gifts", "help", "home", "invite", "join",
+	"legal", "login", "logout", "mod", "moderator", "news", "official", "parent", "partner", "partners",
+	"press", "privacy", "root", "security", "settings", "share", "signin", "signup", "sona", "staff",
+	"status", "support", "system", "team", "terms", "www",
+}
+
+// ReservedHandles are refused as handles, lower case: the built-in list
+// plus any in HANDLE_RESERVED (comma-separated).
+func ReservedHandles() []string {
+	out := append([]string{}, defaultReservedHandles...)
+	for _, v := range splitList(os.Getenv("HANDLE_RESERVED")) {
+		out = append(out, strings.ToLower(v))
+	}
+	return out
+}
+
+// HandleHold is how long a handle a family moved away from keeps
+// redirecting to its new one before anyone else may claim it.
+func HandleHold() time.Duration {
+	return durationEnv("HANDLE_HOLD", 180*24*time.Hour)
+}
+
+// HandleLinkBase is prepended to "handle/gift/token" in gift links of
+// families with a handle, e.g. "https://sona.app/@". Unset, links point at
+// this server's /share/@ endpoint.
+func HandleLinkBase() string {
+	if v := strings.TrimSpace(os.Getenv("HANDLE_LINK_BASE")); v != "" {
+		return v
+	}
+	return "/share/@"
+}
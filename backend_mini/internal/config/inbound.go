@@ -0,0 +1,25 @@
+package config
+
+import (
+	"os"
+	"strings"
+)
+
+// InboundEmailSecret is the last path segment of the inbound email
+// webhook, /inbound/email/{secret}, which is all the provider can be given
+// to prove it is the sender. Unset, the gateway is off.
+func InboundEmailSecret() string {
+	return strings.TrimSpace(os.Getenv("INBOUND_EMAIL_SECRET"))
+}
+
+// InboundEmailRequireAuth makes the gateway drop mail whose sender domain
+// passed neither SPF nor DKIM. INBOUND_EMAIL_REQUIRE_AUTH=false turns it
+// off for providers that do not report either.
+func InboundEmailRequireAuth() bool {
+	return os.Getenv("INBOUND_EMAIL_REQUIRE_AUTH") != "false"
+}
+
+// InboundEmailMaxChores caps the chores one email can create.
+func InboundEmailMaxChores() int {
+	return intEnv("INBOUND_EMAIL_MAX_CHORES", 10)
+}
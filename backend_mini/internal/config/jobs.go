@@ -0,0 +1,69 @@
+package config
+
+import (
+	"os"
+	"strings"
+	"time"
+)
+
+// JobSchedule is the cron expression for a background job, read from
+// SCHEDULE_<JOB>, e.g. SCHEDULE_STATEMENT_CLOSE="CRON_TZ=Europe/Berlin 0 2 1 * *".
+// Empty means the job keeps running on its interval.
+func JobSchedule(job string) string {
+	return strings.TrimSpace(os.Getenv("SCHEDULE_" + strings.ToUpper(job)))
+}
+
+// AlertCheckInterval controls how often balance alerts are evaluated.
+func AlertCheckInterval() time.Duration {
+	return durationEnv("ALERT_CHECK_INTERVAL", 5*time.Minute)
+}
+
+// LocationPurgeInterval controls how often expired location reports are deleted.
+func LocationPurgeInterval() time.Duration {
+	return durationEnv("LOCATION_PURGE_INTERVAL", 15*time.Minute)
+}
+
+// CalendarSyncInterval controls how often family calendar feeds are refreshed.
+func CalendarSyncInterval() time.Duration {
+	return durationEnv("CALENDAR_SYNC_INTERVAL", 6*time.Hour)
+}
+
+// StatementCloseInterval controls how often ended months are closed into statements.
+func StatementCloseInterval() time.Duration {
+	return durationEnv("STATEMENT_CLOSE_INTERVAL", time.Hour)
+}
+
+// AnomalyScanInterval controls how often new transfers are checked for anomalies.
+func AnomalyScanInterval() time.Duration {
+	return durationEnv("ANOMALY_SCAN_INTERVAL", time.Minute)
+}
+
+// ATAProvisionInterval controls how often missing family token accounts are created.
+func ATAProvisionInterval() time.Duration {
+	return durationEnv("ATA_PROVISION_INTERVAL", 30*time.Minute)
+}
+
+// LedgerAnchorInterval controls how often the ledger chain head is published on-chain.
+func LedgerAnchorInterval() time.Duration {
+	return durationEnv("LEDGER_ANCHOR_INTERVAL", 24*time.Hour)
+}
+
+// ChoreClaimSweepInterval controls how often lapsed chore claims are reopened.
+func ChoreClaimSweepInterval() time.Duration {
+	return durationEnv("CHORE_CLAIM_SWEEP_INTERVAL", time.Minute)
+}
+
+// ChoreAutoApproveInterval controls how often submitted chores are checked
+// against their family's auto-approval setting.
+func ChoreAutoApproveInterval() time.Duration {
+	return durationEnv("CHORE_AUTO_APPROVE_INTERVAL", 5*time.Minute)
+}
+
+func durationEnv(key string, def time.Duration) time.Duration {
+	if v := os.Getenv(key); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d
+		}
+	}
+	return def
+}
@@ -0,0 +1,52 @@
+package config
+
+import (
+	"os"
+	"strings"
+	"time"
+)
+
+var defaultMoneyRoutes = []string{
+	"/eurc_tx", "/update_chore", "/rebuild_tx/", "/decide_unlock", "/create_gift", "/gift/", "/share/",
+	"/mint_nft", "/upd_nft", "/accept_nft", "/reverse_tx", "/acknowledge_reversal", "/run_action",
+}
+
+var defaultMaintenanceReadRoutes = []string{
+	"/get_chores", "/chore/", "/get_limits", "/list_kids", "/kid_balance", "/messages", "/poll_events",
+	"/statements", "/statements/", "/get_usage", "/list_gifts", "/list_savings_locks", "/list_devices",
+	"/poll_commands", "/get_policy", "/get_split_rule", "/get_webhooks",
+}
+
+// MoneyRoutes are the routes the "money" kill switch takes down: everything
+// that builds a transfer or starts a payment. A route ending in "/" covers
+// everything below it. MONEY_ROUTES replaces the list.
+func MoneyRoutes() []string {
+	if v := splitList(os.Getenv("MONEY_ROUTES")); len(v) > 0 {
+		return v
+	}
+	return defaultMoneyRoutes
+}
+
+// MaintenanceReadRoutes stay up in maintenance mode, along with /admin/.
+// MAINTENANCE_READ_ROUTES replaces the list.
+func MaintenanceReadRoutes() []string {
+	if v := splitList(os.Getenv("MAINTENANCE_READ_ROUTES")); len(v) > 0 {
+		return v
+	}
+	return defaultMaintenanceReadRoutes
+}
+
+// KillSwitchRefresh is how often each server rereads the kill switches,
+// and so how long a switch flipped on another server takes to apply here.
+func KillSwitchRefresh() time.Duration {
+	return durationEnv("KILL_SWITCH_REFRESH", 2*time.Second)
+}
+
+// KillSwitchMessage is what turned-away clients are told when the switch
+// was flipped without a message of its own.
+func KillSwitchMessage() string {
+	if v := strings.TrimSpace(os.Getenv("KILL_SWITCH_MESSAGE")); v != "" {
+		return v
+	}
+	return "This is switched off for a short while as we fix a problem. Your money is safe; please try again soon."
+}
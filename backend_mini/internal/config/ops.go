@@ -0,0 +1,46 @@
+package config
+
+import (
+	"os"
+	"strings"
+	"time"
+)
+
+// OpsAPIKey is the bearer token for the ops listener (pprof, runtime
+// stats and metrics). The listener only starts while it is set.
+func OpsAPIKey() string {
+	return os.Getenv("OPS_API_KEY")
+}
+
+// OpsListenAddr is where the ops listener binds. Keep it off public
+// interfaces: profiles expose the process's memory.
+func OpsListenAddr() string {
+	if v := os.Getenv("OPS_LISTEN_ADDR"); v != "" {
+		return v
+	}
+	return "127.0.0.1:33778"
+}
+
+// DrainTimeout is how long a stopping server waits for in-flight requests
+// to finish before closing their connections.
+func DrainTimeout() time.Duration {
+	return durationEnv("DRAIN_TIMEOUT", 30*time.Second)
+}
+
+// StateBackend selects where rate limits and long-poll wakeups live:
+// "local" (the default) keeps them in process, "redis" shares them between
+// instances through RedisURL.
+func StateBackend() string {
+	if v := strings.ToLower(strings.TrimSpace(os.Getenv("STATE_BACKEND"))); v != "" {
+		return v
+	}
+	return "local"
+}
+
+// RedisURL is redis://[:password@]host[:port][/db].
+func RedisURL() string {
+	if v := os.Getenv("REDIS_URL"); v != "" {
+		return v
+	}
+	return "redis://127.0.0.1:6379/0"
+}
@@ -0,0 +1,13 @@
+package config
+
+import (
+	"os"
+	"strings"
+)
+
+// OutboundAllowPrivate lets webhooks, integrations and calendar feeds
+// reach loopback and private addresses (OUTBOUND_ALLOW_PRIVATE=1). It is
+// for local development only: in production those URLs are user input.
+func OutboundAllowPrivate() bool {
+	return strings.TrimSpace(os.Getenv("OUTBOUND_ALLOW_PRIVATE")) == "1"
+}
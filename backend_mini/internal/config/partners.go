@@ -0,0 +1,27 @@
+package config
+
+import (
+	"os"
+	"strings"
+)
+
+// DataSharingTermsVersion is the current version of the partner
+// data-sharing terms. Only families whose consent names this version are
+// counted, so publishing new terms drops everyone until they agree again.
+func DataSharingTermsVersion() string {
+	if v := strings.TrimSpace(os.Getenv("DATA_SHARING_TERMS_VERSION")); v != "" {
+		return v
+	}
+	return "v1"
+}
+
+// PartnerMinFamilies is the fewest consenting families a partner statistic
+// must cover; smaller groups are suppressed.
+func PartnerMinFamilies() int {
+	return intEnv("PARTNER_MIN_FAMILIES", 10)
+}
+
+// PartnerScreenTimeDays is the window partner screen time averages cover.
+func PartnerScreenTimeDays() int {
+	return intEnv("PARTNER_SCREEN_TIME_DAYS", 30)
+}
@@ -0,0 +1,14 @@
+package config
+
+import "time"
+
+// KidPINMaxAttempts is how many wrong kid PINs in a row lock the PIN.
+func KidPINMaxAttempts() int {
+	return intEnv("KID_PIN_MAX_ATTEMPTS", 5)
+}
+
+// KidPINLockout is how long a kid PIN stays locked after too many wrong
+// attempts. A parent resetting the PIN lifts the lockout early.
+func KidPINLockout() time.Duration {
+	return durationEnv("KID_PIN_LOCKOUT", 15*time.Minute)
+}
@@ -0,0 +1,22 @@
+package config
+
+// QuotaMaxKids caps the kids in one family.
+func QuotaMaxKids() int {
+	return intEnv("QUOTA_MAX_KIDS", 20)
+}
+
+// QuotaMaxOpenChores caps a family's chores that are not yet approved or
+// rejected.
+func QuotaMaxOpenChores() int {
+	return intEnv("QUOTA_MAX_OPEN_CHORES", 500)
+}
+
+// QuotaMaxLimits caps the app limits across a family's kids.
+func QuotaMaxLimits() int {
+	return intEnv("QUOTA_MAX_LIMITS", 500)
+}
+
+// QuotaMaxWebhooks caps a family's webhooks.
+func QuotaMaxWebhooks() int {
+	return intEnv("QUOTA_MAX_WEBHOOKS", 10)
+}
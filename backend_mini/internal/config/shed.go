@@ -0,0 +1,27 @@
+package config
+
+import "os"
+
+var defaultLowPriorityRoutes = []string{"/poll_events", "/get_usage", "/statements", "/statements/", "/suggest_bounty", "/limit_history", "/policy_history"}
+
+// ShedMaxInFlight is how many requests may be in flight before
+// low-priority requests are turned away.
+func ShedMaxInFlight() int {
+	return intEnv("SHED_MAX_IN_FLIGHT", 200)
+}
+
+// ShedMaxDBWaits is how many waits for a database connection per second
+// mark the database as backed up, which also sheds low-priority requests.
+func ShedMaxDBWaits() int {
+	return intEnv("SHED_MAX_DB_WAITS", 50)
+}
+
+// LowPriorityRoutes are shed under load: analytics and polling that
+// clients retry anyway. A route ending in "/" covers everything below it.
+// LOW_PRIORITY_ROUTES replaces the list.
+func LowPriorityRoutes() []string {
+	if v := splitList(os.Getenv("LOW_PRIORITY_ROUTES")); len(v) > 0 {
+		return v
+	}
+	return defaultLowPriorityRoutes
+}
@@ -0,0 +1,74 @@
+package config
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SLOTarget is a latency objective for one route: Percentile percent of
+// requests must finish within Threshold without a 5xx.
+type SLOTarget struct {
+	Route      string
+	Percentile float64
+	Threshold  time.Duration
+}
+
+var defaultSLOTargets = []SLOTarget{
+	{Route: "/eurc_tx", Percentile: 95, Threshold: 800 * time.Millisecond},
+	{Route: "/update_chore", Percentile: 95, Threshold: 800 * time.Millisecond},
+	{Route: "/rebuild_tx", Percentile: 95, Threshold: 800 * time.Millisecond},
+	{Route: "/get_chores", Percentile: 95, Threshold: 300 * time.Millisecond},
+	{Route: "/get_limits", Percentile: 95, Threshold: 300 * time.Millisecond},
+}
+
+// SLOTargets reads SLO_TARGETS as "route=threshold@percentile,...", e.g.
+// "/eurc_tx=800ms@95,/get_chores=300ms@99". The percentile defaults to 95.
+// An unparsable value falls back to the defaults.
+func SLOTargets() []SLOTarget {
+	v := os.Getenv("SLO_TARGETS")
+	if v == "" {
+		return defaultSLOTargets
+	}
+	var out []SLOTarget
+	for _, part := range strings.Split(v, ",") {
+		route, spec, ok := strings.Cut(strings.TrimSpace(part), "=")
+		threshold, pct, hasPct := strings.Cut(spec, "@")
+		d, err := time.ParseDuration(threshold)
+		if !ok || !strings.HasPrefix(route, "/") || err != nil || d <= 0 {
+			return defaultSLOTargets
+		}
+		t := SLOTarget{Route: route, Percentile: 95, Threshold: d}
+		if hasPct {
+			p, err := strconv.ParseFloat(pct, 64)
+			if err != nil || p <= 0 || p >= 100 {
+				return defaultSLOTargets
+			}
+			t.Percentile = p
+		}
+		out = append(out, t)
+	}
+	return out
+}
+
+// SLOAlertBurnRate is how fast a route must be spending its error budget,
+// over both the 5 minute and 1 hour windows, before an slo.burn_rate alert
+// is sent. 1 spends exactly the budget.
+func SLOAlertBurnRate() float64 {
+	if f, err := strconv.ParseFloat(os.Getenv("SLO_ALERT_BURN_RATE"), 64); err == nil && f > 0 {
+		return f
+	}
+	return 2
+}
+
+// OpsWebhookURL receives operational alerts such as SLO burn, signed with
+// OpsWebhookSecret like parent webhooks. Alerts are only logged while it
+// is unset.
+func OpsWebhookURL() string {
+	return os.Getenv("OPS_WEBHOOK_URL")
+}
+
+func OpsWebhookSecret() string {
+	return os.Getenv("OPS_WEBHOOK_SECRET")
+}
@@ -0,0 +1,19 @@
+package config
+
+import "time"
+
+// TokenRatePerMinute is the request budget of each personal access token.
+// The mobile app key is not rate limited.
+func TokenRatePerMinute() int {
+	return intEnv("TOKEN_RATE_PER_MINUTE", 60)
+}
+
+// ActionTokenTTL is how long an action token lasts when the app does not
+// ask for less; ActionTokenMaxTTL is the most it may ask for.
+func ActionTokenTTL() time.Duration {
+	return durationEnv("ACTION_TOKEN_TTL", 10*time.Minute)
+}
+
+func ActionTokenMaxTTL() time.Duration {
+	return durationEnv("ACTION_TOKEN_MAX_TTL", 24*time.Hour)
+}
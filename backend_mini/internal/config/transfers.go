@@ -0,0 +1,32 @@
+package config
+
+import (
+	"os"
+	"time"
+)
+
+// DuplicateTransferWindow is how far back an identical (from, to, amount)
+// transfer counts as a duplicate of a new one.
+func DuplicateTransferWindow() time.Duration {
+	return durationEnv("DUPLICATE_TRANSFER_WINDOW", 2*time.Minute)
+}
+
+// DuplicateTransferBlocks reports whether duplicates are refused unless the
+// request sets force (DUPLICATE_TRANSFER_MODE=block, the default) or only
+// flagged in the response (DUPLICATE_TRANSFER_MODE=warn).
+func DuplicateTransferBlocks() bool {
+	return os.Getenv("DUPLICATE_TRANSFER_MODE") != "warn"
+}
+
+// TransactionValidity is how long a built transaction counts as signable
+// before /rebuild_tx may replace it. Solana drops a blockhash after about
+// 150 blocks, a little over a minute.
+func TransactionValidity() time.Duration {
+	return durationEnv("TX_VALIDITY", 60*time.Second)
+}
+
+// ReversalWindow is how long after it was built a transfer may still be
+// reversed with /reverse_tx.
+func ReversalWindow() time.Duration {
+	return durationEnv("REVERSAL_WINDOW", 30*24*time.Hour)
+}
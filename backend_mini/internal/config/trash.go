@@ -0,0 +1,13 @@
+package config
+
+import "time"
+
+// TrashRetention is how long deleted chores and limits stay restorable.
+func TrashRetention() time.Duration {
+	return durationEnv("TRASH_RETENTION", 30*24*time.Hour)
+}
+
+// TrashPurgeInterval controls how often expired trash is dropped for good.
+func TrashPurgeInterval() time.Duration {
+	return durationEnv("TRASH_PURGE_INTERVAL", time.Hour)
+}
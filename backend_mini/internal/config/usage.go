@@ -0,0 +1,25 @@
+package config
+
+import (
+	"os"
+	"strconv"
+)
+
+// UsageMaxBatchRecords caps how many NDJSON records one /report_usage call may carry.
+func UsageMaxBatchRecords() int {
+	return intEnv("USAGE_MAX_BATCH_RECORDS", 5000)
+}
+
+// UsageMaxBatchBytes caps the decompressed size of one /report_usage body.
+func UsageMaxBatchBytes() int64 {
+	return int64(intEnv("USAGE_MAX_BATCH_BYTES", 2<<20))
+}
+
+func intEnv(key string, def int) int {
+	if v := os.Getenv(key); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return n
+		}
+	}
+	return def
+}
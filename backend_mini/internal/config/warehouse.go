@@ -0,0 +1,19 @@
+package config
+
+import (
+	"os"
+	"strings"
+	"time"
+)
+
+// WarehouseExportDir is where the warehouse export writes its files, e.g.
+// a bucket mounted with gcsfuse or s3fs. Unset, nothing is exported.
+func WarehouseExportDir() string {
+	return strings.TrimSpace(os.Getenv("WAREHOUSE_EXPORT_DIR"))
+}
+
+// WarehouseExportInterval controls how often changed rows are exported
+// when SCHEDULE_WAREHOUSE_EXPORT does not pin it to a time of night.
+func WarehouseExportInterval() time.Duration {
+	return durationEnv("WAREHOUSE_EXPORT_INTERVAL", 24*time.Hour)
+}
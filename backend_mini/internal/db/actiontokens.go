@@ -0,0 +1,99 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"backend_mini/internal/util"
+)
+
+// ActionTokenPrefix marks single-action tokens handed to system shortcuts.
+const ActionTokenPrefix = "sona_act_"
+
+// Actions an action token can stand for.
+const (
+	ActionApproveChore = "approve_chore"
+	ActionSend         = "send"
+)
+
+// ErrActionTokenNotFound means the token is unknown, expired or used.
+var ErrActionTokenNotFound = errors.New("action token not found")
+
+// ActionToken lets whoever holds it do one thing once: approve ChoreID, or
+// send Amount from the parent to KidEmail. Only its SHA-256 is stored.
+type ActionToken struct {
+	TokenID     string `json:"token_id"`
+	ParentEmail string `json:"parent_email"`
+	Action      string `json:"action"`
+	ChoreID     string `json:"chore_id,omitempty"`
+	KidEmail    string `json:"kid_email,omitempty"`
+	Amount      uint64 `json:"amount,omitempty"`
+	CreatedAt   string `json:"created_at"`
+	ExpiresAt   string `json:"expires_at"`
+	UsedAt      string `json:"used_at,omitempty"`
+}
+
+const actionTokenColumns = `token_id, parent_email, action, chore_id, kid_email, amount, created_at, expires_at, used_at`
+
+func scanActionToken(row rowScanner, t *ActionToken) error {
+	return row.Scan(&t.TokenID, &t.ParentEmail, &t.Action, &t.ChoreID, &t.KidEmail, &t.Amount, &t.CreatedAt, &t.ExpiresAt, &t.UsedAt)
+}
+
+// CreateActionToken issues t and returns it with its raw value, which is
+// never shown again.
+func (d *DB) CreateActionToken(ctx context.Context, t ActionToken, ttl time.Duration) (*ActionToken, string, error) {
+	id, err := util.NewID()
+	if err != nil {
+		return nil, "", err
+	}
+	raw, err := newSecret(ActionTokenPrefix + strings.ToLower(id) + "_")
+	if err != nil {
+		return nil, "", err
+	}
+	now := time.Now().UTC()
+	t.TokenID = id
+	t.ParentEmail, t.KidEmail = strings.ToLower(t.ParentEmail), strings.ToLower(t.KidEmail)
+	t.CreatedAt, t.ExpiresAt = now.Format(time.RFC3339), now.Add(ttl).Format(time.RFC3339)
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `INSERT INTO action_tokens (token_id, parent_email, action, chore_id, kid_email, amount, token_hash, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		t.TokenID, t.ParentEmail, t.Action, t.ChoreID, t.KidEmail, t.Amount, hashToken(raw), t.CreatedAt, t.ExpiresAt); err != nil {
+		return nil, "", err
+	}
+	if err := writeAudit(ctx, tx, t.ParentEmail, "action_token.create", t.ParentEmail, t.TokenID+" "+t.Action); err != nil {
+		return nil, "", err
+	}
+	return &t, raw, tx.Commit()
+}
+
+// UseActionToken burns a raw token that is unused and unexpired and
+// returns what it stands for. Only one caller can ever get it.
+func (d *DB) UseActionToken(ctx context.Context, raw string, now time.Time) (*ActionToken, error) {
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	stamp := now.UTC().Format(time.RFC3339)
+	res, err := tx.ExecContext(ctx, `UPDATE action_tokens SET used_at=? WHERE token_hash=? AND used_at='' AND expires_at>?`, stamp, hashToken(raw), stamp)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, ErrActionTokenNotFound
+	}
+	var t ActionToken
+	if err := scanActionToken(tx.QueryRowContext(ctx, `SELECT `+actionTokenColumns+` FROM action_tokens WHERE token_hash=?`, hashToken(raw)), &t); err != nil {
+		return nil, err
+	}
+	if err := writeAudit(ctx, tx, "action:"+t.TokenID, "action_token.use", t.ParentEmail, t.Action); err != nil {
+		return nil, err
+	}
+	return &t, tx.Commit()
+}
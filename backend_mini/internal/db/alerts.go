@@ -0,0 +1,131 @@
+package db
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"backend_mini/internal/util"
+)
+
+const (
+	AlertBelow = "below"
+	AlertAbove = "above"
+
+	AlertStateOK        = "ok"
+	AlertStateTriggered = "triggered"
+)
+
+type BalanceAlert struct {
+	AlertID       string `json:"alert_id"`
+	ParentEmail   string `json:"parent_email"`
+	KidEmail      string `json:"kid_email"`
+	Direction     string `json:"direction"`
+	Threshold     uint64 `json:"threshold"`
+	State         string `json:"state"`
+	LastBalance   uint64 `json:"last_balance"`
+	LastCheckedAt string `json:"last_checked_at"`
+	TriggeredAt   string `json:"triggered_at"`
+	CreatedAt     string `json:"created_at"`
+}
+
+type AlertRule struct {
+	Direction string
+	Threshold uint64
+}
+
+// Breached reports whether balance violates the alert's threshold.
+func (a *BalanceAlert) Breached(balance uint64) bool {
+	if a.Direction == AlertAbove {
+		return balance > a.Threshold
+	}
+	return balance < a.Threshold
+}
+
+// SetBalanceAlerts replaces all alerts a parent has on a kid.
+func (d *DB) SetBalanceAlerts(ctx context.Context, parentEmail, kidEmail string, rules []AlertRule) ([]BalanceAlert, error) {
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	parentEmail, kidEmail = strings.ToLower(parentEmail), strings.ToLower(kidEmail)
+	if _, err := tx.ExecContext(ctx, `DELETE FROM balance_alerts WHERE parent_email=? AND kid_email=?`, parentEmail, kidEmail); err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	out := make([]BalanceAlert, 0, len(rules))
+	for _, r := range rules {
+		id, err := util.NewID()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO balance_alerts (alert_id, parent_email, kid_email, direction, threshold, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
+			id, parentEmail, kidEmail, r.Direction, r.Threshold, now); err != nil {
+			return nil, err
+		}
+		out = append(out, BalanceAlert{AlertID: id, ParentEmail: parentEmail, KidEmail: kidEmail, Direction: r.Direction, Threshold: r.Threshold, State: AlertStateOK, CreatedAt: now})
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ListBalanceAlerts returns a parent's alerts, optionally narrowed to one kid.
+func (d *DB) ListBalanceAlerts(ctx context.Context, parentEmail, kidEmail string) ([]BalanceAlert, error) {
+	q := `SELECT alert_id, parent_email, kid_email, direction, threshold, state, last_balance, last_checked_at, triggered_at, created_at FROM balance_alerts WHERE parent_email=?`
+	args := []any{strings.ToLower(parentEmail)}
+	if kidEmail != "" {
+		q += ` AND kid_email=?`
+		args = append(args, strings.ToLower(kidEmail))
+	}
+	return d.scanBalanceAlerts(ctx, q+` ORDER BY kid_email, created_at`, args...)
+}
+
+func (d *DB) AllBalanceAlerts(ctx context.Context) ([]BalanceAlert, error) {
+	return d.scanBalanceAlerts(ctx, `SELECT alert_id, parent_email, kid_email, direction, threshold, state, last_balance, last_checked_at, triggered_at, created_at FROM balance_alerts ORDER BY kid_email`)
+}
+
+func (d *DB) scanBalanceAlerts(ctx context.Context, q string, args ...any) ([]BalanceAlert, error) {
+	rows, err := d.query(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	alerts := []BalanceAlert{}
+	for rows.Next() {
+		var a BalanceAlert
+		if err := rows.Scan(&a.AlertID, &a.ParentEmail, &a.KidEmail, &a.Direction, &a.Threshold, &a.State, &a.LastBalance, &a.LastCheckedAt, &a.TriggeredAt, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return alerts, nil
+}
+
+// RecordAlertCheck stores the latest evaluation and returns true when the
+// alert transitioned from ok to triggered.
+func (d *DB) RecordAlertCheck(ctx context.Context, a *BalanceAlert, balance uint64, breached bool) (bool, error) {
+	now := time.Now().UTC().Format(time.RFC3339)
+	state := AlertStateOK
+	if breached {
+		state = AlertStateTriggered
+	}
+	transitioned := breached && a.State == AlertStateOK
+	triggeredAt := a.TriggeredAt
+	if transitioned {
+		triggeredAt = now
+	}
+	_, err := d.exec(ctx, `UPDATE balance_alerts SET state=?, last_balance=?, last_checked_at=?, triggered_at=? WHERE alert_id=?`,
+		state, balance, now, triggeredAt, a.AlertID)
+	if err != nil {
+		return false, err
+	}
+	return transitioned, nil
+}
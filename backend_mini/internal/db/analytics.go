@@ -0,0 +1,99 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"time"
+)
+
+// analyticsSnapshot is a read-only copy of the database made with VACUUM
+// INTO, so heavy aggregate queries never hold a read transaction open on
+// the live file while the writer works.
+type analyticsSnapshot struct {
+	db      *sql.DB
+	takenAt time.Time
+}
+
+// AnalyticsStatus describes the snapshot analytics queries read from.
+type AnalyticsStatus struct {
+	Enabled bool   `json:"enabled"`
+	Path    string `json:"path,omitempty"`
+	TakenAt string `json:"taken_at,omitempty"`
+	Bytes   int64  `json:"bytes,omitempty"`
+	// Fresh is false when there is no snapshot yet or it is older than
+	// the maximum age; analytics then read the live database.
+	Fresh bool `json:"fresh"`
+}
+
+// SetAnalyticsSnapshot makes analytics queries read a snapshot at path
+// while it is younger than maxAge. Call it before serving.
+func (d *DB) SetAnalyticsSnapshot(path string, maxAge time.Duration) {
+	d.snapPath, d.snapMaxAge = path, maxAge
+}
+
+// RefreshAnalyticsSnapshot copies the database to a new snapshot and
+// switches analytics over to it. The copy runs on its own connection as
+// one read transaction, which WAL lets proceed alongside writes.
+func (d *DB) RefreshAnalyticsSnapshot(ctx context.Context) error {
+	if d.snapPath == "" {
+		return nil
+	}
+	tmp := d.snapPath + ".tmp"
+	if err := os.Remove(tmp); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	src, err := sql.Open("sqlite", d.dsn)
+	if err != nil {
+		return err
+	}
+	takenAt := time.Now().UTC()
+	_, err = src.ExecContext(ctx, `VACUUM INTO ?`, tmp)
+	_ = src.Close()
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	// connections of the old snapshot keep the file they opened
+	if err := os.Rename(tmp, d.snapPath); err != nil {
+		return err
+	}
+	snap, err := sql.Open("sqlite", "file:"+d.snapPath+"?mode=ro&immutable=1")
+	if err != nil {
+		return err
+	}
+	snap.SetMaxOpenConns(maxReadConns)
+	if err := snap.PingContext(ctx); err != nil {
+		_ = snap.Close()
+		return err
+	}
+	if old := d.snap.Swap(&analyticsSnapshot{db: snap, takenAt: takenAt}); old != nil {
+		// let queries that already picked the old snapshot finish
+		time.AfterFunc(time.Minute, func() { _ = old.db.Close() })
+	}
+	return nil
+}
+
+// analytics returns the pool for heavy aggregate reads: the snapshot while
+// it is fresh, the live read pool otherwise.
+func (d *DB) analytics() *sql.DB {
+	if s := d.snap.Load(); s != nil && time.Since(s.takenAt) <= d.snapMaxAge {
+		return s.db
+	}
+	return d.Read
+}
+
+// AnalyticsStatus reports on the current snapshot.
+func (d *DB) AnalyticsStatus() AnalyticsStatus {
+	st := AnalyticsStatus{Enabled: d.snapPath != "", Path: d.snapPath}
+	s := d.snap.Load()
+	if s == nil {
+		return st
+	}
+	st.TakenAt = s.takenAt.Format(time.RFC3339)
+	st.Fresh = time.Since(s.takenAt) <= d.snapMaxAge
+	if fi, err := os.Stat(d.snapPath); err == nil {
+		st.Bytes = fi.Size()
+	}
+	return st
+}
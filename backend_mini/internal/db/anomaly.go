@@ -0,0 +1,251 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"backend_mini/internal/util"
+)
+
+// Anomaly rules a transfer can be flagged under.
+const (
+	FlagBurst        = "burst"
+	FlagNewRecipient = "new_recipient"
+	FlagLargeAmount  = "large_amount"
+)
+
+// Flag statuses. Only open flags hold transfers when a family blocks on flag.
+const (
+	FlagOpen      = "open"
+	FlagResolved  = "resolved"
+	FlagDismissed = "dismissed"
+)
+
+var ErrFlagNotFound = errors.New("flag not found")
+
+// AnomalySettings tune detection for one family.
+type AnomalySettings struct {
+	ParentEmail       string  `json:"parent_email"`
+	BurstCount        int     `json:"burst_count"`
+	BurstMinutes      int     `json:"burst_minutes"`
+	LargeMultiplier   float64 `json:"large_multiplier"`
+	FlagNewRecipients bool    `json:"flag_new_recipients"`
+	BlockOnFlag       bool    `json:"block_on_flag"`
+	UpdatedAt         string  `json:"updated_at,omitempty"`
+}
+
+// DefaultAnomalySettings apply to families that never saved their own.
+func DefaultAnomalySettings(parentEmail string) AnomalySettings {
+	return AnomalySettings{ParentEmail: strings.ToLower(parentEmail), BurstCount: 5, BurstMinutes: 10, LargeMultiplier: 5, FlagNewRecipients: true}
+}
+
+type TransferFlag struct {
+	FlagID         string `json:"flag_id"`
+	TransferID     string `json:"transfer_id"`
+	ParentEmail    string `json:"parent_email"`
+	FromWallet     string `json:"from_wallet"`
+	Rule           string `json:"rule"`
+	Detail         string `json:"detail"`
+	Status         string `json:"status"`
+	ResolutionNote string `json:"resolution_note,omitempty"`
+	ResolvedBy     string `json:"resolved_by,omitempty"`
+	CreatedAt      string `json:"created_at"`
+	ResolvedAt     string `json:"resolved_at,omitempty"`
+}
+
+func (d *DB) GetAnomalySettings(ctx context.Context, parentEmail string) (AnomalySettings, error) {
+	s := DefaultAnomalySettings(parentEmail)
+	err := d.queryRow(ctx, `SELECT burst_count, burst_minutes, large_multiplier, flag_new_recipients, block_on_flag, updated_at FROM anomaly_settings WHERE parent_email=?`, s.ParentEmail).
+		Scan(&s.BurstCount, &s.BurstMinutes, &s.LargeMultiplier, &s.FlagNewRecipients, &s.BlockOnFlag, &s.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return s, nil
+	}
+	return s, err
+}
+
+func (d *DB) SetAnomalySettings(ctx context.Context, s AnomalySettings) (AnomalySettings, error) {
+	s.ParentEmail = strings.ToLower(s.ParentEmail)
+	s.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	_, err := d.exec(ctx, `INSERT INTO anomaly_settings (parent_email, burst_count, burst_minutes, large_multiplier, flag_new_recipients, block_on_flag, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(parent_email) DO UPDATE SET burst_count=excluded.burst_count, burst_minutes=excluded.burst_minutes, large_multiplier=excluded.large_multiplier,
+		flag_new_recipients=excluded.flag_new_recipients, block_on_flag=excluded.block_on_flag, updated_at=excluded.updated_at`,
+		s.ParentEmail, s.BurstCount, s.BurstMinutes, s.LargeMultiplier, s.FlagNewRecipients, s.BlockOnFlag, s.UpdatedAt)
+	return s, err
+}
+
+// UnscannedTransfers returns up to limit transfers the detector has not looked at, oldest first.
+func (d *DB) UnscannedTransfers(ctx context.Context, limit int) ([]Transfer, error) {
+	rows, err := d.query(ctx, `SELECT transfer_id FROM transfers WHERE scanned=0 ORDER BY created_at, transfer_id LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	out := make([]Transfer, 0, len(ids))
+	for _, id := range ids {
+		t, found, err := d.GetTransfer(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			out = append(out, *t)
+		}
+	}
+	return out, nil
+}
+
+func (d *DB) MarkTransferScanned(ctx context.Context, transferID string) error {
+	_, err := d.exec(ctx, `UPDATE transfers SET scanned=1 WHERE transfer_id=?`, transferID)
+	return err
+}
+
+// CountTransfersFrom counts transfers from wallet created in [from, to].
+func (d *DB) CountTransfersFrom(ctx context.Context, wallet, from, to string) (int, error) {
+	var n int
+	err := d.queryRow(ctx, `SELECT COUNT(*) FROM transfers WHERE from_wallet=? AND status<>'superseded' AND created_at >= ? AND created_at <= ?`, wallet, from, to).Scan(&n)
+	return n, err
+}
+
+// RecentTransferTotals returns the totals of up to limit transfers from
+// wallet created before the given transfer, newest first.
+func (d *DB) RecentTransferTotals(ctx context.Context, wallet string, before *Transfer, limit int) ([]uint64, error) {
+	rows, err := d.query(ctx, `SELECT total FROM transfers WHERE from_wallet=? AND status<>'superseded' AND (created_at < ? OR (created_at = ? AND transfer_id < ?)) ORDER BY created_at DESC LIMIT ?`,
+		wallet, before.CreatedAt, before.CreatedAt, before.TransferID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []uint64
+	for rows.Next() {
+		var v uint64
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, rows.Err()
+}
+
+// PaidBefore reports whether wallet sent anything to recipient before the given transfer.
+func (d *DB) PaidBefore(ctx context.Context, wallet, recipient string, before *Transfer) (bool, error) {
+	var n int
+	err := d.queryRow(ctx, `SELECT COUNT(*) FROM transfer_legs l JOIN transfers t ON t.transfer_id = l.transfer_id
+		WHERE t.from_wallet=? AND l.to_wallet=? AND t.transfer_id<>? AND t.created_at <= ?`, wallet, recipient, before.TransferID, before.CreatedAt).Scan(&n)
+	return n > 0, err
+}
+
+// FamilyWallets returns the parent's wallet, the kids' wallets and their
+// savings wallets: the recipients that never count as unverified.
+func (d *DB) FamilyWallets(ctx context.Context, parentEmail string) (map[string]bool, error) {
+	rows, err := d.query(ctx, `
+		SELECT p.wallet FROM parents p WHERE p.email=?
+		UNION SELECT c.wallet FROM children c JOIN parents p ON p.id = c.parent_id WHERE p.email=?
+		UNION SELECT s.savings_wallet FROM split_rules s WHERE s.parent_email=?`, strings.ToLower(parentEmail), strings.ToLower(parentEmail), strings.ToLower(parentEmail))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[string]bool{}
+	for rows.Next() {
+		var w sql.NullString
+		if err := rows.Scan(&w); err != nil {
+			return nil, err
+		}
+		if w.String != "" {
+			out[w.String] = true
+		}
+	}
+	return out, rows.Err()
+}
+
+// AddTransferFlag records a flag; a transfer is flagged at most once per rule.
+func (d *DB) AddTransferFlag(ctx context.Context, f TransferFlag) (*TransferFlag, bool, error) {
+	id, err := util.NewID()
+	if err != nil {
+		return nil, false, err
+	}
+	f.FlagID, f.Status, f.CreatedAt = id, FlagOpen, time.Now().UTC().Format(time.RFC3339)
+	f.ParentEmail = strings.ToLower(f.ParentEmail)
+	res, err := d.exec(ctx, `INSERT OR IGNORE INTO transfer_flags (flag_id, transfer_id, parent_email, from_wallet, rule, detail, status, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		f.FlagID, f.TransferID, f.ParentEmail, f.FromWallet, f.Rule, f.Detail, f.Status, f.CreatedAt)
+	if err != nil {
+		return nil, false, err
+	}
+	n, _ := res.RowsAffected()
+	return &f, n > 0, nil
+}
+
+const flagColumns = `flag_id, transfer_id, parent_email, from_wallet, rule, detail, status, resolution_note, resolved_by, created_at, resolved_at`
+
+func scanFlag(row rowScanner, f *TransferFlag) error {
+	return row.Scan(&f.FlagID, &f.TransferID, &f.ParentEmail, &f.FromWallet, &f.Rule, &f.Detail, &f.Status, &f.ResolutionNote, &f.ResolvedBy, &f.CreatedAt, &f.ResolvedAt)
+}
+
+func (d *DB) listFlags(ctx context.Context, q string, args ...any) ([]TransferFlag, error) {
+	rows, err := d.query(ctx, `SELECT `+flagColumns+` FROM transfer_flags WHERE `+q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []TransferFlag{}
+	for rows.Next() {
+		var f TransferFlag
+		if err := scanFlag(rows, &f); err != nil {
+			return nil, err
+		}
+		out = append(out, f)
+	}
+	return out, rows.Err()
+}
+
+// ListTransferFlags filters by status and parent; empty filters match all.
+func (d *DB) ListTransferFlags(ctx context.Context, status, parentEmail string, limit int) ([]TransferFlag, error) {
+	return d.listFlags(ctx, `(?='' OR status=?) AND (?='' OR parent_email=?) ORDER BY created_at DESC LIMIT ?`,
+		status, status, strings.ToLower(parentEmail), strings.ToLower(parentEmail), limit)
+}
+
+// OpenFlagsForWallet returns the unresolved flags on transfers from wallet.
+func (d *DB) OpenFlagsForWallet(ctx context.Context, wallet string) ([]TransferFlag, error) {
+	return d.listFlags(ctx, `from_wallet=? AND status=? ORDER BY created_at`, wallet, FlagOpen)
+}
+
+// HasOpenFlag reports whether wallet has an open flag under rule raised since the given time.
+func (d *DB) HasOpenFlag(ctx context.Context, wallet, rule, since string) (bool, error) {
+	var n int
+	err := d.queryRow(ctx, `SELECT COUNT(*) FROM transfer_flags WHERE from_wallet=? AND rule=? AND status=? AND created_at >= ?`, wallet, rule, FlagOpen, since).Scan(&n)
+	return n > 0, err
+}
+
+// ResolveTransferFlag closes an open flag as resolved or dismissed.
+func (d *DB) ResolveTransferFlag(ctx context.Context, flagID, status, note, resolvedBy string) (*TransferFlag, error) {
+	res, err := d.exec(ctx, `UPDATE transfer_flags SET status=?, resolution_note=?, resolved_by=?, resolved_at=? WHERE flag_id=? AND status=?`,
+		status, note, resolvedBy, time.Now().UTC().Format(time.RFC3339), flagID, FlagOpen)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, ErrFlagNotFound
+	}
+	var f TransferFlag
+	if err := scanFlag(d.SQL.QueryRowContext(ctx, `SELECT `+flagColumns+` FROM transfer_flags WHERE flag_id=?`, flagID), &f); err != nil {
+		return nil, err
+	}
+	if err := writeAudit(ctx, d.SQL, resolvedBy, "transfer_flag."+status, f.ParentEmail, f.FlagID); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
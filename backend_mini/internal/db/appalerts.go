@@ -0,0 +1,158 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"backend_mini/internal/util"
+)
+
+// App alert statuses. An alert is open until the parent picks one of the
+// actions; ignored apps act as the kid's allow-list and never alert again.
+const (
+	AppAlertOpen    = "open"
+	AppAlertLimited = "limited"
+	AppAlertIgnored = "ignored"
+	AppAlertBlocked = "blocked"
+)
+
+var ErrAppAlertNotFound = errors.New("no open app alert with that id")
+
+// AppAlertActions are what a parent can do about a newly detected app.
+var AppAlertActions = []string{"set_limit", "ignore", "block"}
+
+// AppAlert tells a parent that a kid used an app no limit covers.
+type AppAlert struct {
+	AlertID      string      `json:"alert_id"`
+	ParentEmail  string      `json:"parent_email"`
+	KidEmail     string      `json:"kid_email"`
+	App          string      `json:"app"`
+	FirstSeenDay string      `json:"first_seen_day"`
+	Minutes      int         `json:"minutes"`
+	Status       string      `json:"status"`
+	Actions      []string    `json:"actions,omitempty"`
+	ResolvedAt   string      `json:"resolved_at,omitempty"`
+	CreatedAt    string      `json:"created_at"`
+	AppInfo      *CatalogApp `json:"app_info,omitempty"`
+}
+
+const appAlertColumns = `alert_id, parent_email, kid_email, app, first_seen_day, minutes, status, resolved_at, created_at`
+
+func scanAppAlert(row rowScanner, a *AppAlert) error {
+	if err := row.Scan(&a.AlertID, &a.ParentEmail, &a.KidEmail, &a.App, &a.FirstSeenDay, &a.Minutes, &a.Status, &a.ResolvedAt, &a.CreatedAt); err != nil {
+		return err
+	}
+	if a.Status == AppAlertOpen {
+		a.Actions = AppAlertActions
+	}
+	return nil
+}
+
+// DetectNewApps opens an alert for each used app the kid has neither a
+// limit nor an earlier alert for, and returns the alerts it opened.
+func (d *DB) DetectNewApps(ctx context.Context, parentEmail, kidEmail string, used []UsageRecord) ([]AppAlert, error) {
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	parentEmail, kidEmail = strings.ToLower(parentEmail), strings.ToLower(kidEmail)
+	now := time.Now().UTC().Format(time.RFC3339)
+	var opened []AppAlert
+	seen := map[string]bool{}
+	for _, rec := range used {
+		if seen[rec.App] {
+			continue
+		}
+		seen[rec.App] = true
+		var n int
+		if err := tx.QueryRowContext(ctx, `SELECT (SELECT COUNT(*) FROM app_limits WHERE kid_email=? AND app=?) + (SELECT COUNT(*) FROM app_alerts WHERE kid_email=? AND app=?)`,
+			kidEmail, rec.App, kidEmail, rec.App).Scan(&n); err != nil {
+			return nil, err
+		}
+		if n > 0 {
+			continue
+		}
+		id, err := util.NewID()
+		if err != nil {
+			return nil, err
+		}
+		a := AppAlert{AlertID: id, ParentEmail: parentEmail, KidEmail: kidEmail, App: rec.App, FirstSeenDay: rec.Day, Minutes: rec.Minutes,
+			Status: AppAlertOpen, Actions: AppAlertActions, CreatedAt: now}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO app_alerts (`+appAlertColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			a.AlertID, a.ParentEmail, a.KidEmail, a.App, a.FirstSeenDay, a.Minutes, a.Status, a.ResolvedAt, a.CreatedAt); err != nil {
+			return nil, err
+		}
+		opened = append(opened, a)
+	}
+	return opened, tx.Commit()
+}
+
+func (d *DB) GetAppAlert(ctx context.Context, alertID string) (*AppAlert, bool, error) {
+	var a AppAlert
+	err := scanAppAlert(d.queryRow(ctx, `SELECT `+appAlertColumns+` FROM app_alerts WHERE alert_id=?`, alertID), &a)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return &a, true, nil
+}
+
+// ListAppAlerts filters a parent's alerts by kid and status; empty filters
+// match all.
+func (d *DB) ListAppAlerts(ctx context.Context, parentEmail, kidEmail, status string) ([]AppAlert, error) {
+	kidEmail = strings.ToLower(kidEmail)
+	rows, err := d.query(ctx, `SELECT `+appAlertColumns+` FROM app_alerts WHERE parent_email=? AND (?='' OR kid_email=?) AND (?='' OR status=?) ORDER BY created_at DESC`,
+		strings.ToLower(parentEmail), kidEmail, kidEmail, status, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []AppAlert{}
+	for rows.Next() {
+		var a AppAlert
+		if err := scanAppAlert(rows, &a); err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+// ResolveAppAlert closes an open alert with status. For limited and
+// blocked alerts the limit is written in the same transaction, recorded in
+// the limit history under parentEmail.
+func (d *DB) ResolveAppAlert(ctx context.Context, alertID, parentEmail, status string, timePerDay int, feeExtraHour uint64) (*AppAlert, *AppLimit, error) {
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	var a AppAlert
+	err = scanAppAlert(tx.QueryRowContext(ctx, `SELECT `+appAlertColumns+` FROM app_alerts WHERE alert_id=? AND parent_email=? AND status=?`,
+		alertID, strings.ToLower(parentEmail), AppAlertOpen), &a)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, ErrAppAlertNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	var limit *AppLimit
+	if status != AppAlertIgnored {
+		if limit, _, err = upsertAppLimit(ctx, tx, a.ParentEmail, a.KidEmail, a.App, timePerDay, feeExtraHour, parentEmail, LimitSourceAppAlert); err != nil {
+			return nil, nil, err
+		}
+	}
+	a.Status, a.ResolvedAt, a.Actions = status, time.Now().UTC().Format(time.RFC3339), nil
+	if _, err := tx.ExecContext(ctx, `UPDATE app_alerts SET status=?, resolved_at=? WHERE alert_id=?`, a.Status, a.ResolvedAt, a.AlertID); err != nil {
+		return nil, nil, err
+	}
+	return &a, limit, tx.Commit()
+}
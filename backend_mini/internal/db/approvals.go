@@ -0,0 +1,94 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// AutoApproval is a submitted chore whose family auto-approves it once
+// AfterHours have passed since SubmittedAt.
+type AutoApproval struct {
+	Chore       Chore
+	ParentEmail string
+	SubmittedAt time.Time
+	AfterHours  int
+}
+
+// Due reports whether the parent's time to decide has run out by now.
+func (a AutoApproval) Due(now time.Time) bool {
+	return !now.Before(a.SubmittedAt.Add(time.Duration(a.AfterHours) * time.Hour))
+}
+
+// AutoApprovalCandidates lists submitted chores under their family's
+// auto-approval threshold, with when they were last submitted. Chores
+// submitted before timelines were recorded have no submission time and
+// are left to the parent, as are chores of a paused kid or family until
+// the pause ends.
+func (d *DB) AutoApprovalCandidates(ctx context.Context) ([]AutoApproval, error) {
+	now := time.Now().UTC().Format(time.RFC3339)
+	rows, err := d.query(ctx, `SELECT `+choreColumns+`, parent_email, after_hours, submitted_at FROM (
+		SELECT c.*, p.email AS parent_email, s.auto_approve_after_hours AS after_hours,
+			(SELECT MAX(t.created_at) FROM chore_timeline t WHERE t.chore_id = c.chore_id AND t.kind = ?) AS submitted_at
+		FROM chores c
+		JOIN parents p ON p.wallet = c.parent_wallet AND p.wallet <> ''
+		JOIN family_settings s ON s.parent_email = p.email
+		WHERE c.chore_status = 1 AND c.kind = ? AND s.auto_approve_below > 0 AND c.bounty_amount < s.auto_approve_below
+			AND NOT EXISTS (SELECT 1 FROM pauses ps WHERE ps.parent_email = p.email AND ps.starts_at <= ? AND ps.ends_at > ?
+				AND (ps.kid_email = '' OR ps.kid_email IN (SELECT lower(k.email) FROM children k WHERE k.wallet <> '' AND k.wallet = c.child_wallet)))
+	) WHERE submitted_at IS NOT NULL`, TimelineSubmitted, ChoreKindChore, now, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []AutoApproval
+	for rows.Next() {
+		var a AutoApproval
+		var submitted string
+		if err := scanChore(extraScanner{rows, []any{&a.ParentEmail, &a.AfterHours, &submitted}}, &a.Chore); err != nil {
+			return nil, err
+		}
+		if a.SubmittedAt, err = time.Parse(time.RFC3339, submitted); err != nil {
+			return nil, fmt.Errorf("chore %s: %w", a.Chore.ChoreID, err)
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+// extraScanner lets a scan helper read a row that has more columns after
+// the ones it knows about.
+type extraScanner struct {
+	row   rowScanner
+	extra []any
+}
+
+func (s extraScanner) Scan(dest ...any) error {
+	return s.row.Scan(append(dest, s.extra...)...)
+}
+
+// AutoApproveChore approves a chore that is still submitted, recording the
+// system as the approver. It reports false when the parent decided first.
+func (d *DB) AutoApproveChore(ctx context.Context, choreID, note string) (*Chore, bool, error) {
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `UPDATE chores SET chore_status=3 WHERE chore_id=? AND chore_status=1`, choreID)
+	if err != nil {
+		return nil, false, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, false, nil
+	}
+	if err := addChoreEntry(ctx, tx, choreID, TimelineApproved, ActorSystem, note, ""); err != nil {
+		return nil, false, err
+	}
+	var c Chore
+	if err := scanChore(tx.QueryRowContext(ctx, `SELECT `+choreColumns+` FROM chores WHERE chore_id=?`, choreID), &c); err != nil {
+		return nil, false, err
+	}
+	return &c, true, tx.Commit()
+}
@@ -0,0 +1,219 @@
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"backend_mini/internal/util"
+)
+
+// AssistantRefreshPrefix marks refresh tokens of linked voice assistants.
+const AssistantRefreshPrefix = "sona_ast_"
+
+var (
+	// ErrAssistantGrant means an authorization code or refresh token is
+	// unknown, used, expired, revoked or was issued to another client.
+	ErrAssistantGrant        = errors.New("invalid grant")
+	ErrAssistantLinkNotFound = errors.New("assistant link not found")
+)
+
+// AssistantLink is a voice assistant account linked to a parent through
+// OAuth. Only the SHA-256 of its refresh token is stored; access tokens
+// are session JWTs naming the link, so revoking it cuts them off too.
+type AssistantLink struct {
+	LinkID      string `json:"link_id"`
+	ParentEmail string `json:"parent_email"`
+	ClientID    string `json:"client_id"`
+	CreatedAt   string `json:"created_at"`
+	LastUsedAt  string `json:"last_used_at,omitempty"`
+	RevokedAt   string `json:"revoked_at,omitempty"`
+}
+
+const assistantLinkColumns = `link_id, parent_email, client_id, created_at, last_used_at, revoked_at`
+
+func scanAssistantLink(row rowScanner, l *AssistantLink) error {
+	return row.Scan(&l.LinkID, &l.ParentEmail, &l.ClientID, &l.CreatedAt, &l.LastUsedAt, &l.RevokedAt)
+}
+
+func newSecret(prefix string) (string, error) {
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return prefix + hex.EncodeToString(secret), nil
+}
+
+// CreateAssistantCode issues the one-time authorization code the assistant
+// exchanges for tokens. It is only good for clientID and redirectURI.
+func (d *DB) CreateAssistantCode(ctx context.Context, parentEmail, clientID, redirectURI string, ttl time.Duration) (string, error) {
+	raw, err := newSecret("")
+	if err != nil {
+		return "", err
+	}
+	_, err = d.exec(ctx, `INSERT INTO assistant_codes (code_hash, parent_email, client_id, redirect_uri, expires_at) VALUES (?, ?, ?, ?, ?)`,
+		hashToken(raw), strings.ToLower(parentEmail), clientID, redirectURI, time.Now().UTC().Add(ttl).Format(time.RFC3339))
+	return raw, err
+}
+
+// RedeemAssistantCode uses up an authorization code and links the account,
+// returning the link with its raw refresh token.
+func (d *DB) RedeemAssistantCode(ctx context.Context, code, clientID, redirectURI string, now time.Time) (*AssistantLink, string, error) {
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	defer tx.Rollback()
+
+	var parentEmail string
+	err = tx.QueryRowContext(ctx, `SELECT parent_email FROM assistant_codes WHERE code_hash=? AND client_id=? AND redirect_uri=? AND used_at='' AND expires_at>?`,
+		hashToken(code), clientID, redirectURI, now.UTC().Format(time.RFC3339)).Scan(&parentEmail)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, "", ErrAssistantGrant
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE assistant_codes SET used_at=? WHERE code_hash=?`, now.UTC().Format(time.RFC3339), hashToken(code)); err != nil {
+		return nil, "", err
+	}
+	id, err := util.NewID()
+	if err != nil {
+		return nil, "", err
+	}
+	refresh, err := newSecret(AssistantRefreshPrefix)
+	if err != nil {
+		return nil, "", err
+	}
+	l := AssistantLink{LinkID: id, ParentEmail: parentEmail, ClientID: clientID, CreatedAt: now.UTC().Format(time.RFC3339)}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO assistant_links (link_id, parent_email, client_id, refresh_hash, created_at) VALUES (?, ?, ?, ?, ?)`,
+		l.LinkID, l.ParentEmail, l.ClientID, hashToken(refresh), l.CreatedAt); err != nil {
+		return nil, "", err
+	}
+	if err := writeAudit(ctx, tx, parentEmail, "assistant.link", parentEmail, l.LinkID+" "+clientID); err != nil {
+		return nil, "", err
+	}
+	return &l, refresh, tx.Commit()
+}
+
+// RefreshAssistantLink swaps a refresh token for a new one. The old one
+// stops working, so a leaked token is useless once the assistant refreshes.
+func (d *DB) RefreshAssistantLink(ctx context.Context, raw, clientID string) (*AssistantLink, string, error) {
+	refresh, err := newSecret(AssistantRefreshPrefix)
+	if err != nil {
+		return nil, "", err
+	}
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	defer tx.Rollback()
+
+	var l AssistantLink
+	err = scanAssistantLink(tx.QueryRowContext(ctx, `SELECT `+assistantLinkColumns+` FROM assistant_links WHERE refresh_hash=? AND client_id=? AND revoked_at=''`, hashToken(raw), clientID), &l)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, "", ErrAssistantGrant
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE assistant_links SET refresh_hash=? WHERE link_id=?`, hashToken(refresh), l.LinkID); err != nil {
+		return nil, "", err
+	}
+	return &l, refresh, tx.Commit()
+}
+
+// ActiveAssistantLink loads a link that has not been revoked and stamps
+// its last use.
+func (d *DB) ActiveAssistantLink(ctx context.Context, linkID string, now time.Time) (*AssistantLink, error) {
+	var l AssistantLink
+	err := scanAssistantLink(d.queryRow(ctx, `SELECT `+assistantLinkColumns+` FROM assistant_links WHERE link_id=? AND revoked_at=''`, linkID), &l)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrAssistantLinkNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	l.LastUsedAt = now.UTC().Format(time.RFC3339)
+	if _, err := d.exec(ctx, `UPDATE assistant_links SET last_used_at=? WHERE link_id=?`, l.LastUsedAt, l.LinkID); err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// ListAssistantLinks returns a parent's links, newest first, including
+// revoked ones.
+func (d *DB) ListAssistantLinks(ctx context.Context, parentEmail string) ([]AssistantLink, error) {
+	rows, err := d.query(ctx, `SELECT `+assistantLinkColumns+` FROM assistant_links WHERE parent_email=? ORDER BY created_at DESC`, strings.ToLower(parentEmail))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []AssistantLink{}
+	for rows.Next() {
+		var l AssistantLink
+		if err := scanAssistantLink(rows, &l); err != nil {
+			return nil, err
+		}
+		out = append(out, l)
+	}
+	return out, rows.Err()
+}
+
+// RevokeAssistantLink unlinks an assistant. Its access and refresh tokens
+// stop working at once.
+func (d *DB) RevokeAssistantLink(ctx context.Context, parentEmail, linkID string) error {
+	parentEmail = strings.ToLower(parentEmail)
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx, `UPDATE assistant_links SET revoked_at=? WHERE link_id=? AND parent_email=? AND revoked_at=''`,
+		time.Now().UTC().Format(time.RFC3339), linkID, parentEmail)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrAssistantLinkNotFound
+	}
+	if err := writeAudit(ctx, tx, parentEmail, "assistant.unlink", parentEmail, linkID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// AssistantApproveChore approves a submitted chore of the parent's by
+// voice. As with auto-approval no payout is built; the parent's app builds
+// it with /update_chore status 3.
+func (d *DB) AssistantApproveChore(ctx context.Context, l *AssistantLink, parentWallet, choreID string) (*Chore, error) {
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `UPDATE chores SET chore_status=3 WHERE chore_id=? AND parent_wallet=? AND chore_status=1 AND kind=?`, choreID, parentWallet, ChoreKindChore)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, ErrChoreNotSubmitted
+	}
+	if err := addChoreEntry(ctx, tx, choreID, TimelineApproved, ActorAssistant, "", l.LinkID); err != nil {
+		return nil, err
+	}
+	if err := writeAudit(ctx, tx, l.ParentEmail, "assistant.approve", choreID, l.LinkID); err != nil {
+		return nil, err
+	}
+	var c Chore
+	if err := scanChore(tx.QueryRowContext(ctx, `SELECT `+choreColumns+` FROM chores WHERE chore_id=?`, choreID), &c); err != nil {
+		return nil, err
+	}
+	return &c, tx.Commit()
+}
@@ -0,0 +1,53 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+type AuditEntry struct {
+	ID        int64  `json:"id"`
+	Actor     string `json:"actor"`
+	Action    string `json:"action"`
+	Subject   string `json:"subject"`
+	Detail    string `json:"detail"`
+	CreatedAt string `json:"created_at"`
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+func writeAudit(ctx context.Context, ex execer, actor, action, subject, detail string) error {
+	_, err := ex.ExecContext(ctx, `INSERT INTO audit_log (actor, action, subject, detail, created_at) VALUES (?, ?, ?, ?, ?)`,
+		strings.ToLower(actor), action, strings.ToLower(subject), detail, time.Now().UTC().Format(time.RFC3339))
+	return err
+}
+
+// Audit records a security-relevant action outside of any transaction.
+func (d *DB) Audit(ctx context.Context, actor, action, subject, detail string) error {
+	return writeAudit(ctx, d.SQL, actor, action, subject, detail)
+}
+
+func (d *DB) GetAuditLog(ctx context.Context, subject string, limit int) ([]AuditEntry, error) {
+	rows, err := d.query(ctx, `SELECT id, actor, action, subject, detail, created_at FROM audit_log WHERE subject=? ORDER BY id DESC LIMIT ?`, strings.ToLower(subject), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var e AuditEntry
+		if err := rows.Scan(&e.ID, &e.Actor, &e.Action, &e.Subject, &e.Detail, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
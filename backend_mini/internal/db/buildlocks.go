@@ -0,0 +1,59 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// AcquireBuildLock takes the build flag on wallet for holder until ttl has
+// passed. It fails without waiting while another holder's flag is live, so
+// servers sharing the database build one transfer per wallet at a time.
+// Expiry is compared in Unix nanoseconds: RFC 3339 strings with a variable
+// number of fraction digits do not sort by time. expires_at is kept for
+// people reading the table.
+func (d *DB) AcquireBuildLock(ctx context.Context, wallet, holder string, ttl time.Duration) (bool, error) {
+	now := time.Now().UTC()
+	expires := now.Add(ttl)
+	res, err := d.exec(ctx, `INSERT INTO build_locks (wallet, holder, expires_at, expires_ns) VALUES (?, ?, ?, ?)
+		ON CONFLICT(wallet) DO UPDATE SET holder=excluded.holder, expires_at=excluded.expires_at, expires_ns=excluded.expires_ns
+		WHERE build_locks.expires_ns <= ?`,
+		wallet, holder, expires.Format(time.RFC3339Nano), expires.UnixNano(), now.UnixNano())
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// ReleaseBuildLock drops holder's flag on wallet, leaving anyone else's alone.
+func (d *DB) ReleaseBuildLock(ctx context.Context, wallet, holder string) error {
+	_, err := d.exec(ctx, `DELETE FROM build_locks WHERE wallet=? AND holder=?`, wallet, holder)
+	return err
+}
+
+// PendingATACreates returns the token accounts that unexpired builds from
+// wallet already create, so a concurrent build can leave them out.
+func (d *DB) PendingATACreates(ctx context.Context, wallet string, now time.Time) (map[string]bool, error) {
+	rows, err := d.query(ctx, `SELECT ata_creates FROM transfers WHERE from_wallet=? AND status=? AND expires_at > ?`,
+		wallet, TransferBuilt, now.UTC().Format(time.RFC3339))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[string]bool{}
+	for rows.Next() {
+		var raw string
+		if err := rows.Scan(&raw); err != nil {
+			return nil, err
+		}
+		var atas []string
+		if err := json.Unmarshal([]byte(raw), &atas); err != nil {
+			return nil, err
+		}
+		for _, ata := range atas {
+			out[ata] = true
+		}
+	}
+	return out, rows.Err()
+}
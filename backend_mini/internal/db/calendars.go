@@ -0,0 +1,337 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"backend_mini/internal/util"
+)
+
+const (
+	// events on a school calendar mark days with school
+	CalendarSchool = "school"
+	// events on a holidays calendar mark days off
+	CalendarHolidays = "holidays"
+
+	DaySchool      = "school_day"
+	DaySchoolNight = "school_night"
+	DayNoSchool    = "no_school"
+)
+
+var ErrCalendarNotFound = errors.New("calendar not found")
+
+type FamilyCalendar struct {
+	CalendarID   string `json:"calendar_id"`
+	ParentEmail  string `json:"parent_email"`
+	Name         string `json:"name"`
+	Kind         string `json:"kind"`
+	URL          string `json:"url,omitempty"`
+	LastSyncedAt string `json:"last_synced_at,omitempty"`
+	LastError    string `json:"last_error,omitempty"`
+	Days         int    `json:"days"`
+	CreatedAt    string `json:"created_at"`
+}
+
+// CalendarDay is a resolved date for a family.
+type CalendarDay struct {
+	Date        string `json:"date"`
+	SchoolDay   bool   `json:"school_day"`
+	SchoolNight bool   `json:"school_night"`
+	Holiday     string `json:"holiday,omitempty"`
+}
+
+// ScheduleRule sets an app's allowance on days of a given type. An empty App
+// applies to every app.
+type ScheduleRule struct {
+	RuleID      string `json:"rule_id"`
+	ParentEmail string `json:"parent_email"`
+	KidEmail    string `json:"kid_email"`
+	App         string `json:"app"`
+	DayType     string `json:"day_type"`
+	TimePerDay  int    `json:"time_per_day"`
+	CreatedAt   string `json:"created_at"`
+}
+
+func (d *DB) CreateCalendar(ctx context.Context, c FamilyCalendar) (*FamilyCalendar, error) {
+	id, err := util.NewID()
+	if err != nil {
+		return nil, err
+	}
+	c.CalendarID = id
+	c.ParentEmail = strings.ToLower(c.ParentEmail)
+	c.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+	_, err = d.exec(ctx, `INSERT INTO family_calendars (calendar_id, parent_email, name, kind, url, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		c.CalendarID, c.ParentEmail, c.Name, c.Kind, c.URL, c.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+const calendarColumns = `c.calendar_id, c.parent_email, c.name, c.kind, c.url, c.last_synced_at, c.last_error, c.created_at,
+	(SELECT COUNT(*) FROM calendar_days cd WHERE cd.calendar_id = c.calendar_id)`
+
+func scanCalendar(row rowScanner, c *FamilyCalendar) error {
+	return row.Scan(&c.CalendarID, &c.ParentEmail, &c.Name, &c.Kind, &c.URL, &c.LastSyncedAt, &c.LastError, &c.CreatedAt, &c.Days)
+}
+
+func (d *DB) GetCalendar(ctx context.Context, calendarID string) (*FamilyCalendar, error) {
+	var c FamilyCalendar
+	if err := scanCalendar(d.queryRow(ctx, `SELECT `+calendarColumns+` FROM family_calendars c WHERE c.calendar_id=?`, calendarID), &c); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrCalendarNotFound
+		}
+		return nil, err
+	}
+	return &c, nil
+}
+
+// ListCalendars returns a family's calendars, or every calendar with a URL
+// when parentEmail is empty (used by the sync job).
+func (d *DB) ListCalendars(ctx context.Context, parentEmail string) ([]FamilyCalendar, error) {
+	q := `SELECT ` + calendarColumns + ` FROM family_calendars c WHERE c.parent_email=? ORDER BY c.created_at`
+	args := []any{strings.ToLower(parentEmail)}
+	if parentEmail == "" {
+		q = `SELECT ` + calendarColumns + ` FROM family_calendars c WHERE c.url<>'' ORDER BY c.created_at`
+		args = nil
+	}
+	rows, err := d.query(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []FamilyCalendar{}
+	for rows.Next() {
+		var c FamilyCalendar
+		if err := scanCalendar(rows, &c); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+func (d *DB) DeleteCalendar(ctx context.Context, parentEmail, calendarID string) error {
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	res, err := tx.ExecContext(ctx, `DELETE FROM family_calendars WHERE calendar_id=? AND parent_email=?`, calendarID, strings.ToLower(parentEmail))
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrCalendarNotFound
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM calendar_days WHERE calendar_id=?`, calendarID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ReplaceCalendarDays swaps in the dates from a fresh sync.
+func (d *DB) ReplaceCalendarDays(ctx context.Context, calendarID string, days map[string]string) error {
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	if _, err := tx.ExecContext(ctx, `DELETE FROM calendar_days WHERE calendar_id=?`, calendarID); err != nil {
+		return err
+	}
+	for day, summary := range days {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO calendar_days (calendar_id, day, summary) VALUES (?, ?, ?)`, calendarID, day, summary); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE family_calendars SET last_synced_at=?, last_error='' WHERE calendar_id=?`,
+		time.Now().UTC().Format(time.RFC3339), calendarID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (d *DB) RecordCalendarSyncError(ctx context.Context, calendarID string, syncErr error) error {
+	_, err := d.exec(ctx, `UPDATE family_calendars SET last_error=? WHERE calendar_id=?`, syncErr.Error(), calendarID)
+	return err
+}
+
+// ResolveDays classifies n days starting at from for a family. A day is a
+// school day when a school calendar lists it (or, without synced school
+// calendars, when it is a weekday) and no holidays calendar lists it. A school night is
+// the day before a school day.
+func (d *DB) ResolveDays(ctx context.Context, parentEmail string, from time.Time, n int) ([]CalendarDay, error) {
+	from = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	first := from.Format("2006-01-02")
+	last := from.AddDate(0, 0, n).Format("2006-01-02")
+
+	var schoolCalendars int
+	// a school calendar that never synced must not turn every day into a day off
+	if err := d.queryRow(ctx, `SELECT COUNT(*) FROM family_calendars c WHERE c.parent_email=? AND c.kind=?
+		AND EXISTS (SELECT 1 FROM calendar_days cd WHERE cd.calendar_id = c.calendar_id)`,
+		strings.ToLower(parentEmail), CalendarSchool).Scan(&schoolCalendars); err != nil {
+		return nil, err
+	}
+	rows, err := d.query(ctx, `
+		SELECT c.kind, cd.day, cd.summary FROM calendar_days cd
+		JOIN family_calendars c ON c.calendar_id = cd.calendar_id
+		WHERE c.parent_email=? AND cd.day>=? AND cd.day<=?
+	`, strings.ToLower(parentEmail), first, last)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	school := map[string]bool{}
+	holidays := map[string]string{}
+	for rows.Next() {
+		var kind, day, summary string
+		if err := rows.Scan(&kind, &day, &summary); err != nil {
+			return nil, err
+		}
+		if kind == CalendarHolidays {
+			if summary == "" {
+				summary = "holiday"
+			}
+			holidays[day] = summary
+		} else {
+			school[day] = true
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	isSchool := func(t time.Time) bool {
+		day := t.Format("2006-01-02")
+		if _, off := holidays[day]; off {
+			return false
+		}
+		if schoolCalendars > 0 {
+			return school[day]
+		}
+		return t.Weekday() != time.Saturday && t.Weekday() != time.Sunday
+	}
+	out := make([]CalendarDay, n)
+	for i := range out {
+		t := from.AddDate(0, 0, i)
+		out[i] = CalendarDay{
+			Date:        t.Format("2006-01-02"),
+			SchoolDay:   isSchool(t),
+			SchoolNight: isSchool(t.AddDate(0, 0, 1)),
+			Holiday:     holidays[t.Format("2006-01-02")],
+		}
+	}
+	return out, nil
+}
+
+// NextSchoolDay returns the first school day strictly after from, looking
+// up to 60 days ahead.
+func (d *DB) NextSchoolDay(ctx context.Context, parentEmail string, from time.Time) (string, bool, error) {
+	days, err := d.ResolveDays(ctx, parentEmail, from.AddDate(0, 0, 1), 60)
+	if err != nil {
+		return "", false, err
+	}
+	for _, day := range days {
+		if day.SchoolDay {
+			return day.Date, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+func (d *DB) SetScheduleRule(ctx context.Context, r ScheduleRule) (*ScheduleRule, error) {
+	id, err := util.NewID()
+	if err != nil {
+		return nil, err
+	}
+	r.RuleID = id
+	r.ParentEmail = strings.ToLower(r.ParentEmail)
+	r.KidEmail = strings.ToLower(r.KidEmail)
+	r.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+	if err := d.SQL.QueryRowContext(ctx, `
+		INSERT INTO schedule_rules (rule_id, parent_email, kid_email, app, day_type, time_per_day, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(kid_email, app, day_type) DO UPDATE SET time_per_day=excluded.time_per_day
+		RETURNING rule_id, created_at
+	`, r.RuleID, r.ParentEmail, r.KidEmail, r.App, r.DayType, r.TimePerDay, r.CreatedAt).Scan(&r.RuleID, &r.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func (d *DB) DeleteScheduleRule(ctx context.Context, parentEmail, ruleID string) (bool, error) {
+	res, err := d.exec(ctx, `DELETE FROM schedule_rules WHERE rule_id=? AND parent_email=?`, ruleID, strings.ToLower(parentEmail))
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (d *DB) ListScheduleRules(ctx context.Context, kidEmail string) ([]ScheduleRule, error) {
+	rows, err := d.query(ctx, `SELECT rule_id, parent_email, kid_email, app, day_type, time_per_day, created_at FROM schedule_rules WHERE kid_email=? ORDER BY created_at, rule_id`, strings.ToLower(kidEmail))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []ScheduleRule{}
+	for rows.Next() {
+		var r ScheduleRule
+		if err := rows.Scan(&r.RuleID, &r.ParentEmail, &r.KidEmail, &r.App, &r.DayType, &r.TimePerDay, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// dayTypePriority decides which rule applies when a day matches several
+// types, e.g. a Sunday before school is both no_school and school_night.
+var dayTypePriority = []string{DaySchoolNight, DaySchool, DayNoSchool}
+
+func (c CalendarDay) matches(dayType string) bool {
+	switch dayType {
+	case DaySchool:
+		return c.SchoolDay
+	case DaySchoolNight:
+		return c.SchoolNight
+	case DayNoSchool:
+		return !c.SchoolDay
+	}
+	return false
+}
+
+// ApplyScheduleRules sets the schedule allowance on each limit a rule covers
+// for the given day. App-specific rules win over catch-all ones.
+func ApplyScheduleRules(limits []AppLimit, rules []ScheduleRule, day CalendarDay) []AppLimit {
+	out := make([]AppLimit, len(limits))
+	for i, l := range limits {
+		var match *ScheduleRule
+	search:
+		for _, app := range []string{l.App, ""} {
+			for _, dt := range dayTypePriority {
+				if !day.matches(dt) {
+					continue
+				}
+				for j := range rules {
+					if rules[j].App == app && rules[j].DayType == dt {
+						match = &rules[j]
+						break search
+					}
+				}
+			}
+		}
+		if match != nil {
+			minutes := match.TimePerDay
+			l.DayType = match.DayType
+			l.ScheduleTimePerDay = &minutes
+		}
+		out[i] = l
+	}
+	return out
+}
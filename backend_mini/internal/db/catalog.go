@@ -0,0 +1,74 @@
+package db
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// CatalogApp is display metadata for an app bundle ID, so clients can show
+// a name and icon without keeping their own copy of the store listing.
+type CatalogApp struct {
+	BundleID    string `json:"bundle_id"`
+	DisplayName string `json:"display_name"`
+	IconURL     string `json:"icon_url,omitempty"`
+	Category    string `json:"category,omitempty"`
+	AgeRating   string `json:"age_rating,omitempty"`
+	UpdatedAt   string `json:"updated_at"`
+}
+
+// ImportCatalog upserts apps in one transaction and reports how many rows
+// were new.
+func (d *DB) ImportCatalog(ctx context.Context, apps []CatalogApp) (created, updated int, err error) {
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	for _, a := range apps {
+		var n int
+		if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM app_catalog WHERE bundle_id=?`, a.BundleID).Scan(&n); err != nil {
+			return 0, 0, err
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO app_catalog (bundle_id, display_name, icon_url, category, age_rating, updated_at) VALUES (?, ?, ?, ?, ?, ?)
+			ON CONFLICT(bundle_id) DO UPDATE SET display_name=excluded.display_name, icon_url=excluded.icon_url, category=excluded.category, age_rating=excluded.age_rating, updated_at=excluded.updated_at`,
+			a.BundleID, a.DisplayName, a.IconURL, a.Category, a.AgeRating, now); err != nil {
+			return 0, 0, err
+		}
+		if n == 0 {
+			created++
+		} else {
+			updated++
+		}
+	}
+	return created, updated, tx.Commit()
+}
+
+// CatalogApps looks up the catalog entries for bundleIDs. Apps the catalog
+// does not know are absent from the result.
+func (d *DB) CatalogApps(ctx context.Context, bundleIDs []string) (map[string]*CatalogApp, error) {
+	out := map[string]*CatalogApp{}
+	if len(bundleIDs) == 0 {
+		return out, nil
+	}
+	args := make([]any, len(bundleIDs))
+	for i, id := range bundleIDs {
+		args[i] = id
+	}
+	rows, err := d.SQL.QueryContext(ctx, `SELECT bundle_id, display_name, icon_url, category, age_rating, updated_at FROM app_catalog
+		WHERE bundle_id IN (?`+strings.Repeat(", ?", len(bundleIDs)-1)+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var a CatalogApp
+		if err := rows.Scan(&a.BundleID, &a.DisplayName, &a.IconURL, &a.Category, &a.AgeRating, &a.UpdatedAt); err != nil {
+			return nil, err
+		}
+		out[a.BundleID] = &a
+	}
+	return out, rows.Err()
+}
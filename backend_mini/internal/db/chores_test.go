@@ -0,0 +1,72 @@
+package db
+
+import (
+	"context"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// TestGetChoresPlan checks with EXPLAIN QUERY PLAN that every branch of
+// GetChores seeks an index, whatever filters it is given: a scan of chores
+// grows with every family's chores, not the caller's.
+func TestGetChoresPlan(t *testing.T) {
+	ctx := context.Background()
+	d, err := Open(ctx, filepath.Join(t.TempDir(), "plan.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if err := d.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	scan := regexp.MustCompile(`^SCAN (TABLE )?(chores|children|parents)\b`)
+	search := regexp.MustCompile(`^SEARCH (TABLE )?chores USING (COVERING )?INDEX idx_chores_`)
+	for _, tc := range []struct {
+		name string
+		f    ChoreFilter
+	}{
+		{"unfiltered", ChoreFilter{}},
+		{"one_status", ChoreFilter{Statuses: []int{1}}},
+		{"every_status", ChoreFilter{Statuses: []int{0, 1, 3, 4}}},
+		{"due_window", ChoreFilter{DueFrom: "2026-01-01", DueTo: "2026-01-31"}},
+		{"kind", ChoreFilter{Kind: ChoreKindChore}},
+		{"all", ChoreFilter{Statuses: []int{0, 1}, DueFrom: "2026-01-01", DueTo: "2026-01-31", Kind: ChoreKindChore}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			query, args := choresQuery("wallet", tc.f)
+			rows, err := d.SQL.QueryContext(ctx, `EXPLAIN QUERY PLAN `+query, args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rows.Close()
+			var plan []string
+			searches := 0
+			for rows.Next() {
+				var id, parent, notused int
+				var detail string
+				if err := rows.Scan(&id, &parent, &notused, &detail); err != nil {
+					t.Fatal(err)
+				}
+				plan = append(plan, detail)
+				if scan.MatchString(detail) {
+					t.Errorf("full scan: %s", detail)
+				}
+				if search.MatchString(detail) {
+					searches++
+				}
+			}
+			if err := rows.Err(); err != nil {
+				t.Fatal(err)
+			}
+			if searches != 3 {
+				t.Errorf("%d of 3 branches seek a chores index", searches)
+			}
+			if t.Failed() {
+				t.Logf("plan:\n%s", strings.Join(plan, "\n"))
+			}
+		})
+	}
+}
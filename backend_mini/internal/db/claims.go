@@ -0,0 +1,87 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	ErrChoreNotOpen      = errors.New("chore is not open for claiming")
+	ErrChoreAlreadyTaken = errors.New("chore was already claimed")
+)
+
+// ClaimChore assigns an open, unclaimed chore to kidWallet. The first claim
+// wins: the update only applies while the chore has no kid, so a concurrent
+// claim gets ErrChoreAlreadyTaken. The claim lapses at expiresAt unless the
+// kid moves the chore on from assigned.
+func (d *DB) ClaimChore(ctx context.Context, choreID, kidWallet string, expiresAt time.Time) (*Chore, error) {
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var c Chore
+	if err := scanChore(tx.QueryRowContext(ctx, `SELECT `+choreColumns+` FROM chores WHERE chore_id=?`, choreID), &c); err != nil {
+		return nil, err
+	}
+	if !c.Open {
+		return nil, ErrChoreNotOpen
+	}
+	res, err := tx.ExecContext(ctx, `UPDATE chores SET child_wallet=?, claim_expires_at=? WHERE chore_id=? AND child_wallet=''`,
+		kidWallet, expiresAt.UTC().Format(time.RFC3339), choreID)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, ErrChoreAlreadyTaken
+	}
+	if err := addChoreEntry(ctx, tx, choreID, TimelineAssigned, ActorKid, "claimed", kidWallet); err != nil {
+		return nil, err
+	}
+	if err := scanChore(tx.QueryRowContext(ctx, `SELECT `+choreColumns+` FROM chores WHERE chore_id=?`, choreID), &c); err != nil {
+		return nil, err
+	}
+	return &c, tx.Commit()
+}
+
+// ReleaseExpiredClaims reopens claimed chores still in the assigned state
+// whose claim has lapsed by now, and returns them as reopened.
+func (d *DB) ReleaseExpiredClaims(ctx context.Context, now time.Time) ([]Chore, error) {
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	at := now.UTC().Format(time.RFC3339)
+	rows, err := tx.QueryContext(ctx, `SELECT `+choreColumns+` FROM chores
+		WHERE open=1 AND chore_status=0 AND child_wallet<>'' AND claim_expires_at<>'' AND claim_expires_at<=?`, at)
+	if err != nil {
+		return nil, err
+	}
+	var released []Chore
+	for rows.Next() {
+		var c Chore
+		if err := scanChore(rows, &c); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		released = append(released, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for i := range released {
+		if _, err := tx.ExecContext(ctx, `UPDATE chores SET child_wallet='', claim_expires_at='' WHERE chore_id=?`, released[i].ChoreID); err != nil {
+			return nil, err
+		}
+		if err := addChoreEntry(ctx, tx, released[i].ChoreID, TimelineReopened, ActorSystem, "claim expired", ""); err != nil {
+			return nil, err
+		}
+		released[i].ChildWallet, released[i].ClaimExpiresAt = "", ""
+	}
+	return released, tx.Commit()
+}
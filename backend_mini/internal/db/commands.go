@@ -0,0 +1,178 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"backend_mini/internal/util"
+)
+
+const (
+	CommandLockApp = "lock_app"
+	CommandUnlock  = "unlock"
+	CommandMessage = "message"
+
+	CommandQueued    = "queued"
+	CommandDelivered = "delivered"
+	CommandAcked     = "acked"
+	CommandFailed    = "failed"
+	CommandExpired   = "expired"
+)
+
+var ErrCommandNotFound = errors.New("command not found")
+
+// DeviceCommand is a parent instruction queued for one paired device.
+// Signature is the server's ed25519 signature over SigningPayload, so the
+// device can reject commands that did not come from us.
+type DeviceCommand struct {
+	CommandID   string          `json:"command_id"`
+	DeviceID    string          `json:"device_id"`
+	KidEmail    string          `json:"kid_email"`
+	ParentEmail string          `json:"parent_email"`
+	Type        string          `json:"type"`
+	Payload     json.RawMessage `json:"payload"`
+	Signature   string          `json:"signature"`
+	Status      string          `json:"status"`
+	Result      string          `json:"result,omitempty"`
+	CreatedAt   string          `json:"created_at"`
+	ExpiresAt   string          `json:"expires_at"`
+	DeliveredAt string          `json:"delivered_at,omitempty"`
+	AckedAt     string          `json:"acked_at,omitempty"`
+}
+
+// SigningPayload is the byte string the signature covers.
+func (c *DeviceCommand) SigningPayload() []byte {
+	return []byte(strings.Join([]string{"sona-command-v1", c.CommandID, c.DeviceID, c.Type, string(c.Payload), c.CreatedAt, c.ExpiresAt}, "\n"))
+}
+
+const commandColumns = `command_id, device_id, kid_email, parent_email, type, payload, signature, status, result, created_at, expires_at, delivered_at, acked_at`
+
+func scanCommand(row rowScanner, c *DeviceCommand) error {
+	var payload string
+	if err := row.Scan(&c.CommandID, &c.DeviceID, &c.KidEmail, &c.ParentEmail, &c.Type, &payload, &c.Signature, &c.Status, &c.Result, &c.CreatedAt, &c.ExpiresAt, &c.DeliveredAt, &c.AckedAt); err != nil {
+		return err
+	}
+	c.Payload = json.RawMessage(payload)
+	return nil
+}
+
+// CreateDeviceCommand assigns an id, signs the command with sign and queues it.
+func (d *DB) CreateDeviceCommand(ctx context.Context, c DeviceCommand, ttl time.Duration, sign func([]byte) (string, error)) (*DeviceCommand, error) {
+	id, err := util.GenerateCode(12)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	c.CommandID = id
+	c.Status = CommandQueued
+	c.CreatedAt = now.Format(time.RFC3339)
+	c.ExpiresAt = now.Add(ttl).Format(time.RFC3339)
+	if len(c.Payload) == 0 {
+		c.Payload = json.RawMessage(`{}`)
+	}
+	if c.Signature, err = sign(c.SigningPayload()); err != nil {
+		return nil, err
+	}
+	_, err = d.exec(ctx, `INSERT INTO device_commands (command_id, device_id, kid_email, parent_email, type, payload, signature, status, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		c.CommandID, c.DeviceID, c.KidEmail, c.ParentEmail, c.Type, string(c.Payload), c.Signature, c.Status, c.CreatedAt, c.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// TakePendingCommands returns unexpired commands the device has not acked yet
+// and stamps the first delivery time on them.
+func (d *DB) TakePendingCommands(ctx context.Context, deviceID string) ([]DeviceCommand, error) {
+	now := time.Now().UTC().Format(time.RFC3339)
+	if _, err := d.exec(ctx, `UPDATE device_commands SET status=?, delivered_at=? WHERE device_id=? AND status=? AND expires_at>?`,
+		CommandDelivered, now, deviceID, CommandQueued, now); err != nil {
+		return nil, err
+	}
+	rows, err := d.query(ctx, `SELECT `+commandColumns+` FROM device_commands WHERE device_id=? AND status=? AND expires_at>? ORDER BY created_at, command_id`,
+		deviceID, CommandDelivered, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []DeviceCommand{}
+	for rows.Next() {
+		var c DeviceCommand
+		if err := scanCommand(rows, &c); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// AckCommand records the device's outcome (acked or failed) for a command.
+func (d *DB) AckCommand(ctx context.Context, deviceID, commandID, status, result string) (*DeviceCommand, error) {
+	now := time.Now().UTC().Format(time.RFC3339)
+	res, err := d.exec(ctx, `UPDATE device_commands SET status=?, result=?, acked_at=?, delivered_at=CASE WHEN delivered_at='' THEN ? ELSE delivered_at END
+		WHERE command_id=? AND device_id=? AND status IN (?, ?)`,
+		status, result, now, now, commandID, deviceID, CommandQueued, CommandDelivered)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return nil, err
+	} else if n == 0 {
+		return nil, ErrCommandNotFound
+	}
+	return d.GetDeviceCommand(ctx, commandID)
+}
+
+func (d *DB) GetDeviceCommand(ctx context.Context, commandID string) (*DeviceCommand, error) {
+	var c DeviceCommand
+	err := scanCommand(d.queryRow(ctx, `SELECT `+commandColumns+` FROM device_commands WHERE command_id=?`, commandID), &c)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrCommandNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.markExpired(time.Now())
+	return &c, nil
+}
+
+// ListDeviceCommands returns a parent's most recent commands, newest first.
+func (d *DB) ListDeviceCommands(ctx context.Context, parentEmail, deviceID string, limit int) ([]DeviceCommand, error) {
+	q := `SELECT ` + commandColumns + ` FROM device_commands WHERE parent_email=?`
+	args := []any{strings.ToLower(parentEmail)}
+	if deviceID != "" {
+		q += ` AND device_id=?`
+		args = append(args, deviceID)
+	}
+	rows, err := d.query(ctx, q+` ORDER BY created_at DESC, command_id LIMIT ?`, append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	out := []DeviceCommand{}
+	for rows.Next() {
+		var c DeviceCommand
+		if err := scanCommand(rows, &c); err != nil {
+			return nil, err
+		}
+		c.markExpired(now)
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+func (c *DeviceCommand) markExpired(now time.Time) {
+	if c.Status != CommandQueued && c.Status != CommandDelivered {
+		return
+	}
+	if exp, err := time.Parse(time.RFC3339, c.ExpiresAt); err == nil && !now.Before(exp) {
+		c.Status = CommandExpired
+	}
+}
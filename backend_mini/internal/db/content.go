@@ -0,0 +1,158 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"backend_mini/internal/util"
+)
+
+// Content filter strictness, per family. Every level but off queues what
+// it catches for admin review.
+const (
+	ContentFilterOff   = "off"
+	ContentFilterFlag  = "flag"  // stored as written
+	ContentFilterMask  = "mask"  // matches masked before storing
+	ContentFilterBlock = "block" // rejected
+)
+
+// Content flag statuses. Removing a flag blanks the field it was raised on.
+const (
+	ContentFlagOpen     = "open"
+	ContentFlagApproved = "approved"
+	ContentFlagRemoved  = "removed"
+)
+
+// ContentFieldChoreNote is the kid's note on a submitted chore, the only
+// kid-entered plaintext the server stores. Messages are end-to-end
+// encrypted and never seen in the clear.
+const ContentFieldChoreNote = "chore.submission_note"
+
+var ErrContentFlagNotFound = errors.New("no open content flag with that id")
+
+type ContentFilter struct {
+	ParentEmail string `json:"parent_email"`
+	Strictness  string `json:"strictness"`
+	UpdatedAt   string `json:"updated_at,omitempty"`
+}
+
+// ContentFlag is kid-entered text the filter caught, queued for review.
+type ContentFlag struct {
+	FlagID      string                `json:"flag_id"`
+	ParentEmail string                `json:"parent_email"`
+	KidEmail    string                `json:"kid_email"`
+	Field       string                `json:"field"`
+	SubjectID   string                `json:"subject_id"`
+	Original    string                `json:"original"`
+	Stored      string                `json:"stored"`
+	Findings    []util.ContentFinding `json:"findings"`
+	Strictness  string                `json:"strictness"`
+	Status      string                `json:"status"`
+	ReviewedBy  string                `json:"reviewed_by,omitempty"`
+	CreatedAt   string                `json:"created_at"`
+	ReviewedAt  string                `json:"reviewed_at,omitempty"`
+}
+
+// GetContentFilter returns the family's filter, masking by default.
+func (d *DB) GetContentFilter(ctx context.Context, parentEmail string) (ContentFilter, error) {
+	s, err := d.GetFamilySettings(ctx, parentEmail)
+	return ContentFilter{ParentEmail: s.ParentEmail, Strictness: s.ContentFilter, UpdatedAt: s.UpdatedAt}, err
+}
+
+// SetContentFilter changes only the content filter in the family settings.
+func (d *DB) SetContentFilter(ctx context.Context, parentEmail, strictness string) (ContentFilter, error) {
+	s, err := d.GetFamilySettings(ctx, parentEmail)
+	if err != nil {
+		return ContentFilter{}, err
+	}
+	s.ContentFilter = strictness
+	if s, err = d.SetFamilySettings(ctx, s); err != nil {
+		return ContentFilter{}, err
+	}
+	return ContentFilter{ParentEmail: s.ParentEmail, Strictness: s.ContentFilter, UpdatedAt: s.UpdatedAt}, nil
+}
+
+func (d *DB) AddContentFlag(ctx context.Context, f ContentFlag) (*ContentFlag, error) {
+	id, err := util.NewID()
+	if err != nil {
+		return nil, err
+	}
+	findings, err := json.Marshal(f.Findings)
+	if err != nil {
+		return nil, err
+	}
+	f.FlagID, f.Status, f.CreatedAt = id, ContentFlagOpen, time.Now().UTC().Format(time.RFC3339)
+	f.ParentEmail, f.KidEmail = strings.ToLower(f.ParentEmail), strings.ToLower(f.KidEmail)
+	_, err = d.exec(ctx, `INSERT INTO content_flags (flag_id, parent_email, kid_email, field, subject_id, original, stored, findings, strictness, status, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		f.FlagID, f.ParentEmail, f.KidEmail, f.Field, f.SubjectID, f.Original, f.Stored, string(findings), f.Strictness, f.Status, f.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+const contentFlagColumns = `flag_id, parent_email, kid_email, field, subject_id, original, stored, findings, strictness, status, reviewed_by, created_at, reviewed_at`
+
+func scanContentFlag(row rowScanner, f *ContentFlag) error {
+	var findings string
+	if err := row.Scan(&f.FlagID, &f.ParentEmail, &f.KidEmail, &f.Field, &f.SubjectID, &f.Original, &f.Stored, &findings, &f.Strictness, &f.Status, &f.ReviewedBy, &f.CreatedAt, &f.ReviewedAt); err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(findings), &f.Findings)
+}
+
+// ListContentFlags filters by status and parent; empty filters match all.
+func (d *DB) ListContentFlags(ctx context.Context, status, parentEmail string, limit int) ([]ContentFlag, error) {
+	rows, err := d.query(ctx, `SELECT `+contentFlagColumns+` FROM content_flags WHERE (?='' OR status=?) AND (?='' OR parent_email=?) ORDER BY created_at DESC LIMIT ?`,
+		status, status, strings.ToLower(parentEmail), strings.ToLower(parentEmail), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []ContentFlag{}
+	for rows.Next() {
+		var f ContentFlag
+		if err := scanContentFlag(rows, &f); err != nil {
+			return nil, err
+		}
+		out = append(out, f)
+	}
+	return out, rows.Err()
+}
+
+// ReviewContentFlag closes an open flag as approved, leaving the stored
+// text alone, or removed, blanking the field it was raised on.
+func (d *DB) ReviewContentFlag(ctx context.Context, flagID, status, reviewedBy string) (*ContentFlag, error) {
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx, `UPDATE content_flags SET status=?, reviewed_by=?, reviewed_at=? WHERE flag_id=? AND status=?`,
+		status, reviewedBy, time.Now().UTC().Format(time.RFC3339), flagID, ContentFlagOpen)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, ErrContentFlagNotFound
+	}
+	var f ContentFlag
+	if err := scanContentFlag(tx.QueryRowContext(ctx, `SELECT `+contentFlagColumns+` FROM content_flags WHERE flag_id=?`, flagID), &f); err != nil {
+		return nil, err
+	}
+	if status == ContentFlagRemoved && f.Field == ContentFieldChoreNote {
+		if _, err := tx.ExecContext(ctx, `UPDATE chores SET submission_note='' WHERE chore_id=? AND submission_note=?`, f.SubjectID, f.Stored); err != nil {
+			return nil, err
+		}
+	}
+	if err := writeAudit(ctx, tx, reviewedBy, "content_flag."+status, f.ParentEmail, f.FlagID); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
@@ -5,7 +5,10 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"net/url"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	_ "modernc.org/sqlite"
@@ -14,11 +17,32 @@ import (
 )
 
 type DB struct {
-	SQL *sql.DB
+	// SQL is the single writer connection; Read is a pool of query-only
+	// connections that WAL lets run concurrently with the writer.
+	SQL  *sql.DB
+	Read *sql.DB
+
+	readStmts  *stmtCache
+	writeStmts *stmtCache
+
+	quotas        Quotas
+	premiumQuotas Quotas
+	trashTTL      time.Duration
+
+	// dsn opens the live database; snap is the analytics snapshot, if any
+	dsn        string
+	snapPath   string
+	snapMaxAge time.Duration
+	snap       atomic.Pointer[analyticsSnapshot]
 }
 
+const maxReadConns = 8
+
 type Parent struct {
-	ID               string      `json:"id"`
+	ID string `json:"id"`
+	// Code is the parent's short public code. Families from before ids
+	// became ULIDs keep their old 6-character id as their code.
+	Code             string      `json:"code"`
 	Name             string      `json:"name"`
 	Email            string      `json:"email"`
 	KidsList         []ParentKid `json:"kids_list"`
@@ -26,12 +50,22 @@ type Parent struct {
 	Wallet           string      `json:"wallet"`
 }
 
+// Child.Email is the kid's key everywhere kid_email is stored. Kids added
+// by name have no address of their own, so their key is their lowercased
+// id; ContactEmail then holds the address they share with siblings, if any.
 type Child struct {
-	ID       string `json:"id"`
-	Name     string `json:"name"`
-	Email    string `json:"email"`
-	ParentID string `json:"parent_id"`
-	Wallet   string `json:"wallet"`
+	ID           string `json:"id"`
+	Name         string `json:"name"`
+	Email        string `json:"email"`
+	ParentID     string `json:"parent_id"`
+	Wallet       string `json:"wallet"`
+	ContactEmail string `json:"contact_email,omitempty"`
+	LoginCode    string `json:"login_code,omitempty"`
+	// BirthYear places the kid in an age band for anonymized partner
+	// statistics; zero is unknown.
+	BirthYear int `json:"birth_year,omitempty"`
+	// PausedUntil is set on responses while a pause covers the kid.
+	PausedUntil string `json:"paused_until,omitempty"`
 }
 
 type ParentKid struct {
@@ -47,8 +81,27 @@ type Chore struct {
 	ChoreDescription string `json:"chore_description"`
 	BountyAmount     uint64 `json:"bounty_amount"`
 	ChoreStatus      int    `json:"chore_status"`
+	DueDate          string `json:"due_date,omitempty"`
+	// Open chores were posted to every kid in the family. ChildWallet
+	// is empty until one claims it.
+	Open           bool   `json:"open,omitempty"`
+	ClaimExpiresAt string `json:"claim_expires_at,omitempty"`
+	// Kind is ChoreKindChore, or ChoreKindPenalty for an amount the kid
+	// owes the parent: acknowledging it builds a kid-to-parent transfer.
+	Kind string `json:"kind"`
+	// SubmissionNote is what the kid wrote when submitting the chore,
+	// after the family's content filter.
+	SubmissionNote string `json:"submission_note,omitempty"`
+	// Timeline summarizes the chore's history in lists; see ChoreTimeline.
+	Timeline *TimelineSummary `json:"timeline,omitempty"`
 }
 
+// Chore kinds.
+const (
+	ChoreKindChore   = "chore"
+	ChoreKindPenalty = "penalty"
+)
+
 type AppLimit struct {
 	LimitID      string `json:"limit_id"`
 	ParentEmail  string `json:"parent_email"`
@@ -57,21 +110,90 @@ type AppLimit struct {
 	TimePerDay   int    `json:"time_per_day"`
 	FeeExtraHour uint64 `json:"fee_extra_hour"`
 	CreatedAt    string `json:"created_at"`
+
+	// set by ApplyScheduleRules
+	DayType            string `json:"day_type,omitempty"`
+	ScheduleTimePerDay *int   `json:"schedule_time_per_day,omitempty"`
+
+	// set by ApplyZoneRules
+	Zone           string `json:"zone,omitempty"`
+	ZoneTimePerDay *int   `json:"zone_time_per_day,omitempty"`
+
+	// set while a pause covers the kid; devices stop enforcing until then
+	PausedUntil string `json:"paused_until,omitempty"`
+
+	// set by ResolveEffectiveLimits
+	EffectiveTimePerDay *int     `json:"effective_time_per_day,omitempty"`
+	LockedUntil         string   `json:"locked_until,omitempty"`
+	AppliedOverrides    []string `json:"applied_overrides,omitempty"`
+
+	// from the app catalog, when it knows the app
+	AppInfo *CatalogApp `json:"app_info,omitempty"`
+}
+
+// pragmas go in the DSN so every pooled connection gets them
+var pragmas = []string{"foreign_keys(1)", "busy_timeout(5000)", "journal_mode(WAL)", "synchronous(NORMAL)"}
+
+// sqliteDSN adds pragmas to path, keeping any query string it already
+// has, such as "file:sona.db?cache=shared".
+func sqliteDSN(path string, pragmas ...string) (string, error) {
+	name, query, _ := strings.Cut(path, "?")
+	q, err := url.ParseQuery(query)
+	if err != nil {
+		return "", fmt.Errorf("database path %q: %w", path, err)
+	}
+	for _, p := range pragmas {
+		q.Add("_pragma", p)
+	}
+	return name + "?" + q.Encode(), nil
 }
 
 func Open(ctx context.Context, path string) (*DB, error) {
-	d, err := sql.Open("sqlite", path)
+	dsn, err := sqliteDSN(path, pragmas...)
 	if err != nil {
 		return nil, err
 	}
-	if _, err := d.ExecContext(ctx, "PRAGMA foreign_keys = ON"); err != nil {
-		_ = d.Close()
+	readDSN, err := sqliteDSN(path, append(pragmas, "query_only(1)")...)
+	if err != nil {
+		return nil, err
+	}
+	w, err := sql.Open("sqlite", dsn)
+	if err != nil {
 		return nil, err
 	}
-	return &DB{SQL: d}, nil
+	w.SetMaxOpenConns(1)
+	if err := w.PingContext(ctx); err != nil {
+		_ = w.Close()
+		return nil, err
+	}
+
+	r, err := sql.Open("sqlite", readDSN)
+	if err != nil {
+		_ = w.Close()
+		return nil, err
+	}
+	r.SetMaxOpenConns(maxReadConns)
+	r.SetMaxIdleConns(maxReadConns)
+	if err := r.PingContext(ctx); err != nil {
+		_ = w.Close()
+		_ = r.Close()
+		return nil, err
+	}
+	return &DB{SQL: w, Read: r, readStmts: newStmtCache(r), writeStmts: newStmtCache(w), dsn: dsn}, nil
 }
 
-func (d *DB) Close() error { return d.SQL.Close() }
+func (d *DB) Close() error {
+	d.readStmts.close()
+	d.writeStmts.close()
+	if s := d.snap.Load(); s != nil {
+		_ = s.db.Close()
+	}
+	rerr := d.Read.Close()
+	if err := d.SQL.Close(); err != nil {
+		return err
+	}
+	return rerr
+}
 
 func (d *DB) Migrate(ctx context.Context) error {
 	stmts := []string{
@@ -110,43 +232,794 @@ func (d *DB) Migrate(ctx context.Context) error {
 			created_at TEXT NOT NULL,
 			UNIQUE(parent_email, kid_email, app)
 		);`,
+		`CREATE TABLE IF NOT EXISTS webhooks (
+			webhook_id TEXT PRIMARY KEY,
+			parent_email TEXT NOT NULL,
+			url TEXT NOT NULL,
+			secret TEXT NOT NULL,
+			created_at TEXT NOT NULL
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_webhooks_parent ON webhooks(parent_email);`,
+		`CREATE TABLE IF NOT EXISTS message_threads (
+			thread_id TEXT PRIMARY KEY,
+			parent_email TEXT NOT NULL,
+			kid_email TEXT NOT NULL,
+			chore_id TEXT NOT NULL DEFAULT '',
+			title TEXT NOT NULL DEFAULT '',
+			created_at TEXT NOT NULL
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_threads_members ON message_threads(parent_email, kid_email);`,
+		`CREATE TABLE IF NOT EXISTS messages (
+			seq INTEGER PRIMARY KEY AUTOINCREMENT,
+			message_id TEXT NOT NULL UNIQUE,
+			thread_id TEXT NOT NULL,
+			sender_email TEXT NOT NULL,
+			ciphertext TEXT NOT NULL,
+			encapsulated_key TEXT NOT NULL,
+			created_at TEXT NOT NULL,
+			delivered_at TEXT NOT NULL DEFAULT '',
+			read_at TEXT NOT NULL DEFAULT '',
+			FOREIGN KEY(thread_id) REFERENCES message_threads(thread_id) ON DELETE CASCADE
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_messages_thread ON messages(thread_id, seq);`,
+		`CREATE TABLE IF NOT EXISTS user_keys (
+			email TEXT PRIMARY KEY,
+			key_id TEXT NOT NULL,
+			public_key TEXT NOT NULL,
+			created_at TEXT NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS retired_keys (
+			email TEXT NOT NULL,
+			key_id TEXT NOT NULL,
+			public_key TEXT NOT NULL,
+			created_at TEXT NOT NULL,
+			retired_at TEXT NOT NULL,
+			PRIMARY KEY(email, key_id)
+		);`,
+		`CREATE TABLE IF NOT EXISTS audit_log (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			actor TEXT NOT NULL,
+			action TEXT NOT NULL,
+			subject TEXT NOT NULL,
+			detail TEXT NOT NULL DEFAULT '',
+			created_at TEXT NOT NULL
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_subject ON audit_log(subject, id);`,
+		`CREATE TABLE IF NOT EXISTS events (
+			seq INTEGER PRIMARY KEY AUTOINCREMENT,
+			type TEXT NOT NULL,
+			parent_email TEXT NOT NULL,
+			payload TEXT NOT NULL,
+			created_at TEXT NOT NULL
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_events_parent ON events(parent_email, seq);`,
+		`CREATE TABLE IF NOT EXISTS balance_alerts (
+			alert_id TEXT PRIMARY KEY,
+			parent_email TEXT NOT NULL,
+			kid_email TEXT NOT NULL,
+			direction TEXT NOT NULL,
+			threshold INTEGER NOT NULL,
+			state TEXT NOT NULL DEFAULT 'ok',
+			last_balance INTEGER NOT NULL DEFAULT 0,
+			last_checked_at TEXT NOT NULL DEFAULT '',
+			triggered_at TEXT NOT NULL DEFAULT '',
+			created_at TEXT NOT NULL
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_balance_alerts_kid ON balance_alerts(kid_email);`,
+		`CREATE TABLE IF NOT EXISTS split_rules (
+			kid_email TEXT PRIMARY KEY,
+			parent_email TEXT NOT NULL,
+			percent INTEGER NOT NULL,
+			savings_wallet TEXT NOT NULL,
+			updated_at TEXT NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS limit_overrides (
+			override_id TEXT PRIMARY KEY,
+			parent_email TEXT NOT NULL,
+			kid_email TEXT NOT NULL,
+			kind TEXT NOT NULL,
+			app TEXT NOT NULL DEFAULT '',
+			minutes INTEGER NOT NULL DEFAULT 0,
+			starts_at TEXT NOT NULL,
+			expires_at TEXT NOT NULL,
+			issued_by TEXT NOT NULL,
+			created_at TEXT NOT NULL
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_limit_overrides_kid ON limit_overrides(kid_email, expires_at);`,
+		`CREATE TABLE IF NOT EXISTS pairing_codes (
+			code TEXT PRIMARY KEY,
+			parent_email TEXT NOT NULL,
+			kid_email TEXT NOT NULL,
+			expires_at TEXT NOT NULL,
+			redeemed_at TEXT NOT NULL DEFAULT '',
+			created_at TEXT NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS devices (
+			device_id TEXT PRIMARY KEY,
+			kid_email TEXT NOT NULL,
+			parent_email TEXT NOT NULL,
+			name TEXT NOT NULL,
+			platform TEXT NOT NULL DEFAULT '',
+			paired_at TEXT NOT NULL,
+			last_seen_at TEXT NOT NULL DEFAULT '',
+			unpaired_at TEXT NOT NULL DEFAULT ''
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_devices_kid ON devices(kid_email);`,
+		`CREATE INDEX IF NOT EXISTS idx_devices_parent ON devices(parent_email);`,
+		`CREATE TABLE IF NOT EXISTS device_commands (
+			command_id TEXT PRIMARY KEY,
+			device_id TEXT NOT NULL,
+			kid_email TEXT NOT NULL,
+			parent_email TEXT NOT NULL,
+			type TEXT NOT NULL,
+			payload TEXT NOT NULL,
+			signature TEXT NOT NULL,
+			status TEXT NOT NULL,
+			result TEXT NOT NULL DEFAULT '',
+			created_at TEXT NOT NULL,
+			expires_at TEXT NOT NULL,
+			delivered_at TEXT NOT NULL DEFAULT '',
+			acked_at TEXT NOT NULL DEFAULT ''
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_device_commands_device ON device_commands(device_id, status);`,
+		`CREATE TABLE IF NOT EXISTS location_settings (
+			parent_email TEXT PRIMARY KEY,
+			enabled INTEGER NOT NULL DEFAULT 0,
+			retention_hours INTEGER NOT NULL,
+			updated_at TEXT NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS geofences (
+			geofence_id TEXT PRIMARY KEY,
+			parent_email TEXT NOT NULL,
+			name TEXT NOT NULL,
+			lat REAL NOT NULL,
+			lng REAL NOT NULL,
+			radius_m INTEGER NOT NULL,
+			rules TEXT NOT NULL,
+			created_at TEXT NOT NULL
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_geofences_parent ON geofences(parent_email);`,
+		`CREATE TABLE IF NOT EXISTS location_reports (
+			seq INTEGER PRIMARY KEY AUTOINCREMENT,
+			kid_email TEXT NOT NULL,
+			parent_email TEXT NOT NULL,
+			device_id TEXT NOT NULL,
+			lat REAL NOT NULL,
+			lng REAL NOT NULL,
+			reported_at TEXT NOT NULL,
+			expires_at TEXT NOT NULL
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_location_reports_kid ON location_reports(kid_email, reported_at);`,
+		`CREATE INDEX IF NOT EXISTS idx_location_reports_expiry ON location_reports(expires_at);`,
+		`CREATE TABLE IF NOT EXISTS family_calendars (
+			calendar_id TEXT PRIMARY KEY,
+			parent_email TEXT NOT NULL,
+			name TEXT NOT NULL,
+			kind TEXT NOT NULL,
+			url TEXT NOT NULL DEFAULT '',
+			last_synced_at TEXT NOT NULL DEFAULT '',
+			last_error TEXT NOT NULL DEFAULT '',
+			created_at TEXT NOT NULL
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_family_calendars_parent ON family_calendars(parent_email);`,
+		`CREATE TABLE IF NOT EXISTS calendar_days (
+			calendar_id TEXT NOT NULL,
+			day TEXT NOT NULL,
+			summary TEXT NOT NULL DEFAULT '',
+			PRIMARY KEY (calendar_id, day)
+		);`,
+		`CREATE TABLE IF NOT EXISTS schedule_rules (
+			rule_id TEXT PRIMARY KEY,
+			parent_email TEXT NOT NULL,
+			kid_email TEXT NOT NULL,
+			app TEXT NOT NULL DEFAULT '',
+			day_type TEXT NOT NULL,
+			time_per_day INTEGER NOT NULL,
+			created_at TEXT NOT NULL,
+			UNIQUE(kid_email, app, day_type)
+		);`,
+		`CREATE TABLE IF NOT EXISTS usage_reports (
+			device_id TEXT NOT NULL,
+			kid_email TEXT NOT NULL,
+			app TEXT NOT NULL,
+			day TEXT NOT NULL,
+			minutes INTEGER NOT NULL,
+			updated_at TEXT NOT NULL,
+			PRIMARY KEY (device_id, app, day)
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_usage_reports_kid ON usage_reports(kid_email, day);`,
+		`CREATE TABLE IF NOT EXISTS api_tokens (
+			token_id TEXT PRIMARY KEY,
+			parent_email TEXT NOT NULL,
+			name TEXT NOT NULL,
+			token_hash TEXT NOT NULL UNIQUE,
+			scopes TEXT NOT NULL,
+			created_at TEXT NOT NULL,
+			expires_at TEXT NOT NULL,
+			last_used_at TEXT NOT NULL DEFAULT '',
+			revoked_at TEXT NOT NULL DEFAULT ''
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_api_tokens_parent ON api_tokens(parent_email);`,
+		`CREATE TABLE IF NOT EXISTS integrations (
+			integration_id TEXT PRIMARY KEY,
+			parent_email TEXT NOT NULL,
+			name TEXT NOT NULL,
+			kind TEXT NOT NULL,
+			url TEXT NOT NULL,
+			event_types TEXT NOT NULL DEFAULT '[]',
+			template TEXT NOT NULL DEFAULT '',
+			created_at TEXT NOT NULL
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_integrations_parent ON integrations(parent_email);`,
+		`CREATE TABLE IF NOT EXISTS family_policies (
+			parent_email TEXT NOT NULL,
+			version INTEGER NOT NULL,
+			document TEXT NOT NULL,
+			created_by TEXT NOT NULL,
+			created_at TEXT NOT NULL,
+			PRIMARY KEY (parent_email, version)
+		);`,
+		`CREATE TABLE IF NOT EXISTS transfers (
+			transfer_id TEXT PRIMARY KEY,
+			from_wallet TEXT NOT NULL,
+			kind TEXT NOT NULL,
+			ref TEXT NOT NULL DEFAULT '',
+			total INTEGER NOT NULL,
+			created_at TEXT NOT NULL
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_transfers_from ON transfers(from_wallet, created_at);`,
+		`CREATE TABLE IF NOT EXISTS transfer_legs (
+			transfer_id TEXT NOT NULL,
+			to_wallet TEXT NOT NULL,
+			amount INTEGER NOT NULL,
+			FOREIGN KEY(transfer_id) REFERENCES transfers(transfer_id) ON DELETE CASCADE
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_transfer_legs_to ON transfer_legs(to_wallet);`,
+		`CREATE INDEX IF NOT EXISTS idx_transfer_legs_transfer ON transfer_legs(transfer_id);`,
+		`CREATE TABLE IF NOT EXISTS statements (
+			kid_email TEXT NOT NULL,
+			period TEXT NOT NULL,
+			wallet TEXT NOT NULL,
+			opening_balance INTEGER NOT NULL,
+			closing_balance INTEGER NOT NULL,
+			entries TEXT NOT NULL,
+			finalized_at TEXT NOT NULL,
+			PRIMARY KEY (kid_email, period)
+		);`,
+		`CREATE TABLE IF NOT EXISTS anomaly_settings (
+			parent_email TEXT PRIMARY KEY,
+			burst_count INTEGER NOT NULL,
+			burst_minutes INTEGER NOT NULL,
+			large_multiplier REAL NOT NULL,
+			flag_new_recipients INTEGER NOT NULL,
+			block_on_flag INTEGER NOT NULL,
+			updated_at TEXT NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS transfer_flags (
+			flag_id TEXT PRIMARY KEY,
+			transfer_id TEXT NOT NULL,
+			parent_email TEXT NOT NULL,
+			from_wallet TEXT NOT NULL,
+			rule TEXT NOT NULL,
+			detail TEXT NOT NULL,
+			status TEXT NOT NULL DEFAULT 'open',
+			resolution_note TEXT NOT NULL DEFAULT '',
+			resolved_by TEXT NOT NULL DEFAULT '',
+			created_at TEXT NOT NULL,
+			resolved_at TEXT NOT NULL DEFAULT '',
+			UNIQUE (transfer_id, rule)
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_transfer_flags_status ON transfer_flags(status, created_at);`,
+		`CREATE INDEX IF NOT EXISTS idx_transfer_flags_wallet ON transfer_flags(from_wallet, status);`,
+		`CREATE TABLE IF NOT EXISTS build_locks (
+			wallet TEXT PRIMARY KEY,
+			holder TEXT NOT NULL,
+			expires_at TEXT NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS savings_locks (
+			lock_id TEXT PRIMARY KEY,
+			parent_email TEXT NOT NULL,
+			kid_email TEXT NOT NULL,
+			wallet TEXT NOT NULL,
+			amount INTEGER NOT NULL,
+			unlock_on TEXT NOT NULL,
+			until_age INTEGER NOT NULL DEFAULT 0,
+			note TEXT NOT NULL DEFAULT '',
+			status TEXT NOT NULL,
+			unlock_reason TEXT NOT NULL DEFAULT '',
+			requested_at TEXT NOT NULL DEFAULT '',
+			decided_at TEXT NOT NULL DEFAULT '',
+			created_at TEXT NOT NULL
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_savings_locks_wallet ON savings_locks(wallet, status);`,
+		`CREATE TABLE IF NOT EXISTS app_limit_history (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			limit_id TEXT NOT NULL,
+			parent_email TEXT NOT NULL,
+			kid_email TEXT NOT NULL,
+			app TEXT NOT NULL,
+			old_time_per_day INTEGER,
+			old_fee_extra_hour INTEGER,
+			time_per_day INTEGER NOT NULL,
+			fee_extra_hour INTEGER NOT NULL,
+			changed_by TEXT NOT NULL,
+			source TEXT NOT NULL,
+			changed_at TEXT NOT NULL
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_app_limit_history_kid ON app_limit_history(kid_email, id);`,
+		`CREATE TABLE IF NOT EXISTS scheduled_limit_changes (
+			change_id TEXT PRIMARY KEY,
+			parent_email TEXT NOT NULL,
+			kid_email TEXT NOT NULL,
+			app TEXT NOT NULL,
+			time_per_day INTEGER NOT NULL,
+			fee_extra_hour INTEGER NOT NULL,
+			effective_at TEXT NOT NULL,
+			status TEXT NOT NULL,
+			created_by TEXT NOT NULL,
+			created_at TEXT NOT NULL,
+			applied_at TEXT NOT NULL DEFAULT ''
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_scheduled_limit_changes_kid ON scheduled_limit_changes(kid_email, status, effective_at);`,
+		`CREATE TABLE IF NOT EXISTS app_catalog (
+			bundle_id TEXT PRIMARY KEY,
+			display_name TEXT NOT NULL,
+			icon_url TEXT NOT NULL DEFAULT '',
+			category TEXT NOT NULL DEFAULT '',
+			age_rating TEXT NOT NULL DEFAULT '',
+			updated_at TEXT NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS app_alerts (
+			alert_id TEXT PRIMARY KEY,
+			parent_email TEXT NOT NULL,
+			kid_email TEXT NOT NULL,
+			app TEXT NOT NULL,
+			first_seen_day TEXT NOT NULL,
+			minutes INTEGER NOT NULL,
+			status TEXT NOT NULL,
+			resolved_at TEXT NOT NULL DEFAULT '',
+			created_at TEXT NOT NULL,
+			UNIQUE(kid_email, app)
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_app_alerts_parent ON app_alerts(parent_email, status);`,
+		`CREATE TABLE IF NOT EXISTS family_settings (
+			parent_email TEXT PRIMARY KEY,
+			timezone TEXT NOT NULL,
+			currency TEXT NOT NULL,
+			notifications TEXT NOT NULL,
+			auto_approve_below INTEGER NOT NULL,
+			auto_approve_after_hours INTEGER NOT NULL,
+			content_filter TEXT NOT NULL,
+			features TEXT NOT NULL,
+			updated_at TEXT NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS content_flags (
+			flag_id TEXT PRIMARY KEY,
+			parent_email TEXT NOT NULL,
+			kid_email TEXT NOT NULL,
+			field TEXT NOT NULL,
+			subject_id TEXT NOT NULL,
+			original TEXT NOT NULL,
+			stored TEXT NOT NULL,
+			findings TEXT NOT NULL,
+			strictness TEXT NOT NULL,
+			status TEXT NOT NULL DEFAULT 'open',
+			reviewed_by TEXT NOT NULL DEFAULT '',
+			created_at TEXT NOT NULL,
+			reviewed_at TEXT NOT NULL DEFAULT ''
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_content_flags_status ON content_flags(status, created_at);`,
+		`CREATE TABLE IF NOT EXISTS account_recoveries (
+			recovery_id TEXT PRIMARY KEY,
+			old_email TEXT NOT NULL,
+			new_email TEXT NOT NULL,
+			verified_by TEXT NOT NULL,
+			document_ref TEXT NOT NULL,
+			reason TEXT NOT NULL,
+			status TEXT NOT NULL,
+			cooling_off_until TEXT NOT NULL,
+			reviewed_by TEXT NOT NULL,
+			review_note TEXT NOT NULL,
+			created_at TEXT NOT NULL,
+			decided_at TEXT NOT NULL
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_account_recoveries_old ON account_recoveries(old_email, status);`,
+		`CREATE TABLE IF NOT EXISTS message_templates (
+			name TEXT NOT NULL,
+			channel TEXT NOT NULL,
+			version INTEGER NOT NULL,
+			title TEXT NOT NULL DEFAULT '',
+			body TEXT NOT NULL,
+			active INTEGER NOT NULL DEFAULT 0,
+			created_by TEXT NOT NULL,
+			created_at TEXT NOT NULL,
+			promoted_at TEXT NOT NULL DEFAULT '',
+			PRIMARY KEY (name, channel, version)
+		);`,
+		`CREATE TABLE IF NOT EXISTS chore_timeline (
+			chore_id TEXT NOT NULL,
+			seq INTEGER NOT NULL,
+			kind TEXT NOT NULL,
+			actor TEXT NOT NULL,
+			note TEXT NOT NULL DEFAULT '',
+			ref TEXT NOT NULL DEFAULT '',
+			created_at TEXT NOT NULL,
+			PRIMARY KEY (chore_id, seq)
+		);`,
+		`CREATE TABLE IF NOT EXISTS gifts (
+			gift_id TEXT PRIMARY KEY,
+			parent_email TEXT NOT NULL,
+			kid_email TEXT NOT NULL,
+			wallet TEXT NOT NULL,
+			amount INTEGER NOT NULL DEFAULT 0,
+			note TEXT NOT NULL DEFAULT '',
+			from_name TEXT NOT NULL DEFAULT '',
+			message TEXT NOT NULL DEFAULT '',
+			reference TEXT NOT NULL,
+			status TEXT NOT NULL,
+			signature TEXT NOT NULL DEFAULT '',
+			received INTEGER NOT NULL DEFAULT 0,
+			created_at TEXT NOT NULL,
+			expires_at TEXT NOT NULL,
+			received_at TEXT NOT NULL DEFAULT '',
+			token_hash TEXT NOT NULL UNIQUE
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_gifts_parent ON gifts(parent_email, created_at);`,
+		`CREATE TABLE IF NOT EXISTS partners (
+			partner_id TEXT PRIMARY KEY,
+			name TEXT NOT NULL,
+			key_hash TEXT NOT NULL UNIQUE,
+			created_at TEXT NOT NULL,
+			last_used_at TEXT NOT NULL DEFAULT '',
+			revoked_at TEXT NOT NULL DEFAULT ''
+		);`,
+		`CREATE TABLE IF NOT EXISTS warehouse_rows (
+			table_name TEXT NOT NULL,
+			row_key TEXT NOT NULL,
+			row_hash TEXT NOT NULL,
+			exported_at TEXT NOT NULL,
+			PRIMARY KEY (table_name, row_key)
+		);`,
+		`CREATE TABLE IF NOT EXISTS quota_overrides (
+			parent_email TEXT NOT NULL,
+			resource TEXT NOT NULL,
+			max INTEGER NOT NULL,
+			set_by TEXT NOT NULL,
+			updated_at TEXT NOT NULL,
+			PRIMARY KEY (parent_email, resource)
+		);`,
+		`CREATE TABLE IF NOT EXISTS device_sequences (
+			device_id TEXT NOT NULL,
+			stream TEXT NOT NULL,
+			high INTEGER NOT NULL,
+			mask INTEGER NOT NULL,
+			accepted INTEGER NOT NULL DEFAULT 0,
+			duplicates INTEGER NOT NULL DEFAULT 0,
+			stale INTEGER NOT NULL DEFAULT 0,
+			updated_at TEXT NOT NULL,
+			PRIMARY KEY (device_id, stream)
+		);`,
+		`CREATE TABLE IF NOT EXISTS pauses (
+			pause_id TEXT PRIMARY KEY,
+			parent_email TEXT NOT NULL,
+			kid_email TEXT NOT NULL DEFAULT '',
+			starts_at TEXT NOT NULL,
+			ends_at TEXT NOT NULL,
+			reason TEXT NOT NULL DEFAULT '',
+			created_at TEXT NOT NULL
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_pauses_parent ON pauses(parent_email, ends_at);`,
+		`CREATE TABLE IF NOT EXISTS trash (
+			trash_id TEXT PRIMARY KEY,
+			kind TEXT NOT NULL,
+			item_id TEXT NOT NULL,
+			parent_email TEXT NOT NULL,
+			kid_email TEXT NOT NULL DEFAULT '',
+			label TEXT NOT NULL DEFAULT '',
+			data TEXT NOT NULL,
+			deleted_by TEXT NOT NULL,
+			deleted_at TEXT NOT NULL,
+			expires_at TEXT NOT NULL
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_trash_parent ON trash(parent_email, deleted_at);`,
+		`CREATE INDEX IF NOT EXISTS idx_trash_expires ON trash(expires_at);`,
+		`CREATE TABLE IF NOT EXISTS family_handles (
+			handle TEXT PRIMARY KEY,
+			parent_email TEXT NOT NULL,
+			claimed_at TEXT NOT NULL,
+			released_at TEXT NOT NULL DEFAULT ''
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_family_handles_parent ON family_handles(parent_email, released_at);`,
+		`CREATE TABLE IF NOT EXISTS feature_flags (
+			name TEXT PRIMARY KEY,
+			enabled INTEGER NOT NULL DEFAULT 0,
+			message TEXT NOT NULL DEFAULT '',
+			updated_by TEXT NOT NULL,
+			updated_at TEXT NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS chore_delegations (
+			delegation_id TEXT PRIMARY KEY,
+			parent_email TEXT NOT NULL,
+			delegate_name TEXT NOT NULL,
+			delegate_email TEXT NOT NULL DEFAULT '',
+			chore_ids TEXT NOT NULL,
+			token_hash TEXT NOT NULL UNIQUE,
+			created_at TEXT NOT NULL,
+			expires_at TEXT NOT NULL,
+			last_used_at TEXT NOT NULL DEFAULT '',
+			revoked_at TEXT NOT NULL DEFAULT ''
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_chore_delegations_parent ON chore_delegations(parent_email, created_at);`,
+		`CREATE TABLE IF NOT EXISTS subscriptions (
+			subscription_id TEXT PRIMARY KEY,
+			parent_email TEXT NOT NULL,
+			source TEXT NOT NULL,
+			external_id TEXT NOT NULL,
+			product_id TEXT NOT NULL,
+			status TEXT NOT NULL,
+			expires_at TEXT NOT NULL,
+			auto_renew INTEGER NOT NULL DEFAULT 0,
+			created_at TEXT NOT NULL,
+			updated_at TEXT NOT NULL,
+			UNIQUE (source, external_id)
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_subscriptions_parent ON subscriptions(parent_email, expires_at);`,
+		`CREATE TABLE IF NOT EXISTS stripe_events (
+			event_id TEXT PRIMARY KEY,
+			type TEXT NOT NULL,
+			received_at TEXT NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS transfer_reversals (
+			reversal_id TEXT PRIMARY KEY,
+			transfer_id TEXT NOT NULL,
+			parent_email TEXT NOT NULL,
+			requested_by TEXT NOT NULL,
+			reason TEXT NOT NULL DEFAULT '',
+			amount INTEGER NOT NULL,
+			status TEXT NOT NULL,
+			ack_email TEXT NOT NULL DEFAULT '',
+			decided_at TEXT NOT NULL DEFAULT '',
+			reversal_transfer_id TEXT NOT NULL DEFAULT '',
+			created_at TEXT NOT NULL
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_transfer_reversals_transfer ON transfer_reversals(transfer_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_transfer_reversals_parent ON transfer_reversals(parent_email, created_at);`,
+		`CREATE TABLE IF NOT EXISTS inbound_emails (
+			message_id TEXT PRIMARY KEY,
+			parent_email TEXT NOT NULL,
+			chores_created INTEGER NOT NULL DEFAULT 0,
+			received_at TEXT NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS assistant_links (
+			link_id TEXT PRIMARY KEY,
+			parent_email TEXT NOT NULL,
+			client_id TEXT NOT NULL,
+			refresh_hash TEXT NOT NULL UNIQUE,
+			created_at TEXT NOT NULL,
+			last_used_at TEXT NOT NULL DEFAULT '',
+			revoked_at TEXT NOT NULL DEFAULT ''
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_assistant_links_parent ON assistant_links(parent_email, created_at);`,
+		`CREATE TABLE IF NOT EXISTS assistant_codes (
+			code_hash TEXT PRIMARY KEY,
+			parent_email TEXT NOT NULL,
+			client_id TEXT NOT NULL,
+			redirect_uri TEXT NOT NULL,
+			expires_at TEXT NOT NULL,
+			used_at TEXT NOT NULL DEFAULT ''
+		);`,
+		`CREATE TABLE IF NOT EXISTS action_tokens (
+			token_id TEXT PRIMARY KEY,
+			parent_email TEXT NOT NULL,
+			action TEXT NOT NULL,
+			chore_id TEXT NOT NULL DEFAULT '',
+			kid_email TEXT NOT NULL DEFAULT '',
+			amount INTEGER NOT NULL DEFAULT 0,
+			token_hash TEXT NOT NULL UNIQUE,
+			created_at TEXT NOT NULL,
+			expires_at TEXT NOT NULL,
+			used_at TEXT NOT NULL DEFAULT ''
+		);`,
+		`CREATE TABLE IF NOT EXISTS ledger_chain (
+			seq INTEGER PRIMARY KEY AUTOINCREMENT,
+			event TEXT NOT NULL,
+			transfer_id TEXT NOT NULL,
+			payload TEXT NOT NULL,
+			prev_hash TEXT NOT NULL,
+			hash TEXT NOT NULL,
+			created_at TEXT NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS ledger_anchors (
+			seq INTEGER PRIMARY KEY,
+			hash TEXT NOT NULL,
+			signature TEXT NOT NULL,
+			anchored_at TEXT NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS chores_history (
+			hist_id INTEGER PRIMARY KEY AUTOINCREMENT,
+			op TEXT NOT NULL,
+			changed_at TEXT NOT NULL,
+			chore_id TEXT NOT NULL,
+			parent_wallet TEXT NOT NULL,
+			child_wallet TEXT NOT NULL,
+			chore_name TEXT NOT NULL,
+			chore_description TEXT NOT NULL,
+			bounty_amount INTEGER NOT NULL,
+			chore_status INTEGER NOT NULL,
+			due_date TEXT NOT NULL,
+			open INTEGER NOT NULL,
+			claim_expires_at TEXT NOT NULL,
+			kind TEXT NOT NULL,
+			submission_note TEXT NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS app_limits_history (
+			hist_id INTEGER PRIMARY KEY AUTOINCREMENT,
+			op TEXT NOT NULL,
+			changed_at TEXT NOT NULL,
+			limit_id TEXT NOT NULL,
+			parent_email TEXT NOT NULL,
+			kid_email TEXT NOT NULL,
+			app TEXT NOT NULL,
+			time_per_day INTEGER NOT NULL,
+			fee_extra_hour INTEGER NOT NULL,
+			created_at TEXT NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS kid_pins (
+			kid_email TEXT PRIMARY KEY,
+			pin_hash TEXT NOT NULL,
+			failed_attempts INTEGER NOT NULL DEFAULT 0,
+			locked_until TEXT NOT NULL DEFAULT '',
+			updated_at TEXT NOT NULL
+		);`,
 	}
 	for _, s := range stmts {
 		if _, err := d.SQL.ExecContext(ctx, s); err != nil {
 			return err
 		}
 	}
-	return nil
+	// columns added to tables that already exist in deployed databases
+	columns := []struct{ table, column, ddl string }{
+		{"chores", "due_date", `ALTER TABLE chores ADD COLUMN due_date TEXT NOT NULL DEFAULT ''`},
+		{"chores", "open", `ALTER TABLE chores ADD COLUMN open INTEGER NOT NULL DEFAULT 0`},
+		{"chores", "claim_expires_at", `ALTER TABLE chores ADD COLUMN claim_expires_at TEXT NOT NULL DEFAULT ''`},
+		{"chores", "kind", `ALTER TABLE chores ADD COLUMN kind TEXT NOT NULL DEFAULT 'chore'`},
+		{"chores", "submission_note", `ALTER TABLE chores ADD COLUMN submission_note TEXT NOT NULL DEFAULT ''`},
+		{"transfers", "scanned", `ALTER TABLE transfers ADD COLUMN scanned INTEGER NOT NULL DEFAULT 0`},
+		{"transfers", "to_wallet", `ALTER TABLE transfers ADD COLUMN to_wallet TEXT NOT NULL DEFAULT ''`},
+		{"transfers", "status", `ALTER TABLE transfers ADD COLUMN status TEXT NOT NULL DEFAULT 'built'`},
+		{"transfers", "blockhash", `ALTER TABLE transfers ADD COLUMN blockhash TEXT NOT NULL DEFAULT ''`},
+		{"transfers", "expires_at", `ALTER TABLE transfers ADD COLUMN expires_at TEXT NOT NULL DEFAULT ''`},
+		{"transfers", "superseded_by", `ALTER TABLE transfers ADD COLUMN superseded_by TEXT NOT NULL DEFAULT ''`},
+		{"transfers", "ata_creates", `ALTER TABLE transfers ADD COLUMN ata_creates TEXT NOT NULL DEFAULT '[]'`},
+		{"transfers", "message_hash", `ALTER TABLE transfers ADD COLUMN message_hash TEXT NOT NULL DEFAULT ''`},
+		{"transfers", "signature", `ALTER TABLE transfers ADD COLUMN signature TEXT NOT NULL DEFAULT ''`},
+		{"transfers", "settled_at", `ALTER TABLE transfers ADD COLUMN settled_at TEXT NOT NULL DEFAULT ''`},
+		{"children", "contact_email", `ALTER TABLE children ADD COLUMN contact_email TEXT NOT NULL DEFAULT ''`},
+		{"children", "login_code", `ALTER TABLE children ADD COLUMN login_code TEXT NOT NULL DEFAULT ''`},
+		{"children", "birth_year", `ALTER TABLE children ADD COLUMN birth_year INTEGER NOT NULL DEFAULT 0`},
+		{"parents", "code", `ALTER TABLE parents ADD COLUMN code TEXT NOT NULL DEFAULT ''`},
+		{"devices", "public_key", `ALTER TABLE devices ADD COLUMN public_key TEXT NOT NULL DEFAULT ''`},
+		{"webhooks", "filter", `ALTER TABLE webhooks ADD COLUMN filter TEXT NOT NULL DEFAULT ''`},
+		{"webhooks", "transform", `ALTER TABLE webhooks ADD COLUMN transform TEXT NOT NULL DEFAULT ''`},
+		{"family_settings", "data_sharing_consent", `ALTER TABLE family_settings ADD COLUMN data_sharing_consent TEXT NOT NULL DEFAULT ''`},
+		// flags from before it read as expired, which at most lets one build
+		// through early during the upgrade
+		{"build_locks", "expires_ns", `ALTER TABLE build_locks ADD COLUMN expires_ns INTEGER NOT NULL DEFAULT 0`},
+	}
+	for _, c := range columns {
+		if err := d.ensureColumn(ctx, c.table, c.column, c.ddl); err != nil {
+			return err
+		}
+	}
+	// indexes over the columns above, so they run once those exist
+	indexes := []string{
+		`UPDATE parents SET code=id WHERE code='' AND length(id)=6;`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_parents_code ON parents(code) WHERE code <> '';`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_children_login_code ON children(login_code) WHERE login_code <> '';`,
+		// one thread per chore: fold any duplicate chore threads (and their
+		// messages) into the first before the index can hold
+		`UPDATE messages SET thread_id=(SELECT k.thread_id FROM message_threads t JOIN message_threads k ON k.chore_id=t.chore_id WHERE t.thread_id=messages.thread_id ORDER BY k.created_at, k.thread_id LIMIT 1)
+			WHERE thread_id IN (SELECT t.thread_id FROM message_threads t WHERE t.chore_id <> '' AND EXISTS (SELECT 1 FROM message_threads k WHERE k.chore_id=t.chore_id AND (k.created_at, k.thread_id) < (t.created_at, t.thread_id)));`,
+		`DELETE FROM message_threads WHERE chore_id <> '' AND EXISTS (SELECT 1 FROM message_threads k WHERE k.chore_id=message_threads.chore_id AND (k.created_at, k.thread_id) < (message_threads.created_at, message_threads.thread_id));`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_threads_chore ON message_threads(chore_id) WHERE chore_id <> '';`,
+		`CREATE INDEX IF NOT EXISTS idx_children_contact ON children(contact_email) WHERE contact_email <> '';`,
+		`CREATE INDEX IF NOT EXISTS idx_children_name ON children(parent_id, lower(name));`,
+		`CREATE INDEX IF NOT EXISTS idx_children_wallet ON children(wallet);`,
+		`CREATE INDEX IF NOT EXISTS idx_parents_wallet ON parents(wallet);`,
+		`CREATE INDEX IF NOT EXISTS idx_chores_parent ON chores(parent_wallet, chore_status, due_date);`,
+		`CREATE INDEX IF NOT EXISTS idx_chores_child ON chores(child_wallet, chore_status, due_date);`,
+		`CREATE INDEX IF NOT EXISTS idx_ledger_chain_transfer ON ledger_chain(transfer_id, event);`,
+		// the ledger is append-only: only a transfer's status, what superseded
+		// it and whether the anomaly scan saw it may change after it is written
+		`CREATE TRIGGER IF NOT EXISTS ledger_chain_no_update BEFORE UPDATE ON ledger_chain BEGIN SELECT RAISE(ABORT, 'ledger_chain is append-only'); END;`,
+		`CREATE TRIGGER IF NOT EXISTS ledger_chain_no_delete BEFORE DELETE ON ledger_chain BEGIN SELECT RAISE(ABORT, 'ledger_chain is append-only'); END;`,
+		`CREATE TRIGGER IF NOT EXISTS transfers_no_update BEFORE UPDATE OF transfer_id, from_wallet, to_wallet, kind, ref, total, blockhash, expires_at, ata_creates, message_hash, created_at ON transfers BEGIN SELECT RAISE(ABORT, 'transfers are append-only'); END;`,
+		`CREATE TRIGGER IF NOT EXISTS transfers_no_delete BEFORE DELETE ON transfers BEGIN SELECT RAISE(ABORT, 'transfers are append-only'); END;`,
+		`CREATE TRIGGER IF NOT EXISTS transfer_legs_no_update BEFORE UPDATE ON transfer_legs BEGIN SELECT RAISE(ABORT, 'transfer legs are append-only'); END;`,
+		`CREATE TRIGGER IF NOT EXISTS transfer_legs_no_delete BEFORE DELETE ON transfer_legs BEGIN SELECT RAISE(ABORT, 'transfer legs are append-only'); END;`,
+	}
+	indexes = append(indexes, historyTriggers()...)
+	for _, s := range indexes {
+		if _, err := d.SQL.ExecContext(ctx, s); err != nil {
+			return err
+		}
+	}
+	if err := d.baselineHistory(ctx); err != nil {
+		return err
+	}
+	return d.chainUnchainedTransfers(ctx)
+}
+
+func (d *DB) ensureColumn(ctx context.Context, table, column, ddl string) error {
+	rows, err := d.SQL.QueryContext(ctx, `SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+	_, err = d.SQL.ExecContext(ctx, ddl)
+	return err
 }
 
 func (d *DB) GetParentByEmail(ctx context.Context, email string) (*Parent, bool, error) {
-	row := d.SQL.QueryRowContext(ctx, `SELECT id, name, email, kids_list, registration_date, wallet FROM parents WHERE lower(email)=?`, strings.ToLower(email))
+	return scanParent(d.queryRow(ctx, `SELECT id, code, name, email, kids_list, registration_date, wallet FROM parents WHERE lower(email)=?`, strings.ToLower(email)))
+}
+
+// scanParent tolerates NULLs in columns that legacy rows may lack.
+func scanParent(row *sql.Row) (*Parent, bool, error) {
 	var p Parent
-	var kidsRaw string
-	if err := row.Scan(&p.ID, &p.Name, &p.Email, &kidsRaw, &p.RegistrationDate, &p.Wallet); err != nil {
+	var kidsRaw, regDate, wallet sql.NullString
+	if err := row.Scan(&p.ID, &p.Code, &p.Name, &p.Email, &kidsRaw, &regDate, &wallet); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, false, nil
 		}
 		return nil, false, err
 	}
-	if kidsRaw == "" {
-		p.KidsList = []ParentKid{}
-	} else {
+	p.RegistrationDate = regDate.String
+	p.Wallet = wallet.String
+	p.KidsList = []ParentKid{}
+	if kidsRaw.String != "" {
 		var kids []ParentKid
-		if err := json.Unmarshal([]byte(kidsRaw), &kids); err == nil {
+		// fallback to empty if malformed
+		if err := json.Unmarshal([]byte(kidsRaw.String), &kids); err == nil && kids != nil {
 			p.KidsList = kids
-		} else {
-			// fallback to empty if malformed
-			p.KidsList = []ParentKid{}
 		}
 	}
 	return &p, true, nil
 }
 
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+const childColumns = `id, name, email, parent_id, wallet, contact_email, login_code, birth_year`
+
+// scanChild tolerates a NULL wallet on legacy rows.
+func scanChild(row rowScanner, c *Child) error {
+	var wallet sql.NullString
+	if err := row.Scan(&c.ID, &c.Name, &c.Email, &c.ParentID, &wallet, &c.ContactEmail, &c.LoginCode, &c.BirthYear); err != nil {
+		return err
+	}
+	c.Wallet = wallet.String
+	return nil
+}
+
 func (d *DB) GetChildByEmail(ctx context.Context, email string) (*Child, bool, error) {
-	row := d.SQL.QueryRowContext(ctx, `SELECT id, name, email, parent_id, wallet FROM children WHERE lower(email)=?`, strings.ToLower(email))
+	row := d.queryRow(ctx, `SELECT `+childColumns+` FROM children WHERE lower(email)=?`, strings.ToLower(email))
 	var c Child
-	if err := row.Scan(&c.ID, &c.Name, &c.Email, &c.ParentID, &c.Wallet); err != nil {
+	if err := scanChild(row, &c); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, false, nil
 		}
@@ -155,22 +1028,34 @@ func (d *DB) GetChildByEmail(ctx context.Context, email string) (*Child, bool, e
 	return &c, true, nil
 }
 
+// CreateParent registers a parent under a new ULID and a fresh public code.
+// It fails with ErrEmailTaken when the email is already registered.
 func (d *DB) CreateParent(ctx context.Context, name, email string) (*Parent, error) {
 	now := time.Now().UTC().Format(time.RFC3339)
-	// try multiple times in case of rare id collisions
+	email = strings.ToLower(email)
+	id, err := util.NewID()
+	if err != nil {
+		return nil, err
+	}
+	// only the short code can collide; retry that and nothing else
 	for i := 0; i < 10; i++ {
-		id, err := util.GenerateShortID()
+		code, err := util.GenerateShortID()
 		if err != nil {
 			return nil, err
 		}
-		_, err = d.SQL.ExecContext(ctx, `INSERT INTO parents (id, name, email, kids_list, registration_date, wallet) VALUES (?, ?, ?, '[]', ?, '')`, id, name, strings.ToLower(email), now)
-		if err == nil {
-			return &Parent{ID: id, Name: name, Email: strings.ToLower(email), KidsList: []ParentKid{}, RegistrationDate: now, Wallet: ""}, nil
+		_, err = d.exec(ctx, `INSERT INTO parents (id, code, name, email, kids_list, registration_date, wallet) VALUES (?, ?, ?, ?, '[]', ?, '')`, id, code, name, email, now)
+		switch uniqueViolation(err) {
+		case "parents.code":
+			continue
+		case "parents.email":
+			return nil, ErrEmailTaken
 		}
-		// unique collision on id or email -> retry id only when it's id collision; email collision will fail again but caller path should avoid create if exists
-		// continue loop to retry id; if email duplicate, next attempt will still fail and we will return the error after attempts
+		if err != nil {
+			return nil, err
+		}
+		return &Parent{ID: id, Code: code, Name: name, Email: email, KidsList: []ParentKid{}, RegistrationDate: now, Wallet: ""}, nil
 	}
-	return nil, errors.New("failed to generate unique id for parent")
+	return nil, errors.New("failed to generate unique code for parent")
 }
 
 func (d *DB) UpdateParentByEmail(ctx context.Context, email string, name *string, wallet *string) (*Parent, error) {
@@ -216,7 +1101,8 @@ func (d *DB) mustGetParentByEmail(ctx context.Context, email string) (*Parent, e
 
 func (d *DB) CreateChild(ctx context.Context, name, email, parentID string) (*Child, error) {
 	// ensure parent exists
-	if _, found, err := d.GetParentByID(ctx, parentID); err != nil {
+	parent, found, err := d.GetParentByID(ctx, parentID)
+	if err != nil {
 		return nil, err
 	} else if !found {
 		return nil, errors.New("parent_id not found")
@@ -227,21 +1113,21 @@ func (d *DB) CreateChild(ctx context.Context, name, email, parentID string) (*Ch
 		return nil, err
 	}
 	defer func() { _ = tx.Rollback() }()
+	if err := d.checkQuota(ctx, tx, parent.Email, QuotaKids); err != nil {
+		return nil, err
+	}
 
-	var child *Child
-	for i := 0; i < 10; i++ {
-		id, genErr := util.GenerateShortID()
-		if genErr != nil {
-			return nil, genErr
-		}
-		_, err = tx.ExecContext(ctx, `INSERT INTO children (id, name, email, parent_id, wallet) VALUES (?, ?, ?, ?, '')`, id, name, strings.ToLower(email), parentID)
-		if err == nil {
-			child = &Child{ID: id, Name: name, Email: strings.ToLower(email), ParentID: parentID, Wallet: ""}
-			break
-		}
+	id, err := util.NewID()
+	if err != nil {
+		return nil, err
 	}
-	if child == nil {
-		return nil, errors.New("failed to generate unique id for child")
+	child := &Child{ID: id, Name: name, Email: strings.ToLower(email), ParentID: parentID, Wallet: ""}
+	_, err = tx.ExecContext(ctx, `INSERT INTO children (id, name, email, parent_id, wallet) VALUES (?, ?, ?, ?, '')`, child.ID, child.Name, child.Email, child.ParentID)
+	if uniqueViolation(err) == "children.email" {
+		return nil, ErrEmailTaken
+	}
+	if err != nil {
+		return nil, err
 	}
 
 	if err := addChildToParentKidsListTx(ctx, tx, parentID, child.Email, child.Wallet); err != nil {
@@ -260,9 +1146,9 @@ func (d *DB) UpdateChildByEmail(ctx context.Context, email string, name *string,
 	}
 	defer func() { _ = tx.Rollback() }()
 
-	row := tx.QueryRowContext(ctx, `SELECT id, name, email, parent_id, wallet FROM children WHERE lower(email)=?`, strings.ToLower(email))
+	row := tx.QueryRowContext(ctx, `SELECT `+childColumns+` FROM children WHERE lower(email)=?`, strings.ToLower(email))
 	var existing Child
-	if err := row.Scan(&existing.ID, &existing.Name, &existing.Email, &existing.ParentID, &existing.Wallet); err != nil {
+	if err := scanChild(row, &existing); err != nil {
 		return nil, err
 	}
 
@@ -319,9 +1205,9 @@ func (d *DB) UpdateChildByEmail(ctx context.Context, email string, name *string,
 		}
 	}
 
-	row2 := tx.QueryRowContext(ctx, `SELECT id, name, email, parent_id, wallet FROM children WHERE lower(email)=?`, strings.ToLower(email))
+	row2 := tx.QueryRowContext(ctx, `SELECT `+childColumns+` FROM children WHERE lower(email)=?`, strings.ToLower(email))
 	var out Child
-	if err := row2.Scan(&out.ID, &out.Name, &out.Email, &out.ParentID, &out.Wallet); err != nil {
+	if err := scanChild(row2, &out); err != nil {
 		return nil, err
 	}
 
@@ -332,26 +1218,11 @@ func (d *DB) UpdateChildByEmail(ctx context.Context, email string, name *string,
 }
 
 func (d *DB) GetParentByID(ctx context.Context, id string) (*Parent, bool, error) {
-	row := d.SQL.QueryRowContext(ctx, `SELECT id, name, email, kids_list, registration_date, wallet FROM parents WHERE id=?`, id)
-	var p Parent
-	var kidsRaw string
-	if err := row.Scan(&p.ID, &p.Name, &p.Email, &kidsRaw, &p.RegistrationDate, &p.Wallet); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, false, nil
-		}
-		return nil, false, err
-	}
-	if kidsRaw == "" {
-		p.KidsList = []ParentKid{}
-	} else {
-		var kids []ParentKid
-		if err := json.Unmarshal([]byte(kidsRaw), &kids); err == nil {
-			p.KidsList = kids
-		} else {
-			p.KidsList = []ParentKid{}
-		}
-	}
-	return &p, true, nil
+	return scanParent(d.queryRow(ctx, `SELECT id, code, name, email, kids_list, registration_date, wallet FROM parents WHERE id=?`, id))
+}
+
+func (d *DB) GetParentByWallet(ctx context.Context, wallet string) (*Parent, bool, error) {
+	return scanParent(d.queryRow(ctx, `SELECT id, code, name, email, kids_list, registration_date, wallet FROM parents WHERE wallet=? LIMIT 1`, wallet))
 }
 
 func addChildToParentKidsListTx(ctx context.Context, tx *sql.Tx, parentID, childEmail string, childWallet string) error {
@@ -360,13 +1231,13 @@ func addChildToParentKidsListTx(ctx context.Context, tx *sql.Tx, parentID, child
 
 func upsertChildInParentKidsListTx(ctx context.Context, tx *sql.Tx, parentID, childEmail string, childWallet string) error {
 	row := tx.QueryRowContext(ctx, `SELECT kids_list FROM parents WHERE id=?`, parentID)
-	var kidsRaw string
+	var kidsRaw sql.NullString
 	if err := row.Scan(&kidsRaw); err != nil {
 		return err
 	}
 	var kids []ParentKid
-	if kidsRaw != "" {
-		_ = json.Unmarshal([]byte(kidsRaw), &kids)
+	if kidsRaw.String != "" {
+		_ = json.Unmarshal([]byte(kidsRaw.String), &kids)
 	}
 	updated := false
 	for i := range kids {
@@ -386,13 +1257,13 @@ func upsertChildInParentKidsListTx(ctx context.Context, tx *sql.Tx, parentID, ch
 
 func removeChildFromParentKidsListTx(ctx context.Context, tx *sql.Tx, parentID, childEmail string) error {
 	row := tx.QueryRowContext(ctx, `SELECT kids_list FROM parents WHERE id=?`, parentID)
-	var kidsRaw string
+	var kidsRaw sql.NullString
 	if err := row.Scan(&kidsRaw); err != nil {
 		return err
 	}
 	var kids []ParentKid
-	if kidsRaw != "" {
-		_ = json.Unmarshal([]byte(kidsRaw), &kids)
+	if kidsRaw.String != "" {
+		_ = json.Unmarshal([]byte(kidsRaw.String), &kids)
 	}
 	out := make([]ParentKid, 0, len(kids))
 	for _, k := range kids {
@@ -405,17 +1276,44 @@ func removeChildFromParentKidsListTx(ctx context.Context, tx *sql.Tx, parentID,
 	return err
 }
 
-func (d *DB) CreateChore(ctx context.Context, parentWallet, childWallet, choreName, choreDescription string, bountyAmount uint64) (*Chore, error) {
-	id, err := util.GenerateShortID()
+func (d *DB) CreateChore(ctx context.Context, parentWallet, childWallet, choreName, choreDescription string, bountyAmount uint64, dueDate, kind string) (*Chore, error) {
+	id, err := util.NewID()
+	if err != nil {
+		return nil, err
+	}
+	tx, err := d.SQL.BeginTx(ctx, nil)
 	if err != nil {
 		return nil, err
 	}
+	defer tx.Rollback()
 
-	_, err = d.SQL.ExecContext(ctx, `INSERT INTO chores (chore_id, parent_wallet, child_wallet, chore_name, chore_description, bounty_amount, chore_status) VALUES (?, ?, ?, ?, ?, ?, 0)`,
-		id, parentWallet, childWallet, choreName, choreDescription, bountyAmount)
+	var parentEmail string
+	err = tx.QueryRowContext(ctx, `SELECT email FROM parents WHERE wallet=?`, parentWallet).Scan(&parentEmail)
+	if err == nil {
+		err = d.checkQuota(ctx, tx, parentEmail, QuotaOpenChores)
+	} else if errors.Is(err, sql.ErrNoRows) {
+		err = nil
+	}
 	if err != nil {
 		return nil, err
 	}
+	open := childWallet == ""
+	_, err = tx.ExecContext(ctx, `INSERT INTO chores (chore_id, parent_wallet, child_wallet, chore_name, chore_description, bounty_amount, chore_status, due_date, open, kind) VALUES (?, ?, ?, ?, ?, ?, 0, ?, ?, ?)`,
+		id, parentWallet, childWallet, choreName, choreDescription, bountyAmount, dueDate, open, kind)
+	if err != nil {
+		return nil, err
+	}
+	if err := addChoreEntry(ctx, tx, id, TimelineCreated, ActorParent, "", ""); err != nil {
+		return nil, err
+	}
+	if !open {
+		if err := addChoreEntry(ctx, tx, id, TimelineAssigned, ActorParent, "", childWallet); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
 
 	return &Chore{
 		ChoreID:          id,
@@ -425,33 +1323,144 @@ func (d *DB) CreateChore(ctx context.Context, parentWallet, childWallet, choreNa
 		ChoreDescription: choreDescription,
 		BountyAmount:     bountyAmount,
 		ChoreStatus:      0,
+		DueDate:          dueDate,
+		Open:             open,
+		Kind:             kind,
 	}, nil
 }
 
-func (d *DB) UpdateChoreStatus(ctx context.Context, choreID string, newStatus int) (*Chore, error) {
-	result, err := d.SQL.ExecContext(ctx, `UPDATE chores SET chore_status=? WHERE chore_id=?`, newStatus, choreID)
+// UpdateChoreStatus moves a chore to newStatus and records the change on
+// the chore's timeline with note: the kid's submission note for status 1,
+// which is also stored on the chore, or the parent's reason otherwise.
+func (d *DB) UpdateChoreStatus(ctx context.Context, choreID string, newStatus int, note, deviceID string) (*Chore, error) {
+	tx, err := d.SQL.BeginTx(ctx, nil)
 	if err != nil {
 		return nil, err
 	}
+	defer tx.Rollback()
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
+	var prev int
+	if err := tx.QueryRowContext(ctx, `SELECT chore_status FROM chores WHERE chore_id=?`, choreID).Scan(&prev); err != nil {
 		return nil, err
 	}
-	if rowsAffected == 0 {
-		return nil, sql.ErrNoRows
+	if _, err := tx.ExecContext(ctx, `UPDATE chores SET chore_status=? WHERE chore_id=?`, newStatus, choreID); err != nil {
+		return nil, err
+	}
+	if newStatus == 1 && note != "" {
+		if _, err := tx.ExecContext(ctx, `UPDATE chores SET submission_note=? WHERE chore_id=?`, note, choreID); err != nil {
+			return nil, err
+		}
 	}
 
-	row := d.SQL.QueryRowContext(ctx, `SELECT chore_id, parent_wallet, child_wallet, chore_name, chore_description, bounty_amount, chore_status FROM chores WHERE chore_id=?`, choreID)
+	row := tx.QueryRowContext(ctx, `SELECT `+choreColumns+` FROM chores WHERE chore_id=?`, choreID)
 	var c Chore
-	if err := row.Scan(&c.ChoreID, &c.ParentWallet, &c.ChildWallet, &c.ChoreName, &c.ChoreDescription, &c.BountyAmount, &c.ChoreStatus); err != nil {
+	if err := scanChore(row, &c); err != nil {
 		return nil, err
 	}
-	return &c, nil
+	// repeating a status, e.g. status 3 again to build an auto-approved
+	// chore's payout, adds no entry
+	if entry, actor, ok := statusEntry(c.Kind, newStatus); ok && newStatus != prev {
+		ref := ""
+		switch entry {
+		case TimelineAssigned:
+			ref = c.ChildWallet
+		case TimelineSubmitted:
+			ref = deviceID
+		}
+		if err := addChoreEntry(ctx, tx, choreID, entry, actor, note, ref); err != nil {
+			return nil, err
+		}
+	}
+	return &c, tx.Commit()
 }
 
-func (d *DB) GetChores(ctx context.Context, wallet string) ([]Chore, error) {
-	rows, err := d.SQL.QueryContext(ctx, `SELECT chore_id, parent_wallet, child_wallet, chore_name, chore_description, bounty_amount, chore_status FROM chores WHERE parent_wallet=? OR child_wallet=?`, wallet, wallet)
+func (d *DB) GetChore(ctx context.Context, choreID string) (*Chore, bool, error) {
+	var c Chore
+	err := scanChore(d.queryRow(ctx, `SELECT `+choreColumns+` FROM chores WHERE chore_id=?`, choreID), &c)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return &c, true, nil
+}
+
+// choreColumns is the column list scanChore expects.
+const choreColumns = `chore_id, parent_wallet, child_wallet, chore_name, chore_description, bounty_amount, chore_status, due_date, open, claim_expires_at, kind, submission_note`
+
+func scanChore(row rowScanner, c *Chore) error {
+	var desc sql.NullString
+	if err := row.Scan(&c.ChoreID, &c.ParentWallet, &c.ChildWallet, &c.ChoreName, &desc, &c.BountyAmount, &c.ChoreStatus, &c.DueDate, &c.Open, &c.ClaimExpiresAt, &c.Kind, &c.SubmissionNote); err != nil {
+		return err
+	}
+	c.ChoreDescription = desc.String
+	return nil
+}
+
+// ChoreFilter narrows GetChores. Zero fields match everything; DueFrom and
+// DueTo are inclusive YYYY-MM-DD bounds, and either one leaves out chores
+// with no due date.
+type ChoreFilter struct {
+	Statuses []int
+	DueFrom  string
+	DueTo    string
+	Kind     string
+}
+
+// where returns the filter as conditions on chores, with their arguments.
+func (f ChoreFilter) where() (string, []any) {
+	var conds []string
+	var args []any
+	if len(f.Statuses) > 0 {
+		conds = append(conds, `chore_status IN (?`+strings.Repeat(", ?", len(f.Statuses)-1)+`)`)
+		for _, s := range f.Statuses {
+			args = append(args, s)
+		}
+	}
+	if f.DueFrom != "" {
+		conds = append(conds, `due_date>=?`)
+		args = append(args, f.DueFrom)
+	}
+	if f.DueTo != "" {
+		conds = append(conds, `due_date<>'' AND due_date<=?`)
+		args = append(args, f.DueTo)
+	}
+	if f.Kind != "" {
+		conds = append(conds, `kind=?`)
+		args = append(args, f.Kind)
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return " AND " + strings.Join(conds, " AND "), args
+}
+
+// choresQuery is GetChores' statement and its arguments. Statuses are
+// expected without repeats, so the text takes one of a few shapes.
+func choresQuery(wallet string, f ChoreFilter) (string, []any) {
+	cond, fargs := f.where()
+	var args []any
+	args = append(append(args, wallet), fargs...)
+	args = append(append(args, wallet, wallet), fargs...)
+	args = append(append(args, wallet, wallet), fargs...)
+	return `SELECT ` + choreColumns + ` FROM chores WHERE parent_wallet=?` + cond + `
+		UNION ALL
+		SELECT ` + choreColumns + ` FROM chores WHERE child_wallet=? AND parent_wallet<>?` + cond + `
+		UNION ALL
+		SELECT ` + choreColumns + ` FROM chores WHERE +child_wallet='' AND parent_wallet<>? AND parent_wallet IN (
+			SELECT p.wallet FROM children c JOIN parents p ON p.id = c.parent_id WHERE c.wallet=? AND p.wallet<>'')` + cond, args
+}
+
+// GetChores returns the chores wallet created, those assigned to it, and
+// the open chores of the family of the kid it belongs to. Each of the three
+// is its own branch so every one can seek an index instead of scanning the
+// table for an OR; the parent_wallet<>? guards keep a chore from coming up
+// twice. The unary + keeps open chores on the family's parent_wallet index
+// rather than the unassigned chores of every family.
+func (d *DB) GetChores(ctx context.Context, wallet string, f ChoreFilter) ([]Chore, error) {
+	query, args := choresQuery(wallet, f)
+	rows, err := d.query(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -460,7 +1469,7 @@ func (d *DB) GetChores(ctx context.Context, wallet string) ([]Chore, error) {
 	var chores []Chore
 	for rows.Next() {
 		var c Chore
-		if err := rows.Scan(&c.ChoreID, &c.ParentWallet, &c.ChildWallet, &c.ChoreName, &c.ChoreDescription, &c.BountyAmount, &c.ChoreStatus); err != nil {
+		if err := scanChore(rows, &c); err != nil {
 			return nil, err
 		}
 		chores = append(chores, c)
@@ -471,42 +1480,34 @@ func (d *DB) GetChores(ctx context.Context, wallet string) ([]Chore, error) {
 	return chores, nil
 }
 
-func (d *DB) CreateOrUpdateAppLimit(ctx context.Context, parentEmail, kidEmail, app string, timePerDay int, feeExtraHour uint64) (*AppLimit, error) {
-	limitID, err := util.GenerateShortID()
+// CreateOrUpdateAppLimit writes the kid's limit for app and records the
+// change in the limit history under changedBy.
+func (d *DB) CreateOrUpdateAppLimit(ctx context.Context, parentEmail, kidEmail, app string, timePerDay int, feeExtraHour uint64, changedBy string) (*AppLimit, error) {
+	tx, err := d.SQL.BeginTx(ctx, nil)
 	if err != nil {
 		return nil, err
 	}
+	defer tx.Rollback()
 
-	now := time.Now().UTC().Format(time.RFC3339)
-
-	_, err = d.SQL.ExecContext(ctx, `
-		INSERT INTO app_limits (limit_id, parent_email, kid_email, app, time_per_day, fee_extra_hour, created_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?)
-		ON CONFLICT(parent_email, kid_email, app) DO UPDATE SET
-			time_per_day = excluded.time_per_day,
-			fee_extra_hour = excluded.fee_extra_hour
-	`, limitID, strings.ToLower(parentEmail), strings.ToLower(kidEmail), app, timePerDay, feeExtraHour, now)
-
-	if err != nil {
+	var exists int
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM app_limits WHERE parent_email=? AND kid_email=? AND app=?`,
+		strings.ToLower(parentEmail), strings.ToLower(kidEmail), app).Scan(&exists); err != nil {
 		return nil, err
 	}
-
-	row := d.SQL.QueryRowContext(ctx, `
-		SELECT limit_id, parent_email, kid_email, app, time_per_day, fee_extra_hour, created_at
-		FROM app_limits 
-		WHERE parent_email=? AND kid_email=? AND app=?
-	`, strings.ToLower(parentEmail), strings.ToLower(kidEmail), app)
-
-	var limit AppLimit
-	if err := row.Scan(&limit.LimitID, &limit.ParentEmail, &limit.KidEmail, &limit.App, &limit.TimePerDay, &limit.FeeExtraHour, &limit.CreatedAt); err != nil {
+	if exists == 0 {
+		if err := d.checkQuota(ctx, tx, parentEmail, QuotaLimits); err != nil {
+			return nil, err
+		}
+	}
+	limit, _, err := upsertAppLimit(ctx, tx, parentEmail, kidEmail, app, timePerDay, feeExtraHour, changedBy, LimitSourceSet)
+	if err != nil {
 		return nil, err
 	}
-
-	return &limit, nil
+	return limit, tx.Commit()
 }
 
 func (d *DB) GetAppLimitsByKidEmail(ctx context.Context, kidEmail string) ([]AppLimit, error) {
-	rows, err := d.SQL.QueryContext(ctx, `
+	rows, err := d.query(ctx, `
 		SELECT limit_id, parent_email, kid_email, app, time_per_day, fee_extra_hour, created_at
 		FROM app_limits 
 		WHERE kid_email=?
@@ -0,0 +1,184 @@
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"backend_mini/internal/util"
+)
+
+// DelegationTokenPrefix marks tokens of delegated verifiers, which unlike
+// personal access tokens belong to someone outside the family.
+const DelegationTokenPrefix = "sona_dlg_"
+
+var (
+	ErrDelegationNotFound = errors.New("delegation not found")
+	ErrNotDelegated       = errors.New("chore is not delegated to this token")
+	ErrChoreNotSubmitted  = errors.New("chore is not waiting for verification")
+)
+
+// Delegation lets another adult, such as a coach or tutor, view and verify
+// a fixed set of a family's chores. Like APIToken only the token's SHA-256
+// is stored.
+type Delegation struct {
+	DelegationID  string   `json:"delegation_id"`
+	ParentEmail   string   `json:"parent_email"`
+	DelegateName  string   `json:"delegate_name"`
+	DelegateEmail string   `json:"delegate_email,omitempty"`
+	ChoreIDs      []string `json:"chore_ids"`
+	CreatedAt     string   `json:"created_at"`
+	ExpiresAt     string   `json:"expires_at"`
+	LastUsedAt    string   `json:"last_used_at,omitempty"`
+	RevokedAt     string   `json:"revoked_at,omitempty"`
+}
+
+const delegationColumns = `delegation_id, parent_email, delegate_name, delegate_email, chore_ids, created_at, expires_at, last_used_at, revoked_at`
+
+func scanDelegation(row rowScanner, dl *Delegation) error {
+	var ids string
+	if err := row.Scan(&dl.DelegationID, &dl.ParentEmail, &dl.DelegateName, &dl.DelegateEmail, &ids, &dl.CreatedAt, &dl.ExpiresAt, &dl.LastUsedAt, &dl.RevokedAt); err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(ids), &dl.ChoreIDs)
+}
+
+// CreateDelegation issues a delegation token for choreIDs and returns it
+// with its raw value, which is never shown again.
+func (d *DB) CreateDelegation(ctx context.Context, dl Delegation, ttl time.Duration) (*Delegation, string, error) {
+	id, err := util.NewID()
+	if err != nil {
+		return nil, "", err
+	}
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", err
+	}
+	raw := DelegationTokenPrefix + strings.ToLower(id) + "_" + hex.EncodeToString(secret)
+	now := time.Now().UTC()
+	dl.DelegationID = id
+	dl.ParentEmail = strings.ToLower(dl.ParentEmail)
+	dl.DelegateEmail = strings.ToLower(dl.DelegateEmail)
+	dl.CreatedAt = now.Format(time.RFC3339)
+	dl.ExpiresAt = now.Add(ttl).Format(time.RFC3339)
+	ids, err := json.Marshal(dl.ChoreIDs)
+	if err != nil {
+		return nil, "", err
+	}
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `INSERT INTO chore_delegations (delegation_id, parent_email, delegate_name, delegate_email, chore_ids, token_hash, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		dl.DelegationID, dl.ParentEmail, dl.DelegateName, dl.DelegateEmail, string(ids), hashToken(raw), dl.CreatedAt, dl.ExpiresAt); err != nil {
+		return nil, "", err
+	}
+	if err := writeAudit(ctx, tx, dl.ParentEmail, "delegation.create", dl.ParentEmail, dl.DelegationID+" "+dl.DelegateName+" "+string(ids)); err != nil {
+		return nil, "", err
+	}
+	return &dl, raw, tx.Commit()
+}
+
+// LookupDelegation resolves a raw delegation token that is neither revoked
+// nor expired, and stamps its last use.
+func (d *DB) LookupDelegation(ctx context.Context, raw string, now time.Time) (*Delegation, error) {
+	var dl Delegation
+	err := scanDelegation(d.queryRow(ctx, `SELECT `+delegationColumns+` FROM chore_delegations WHERE token_hash=? AND revoked_at='' AND expires_at>?`,
+		hashToken(raw), now.UTC().Format(time.RFC3339)), &dl)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrDelegationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := d.exec(ctx, `UPDATE chore_delegations SET last_used_at=? WHERE delegation_id=?`, now.UTC().Format(time.RFC3339), dl.DelegationID); err != nil {
+		return nil, err
+	}
+	return &dl, nil
+}
+
+// ListDelegations returns a parent's delegations, newest first, including
+// revoked and expired ones.
+func (d *DB) ListDelegations(ctx context.Context, parentEmail string) ([]Delegation, error) {
+	rows, err := d.query(ctx, `SELECT `+delegationColumns+` FROM chore_delegations WHERE parent_email=? ORDER BY created_at DESC`, strings.ToLower(parentEmail))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []Delegation{}
+	for rows.Next() {
+		var dl Delegation
+		if err := scanDelegation(rows, &dl); err != nil {
+			return nil, err
+		}
+		out = append(out, dl)
+	}
+	return out, rows.Err()
+}
+
+// RevokeDelegation ends a delegation at once.
+func (d *DB) RevokeDelegation(ctx context.Context, parentEmail, delegationID string) error {
+	parentEmail = strings.ToLower(parentEmail)
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx, `UPDATE chore_delegations SET revoked_at=? WHERE delegation_id=? AND parent_email=? AND revoked_at=''`,
+		time.Now().UTC().Format(time.RFC3339), delegationID, parentEmail)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrDelegationNotFound
+	}
+	if err := writeAudit(ctx, tx, parentEmail, "delegation.revoke", parentEmail, delegationID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// VerifyDelegatedChore approves (status 3) or rejects (status 4) a
+// submitted chore on the delegate's word. As with auto-approval no payout
+// is built; the parent's app builds it with /update_chore status 3.
+func (d *DB) VerifyDelegatedChore(ctx context.Context, dl *Delegation, choreID string, approve bool, note string) (*Chore, error) {
+	if !slices.Contains(dl.ChoreIDs, choreID) {
+		return nil, ErrNotDelegated
+	}
+	status, entry := 4, TimelineRejected
+	if approve {
+		status, entry = 3, TimelineApproved
+	}
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `UPDATE chores SET chore_status=? WHERE chore_id=? AND chore_status=1`, status, choreID)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, ErrChoreNotSubmitted
+	}
+	if err := addChoreEntry(ctx, tx, choreID, entry, ActorDelegate, note, dl.DelegationID); err != nil {
+		return nil, err
+	}
+	if err := writeAudit(ctx, tx, "delegate:"+dl.DelegationID, "delegation."+entry, choreID, dl.DelegateName+" for "+dl.ParentEmail); err != nil {
+		return nil, err
+	}
+	var c Chore
+	if err := scanChore(tx.QueryRowContext(ctx, `SELECT `+choreColumns+` FROM chores WHERE chore_id=?`, choreID), &c); err != nil {
+		return nil, err
+	}
+	return &c, tx.Commit()
+}
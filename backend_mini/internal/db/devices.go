@@ -0,0 +1,169 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"backend_mini/internal/util"
+)
+
+const PairingCodeTTL = 10 * time.Minute
+
+var (
+	ErrPairingCodeInvalid = errors.New("pairing code is invalid, expired, or already used")
+	ErrDeviceNotFound     = errors.New("device not found")
+)
+
+type PairingCode struct {
+	Code        string `json:"code"`
+	ParentEmail string `json:"parent_email"`
+	KidEmail    string `json:"kid_email"`
+	ExpiresAt   string `json:"expires_at"`
+}
+
+type Device struct {
+	DeviceID    string `json:"device_id"`
+	KidEmail    string `json:"kid_email"`
+	ParentEmail string `json:"parent_email"`
+	Name        string `json:"name"`
+	Platform    string `json:"platform"`
+	PairedAt    string `json:"paired_at"`
+	LastSeenAt  string `json:"last_seen_at"`
+	UnpairedAt  string `json:"unpaired_at"`
+	// PublicKey is the base64 ed25519 key the device signs requests with,
+	// empty for devices paired without one.
+	PublicKey string `json:"public_key,omitempty"`
+}
+
+func (d *DB) CreatePairingCode(ctx context.Context, parentEmail, kidEmail string) (*PairingCode, error) {
+	now := time.Now().UTC()
+	pc := PairingCode{ParentEmail: strings.ToLower(parentEmail), KidEmail: strings.ToLower(kidEmail), ExpiresAt: now.Add(PairingCodeTTL).Format(time.RFC3339)}
+	for i := 0; i < 10; i++ {
+		code, err := util.GenerateCode(8)
+		if err != nil {
+			return nil, err
+		}
+		_, err = d.exec(ctx, `INSERT INTO pairing_codes (code, parent_email, kid_email, expires_at, created_at) VALUES (?, ?, ?, ?, ?)`,
+			code, pc.ParentEmail, pc.KidEmail, pc.ExpiresAt, now.Format(time.RFC3339))
+		if err == nil {
+			pc.Code = code
+			return &pc, nil
+		}
+	}
+	return nil, errors.New("failed to generate unique pairing code")
+}
+
+// RedeemPairingCode burns a pairing code and binds a new device to its kid.
+// publicKey is the key the device generated for signing requests, if any.
+func (d *DB) RedeemPairingCode(ctx context.Context, code, name, platform, publicKey string) (*Device, error) {
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	var pc PairingCode
+	err = tx.QueryRowContext(ctx, `SELECT code, parent_email, kid_email, expires_at FROM pairing_codes WHERE code=? AND redeemed_at='' AND expires_at>?`,
+		strings.ToUpper(code), now).Scan(&pc.Code, &pc.ParentEmail, &pc.KidEmail, &pc.ExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrPairingCodeInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE pairing_codes SET redeemed_at=? WHERE code=?`, now, pc.Code); err != nil {
+		return nil, err
+	}
+
+	dev := Device{KidEmail: pc.KidEmail, ParentEmail: pc.ParentEmail, Name: name, Platform: platform, PairedAt: now, LastSeenAt: now, PublicKey: publicKey}
+	for i := 0; i < 10; i++ {
+		id, err := util.GenerateCode(12)
+		if err != nil {
+			return nil, err
+		}
+		_, err = tx.ExecContext(ctx, `INSERT INTO devices (device_id, kid_email, parent_email, name, platform, paired_at, last_seen_at, public_key) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			id, dev.KidEmail, dev.ParentEmail, dev.Name, dev.Platform, dev.PairedAt, dev.LastSeenAt, dev.PublicKey)
+		if err == nil {
+			dev.DeviceID = id
+			break
+		}
+	}
+	if dev.DeviceID == "" {
+		return nil, errors.New("failed to generate unique device id")
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &dev, nil
+}
+
+func (d *DB) GetDevice(ctx context.Context, deviceID string) (*Device, bool, error) {
+	row := d.queryRow(ctx, `SELECT device_id, kid_email, parent_email, name, platform, paired_at, last_seen_at, unpaired_at, public_key FROM devices WHERE device_id=?`, deviceID)
+	var dev Device
+	if err := row.Scan(&dev.DeviceID, &dev.KidEmail, &dev.ParentEmail, &dev.Name, &dev.Platform, &dev.PairedAt, &dev.LastSeenAt, &dev.UnpairedAt, &dev.PublicKey); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	return &dev, true, nil
+}
+
+// ListDevices returns paired devices of a parent, optionally for one kid.
+func (d *DB) ListDevices(ctx context.Context, parentEmail, kidEmail string) ([]Device, error) {
+	q := `SELECT device_id, kid_email, parent_email, name, platform, paired_at, last_seen_at, unpaired_at, public_key FROM devices WHERE parent_email=? AND unpaired_at=''`
+	args := []any{strings.ToLower(parentEmail)}
+	if kidEmail != "" {
+		q += ` AND kid_email=?`
+		args = append(args, strings.ToLower(kidEmail))
+	}
+	rows, err := d.query(ctx, q+` ORDER BY paired_at`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	devices := []Device{}
+	for rows.Next() {
+		var dev Device
+		if err := rows.Scan(&dev.DeviceID, &dev.KidEmail, &dev.ParentEmail, &dev.Name, &dev.Platform, &dev.PairedAt, &dev.LastSeenAt, &dev.UnpairedAt, &dev.PublicKey); err != nil {
+			return nil, err
+		}
+		devices = append(devices, dev)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return devices, nil
+}
+
+func (d *DB) RenameDevice(ctx context.Context, deviceID, name string) error {
+	return d.updateActiveDevice(ctx, `UPDATE devices SET name=? WHERE device_id=? AND unpaired_at=''`, name, deviceID)
+}
+
+func (d *DB) UnpairDevice(ctx context.Context, deviceID string) error {
+	return d.updateActiveDevice(ctx, `UPDATE devices SET unpaired_at=? WHERE device_id=? AND unpaired_at=''`, time.Now().UTC().Format(time.RFC3339), deviceID)
+}
+
+func (d *DB) TouchDevice(ctx context.Context, deviceID string) error {
+	return d.updateActiveDevice(ctx, `UPDATE devices SET last_seen_at=? WHERE device_id=? AND unpaired_at=''`, time.Now().UTC().Format(time.RFC3339), deviceID)
+}
+
+func (d *DB) updateActiveDevice(ctx context.Context, q string, args ...any) error {
+	res, err := d.exec(ctx, q, args...)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrDeviceNotFound
+	}
+	return nil
+}
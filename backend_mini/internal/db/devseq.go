@@ -0,0 +1,105 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Streams of device-reported data, each sequenced on its own.
+const (
+	SeqStreamUsage    = "usage"
+	SeqStreamLocation = "location"
+)
+
+// Sequence check outcomes.
+const (
+	SeqAccepted  = "accepted"
+	SeqDuplicate = "duplicate"
+	SeqStale     = "stale"
+)
+
+// seqWindow is how far behind the highest sequence number a report may
+// arrive and still be accepted, tracked as a bitmask like IPsec's replay
+// window.
+const seqWindow = 64
+
+var (
+	ErrSeqDuplicate = errors.New("report already received")
+	ErrSeqStale     = errors.New("report is older than ones already received")
+)
+
+// SeqStats totals one stream's sequence checks across devices.
+type SeqStats struct {
+	Stream     string `json:"stream"`
+	Devices    int    `json:"devices"`
+	Accepted   int64  `json:"accepted"`
+	Duplicates int64  `json:"duplicates"`
+	Stale      int64  `json:"stale"`
+}
+
+// checkSeq records seq for the device's stream inside tx and reports
+// whether it is new. Numbers above the highest seen are always new. One
+// already seen within seqWindow is a duplicate; any other below the
+// highest is new if it is within seqWindow and inOrder is not set, and
+// stale otherwise.
+func checkSeq(ctx context.Context, tx *sql.Tx, deviceID, stream string, seq uint64, inOrder bool) (string, error) {
+	// stored as signed integers, which is all SQLite has
+	var storedHigh, storedMask int64
+	err := tx.QueryRowContext(ctx, `SELECT high, mask FROM device_sequences WHERE device_id=? AND stream=?`, deviceID, stream).Scan(&storedHigh, &storedMask)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", err
+	}
+	high, mask := uint64(storedHigh), uint64(storedMask)
+	outcome := SeqAccepted
+	switch {
+	case seq > high:
+		// bit i of mask is seq high-i
+		if shift := seq - high; shift >= seqWindow {
+			mask = 1
+		} else {
+			mask = mask<<shift | 1
+		}
+		high = seq
+	case high-seq < seqWindow && mask&(1<<(high-seq)) != 0:
+		outcome = SeqDuplicate
+	case inOrder || high-seq >= seqWindow:
+		outcome = SeqStale
+	default:
+		mask |= 1 << (high - seq)
+	}
+	var accepted, dup, stale int
+	switch outcome {
+	case SeqAccepted:
+		accepted = 1
+	case SeqDuplicate:
+		dup = 1
+	default:
+		stale = 1
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO device_sequences (device_id, stream, high, mask, accepted, duplicates, stale, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(device_id, stream) DO UPDATE SET high=excluded.high, mask=excluded.mask, accepted=accepted+excluded.accepted,
+		duplicates=duplicates+excluded.duplicates, stale=stale+excluded.stale, updated_at=excluded.updated_at`,
+		deviceID, stream, int64(high), int64(mask), accepted, dup, stale, time.Now().UTC().Format(time.RFC3339))
+	return outcome, err
+}
+
+// DeviceSeqStats totals sequence checks per stream.
+func (d *DB) DeviceSeqStats(ctx context.Context) ([]SeqStats, error) {
+	rows, err := d.query(ctx, `SELECT stream, COUNT(*), SUM(accepted), SUM(duplicates), SUM(stale) FROM device_sequences GROUP BY stream ORDER BY stream`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []SeqStats{}
+	for rows.Next() {
+		var s SeqStats
+		if err := rows.Scan(&s.Stream, &s.Devices, &s.Accepted, &s.Duplicates, &s.Stale); err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
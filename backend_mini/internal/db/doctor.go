@@ -0,0 +1,249 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"backend_mini/internal/util"
+)
+
+type Issue struct {
+	Kind     string `json:"kind"`
+	Table    string `json:"table"`
+	RowID    string `json:"row_id"`
+	Detail   string `json:"detail"`
+	Repaired bool   `json:"repaired"`
+}
+
+type DoctorOptions struct {
+	Repair        bool
+	DeleteOrphans bool
+}
+
+type nullableColumn struct {
+	table, column string
+	fill          func() string
+}
+
+var doctorColumns = []nullableColumn{
+	{"parents", "kids_list", func() string { return "[]" }},
+	{"parents", "wallet", func() string { return "" }},
+	{"parents", "registration_date", func() string { return time.Now().UTC().Format(time.RFC3339) }},
+	{"children", "wallet", func() string { return "" }},
+	{"chores", "chore_description", func() string { return "" }},
+}
+
+// Doctor scans for legacy/inconsistent rows (NULLs, missing ids, orphaned
+// kids, kids_list drift) and optionally repairs them in one transaction.
+func (d *DB) Doctor(ctx context.Context, opts DoctorOptions) ([]Issue, error) {
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var issues []Issue
+	for _, check := range []func(context.Context, *sql.Tx, DoctorOptions) ([]Issue, error){
+		doctorNulls, doctorMissingIDs, doctorOrphans, doctorKidsLists,
+	} {
+		found, err := check(ctx, tx, opts)
+		if err != nil {
+			return nil, err
+		}
+		issues = append(issues, found...)
+	}
+	if opts.Repair {
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+	}
+	return issues, nil
+}
+
+func doctorNulls(ctx context.Context, tx *sql.Tx, opts DoctorOptions) ([]Issue, error) {
+	var issues []Issue
+	for _, c := range doctorColumns {
+		var n int
+		q := fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE %s IS NULL`, c.table, c.column)
+		if err := tx.QueryRowContext(ctx, q).Scan(&n); err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			continue
+		}
+		issue := Issue{Kind: "null_column", Table: c.table, Detail: fmt.Sprintf("%d rows with NULL %s", n, c.column)}
+		if opts.Repair {
+			q := fmt.Sprintf(`UPDATE %s SET %s=? WHERE %s IS NULL`, c.table, c.column, c.column)
+			if _, err := tx.ExecContext(ctx, q, c.fill()); err != nil {
+				return nil, err
+			}
+			issue.Repaired = true
+		}
+		issues = append(issues, issue)
+	}
+	return issues, nil
+}
+
+func doctorMissingIDs(ctx context.Context, tx *sql.Tx, opts DoctorOptions) ([]Issue, error) {
+	var issues []Issue
+	for _, table := range []string{"parents", "children"} {
+		rows, err := tx.QueryContext(ctx, fmt.Sprintf(`SELECT rowid, email FROM %s WHERE id IS NULL OR id=''`, table))
+		if err != nil {
+			return nil, err
+		}
+		type missing struct {
+			rowid int64
+			email string
+		}
+		var found []missing
+		for rows.Next() {
+			var m missing
+			if err := rows.Scan(&m.rowid, &m.email); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			found = append(found, m)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		for _, m := range found {
+			issue := Issue{Kind: "missing_id", Table: table, RowID: m.email, Detail: "row has no id"}
+			if opts.Repair {
+				id, err := util.NewID()
+				if err != nil {
+					return nil, err
+				}
+				// children.parent_id follows via ON UPDATE CASCADE
+				if _, err := tx.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET id=? WHERE rowid=?`, table), id, m.rowid); err != nil {
+					return nil, err
+				}
+				issue.Detail = "assigned id " + id
+				issue.Repaired = true
+			}
+			issues = append(issues, issue)
+		}
+	}
+	return issues, nil
+}
+
+func doctorOrphans(ctx context.Context, tx *sql.Tx, opts DoctorOptions) ([]Issue, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT c.id, c.email, c.parent_id FROM children c
+		LEFT JOIN parents p ON p.id = c.parent_id
+		WHERE p.id IS NULL
+	`)
+	if err != nil {
+		return nil, err
+	}
+	var issues []Issue
+	for rows.Next() {
+		var id, email, parentID sql.NullString
+		if err := rows.Scan(&id, &email, &parentID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		issues = append(issues, Issue{Kind: "orphaned_kid", Table: "children", RowID: id.String, Detail: fmt.Sprintf("%s references missing parent %q", email.String, parentID.String)})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if opts.Repair && opts.DeleteOrphans {
+		for i := range issues {
+			if _, err := tx.ExecContext(ctx, `DELETE FROM children WHERE id=?`, issues[i].RowID); err != nil {
+				return nil, err
+			}
+			issues[i].Repaired = true
+		}
+	}
+	return issues, nil
+}
+
+func doctorKidsLists(ctx context.Context, tx *sql.Tx, opts DoctorOptions) ([]Issue, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT id, kids_list FROM parents`)
+	if err != nil {
+		return nil, err
+	}
+	stored := map[string]string{}
+	for rows.Next() {
+		var id, raw sql.NullString
+		if err := rows.Scan(&id, &raw); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		stored[id.String] = raw.String
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = tx.QueryContext(ctx, `SELECT parent_id, email, wallet FROM children ORDER BY rowid`)
+	if err != nil {
+		return nil, err
+	}
+	actual := map[string][]ParentKid{}
+	for rows.Next() {
+		var parentID, email, wallet sql.NullString
+		if err := rows.Scan(&parentID, &email, &wallet); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		actual[parentID.String] = append(actual[parentID.String], ParentKid{Email: strings.ToLower(email.String), Wallet: wallet.String})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(stored))
+	for id := range stored {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var issues []Issue
+	for _, id := range ids {
+		want := actual[id]
+		if want == nil {
+			want = []ParentKid{}
+		}
+		var have []ParentKid
+		if err := json.Unmarshal([]byte(stored[id]), &have); err == nil && sameKids(have, want) {
+			continue
+		}
+		issue := Issue{Kind: "kids_list_drift", Table: "parents", RowID: id, Detail: fmt.Sprintf("kids_list has %d entries, children table has %d", len(have), len(want))}
+		if opts.Repair {
+			buf, _ := json.Marshal(want)
+			if _, err := tx.ExecContext(ctx, `UPDATE parents SET kids_list=? WHERE id=?`, string(buf), id); err != nil {
+				return nil, err
+			}
+			issue.Repaired = true
+		}
+		issues = append(issues, issue)
+	}
+	return issues, nil
+}
+
+func sameKids(a, b []ParentKid) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	seen := make(map[string]string, len(a))
+	for _, k := range a {
+		seen[strings.ToLower(k.Email)] = k.Wallet
+	}
+	for _, k := range b {
+		if w, ok := seen[k.Email]; !ok || w != k.Wallet {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,59 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+type Event struct {
+	Seq         int64           `json:"seq"`
+	Type        string          `json:"type"`
+	ParentEmail string          `json:"parent_email"`
+	Payload     json.RawMessage `json:"payload"`
+	CreatedAt   string          `json:"created_at"`
+}
+
+func (d *DB) AddEvent(ctx context.Context, eventType, parentEmail string, payload any) (*Event, error) {
+	buf, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	res, err := d.exec(ctx, `INSERT INTO events (type, parent_email, payload, created_at) VALUES (?, ?, ?, ?)`,
+		eventType, strings.ToLower(parentEmail), string(buf), now)
+	if err != nil {
+		return nil, err
+	}
+	seq, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return &Event{Seq: seq, Type: eventType, ParentEmail: strings.ToLower(parentEmail), Payload: buf, CreatedAt: now}, nil
+}
+
+// GetEvents returns up to limit events for a parent with seq > after, oldest first.
+func (d *DB) GetEvents(ctx context.Context, parentEmail string, after int64, limit int) ([]Event, error) {
+	rows, err := d.query(ctx, `SELECT seq, type, parent_email, payload, created_at FROM events WHERE parent_email=? AND seq>? ORDER BY seq LIMIT ?`,
+		strings.ToLower(parentEmail), after, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []Event{}
+	for rows.Next() {
+		var e Event
+		var payload string
+		if err := rows.Scan(&e.Seq, &e.Type, &e.ParentEmail, &payload, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		e.Payload = json.RawMessage(payload)
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
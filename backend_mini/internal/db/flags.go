@@ -0,0 +1,91 @@
+package db
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// KillSwitchPrefix starts the names of feature flags that take routes out
+// of service: "kill:maintenance", "kill:money" or "kill:" plus a route.
+const KillSwitchPrefix = "kill:"
+
+// FeatureFlag is a server-wide switch ops can flip at runtime. Unlike
+// family features it applies to everyone.
+type FeatureFlag struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+	// Message is shown to clients a kill switch turns away.
+	Message   string `json:"message,omitempty"`
+	UpdatedBy string `json:"updated_by"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+const featureFlagColumns = `name, enabled, message, updated_by, updated_at`
+
+func scanFeatureFlag(row rowScanner, f *FeatureFlag) error {
+	return row.Scan(&f.Name, &f.Enabled, &f.Message, &f.UpdatedBy, &f.UpdatedAt)
+}
+
+// SetFeatureFlag turns a flag on or off, creating it if need be.
+func (d *DB) SetFeatureFlag(ctx context.Context, f FeatureFlag) (*FeatureFlag, error) {
+	f.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `INSERT INTO feature_flags (`+featureFlagColumns+`) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(name) DO UPDATE SET enabled=excluded.enabled, message=excluded.message, updated_by=excluded.updated_by, updated_at=excluded.updated_at`,
+		f.Name, f.Enabled, f.Message, f.UpdatedBy, f.UpdatedAt); err != nil {
+		return nil, err
+	}
+	state := "off"
+	if f.Enabled {
+		state = "on"
+	}
+	if err := writeAudit(ctx, tx, f.UpdatedBy, "flag.set", f.Name, state+" "+f.Message); err != nil {
+		return nil, err
+	}
+	return &f, tx.Commit()
+}
+
+// ListFeatureFlags returns every flag ever set, on or off, by name.
+func (d *DB) ListFeatureFlags(ctx context.Context) ([]FeatureFlag, error) {
+	rows, err := d.query(ctx, `SELECT `+featureFlagColumns+` FROM feature_flags ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []FeatureFlag{}
+	for rows.Next() {
+		var f FeatureFlag
+		if err := scanFeatureFlag(rows, &f); err != nil {
+			return nil, err
+		}
+		out = append(out, f)
+	}
+	return out, rows.Err()
+}
+
+// KillSwitches returns the kill switches that are on, without the prefix,
+// with their messages.
+func (d *DB) KillSwitches(ctx context.Context) (map[string]string, error) {
+	rows, err := d.query(ctx, `SELECT name, message FROM feature_flags WHERE enabled=1 AND name LIKE ?`, KillSwitchPrefix+"%")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := map[string]string{}
+	for rows.Next() {
+		var name, message string
+		if err := rows.Scan(&name, &message); err != nil {
+			return nil, err
+		}
+		out[strings.TrimPrefix(name, KillSwitchPrefix)] = message
+	}
+	return out, rows.Err()
+}
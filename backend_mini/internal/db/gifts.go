@@ -0,0 +1,192 @@
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"backend_mini/internal/util"
+)
+
+// Gift statuses. A link is open until the relative fills in who they are,
+// pending until their payment is seen on chain, and then received.
+const (
+	GiftOpen      = "open"
+	GiftPending   = "pending"
+	GiftReceived  = "received"
+	GiftExpired   = "expired"
+	GiftCancelled = "cancelled"
+)
+
+var ErrGiftClosed = errors.New("gift link is no longer open")
+
+// Gift is a one-time link a parent sends a relative so they can contribute
+// to a kid without an account. Only the link token's SHA-256 is stored.
+type Gift struct {
+	GiftID      string `json:"gift_id"`
+	ParentEmail string `json:"parent_email"`
+	KidEmail    string `json:"kid_email"`
+	Wallet      string `json:"wallet"`
+	// Amount is the suggested contribution; zero lets the relative choose.
+	Amount     uint64 `json:"amount"`
+	Note       string `json:"note,omitempty"`
+	FromName   string `json:"from_name,omitempty"`
+	Message    string `json:"message,omitempty"`
+	Reference  string `json:"reference"`
+	Status     string `json:"status"`
+	Signature  string `json:"signature,omitempty"`
+	Received   uint64 `json:"received,omitempty"`
+	CreatedAt  string `json:"created_at"`
+	ExpiresAt  string `json:"expires_at"`
+	ReceivedAt string `json:"received_at,omitempty"`
+}
+
+// Waiting reports whether the gift can still be paid.
+func (g *Gift) Waiting() bool {
+	return g.Status == GiftOpen || g.Status == GiftPending
+}
+
+const giftColumns = `gift_id, parent_email, kid_email, wallet, amount, note, from_name, message, reference, status, signature, received, created_at, expires_at, received_at`
+
+func scanGift(row rowScanner, g *Gift) error {
+	return row.Scan(&g.GiftID, &g.ParentEmail, &g.KidEmail, &g.Wallet, &g.Amount, &g.Note, &g.FromName, &g.Message, &g.Reference, &g.Status, &g.Signature, &g.Received, &g.CreatedAt, &g.ExpiresAt, &g.ReceivedAt)
+}
+
+// CreateGift stores g and returns it with the raw link token, which is
+// not kept.
+func (d *DB) CreateGift(ctx context.Context, g Gift, ttl time.Duration) (*Gift, string, error) {
+	id, err := util.NewID()
+	if err != nil {
+		return nil, "", err
+	}
+	secret := make([]byte, 16)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", err
+	}
+	raw := strings.ToLower(id) + hex.EncodeToString(secret)
+	if g.Reference, err = util.NewPaymentReference(); err != nil {
+		return nil, "", err
+	}
+	now := time.Now().UTC()
+	g.GiftID, g.Status = id, GiftOpen
+	g.ParentEmail, g.KidEmail = strings.ToLower(g.ParentEmail), strings.ToLower(g.KidEmail)
+	g.CreatedAt, g.ExpiresAt = now.Format(time.RFC3339), now.Add(ttl).Format(time.RFC3339)
+	_, err = d.exec(ctx, `INSERT INTO gifts (`+giftColumns+`, token_hash) VALUES (?, ?, ?, ?, ?, ?, '', '', ?, ?, '', 0, ?, ?, '', ?)`,
+		g.GiftID, g.ParentEmail, g.KidEmail, g.Wallet, g.Amount, g.Note, g.Reference, g.Status, g.CreatedAt, g.ExpiresAt, hashToken(raw))
+	if err != nil {
+		return nil, "", err
+	}
+	return &g, raw, nil
+}
+
+func (d *DB) getGift(ctx context.Context, where string, arg any) (*Gift, bool, error) {
+	var g Gift
+	err := scanGift(d.queryRow(ctx, `SELECT `+giftColumns+` FROM gifts WHERE `+where, arg), &g)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return &g, true, nil
+}
+
+// GetGiftByToken finds the gift a link token belongs to.
+func (d *DB) GetGiftByToken(ctx context.Context, raw string) (*Gift, bool, error) {
+	return d.getGift(ctx, `token_hash=?`, hashToken(raw))
+}
+
+func (d *DB) GetGift(ctx context.Context, giftID string) (*Gift, bool, error) {
+	return d.getGift(ctx, `gift_id=?`, giftID)
+}
+
+// ListGifts returns a parent's gifts, newest first, optionally for one kid.
+func (d *DB) ListGifts(ctx context.Context, parentEmail, kidEmail string) ([]Gift, error) {
+	rows, err := d.query(ctx, `SELECT `+giftColumns+` FROM gifts WHERE parent_email=? AND (?='' OR kid_email=?) ORDER BY created_at DESC, gift_id`,
+		strings.ToLower(parentEmail), strings.ToLower(kidEmail), strings.ToLower(kidEmail))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Gift{}
+	for rows.Next() {
+		var g Gift
+		if err := scanGift(rows, &g); err != nil {
+			return nil, err
+		}
+		out = append(out, g)
+	}
+	return out, rows.Err()
+}
+
+// SignGift records who the relative is and their message for the kid. It
+// can be changed until the payment is seen.
+func (d *DB) SignGift(ctx context.Context, giftID, fromName, message string) (*Gift, error) {
+	res, err := d.exec(ctx, `UPDATE gifts SET from_name=?, message=?, status=? WHERE gift_id=? AND status IN (?, ?) AND expires_at>?`,
+		fromName, message, GiftPending, giftID, GiftOpen, GiftPending, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, ErrGiftClosed
+	}
+	g, _, err := d.GetGift(ctx, giftID)
+	return g, err
+}
+
+// CancelGift closes a gift that has not been paid.
+func (d *DB) CancelGift(ctx context.Context, parentEmail, giftID string) (*Gift, error) {
+	res, err := d.exec(ctx, `UPDATE gifts SET status=? WHERE gift_id=? AND parent_email=? AND status IN (?, ?)`,
+		GiftCancelled, giftID, strings.ToLower(parentEmail), GiftOpen, GiftPending)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, ErrGiftClosed
+	}
+	g, _, err := d.GetGift(ctx, giftID)
+	return g, err
+}
+
+// WaitingGifts lists gifts that can still be paid.
+func (d *DB) WaitingGifts(ctx context.Context) ([]Gift, error) {
+	rows, err := d.query(ctx, `SELECT `+giftColumns+` FROM gifts WHERE status IN (?, ?) ORDER BY created_at`, GiftOpen, GiftPending)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Gift
+	for rows.Next() {
+		var g Gift
+		if err := scanGift(rows, &g); err != nil {
+			return nil, err
+		}
+		out = append(out, g)
+	}
+	return out, rows.Err()
+}
+
+// ReceiveGift marks a waiting gift as paid by the transaction sig. It
+// reports false when the gift had already left the waiting states.
+func (d *DB) ReceiveGift(ctx context.Context, giftID, sig string, amount uint64) (*Gift, bool, error) {
+	res, err := d.exec(ctx, `UPDATE gifts SET status=?, signature=?, received=?, received_at=? WHERE gift_id=? AND status IN (?, ?)`,
+		GiftReceived, sig, amount, time.Now().UTC().Format(time.RFC3339), giftID, GiftOpen, GiftPending)
+	if err != nil {
+		return nil, false, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, false, nil
+	}
+	g, _, err := d.GetGift(ctx, giftID)
+	return g, err == nil, err
+}
+
+// ExpireGift closes a waiting gift whose link ran out.
+func (d *DB) ExpireGift(ctx context.Context, giftID string) error {
+	_, err := d.exec(ctx, `UPDATE gifts SET status=? WHERE gift_id=? AND status IN (?, ?)`, GiftExpired, giftID, GiftOpen, GiftPending)
+	return err
+}
@@ -0,0 +1,163 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrHandleTaken      = errors.New("that handle belongs to another family")
+	ErrShareCodeUnknown = errors.New("no family has that code or handle")
+)
+
+// Handle is a vanity alias for a family's public code, shown as @handle.
+// A family has at most one current handle; ones it moved away from keep
+// ReleasedAt and redirect to the current one until the hold runs out.
+type Handle struct {
+	Handle      string `json:"handle"`
+	ParentEmail string `json:"parent_email"`
+	ClaimedAt   string `json:"claimed_at"`
+	ReleasedAt  string `json:"released_at,omitempty"`
+}
+
+const handleColumns = `handle, parent_email, claimed_at, released_at`
+
+func scanHandle(row rowScanner, h *Handle) error {
+	return row.Scan(&h.Handle, &h.ParentEmail, &h.ClaimedAt, &h.ReleasedAt)
+}
+
+// ShareTarget is the family a public code or handle leads to.
+type ShareTarget struct {
+	ParentEmail string `json:"-"`
+	Code        string `json:"code"`
+	Handle      string `json:"handle,omitempty"`
+	// RedirectedFrom is the old handle that was asked for, if any.
+	RedirectedFrom string `json:"redirected_from,omitempty"`
+}
+
+// ClaimHandle makes handle the family's current handle; an empty handle
+// just drops the current one. The old handle keeps redirecting, and no
+// other family can claim it, until hold has passed since its release.
+func (d *DB) ClaimHandle(ctx context.Context, parentEmail, handle string, hold time.Duration) (*Handle, error) {
+	parentEmail = strings.ToLower(parentEmail)
+	now := time.Now().UTC()
+	ts := now.Format(time.RFC3339)
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var cur Handle
+	err = scanHandle(tx.QueryRowContext(ctx, `SELECT `+handleColumns+` FROM family_handles WHERE parent_email=? AND released_at=''`, parentEmail), &cur)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if err == nil && cur.Handle == handle {
+		return &cur, nil
+	}
+	if handle != "" {
+		var prev Handle
+		err := scanHandle(tx.QueryRowContext(ctx, `SELECT `+handleColumns+` FROM family_handles WHERE handle=?`, handle), &prev)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+		case err != nil:
+			return nil, err
+		case prev.ParentEmail != parentEmail && (prev.ReleasedAt == "" || prev.ReleasedAt > now.Add(-hold).Format(time.RFC3339)):
+			return nil, ErrHandleTaken
+		default:
+			// the family taking back its own old handle, or one whose hold ran out
+			if _, err := tx.ExecContext(ctx, `DELETE FROM family_handles WHERE handle=?`, handle); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if cur.Handle != "" {
+		if _, err := tx.ExecContext(ctx, `UPDATE family_handles SET released_at=? WHERE handle=?`, ts, cur.Handle); err != nil {
+			return nil, err
+		}
+	}
+	h := &Handle{Handle: handle, ParentEmail: parentEmail, ClaimedAt: ts}
+	if handle != "" {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO family_handles (`+handleColumns+`) VALUES (?, ?, ?, '')`, h.Handle, h.ParentEmail, h.ClaimedAt); err != nil {
+			return nil, err
+		}
+	}
+	if err := writeAudit(ctx, tx, parentEmail, "handle.claim", parentEmail, cur.Handle+" -> "+handle); err != nil {
+		return nil, err
+	}
+	return h, tx.Commit()
+}
+
+// FamilyHandle returns the family's current handle, or "".
+func (d *DB) FamilyHandle(ctx context.Context, parentEmail string) (string, error) {
+	var handle string
+	err := d.queryRow(ctx, `SELECT handle FROM family_handles WHERE parent_email=? AND released_at=''`, strings.ToLower(parentEmail)).Scan(&handle)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return handle, err
+}
+
+// HandleHistory lists every handle the family has held, newest first. Ones
+// another family has since claimed are gone from it.
+func (d *DB) HandleHistory(ctx context.Context, parentEmail string) ([]Handle, error) {
+	rows, err := d.query(ctx, `SELECT `+handleColumns+` FROM family_handles WHERE parent_email=? ORDER BY claimed_at DESC, handle`, strings.ToLower(parentEmail))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []Handle{}
+	for rows.Next() {
+		var h Handle
+		if err := scanHandle(rows, &h); err != nil {
+			return nil, err
+		}
+		out = append(out, h)
+	}
+	return out, rows.Err()
+}
+
+// ResolveShareCode finds the family behind a public code, or behind a
+// handle when code starts with "@". An old handle still on hold resolves
+// to its family with RedirectedFrom set.
+func (d *DB) ResolveShareCode(ctx context.Context, code string, hold time.Duration) (*ShareTarget, error) {
+	var t ShareTarget
+	if handle, ok := strings.CutPrefix(code, "@"); ok {
+		var h Handle
+		err := scanHandle(d.queryRow(ctx, `SELECT `+handleColumns+` FROM family_handles WHERE handle=?`, strings.ToLower(handle)), &h)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrShareCodeUnknown
+		}
+		if err != nil {
+			return nil, err
+		}
+		if h.ReleasedAt != "" {
+			if h.ReleasedAt <= time.Now().UTC().Add(-hold).Format(time.RFC3339) {
+				return nil, ErrShareCodeUnknown
+			}
+			t.RedirectedFrom = h.Handle
+		}
+		t.ParentEmail = h.ParentEmail
+	} else {
+		err := d.queryRow(ctx, `SELECT email FROM parents WHERE code=?`, strings.ToUpper(code)).Scan(&t.ParentEmail)
+		if errors.Is(err, sql.ErrNoRows) || code == "" {
+			return nil, ErrShareCodeUnknown
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := d.queryRow(ctx, `SELECT code FROM parents WHERE email=?`, t.ParentEmail).Scan(&t.Code); err != nil {
+		return nil, err
+	}
+	var err error
+	if t.Handle, err = d.FamilyHandle(ctx, t.ParentEmail); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
@@ -0,0 +1,160 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// Operations recorded in the history tables. A baseline row is the state a
+// row was in when history began; nothing is known of it before then.
+const (
+	HistoryInsert   = "insert"
+	HistoryUpdate   = "update"
+	HistoryDelete   = "delete"
+	HistoryBaseline = "baseline"
+)
+
+// historyTables lists the tables whose every version is kept, with the
+// history table the triggers copy them into.
+var historyTables = []struct{ table, history, key, columns string }{
+	{"chores", "chores_history", "chore_id", choreColumns},
+	{"app_limits", "app_limits_history", "limit_id", appLimitColumns},
+}
+
+// historyTriggers copies each insert, update and delete into the history
+// tables. They are dropped and recreated at every start, so they always
+// copy the columns the scan functions read.
+func historyTriggers() []string {
+	var out []string
+	for _, t := range historyTables {
+		for _, ev := range []struct{ op, when, row string }{
+			{HistoryInsert, "INSERT", "NEW"},
+			{HistoryUpdate, "UPDATE", "NEW"},
+			{HistoryDelete, "DELETE", "OLD"},
+		} {
+			name := t.history + "_" + ev.op
+			var vals []string
+			for _, c := range strings.Split(t.columns, ",") {
+				vals = append(vals, ev.row+"."+strings.TrimSpace(c))
+			}
+			out = append(out,
+				`DROP TRIGGER IF EXISTS `+name+`;`,
+				`CREATE TRIGGER `+name+` AFTER `+ev.when+` ON `+t.table+` BEGIN INSERT INTO `+t.history+` (op, changed_at, `+t.columns+`) VALUES ('`+ev.op+`', strftime('%Y-%m-%dT%H:%M:%SZ', 'now'), `+strings.Join(vals, ", ")+`); END;`)
+		}
+		out = append(out, `CREATE INDEX IF NOT EXISTS idx_`+t.history+`_key ON `+t.history+`(`+t.key+`, hist_id);`)
+	}
+	return out
+}
+
+// baselineHistory records rows that predate the history tables as they
+// are now.
+func (d *DB) baselineHistory(ctx context.Context) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	for _, t := range historyTables {
+		if _, err := d.SQL.ExecContext(ctx, `INSERT INTO `+t.history+` (op, changed_at, `+t.columns+`) SELECT ?, ?, `+t.columns+` FROM `+t.table+` WHERE `+t.key+` NOT IN (SELECT `+t.key+` FROM `+t.history+`)`,
+			HistoryBaseline, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type ChoreVersion struct {
+	Op        string `json:"op"`
+	ChangedAt string `json:"changed_at"`
+	Chore
+}
+
+type LimitVersion struct {
+	Op        string `json:"op"`
+	ChangedAt string `json:"changed_at"`
+	AppLimit
+}
+
+// FamilySnapshot is a family's chores and limits as they stood at At.
+// HistoryFrom, when set, is when history began. Rows that existed then are
+// only known as of then, so a snapshot from before it shows them in their
+// baseline state.
+type FamilySnapshot struct {
+	At          string         `json:"at"`
+	Chores      []ChoreVersion `json:"chores"`
+	Limits      []LimitVersion `json:"limits"`
+	HistoryFrom string         `json:"history_from,omitempty"`
+}
+
+// prefixScanner scans the history columns in front of a row's own.
+type prefixScanner struct {
+	row    rowScanner
+	prefix []any
+}
+
+func (p prefixScanner) Scan(dest ...any) error { return p.row.Scan(append(p.prefix, dest...)...) }
+
+// FamilyAsOf rebuilds the family's chores and limits as of at from the
+// latest version of each row written at or before it. A row with only its
+// baseline version by then still counts, as it existed before history
+// began. Deleted rows are left out.
+func (d *DB) FamilyAsOf(ctx context.Context, parentWallet, parentEmail string, at time.Time) (*FamilySnapshot, error) {
+	out := &FamilySnapshot{At: at.UTC().Format(time.RFC3339), Chores: []ChoreVersion{}, Limits: []LimitVersion{}}
+	var from sql.NullString
+	if err := d.queryRow(ctx, `SELECT MIN(changed_at) FROM (SELECT changed_at FROM chores_history WHERE op=? UNION ALL SELECT changed_at FROM app_limits_history WHERE op=?)`,
+		HistoryBaseline, HistoryBaseline).Scan(&from); err != nil {
+		return nil, err
+	}
+	out.HistoryFrom = from.String
+
+	rows, err := d.query(ctx, `SELECT op, changed_at, `+choreColumns+` FROM chores_history WHERE hist_id IN (
+		SELECT MAX(hist_id) FROM chores_history WHERE parent_wallet=? AND (changed_at<=? OR op=?) GROUP BY chore_id
+	) AND op<>? ORDER BY chore_id`, parentWallet, out.At, HistoryBaseline, HistoryDelete)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var v ChoreVersion
+		if err := scanChore(prefixScanner{rows, []any{&v.Op, &v.ChangedAt}}, &v.Chore); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		out.Chores = append(out.Chores, v)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = d.query(ctx, `SELECT op, changed_at, `+appLimitColumns+` FROM app_limits_history WHERE hist_id IN (
+		SELECT MAX(hist_id) FROM app_limits_history WHERE parent_email=? AND (changed_at<=? OR op=?) GROUP BY limit_id
+	) AND op<>? ORDER BY kid_email, app`, strings.ToLower(parentEmail), out.At, HistoryBaseline, HistoryDelete)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var v LimitVersion
+		if err := scanAppLimit(prefixScanner{rows, []any{&v.Op, &v.ChangedAt}}, &v.AppLimit); err != nil {
+			return nil, err
+		}
+		out.Limits = append(out.Limits, v)
+	}
+	return out, rows.Err()
+}
+
+// ChoreVersions lists every recorded version of a chore, oldest first.
+func (d *DB) ChoreVersions(ctx context.Context, choreID string) ([]ChoreVersion, error) {
+	rows, err := d.query(ctx, `SELECT op, changed_at, `+choreColumns+` FROM chores_history WHERE chore_id=? ORDER BY hist_id`, choreID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []ChoreVersion{}
+	for rows.Next() {
+		var v ChoreVersion
+		if err := scanChore(prefixScanner{rows, []any{&v.Op, &v.ChangedAt}}, &v.Chore); err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,81 @@
+package db_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"backend_mini/internal/db"
+	"backend_mini/internal/fixtures"
+)
+
+const historyFamily = `
+families:
+  - parent:
+      email: p@example.com
+      name: Parent
+      wallet: GBu756JpQbbyhkj81Boxgd5AYh4rw2YhZLUFWUUReqTw
+    kids:
+      - email: k@example.com
+        name: Kid
+        wallet: 8SyBMpUXQdPPmUAmxEn1EE3Bvxs4Lq4TgX4BWs428rUD
+        limits:
+          - app: com.example.game
+            minutes_per_day: 60
+    chores:
+      - kid: k@example.com
+        name: Dishes
+        bounty: 100
+`
+
+// TestFamilyAsOfBeforeHistory takes a snapshot from before history began:
+// a chore and a limit that predate it show in their baseline state, and a
+// chore created since is left out.
+func TestFamilyAsOfBeforeHistory(t *testing.T) {
+	ctx := context.Background()
+	d, err := db.Open(ctx, filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if err := d.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	f, err := fixtures.Parse([]byte(historyFamily))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fixtures.Load(ctx, d, f); err != nil {
+		t.Fatal(err)
+	}
+	parent := f.Families[0].Parent
+
+	// as if the family was written before the history tables existed: the
+	// next migration records it as its baseline
+	for _, s := range []string{`DELETE FROM chores_history`, `DELETE FROM app_limits_history`} {
+		if _, err := d.SQL.ExecContext(ctx, s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := d.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.CreateChore(ctx, parent.Wallet, "", "Laundry", "", 50, "", db.ChoreKindChore); err != nil {
+		t.Fatal(err)
+	}
+
+	snap, err := d.FamilyAsOf(ctx, parent.Wallet, parent.Email, time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snap.HistoryFrom == "" {
+		t.Error("history_from is empty")
+	}
+	if len(snap.Chores) != 1 || snap.Chores[0].ChoreName != "Dishes" || snap.Chores[0].Op != db.HistoryBaseline {
+		t.Errorf("chores = %+v, want only Dishes at its baseline", snap.Chores)
+	}
+	if len(snap.Limits) != 1 || snap.Limits[0].App != "com.example.game" || snap.Limits[0].Op != db.HistoryBaseline {
+		t.Errorf("limits = %+v, want the baseline com.example.game limit", snap.Limits)
+	}
+}
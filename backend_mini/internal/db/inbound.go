@@ -0,0 +1,22 @@
+package db
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// InboundEmailSeen reports whether an inbound email was already handled;
+// providers retry deliveries they are unsure about.
+func (d *DB) InboundEmailSeen(ctx context.Context, messageID string) (bool, error) {
+	var n int
+	err := d.queryRow(ctx, `SELECT COUNT(*) FROM inbound_emails WHERE message_id=?`, messageID).Scan(&n)
+	return n > 0, err
+}
+
+// RecordInboundEmail marks an inbound email handled by its Message-ID.
+func (d *DB) RecordInboundEmail(ctx context.Context, messageID, parentEmail string, chores int) error {
+	_, err := d.exec(ctx, `INSERT OR IGNORE INTO inbound_emails (message_id, parent_email, chores_created, received_at) VALUES (?, ?, ?, ?)`,
+		messageID, strings.ToLower(parentEmail), chores, time.Now().UTC().Format(time.RFC3339))
+	return err
+}
@@ -0,0 +1,138 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"backend_mini/internal/util"
+)
+
+var ErrIntegrationNotFound = errors.New("integration not found")
+
+// Integration relays a parent's events to a Zapier/IFTTT-style hook. An empty
+// EventTypes list relays everything; a nil Template means the kind's default.
+type Integration struct {
+	IntegrationID string            `json:"integration_id"`
+	ParentEmail   string            `json:"parent_email"`
+	Name          string            `json:"name"`
+	Kind          string            `json:"kind"`
+	URL           string            `json:"url"`
+	EventTypes    []string          `json:"event_types"`
+	Template      map[string]string `json:"template,omitempty"`
+	CreatedAt     string            `json:"created_at"`
+}
+
+// Wants reports whether the integration relays events of this type.
+func (i *Integration) Wants(eventType string) bool {
+	if len(i.EventTypes) == 0 {
+		return true
+	}
+	for _, t := range i.EventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// SaveIntegration creates an integration, or replaces it when IntegrationID is set.
+func (d *DB) SaveIntegration(ctx context.Context, in Integration) (*Integration, error) {
+	in.ParentEmail = strings.ToLower(in.ParentEmail)
+	if in.EventTypes == nil {
+		in.EventTypes = []string{}
+	}
+	types, err := json.Marshal(in.EventTypes)
+	if err != nil {
+		return nil, err
+	}
+	tmpl := ""
+	if in.Template != nil {
+		buf, err := json.Marshal(in.Template)
+		if err != nil {
+			return nil, err
+		}
+		tmpl = string(buf)
+	}
+	if in.IntegrationID != "" {
+		res, err := d.exec(ctx, `UPDATE integrations SET name=?, kind=?, url=?, event_types=?, template=? WHERE integration_id=? AND parent_email=?`,
+			in.Name, in.Kind, in.URL, string(types), tmpl, in.IntegrationID, in.ParentEmail)
+		if err != nil {
+			return nil, err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return nil, ErrIntegrationNotFound
+		}
+		return d.GetIntegration(ctx, in.IntegrationID)
+	}
+	if in.IntegrationID, err = util.NewID(); err != nil {
+		return nil, err
+	}
+	in.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+	_, err = d.exec(ctx, `INSERT INTO integrations (integration_id, parent_email, name, kind, url, event_types, template, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		in.IntegrationID, in.ParentEmail, in.Name, in.Kind, in.URL, string(types), tmpl, in.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &in, nil
+}
+
+const integrationColumns = `integration_id, parent_email, name, kind, url, event_types, template, created_at`
+
+func scanIntegration(row rowScanner, in *Integration) error {
+	var types, tmpl string
+	if err := row.Scan(&in.IntegrationID, &in.ParentEmail, &in.Name, &in.Kind, &in.URL, &types, &tmpl, &in.CreatedAt); err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(types), &in.EventTypes); err != nil {
+		return err
+	}
+	if tmpl != "" {
+		return json.Unmarshal([]byte(tmpl), &in.Template)
+	}
+	return nil
+}
+
+func (d *DB) GetIntegration(ctx context.Context, integrationID string) (*Integration, error) {
+	var in Integration
+	err := scanIntegration(d.queryRow(ctx, `SELECT `+integrationColumns+` FROM integrations WHERE integration_id=?`, integrationID), &in)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrIntegrationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &in, nil
+}
+
+func (d *DB) ListIntegrations(ctx context.Context, parentEmail string) ([]Integration, error) {
+	rows, err := d.query(ctx, `SELECT `+integrationColumns+` FROM integrations WHERE parent_email=? ORDER BY created_at`, strings.ToLower(parentEmail))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []Integration{}
+	for rows.Next() {
+		var in Integration
+		if err := scanIntegration(rows, &in); err != nil {
+			return nil, err
+		}
+		out = append(out, in)
+	}
+	return out, rows.Err()
+}
+
+func (d *DB) DeleteIntegration(ctx context.Context, parentEmail, integrationID string) error {
+	res, err := d.exec(ctx, `DELETE FROM integrations WHERE integration_id=? AND parent_email=?`, integrationID, strings.ToLower(parentEmail))
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrIntegrationNotFound
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+type UserKey struct {
+	Email     string `json:"email"`
+	KeyID     string `json:"key_id"`
+	PublicKey string `json:"public_key"`
+	CreatedAt string `json:"created_at"`
+}
+
+func (d *DB) PublishUserKey(ctx context.Context, email, keyID, publicKey string) (*UserKey, error) {
+	now := time.Now().UTC().Format(time.RFC3339)
+	_, err := d.exec(ctx, `
+		INSERT INTO user_keys (email, key_id, public_key, created_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(email) DO UPDATE SET key_id=excluded.key_id, public_key=excluded.public_key, created_at=excluded.created_at
+	`, strings.ToLower(email), keyID, publicKey, now)
+	if err != nil {
+		return nil, err
+	}
+	return &UserKey{Email: strings.ToLower(email), KeyID: keyID, PublicKey: publicKey, CreatedAt: now}, nil
+}
+
+func (d *DB) GetUserKey(ctx context.Context, email string) (*UserKey, bool, error) {
+	row := d.queryRow(ctx, `SELECT email, key_id, public_key, created_at FROM user_keys WHERE email=?`, strings.ToLower(email))
+	var k UserKey
+	if err := row.Scan(&k.Email, &k.KeyID, &k.PublicKey, &k.CreatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	return &k, true, nil
+}
+
+// UserExists reports whether email belongs to a known parent or child.
+func (d *DB) UserExists(ctx context.Context, email string) (bool, error) {
+	var n int
+	err := d.queryRow(ctx, `
+		SELECT (SELECT COUNT(*) FROM parents WHERE lower(email)=?) + (SELECT COUNT(*) FROM children WHERE lower(email)=?)
+	`, strings.ToLower(email), strings.ToLower(email)).Scan(&n)
+	return n > 0, err
+}
+
+type RetiredKey struct {
+	KeyID     string `json:"key_id"`
+	PublicKey string `json:"public_key"`
+	CreatedAt string `json:"created_at"`
+	RetiredAt string `json:"retired_at"`
+}
+
+// RotateUserKey retires the current key (kept for decrypting old payloads)
+// and publishes newKey in its place.
+func (d *DB) RotateUserKey(ctx context.Context, email, keyID, publicKey string) (*UserKey, *RetiredKey, error) {
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	email = strings.ToLower(email)
+	now := time.Now().UTC().Format(time.RFC3339)
+	var old RetiredKey
+	err = tx.QueryRowContext(ctx, `SELECT key_id, public_key, created_at FROM user_keys WHERE email=?`, email).Scan(&old.KeyID, &old.PublicKey, &old.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, errors.New("no current key to rotate")
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if old.KeyID == keyID {
+		return nil, nil, errors.New("new key matches the current key")
+	}
+	old.RetiredAt = now
+	if _, err := tx.ExecContext(ctx, `INSERT OR REPLACE INTO retired_keys (email, key_id, public_key, created_at, retired_at) VALUES (?, ?, ?, ?, ?)`,
+		email, old.KeyID, old.PublicKey, old.CreatedAt, old.RetiredAt); err != nil {
+		return nil, nil, err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE user_keys SET key_id=?, public_key=?, created_at=? WHERE email=?`, keyID, publicKey, now, email); err != nil {
+		return nil, nil, err
+	}
+	if err := writeAudit(ctx, tx, email, "rotate_keys", email, "retired "+old.KeyID+", active "+keyID); err != nil {
+		return nil, nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+	return &UserKey{Email: email, KeyID: keyID, PublicKey: publicKey, CreatedAt: now}, &old, nil
+}
+
+func (d *DB) GetRetiredKeys(ctx context.Context, email string) ([]RetiredKey, error) {
+	rows, err := d.query(ctx, `SELECT key_id, public_key, created_at, retired_at FROM retired_keys WHERE email=? ORDER BY retired_at DESC`, strings.ToLower(email))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []RetiredKey{}
+	for rows.Next() {
+		var k RetiredKey
+		if err := rows.Scan(&k.KeyID, &k.PublicKey, &k.CreatedAt, &k.RetiredAt); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
@@ -0,0 +1,281 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"backend_mini/internal/util"
+)
+
+var (
+	// ErrKidNameTaken is returned when a family already has a kid by that name.
+	ErrKidNameTaken = errors.New("this family already has a kid with that name")
+	// ErrEmailTaken is returned when creating a parent or kid whose email
+	// is already registered.
+	ErrEmailTaken = errors.New("email already registered")
+)
+
+// uniqueViolation names the columns of the UNIQUE constraint err broke, as
+// SQLite reports them ("parents.email"), or "" if err is anything else.
+func uniqueViolation(err error) string {
+	const marker = "UNIQUE constraint failed: "
+	if err == nil {
+		return ""
+	}
+	msg := err.Error()
+	i := strings.Index(msg, marker)
+	if i < 0 {
+		return ""
+	}
+	cols := msg[i+len(marker):]
+	if j := strings.Index(cols, " ("); j >= 0 {
+		cols = cols[:j]
+	}
+	return cols
+}
+
+type KidSummary struct {
+	ID            string `json:"id"`
+	Name          string `json:"name"`
+	Email         string `json:"email"`
+	ParentID      string `json:"parent_id"`
+	Wallet        string `json:"wallet"`
+	ContactEmail  string `json:"contact_email,omitempty"`
+	LoginCode     string `json:"login_code,omitempty"`
+	PendingChores int    `json:"pending_chores"`
+	// PendingPenalties counts penalties not yet acknowledged or waived;
+	// they are not chores and never count in PendingChores.
+	PendingPenalties int    `json:"pending_penalties"`
+	PausedUntil      string `json:"paused_until,omitempty"`
+}
+
+// ListKids returns every child of a parent with its open chore count in a
+// single query, so clients don't need a follow-up lookup per kid.
+func (d *DB) ListKids(ctx context.Context, parentID string) ([]KidSummary, error) {
+	rows, err := d.query(ctx, `
+		SELECT c.id, c.name, c.email, c.parent_id, c.wallet, c.contact_email, c.login_code,
+			COUNT(CASE WHEN ch.kind = 'chore' THEN 1 END), COUNT(CASE WHEN ch.kind = 'penalty' THEN 1 END),
+			(SELECT COALESCE(MAX(ps.ends_at), '') FROM pauses ps JOIN parents p ON p.email = ps.parent_email
+				WHERE p.id = c.parent_id AND ps.kid_email IN ('', lower(c.email)) AND ps.starts_at <= ?1 AND ps.ends_at > ?1)
+		FROM children c
+		LEFT JOIN chores ch ON c.wallet <> '' AND ch.child_wallet = c.wallet AND ch.chore_status < 3
+		WHERE c.parent_id=?2
+		GROUP BY c.id
+		ORDER BY c.name
+	`, time.Now().UTC().Format(time.RFC3339), parentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	kids := []KidSummary{}
+	for rows.Next() {
+		var k KidSummary
+		var wallet sql.NullString
+		if err := rows.Scan(&k.ID, &k.Name, &k.Email, &k.ParentID, &wallet, &k.ContactEmail, &k.LoginCode, &k.PendingChores, &k.PendingPenalties, &k.PausedUntil); err != nil {
+			return nil, err
+		}
+		k.Wallet = wallet.String
+		kids = append(kids, k)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return kids, nil
+}
+
+// FamilyOfWallet returns the email of the parent whose family owns wallet,
+// either as the parent's own wallet or as one of their kids'.
+func (d *DB) FamilyOfWallet(ctx context.Context, wallet string) (parentEmail string, isKid bool, found bool, err error) {
+	if p, ok, err := d.GetParentByWallet(ctx, wallet); err != nil || ok {
+		if ok {
+			return p.Email, false, true, nil
+		}
+		return "", false, false, err
+	}
+	kid, ok, err := d.GetChildByWallet(ctx, wallet)
+	if err != nil || !ok {
+		return "", false, false, err
+	}
+	p, ok, err := d.GetParentByID(ctx, kid.ParentID)
+	if err != nil || !ok {
+		return "", false, false, err
+	}
+	return p.Email, true, true, nil
+}
+
+// AllFamilyWallets lists every wallet set on a parent, a kid or a split
+// rule's savings side.
+func (d *DB) AllFamilyWallets(ctx context.Context) ([]string, error) {
+	rows, err := d.query(ctx, `
+		SELECT wallet FROM parents WHERE wallet <> ''
+		UNION SELECT wallet FROM children WHERE wallet <> ''
+		UNION SELECT savings_wallet FROM split_rules`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var w string
+		if err := rows.Scan(&w); err != nil {
+			return nil, err
+		}
+		out = append(out, w)
+	}
+	return out, rows.Err()
+}
+
+// GetChildByName finds a kid within a family by name, case-insensitively.
+func (d *DB) GetChildByName(ctx context.Context, parentID, name string) (*Child, bool, error) {
+	var c Child
+	err := scanChild(d.queryRow(ctx, `SELECT `+childColumns+` FROM children WHERE parent_id=? AND lower(name)=lower(?) ORDER BY rowid LIMIT 1`, parentID, strings.TrimSpace(name)), &c)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return &c, true, nil
+}
+
+func (d *DB) GetChildByID(ctx context.Context, id string) (*Child, bool, error) {
+	var c Child
+	err := scanChild(d.queryRow(ctx, `SELECT `+childColumns+` FROM children WHERE id=?`, id), &c)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return &c, true, nil
+}
+
+// GetChildByLoginCode finds the kid a login code was issued to.
+func (d *DB) GetChildByLoginCode(ctx context.Context, code string) (*Child, bool, error) {
+	var c Child
+	err := scanChild(d.queryRow(ctx, `SELECT `+childColumns+` FROM children WHERE login_code=? AND login_code<>''`, strings.ToUpper(strings.TrimSpace(code))), &c)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return &c, true, nil
+}
+
+// ChildrenByEmail lists every kid signing in with email: the kid whose key
+// it is and any siblings who share it as their contact address.
+func (d *DB) ChildrenByEmail(ctx context.Context, email string) ([]Child, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	rows, err := d.query(ctx, `SELECT `+childColumns+` FROM children WHERE lower(email)=? OR contact_email=? ORDER BY name`, email, email)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Child{}
+	for rows.Next() {
+		var c Child
+		if err := scanChild(rows, &c); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// CreateChildByName adds a kid identified by name within the family rather
+// than by an email of their own. Their key is their lowercased id and they
+// get a login code to sign in with; contactEmail may be an address shared
+// with siblings, or empty.
+func (d *DB) CreateChildByName(ctx context.Context, name, parentID, contactEmail string) (*Child, error) {
+	name = strings.TrimSpace(name)
+	parent, found, err := d.GetParentByID(ctx, parentID)
+	if err != nil {
+		return nil, err
+	} else if !found {
+		return nil, errors.New("parent_id not found")
+	}
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+	if err := d.checkQuota(ctx, tx, parent.Email, QuotaKids); err != nil {
+		return nil, err
+	}
+
+	var taken int
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM children WHERE parent_id=? AND lower(name)=lower(?)`, parentID, name).Scan(&taken); err != nil {
+		return nil, err
+	}
+	if taken > 0 {
+		return nil, ErrKidNameTaken
+	}
+	id, err := util.NewID()
+	if err != nil {
+		return nil, err
+	}
+	var child *Child
+	// only the login code can collide; retry that and nothing else
+	for i := 0; i < 10 && child == nil; i++ {
+		code, err := util.GenerateCode(8)
+		if err != nil {
+			return nil, err
+		}
+		c := Child{ID: id, Name: name, Email: strings.ToLower(id), ParentID: parentID, ContactEmail: strings.ToLower(strings.TrimSpace(contactEmail)), LoginCode: code}
+		_, err = tx.ExecContext(ctx, `INSERT INTO children (`+childColumns+`) VALUES (?, ?, ?, ?, '', ?, ?, 0)`,
+			c.ID, c.Name, c.Email, c.ParentID, c.ContactEmail, c.LoginCode)
+		if uniqueViolation(err) == "children.login_code" {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		child = &c
+	}
+	if child == nil {
+		return nil, errors.New("failed to generate unique login code for child")
+	}
+	if err := addChildToParentKidsListTx(ctx, tx, parentID, child.Email, ""); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return child, nil
+}
+
+// ResetLoginCode issues a kid a new login code, invalidating the old one.
+func (d *DB) ResetLoginCode(ctx context.Context, kidEmail string) (string, error) {
+	for i := 0; i < 10; i++ {
+		code, err := util.GenerateCode(8)
+		if err != nil {
+			return "", err
+		}
+		res, err := d.exec(ctx, `UPDATE children SET login_code=? WHERE lower(email)=?`, code, strings.ToLower(kidEmail))
+		if err != nil {
+			continue
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return "", sql.ErrNoRows
+		}
+		return code, nil
+	}
+	return "", errors.New("failed to generate unique login code")
+}
+
+// SetChildBirthYear sets the year the kid was born; zero clears it.
+func (d *DB) SetChildBirthYear(ctx context.Context, kidEmail string, year int) error {
+	res, err := d.exec(ctx, `UPDATE children SET birth_year=? WHERE lower(email)=?`, year, strings.ToLower(kidEmail))
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
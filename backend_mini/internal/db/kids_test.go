@@ -0,0 +1,62 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+// BenchmarkListKids drives /list_kids' query from many goroutines at once,
+// against one connection serving reads and writes alike and against the
+// single writer plus reader pool Open sets up:
+//
+//	go test ./internal/db -run '^$' -bench ListKids -cpu 1,4,8
+func BenchmarkListKids(b *testing.B) {
+	ctx := context.Background()
+	d, err := Open(ctx, filepath.Join(b.TempDir(), "bench.db"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer d.Close()
+	if err := d.Migrate(ctx); err != nil {
+		b.Fatal(err)
+	}
+	p, err := d.CreateParent(ctx, "Bench Parent", "bench@example.com")
+	if err != nil {
+		b.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		if _, err := d.CreateChild(ctx, fmt.Sprintf("Kid %d", i), fmt.Sprintf("kid%d@example.com", i), p.ID); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	// reads queued behind the writer's one connection, as before the pool
+	single := &DB{SQL: d.SQL, Read: d.SQL, readStmts: newStmtCache(d.SQL), writeStmts: d.writeStmts}
+	defer single.readStmts.close()
+
+	for _, bc := range []struct {
+		name string
+		db   *DB
+	}{{"single_conn", single}, {"reader_pool", d}} {
+		b.Run(bc.name, func(b *testing.B) {
+			// more callers than cores, as under request load
+			b.SetParallelism(4)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					kids, err := bc.db.ListKids(ctx, p.ID)
+					if err != nil {
+						b.Error(err)
+						return
+					}
+					if len(kids) != 4 {
+						b.Errorf("listed %d kids, want 4", len(kids))
+						return
+					}
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,222 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"backend_mini/internal/util"
+)
+
+// Transfer kinds recorded in the ledger.
+const (
+	TransferKindDirect      = "transfer"
+	TransferKindChorePayout = "chore_payout"
+	TransferKindPenalty     = "penalty"
+	// TransferKindReversal pays a mistaken transfer back; its ref is the
+	// transfer it reverses.
+	TransferKindReversal = "reversal"
+)
+
+// Transfer statuses. A rebuilt transfer is superseded by its replacement
+// and no longer counts anywhere in the ledger.
+const (
+	TransferBuilt      = "built"
+	TransferSuperseded = "superseded"
+)
+
+var ErrTransferSuperseded = errors.New("transfer already superseded")
+
+// Transfer is a built EURC transaction as recorded in the ledger. It is
+// written when the transaction is handed to the client for signing. The
+// ledger does not watch the chain: SettledAt is only set when something
+// that depends on settlement, such as a reversal, confirms it there.
+type Transfer struct {
+	TransferID   string        `json:"transfer_id"`
+	FromWallet   string        `json:"from_wallet"`
+	ToWallet     string        `json:"to_wallet"`
+	Kind         string        `json:"kind"`
+	Ref          string        `json:"ref,omitempty"`
+	Total        uint64        `json:"total"`
+	Legs         []TransferLeg `json:"legs"`
+	Status       string        `json:"status"`
+	Blockhash    string        `json:"blockhash"`
+	ExpiresAt    string        `json:"expires_at"`
+	SupersededBy string        `json:"superseded_by,omitempty"`
+	ATACreates   []string      `json:"ata_creates,omitempty"`
+	MessageHash  string        `json:"message_hash,omitempty"`
+	// Signature is the one the transfer was signed with, once a client
+	// has had it verified; SettledAt is set once it was confirmed on chain.
+	Signature string `json:"signature,omitempty"`
+	SettledAt string `json:"settled_at,omitempty"`
+	CreatedAt string `json:"created_at"`
+}
+
+type TransferLeg struct {
+	ToWallet string `json:"to_wallet"`
+	Amount   uint64 `json:"amount"`
+}
+
+// RecordTransfer writes a built transfer and its legs, filling in its id,
+// total, status and creation time. ToWallet is the recipient asked for; the
+// legs may differ when a split rule applied.
+func (d *DB) RecordTransfer(ctx context.Context, t *Transfer) error {
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := insertTransfer(ctx, tx, t); err != nil {
+		return err
+	}
+	if t.Ref != "" && (t.Kind == TransferKindChorePayout || t.Kind == TransferKindPenalty) {
+		payer := ActorParent
+		if t.Kind == TransferKindPenalty {
+			payer = ActorKid
+		}
+		if err := addChoreEntry(ctx, tx, t.Ref, TimelinePaid, payer, "", t.TransferID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// SupersedeTransfer records replacement and marks oldID as superseded by it,
+// failing with ErrTransferSuperseded if something replaced oldID first.
+func (d *DB) SupersedeTransfer(ctx context.Context, oldID string, replacement *Transfer) error {
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := insertTransfer(ctx, tx, replacement); err != nil {
+		return err
+	}
+	res, err := tx.ExecContext(ctx, `UPDATE transfers SET status=?, superseded_by=? WHERE transfer_id=? AND status=?`,
+		TransferSuperseded, replacement.TransferID, oldID, TransferBuilt)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrTransferSuperseded
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE transfer_reversals SET reversal_transfer_id=? WHERE reversal_transfer_id=?`, replacement.TransferID, oldID); err != nil {
+		return err
+	}
+	if err := appendLedger(ctx, tx, LedgerEventSuperseded, oldID, ledgerSuperseded{oldID, replacement.TransferID}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func insertTransfer(ctx context.Context, tx *sql.Tx, t *Transfer) error {
+	id, err := util.NewID()
+	if err != nil {
+		return err
+	}
+	t.TransferID, t.Status, t.CreatedAt, t.Total = id, TransferBuilt, time.Now().UTC().Format(time.RFC3339), 0
+	for _, l := range t.Legs {
+		t.Total += l.Amount
+	}
+	if t.ATACreates == nil {
+		t.ATACreates = []string{}
+	}
+	atas, err := json.Marshal(t.ATACreates)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO transfers (transfer_id, from_wallet, to_wallet, kind, ref, total, status, blockhash, expires_at, ata_creates, message_hash, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		t.TransferID, t.FromWallet, t.ToWallet, t.Kind, t.Ref, t.Total, t.Status, t.Blockhash, t.ExpiresAt, string(atas), t.MessageHash, t.CreatedAt); err != nil {
+		return err
+	}
+	for _, l := range t.Legs {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO transfer_legs (transfer_id, to_wallet, amount) VALUES (?, ?, ?)`, t.TransferID, l.ToWallet, l.Amount); err != nil {
+			return err
+		}
+	}
+	return appendBuilt(ctx, tx, t)
+}
+
+func (d *DB) GetTransfer(ctx context.Context, transferID string) (*Transfer, bool, error) {
+	var t Transfer
+	var atas string
+	err := d.queryRow(ctx, `SELECT transfer_id, from_wallet, to_wallet, kind, ref, total, status, blockhash, expires_at, superseded_by, ata_creates, message_hash, signature, settled_at, created_at FROM transfers WHERE transfer_id=?`, transferID).
+		Scan(&t.TransferID, &t.FromWallet, &t.ToWallet, &t.Kind, &t.Ref, &t.Total, &t.Status, &t.Blockhash, &t.ExpiresAt, &t.SupersededBy, &atas, &t.MessageHash, &t.Signature, &t.SettledAt, &t.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if err := json.Unmarshal([]byte(atas), &t.ATACreates); err != nil {
+		return nil, false, err
+	}
+	rows, err := d.query(ctx, `SELECT to_wallet, amount FROM transfer_legs WHERE transfer_id=? ORDER BY rowid`, transferID)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+	t.Legs = []TransferLeg{}
+	for rows.Next() {
+		var l TransferLeg
+		if err := rows.Scan(&l.ToWallet, &l.Amount); err != nil {
+			return nil, false, err
+		}
+		t.Legs = append(t.Legs, l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+	return &t, true, nil
+}
+
+// RecordTransferSignature notes the signature a verified transaction
+// carries. A settled transfer keeps the one it settled with.
+func (d *DB) RecordTransferSignature(ctx context.Context, transferID, signature string) error {
+	_, err := d.exec(ctx, `UPDATE transfers SET signature=? WHERE transfer_id=? AND settled_at=''`, signature, transferID)
+	return err
+}
+
+// SettleTransfer records that the transfer landed on chain with signature.
+func (d *DB) SettleTransfer(ctx context.Context, t *Transfer, signature string) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	if _, err := d.exec(ctx, `UPDATE transfers SET signature=?, settled_at=? WHERE transfer_id=?`, signature, now, t.TransferID); err != nil {
+		return err
+	}
+	t.Signature, t.SettledAt = signature, now
+	return nil
+}
+
+// RecentDuplicate returns the latest transfer with the same sender,
+// requested recipient and amount built at or after since.
+func (d *DB) RecentDuplicate(ctx context.Context, fromWallet, toWallet string, amount uint64, since time.Time) (*Transfer, bool, error) {
+	var id string
+	err := d.queryRow(ctx, `SELECT transfer_id FROM transfers WHERE from_wallet=? AND to_wallet=? AND total=? AND status=? AND created_at >= ? ORDER BY created_at DESC LIMIT 1`,
+		fromWallet, toWallet, amount, TransferBuilt, since.UTC().Format(time.RFC3339)).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return d.GetTransfer(ctx, id)
+}
+
+// PendingTotals sums the unexpired builds moving EURC into and out of
+// wallet: transactions that may still land but are not reflected on chain.
+func (d *DB) PendingTotals(ctx context.Context, wallet string, now time.Time) (in, out uint64, err error) {
+	at := now.UTC().Format(time.RFC3339)
+	if err := d.queryRow(ctx, `SELECT COALESCE(SUM(l.amount), 0) FROM transfer_legs l JOIN transfers t ON t.transfer_id = l.transfer_id
+		WHERE l.to_wallet=? AND t.status=? AND t.expires_at > ?`, wallet, TransferBuilt, at).Scan(&in); err != nil {
+		return 0, 0, err
+	}
+	if err := d.queryRow(ctx, `SELECT COALESCE(SUM(total), 0) FROM transfers WHERE from_wallet=? AND status=? AND expires_at > ?`,
+		wallet, TransferBuilt, at).Scan(&out); err != nil {
+		return 0, 0, err
+	}
+	return in, out, nil
+}
@@ -0,0 +1,315 @@
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Events of the ledger chain. A transfer is appended once when it is
+// built and once more if a rebuild supersedes it; nothing else about a
+// transfer may change.
+const (
+	LedgerEventBuilt      = "built"
+	LedgerEventSuperseded = "superseded"
+)
+
+// maxLedgerProblems caps the problems a verification lists.
+const maxLedgerProblems = 100
+
+// LedgerEntry is one link of the hash chain over the transfers ledger.
+// Hash is the SHA-256 of PrevHash and Payload, so changing any entry, or
+// the transfer it describes, breaks every hash after it.
+type LedgerEntry struct {
+	Seq        int64  `json:"seq"`
+	Event      string `json:"event"`
+	TransferID string `json:"transfer_id"`
+	Payload    string `json:"payload"`
+	PrevHash   string `json:"prev_hash"`
+	Hash       string `json:"hash"`
+	CreatedAt  string `json:"created_at"`
+}
+
+// LedgerAnchor is a chain head published on-chain in a memo transaction
+// from the server wallet.
+type LedgerAnchor struct {
+	Seq        int64  `json:"seq"`
+	Hash       string `json:"hash"`
+	Signature  string `json:"signature"`
+	AnchoredAt string `json:"anchored_at"`
+	// Matches is set by verification: the chain still has Hash at Seq.
+	Matches bool `json:"matches"`
+}
+
+type LedgerProblem struct {
+	Seq        int64  `json:"seq,omitempty"`
+	TransferID string `json:"transfer_id,omitempty"`
+	Problem    string `json:"problem"`
+}
+
+// LedgerVerification is the outcome of VerifyLedger.
+type LedgerVerification struct {
+	OK       bool            `json:"ok"`
+	Entries  int64           `json:"entries"`
+	HeadSeq  int64           `json:"head_seq"`
+	HeadHash string          `json:"head_hash"`
+	Anchors  []LedgerAnchor  `json:"anchors"`
+	Problems []LedgerProblem `json:"problems,omitempty"`
+}
+
+// ledgerBuilt is what the chain records of a built transfer: every column
+// that is fixed once it is written.
+type ledgerBuilt struct {
+	TransferID  string        `json:"transfer_id"`
+	FromWallet  string        `json:"from_wallet"`
+	ToWallet    string        `json:"to_wallet"`
+	Kind        string        `json:"kind"`
+	Ref         string        `json:"ref"`
+	Total       uint64        `json:"total"`
+	Legs        []TransferLeg `json:"legs"`
+	Blockhash   string        `json:"blockhash"`
+	ExpiresAt   string        `json:"expires_at"`
+	ATACreates  []string      `json:"ata_creates"`
+	MessageHash string        `json:"message_hash"`
+	CreatedAt   string        `json:"created_at"`
+}
+
+type ledgerSuperseded struct {
+	TransferID   string `json:"transfer_id"`
+	SupersededBy string `json:"superseded_by"`
+}
+
+func builtPayload(t *Transfer) (string, error) {
+	legs, atas := t.Legs, t.ATACreates
+	if legs == nil {
+		legs = []TransferLeg{}
+	}
+	if atas == nil {
+		atas = []string{}
+	}
+	raw, err := json.Marshal(ledgerBuilt{t.TransferID, t.FromWallet, t.ToWallet, t.Kind, t.Ref, t.Total, legs, t.Blockhash, t.ExpiresAt, atas, t.MessageHash, t.CreatedAt})
+	return string(raw), err
+}
+
+func chainHash(prev, payload string) string {
+	sum := sha256.Sum256([]byte(prev + "\n" + payload))
+	return hex.EncodeToString(sum[:])
+}
+
+// appendLedger links a new entry to the head of the chain. Writes go
+// through the single write connection, so the head cannot move under it.
+func appendLedger(ctx context.Context, tx *sql.Tx, event, transferID string, payload any) error {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	var prev string
+	err = tx.QueryRowContext(ctx, `SELECT hash FROM ledger_chain ORDER BY seq DESC LIMIT 1`).Scan(&prev)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO ledger_chain (event, transfer_id, payload, prev_hash, hash, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		event, transferID, string(raw), prev, chainHash(prev, string(raw)), time.Now().UTC().Format(time.RFC3339))
+	return err
+}
+
+func appendBuilt(ctx context.Context, tx *sql.Tx, t *Transfer) error {
+	payload, err := builtPayload(t)
+	if err != nil {
+		return err
+	}
+	return appendLedger(ctx, tx, LedgerEventBuilt, t.TransferID, json.RawMessage(payload))
+}
+
+// chainUnchainedTransfers appends transfers recorded before the chain
+// existed, oldest first, so the chain covers the whole ledger.
+func (d *DB) chainUnchainedTransfers(ctx context.Context) error {
+	rows, err := d.SQL.QueryContext(ctx, `SELECT transfer_id FROM transfers WHERE transfer_id NOT IN (SELECT transfer_id FROM ledger_chain WHERE event=?) ORDER BY created_at, rowid`, LedgerEventBuilt)
+	if err != nil {
+		return err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil || len(ids) == 0 {
+		return err
+	}
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, id := range ids {
+		t, found, err := d.GetTransfer(ctx, id)
+		if err != nil || !found {
+			return fmt.Errorf("chaining transfer %s: %v", id, err)
+		}
+		if err := appendBuilt(ctx, tx, t); err != nil {
+			return err
+		}
+		if t.Status == TransferSuperseded {
+			if err := appendLedger(ctx, tx, LedgerEventSuperseded, t.TransferID, ledgerSuperseded{t.TransferID, t.SupersededBy}); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// LedgerHead is the newest entry of the chain; found is false while the
+// ledger is empty.
+func (d *DB) LedgerHead(ctx context.Context) (seq int64, hash string, found bool, err error) {
+	err = d.queryRow(ctx, `SELECT seq, hash FROM ledger_chain ORDER BY seq DESC LIMIT 1`).Scan(&seq, &hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, "", false, nil
+	}
+	return seq, hash, err == nil, err
+}
+
+// LastLedgerAnchor returns the newest anchor, if any.
+func (d *DB) LastLedgerAnchor(ctx context.Context) (*LedgerAnchor, bool, error) {
+	var a LedgerAnchor
+	err := d.queryRow(ctx, `SELECT seq, hash, signature, anchored_at FROM ledger_anchors ORDER BY seq DESC LIMIT 1`).Scan(&a.Seq, &a.Hash, &a.Signature, &a.AnchoredAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return &a, true, nil
+}
+
+func (d *DB) RecordLedgerAnchor(ctx context.Context, a *LedgerAnchor) error {
+	a.AnchoredAt = time.Now().UTC().Format(time.RFC3339)
+	_, err := d.exec(ctx, `INSERT INTO ledger_anchors (seq, hash, signature, anchored_at) VALUES (?, ?, ?, ?)`, a.Seq, a.Hash, a.Signature, a.AnchoredAt)
+	return err
+}
+
+// VerifyLedger walks the whole chain: every hash must follow from the one
+// before, every transfer must still read as its entry recorded it, and
+// every anchor must name a hash the chain still has.
+func (d *DB) VerifyLedger(ctx context.Context) (*LedgerVerification, error) {
+	v := &LedgerVerification{Anchors: []LedgerAnchor{}}
+	problem := func(p LedgerProblem) {
+		if len(v.Problems) < maxLedgerProblems {
+			v.Problems = append(v.Problems, p)
+		}
+	}
+	rows, err := d.query(ctx, `SELECT seq, event, transfer_id, payload, prev_hash, hash, created_at FROM ledger_chain ORDER BY seq`)
+	if err != nil {
+		return nil, err
+	}
+	var entries []LedgerEntry
+	for rows.Next() {
+		var e LedgerEntry
+		if err := rows.Scan(&e.Seq, &e.Event, &e.TransferID, &e.Payload, &e.PrevHash, &e.Hash, &e.CreatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	hashes := make(map[int64]string, len(entries))
+	built, superseded := 0, map[string]string{}
+	prev := ""
+	for _, e := range entries {
+		if e.PrevHash != prev {
+			problem(LedgerProblem{Seq: e.Seq, TransferID: e.TransferID, Problem: "does not link to the entry before it"})
+		}
+		if chainHash(e.PrevHash, e.Payload) != e.Hash {
+			problem(LedgerProblem{Seq: e.Seq, TransferID: e.TransferID, Problem: "entry was modified: its hash does not match"})
+		}
+		prev, hashes[e.Seq] = e.Hash, e.Hash
+		switch e.Event {
+		case LedgerEventBuilt:
+			built++
+			t, found, err := d.GetTransfer(ctx, e.TransferID)
+			if err != nil {
+				return nil, err
+			}
+			if !found {
+				problem(LedgerProblem{Seq: e.Seq, TransferID: e.TransferID, Problem: "transfer was deleted"})
+				continue
+			}
+			if payload, err := builtPayload(t); err != nil {
+				return nil, err
+			} else if payload != e.Payload {
+				problem(LedgerProblem{Seq: e.Seq, TransferID: e.TransferID, Problem: "transfer differs from what the chain recorded"})
+			}
+		case LedgerEventSuperseded:
+			var s ledgerSuperseded
+			if err := json.Unmarshal([]byte(e.Payload), &s); err != nil {
+				problem(LedgerProblem{Seq: e.Seq, TransferID: e.TransferID, Problem: "unreadable entry"})
+				continue
+			}
+			superseded[s.TransferID] = s.SupersededBy
+		}
+	}
+	v.Entries = int64(len(entries))
+	if n := len(entries); n > 0 {
+		v.HeadSeq, v.HeadHash = entries[n-1].Seq, entries[n-1].Hash
+	}
+
+	// transfers the chain does not know of, and supersessions it did not see
+	rows, err = d.query(ctx, `SELECT transfer_id, status, superseded_by FROM transfers`)
+	if err != nil {
+		return nil, err
+	}
+	transfers := 0
+	for rows.Next() {
+		var id, status, by string
+		if err := rows.Scan(&id, &status, &by); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		transfers++
+		if want, ok := superseded[id]; (status == TransferSuperseded) != ok || want != by {
+			problem(LedgerProblem{TransferID: id, Problem: "supersession differs from what the chain recorded"})
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if transfers != built {
+		problem(LedgerProblem{Problem: fmt.Sprintf("%d transfers but %d built entries in the chain", transfers, built)})
+	}
+
+	rows, err = d.query(ctx, `SELECT seq, hash, signature, anchored_at FROM ledger_anchors ORDER BY seq`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var a LedgerAnchor
+		if err := rows.Scan(&a.Seq, &a.Hash, &a.Signature, &a.AnchoredAt); err != nil {
+			return nil, err
+		}
+		a.Matches = hashes[a.Seq] == a.Hash
+		if !a.Matches {
+			problem(LedgerProblem{Seq: a.Seq, Problem: "chain no longer matches the anchor published in " + a.Signature})
+		}
+		v.Anchors = append(v.Anchors, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	v.OK = len(v.Problems) == 0
+	return v, nil
+}
@@ -0,0 +1,298 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"backend_mini/internal/util"
+)
+
+// Sources of a limit change in the history.
+const (
+	LimitSourceSet       = "set_limit"
+	LimitSourceBulk      = "set_limits_bulk"
+	LimitSourceScheduled = "scheduled"
+	LimitSourceAppAlert  = "app_alert"
+)
+
+// Scheduled limit change statuses.
+const (
+	LimitChangePending   = "pending"
+	LimitChangeApplied   = "applied"
+	LimitChangeCancelled = "cancelled"
+)
+
+var ErrLimitChangeNotFound = errors.New("scheduled limit change not found")
+
+// BulkLimitResult sorts the rows touched by SetAppLimitsBulk by what
+// happened to them. Skipped rows are existing limits left untouched
+// because override was not set.
+type BulkLimitResult struct {
+	Created []AppLimit `json:"created"`
+	Updated []AppLimit `json:"updated"`
+	Skipped []AppLimit `json:"skipped"`
+}
+
+// LimitChange is one entry of the limit history. The Old fields are nil
+// when the change created the limit.
+type LimitChange struct {
+	ID              int64   `json:"id"`
+	LimitID         string  `json:"limit_id"`
+	ParentEmail     string  `json:"parent_email"`
+	KidEmail        string  `json:"kid_email"`
+	App             string  `json:"app"`
+	OldTimePerDay   *int    `json:"old_time_per_day"`
+	OldFeeExtraHour *uint64 `json:"old_fee_extra_hour"`
+	TimePerDay      int     `json:"time_per_day"`
+	FeeExtraHour    uint64  `json:"fee_extra_hour"`
+	ChangedBy       string  `json:"changed_by"`
+	Source          string  `json:"source"`
+	ChangedAt       string  `json:"changed_at"`
+}
+
+// ScheduledLimitChange is a limit waiting for EffectiveAt. It is written to
+// app_limits the first time the kid's limits are resolved at or after then.
+type ScheduledLimitChange struct {
+	ChangeID     string `json:"change_id"`
+	ParentEmail  string `json:"parent_email"`
+	KidEmail     string `json:"kid_email"`
+	App          string `json:"app"`
+	TimePerDay   int    `json:"time_per_day"`
+	FeeExtraHour uint64 `json:"fee_extra_hour"`
+	EffectiveAt  string `json:"effective_at"`
+	Status       string `json:"status"`
+	CreatedBy    string `json:"created_by"`
+	CreatedAt    string `json:"created_at"`
+	AppliedAt    string `json:"applied_at,omitempty"`
+}
+
+const appLimitColumns = `limit_id, parent_email, kid_email, app, time_per_day, fee_extra_hour, created_at`
+
+func scanAppLimit(row rowScanner, l *AppLimit) error {
+	return row.Scan(&l.LimitID, &l.ParentEmail, &l.KidEmail, &l.App, &l.TimePerDay, &l.FeeExtraHour, &l.CreatedAt)
+}
+
+const limitChangeColumns = `change_id, parent_email, kid_email, app, time_per_day, fee_extra_hour, effective_at, status, created_by, created_at, applied_at`
+
+func scanLimitChange(row rowScanner, c *ScheduledLimitChange) error {
+	return row.Scan(&c.ChangeID, &c.ParentEmail, &c.KidEmail, &c.App, &c.TimePerDay, &c.FeeExtraHour, &c.EffectiveAt, &c.Status, &c.CreatedBy, &c.CreatedAt, &c.AppliedAt)
+}
+
+// upsertAppLimit creates or updates the kid's limit for app inside tx and
+// records the change in the history. It reports whether the row is new.
+func upsertAppLimit(ctx context.Context, tx *sql.Tx, parentEmail, kidEmail, app string, timePerDay int, feeExtraHour uint64, changedBy, source string) (*AppLimit, bool, error) {
+	parentEmail, kidEmail = strings.ToLower(parentEmail), strings.ToLower(kidEmail)
+	var l AppLimit
+	err := scanAppLimit(tx.QueryRowContext(ctx, `SELECT `+appLimitColumns+` FROM app_limits WHERE parent_email=? AND kid_email=? AND app=?`, parentEmail, kidEmail, app), &l)
+	if errors.Is(err, sql.ErrNoRows) {
+		l, err = insertAppLimit(ctx, tx, parentEmail, kidEmail, app, timePerDay, feeExtraHour)
+		if err != nil {
+			return nil, false, err
+		}
+		return &l, true, writeLimitHistory(ctx, tx, nil, &l, changedBy, source)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	prev := l
+	if err := updateAppLimit(ctx, tx, &l, timePerDay, feeExtraHour); err != nil {
+		return nil, false, err
+	}
+	return &l, false, writeLimitHistory(ctx, tx, &prev, &l, changedBy, source)
+}
+
+func insertAppLimit(ctx context.Context, tx *sql.Tx, parentEmail, kidEmail, app string, timePerDay int, feeExtraHour uint64) (AppLimit, error) {
+	id, err := util.NewID()
+	if err != nil {
+		return AppLimit{}, err
+	}
+	l := AppLimit{LimitID: id, ParentEmail: parentEmail, KidEmail: kidEmail, App: app, TimePerDay: timePerDay, FeeExtraHour: feeExtraHour, CreatedAt: time.Now().UTC().Format(time.RFC3339)}
+	_, err = tx.ExecContext(ctx, `INSERT INTO app_limits (`+appLimitColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		l.LimitID, l.ParentEmail, l.KidEmail, l.App, l.TimePerDay, l.FeeExtraHour, l.CreatedAt)
+	return l, err
+}
+
+func updateAppLimit(ctx context.Context, tx *sql.Tx, l *AppLimit, timePerDay int, feeExtraHour uint64) error {
+	if _, err := tx.ExecContext(ctx, `UPDATE app_limits SET time_per_day=?, fee_extra_hour=? WHERE limit_id=?`, timePerDay, feeExtraHour, l.LimitID); err != nil {
+		return err
+	}
+	l.TimePerDay, l.FeeExtraHour = timePerDay, feeExtraHour
+	return nil
+}
+
+func writeLimitHistory(ctx context.Context, tx *sql.Tx, prev, l *AppLimit, changedBy, source string) error {
+	var oldTime, oldFee any
+	if prev != nil {
+		oldTime, oldFee = prev.TimePerDay, prev.FeeExtraHour
+	}
+	_, err := tx.ExecContext(ctx, `INSERT INTO app_limit_history (limit_id, parent_email, kid_email, app, old_time_per_day, old_fee_extra_hour, time_per_day, fee_extra_hour, changed_by, source, changed_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		l.LimitID, l.ParentEmail, l.KidEmail, l.App, oldTime, oldFee, l.TimePerDay, l.FeeExtraHour, strings.ToLower(changedBy), source, time.Now().UTC().Format(time.RFC3339))
+	return err
+}
+
+// SetAppLimitsBulk applies one limit for app to each kid in a single
+// transaction: either every row is written or none is. A kid who already
+// has a limit for app keeps it unless override is set.
+func (d *DB) SetAppLimitsBulk(ctx context.Context, parentEmail string, kidEmails []string, app string, timePerDay int, feeExtraHour uint64, override bool) (*BulkLimitResult, error) {
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	parentEmail = strings.ToLower(parentEmail)
+	out := &BulkLimitResult{Created: []AppLimit{}, Updated: []AppLimit{}, Skipped: []AppLimit{}}
+	for _, kidEmail := range kidEmails {
+		kidEmail = strings.ToLower(kidEmail)
+		var l AppLimit
+		err := scanAppLimit(tx.QueryRowContext(ctx, `SELECT `+appLimitColumns+` FROM app_limits WHERE parent_email=? AND kid_email=? AND app=?`, parentEmail, kidEmail, app), &l)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			if err := d.checkQuota(ctx, tx, parentEmail, QuotaLimits); err != nil {
+				return nil, err
+			}
+			if l, err = insertAppLimit(ctx, tx, parentEmail, kidEmail, app, timePerDay, feeExtraHour); err != nil {
+				return nil, err
+			}
+			if err := writeLimitHistory(ctx, tx, nil, &l, parentEmail, LimitSourceBulk); err != nil {
+				return nil, err
+			}
+			out.Created = append(out.Created, l)
+		case err != nil:
+			return nil, err
+		case !override:
+			out.Skipped = append(out.Skipped, l)
+		default:
+			prev := l
+			if err := updateAppLimit(ctx, tx, &l, timePerDay, feeExtraHour); err != nil {
+				return nil, err
+			}
+			if err := writeLimitHistory(ctx, tx, &prev, &l, parentEmail, LimitSourceBulk); err != nil {
+				return nil, err
+			}
+			out.Updated = append(out.Updated, l)
+		}
+	}
+	return out, tx.Commit()
+}
+
+// GetLimitHistory returns the kid's limit changes, newest first, optionally
+// only those for app.
+func (d *DB) GetLimitHistory(ctx context.Context, kidEmail, app string, limit int) ([]LimitChange, error) {
+	rows, err := d.query(ctx, `SELECT id, limit_id, parent_email, kid_email, app, old_time_per_day, old_fee_extra_hour, time_per_day, fee_extra_hour, changed_by, source, changed_at
+		FROM app_limit_history WHERE kid_email=? AND (?='' OR app=?) ORDER BY id DESC LIMIT ?`, strings.ToLower(kidEmail), app, app, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []LimitChange{}
+	for rows.Next() {
+		var c LimitChange
+		var oldTime, oldFee sql.NullInt64
+		if err := rows.Scan(&c.ID, &c.LimitID, &c.ParentEmail, &c.KidEmail, &c.App, &oldTime, &oldFee, &c.TimePerDay, &c.FeeExtraHour, &c.ChangedBy, &c.Source, &c.ChangedAt); err != nil {
+			return nil, err
+		}
+		if oldTime.Valid {
+			t, f := int(oldTime.Int64), uint64(oldFee.Int64)
+			c.OldTimePerDay, c.OldFeeExtraHour = &t, &f
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// ScheduleAppLimit records a limit that takes effect at c.EffectiveAt,
+// filling in its id, status and creation time.
+func (d *DB) ScheduleAppLimit(ctx context.Context, c *ScheduledLimitChange) error {
+	id, err := util.NewID()
+	if err != nil {
+		return err
+	}
+	c.ChangeID, c.Status, c.CreatedAt = id, LimitChangePending, time.Now().UTC().Format(time.RFC3339)
+	c.ParentEmail, c.KidEmail, c.CreatedBy = strings.ToLower(c.ParentEmail), strings.ToLower(c.KidEmail), strings.ToLower(c.CreatedBy)
+	_, err = d.exec(ctx, `INSERT INTO scheduled_limit_changes (`+limitChangeColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		c.ChangeID, c.ParentEmail, c.KidEmail, c.App, c.TimePerDay, c.FeeExtraHour, c.EffectiveAt, c.Status, c.CreatedBy, c.CreatedAt, c.AppliedAt)
+	return err
+}
+
+// ListScheduledLimits returns the kid's pending limit changes, soonest
+// first.
+func (d *DB) ListScheduledLimits(ctx context.Context, kidEmail string) ([]ScheduledLimitChange, error) {
+	rows, err := d.query(ctx, `SELECT `+limitChangeColumns+` FROM scheduled_limit_changes WHERE kid_email=? AND status=? ORDER BY effective_at, created_at`,
+		strings.ToLower(kidEmail), LimitChangePending)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []ScheduledLimitChange{}
+	for rows.Next() {
+		var c ScheduledLimitChange
+		if err := scanLimitChange(rows, &c); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// CancelScheduledLimit drops a pending change of the parent's before it
+// takes effect.
+func (d *DB) CancelScheduledLimit(ctx context.Context, changeID, parentEmail string) error {
+	res, err := d.exec(ctx, `UPDATE scheduled_limit_changes SET status=? WHERE change_id=? AND parent_email=? AND status=?`,
+		LimitChangeCancelled, changeID, strings.ToLower(parentEmail), LimitChangePending)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrLimitChangeNotFound
+	}
+	return nil
+}
+
+// EffectiveAppLimits resolves the kid's stored limits as of at: pending
+// changes due by then are written to app_limits first, oldest first, so a
+// later change to the same app wins. The history credits each to whoever
+// scheduled it.
+func (d *DB) EffectiveAppLimits(ctx context.Context, kidEmail string, at time.Time) ([]AppLimit, error) {
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `SELECT `+limitChangeColumns+` FROM scheduled_limit_changes WHERE kid_email=? AND status=? AND effective_at<=? ORDER BY effective_at, created_at`,
+		strings.ToLower(kidEmail), LimitChangePending, at.UTC().Format(time.RFC3339))
+	if err != nil {
+		return nil, err
+	}
+	var due []ScheduledLimitChange
+	for rows.Next() {
+		var c ScheduledLimitChange
+		if err := scanLimitChange(rows, &c); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		due = append(due, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	for _, c := range due {
+		if _, _, err := upsertAppLimit(ctx, tx, c.ParentEmail, c.KidEmail, c.App, c.TimePerDay, c.FeeExtraHour, c.CreatedBy, LimitSourceScheduled); err != nil {
+			return nil, err
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE scheduled_limit_changes SET status=?, applied_at=? WHERE change_id=?`, LimitChangeApplied, now, c.ChangeID); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return d.GetAppLimitsByKidEmail(ctx, kidEmail)
+}
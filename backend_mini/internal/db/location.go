@@ -0,0 +1,309 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"math"
+	"strings"
+	"time"
+
+	"backend_mini/internal/util"
+)
+
+const (
+	DefaultLocationRetentionHours = 24
+	MaxLocationRetentionHours     = 72
+	// a report older than this no longer places the kid in a zone
+	LocationFreshness = 30 * time.Minute
+	// reports are rounded to 3 decimals (~110m) before they are stored
+	locationPrecision = 1000
+)
+
+var ErrGeofenceNotFound = errors.New("geofence not found")
+
+type LocationSettings struct {
+	ParentEmail    string `json:"parent_email"`
+	Enabled        bool   `json:"enabled"`
+	RetentionHours int    `json:"retention_hours"`
+	UpdatedAt      string `json:"updated_at,omitempty"`
+}
+
+// ZoneRule sets the daily allowance for an app while the kid is inside the
+// geofence. An empty App applies to every app; TimePerDay 0 blocks it.
+type ZoneRule struct {
+	App        string `json:"app"`
+	TimePerDay int    `json:"time_per_day"`
+}
+
+type Geofence struct {
+	GeofenceID  string     `json:"geofence_id"`
+	ParentEmail string     `json:"parent_email"`
+	Name        string     `json:"name"`
+	Lat         float64    `json:"lat"`
+	Lng         float64    `json:"lng"`
+	RadiusM     int        `json:"radius_m"`
+	Rules       []ZoneRule `json:"rules"`
+	CreatedAt   string     `json:"created_at"`
+}
+
+type LocationReport struct {
+	KidEmail   string  `json:"kid_email"`
+	DeviceID   string  `json:"device_id"`
+	Lat        float64 `json:"lat"`
+	Lng        float64 `json:"lng"`
+	ReportedAt string  `json:"reported_at"`
+}
+
+// Contains reports whether the point lies within the geofence radius.
+func (g *Geofence) Contains(lat, lng float64) bool {
+	const earthRadiusM = 6371000.0
+	rad := math.Pi / 180
+	dLat := (lat - g.Lat) * rad
+	dLng := (lng - g.Lng) * rad
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(g.Lat*rad)*math.Cos(lat*rad)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2*earthRadiusM*math.Asin(math.Sqrt(h)) <= float64(g.RadiusM)
+}
+
+func coarse(v float64) float64 {
+	return math.Round(v*locationPrecision) / locationPrecision
+}
+
+// GetLocationSettings returns the family's settings; the module is off
+// unless the parent opted in.
+func (d *DB) GetLocationSettings(ctx context.Context, parentEmail string) (*LocationSettings, error) {
+	s := LocationSettings{ParentEmail: strings.ToLower(parentEmail), RetentionHours: DefaultLocationRetentionHours}
+	var enabled int
+	err := d.queryRow(ctx, `SELECT enabled, retention_hours, updated_at FROM location_settings WHERE parent_email=?`, s.ParentEmail).
+		Scan(&enabled, &s.RetentionHours, &s.UpdatedAt)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	s.Enabled = enabled == 1
+	return &s, nil
+}
+
+// SetLocationSettings stores the toggle. Turning the module off deletes every
+// stored report for the family.
+func (d *DB) SetLocationSettings(ctx context.Context, s LocationSettings) (*LocationSettings, error) {
+	s.ParentEmail = strings.ToLower(s.ParentEmail)
+	s.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	enabled := 0
+	if s.Enabled {
+		enabled = 1
+	}
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO location_settings (parent_email, enabled, retention_hours, updated_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(parent_email) DO UPDATE SET enabled=excluded.enabled, retention_hours=excluded.retention_hours, updated_at=excluded.updated_at
+	`, s.ParentEmail, enabled, s.RetentionHours, s.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if !s.Enabled {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM location_reports WHERE parent_email=?`, s.ParentEmail); err != nil {
+			return nil, err
+		}
+	} else {
+		// shortening retention applies to reports already stored
+		cutoff := time.Now().UTC().Add(time.Duration(s.RetentionHours) * time.Hour).Format(time.RFC3339)
+		if _, err := tx.ExecContext(ctx, `UPDATE location_reports SET expires_at=? WHERE parent_email=? AND expires_at>?`, cutoff, s.ParentEmail, cutoff); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// SaveGeofence creates a geofence, or replaces it when GeofenceID is set.
+func (d *DB) SaveGeofence(ctx context.Context, g Geofence) (*Geofence, error) {
+	g.ParentEmail = strings.ToLower(g.ParentEmail)
+	if g.Rules == nil {
+		g.Rules = []ZoneRule{}
+	}
+	rules, err := json.Marshal(g.Rules)
+	if err != nil {
+		return nil, err
+	}
+	if g.GeofenceID != "" {
+		res, err := d.exec(ctx, `UPDATE geofences SET name=?, lat=?, lng=?, radius_m=?, rules=? WHERE geofence_id=? AND parent_email=?`,
+			g.Name, g.Lat, g.Lng, g.RadiusM, string(rules), g.GeofenceID, g.ParentEmail)
+		if err != nil {
+			return nil, err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return nil, ErrGeofenceNotFound
+		}
+		return d.GetGeofence(ctx, g.GeofenceID)
+	}
+	if g.GeofenceID, err = util.NewID(); err != nil {
+		return nil, err
+	}
+	g.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+	_, err = d.exec(ctx, `INSERT INTO geofences (geofence_id, parent_email, name, lat, lng, radius_m, rules, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		g.GeofenceID, g.ParentEmail, g.Name, g.Lat, g.Lng, g.RadiusM, string(rules), g.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+func (d *DB) DeleteGeofence(ctx context.Context, parentEmail, geofenceID string) error {
+	res, err := d.exec(ctx, `DELETE FROM geofences WHERE geofence_id=? AND parent_email=?`, geofenceID, strings.ToLower(parentEmail))
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrGeofenceNotFound
+	}
+	return nil
+}
+
+func scanGeofence(row rowScanner, g *Geofence) error {
+	var rules string
+	if err := row.Scan(&g.GeofenceID, &g.ParentEmail, &g.Name, &g.Lat, &g.Lng, &g.RadiusM, &rules, &g.CreatedAt); err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(rules), &g.Rules)
+}
+
+func (d *DB) GetGeofence(ctx context.Context, geofenceID string) (*Geofence, error) {
+	var g Geofence
+	err := scanGeofence(d.queryRow(ctx, `SELECT geofence_id, parent_email, name, lat, lng, radius_m, rules, created_at FROM geofences WHERE geofence_id=?`, geofenceID), &g)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrGeofenceNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+func (d *DB) ListGeofences(ctx context.Context, parentEmail string) ([]Geofence, error) {
+	rows, err := d.query(ctx, `SELECT geofence_id, parent_email, name, lat, lng, radius_m, rules, created_at FROM geofences WHERE parent_email=? ORDER BY created_at, geofence_id`, strings.ToLower(parentEmail))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []Geofence{}
+	for rows.Next() {
+		var g Geofence
+		if err := scanGeofence(rows, &g); err != nil {
+			return nil, err
+		}
+		out = append(out, g)
+	}
+	return out, rows.Err()
+}
+
+// AddLocationReport stores a coarse location that expires after the
+// family's retention window. Expired reports are purged on the way. A
+// non-zero seq must be higher than any the device sent before, since an
+// older position is no use once a newer one is in; otherwise the report
+// is dropped with ErrSeqDuplicate or ErrSeqStale.
+func (d *DB) AddLocationReport(ctx context.Context, dev *Device, lat, lng float64, seq uint64, retentionHours int) (*LocationReport, error) {
+	now := time.Now().UTC()
+	rep := LocationReport{KidEmail: dev.KidEmail, DeviceID: dev.DeviceID, Lat: coarse(lat), Lng: coarse(lng), ReportedAt: now.Format(time.RFC3339)}
+	if _, err := d.PurgeLocationReports(ctx, now); err != nil {
+		return nil, err
+	}
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+	if seq != 0 {
+		outcome, err := checkSeq(ctx, tx, dev.DeviceID, SeqStreamLocation, seq, true)
+		if err != nil {
+			return nil, err
+		}
+		if outcome != SeqAccepted {
+			// keep the count of what was dropped
+			if err := tx.Commit(); err != nil {
+				return nil, err
+			}
+			if outcome == SeqDuplicate {
+				return nil, ErrSeqDuplicate
+			}
+			return nil, ErrSeqStale
+		}
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO location_reports (kid_email, parent_email, device_id, lat, lng, reported_at, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		rep.KidEmail, dev.ParentEmail, rep.DeviceID, rep.Lat, rep.Lng, rep.ReportedAt, now.Add(time.Duration(retentionHours)*time.Hour).Format(time.RFC3339))
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &rep, nil
+}
+
+// LatestLocation returns the kid's newest report if it is still fresh.
+func (d *DB) LatestLocation(ctx context.Context, kidEmail string, now time.Time) (*LocationReport, bool, error) {
+	var rep LocationReport
+	err := d.queryRow(ctx, `SELECT kid_email, device_id, lat, lng, reported_at FROM location_reports WHERE kid_email=? AND reported_at>? AND expires_at>? ORDER BY seq DESC LIMIT 1`,
+		strings.ToLower(kidEmail), now.UTC().Add(-LocationFreshness).Format(time.RFC3339), now.UTC().Format(time.RFC3339)).
+		Scan(&rep.KidEmail, &rep.DeviceID, &rep.Lat, &rep.Lng, &rep.ReportedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return &rep, true, nil
+}
+
+func (d *DB) PurgeLocationReports(ctx context.Context, now time.Time) (int64, error) {
+	res, err := d.exec(ctx, `DELETE FROM location_reports WHERE expires_at<=?`, now.UTC().Format(time.RFC3339))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// ZoneAt returns the first of the geofences containing the point.
+func ZoneAt(fences []Geofence, lat, lng float64) *Geofence {
+	for i := range fences {
+		if fences[i].Contains(lat, lng) {
+			return &fences[i]
+		}
+	}
+	return nil
+}
+
+// ApplyZoneRules sets the zone allowance on each limit the geofence has a
+// rule for. An app-specific rule wins over the catch-all one.
+func ApplyZoneRules(limits []AppLimit, g *Geofence) []AppLimit {
+	if g == nil {
+		return limits
+	}
+	out := make([]AppLimit, len(limits))
+	for i, l := range limits {
+		var rule *ZoneRule
+		for j := range g.Rules {
+			r := &g.Rules[j]
+			if r.App == l.App {
+				rule = r
+				break
+			}
+			if r.App == "" && rule == nil {
+				rule = r
+			}
+		}
+		if rule != nil {
+			minutes := rule.TimePerDay
+			l.Zone = g.Name
+			l.ZoneTimePerDay = &minutes
+		}
+		out[i] = l
+	}
+	return out
+}
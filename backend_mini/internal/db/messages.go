@@ -0,0 +1,152 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"backend_mini/internal/util"
+)
+
+type MessageThread struct {
+	ThreadID    string `json:"thread_id"`
+	ParentEmail string `json:"parent_email"`
+	KidEmail    string `json:"kid_email"`
+	ChoreID     string `json:"chore_id"`
+	Title       string `json:"title"`
+	CreatedAt   string `json:"created_at"`
+}
+
+// Message payloads are HPKE-sealed on the client; the server only ever
+// sees ciphertext and the encapsulated key.
+type Message struct {
+	Seq             int64  `json:"seq"`
+	MessageID       string `json:"message_id"`
+	ThreadID        string `json:"thread_id"`
+	SenderEmail     string `json:"sender_email"`
+	Ciphertext      string `json:"ciphertext"`
+	EncapsulatedKey string `json:"encapsulated_key"`
+	CreatedAt       string `json:"created_at"`
+	DeliveredAt     string `json:"delivered_at"`
+	ReadAt          string `json:"read_at"`
+}
+
+func (t *MessageThread) HasMember(email string) bool {
+	return strings.EqualFold(t.ParentEmail, email) || strings.EqualFold(t.KidEmail, email)
+}
+
+// CreateThread creates a thread between a parent and kid. Threads tied to a
+// chore are unique per chore, so a second call, even a concurrent one,
+// returns the existing one.
+func (d *DB) CreateThread(ctx context.Context, parentEmail, kidEmail, choreID, title string) (*MessageThread, error) {
+	id, err := util.NewID()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	t := MessageThread{ThreadID: id, ParentEmail: strings.ToLower(parentEmail), KidEmail: strings.ToLower(kidEmail), ChoreID: choreID, Title: title, CreatedAt: now}
+	res, err := d.exec(ctx, `INSERT INTO message_threads (thread_id, parent_email, kid_email, chore_id, title, created_at) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(chore_id) WHERE chore_id <> '' DO NOTHING`,
+		t.ThreadID, t.ParentEmail, t.KidEmail, t.ChoreID, t.Title, t.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if n == 1 {
+		return &t, nil
+	}
+	// another call created the chore's thread first
+	row := d.queryRow(ctx, `SELECT thread_id, parent_email, kid_email, chore_id, title, created_at FROM message_threads WHERE chore_id=?`, choreID)
+	if err := row.Scan(&t.ThreadID, &t.ParentEmail, &t.KidEmail, &t.ChoreID, &t.Title, &t.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (d *DB) GetThread(ctx context.Context, threadID string) (*MessageThread, bool, error) {
+	row := d.queryRow(ctx, `SELECT thread_id, parent_email, kid_email, chore_id, title, created_at FROM message_threads WHERE thread_id=?`, threadID)
+	var t MessageThread
+	if err := row.Scan(&t.ThreadID, &t.ParentEmail, &t.KidEmail, &t.ChoreID, &t.Title, &t.CreatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	return &t, true, nil
+}
+
+func (d *DB) AddMessage(ctx context.Context, threadID, senderEmail, ciphertext, encapsulatedKey string) (*Message, error) {
+	id, err := util.NewID()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	res, err := d.exec(ctx, `INSERT INTO messages (message_id, thread_id, sender_email, ciphertext, encapsulated_key, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		id, threadID, strings.ToLower(senderEmail), ciphertext, encapsulatedKey, now)
+	if err != nil {
+		return nil, err
+	}
+	seq, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return &Message{Seq: seq, MessageID: id, ThreadID: threadID, SenderEmail: strings.ToLower(senderEmail), Ciphertext: ciphertext, EncapsulatedKey: encapsulatedKey, CreatedAt: now}, nil
+}
+
+// ListMessages returns up to limit messages with seq > after, oldest first,
+// and stamps delivered_at on the ones addressed to the reader.
+func (d *DB) ListMessages(ctx context.Context, threadID, readerEmail string, after int64, limit int) ([]Message, bool, error) {
+	now := time.Now().UTC().Format(time.RFC3339)
+	if _, err := d.exec(ctx, `
+		UPDATE messages SET delivered_at=?
+		WHERE seq IN (SELECT seq FROM messages WHERE thread_id=? AND seq>? ORDER BY seq LIMIT ?)
+		AND sender_email<>? AND delivered_at=''
+	`, now, threadID, after, limit, strings.ToLower(readerEmail)); err != nil {
+		return nil, false, err
+	}
+
+	// read on the writer so the delivered_at stamps above are visible
+	rows, err := d.SQL.QueryContext(ctx, `
+		SELECT seq, message_id, thread_id, sender_email, ciphertext, encapsulated_key, created_at, delivered_at, read_at
+		FROM messages WHERE thread_id=? AND seq>? ORDER BY seq LIMIT ?
+	`, threadID, after, limit+1)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	msgs := []Message{}
+	for rows.Next() {
+		var m Message
+		if err := rows.Scan(&m.Seq, &m.MessageID, &m.ThreadID, &m.SenderEmail, &m.Ciphertext, &m.EncapsulatedKey, &m.CreatedAt, &m.DeliveredAt, &m.ReadAt); err != nil {
+			return nil, false, err
+		}
+		msgs = append(msgs, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+	hasMore := len(msgs) > limit
+	if hasMore {
+		msgs = msgs[:limit]
+	}
+	return msgs, hasMore, nil
+}
+
+// MarkRead stamps read_at on every message up to seq not sent by the reader.
+func (d *DB) MarkRead(ctx context.Context, threadID, readerEmail string, upToSeq int64) (int64, error) {
+	now := time.Now().UTC().Format(time.RFC3339)
+	res, err := d.exec(ctx, `
+		UPDATE messages SET read_at=?, delivered_at=CASE WHEN delivered_at='' THEN ? ELSE delivered_at END
+		WHERE thread_id=? AND seq<=? AND sender_email<>? AND read_at=''
+	`, now, now, threadID, upToSeq, strings.ToLower(readerEmail))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
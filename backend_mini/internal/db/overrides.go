@@ -0,0 +1,132 @@
+package db
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"backend_mini/internal/util"
+)
+
+const (
+	OverrideLock      = "lock"
+	OverrideExtraTime = "extra_time"
+)
+
+// LimitOverride is a temporary adjustment layered over stored app_limits.
+// An empty App applies to every app of the kid.
+type LimitOverride struct {
+	OverrideID  string `json:"override_id"`
+	ParentEmail string `json:"parent_email"`
+	KidEmail    string `json:"kid_email"`
+	Kind        string `json:"kind"`
+	App         string `json:"app"`
+	Minutes     int    `json:"minutes"`
+	StartsAt    string `json:"starts_at"`
+	ExpiresAt   string `json:"expires_at"`
+	IssuedBy    string `json:"issued_by"`
+	CreatedAt   string `json:"created_at"`
+}
+
+func (o *LimitOverride) appliesTo(app string) bool {
+	return o.App == "" || o.App == app
+}
+
+func (d *DB) CreateLimitOverride(ctx context.Context, o LimitOverride) (*LimitOverride, error) {
+	id, err := util.NewID()
+	if err != nil {
+		return nil, err
+	}
+	o.OverrideID = id
+	o.ParentEmail = strings.ToLower(o.ParentEmail)
+	o.KidEmail = strings.ToLower(o.KidEmail)
+	o.IssuedBy = strings.ToLower(o.IssuedBy)
+	o.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+	_, err = d.exec(ctx, `
+		INSERT INTO limit_overrides (override_id, parent_email, kid_email, kind, app, minutes, starts_at, expires_at, issued_by, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, o.OverrideID, o.ParentEmail, o.KidEmail, o.Kind, o.App, o.Minutes, o.StartsAt, o.ExpiresAt, o.IssuedBy, o.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+// ClearLimitOverride expires an override immediately.
+func (d *DB) ClearLimitOverride(ctx context.Context, overrideID string) (bool, error) {
+	res, err := d.exec(ctx, `UPDATE limit_overrides SET expires_at=? WHERE override_id=? AND expires_at>?`,
+		time.Now().UTC().Format(time.RFC3339), overrideID, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// GetActiveOverrides returns overrides for a kid that are in effect at now.
+func (d *DB) GetActiveOverrides(ctx context.Context, kidEmail string, now time.Time) ([]LimitOverride, error) {
+	ts := now.UTC().Format(time.RFC3339)
+	rows, err := d.query(ctx, `
+		SELECT override_id, parent_email, kid_email, kind, app, minutes, starts_at, expires_at, issued_by, created_at
+		FROM limit_overrides WHERE kid_email=? AND starts_at<=? AND expires_at>? ORDER BY created_at
+	`, strings.ToLower(kidEmail), ts, ts)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []LimitOverride{}
+	for rows.Next() {
+		var o LimitOverride
+		if err := rows.Scan(&o.OverrideID, &o.ParentEmail, &o.KidEmail, &o.Kind, &o.App, &o.Minutes, &o.StartsAt, &o.ExpiresAt, &o.IssuedBy, &o.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, o)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ResolveEffectiveLimits applies active overrides on top of the base
+// allowance: the zone allowance if ApplyZoneRules set one, else the schedule
+// allowance from ApplyScheduleRules, else the stored limit. A lock forces the
+// app to 0 minutes until it expires, extra_time adds minutes to the daily
+// allowance. Locks win over extra time.
+func ResolveEffectiveLimits(limits []AppLimit, overrides []LimitOverride) []AppLimit {
+	out := make([]AppLimit, len(limits))
+	for i, l := range limits {
+		effective := l.TimePerDay
+		switch {
+		case l.ZoneTimePerDay != nil:
+			effective = *l.ZoneTimePerDay
+		case l.ScheduleTimePerDay != nil:
+			effective = *l.ScheduleTimePerDay
+		}
+		var applied []string
+		locked := ""
+		for _, o := range overrides {
+			if !o.appliesTo(l.App) {
+				continue
+			}
+			switch o.Kind {
+			case OverrideLock:
+				if o.ExpiresAt > locked {
+					locked = o.ExpiresAt
+				}
+			case OverrideExtraTime:
+				effective += o.Minutes
+			}
+			applied = append(applied, o.OverrideID)
+		}
+		if locked != "" {
+			effective = 0
+		}
+		l.EffectiveTimePerDay = &effective
+		l.LockedUntil = locked
+		l.AppliedOverrides = applied
+		out[i] = l
+	}
+	return out
+}
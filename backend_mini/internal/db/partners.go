@@ -0,0 +1,186 @@
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"backend_mini/internal/util"
+)
+
+// PartnerKeyPrefix marks partner API keys, like TokenPrefix does for
+// personal access tokens.
+const PartnerKeyPrefix = "sona_partner_"
+
+var ErrPartnerNotFound = errors.New("partner not found")
+
+// Partner is a researcher or partner organisation allowed to read
+// aggregate statistics. Only its key's SHA-256 is stored.
+type Partner struct {
+	PartnerID  string `json:"partner_id"`
+	Name       string `json:"name"`
+	CreatedAt  string `json:"created_at"`
+	LastUsedAt string `json:"last_used_at,omitempty"`
+	RevokedAt  string `json:"revoked_at,omitempty"`
+}
+
+const partnerColumns = `partner_id, name, created_at, last_used_at, revoked_at`
+
+func scanPartner(row rowScanner, p *Partner) error {
+	return row.Scan(&p.PartnerID, &p.Name, &p.CreatedAt, &p.LastUsedAt, &p.RevokedAt)
+}
+
+// CreatePartner issues a partner key and returns it with its raw value.
+func (d *DB) CreatePartner(ctx context.Context, name, createdBy string) (*Partner, string, error) {
+	id, err := util.NewID()
+	if err != nil {
+		return nil, "", err
+	}
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", err
+	}
+	raw := PartnerKeyPrefix + strings.ToLower(id) + "_" + hex.EncodeToString(secret)
+	p := Partner{PartnerID: id, Name: name, CreatedAt: time.Now().UTC().Format(time.RFC3339)}
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	defer func() { _ = tx.Rollback() }()
+	if _, err := tx.ExecContext(ctx, `INSERT INTO partners (partner_id, name, key_hash, created_at) VALUES (?, ?, ?, ?)`,
+		p.PartnerID, p.Name, hashToken(raw), p.CreatedAt); err != nil {
+		return nil, "", err
+	}
+	if err := writeAudit(ctx, tx, createdBy, "partner.create", p.PartnerID, p.Name); err != nil {
+		return nil, "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, "", err
+	}
+	return &p, raw, nil
+}
+
+func (d *DB) ListPartners(ctx context.Context) ([]Partner, error) {
+	rows, err := d.query(ctx, `SELECT `+partnerColumns+` FROM partners ORDER BY created_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []Partner{}
+	for rows.Next() {
+		var p Partner
+		if err := scanPartner(rows, &p); err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+func (d *DB) RevokePartner(ctx context.Context, partnerID, revokedBy string) error {
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	res, err := tx.ExecContext(ctx, `UPDATE partners SET revoked_at=? WHERE partner_id=? AND revoked_at=''`,
+		time.Now().UTC().Format(time.RFC3339), partnerID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrPartnerNotFound
+	}
+	if err := writeAudit(ctx, tx, revokedBy, "partner.revoke", partnerID, ""); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// LookupPartner resolves a raw partner key that has not been revoked.
+func (d *DB) LookupPartner(ctx context.Context, raw string) (*Partner, error) {
+	var p Partner
+	err := scanPartner(d.queryRow(ctx, `SELECT `+partnerColumns+` FROM partners WHERE key_hash=? AND revoked_at=''`, hashToken(raw)), &p)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrPartnerNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (d *DB) TouchPartner(ctx context.Context, partnerID string) error {
+	_, err := d.exec(ctx, `UPDATE partners SET last_used_at=? WHERE partner_id=?`, time.Now().UTC().Format(time.RFC3339), partnerID)
+	return err
+}
+
+// SharedKidStats is one kid's raw figures from a family that consented to
+// the given terms version. It never leaves the server as is; the handlers
+// aggregate it into bands first.
+type SharedKidStats struct {
+	FamilyID     string
+	BirthYear    int
+	Chores       int
+	Approved     int
+	Minutes      int
+	DaysReported int
+}
+
+// SharedKidStatistics returns stats for every kid of a family whose data
+// sharing consent names termsVersion, with screen time from usage reports
+// on or after since (YYYY-MM-DD). The stats come from the analytics
+// snapshot, but consent is checked against the live database so a
+// withdrawal takes effect at once.
+func (d *DB) SharedKidStatistics(ctx context.Context, termsVersion, since string) ([]SharedKidStats, error) {
+	consenting := map[string]bool{}
+	rows, err := d.query(ctx, `SELECT p.id FROM parents p JOIN family_settings s ON s.parent_email=p.email WHERE s.data_sharing_consent=?`, termsVersion)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		consenting[id] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = d.analytics().QueryContext(ctx, `
+		SELECT c.parent_id, c.birth_year,
+			(SELECT COUNT(*) FROM chores ch WHERE c.wallet<>'' AND ch.child_wallet=c.wallet AND ch.kind=?),
+			(SELECT COUNT(*) FROM chores ch WHERE c.wallet<>'' AND ch.child_wallet=c.wallet AND ch.kind=? AND ch.chore_status=3),
+			(SELECT COALESCE(SUM(u.minutes), 0) FROM usage_reports u WHERE u.kid_email=lower(c.email) AND u.day>=?),
+			(SELECT COUNT(DISTINCT u.day) FROM usage_reports u WHERE u.kid_email=lower(c.email) AND u.day>=?)
+		FROM children c
+		JOIN parents p ON p.id=c.parent_id
+		JOIN family_settings s ON s.parent_email=p.email
+		WHERE s.data_sharing_consent=?`,
+		ChoreKindChore, ChoreKindChore, since, since, termsVersion)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []SharedKidStats{}
+	for rows.Next() {
+		var s SharedKidStats
+		if err := rows.Scan(&s.FamilyID, &s.BirthYear, &s.Chores, &s.Approved, &s.Minutes, &s.DaysReported); err != nil {
+			return nil, err
+		}
+		if consenting[s.FamilyID] {
+			out = append(out, s)
+		}
+	}
+	return out, rows.Err()
+}
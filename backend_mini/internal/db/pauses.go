@@ -0,0 +1,128 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"backend_mini/internal/util"
+)
+
+var ErrPauseNotFound = errors.New("pause not found")
+
+// Pause is a vacation or deactivation window for one kid, or for the whole
+// family when KidEmail is empty. While it runs, limits are not enforced,
+// chores are not auto-approved, balance alerts are not checked and events
+// are stored without being delivered; it lifts by itself at EndsAt.
+type Pause struct {
+	PauseID     string `json:"pause_id"`
+	ParentEmail string `json:"parent_email"`
+	KidEmail    string `json:"kid_email,omitempty"`
+	StartsAt    string `json:"starts_at"`
+	EndsAt      string `json:"ends_at"`
+	Reason      string `json:"reason,omitempty"`
+	CreatedAt   string `json:"created_at"`
+}
+
+const pauseColumns = `pause_id, parent_email, kid_email, starts_at, ends_at, reason, created_at`
+
+func scanPause(row rowScanner, p *Pause) error {
+	return row.Scan(&p.PauseID, &p.ParentEmail, &p.KidEmail, &p.StartsAt, &p.EndsAt, &p.Reason, &p.CreatedAt)
+}
+
+// pausedUntilQuery finds when the pauses running at the time bound twice
+// that cover the parent's family, or the kid bound after the parent, end.
+const pausedUntilQuery = `SELECT COALESCE(MAX(ends_at), '') FROM pauses WHERE parent_email=? AND kid_email IN ('', ?) AND starts_at<=? AND ends_at>?`
+
+func (d *DB) CreatePause(ctx context.Context, p Pause) (*Pause, error) {
+	id, err := util.NewID()
+	if err != nil {
+		return nil, err
+	}
+	p.PauseID = id
+	p.ParentEmail = strings.ToLower(p.ParentEmail)
+	p.KidEmail = strings.ToLower(p.KidEmail)
+	p.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+	if _, err := tx.ExecContext(ctx, `INSERT INTO pauses (`+pauseColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		p.PauseID, p.ParentEmail, p.KidEmail, p.StartsAt, p.EndsAt, p.Reason, p.CreatedAt); err != nil {
+		return nil, err
+	}
+	subject := p.KidEmail
+	if subject == "" {
+		subject = p.ParentEmail
+	}
+	if err := writeAudit(ctx, tx, p.ParentEmail, "pause.create", subject, p.StartsAt+" - "+p.EndsAt); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// ListPauses returns the family's pauses that have not ended by now,
+// soonest first, or all of them newest first when includeEnded is set.
+func (d *DB) ListPauses(ctx context.Context, parentEmail string, includeEnded bool, now time.Time) ([]Pause, error) {
+	order, after := "starts_at", now.UTC().Format(time.RFC3339)
+	if includeEnded {
+		order, after = "starts_at DESC", ""
+	}
+	rows, err := d.query(ctx, `SELECT `+pauseColumns+` FROM pauses WHERE parent_email=? AND ends_at>? ORDER BY `+order, strings.ToLower(parentEmail), after)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []Pause{}
+	for rows.Next() {
+		var p Pause
+		if err := scanPause(rows, &p); err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
+
+// EndPause resumes early: a running pause ends now, and one that has not
+// started yet never will.
+func (d *DB) EndPause(ctx context.Context, parentEmail, pauseID string, now time.Time) (*Pause, error) {
+	parentEmail = strings.ToLower(parentEmail)
+	ts := now.UTC().Format(time.RFC3339)
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+	res, err := tx.ExecContext(ctx, `UPDATE pauses SET ends_at=MAX(starts_at, ?) WHERE pause_id=? AND parent_email=? AND ends_at>?`, ts, pauseID, parentEmail, ts)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, ErrPauseNotFound
+	}
+	var p Pause
+	if err := scanPause(tx.QueryRowContext(ctx, `SELECT `+pauseColumns+` FROM pauses WHERE pause_id=?`, pauseID), &p); err != nil {
+		return nil, err
+	}
+	if err := writeAudit(ctx, tx, parentEmail, "pause.end", parentEmail, pauseID); err != nil {
+		return nil, err
+	}
+	return &p, tx.Commit()
+}
+
+// PausedUntil returns when the latest pause covering the kid (or, with an
+// empty kidEmail, the whole family) that is running at now ends, or ""
+// when nothing is paused.
+func (d *DB) PausedUntil(ctx context.Context, parentEmail, kidEmail string, now time.Time) (string, error) {
+	ts := now.UTC().Format(time.RFC3339)
+	var until string
+	err := d.queryRow(ctx, pausedUntilQuery, strings.ToLower(parentEmail), strings.ToLower(kidEmail), ts, ts).Scan(&until)
+	return until, err
+}
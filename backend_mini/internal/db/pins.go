@@ -0,0 +1,153 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PINCheck is the outcome of checking a kid's PIN. Required is false when
+// the kid has no PIN, in which case nothing was checked.
+type PINCheck struct {
+	Required          bool   `json:"required"`
+	OK                bool   `json:"ok"`
+	AttemptsRemaining int    `json:"attempts_remaining,omitempty"`
+	LockedUntil       string `json:"locked_until,omitempty"`
+}
+
+// SetKidPIN stores a bcrypt hash of pin for the kid, replacing any earlier
+// PIN and lifting a lockout.
+func (d *DB) SetKidPIN(ctx context.Context, kidEmail, pin, setBy string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(pin), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `INSERT INTO kid_pins (kid_email, pin_hash, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT(kid_email) DO UPDATE SET pin_hash=excluded.pin_hash, failed_attempts=0, locked_until='', updated_at=excluded.updated_at`,
+		strings.ToLower(kidEmail), string(hash), time.Now().UTC().Format(time.RFC3339)); err != nil {
+		return err
+	}
+	if err := writeAudit(ctx, tx, setBy, "kid_pin.set", kidEmail, ""); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ClearKidPIN removes the kid's PIN, so spending no longer asks for one.
+func (d *DB) ClearKidPIN(ctx context.Context, kidEmail, clearedBy string) error {
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `DELETE FROM kid_pins WHERE kid_email=?`, strings.ToLower(kidEmail)); err != nil {
+		return err
+	}
+	if err := writeAudit(ctx, tx, clearedBy, "kid_pin.clear", kidEmail, ""); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// CheckKidPIN compares pin with the kid's PIN. maxAttempts wrong PINs in a
+// row lock it for lockout, during which every attempt fails unchecked. An
+// empty pin fails without counting as an attempt.
+//
+// bcrypt runs with no transaction open, so a PIN check never holds the one
+// writer connection for its cost. The outcome is then recorded in a short
+// transaction that reads the attempt state again: a lockout another attempt
+// set in the meantime still applies, and a PIN changed in the meantime is
+// checked again.
+func (d *DB) CheckKidPIN(ctx context.Context, kidEmail, pin string, maxAttempts int, lockout time.Duration) (PINCheck, error) {
+	kidEmail = strings.ToLower(kidEmail)
+	for {
+		var hash, lockedUntil string
+		var failed int
+		err := d.queryRow(ctx, `SELECT pin_hash, failed_attempts, locked_until FROM kid_pins WHERE kid_email=?`, kidEmail).Scan(&hash, &failed, &lockedUntil)
+		if errors.Is(err, sql.ErrNoRows) {
+			return PINCheck{}, nil
+		}
+		if err != nil {
+			return PINCheck{}, err
+		}
+		if pinLocked(lockedUntil) {
+			return PINCheck{Required: true, LockedUntil: lockedUntil}, nil
+		}
+		if pin == "" {
+			return PINCheck{Required: true}, nil
+		}
+		ok := bcrypt.CompareHashAndPassword([]byte(hash), []byte(pin)) == nil
+
+		check, checked, err := d.recordPINAttempt(ctx, kidEmail, hash, ok, maxAttempts, lockout)
+		if err != nil || checked {
+			return check, err
+		}
+	}
+}
+
+func pinLocked(lockedUntil string) bool {
+	return lockedUntil != "" && lockedUntil > time.Now().UTC().Format(time.RFC3339)
+}
+
+// recordPINAttempt records the outcome of comparing pin with hash. checked
+// is false when the kid's PIN is no longer hash, so the comparison says
+// nothing and has to be made again.
+func (d *DB) recordPINAttempt(ctx context.Context, kidEmail, hash string, ok bool, maxAttempts int, lockout time.Duration) (PINCheck, bool, error) {
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return PINCheck{}, false, err
+	}
+	defer tx.Rollback()
+
+	var current, lockedUntil string
+	var failed int
+	err = tx.QueryRowContext(ctx, `SELECT pin_hash, failed_attempts, locked_until FROM kid_pins WHERE kid_email=?`, kidEmail).Scan(&current, &failed, &lockedUntil)
+	if errors.Is(err, sql.ErrNoRows) {
+		// the PIN was cleared while it was being checked
+		return PINCheck{}, true, nil
+	}
+	if err != nil {
+		return PINCheck{}, false, err
+	}
+	if current != hash {
+		return PINCheck{}, false, nil
+	}
+	if pinLocked(lockedUntil) {
+		return PINCheck{Required: true, LockedUntil: lockedUntil}, true, nil
+	}
+	if ok {
+		if _, err := tx.ExecContext(ctx, `UPDATE kid_pins SET failed_attempts=0, locked_until='' WHERE kid_email=?`, kidEmail); err != nil {
+			return PINCheck{}, false, err
+		}
+		return PINCheck{Required: true, OK: true}, true, tx.Commit()
+	}
+
+	check := PINCheck{Required: true}
+	failed++
+	if failed >= maxAttempts {
+		check.LockedUntil = time.Now().UTC().Add(lockout).Format(time.RFC3339)
+		failed = 0
+		if err := writeAudit(ctx, tx, kidEmail, "kid_pin.locked", kidEmail, "until "+check.LockedUntil); err != nil {
+			return PINCheck{}, false, err
+		}
+	} else {
+		check.AttemptsRemaining = maxAttempts - failed
+		if err := writeAudit(ctx, tx, kidEmail, "kid_pin.failed", kidEmail, strconv.Itoa(check.AttemptsRemaining)+" attempts left"); err != nil {
+			return PINCheck{}, false, err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE kid_pins SET failed_attempts=?, locked_until=? WHERE kid_email=?`, failed, check.LockedUntil, kidEmail); err != nil {
+		return PINCheck{}, false, err
+	}
+	return check, true, tx.Commit()
+}
@@ -0,0 +1,101 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend_mini/internal/policy"
+)
+
+// PolicyVersion is one saved revision of a family's policy document.
+// Versions are never edited; every save appends the next one.
+type PolicyVersion struct {
+	ParentEmail string          `json:"parent_email"`
+	Version     int             `json:"version"`
+	Document    policy.Document `json:"policy"`
+	CreatedBy   string          `json:"created_by"`
+	CreatedAt   string          `json:"created_at"`
+}
+
+// SavePolicy stores doc as the family's next policy version.
+func (d *DB) SavePolicy(ctx context.Context, parentEmail, createdBy string, doc policy.Document) (*PolicyVersion, error) {
+	parentEmail = strings.ToLower(parentEmail)
+	buf, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var version int
+	if err := tx.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) + 1 FROM family_policies WHERE parent_email=?`, parentEmail).Scan(&version); err != nil {
+		return nil, err
+	}
+	pv := &PolicyVersion{ParentEmail: parentEmail, Version: version, Document: doc, CreatedBy: strings.ToLower(createdBy), CreatedAt: time.Now().UTC().Format(time.RFC3339)}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO family_policies (parent_email, version, document, created_by, created_at) VALUES (?, ?, ?, ?, ?)`,
+		pv.ParentEmail, pv.Version, string(buf), pv.CreatedBy, pv.CreatedAt); err != nil {
+		return nil, err
+	}
+	if err := writeAudit(ctx, tx, createdBy, "policy.set", parentEmail, "version "+strconv.Itoa(version)); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return pv, nil
+}
+
+// GetPolicy returns the given version, or the latest one when version is 0.
+func (d *DB) GetPolicy(ctx context.Context, parentEmail string, version int) (*PolicyVersion, bool, error) {
+	q := `SELECT parent_email, version, document, created_by, created_at FROM family_policies WHERE parent_email=?`
+	args := []any{strings.ToLower(parentEmail)}
+	if version > 0 {
+		q += ` AND version=?`
+		args = append(args, version)
+	}
+	q += ` ORDER BY version DESC LIMIT 1`
+	var pv PolicyVersion
+	err := scanPolicy(d.queryRow(ctx, q, args...), &pv)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return &pv, true, nil
+}
+
+// ListPolicyVersions returns the family's policy history, newest first.
+func (d *DB) ListPolicyVersions(ctx context.Context, parentEmail string) ([]PolicyVersion, error) {
+	rows, err := d.query(ctx, `SELECT parent_email, version, document, created_by, created_at FROM family_policies WHERE parent_email=? ORDER BY version DESC`, strings.ToLower(parentEmail))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []PolicyVersion{}
+	for rows.Next() {
+		var pv PolicyVersion
+		if err := scanPolicy(rows, &pv); err != nil {
+			return nil, err
+		}
+		out = append(out, pv)
+	}
+	return out, rows.Err()
+}
+
+func scanPolicy(row rowScanner, pv *PolicyVersion) error {
+	var doc string
+	if err := row.Scan(&pv.ParentEmail, &pv.Version, &doc, &pv.CreatedBy, &pv.CreatedAt); err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(doc), &pv.Document)
+}
@@ -0,0 +1,148 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Quota resources, each capped per family.
+const (
+	QuotaKids       = "kids"
+	QuotaOpenChores = "open_chores"
+	QuotaLimits     = "limits"
+	QuotaWebhooks   = "webhooks"
+)
+
+var QuotaResources = []string{QuotaKids, QuotaOpenChores, QuotaLimits, QuotaWebhooks}
+
+// Quotas maps a resource to the most a family may have. A missing or zero
+// entry means no cap.
+type Quotas map[string]int
+
+// QuotaError is returned when creating something would take a family past
+// its quota.
+type QuotaError struct {
+	Resource string `json:"resource"`
+	Limit    int    `json:"limit"`
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("quota exceeded: a family may have at most %d %s", e.Limit, strings.ReplaceAll(e.Resource, "_", " "))
+}
+
+// QuotaUsage is one resource of a family's quota as admins see it.
+type QuotaUsage struct {
+	Resource string `json:"resource"`
+	Used     int    `json:"used"`
+	// Limit is the cap in force; zero means none.
+	Limit    int  `json:"limit"`
+	Override bool `json:"override"`
+}
+
+// SetQuotas sets the default per-family quotas. Call it before serving.
+func (d *DB) SetQuotas(q Quotas) { d.quotas = q }
+
+// SetPremiumQuotas sets the quotas of premium families where they differ
+// from the defaults. Call it before serving.
+func (d *DB) SetPremiumQuotas(q Quotas) { d.premiumQuotas = q }
+
+// quotaCounts count a family's current use of each resource by parent email.
+var quotaCounts = map[string]string{
+	QuotaKids:       `SELECT COUNT(*) FROM children c JOIN parents p ON p.id=c.parent_id WHERE p.email=?`,
+	QuotaOpenChores: `SELECT COUNT(*) FROM chores c JOIN parents p ON p.wallet<>'' AND p.wallet=c.parent_wallet WHERE p.email=? AND c.chore_status<3`,
+	QuotaLimits:     `SELECT COUNT(*) FROM app_limits WHERE parent_email=?`,
+	QuotaWebhooks:   `SELECT COUNT(*) FROM webhooks WHERE parent_email=?`,
+}
+
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// quotaLimit is the family's cap on resource, its override if an admin
+// set one, and whether it is an override. Premium families get the
+// premium quota where there is one.
+func (d *DB) quotaLimit(ctx context.Context, q queryRower, parentEmail, resource string) (int, bool, error) {
+	var max int
+	err := q.QueryRowContext(ctx, `SELECT max FROM quota_overrides WHERE parent_email=? AND resource=?`, strings.ToLower(parentEmail), resource).Scan(&max)
+	if !errors.Is(err, sql.ErrNoRows) {
+		return max, err == nil, err
+	}
+	if premium, ok := d.premiumQuotas[resource]; ok {
+		entitled, err := d.isPremium(ctx, q, parentEmail, time.Now())
+		if err != nil {
+			return 0, false, err
+		}
+		if entitled {
+			return premium, false, nil
+		}
+	}
+	return d.quotas[resource], false, nil
+}
+
+// checkQuota fails with a QuotaError when the family already has as many
+// of resource as it may. Run it in the transaction that adds one more, so
+// the single writer connection keeps the count and the insert together.
+func (d *DB) checkQuota(ctx context.Context, tx *sql.Tx, parentEmail, resource string) error {
+	parentEmail = strings.ToLower(parentEmail)
+	limit, _, err := d.quotaLimit(ctx, tx, parentEmail, resource)
+	if err != nil || limit <= 0 {
+		return err
+	}
+	var used int
+	if err := tx.QueryRowContext(ctx, quotaCounts[resource], parentEmail).Scan(&used); err != nil {
+		return err
+	}
+	if used >= limit {
+		return &QuotaError{Resource: resource, Limit: limit}
+	}
+	return nil
+}
+
+// FamilyQuotas reports the family's use of every resource against its caps.
+func (d *DB) FamilyQuotas(ctx context.Context, parentEmail string) ([]QuotaUsage, error) {
+	parentEmail = strings.ToLower(parentEmail)
+	out := []QuotaUsage{}
+	for _, res := range QuotaResources {
+		u := QuotaUsage{Resource: res}
+		var err error
+		if u.Limit, u.Override, err = d.quotaLimit(ctx, d.Read, parentEmail, res); err != nil {
+			return nil, err
+		}
+		if err := d.queryRow(ctx, quotaCounts[res], parentEmail).Scan(&u.Used); err != nil {
+			return nil, err
+		}
+		out = append(out, u)
+	}
+	return out, nil
+}
+
+// SetQuotaOverride gives the family its own cap on resource; zero lifts
+// the cap. clear removes the override so the default applies again.
+func (d *DB) SetQuotaOverride(ctx context.Context, parentEmail, resource string, max int, clear bool, setBy string) error {
+	parentEmail = strings.ToLower(parentEmail)
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	detail := fmt.Sprintf("%s=%d", resource, max)
+	if clear {
+		_, err = tx.ExecContext(ctx, `DELETE FROM quota_overrides WHERE parent_email=? AND resource=?`, parentEmail, resource)
+		detail = resource + " cleared"
+	} else {
+		_, err = tx.ExecContext(ctx, `INSERT INTO quota_overrides (parent_email, resource, max, set_by, updated_at) VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT(parent_email, resource) DO UPDATE SET max=excluded.max, set_by=excluded.set_by, updated_at=excluded.updated_at`,
+			parentEmail, resource, max, setBy, time.Now().UTC().Format(time.RFC3339))
+	}
+	if err != nil {
+		return err
+	}
+	if err := writeAudit(ctx, tx, setBy, "quota.override", parentEmail, detail); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
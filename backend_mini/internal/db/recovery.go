@@ -0,0 +1,216 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"backend_mini/internal/util"
+)
+
+// Account recovery statuses. A recovery is pending until an admin approves
+// (completing it) or rejects it, or the owner of the old email cancels it.
+const (
+	RecoveryPending   = "pending"
+	RecoveryCompleted = "completed"
+	RecoveryRejected  = "rejected"
+	RecoveryCancelled = "cancelled"
+)
+
+var (
+	ErrRecoveryNotFound = errors.New("no pending recovery with that id")
+	ErrRecoveryOpen     = errors.New("a recovery is already pending for this account")
+	ErrRecoveryCooling  = errors.New("recovery is still in its cooling-off period")
+)
+
+// AccountRecovery moves a parent account whose owner lost access to its
+// email onto a new, verified email.
+type AccountRecovery struct {
+	RecoveryID string `json:"recovery_id"`
+	OldEmail   string `json:"old_email"`
+	NewEmail   string `json:"new_email"`
+	// VerifiedBy is the identity provider that vouched for NewEmail.
+	VerifiedBy    string `json:"verified_by"`
+	DocumentRef   string `json:"document_ref,omitempty"`
+	Reason        string `json:"reason,omitempty"`
+	Status        string `json:"status"`
+	CoolingOffEnd string `json:"cooling_off_until"`
+	ReviewedBy    string `json:"reviewed_by,omitempty"`
+	ReviewNote    string `json:"review_note,omitempty"`
+	CreatedAt     string `json:"created_at"`
+	DecidedAt     string `json:"decided_at,omitempty"`
+}
+
+const recoveryColumns = `recovery_id, old_email, new_email, verified_by, document_ref, reason, status, cooling_off_until, reviewed_by, review_note, created_at, decided_at`
+
+func scanRecovery(row rowScanner, a *AccountRecovery) error {
+	return row.Scan(&a.RecoveryID, &a.OldEmail, &a.NewEmail, &a.VerifiedBy, &a.DocumentRef, &a.Reason, &a.Status, &a.CoolingOffEnd, &a.ReviewedBy, &a.ReviewNote, &a.CreatedAt, &a.DecidedAt)
+}
+
+// StartRecovery records a pending recovery. Only one may be pending per
+// account.
+func (d *DB) StartRecovery(ctx context.Context, rec *AccountRecovery, coolingOff time.Duration) error {
+	id, err := util.NewID()
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	rec.RecoveryID, rec.Status = id, RecoveryPending
+	rec.OldEmail, rec.NewEmail = strings.ToLower(rec.OldEmail), strings.ToLower(rec.NewEmail)
+	rec.CreatedAt, rec.CoolingOffEnd = now.Format(time.RFC3339), now.Add(coolingOff).Format(time.RFC3339)
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var open int
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM account_recoveries WHERE old_email=? AND status=?`, rec.OldEmail, RecoveryPending).Scan(&open); err != nil {
+		return err
+	}
+	if open > 0 {
+		return ErrRecoveryOpen
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO account_recoveries (`+recoveryColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, '', '', ?, '')`,
+		rec.RecoveryID, rec.OldEmail, rec.NewEmail, rec.VerifiedBy, rec.DocumentRef, rec.Reason, rec.Status, rec.CoolingOffEnd, rec.CreatedAt); err != nil {
+		return err
+	}
+	if err := writeAudit(ctx, tx, rec.NewEmail, "recovery.started", rec.OldEmail, rec.RecoveryID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (d *DB) GetRecovery(ctx context.Context, recoveryID string) (*AccountRecovery, bool, error) {
+	var rec AccountRecovery
+	err := scanRecovery(d.queryRow(ctx, `SELECT `+recoveryColumns+` FROM account_recoveries WHERE recovery_id=?`, recoveryID), &rec)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return &rec, true, nil
+}
+
+// ListRecoveries filters by status; empty matches all.
+func (d *DB) ListRecoveries(ctx context.Context, status string, limit int) ([]AccountRecovery, error) {
+	rows, err := d.query(ctx, `SELECT `+recoveryColumns+` FROM account_recoveries WHERE (?='' OR status=?) ORDER BY created_at DESC LIMIT ?`, status, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []AccountRecovery{}
+	for rows.Next() {
+		var rec AccountRecovery
+		if err := scanRecovery(rows, &rec); err != nil {
+			return nil, err
+		}
+		out = append(out, rec)
+	}
+	return out, rows.Err()
+}
+
+// CancelRecovery lets the owner of the old email stop a pending recovery.
+func (d *DB) CancelRecovery(ctx context.Context, recoveryID, oldEmail string) (*AccountRecovery, error) {
+	return d.decideRecovery(ctx, recoveryID, RecoveryCancelled, strings.ToLower(oldEmail), "", func(tx *sql.Tx, rec *AccountRecovery) error {
+		if rec.OldEmail != strings.ToLower(oldEmail) {
+			return ErrRecoveryNotFound
+		}
+		return nil
+	})
+}
+
+// RejectRecovery closes a pending recovery without changing the account.
+func (d *DB) RejectRecovery(ctx context.Context, recoveryID, reviewedBy, note string) (*AccountRecovery, error) {
+	return d.decideRecovery(ctx, recoveryID, RecoveryRejected, reviewedBy, note, nil)
+}
+
+// CompleteRecovery moves the account onto the new email once the cooling-off
+// period is over: the parent row, every parent_email column, and the
+// parent's messaging keys and sent messages. Audit entries keep the old
+// email, as they record who did what at the time.
+func (d *DB) CompleteRecovery(ctx context.Context, recoveryID, reviewedBy, note string, now time.Time) (*AccountRecovery, error) {
+	return d.decideRecovery(ctx, recoveryID, RecoveryCompleted, reviewedBy, note, func(tx *sql.Tx, rec *AccountRecovery) error {
+		if now.UTC().Format(time.RFC3339) < rec.CoolingOffEnd {
+			return ErrRecoveryCooling
+		}
+		return migrateParentEmail(ctx, tx, rec.OldEmail, rec.NewEmail)
+	})
+}
+
+func (d *DB) decideRecovery(ctx context.Context, recoveryID, status, actor, note string, apply func(*sql.Tx, *AccountRecovery) error) (*AccountRecovery, error) {
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	var rec AccountRecovery
+	err = scanRecovery(tx.QueryRowContext(ctx, `SELECT `+recoveryColumns+` FROM account_recoveries WHERE recovery_id=? AND status=?`, recoveryID, RecoveryPending), &rec)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrRecoveryNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if apply != nil {
+		if err := apply(tx, &rec); err != nil {
+			return nil, err
+		}
+	}
+	rec.Status, rec.DecidedAt = status, time.Now().UTC().Format(time.RFC3339)
+	if status != RecoveryCancelled {
+		rec.ReviewedBy, rec.ReviewNote = actor, note
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE account_recoveries SET status=?, reviewed_by=?, review_note=?, decided_at=? WHERE recovery_id=?`,
+		rec.Status, rec.ReviewedBy, rec.ReviewNote, rec.DecidedAt, rec.RecoveryID); err != nil {
+		return nil, err
+	}
+	if err := writeAudit(ctx, tx, actor, "recovery."+status, rec.OldEmail, rec.RecoveryID); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+// migrateParentEmail rewrites oldEmail to newEmail wherever it identifies
+// the parent. Tables are found by their parent_email column, so tables
+// added later are covered without touching this.
+func migrateParentEmail(ctx context.Context, tx *sql.Tx, oldEmail, newEmail string) error {
+	rows, err := tx.QueryContext(ctx, `SELECT m.name FROM sqlite_master m JOIN pragma_table_info(m.name) c
+		WHERE m.type='table' AND c.name='parent_email'`)
+	if err != nil {
+		return err
+	}
+	var tables []string
+	for rows.Next() {
+		var t string
+		if err := rows.Scan(&t); err != nil {
+			rows.Close()
+			return err
+		}
+		tables = append(tables, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	stmts := []string{
+		`UPDATE parents SET email=? WHERE lower(email)=?`,
+		`UPDATE user_keys SET email=? WHERE lower(email)=?`,
+		`UPDATE retired_keys SET email=? WHERE lower(email)=?`,
+		`UPDATE messages SET sender_email=? WHERE lower(sender_email)=?`,
+	}
+	for _, t := range tables {
+		stmts = append(stmts, `UPDATE `+t+` SET parent_email=? WHERE lower(parent_email)=?`)
+	}
+	for _, s := range stmts {
+		if _, err := tx.ExecContext(ctx, s, newEmail, oldEmail); err != nil {
+			return err
+		}
+	}
+	return nil
+}
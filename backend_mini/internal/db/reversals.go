@@ -0,0 +1,227 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"backend_mini/internal/util"
+)
+
+// Reversal statuses. A pending reversal waits for AckEmail to accept it;
+// built means the compensating transfer was handed out for signing.
+const (
+	ReversalPending  = "pending"
+	ReversalDeclined = "declined"
+	ReversalBuilt    = "built"
+)
+
+var (
+	ErrReversalNotFound = errors.New("reversal not found")
+	ErrReversalExists   = errors.New("the transfer already has a reversal")
+	ErrReversalDecided  = errors.New("the reversal was already decided")
+)
+
+// Reversal undoes a mistaken transfer with a compensating one from its
+// recipient back to its sender, recorded in the ledger as kind "reversal"
+// with the original transfer as ref.
+type Reversal struct {
+	ReversalID  string `json:"reversal_id"`
+	TransferID  string `json:"transfer_id"`
+	ParentEmail string `json:"parent_email"`
+	RequestedBy string `json:"requested_by"`
+	Reason      string `json:"reason,omitempty"`
+	Amount      uint64 `json:"amount"`
+	Status      string `json:"status"`
+	// AckEmail must accept a pending reversal; empty when the family
+	// policy did not ask for acknowledgement.
+	AckEmail           string `json:"ack_email,omitempty"`
+	DecidedAt          string `json:"decided_at,omitempty"`
+	ReversalTransferID string `json:"reversal_transfer_id,omitempty"`
+	CreatedAt          string `json:"created_at"`
+}
+
+const reversalColumns = `reversal_id, transfer_id, parent_email, requested_by, reason, amount, status, ack_email, decided_at, reversal_transfer_id, created_at`
+
+func scanReversal(row rowScanner, rv *Reversal) error {
+	return row.Scan(&rv.ReversalID, &rv.TransferID, &rv.ParentEmail, &rv.RequestedBy, &rv.Reason, &rv.Amount, &rv.Status, &rv.AckEmail, &rv.DecidedAt, &rv.ReversalTransferID, &rv.CreatedAt)
+}
+
+// openReversal fails with ErrReversalExists when the transfer has a
+// reversal that was not declined.
+func openReversal(ctx context.Context, tx *sql.Tx, transferID string) error {
+	var n int
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM transfer_reversals WHERE transfer_id=? AND status<>?`, transferID, ReversalDeclined).Scan(&n); err != nil {
+		return err
+	}
+	if n > 0 {
+		return ErrReversalExists
+	}
+	return nil
+}
+
+func insertReversal(ctx context.Context, tx *sql.Tx, rv *Reversal) error {
+	id, err := util.NewID()
+	if err != nil {
+		return err
+	}
+	rv.ReversalID, rv.CreatedAt = id, time.Now().UTC().Format(time.RFC3339)
+	rv.ParentEmail, rv.RequestedBy, rv.AckEmail = strings.ToLower(rv.ParentEmail), strings.ToLower(rv.RequestedBy), strings.ToLower(rv.AckEmail)
+	_, err = tx.ExecContext(ctx, `INSERT INTO transfer_reversals (`+reversalColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		rv.ReversalID, rv.TransferID, rv.ParentEmail, rv.RequestedBy, rv.Reason, rv.Amount, rv.Status, rv.AckEmail, rv.DecidedAt, rv.ReversalTransferID, rv.CreatedAt)
+	return err
+}
+
+// RequestReversal stores a reversal that waits for rv.AckEmail to accept
+// it.
+func (d *DB) RequestReversal(ctx context.Context, rv *Reversal) error {
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := openReversal(ctx, tx, rv.TransferID); err != nil {
+		return err
+	}
+	rv.Status = ReversalPending
+	if err := insertReversal(ctx, tx, rv); err != nil {
+		return err
+	}
+	if err := writeAudit(ctx, tx, rv.RequestedBy, "transfer.reversal_requested", rv.ParentEmail, rv.TransferID+": "+rv.Reason); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// CompleteReversal records the compensating transfer t and marks rv built.
+// rv is either pending, and is then accepted by actor, or new when no
+// acknowledgement was needed.
+func (d *DB) CompleteReversal(ctx context.Context, rv *Reversal, t *Transfer, actor string) error {
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := insertTransfer(ctx, tx, t); err != nil {
+		return err
+	}
+	rv.DecidedAt, rv.ReversalTransferID = time.Now().UTC().Format(time.RFC3339), t.TransferID
+	if rv.ReversalID == "" {
+		if err := openReversal(ctx, tx, rv.TransferID); err != nil {
+			return err
+		}
+		rv.Status = ReversalBuilt
+		if err := insertReversal(ctx, tx, rv); err != nil {
+			return err
+		}
+	} else {
+		res, err := tx.ExecContext(ctx, `UPDATE transfer_reversals SET status=?, decided_at=?, reversal_transfer_id=? WHERE reversal_id=? AND status=?`,
+			ReversalBuilt, rv.DecidedAt, rv.ReversalTransferID, rv.ReversalID, ReversalPending)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrReversalDecided
+		}
+		rv.Status = ReversalBuilt
+	}
+	if err := writeAudit(ctx, tx, actor, "transfer.reversed", rv.ParentEmail, rv.TransferID+" by "+t.TransferID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeclineReversal turns down a pending reversal; the transfer may be asked
+// to be reversed again.
+func (d *DB) DeclineReversal(ctx context.Context, rv *Reversal, actor string) error {
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rv.DecidedAt = time.Now().UTC().Format(time.RFC3339)
+	res, err := tx.ExecContext(ctx, `UPDATE transfer_reversals SET status=?, decided_at=? WHERE reversal_id=? AND status=?`,
+		ReversalDeclined, rv.DecidedAt, rv.ReversalID, ReversalPending)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrReversalDecided
+	}
+	rv.Status = ReversalDeclined
+	if err := writeAudit(ctx, tx, actor, "transfer.reversal_declined", rv.ParentEmail, rv.TransferID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (d *DB) GetReversal(ctx context.Context, reversalID string) (*Reversal, error) {
+	var rv Reversal
+	err := scanReversal(d.queryRow(ctx, `SELECT `+reversalColumns+` FROM transfer_reversals WHERE reversal_id=?`, reversalID), &rv)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrReversalNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &rv, nil
+}
+
+// ListReversals returns the family's reversals, newest first.
+func (d *DB) ListReversals(ctx context.Context, parentEmail string) ([]Reversal, error) {
+	rows, err := d.query(ctx, `SELECT `+reversalColumns+` FROM transfer_reversals WHERE parent_email=? ORDER BY created_at DESC, reversal_id DESC`, strings.ToLower(parentEmail))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []Reversal{}
+	for rows.Next() {
+		var rv Reversal
+		if err := scanReversal(rows, &rv); err != nil {
+			return nil, err
+		}
+		out = append(out, rv)
+	}
+	return out, rows.Err()
+}
+
+// markReversed flags statement entries that are reversals or have been
+// reversed. It is worked out on read, so statements finalized before a
+// reversal show it too while their amounts stay as they were.
+func (d *DB) markReversed(ctx context.Context, entries []StatementEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	args := make([]any, 0, len(entries)+1)
+	args = append(args, TransferKindReversal)
+	for _, e := range entries {
+		args = append(args, e.TransferID)
+	}
+	// the IN list's length varies, so it is not prepared into the cache
+	rows, err := d.Read.QueryContext(ctx, `SELECT ref FROM transfers WHERE kind=? AND status<>'superseded' AND ref IN (?`+strings.Repeat(", ?", len(entries)-1)+`)`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	reversed := map[string]bool{}
+	for rows.Next() {
+		var ref string
+		if err := rows.Scan(&ref); err != nil {
+			return err
+		}
+		reversed[ref] = true
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for i := range entries {
+		entries[i].Reversed = entries[i].Kind == TransferKindReversal || reversed[entries[i].TransferID]
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"backend_mini/internal/util"
+)
+
+// Savings lock statuses. A lock holds its amount until unlock_on passes or
+// a parent approves an early unlock; a kid's request for one leaves the
+// funds locked until then.
+const (
+	SavingsLocked          = "locked"
+	SavingsUnlockRequested = "unlock_requested"
+	SavingsUnlocked        = "unlocked"
+)
+
+var (
+	ErrSavingsLockNotFound = errors.New("savings lock not found")
+	ErrSavingsLockReleased = errors.New("savings lock already released")
+	ErrNoUnlockRequested   = errors.New("no early unlock was requested")
+)
+
+// SavingsLock keeps Amount of a kid's EURC from being spent until UnlockOn
+// (a YYYY-MM-DD date, UTC). UntilAge is informational: the age the kid
+// reaches on UnlockOn when the lock was set by age.
+type SavingsLock struct {
+	LockID       string `json:"lock_id"`
+	ParentEmail  string `json:"parent_email"`
+	KidEmail     string `json:"kid_email"`
+	Wallet       string `json:"wallet"`
+	Amount       uint64 `json:"amount"`
+	UnlockOn     string `json:"unlock_on"`
+	UntilAge     int    `json:"until_age,omitempty"`
+	Note         string `json:"note,omitempty"`
+	Status       string `json:"status"`
+	UnlockReason string `json:"unlock_reason,omitempty"`
+	RequestedAt  string `json:"requested_at,omitempty"`
+	DecidedAt    string `json:"decided_at,omitempty"`
+	CreatedAt    string `json:"created_at"`
+}
+
+// Active reports whether the lock still holds its amount on day.
+func (l *SavingsLock) Active(day time.Time) bool {
+	return l.Status != SavingsUnlocked && l.UnlockOn > day.UTC().Format("2006-01-02")
+}
+
+const savingsLockColumns = `lock_id, parent_email, kid_email, wallet, amount, unlock_on, until_age, note, status, unlock_reason, requested_at, decided_at, created_at`
+
+func scanSavingsLock(row rowScanner, l *SavingsLock) error {
+	return row.Scan(&l.LockID, &l.ParentEmail, &l.KidEmail, &l.Wallet, &l.Amount, &l.UnlockOn, &l.UntilAge, &l.Note, &l.Status, &l.UnlockReason, &l.RequestedAt, &l.DecidedAt, &l.CreatedAt)
+}
+
+// CreateSavingsLock records l, filling in its id, status and creation time.
+func (d *DB) CreateSavingsLock(ctx context.Context, l *SavingsLock) error {
+	id, err := util.NewID()
+	if err != nil {
+		return err
+	}
+	l.LockID, l.Status, l.CreatedAt = id, SavingsLocked, time.Now().UTC().Format(time.RFC3339)
+	l.ParentEmail, l.KidEmail = strings.ToLower(l.ParentEmail), strings.ToLower(l.KidEmail)
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `INSERT INTO savings_locks (lock_id, parent_email, kid_email, wallet, amount, unlock_on, until_age, note, status, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		l.LockID, l.ParentEmail, l.KidEmail, l.Wallet, l.Amount, l.UnlockOn, l.UntilAge, l.Note, l.Status, l.CreatedAt); err != nil {
+		return err
+	}
+	if err := writeAudit(ctx, tx, l.ParentEmail, "savings_lock.create", l.KidEmail, l.LockID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (d *DB) GetSavingsLock(ctx context.Context, lockID string) (*SavingsLock, bool, error) {
+	var l SavingsLock
+	err := scanSavingsLock(d.queryRow(ctx, `SELECT `+savingsLockColumns+` FROM savings_locks WHERE lock_id=?`, lockID), &l)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return &l, true, nil
+}
+
+// ListSavingsLocks returns the kid's locks, newest first, released ones
+// included.
+func (d *DB) ListSavingsLocks(ctx context.Context, kidEmail string) ([]SavingsLock, error) {
+	rows, err := d.query(ctx, `SELECT `+savingsLockColumns+` FROM savings_locks WHERE kid_email=? ORDER BY created_at DESC`, strings.ToLower(kidEmail))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []SavingsLock{}
+	for rows.Next() {
+		var l SavingsLock
+		if err := scanSavingsLock(rows, &l); err != nil {
+			return nil, err
+		}
+		out = append(out, l)
+	}
+	return out, rows.Err()
+}
+
+// LockedSavings sums the locks on wallet still holding funds on day.
+func (d *DB) LockedSavings(ctx context.Context, wallet string, day time.Time) (uint64, error) {
+	var total uint64
+	err := d.queryRow(ctx, `SELECT COALESCE(SUM(amount), 0) FROM savings_locks WHERE wallet=? AND status<>? AND unlock_on > ?`,
+		wallet, SavingsUnlocked, day.UTC().Format("2006-01-02")).Scan(&total)
+	return total, err
+}
+
+// RequestEarlyUnlock marks a still-held lock as awaiting a parent's
+// decision. The funds stay locked until the parent approves.
+func (d *DB) RequestEarlyUnlock(ctx context.Context, lockID, reason string) (*SavingsLock, error) {
+	return d.moveSavingsLock(ctx, lockID, SavingsLocked, SavingsUnlockRequested, func(l *SavingsLock, now string) {
+		l.UnlockReason, l.RequestedAt = reason, now
+	})
+}
+
+// DecideEarlyUnlock releases a lock awaiting a decision when approve is
+// set, and returns it to locked otherwise.
+func (d *DB) DecideEarlyUnlock(ctx context.Context, lockID, parentEmail string, approve bool) (*SavingsLock, error) {
+	to := SavingsLocked
+	if approve {
+		to = SavingsUnlocked
+	}
+	l, err := d.moveSavingsLock(ctx, lockID, SavingsUnlockRequested, to, func(l *SavingsLock, now string) {
+		l.DecidedAt = now
+	})
+	if err != nil {
+		return nil, err
+	}
+	action := "savings_lock.unlock_denied"
+	if approve {
+		action = "savings_lock.unlock_approved"
+	}
+	if err := writeAudit(ctx, d.SQL, parentEmail, action, l.KidEmail, l.LockID); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// moveSavingsLock changes a lock's status from one state to another,
+// applying set to the other fields first.
+func (d *DB) moveSavingsLock(ctx context.Context, lockID, from, to string, set func(*SavingsLock, string)) (*SavingsLock, error) {
+	l, found, err := d.GetSavingsLock(ctx, lockID)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrSavingsLockNotFound
+	}
+	if l.Status == SavingsUnlocked {
+		return nil, ErrSavingsLockReleased
+	}
+	if l.Status != from {
+		if from == SavingsUnlockRequested {
+			return nil, ErrNoUnlockRequested
+		}
+		return l, nil
+	}
+	set(l, time.Now().UTC().Format(time.RFC3339))
+	res, err := d.exec(ctx, `UPDATE savings_locks SET status=?, unlock_reason=?, requested_at=?, decided_at=? WHERE lock_id=? AND status=?`,
+		to, l.UnlockReason, l.RequestedAt, l.DecidedAt, lockID, from)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, ErrSavingsLockReleased
+	}
+	l.Status = to
+	return l, nil
+}
@@ -0,0 +1,141 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Features a family can turn off. All are on until a family says otherwise.
+const (
+	FeatureOpenChores   = "open_chores"
+	FeaturePenalties    = "penalties"
+	FeatureSavingsLocks = "savings_locks"
+	FeatureAppAlerts    = "app_alerts"
+)
+
+var Features = []string{FeatureOpenChores, FeaturePenalties, FeatureSavingsLocks, FeatureAppAlerts}
+
+// FamilySettings are a family's preferences in one place. Families that
+// never saved any get DefaultFamilySettings.
+type FamilySettings struct {
+	ParentEmail string `json:"parent_email"`
+	// Timezone is an IANA zone name. Relative dates such as
+	// next_school_day and next_monday are resolved in it.
+	Timezone string `json:"timezone"`
+	// Currency is how clients should display amounts. The ledger is
+	// always EURC.
+	Currency      string            `json:"currency"`
+	Notifications NotificationPrefs `json:"notifications"`
+	// AutoApproveBelow is the bounty under which a submitted chore is
+	// approved after AutoApproveAfterHours without a parent decision.
+	// Zero turns auto-approval off.
+	AutoApproveBelow      uint64          `json:"auto_approve_below"`
+	AutoApproveAfterHours int             `json:"auto_approve_after_hours"`
+	ContentFilter         string          `json:"content_filter"`
+	Features              map[string]bool `json:"features"`
+	// DataSharingConsent is the version of the partner data-sharing terms
+	// the parent agreed to; empty means the family is left out.
+	DataSharingConsent string `json:"data_sharing_consent"`
+	UpdatedAt          string `json:"updated_at,omitempty"`
+}
+
+// NotificationPrefs decide which events leave the server. Muted events
+// are still stored and can be polled; they are not sent to webhooks or
+// integrations.
+type NotificationPrefs struct {
+	MutedEvents []string `json:"muted_events"`
+}
+
+// Muted reports whether eventType is muted, either by name or by a
+// "prefix." entry such as "chore.".
+func (n NotificationPrefs) Muted(eventType string) bool {
+	for _, m := range n.MutedEvents {
+		if m == eventType || (strings.HasSuffix(m, ".") && strings.HasPrefix(eventType, m)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Enabled reports whether feature is on.
+func (s FamilySettings) Enabled(feature string) bool {
+	on, set := s.Features[feature]
+	return on || !set
+}
+
+// Location is the family's time zone, UTC when it cannot be loaded.
+func (s FamilySettings) Location() *time.Location {
+	if loc, err := time.LoadLocation(s.Timezone); err == nil {
+		return loc
+	}
+	return time.UTC
+}
+
+func DefaultFamilySettings(parentEmail string) FamilySettings {
+	features := make(map[string]bool, len(Features))
+	for _, f := range Features {
+		features[f] = true
+	}
+	return FamilySettings{
+		ParentEmail:           strings.ToLower(parentEmail),
+		Timezone:              "UTC",
+		Currency:              "EUR",
+		Notifications:         NotificationPrefs{MutedEvents: []string{}},
+		AutoApproveAfterHours: 48,
+		ContentFilter:         ContentFilterMask,
+		Features:              features,
+	}
+}
+
+func (d *DB) GetFamilySettings(ctx context.Context, parentEmail string) (FamilySettings, error) {
+	s := DefaultFamilySettings(parentEmail)
+	var notifications, features string
+	err := d.queryRow(ctx, `SELECT timezone, currency, notifications, auto_approve_below, auto_approve_after_hours, content_filter, features, data_sharing_consent, updated_at
+		FROM family_settings WHERE parent_email=?`, s.ParentEmail).
+		Scan(&s.Timezone, &s.Currency, &notifications, &s.AutoApproveBelow, &s.AutoApproveAfterHours, &s.ContentFilter, &features, &s.DataSharingConsent, &s.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return s, nil
+	}
+	if err != nil {
+		return s, err
+	}
+	if err := json.Unmarshal([]byte(notifications), &s.Notifications); err != nil {
+		return s, err
+	}
+	// features saved before a feature existed leave it at its default
+	var saved map[string]bool
+	if err := json.Unmarshal([]byte(features), &saved); err != nil {
+		return s, err
+	}
+	for f, on := range saved {
+		s.Features[f] = on
+	}
+	return s, nil
+}
+
+func (d *DB) SetFamilySettings(ctx context.Context, s FamilySettings) (FamilySettings, error) {
+	s.ParentEmail = strings.ToLower(s.ParentEmail)
+	s.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	if s.Notifications.MutedEvents == nil {
+		s.Notifications.MutedEvents = []string{}
+	}
+	notifications, err := json.Marshal(s.Notifications)
+	if err != nil {
+		return s, err
+	}
+	features, err := json.Marshal(s.Features)
+	if err != nil {
+		return s, err
+	}
+	_, err = d.exec(ctx, `INSERT INTO family_settings (parent_email, timezone, currency, notifications, auto_approve_below, auto_approve_after_hours, content_filter, features, data_sharing_consent, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(parent_email) DO UPDATE SET timezone=excluded.timezone, currency=excluded.currency, notifications=excluded.notifications,
+		auto_approve_below=excluded.auto_approve_below, auto_approve_after_hours=excluded.auto_approve_after_hours,
+		content_filter=excluded.content_filter, features=excluded.features, data_sharing_consent=excluded.data_sharing_consent, updated_at=excluded.updated_at`,
+		s.ParentEmail, s.Timezone, s.Currency, string(notifications), s.AutoApproveBelow, s.AutoApproveAfterHours, s.ContentFilter, string(features), s.DataSharingConsent, s.UpdatedAt)
+	return s, err
+}
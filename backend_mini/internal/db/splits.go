@@ -0,0 +1,58 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+type SplitRule struct {
+	KidEmail      string `json:"kid_email"`
+	ParentEmail   string `json:"parent_email"`
+	Percent       int    `json:"percent"`
+	SavingsWallet string `json:"savings_wallet"`
+	UpdatedAt     string `json:"updated_at"`
+}
+
+func (d *DB) SetSplitRule(ctx context.Context, parentEmail, kidEmail string, percent int, savingsWallet string) (*SplitRule, error) {
+	now := time.Now().UTC().Format(time.RFC3339)
+	_, err := d.exec(ctx, `
+		INSERT INTO split_rules (kid_email, parent_email, percent, savings_wallet, updated_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(kid_email) DO UPDATE SET parent_email=excluded.parent_email, percent=excluded.percent, savings_wallet=excluded.savings_wallet, updated_at=excluded.updated_at
+	`, strings.ToLower(kidEmail), strings.ToLower(parentEmail), percent, savingsWallet, now)
+	if err != nil {
+		return nil, err
+	}
+	return &SplitRule{KidEmail: strings.ToLower(kidEmail), ParentEmail: strings.ToLower(parentEmail), Percent: percent, SavingsWallet: savingsWallet, UpdatedAt: now}, nil
+}
+
+func (d *DB) DeleteSplitRule(ctx context.Context, kidEmail string) error {
+	_, err := d.exec(ctx, `DELETE FROM split_rules WHERE kid_email=?`, strings.ToLower(kidEmail))
+	return err
+}
+
+func (d *DB) GetSplitRule(ctx context.Context, kidEmail string) (*SplitRule, bool, error) {
+	row := d.queryRow(ctx, `SELECT kid_email, parent_email, percent, savings_wallet, updated_at FROM split_rules WHERE kid_email=?`, strings.ToLower(kidEmail))
+	var r SplitRule
+	if err := row.Scan(&r.KidEmail, &r.ParentEmail, &r.Percent, &r.SavingsWallet, &r.UpdatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	return &r, true, nil
+}
+
+func (d *DB) GetChildByWallet(ctx context.Context, wallet string) (*Child, bool, error) {
+	row := d.queryRow(ctx, `SELECT `+childColumns+` FROM children WHERE wallet=? AND wallet<>''`, wallet)
+	var c Child
+	if err := scanChild(row, &c); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	return &c, true, nil
+}
@@ -0,0 +1,243 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// StatementPeriodLayout is the format of a statement period: one UTC month.
+const StatementPeriodLayout = "2006-01"
+
+// Statement status values reported by ListStatementPeriods.
+const (
+	StatementOpen      = "open"
+	StatementFinalized = "finalized"
+	StatementPending   = "pending_close"
+)
+
+var ErrStatementOpen = errors.New("statement period has not ended")
+
+// Statement is a kid's closed month. Balances are derived from the ledger of
+// built transfers, so they reflect what was sent, not on-chain state.
+// Superseded builds are left out; their replacement stands in for them.
+type Statement struct {
+	KidEmail       string           `json:"kid_email"`
+	Period         string           `json:"period"`
+	Wallet         string           `json:"wallet"`
+	OpeningBalance int64            `json:"opening_balance"`
+	ClosingBalance int64            `json:"closing_balance"`
+	Entries        []StatementEntry `json:"entries"`
+	// Totals nets the entries per transfer kind, so chore earnings and
+	// penalties read separately.
+	Totals      map[string]int64 `json:"totals"`
+	FinalizedAt string           `json:"finalized_at"`
+}
+
+// StatementEntry is a credit (positive amount) or debit (negative amount).
+type StatementEntry struct {
+	TransferID   string `json:"transfer_id"`
+	Kind         string `json:"kind"`
+	Ref          string `json:"ref,omitempty"`
+	Counterparty string `json:"counterparty"`
+	Amount       int64  `json:"amount"`
+	CreatedAt    string `json:"created_at"`
+	// Reversed marks a reversal and the transfer it reversed.
+	Reversed bool `json:"reversed,omitempty"`
+}
+
+type StatementPeriod struct {
+	Period string `json:"period"`
+	Status string `json:"status"`
+}
+
+// PeriodBounds returns the RFC3339 start (inclusive) and end (exclusive) of period.
+func PeriodBounds(period string) (string, string, error) {
+	start, err := time.Parse(StatementPeriodLayout, period)
+	if err != nil {
+		return "", "", err
+	}
+	return start.Format(time.RFC3339), start.AddDate(0, 1, 0).Format(time.RFC3339), nil
+}
+
+// ledgerBalance is the net of all credits and debits on wallet before t.
+func (d *DB) ledgerBalance(ctx context.Context, wallet, before string) (int64, error) {
+	var credits, debits int64
+	if err := d.queryRow(ctx, `SELECT COALESCE(SUM(l.amount), 0) FROM transfer_legs l JOIN transfers t ON t.transfer_id = l.transfer_id WHERE l.to_wallet=? AND t.status<>'superseded' AND t.created_at < ?`, wallet, before).Scan(&credits); err != nil {
+		return 0, err
+	}
+	if err := d.queryRow(ctx, `SELECT COALESCE(SUM(total), 0) FROM transfers WHERE from_wallet=? AND status<>'superseded' AND created_at < ?`, wallet, before).Scan(&debits); err != nil {
+		return 0, err
+	}
+	return credits - debits, nil
+}
+
+func (d *DB) ledgerEntries(ctx context.Context, wallet, from, to string) ([]StatementEntry, error) {
+	rows, err := d.query(ctx, `
+		SELECT t.transfer_id, t.kind, t.ref, t.from_wallet, l.amount, t.created_at
+		FROM transfer_legs l JOIN transfers t ON t.transfer_id = l.transfer_id
+		WHERE l.to_wallet=? AND t.status<>'superseded' AND t.created_at >= ? AND t.created_at < ?
+		UNION ALL
+		SELECT t.transfer_id, t.kind, t.ref, l.to_wallet, -l.amount, t.created_at
+		FROM transfer_legs l JOIN transfers t ON t.transfer_id = l.transfer_id
+		WHERE t.from_wallet=? AND t.status<>'superseded' AND t.created_at >= ? AND t.created_at < ?
+		ORDER BY 6, 1`, wallet, from, to, wallet, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []StatementEntry{}
+	for rows.Next() {
+		var e StatementEntry
+		if err := rows.Scan(&e.TransferID, &e.Kind, &e.Ref, &e.Counterparty, &e.Amount, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+// FinalizeStatement returns the kid's statement for a month that has ended,
+// generating and storing it on first use. Stored statements never change.
+func (d *DB) FinalizeStatement(ctx context.Context, kid *Child, period string, now time.Time) (*Statement, error) {
+	if st, found, err := d.GetStatement(ctx, kid.Email, period); err != nil || found {
+		return st, err
+	}
+	from, to, err := PeriodBounds(period)
+	if err != nil {
+		return nil, err
+	}
+	if to > now.UTC().Format(time.RFC3339) {
+		return nil, ErrStatementOpen
+	}
+	opening, err := d.ledgerBalance(ctx, kid.Wallet, from)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := d.ledgerEntries(ctx, kid.Wallet, from, to)
+	if err != nil {
+		return nil, err
+	}
+	st := &Statement{KidEmail: strings.ToLower(kid.Email), Period: period, Wallet: kid.Wallet, OpeningBalance: opening, ClosingBalance: opening, Entries: entries, FinalizedAt: now.UTC().Format(time.RFC3339)}
+	for _, e := range entries {
+		st.ClosingBalance += e.Amount
+	}
+	buf, err := json.Marshal(entries)
+	if err != nil {
+		return nil, err
+	}
+	// a concurrent close may have won; the first stored statement stands
+	if _, err := d.exec(ctx, `INSERT OR IGNORE INTO statements (kid_email, period, wallet, opening_balance, closing_balance, entries, finalized_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		st.KidEmail, st.Period, st.Wallet, st.OpeningBalance, st.ClosingBalance, string(buf), st.FinalizedAt); err != nil {
+		return nil, err
+	}
+	st, _, err = d.GetStatement(ctx, kid.Email, period)
+	return st, err
+}
+
+func (d *DB) GetStatement(ctx context.Context, kidEmail, period string) (*Statement, bool, error) {
+	var st Statement
+	var entries string
+	err := d.queryRow(ctx, `SELECT kid_email, period, wallet, opening_balance, closing_balance, entries, finalized_at FROM statements WHERE kid_email=? AND period=?`, strings.ToLower(kidEmail), period).
+		Scan(&st.KidEmail, &st.Period, &st.Wallet, &st.OpeningBalance, &st.ClosingBalance, &entries, &st.FinalizedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if err := json.Unmarshal([]byte(entries), &st.Entries); err != nil {
+		return nil, false, err
+	}
+	if err := d.markReversed(ctx, st.Entries); err != nil {
+		return nil, false, err
+	}
+	st.Totals = map[string]int64{}
+	for _, e := range st.Entries {
+		st.Totals[e.Kind] += e.Amount
+	}
+	return &st, true, nil
+}
+
+// firstLedgerActivity returns the creation time of the wallet's earliest
+// transfer in either direction, or "" when it has none.
+func (d *DB) firstLedgerActivity(ctx context.Context, wallet string) (string, error) {
+	var first sql.NullString
+	err := d.queryRow(ctx, `SELECT MIN(created_at) FROM (
+		SELECT t.created_at FROM transfer_legs l JOIN transfers t ON t.transfer_id = l.transfer_id WHERE l.to_wallet=? AND t.status<>'superseded'
+		UNION ALL
+		SELECT created_at FROM transfers WHERE from_wallet=? AND status<>'superseded')`, wallet, wallet).Scan(&first)
+	return first.String, err
+}
+
+// ListStatementPeriods lists every month from the kid's first ledger
+// activity through the current one, newest first.
+func (d *DB) ListStatementPeriods(ctx context.Context, kid *Child, now time.Time) ([]StatementPeriod, error) {
+	out := []StatementPeriod{}
+	if kid.Wallet == "" {
+		return out, nil
+	}
+	first, err := d.firstLedgerActivity(ctx, kid.Wallet)
+	if err != nil || first == "" {
+		return out, err
+	}
+	start, err := time.Parse(time.RFC3339, first)
+	if err != nil {
+		return nil, err
+	}
+	finalized := map[string]bool{}
+	rows, err := d.query(ctx, `SELECT period FROM statements WHERE kid_email=?`, strings.ToLower(kid.Email))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var p string
+		if err := rows.Scan(&p); err != nil {
+			return nil, err
+		}
+		finalized[p] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	current := now.UTC().Format(StatementPeriodLayout)
+	month := time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, time.UTC)
+	for ; month.Format(StatementPeriodLayout) <= current; month = month.AddDate(0, 1, 0) {
+		p := month.Format(StatementPeriodLayout)
+		status := StatementPending
+		switch {
+		case finalized[p]:
+			status = StatementFinalized
+		case p == current:
+			status = StatementOpen
+		}
+		out = append([]StatementPeriod{{Period: p, Status: status}}, out...)
+	}
+	return out, nil
+}
+
+// KidsWithLedgerActivity returns kids whose wallet appears in the ledger.
+func (d *DB) KidsWithLedgerActivity(ctx context.Context) ([]Child, error) {
+	rows, err := d.query(ctx, `SELECT `+childColumns+` FROM children c WHERE c.wallet<>'' AND (
+		EXISTS (SELECT 1 FROM transfers t WHERE t.from_wallet = c.wallet) OR
+		EXISTS (SELECT 1 FROM transfer_legs l WHERE l.to_wallet = c.wallet))`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Child
+	for rows.Next() {
+		var c Child
+		if err := scanChild(rows, &c); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,95 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"backend_mini/internal/metrics"
+)
+
+// stmtCache keeps one prepared statement per query string so hot paths
+// don't re-parse SQL on every call.
+type stmtCache struct {
+	pool  *sql.DB
+	mu    sync.RWMutex
+	stmts map[string]*sql.Stmt
+}
+
+func newStmtCache(pool *sql.DB) *stmtCache {
+	return &stmtCache{pool: pool, stmts: map[string]*sql.Stmt{}}
+}
+
+func (c *stmtCache) get(ctx context.Context, query string) (*sql.Stmt, error) {
+	c.mu.RLock()
+	st, ok := c.stmts[query]
+	c.mu.RUnlock()
+	if ok {
+		return st, nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if st, ok := c.stmts[query]; ok {
+		return st, nil
+	}
+	st, err := c.pool.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	c.stmts[query] = st
+	return st, nil
+}
+
+func (c *stmtCache) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for q, st := range c.stmts {
+		_ = st.Close()
+		delete(c.stmts, q)
+	}
+}
+
+// queryRow runs a read-only single-row query on the reader pool.
+func (d *DB) queryRow(ctx context.Context, query string, args ...any) *sql.Row {
+	defer observeQuery("reader", "query_row", time.Now())
+	st, err := d.readStmts.get(ctx, query)
+	if err != nil {
+		// fall back to an unprepared query so the error surfaces on Scan
+		return d.Read.QueryRowContext(ctx, query, args...)
+	}
+	return st.QueryRowContext(ctx, args...)
+}
+
+// query runs a read-only query on the reader pool.
+func (d *DB) query(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	defer observeQuery("reader", "query", time.Now())
+	st, err := d.readStmts.get(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return st.QueryContext(ctx, args...)
+}
+
+// exec runs a write on the single writer connection.
+func (d *DB) exec(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	defer observeQuery("writer", "exec", time.Now())
+	st, err := d.writeStmts.get(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return st.ExecContext(ctx, args...)
+}
+
+// observeQuery reports a statement run through the helpers above, from
+// start until its first row is ready. Statements inside transactions are
+// not counted.
+func observeQuery(pool, op string, start time.Time) {
+	metrics.ObserveQuery(pool, op, time.Since(start))
+}
+
+// ConnWaits is how many times, since start, a query had to wait for a free
+// connection on either pool. The rate it grows at is the DB's queue depth.
+func (d *DB) ConnWaits() int64 {
+	return d.SQL.Stats().WaitCount + d.Read.Stats().WaitCount
+}
@@ -0,0 +1,223 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"backend_mini/internal/util"
+)
+
+// Subscription sources.
+const (
+	SourceAppStore  = "app_store"
+	SourcePlayStore = "play_store"
+	SourceStripe    = "stripe"
+)
+
+// Subscription statuses. Active, grace and canceled subscriptions entitle
+// the family until ExpiresAt; canceled ones just will not renew.
+const (
+	SubscriptionActive   = "active"
+	SubscriptionGrace    = "grace"
+	SubscriptionPastDue  = "past_due"
+	SubscriptionCanceled = "canceled"
+	SubscriptionRevoked  = "revoked"
+	SubscriptionExpired  = "expired"
+)
+
+// Premium features an entitlement unlocks.
+const (
+	EntitlementAdvancedAnalytics = "advanced_analytics"
+	EntitlementMoreKids          = "more_kids"
+)
+
+var PremiumFeatures = []string{EntitlementAdvancedAnalytics, EntitlementMoreKids}
+
+// PremiumForEveryone is the feature flag that gives every family premium,
+// e.g. while billing is down or during a promotion.
+const PremiumForEveryone = "premium:everyone"
+
+// ErrSubscriptionOwned means the purchase is already another family's.
+var ErrSubscriptionOwned = errors.New("this purchase belongs to another family")
+
+// Subscription is a family's premium subscription from one store, kept up
+// to date each time the purchase is validated again.
+type Subscription struct {
+	SubscriptionID string `json:"subscription_id"`
+	ParentEmail    string `json:"parent_email"`
+	Source         string `json:"source"`
+	ExternalID     string `json:"external_id"`
+	ProductID      string `json:"product_id"`
+	Status         string `json:"status"`
+	ExpiresAt      string `json:"expires_at"`
+	AutoRenew      bool   `json:"auto_renew"`
+	CreatedAt      string `json:"created_at"`
+	UpdatedAt      string `json:"updated_at"`
+}
+
+// Entitlement is what a family may use right now.
+type Entitlement struct {
+	Premium  bool     `json:"premium"`
+	Features []string `json:"features"`
+	// Source and ExpiresAt are of the subscription that runs longest.
+	Source    string `json:"source,omitempty"`
+	ExpiresAt string `json:"expires_at,omitempty"`
+}
+
+// Has reports whether the entitlement includes feature.
+func (e *Entitlement) Has(feature string) bool {
+	for _, f := range e.Features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+const subscriptionColumns = `subscription_id, parent_email, source, external_id, product_id, status, expires_at, auto_renew, created_at, updated_at`
+
+func scanSubscription(row rowScanner, s *Subscription) error {
+	return row.Scan(&s.SubscriptionID, &s.ParentEmail, &s.Source, &s.ExternalID, &s.ProductID, &s.Status, &s.ExpiresAt, &s.AutoRenew, &s.CreatedAt, &s.UpdatedAt)
+}
+
+// entitledWhere selects subscriptions that entitle their family at ?.
+const entitledWhere = `status IN ('` + SubscriptionActive + `', '` + SubscriptionGrace + `', '` + SubscriptionCanceled + `') AND expires_at > ?`
+
+// UpsertSubscription records what a store said about a purchase. The same
+// purchase validated again updates its row; validated for another family
+// it fails with ErrSubscriptionOwned.
+func (d *DB) UpsertSubscription(ctx context.Context, s Subscription) (*Subscription, error) {
+	s.ParentEmail = strings.ToLower(s.ParentEmail)
+	now := time.Now().UTC().Format(time.RFC3339)
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var cur Subscription
+	err = scanSubscription(tx.QueryRowContext(ctx, `SELECT `+subscriptionColumns+` FROM subscriptions WHERE source=? AND external_id=?`, s.Source, s.ExternalID), &cur)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		if s.SubscriptionID, err = util.NewID(); err != nil {
+			return nil, err
+		}
+		s.CreatedAt, s.UpdatedAt = now, now
+		if _, err := tx.ExecContext(ctx, `INSERT INTO subscriptions (`+subscriptionColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			s.SubscriptionID, s.ParentEmail, s.Source, s.ExternalID, s.ProductID, s.Status, s.ExpiresAt, s.AutoRenew, s.CreatedAt, s.UpdatedAt); err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	case cur.ParentEmail != s.ParentEmail:
+		return nil, ErrSubscriptionOwned
+	default:
+		s.SubscriptionID, s.CreatedAt, s.UpdatedAt = cur.SubscriptionID, cur.CreatedAt, now
+		if _, err := tx.ExecContext(ctx, `UPDATE subscriptions SET product_id=?, status=?, expires_at=?, auto_renew=?, updated_at=? WHERE subscription_id=?`,
+			s.ProductID, s.Status, s.ExpiresAt, s.AutoRenew, s.UpdatedAt, s.SubscriptionID); err != nil {
+			return nil, err
+		}
+	}
+	if cur.Status != s.Status || cur.ExpiresAt != s.ExpiresAt {
+		if err := writeAudit(ctx, tx, s.ParentEmail, "subscription."+s.Status, s.ParentEmail, s.Source+" "+s.ProductID+" until "+s.ExpiresAt); err != nil {
+			return nil, err
+		}
+	}
+	return &s, tx.Commit()
+}
+
+// ListSubscriptions returns every subscription the family has had, the
+// latest to expire first.
+func (d *DB) ListSubscriptions(ctx context.Context, parentEmail string) ([]Subscription, error) {
+	rows, err := d.query(ctx, `SELECT `+subscriptionColumns+` FROM subscriptions WHERE parent_email=? ORDER BY expires_at DESC`, strings.ToLower(parentEmail))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []Subscription{}
+	for rows.Next() {
+		var s Subscription
+		if err := scanSubscription(rows, &s); err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+// GetSubscription finds a subscription by its store's id for it.
+func (d *DB) GetSubscription(ctx context.Context, source, externalID string) (*Subscription, bool, error) {
+	var s Subscription
+	err := scanSubscription(d.queryRow(ctx, `SELECT `+subscriptionColumns+` FROM subscriptions WHERE source=? AND external_id=?`, source, externalID), &s)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return &s, true, nil
+}
+
+// LatestSubscription returns the family's subscription from source that
+// runs longest, expired or not.
+func (d *DB) LatestSubscription(ctx context.Context, parentEmail, source string) (*Subscription, bool, error) {
+	var s Subscription
+	err := scanSubscription(d.queryRow(ctx, `SELECT `+subscriptionColumns+` FROM subscriptions WHERE parent_email=? AND source=? ORDER BY expires_at DESC LIMIT 1`, strings.ToLower(parentEmail), source), &s)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return &s, true, nil
+}
+
+// StripeEventSeen reports whether the Stripe event was already handled;
+// Stripe delivers at least once.
+func (d *DB) StripeEventSeen(ctx context.Context, eventID string) (bool, error) {
+	var n int
+	err := d.queryRow(ctx, `SELECT COUNT(*) FROM stripe_events WHERE event_id=?`, eventID).Scan(&n)
+	return n > 0, err
+}
+
+// RecordStripeEvent marks the Stripe event handled.
+func (d *DB) RecordStripeEvent(ctx context.Context, eventID, eventType string) error {
+	_, err := d.exec(ctx, `INSERT OR IGNORE INTO stripe_events (event_id, type, received_at) VALUES (?, ?, ?)`, eventID, eventType, time.Now().UTC().Format(time.RFC3339))
+	return err
+}
+
+// isPremium reports whether the family has an entitling subscription at
+// now, or the premium-for-everyone flag is on.
+func (d *DB) isPremium(ctx context.Context, q queryRower, parentEmail string, now time.Time) (bool, error) {
+	var n int
+	err := q.QueryRowContext(ctx, `SELECT (SELECT COUNT(*) FROM subscriptions WHERE parent_email=? AND `+entitledWhere+`)
+		+ (SELECT COUNT(*) FROM feature_flags WHERE name=? AND enabled=1)`,
+		strings.ToLower(parentEmail), now.UTC().Format(time.RFC3339), PremiumForEveryone).Scan(&n)
+	return n > 0, err
+}
+
+// FamilyEntitlement works out what the family may use at now.
+func (d *DB) FamilyEntitlement(ctx context.Context, parentEmail string, now time.Time) (*Entitlement, error) {
+	e := &Entitlement{Features: []string{}}
+	var s Subscription
+	err := scanSubscription(d.queryRow(ctx, `SELECT `+subscriptionColumns+` FROM subscriptions WHERE parent_email=? AND `+entitledWhere+` ORDER BY expires_at DESC LIMIT 1`,
+		strings.ToLower(parentEmail), now.UTC().Format(time.RFC3339)), &s)
+	switch {
+	case err == nil:
+		e.Premium, e.Source, e.ExpiresAt = true, s.Source, s.ExpiresAt
+	case !errors.Is(err, sql.ErrNoRows):
+		return nil, err
+	default:
+		if e.Premium, err = d.isPremium(ctx, d.Read, parentEmail, now); err != nil {
+			return nil, err
+		}
+	}
+	if e.Premium {
+		e.Features = PremiumFeatures
+	}
+	return e, nil
+}
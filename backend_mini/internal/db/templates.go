@@ -0,0 +1,134 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Message template channels. Title is the push title or the email subject.
+const (
+	ChannelPush  = "push"
+	ChannelEmail = "email"
+)
+
+var ErrTemplateNotFound = errors.New("template version not found")
+
+// MessageTemplate is one saved version of the copy sent for a message,
+// usually named after the event type it describes. Versions are never
+// edited; at most one version per name and channel is active.
+type MessageTemplate struct {
+	Name       string `json:"name"`
+	Channel    string `json:"channel"`
+	Version    int    `json:"version"`
+	Title      string `json:"title,omitempty"`
+	Body       string `json:"body"`
+	Active     bool   `json:"active"`
+	CreatedBy  string `json:"created_by"`
+	CreatedAt  string `json:"created_at"`
+	PromotedAt string `json:"promoted_at,omitempty"`
+}
+
+const templateColumns = `name, channel, version, title, body, active, created_by, created_at, promoted_at`
+
+func scanTemplate(row rowScanner, t *MessageTemplate) error {
+	return row.Scan(&t.Name, &t.Channel, &t.Version, &t.Title, &t.Body, &t.Active, &t.CreatedBy, &t.CreatedAt, &t.PromotedAt)
+}
+
+// SaveTemplate stores t as the next, inactive version of its name and
+// channel.
+func (d *DB) SaveTemplate(ctx context.Context, t *MessageTemplate) error {
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := tx.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) + 1 FROM message_templates WHERE name=? AND channel=?`, t.Name, t.Channel).Scan(&t.Version); err != nil {
+		return err
+	}
+	t.Active, t.PromotedAt = false, ""
+	t.CreatedBy, t.CreatedAt = strings.ToLower(t.CreatedBy), time.Now().UTC().Format(time.RFC3339)
+	if _, err := tx.ExecContext(ctx, `INSERT INTO message_templates (`+templateColumns+`) VALUES (?, ?, ?, ?, ?, 0, ?, ?, '')`,
+		t.Name, t.Channel, t.Version, t.Title, t.Body, t.CreatedBy, t.CreatedAt); err != nil {
+		return err
+	}
+	if err := writeAudit(ctx, tx, t.CreatedBy, "template.saved", t.Name, fmt.Sprintf("%s version %d", t.Channel, t.Version)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetTemplate returns the given version, or the active one when version
+// is 0.
+func (d *DB) GetTemplate(ctx context.Context, name, channel string, version int) (*MessageTemplate, bool, error) {
+	q := `SELECT ` + templateColumns + ` FROM message_templates WHERE name=? AND channel=?`
+	args := []any{name, channel}
+	if version > 0 {
+		q += ` AND version=?`
+		args = append(args, version)
+	} else {
+		q += ` AND active=1`
+	}
+	var t MessageTemplate
+	err := scanTemplate(d.queryRow(ctx, q, args...), &t)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return &t, true, nil
+}
+
+// ListTemplates returns template versions newest first, filtered by name
+// and channel when given.
+func (d *DB) ListTemplates(ctx context.Context, name, channel string) ([]MessageTemplate, error) {
+	rows, err := d.query(ctx, `SELECT `+templateColumns+` FROM message_templates WHERE (?='' OR name=?) AND (?='' OR channel=?)
+		ORDER BY name, channel, version DESC`, name, name, channel, channel)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []MessageTemplate{}
+	for rows.Next() {
+		var t MessageTemplate
+		if err := scanTemplate(rows, &t); err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+// PromoteTemplate makes version the active one for its name and channel.
+// Promoting an older version is how a copy change is rolled back.
+func (d *DB) PromoteTemplate(ctx context.Context, name, channel string, version int, actor string) (*MessageTemplate, error) {
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	var t MessageTemplate
+	err = scanTemplate(tx.QueryRowContext(ctx, `SELECT `+templateColumns+` FROM message_templates WHERE name=? AND channel=? AND version=?`, name, channel, version), &t)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTemplateNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	t.Active, t.PromotedAt = true, time.Now().UTC().Format(time.RFC3339)
+	if _, err := tx.ExecContext(ctx, `UPDATE message_templates SET active=(version=?), promoted_at=CASE WHEN version=? THEN ? ELSE promoted_at END
+		WHERE name=? AND channel=?`, version, version, t.PromotedAt, name, channel); err != nil {
+		return nil, err
+	}
+	if err := writeAudit(ctx, tx, actor, "template.promoted", name, fmt.Sprintf("%s version %d", channel, version)); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
@@ -0,0 +1,133 @@
+package db
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// Chore timeline entry kinds.
+const (
+	TimelineCreated      = "created"
+	TimelineAssigned     = "assigned"
+	TimelineReopened     = "reopened"
+	TimelineSubmitted    = "submitted"
+	TimelineRejected     = "rejected"
+	TimelineApproved     = "approved"
+	TimelineAcknowledged = "acknowledged"
+	TimelineWaived       = "waived"
+	TimelinePaid         = "paid"
+)
+
+// Who a timeline entry is attributed to.
+const (
+	ActorParent = "parent"
+	ActorKid    = "kid"
+	ActorSystem = "system"
+	// ActorDelegate is an adult the parent delegated verification to.
+	ActorDelegate = "delegate"
+	// ActorAssistant is the parent speaking through a linked voice
+	// assistant.
+	ActorAssistant = "assistant"
+)
+
+// ChoreEntry is one step in a chore's history. Ref is the kid's wallet for
+// assigned entries, the signing device for submitted ones sent signed, the
+// delegation for a delegate's decision, the assistant link for a decision
+// made by voice, and the transfer id for paid ones.
+type ChoreEntry struct {
+	Seq       int64  `json:"seq"`
+	Kind      string `json:"kind"`
+	Actor     string `json:"actor"`
+	Note      string `json:"note,omitempty"`
+	Ref       string `json:"ref,omitempty"`
+	CreatedAt string `json:"created_at"`
+}
+
+// TimelineSummary is what chore lists carry instead of the full timeline.
+type TimelineSummary struct {
+	Entries int    `json:"entries"`
+	Last    string `json:"last"`
+	LastAt  string `json:"last_at"`
+}
+
+// statusEntry names the timeline entry for a chore moving to status.
+func statusEntry(kind string, status int) (entry, actor string, ok bool) {
+	if kind == ChoreKindPenalty {
+		switch status {
+		case 3:
+			return TimelineAcknowledged, ActorKid, true
+		case 4:
+			return TimelineWaived, ActorParent, true
+		}
+		return "", "", false
+	}
+	switch status {
+	case 0:
+		return TimelineAssigned, ActorParent, true
+	case 1:
+		return TimelineSubmitted, ActorKid, true
+	case 3:
+		return TimelineApproved, ActorParent, true
+	case 4:
+		return TimelineRejected, ActorParent, true
+	}
+	return "", "", false
+}
+
+func addChoreEntry(ctx context.Context, ex execer, choreID, kind, actor, note, ref string) error {
+	_, err := ex.ExecContext(ctx, `INSERT INTO chore_timeline (chore_id, seq, kind, actor, note, ref, created_at)
+		SELECT ?, COALESCE(MAX(seq), 0) + 1, ?, ?, ?, ?, ? FROM chore_timeline WHERE chore_id=?`,
+		choreID, kind, actor, note, ref, time.Now().UTC().Format(time.RFC3339), choreID)
+	return err
+}
+
+// ChoreTimeline returns a chore's entries in order. Chores created before
+// timelines were recorded start at whatever happened to them since.
+func (d *DB) ChoreTimeline(ctx context.Context, choreID string) ([]ChoreEntry, error) {
+	rows, err := d.query(ctx, `SELECT seq, kind, actor, note, ref, created_at FROM chore_timeline WHERE chore_id=? ORDER BY seq`, choreID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []ChoreEntry{}
+	for rows.Next() {
+		var e ChoreEntry
+		if err := rows.Scan(&e.Seq, &e.Kind, &e.Actor, &e.Note, &e.Ref, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+// TimelineSummaries summarizes the timelines of the given chores in one
+// query. Chores without entries are absent from the map.
+func (d *DB) TimelineSummaries(ctx context.Context, choreIDs []string) (map[string]TimelineSummary, error) {
+	out := map[string]TimelineSummary{}
+	if len(choreIDs) == 0 {
+		return out, nil
+	}
+	args := make([]any, len(choreIDs))
+	for i, id := range choreIDs {
+		args[i] = id
+	}
+	rows, err := d.SQL.QueryContext(ctx, `SELECT t.chore_id, n.entries, t.kind, t.created_at
+		FROM chore_timeline t
+		JOIN (SELECT chore_id, COUNT(*) AS entries, MAX(seq) AS last FROM chore_timeline
+			WHERE chore_id IN (?`+strings.Repeat(", ?", len(args)-1)+`) GROUP BY chore_id) n
+		ON n.chore_id = t.chore_id AND n.last = t.seq`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id string
+		var s TimelineSummary
+		if err := rows.Scan(&id, &s.Entries, &s.Last, &s.LastAt); err != nil {
+			return nil, err
+		}
+		out[id] = s
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,178 @@
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"backend_mini/internal/util"
+)
+
+// TokenPrefix marks personal access tokens so they are easy to spot in
+// config files and secret scanners.
+const TokenPrefix = "sona_pat_"
+
+var ErrTokenNotFound = errors.New("token not found")
+
+// APIToken is a parent's personal access token. Only its SHA-256 is stored;
+// the raw value is returned once, at creation.
+type APIToken struct {
+	TokenID     string   `json:"token_id"`
+	ParentEmail string   `json:"parent_email"`
+	Name        string   `json:"name"`
+	Scopes      []string `json:"scopes"`
+	CreatedAt   string   `json:"created_at"`
+	ExpiresAt   string   `json:"expires_at"`
+	LastUsedAt  string   `json:"last_used_at,omitempty"`
+	RevokedAt   string   `json:"revoked_at,omitempty"`
+}
+
+func (t *APIToken) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func hashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateAPIToken issues a token and returns it with its raw value.
+func (d *DB) CreateAPIToken(ctx context.Context, parentEmail, name string, scopes []string, ttl time.Duration) (*APIToken, string, error) {
+	id, err := util.NewID()
+	if err != nil {
+		return nil, "", err
+	}
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", err
+	}
+	raw := TokenPrefix + strings.ToLower(id) + "_" + hex.EncodeToString(secret)
+	now := time.Now().UTC()
+	t := APIToken{
+		TokenID:     id,
+		ParentEmail: strings.ToLower(parentEmail),
+		Name:        name,
+		Scopes:      scopes,
+		CreatedAt:   now.Format(time.RFC3339),
+		ExpiresAt:   now.Add(ttl).Format(time.RFC3339),
+	}
+	buf, err := json.Marshal(t.Scopes)
+	if err != nil {
+		return nil, "", err
+	}
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	defer func() { _ = tx.Rollback() }()
+	if _, err := tx.ExecContext(ctx, `INSERT INTO api_tokens (token_id, parent_email, name, token_hash, scopes, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		t.TokenID, t.ParentEmail, t.Name, hashToken(raw), string(buf), t.CreatedAt, t.ExpiresAt); err != nil {
+		return nil, "", err
+	}
+	if err := writeAudit(ctx, tx, t.ParentEmail, "token.create", t.ParentEmail, t.TokenID+" "+string(buf)); err != nil {
+		return nil, "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, "", err
+	}
+	return &t, raw, nil
+}
+
+const tokenColumns = `token_id, parent_email, name, scopes, created_at, expires_at, last_used_at, revoked_at`
+
+func scanToken(row rowScanner, t *APIToken) error {
+	var scopes string
+	if err := row.Scan(&t.TokenID, &t.ParentEmail, &t.Name, &scopes, &t.CreatedAt, &t.ExpiresAt, &t.LastUsedAt, &t.RevokedAt); err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(scopes), &t.Scopes)
+}
+
+// LookupAPIToken resolves a raw token that is neither revoked nor expired.
+func (d *DB) LookupAPIToken(ctx context.Context, raw string, now time.Time) (*APIToken, error) {
+	var t APIToken
+	err := scanToken(d.queryRow(ctx, `SELECT `+tokenColumns+` FROM api_tokens WHERE token_hash=? AND revoked_at='' AND expires_at>?`,
+		hashToken(raw), now.UTC().Format(time.RFC3339)), &t)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (d *DB) TouchAPIToken(ctx context.Context, tokenID string) error {
+	_, err := d.exec(ctx, `UPDATE api_tokens SET last_used_at=? WHERE token_id=?`, time.Now().UTC().Format(time.RFC3339), tokenID)
+	return err
+}
+
+func (d *DB) ListAPITokens(ctx context.Context, parentEmail string) ([]APIToken, error) {
+	rows, err := d.query(ctx, `SELECT `+tokenColumns+` FROM api_tokens WHERE parent_email=? ORDER BY created_at DESC`, strings.ToLower(parentEmail))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []APIToken{}
+	for rows.Next() {
+		var t APIToken
+		if err := scanToken(rows, &t); err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+func (d *DB) RevokeAPIToken(ctx context.Context, parentEmail, tokenID string) error {
+	parentEmail = strings.ToLower(parentEmail)
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	res, err := tx.ExecContext(ctx, `UPDATE api_tokens SET revoked_at=? WHERE token_id=? AND parent_email=? AND revoked_at=''`,
+		time.Now().UTC().Format(time.RFC3339), tokenID, parentEmail)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrTokenNotFound
+	}
+	if err := writeAudit(ctx, tx, parentEmail, "token.revoke", parentEmail, tokenID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetChoreParentWallet returns the parent wallet a chore belongs to.
+func (d *DB) GetChoreParentWallet(ctx context.Context, choreID string) (string, bool, error) {
+	var wallet string
+	err := d.queryRow(ctx, `SELECT parent_wallet FROM chores WHERE chore_id=?`, choreID).Scan(&wallet)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
+	return wallet, err == nil, err
+}
+
+// GetOverrideParentEmail returns the parent that issued a limit override.
+func (d *DB) GetOverrideParentEmail(ctx context.Context, overrideID string) (string, bool, error) {
+	var email string
+	err := d.queryRow(ctx, `SELECT parent_email FROM limit_overrides WHERE override_id=?`, overrideID).Scan(&email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
+	return email, err == nil, err
+}
@@ -0,0 +1,282 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"backend_mini/internal/util"
+)
+
+// Kinds of trashed items.
+const (
+	TrashChore = "chore"
+	TrashLimit = "limit"
+)
+
+var (
+	ErrTrashNotFound  = errors.New("nothing in the trash with that id")
+	ErrChoreNotFound  = errors.New("chore not found")
+	ErrChoreSettled   = errors.New("approved chores cannot be deleted")
+	ErrLimitNotFound  = errors.New("limit not found")
+	ErrRestoreBlocked = errors.New("a newer item has taken its place; delete that first")
+)
+
+// trashKind says where a kind of item lives and which quota a restore
+// counts against.
+type trashKind struct {
+	table, key, quota string
+}
+
+var trashKinds = map[string]trashKind{
+	TrashChore: {"chores", "chore_id", QuotaOpenChores},
+	TrashLimit: {"app_limits", "limit_id", QuotaLimits},
+}
+
+// TrashItem is a deleted row kept until ExpiresAt so it can be restored.
+// Data is the row as it was, column by column.
+type TrashItem struct {
+	TrashID     string          `json:"trash_id"`
+	Kind        string          `json:"kind"`
+	ItemID      string          `json:"item_id"`
+	ParentEmail string          `json:"parent_email"`
+	KidEmail    string          `json:"kid_email,omitempty"`
+	Label       string          `json:"label"`
+	Data        json.RawMessage `json:"data"`
+	DeletedBy   string          `json:"deleted_by"`
+	DeletedAt   string          `json:"deleted_at"`
+	ExpiresAt   string          `json:"expires_at"`
+}
+
+const trashColumns = `trash_id, kind, item_id, parent_email, kid_email, label, data, deleted_by, deleted_at, expires_at`
+
+func scanTrashItem(row rowScanner, t *TrashItem) error {
+	var data string
+	if err := row.Scan(&t.TrashID, &t.Kind, &t.ItemID, &t.ParentEmail, &t.KidEmail, &t.Label, &data, &t.DeletedBy, &t.DeletedAt, &t.ExpiresAt); err != nil {
+		return err
+	}
+	t.Data = json.RawMessage(data)
+	return nil
+}
+
+// SetTrashRetention sets how long deleted items can be restored. Call it
+// before serving.
+func (d *DB) SetTrashRetention(ttl time.Duration) { d.trashTTL = ttl }
+
+// moveToTrash copies the row of kind identified by id into the trash and
+// deletes it, inside tx. The table and key come from trashKinds, never
+// from a request.
+func (d *DB) moveToTrash(ctx context.Context, tx *sql.Tx, kind, id, parentEmail, kidEmail, label, deletedBy string) (*TrashItem, error) {
+	k := trashKinds[kind]
+	rows, err := tx.QueryContext(ctx, `SELECT * FROM `+k.table+` WHERE `+k.key+`=?`, id)
+	if err != nil {
+		return nil, err
+	}
+	cols, err := rows.Columns()
+	if err != nil {
+		rows.Close()
+		return nil, err
+	}
+	if !rows.Next() {
+		rows.Close()
+		return nil, sql.ErrNoRows
+	}
+	vals := make([]any, len(cols))
+	ptrs := make([]any, len(cols))
+	for i := range vals {
+		ptrs[i] = &vals[i]
+	}
+	err = rows.Scan(ptrs...)
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+	rec := map[string]any{}
+	for i, c := range cols {
+		if v, ok := vals[i].([]byte); ok {
+			vals[i] = string(v)
+		}
+		rec[c] = vals[i]
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return nil, err
+	}
+	trashID, err := util.NewID()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	t := &TrashItem{
+		TrashID:     trashID,
+		Kind:        kind,
+		ItemID:      id,
+		ParentEmail: strings.ToLower(parentEmail),
+		KidEmail:    strings.ToLower(kidEmail),
+		Label:       label,
+		Data:        data,
+		DeletedBy:   strings.ToLower(deletedBy),
+		DeletedAt:   now.Format(time.RFC3339),
+		ExpiresAt:   now.Add(d.trashTTL).Format(time.RFC3339),
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO trash (`+trashColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		t.TrashID, t.Kind, t.ItemID, t.ParentEmail, t.KidEmail, t.Label, string(t.Data), t.DeletedBy, t.DeletedAt, t.ExpiresAt); err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM `+k.table+` WHERE `+k.key+`=?`, id); err != nil {
+		return nil, err
+	}
+	if err := writeAudit(ctx, tx, t.DeletedBy, kind+".delete", id, t.TrashID); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// DeleteChore moves a chore that has not been approved to the trash.
+// parentWallet must be the wallet the chore was created from.
+func (d *DB) DeleteChore(ctx context.Context, choreID, parentEmail, parentWallet string) (*TrashItem, error) {
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var c Chore
+	err = scanChore(tx.QueryRowContext(ctx, `SELECT `+choreColumns+` FROM chores WHERE chore_id=?`, choreID), &c)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && (parentWallet == "" || c.ParentWallet != parentWallet)) {
+		return nil, ErrChoreNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if c.ChoreStatus >= 3 {
+		return nil, ErrChoreSettled
+	}
+	var kidEmail string
+	if c.ChildWallet != "" {
+		if err := tx.QueryRowContext(ctx, `SELECT email FROM children WHERE wallet=?`, c.ChildWallet).Scan(&kidEmail); err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+	}
+	t, err := d.moveToTrash(ctx, tx, TrashChore, choreID, parentEmail, kidEmail, c.ChoreName, parentEmail)
+	if err != nil {
+		return nil, err
+	}
+	return t, tx.Commit()
+}
+
+// DeleteAppLimit moves one of the parent's limits to the trash.
+func (d *DB) DeleteAppLimit(ctx context.Context, limitID, parentEmail string) (*TrashItem, error) {
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var l AppLimit
+	err = scanAppLimit(tx.QueryRowContext(ctx, `SELECT `+appLimitColumns+` FROM app_limits WHERE limit_id=? AND parent_email=?`, limitID, strings.ToLower(parentEmail)), &l)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrLimitNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	t, err := d.moveToTrash(ctx, tx, TrashLimit, limitID, l.ParentEmail, l.KidEmail, l.App, parentEmail)
+	if err != nil {
+		return nil, err
+	}
+	return t, tx.Commit()
+}
+
+// ListTrash returns the family's restorable items, newest deletion first.
+func (d *DB) ListTrash(ctx context.Context, parentEmail string, now time.Time) ([]TrashItem, error) {
+	rows, err := d.query(ctx, `SELECT `+trashColumns+` FROM trash WHERE parent_email=? AND expires_at>? ORDER BY deleted_at DESC, trash_id`,
+		strings.ToLower(parentEmail), now.UTC().Format(time.RFC3339))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []TrashItem{}
+	for rows.Next() {
+		var t TrashItem
+		if err := scanTrashItem(rows, &t); err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+// Restore puts a trashed item back exactly as it was, under its old id.
+// It counts against the family's quota again, and fails with
+// ErrRestoreBlocked when a row made since takes its place, such as a new
+// limit for the same kid and app.
+func (d *DB) Restore(ctx context.Context, parentEmail, trashID string, now time.Time) (*TrashItem, error) {
+	parentEmail = strings.ToLower(parentEmail)
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var t TrashItem
+	err = scanTrashItem(tx.QueryRowContext(ctx, `SELECT `+trashColumns+` FROM trash WHERE trash_id=? AND parent_email=? AND expires_at>?`,
+		trashID, parentEmail, now.UTC().Format(time.RFC3339)), &t)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTrashNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	k, ok := trashKinds[t.Kind]
+	if !ok {
+		return nil, ErrTrashNotFound
+	}
+	var rec map[string]any
+	dec := json.NewDecoder(bytes.NewReader(t.Data))
+	dec.UseNumber()
+	if err := dec.Decode(&rec); err != nil {
+		return nil, err
+	}
+	// settled chores are never trashed, so every restored chore is open
+	if err := d.checkQuota(ctx, tx, parentEmail, k.quota); err != nil {
+		return nil, err
+	}
+	cols := make([]string, 0, len(rec))
+	args := make([]any, 0, len(rec))
+	for c, v := range rec {
+		if n, ok := v.(json.Number); ok {
+			v = n.String()
+		}
+		cols = append(cols, c)
+		args = append(args, v)
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO `+k.table+` (`+strings.Join(cols, ", ")+`) VALUES (?`+strings.Repeat(", ?", len(cols)-1)+`)`, args...)
+	if err != nil {
+		if uniqueViolation(err) != "" {
+			return nil, ErrRestoreBlocked
+		}
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM trash WHERE trash_id=?`, trashID); err != nil {
+		return nil, err
+	}
+	if err := writeAudit(ctx, tx, parentEmail, t.Kind+".restore", t.ItemID, t.TrashID); err != nil {
+		return nil, err
+	}
+	return &t, tx.Commit()
+}
+
+// PurgeTrash drops items whose restore window closed by now.
+func (d *DB) PurgeTrash(ctx context.Context, now time.Time) (int64, error) {
+	res, err := d.exec(ctx, `DELETE FROM trash WHERE expires_at<=?`, now.UTC().Format(time.RFC3339))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
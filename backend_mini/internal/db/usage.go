@@ -0,0 +1,112 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	UsageStored    = "stored"
+	UsageUpdated   = "updated"
+	UsageDuplicate = "duplicate"
+	// UsageStale is a sequenced record that arrived too far out of order.
+	UsageStale = "stale"
+)
+
+type UsageRecord struct {
+	DeviceID string `json:"device_id"`
+	KidEmail string `json:"kid_email"`
+	App      string `json:"app"`
+	Day      string `json:"day"`
+	Minutes  int    `json:"minutes"`
+	// Seq is the device's sequence number for the record; zero means the
+	// device does not number its reports.
+	Seq uint64 `json:"seq,omitempty"`
+}
+
+// UpsertUsage stores records keyed by (device, app, day) in one transaction.
+// Devices report running daily totals, so a record only replaces a stored
+// one when it carries more minutes; re-sent batches are reported as
+// duplicates, as are sequenced records whose number was already seen.
+// The returned slice holds one status per record.
+func (d *DB) UpsertUsage(ctx context.Context, records []UsageRecord) ([]string, error) {
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	statuses := make([]string, len(records))
+	for i, rec := range records {
+		if rec.Seq != 0 {
+			outcome, err := checkSeq(ctx, tx, rec.DeviceID, SeqStreamUsage, rec.Seq, false)
+			if err != nil {
+				return nil, err
+			}
+			if outcome != SeqAccepted {
+				statuses[i] = UsageDuplicate
+				if outcome == SeqStale {
+					statuses[i] = UsageStale
+				}
+				continue
+			}
+		}
+		var prev int
+		err := tx.QueryRowContext(ctx, `SELECT minutes FROM usage_reports WHERE device_id=? AND app=? AND day=?`, rec.DeviceID, rec.App, rec.Day).Scan(&prev)
+		switch {
+		case err == nil && prev >= rec.Minutes:
+			statuses[i] = UsageDuplicate
+			continue
+		case err == nil:
+			statuses[i] = UsageUpdated
+		case errors.Is(err, sql.ErrNoRows):
+			statuses[i] = UsageStored
+		default:
+			return nil, err
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO usage_reports (device_id, kid_email, app, day, minutes, updated_at) VALUES (?, ?, ?, ?, ?, ?)
+			ON CONFLICT(device_id, app, day) DO UPDATE SET minutes=excluded.minutes, updated_at=excluded.updated_at
+		`, rec.DeviceID, strings.ToLower(rec.KidEmail), rec.App, rec.Day, rec.Minutes, now); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return statuses, nil
+}
+
+// AppUsage is a kid's usage of one app on one day, summed over devices.
+type AppUsage struct {
+	App     string      `json:"app"`
+	Day     string      `json:"day"`
+	Minutes int         `json:"minutes"`
+	AppInfo *CatalogApp `json:"app_info,omitempty"`
+}
+
+func (d *DB) GetUsage(ctx context.Context, kidEmail, from, to string) ([]AppUsage, error) {
+	rows, err := d.query(ctx, `
+		SELECT app, day, SUM(minutes) FROM usage_reports
+		WHERE kid_email=? AND day>=? AND day<=?
+		GROUP BY app, day ORDER BY day, app
+	`, strings.ToLower(kidEmail), from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []AppUsage{}
+	for rows.Next() {
+		var u AppUsage
+		if err := rows.Scan(&u.App, &u.Day, &u.Minutes); err != nil {
+			return nil, err
+		}
+		out = append(out, u)
+	}
+	return out, rows.Err()
+}
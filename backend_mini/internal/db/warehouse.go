@@ -0,0 +1,194 @@
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// WarehouseTable is a table the warehouse export copies, with the columns
+// that identify a row.
+type WarehouseTable struct {
+	Name string
+	Keys []string
+}
+
+// WarehouseTables are exported in this order.
+var WarehouseTables = []WarehouseTable{
+	{"chores", []string{"chore_id"}},
+	{"transfers", []string{"transfer_id"}},
+	{"transfer_legs", []string{"transfer_id", "to_wallet"}},
+	{"usage_reports", []string{"device_id", "app", "day"}},
+	{"app_limits", []string{"limit_id"}},
+}
+
+// WarehouseColumn is a column as the table declares it today.
+type WarehouseColumn struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// WarehouseBatch is what changed in a table since its last committed
+// export: rows that are new or differ, and keys of rows that are gone.
+type WarehouseBatch struct {
+	Table   string
+	Columns []WarehouseColumn
+	Rows    []map[string]any
+	Deleted []map[string]any
+
+	hashes  map[string]string
+	removed []string
+}
+
+// TableColumns lists a table's columns in declaration order, as the
+// analytics snapshot has them.
+func (d *DB) TableColumns(ctx context.Context, table string) ([]WarehouseColumn, error) {
+	rows, err := d.analytics().QueryContext(ctx, `SELECT name, type FROM pragma_table_info(?) ORDER BY cid`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []WarehouseColumn{}
+	for rows.Next() {
+		var c WarehouseColumn
+		if err := rows.Scan(&c.Name, &c.Type); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// WarehouseChanges compares every row of t with the hash recorded at its
+// last export. Tables carry no reliable updated_at, so a row is sent again
+// whenever any column differs, including a column added since. Rows come
+// from the analytics snapshot; the hashes from the live database.
+func (d *DB) WarehouseChanges(ctx context.Context, t WarehouseTable) (*WarehouseBatch, error) {
+	cols, err := d.TableColumns(ctx, t.Name)
+	if err != nil {
+		return nil, err
+	}
+	seen, err := d.warehouseHashes(ctx, t.Name)
+	if err != nil {
+		return nil, err
+	}
+	b := &WarehouseBatch{Table: t.Name, Columns: cols, Rows: []map[string]any{}, Deleted: []map[string]any{}, hashes: map[string]string{}}
+	names := make([]string, len(cols))
+	for i, c := range cols {
+		names[i] = c.Name
+	}
+	// the table name comes from WarehouseTables, never from a request
+	rows, err := d.analytics().QueryContext(ctx, `SELECT `+strings.Join(names, ", ")+` FROM `+t.Name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	present := map[string]bool{}
+	for rows.Next() {
+		vals := make([]any, len(cols))
+		ptrs := make([]any, len(cols))
+		for i := range vals {
+			ptrs[i] = &vals[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		rec := map[string]any{}
+		for i, c := range cols {
+			if v, ok := vals[i].([]byte); ok {
+				vals[i] = string(v)
+			}
+			rec[c.Name] = vals[i]
+		}
+		key, err := warehouseKey(rec, t.Keys)
+		if err != nil {
+			return nil, err
+		}
+		present[key] = true
+		buf, err := json.Marshal(rec)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(buf)
+		hash := hex.EncodeToString(sum[:])
+		if seen[key] != hash {
+			b.Rows = append(b.Rows, rec)
+			b.hashes[key] = hash
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for key := range seen {
+		if present[key] {
+			continue
+		}
+		var parts []any
+		if err := json.Unmarshal([]byte(key), &parts); err != nil {
+			return nil, err
+		}
+		rec := map[string]any{}
+		for i, k := range t.Keys {
+			rec[k] = parts[i]
+		}
+		b.Deleted = append(b.Deleted, rec)
+		b.removed = append(b.removed, key)
+	}
+	return b, nil
+}
+
+func warehouseKey(rec map[string]any, keys []string) (string, error) {
+	parts := make([]any, len(keys))
+	for i, k := range keys {
+		parts[i] = rec[k]
+	}
+	buf, err := json.Marshal(parts)
+	return string(buf), err
+}
+
+func (d *DB) warehouseHashes(ctx context.Context, table string) (map[string]string, error) {
+	rows, err := d.query(ctx, `SELECT row_key, row_hash FROM warehouse_rows WHERE table_name=?`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := map[string]string{}
+	for rows.Next() {
+		var key, hash string
+		if err := rows.Scan(&key, &hash); err != nil {
+			return nil, err
+		}
+		out[key] = hash
+	}
+	return out, rows.Err()
+}
+
+// CommitWarehouseBatch records b as exported, so the next export only
+// carries what changed after it. Call it once b's file is safely written.
+func (d *DB) CommitWarehouseBatch(ctx context.Context, b *WarehouseBatch) error {
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	now := time.Now().UTC().Format(time.RFC3339)
+	for key, hash := range b.hashes {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO warehouse_rows (table_name, row_key, row_hash, exported_at) VALUES (?, ?, ?, ?)
+			ON CONFLICT(table_name, row_key) DO UPDATE SET row_hash=excluded.row_hash, exported_at=excluded.exported_at`,
+			b.Table, key, hash, now); err != nil {
+			return err
+		}
+	}
+	for _, key := range b.removed {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM warehouse_rows WHERE table_name=? AND row_key=?`, b.Table, key); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
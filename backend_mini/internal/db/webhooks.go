@@ -0,0 +1,129 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"backend_mini/internal/util"
+)
+
+var ErrWebhookNotFound = errors.New("webhook not found")
+
+// Webhook is a signed delivery endpoint for a parent's events. Filter, when
+// set, is an eventfilter expression an event must match to be delivered;
+// Transform, when set, is a relay template whose rendering replaces the
+// event's data.
+type Webhook struct {
+	WebhookID   string            `json:"webhook_id"`
+	ParentEmail string            `json:"parent_email"`
+	URL         string            `json:"url"`
+	Secret      string            `json:"secret,omitempty"`
+	Filter      string            `json:"filter,omitempty"`
+	Transform   map[string]string `json:"transform,omitempty"`
+	CreatedAt   string            `json:"created_at"`
+}
+
+func (d *DB) CreateWebhook(ctx context.Context, parentEmail, url, secret, filter string, transform map[string]string) (*Webhook, error) {
+	id, err := util.NewID()
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := marshalTransform(transform)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	tx, err := d.SQL.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+	if err := d.checkQuota(ctx, tx, parentEmail, QuotaWebhooks); err != nil {
+		return nil, err
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO webhooks (webhook_id, parent_email, url, secret, filter, transform, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		id, strings.ToLower(parentEmail), url, secret, filter, tmpl, now)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &Webhook{WebhookID: id, ParentEmail: strings.ToLower(parentEmail), URL: url, Secret: secret, Filter: filter, Transform: transform, CreatedAt: now}, nil
+}
+
+// SetWebhookShaping replaces the webhook's filter and transform; empty
+// values clear them.
+func (d *DB) SetWebhookShaping(ctx context.Context, parentEmail, webhookID, filter string, transform map[string]string) (*Webhook, error) {
+	tmpl, err := marshalTransform(transform)
+	if err != nil {
+		return nil, err
+	}
+	res, err := d.exec(ctx, `UPDATE webhooks SET filter=?, transform=? WHERE webhook_id=? AND parent_email=?`,
+		filter, tmpl, webhookID, strings.ToLower(parentEmail))
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, ErrWebhookNotFound
+	}
+	wh, _, err := d.GetWebhook(ctx, webhookID)
+	return wh, err
+}
+
+func marshalTransform(transform map[string]string) (string, error) {
+	if len(transform) == 0 {
+		return "", nil
+	}
+	buf, err := json.Marshal(transform)
+	return string(buf), err
+}
+
+const webhookColumns = `webhook_id, parent_email, url, secret, filter, transform, created_at`
+
+func scanWebhook(row rowScanner, wh *Webhook) error {
+	var tmpl string
+	if err := row.Scan(&wh.WebhookID, &wh.ParentEmail, &wh.URL, &wh.Secret, &wh.Filter, &tmpl, &wh.CreatedAt); err != nil {
+		return err
+	}
+	if tmpl != "" {
+		return json.Unmarshal([]byte(tmpl), &wh.Transform)
+	}
+	return nil
+}
+
+func (d *DB) GetWebhook(ctx context.Context, webhookID string) (*Webhook, bool, error) {
+	var wh Webhook
+	if err := scanWebhook(d.queryRow(ctx, `SELECT `+webhookColumns+` FROM webhooks WHERE webhook_id=?`, webhookID), &wh); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	return &wh, true, nil
+}
+
+func (d *DB) GetWebhooksByParentEmail(ctx context.Context, parentEmail string) ([]Webhook, error) {
+	rows, err := d.query(ctx, `SELECT `+webhookColumns+` FROM webhooks WHERE parent_email=? ORDER BY created_at`, strings.ToLower(parentEmail))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hooks := []Webhook{}
+	for rows.Next() {
+		var wh Webhook
+		if err := scanWebhook(rows, &wh); err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, wh)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return hooks, nil
+}
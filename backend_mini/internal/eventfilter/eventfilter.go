@@ -0,0 +1,481 @@
+// Package eventfilter evaluates the filter expressions webhook
+// subscriptions carry. The language is the part of CEL that filters need:
+//
+//	type == "chore.completed" && data.bounty_amount > 10000000
+//	data.child_wallet in ["8Sy...", "354..."] || !has(data.due_date)
+//
+// Paths (type, created_at, data.x.y, message.title) read the event as it
+// is delivered; a path the event lacks is null. Literals are numbers,
+// "strings" or 'strings', true, false, null and [lists]. Operators are
+// ==, !=, <, <=, >, >=, in, !, && and ||, with parentheses; has(path)
+// tests whether the event has a value there.
+package eventfilter
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// MaxLength bounds an expression, so a subscription cannot make every
+// delivery expensive.
+const MaxLength = 1024
+
+// Filter is a compiled expression.
+type Filter struct {
+	src  string
+	root node
+}
+
+// Compile parses expr. An empty expression matches every event.
+func Compile(expr string) (*Filter, error) {
+	expr = strings.TrimSpace(expr)
+	if expr == "" {
+		return &Filter{}, nil
+	}
+	if len(expr) > MaxLength {
+		return nil, fmt.Errorf("filter is longer than %d characters", MaxLength)
+	}
+	toks, err := lex(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+	root, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %q at %d", t.text, t.pos)
+	}
+	return &Filter{src: expr, root: root}, nil
+}
+
+func (f *Filter) String() string { return f.src }
+
+// Paths lists the paths the expression reads, for validation.
+func (f *Filter) Paths() []string {
+	var out []string
+	var walk func(n node)
+	walk = func(n node) {
+		switch n := n.(type) {
+		case pathNode:
+			out = append(out, string(n))
+		case hasNode:
+			out = append(out, string(n))
+		case notNode:
+			walk(n.x)
+		case binaryNode:
+			walk(n.l)
+			walk(n.r)
+		case listNode:
+			for _, x := range n {
+				walk(x)
+			}
+		}
+	}
+	if f.root != nil {
+		walk(f.root)
+	}
+	return out
+}
+
+// Match evaluates the filter against doc, the event as a JSON object. It
+// fails when the expression does not yield a bool or compares values that
+// have no order, such as a string with a number.
+func (f *Filter) Match(doc map[string]any) (bool, error) {
+	if f.root == nil {
+		return true, nil
+	}
+	v, err := f.root.eval(doc)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("filter yields %s, not a bool", typeName(v))
+	}
+	return b, nil
+}
+
+type tokKind int
+
+const (
+	tokEOF tokKind = iota
+	tokIdent
+	tokNumber
+	tokString
+	tokOp
+)
+
+type token struct {
+	kind tokKind
+	text string
+	pos  int
+}
+
+func lex(s string) ([]token, error) {
+	var toks []token
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '"' || c == '\'':
+			j := i + 1
+			var b strings.Builder
+			for ; j < len(s) && s[j] != c; j++ {
+				if s[j] == '\\' && j+1 < len(s) {
+					j++
+				}
+				b.WriteByte(s[j])
+			}
+			if j >= len(s) {
+				return nil, fmt.Errorf("unterminated string at %d", i)
+			}
+			toks = append(toks, token{tokString, b.String(), i})
+			i = j + 1
+		case c >= '0' && c <= '9' || c == '-' && i+1 < len(s) && s[i+1] >= '0' && s[i+1] <= '9':
+			j := i + 1
+			for j < len(s) && (s[j] >= '0' && s[j] <= '9' || s[j] == '.') {
+				j++
+			}
+			toks = append(toks, token{tokNumber, s[i:j], i})
+			i = j
+		case c == '_' || unicode.IsLetter(rune(c)):
+			j := i + 1
+			for j < len(s) && (s[j] == '_' || s[j] == '.' || unicode.IsLetter(rune(s[j])) || s[j] >= '0' && s[j] <= '9') {
+				j++
+			}
+			toks = append(toks, token{tokIdent, s[i:j], i})
+			i = j
+		default:
+			op := ""
+			for _, o := range []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!", "(", ")", "[", "]", ","} {
+				if strings.HasPrefix(s[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected %q at %d", c, i)
+			}
+			toks = append(toks, token{tokOp, op, i})
+			i += len(op)
+		}
+	}
+	return append(toks, token{tokEOF, "end of filter", len(s)}), nil
+}
+
+type parser struct {
+	toks []token
+	i    int
+}
+
+func (p *parser) peek() token { return p.toks[p.i] }
+
+func (p *parser) next() token {
+	t := p.toks[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+func (p *parser) accept(op string) bool {
+	if t := p.peek(); t.kind == tokOp && t.text == op {
+		p.i++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(op string) error {
+	if !p.accept(op) {
+		t := p.peek()
+		return fmt.Errorf("expected %q at %d, found %q", op, t.pos, t.text)
+	}
+	return nil
+}
+
+func (p *parser) or() (node, error) {
+	l, err := p.and()
+	for err == nil && p.accept("||") {
+		var r node
+		if r, err = p.and(); err == nil {
+			l = binaryNode{"||", l, r}
+		}
+	}
+	return l, err
+}
+
+func (p *parser) and() (node, error) {
+	l, err := p.not()
+	for err == nil && p.accept("&&") {
+		var r node
+		if r, err = p.not(); err == nil {
+			l = binaryNode{"&&", l, r}
+		}
+	}
+	return l, err
+}
+
+func (p *parser) not() (node, error) {
+	if p.accept("!") {
+		x, err := p.not()
+		return notNode{x}, err
+	}
+	return p.compare()
+}
+
+func (p *parser) compare() (node, error) {
+	l, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	switch {
+	case t.kind == tokOp && (t.text == "==" || t.text == "!=" || t.text == "<" || t.text == "<=" || t.text == ">" || t.text == ">="):
+	case t.kind == tokIdent && t.text == "in":
+	default:
+		return l, nil
+	}
+	p.next()
+	r, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	return binaryNode{t.text, l, r}, nil
+}
+
+func (p *parser) primary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad number %q at %d", t.text, t.pos)
+		}
+		return literal{f}, nil
+	case tokString:
+		return literal{t.text}, nil
+	case tokIdent:
+		switch t.text {
+		case "true", "false":
+			return literal{t.text == "true"}, nil
+		case "null":
+			return literal{nil}, nil
+		case "has":
+			if err := p.expect("("); err != nil {
+				return nil, err
+			}
+			arg := p.next()
+			if arg.kind != tokIdent {
+				return nil, fmt.Errorf("has takes a path, at %d", arg.pos)
+			}
+			return hasNode(arg.text), p.expect(")")
+		}
+		return pathNode(t.text), nil
+	case tokOp:
+		switch t.text {
+		case "(":
+			x, err := p.or()
+			if err != nil {
+				return nil, err
+			}
+			return x, p.expect(")")
+		case "[":
+			var list listNode
+			for !p.accept("]") {
+				if len(list) > 0 {
+					if err := p.expect(","); err != nil {
+						return nil, err
+					}
+				}
+				x, err := p.primary()
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, x)
+			}
+			return list, nil
+		}
+	}
+	return nil, fmt.Errorf("unexpected %q at %d", t.text, t.pos)
+}
+
+type node interface {
+	eval(doc map[string]any) (any, error)
+}
+
+type literal struct{ v any }
+
+func (n literal) eval(map[string]any) (any, error) { return n.v, nil }
+
+type pathNode string
+
+func (n pathNode) eval(doc map[string]any) (any, error) { return lookup(doc, string(n)), nil }
+
+type hasNode string
+
+func (n hasNode) eval(doc map[string]any) (any, error) { return lookup(doc, string(n)) != nil, nil }
+
+type listNode []node
+
+func (n listNode) eval(doc map[string]any) (any, error) {
+	out := make([]any, len(n))
+	for i, x := range n {
+		v, err := x.eval(doc)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+type notNode struct{ x node }
+
+func (n notNode) eval(doc map[string]any) (any, error) {
+	v, err := n.x.eval(doc)
+	if err != nil {
+		return nil, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return nil, fmt.Errorf("! needs a bool, not %s", typeName(v))
+	}
+	return !b, nil
+}
+
+type binaryNode struct {
+	op   string
+	l, r node
+}
+
+func (n binaryNode) eval(doc map[string]any) (any, error) {
+	l, err := n.l.eval(doc)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "&&" || n.op == "||" {
+		lb, ok := l.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%s needs bools, not %s", n.op, typeName(l))
+		}
+		// short-circuit, as in CEL
+		if lb == (n.op == "||") {
+			return lb, nil
+		}
+		r, err := n.r.eval(doc)
+		if err != nil {
+			return nil, err
+		}
+		rb, ok := r.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%s needs bools, not %s", n.op, typeName(r))
+		}
+		return rb, nil
+	}
+	r, err := n.r.eval(doc)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "==":
+		return equal(l, r), nil
+	case "!=":
+		return !equal(l, r), nil
+	case "in":
+		list, ok := r.([]any)
+		if !ok {
+			return nil, fmt.Errorf("in needs a list, not %s", typeName(r))
+		}
+		for _, x := range list {
+			if equal(l, x) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	c, err := order(l, r)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", n.op, err)
+	}
+	switch n.op {
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	default:
+		return c >= 0, nil
+	}
+}
+
+func equal(l, r any) bool {
+	switch l := l.(type) {
+	case nil:
+		return r == nil
+	case float64, string, bool:
+		return l == r
+	}
+	return false
+}
+
+var errNoOrder = errors.New("values have no order")
+
+func order(l, r any) (int, error) {
+	switch l := l.(type) {
+	case float64:
+		if r, ok := r.(float64); ok {
+			return compare(l, r), nil
+		}
+	case string:
+		if r, ok := r.(string); ok {
+			return strings.Compare(l, r), nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %s and %s", errNoOrder, typeName(l), typeName(r))
+}
+
+func compare(l, r float64) int {
+	switch {
+	case l < r:
+		return -1
+	case l > r:
+		return 1
+	}
+	return 0
+}
+
+func typeName(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case float64:
+		return "a number"
+	case string:
+		return "a string"
+	case bool:
+		return "a bool"
+	case []any:
+		return "a list"
+	}
+	return "an object"
+}
+
+func lookup(doc map[string]any, path string) any {
+	var cur any = doc
+	for _, part := range strings.Split(path, ".") {
+		m, ok := cur.(map[string]any)
+		if !ok {
+			return nil
+		}
+		cur = m[part]
+	}
+	return cur
+}
@@ -0,0 +1,289 @@
+// Package fixtures loads families described in YAML into the database
+// through the store layer. cmd/seed uses it for development and demo
+// databases, and tests use it to set up the families they need.
+//
+//	families:
+//	  - parent:
+//	      email: parent@example.com
+//	      name: Parent
+//	      wallet: <base58>
+//	    kids:
+//	      - email: kid@example.com
+//	        name: Kid
+//	        wallet: <base58>
+//	        limits:
+//	          - app: com.example.game
+//	            minutes_per_day: 60
+//	            fee_extra_hour: 5
+//	    chores:
+//	      - kid: kid@example.com   # omit for an open chore
+//	        name: Dishes
+//	        bounty: 5
+//	        status: 0
+//	    settings:
+//	      timezone: Europe/Berlin
+package fixtures
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"backend_mini/internal/db"
+	"backend_mini/internal/util"
+)
+
+type File struct {
+	Families []Family `json:"families"`
+}
+
+type Family struct {
+	Parent   Person       `json:"parent"`
+	Kids     []Kid        `json:"kids"`
+	Chores   []Chore      `json:"chores"`
+	Settings *FamilyPrefs `json:"settings"`
+}
+
+type Person struct {
+	Email  string `json:"email"`
+	Name   string `json:"name"`
+	Wallet string `json:"wallet"`
+}
+
+type Kid struct {
+	Person
+	Limits []Limit `json:"limits"`
+}
+
+type Limit struct {
+	App           string `json:"app"`
+	MinutesPerDay int    `json:"minutes_per_day"`
+	FeeExtraHour  uint64 `json:"fee_extra_hour"`
+}
+
+type Chore struct {
+	// Kid is the assignee's email; empty makes an open chore.
+	Kid         string `json:"kid"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Bounty      uint64 `json:"bounty"`
+	DueDate     string `json:"due_date"`
+	Kind        string `json:"kind"`
+	Status      int    `json:"status"`
+}
+
+// FamilyPrefs is the subset of family settings fixtures may set.
+type FamilyPrefs struct {
+	Timezone string          `json:"timezone"`
+	Currency string          `json:"currency"`
+	Features map[string]bool `json:"features"`
+}
+
+// Result counts what a load wrote.
+type Result struct {
+	Parents int `json:"parents"`
+	Kids    int `json:"kids"`
+	Chores  int `json:"chores"`
+	Limits  int `json:"limits"`
+}
+
+// Parse reads and validates a fixture file. Unknown keys are errors, so a
+// typo does not silently load nothing.
+func Parse(src []byte) (*File, error) {
+	doc, err := parseYAML(src)
+	if err != nil {
+		return nil, fmt.Errorf("fixtures: %w", err)
+	}
+	buf, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.DisallowUnknownFields()
+	var f File
+	if err := dec.Decode(&f); err != nil {
+		return nil, fmt.Errorf("fixtures: %s", strings.TrimPrefix(err.Error(), "json: "))
+	}
+	return &f, f.validate()
+}
+
+func (f *File) validate() error {
+	for i, fam := range f.Families {
+		at := fmt.Sprintf("families[%d]", i)
+		if err := fam.Parent.validate(at + ".parent"); err != nil {
+			return err
+		}
+		kids := map[string]bool{}
+		for j, k := range fam.Kids {
+			kat := fmt.Sprintf("%s.kids[%d]", at, j)
+			if err := k.validate(kat); err != nil {
+				return err
+			}
+			kids[strings.ToLower(k.Email)] = true
+			for n, l := range k.Limits {
+				if l.App == "" || l.MinutesPerDay < 0 {
+					return fmt.Errorf("fixtures: %s.limits[%d]: app and a non-negative minutes_per_day are required", kat, n)
+				}
+			}
+		}
+		for j, c := range fam.Chores {
+			cat := fmt.Sprintf("%s.chores[%d]", at, j)
+			if c.Name == "" {
+				return fmt.Errorf("fixtures: %s: name is required", cat)
+			}
+			if c.Kid != "" && !kids[strings.ToLower(c.Kid)] {
+				return fmt.Errorf("fixtures: %s: kid %q is not one of this family's kids", cat, c.Kid)
+			}
+			if c.Kind != "" && c.Kind != db.ChoreKindChore && c.Kind != db.ChoreKindPenalty {
+				return fmt.Errorf("fixtures: %s: kind must be chore or penalty", cat)
+			}
+			if c.Status < 0 || c.Status > 4 {
+				return fmt.Errorf("fixtures: %s: status must be 0-4", cat)
+			}
+		}
+		if fam.Settings != nil {
+			if _, err := time.LoadLocation(fam.Settings.Timezone); err != nil {
+				return fmt.Errorf("fixtures: %s.settings: unknown timezone %q", at, fam.Settings.Timezone)
+			}
+			for feature := range fam.Settings.Features {
+				if !slices.Contains(db.Features, feature) {
+					return fmt.Errorf("fixtures: %s.settings: unknown feature %q", at, feature)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (p Person) validate(at string) error {
+	if p.Email == "" || p.Name == "" {
+		return fmt.Errorf("fixtures: %s: email and name are required", at)
+	}
+	if p.Wallet != "" {
+		if err := util.ValidateAddress(p.Wallet); err != nil {
+			return fmt.Errorf("fixtures: %s: %v", at, err)
+		}
+	}
+	return nil
+}
+
+// LoadFile parses path and loads it into d.
+func LoadFile(ctx context.Context, d *db.DB, path string) (*Result, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	return Load(ctx, d, f)
+}
+
+// Load writes every family. Parents and kids that already exist (by email)
+// are updated rather than duplicated and limits are upserts, so a file can
+// be loaded again; chores are added each time.
+func Load(ctx context.Context, d *db.DB, f *File) (*Result, error) {
+	var res Result
+	for _, fam := range f.Families {
+		parent, err := loadParent(ctx, d, fam.Parent)
+		if err != nil {
+			return &res, err
+		}
+		res.Parents++
+		wallets := map[string]string{}
+		for _, k := range fam.Kids {
+			kid, err := loadKid(ctx, d, parent, k.Person)
+			if err != nil {
+				return &res, err
+			}
+			res.Kids++
+			wallets[kid.Email] = kid.Wallet
+			for _, l := range k.Limits {
+				if _, err := d.CreateOrUpdateAppLimit(ctx, parent.Email, kid.Email, l.App, l.MinutesPerDay, l.FeeExtraHour, "fixtures"); err != nil {
+					return &res, fmt.Errorf("limit %s for %s: %w", l.App, kid.Email, err)
+				}
+				res.Limits++
+			}
+		}
+		for _, c := range fam.Chores {
+			kind := c.Kind
+			if kind == "" {
+				kind = db.ChoreKindChore
+			}
+			chore, err := d.CreateChore(ctx, parent.Wallet, wallets[strings.ToLower(c.Kid)], c.Name, c.Description, c.Bounty, c.DueDate, kind)
+			if err != nil {
+				return &res, fmt.Errorf("chore %q: %w", c.Name, err)
+			}
+			if c.Status != 0 {
+				if _, err := d.UpdateChoreStatus(ctx, chore.ChoreID, c.Status, "", ""); err != nil {
+					return &res, fmt.Errorf("chore %q: %w", c.Name, err)
+				}
+			}
+			res.Chores++
+		}
+		if fam.Settings != nil {
+			if err := loadSettings(ctx, d, parent.Email, fam.Settings); err != nil {
+				return &res, err
+			}
+		}
+	}
+	return &res, nil
+}
+
+func loadParent(ctx context.Context, d *db.DB, p Person) (*db.Parent, error) {
+	if _, found, err := d.GetParentByEmail(ctx, p.Email); err != nil {
+		return nil, err
+	} else if !found {
+		if _, err := d.CreateParent(ctx, p.Name, p.Email); err != nil {
+			return nil, fmt.Errorf("parent %s: %w", p.Email, err)
+		}
+	}
+	var wallet *string
+	if p.Wallet != "" {
+		wallet = &p.Wallet
+	}
+	return d.UpdateParentByEmail(ctx, p.Email, &p.Name, wallet)
+}
+
+func loadKid(ctx context.Context, d *db.DB, parent *db.Parent, k Person) (*db.Child, error) {
+	if _, found, err := d.GetChildByEmail(ctx, k.Email); err != nil {
+		return nil, err
+	} else if !found {
+		if _, err := d.CreateChild(ctx, k.Name, k.Email, parent.ID); err != nil {
+			return nil, fmt.Errorf("kid %s: %w", k.Email, err)
+		}
+	}
+	var wallet *string
+	if k.Wallet != "" {
+		wallet = &k.Wallet
+	}
+	kid, err := d.UpdateChildByEmail(ctx, k.Email, &k.Name, &parent.ID, wallet)
+	if err != nil {
+		return nil, fmt.Errorf("kid %s: %w", k.Email, err)
+	}
+	return kid, nil
+}
+
+func loadSettings(ctx context.Context, d *db.DB, parentEmail string, prefs *FamilyPrefs) error {
+	s, err := d.GetFamilySettings(ctx, parentEmail)
+	if err != nil {
+		return err
+	}
+	if prefs.Timezone != "" {
+		s.Timezone = prefs.Timezone
+	}
+	if prefs.Currency != "" {
+		s.Currency = strings.ToUpper(prefs.Currency)
+	}
+	for f, on := range prefs.Features {
+		s.Features[f] = on
+	}
+	_, err = d.SetFamilySettings(ctx, s)
+	return err
+}
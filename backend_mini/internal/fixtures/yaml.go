@@ -0,0 +1,238 @@
+package fixtures
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseYAML reads the block-style subset of YAML that fixture files use:
+// nested mappings and sequences by indentation, "- key: value" items,
+// plain and quoted scalars, [a, b] flow lists and # comments. Anchors,
+// multi-line strings and multiple documents are not supported.
+func parseYAML(src []byte) (any, error) {
+	p := &yamlParser{}
+	for i, raw := range strings.Split(string(src), "\n") {
+		text := strings.TrimRight(stripComment(raw), " \r")
+		if strings.TrimSpace(text) == "" || text == "---" {
+			continue
+		}
+		indent := len(text) - len(strings.TrimLeft(text, " "))
+		if strings.HasPrefix(text[indent:], "\t") {
+			return nil, fmt.Errorf("line %d: indent with spaces, not tabs", i+1)
+		}
+		p.lines = append(p.lines, yamlLine{no: i + 1, indent: indent, text: text[indent:]})
+	}
+	if len(p.lines) == 0 {
+		return nil, nil
+	}
+	v, err := p.block(p.lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.lines) {
+		return nil, fmt.Errorf("line %d: unexpected indentation", p.lines[p.pos].no)
+	}
+	return v, nil
+}
+
+type yamlLine struct {
+	no, indent int
+	text       string
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+func isItem(text string) bool { return text == "-" || strings.HasPrefix(text, "- ") }
+
+func (p *yamlParser) block(indent int) (any, error) {
+	if isItem(p.lines[p.pos].text) {
+		return p.sequence(indent)
+	}
+	return p.mapping(indent)
+}
+
+func (p *yamlParser) mapping(indent int) (any, error) {
+	out := map[string]any{}
+	for p.pos < len(p.lines) {
+		l := p.lines[p.pos]
+		if l.indent < indent || (l.indent == indent && isItem(l.text)) {
+			break
+		}
+		if l.indent > indent {
+			return nil, fmt.Errorf("line %d: unexpected indentation", l.no)
+		}
+		key, rest, ok := splitKey(l.text)
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected \"key: value\"", l.no)
+		}
+		if _, dup := out[key]; dup {
+			return nil, fmt.Errorf("line %d: duplicate key %q", l.no, key)
+		}
+		p.pos++
+		if rest != "" {
+			v, err := scalar(rest, l.no)
+			if err != nil {
+				return nil, err
+			}
+			out[key] = v
+			continue
+		}
+		var v any
+		if p.pos < len(p.lines) {
+			next := p.lines[p.pos]
+			// a sequence may sit at its key's indentation
+			if next.indent > indent || (next.indent == indent && isItem(next.text)) {
+				var err error
+				if v, err = p.block(next.indent); err != nil {
+					return nil, err
+				}
+			}
+		}
+		out[key] = v
+	}
+	return out, nil
+}
+
+func (p *yamlParser) sequence(indent int) (any, error) {
+	out := []any{}
+	for p.pos < len(p.lines) {
+		l := p.lines[p.pos]
+		if l.indent != indent || !isItem(l.text) {
+			if l.indent > indent {
+				return nil, fmt.Errorf("line %d: unexpected indentation", l.no)
+			}
+			break
+		}
+		content := strings.TrimLeft(strings.TrimPrefix(l.text, "-"), " ")
+		if content == "" {
+			p.pos++
+			if p.pos < len(p.lines) && p.lines[p.pos].indent > indent {
+				v, err := p.block(p.lines[p.pos].indent)
+				if err != nil {
+					return nil, err
+				}
+				out = append(out, v)
+			} else {
+				out = append(out, nil)
+			}
+			continue
+		}
+		if _, _, ok := splitKey(content); ok && !strings.HasPrefix(content, "[") {
+			// "- key: value" opens a mapping indented to its first key
+			inner := indent + len(l.text) - len(content)
+			p.lines[p.pos] = yamlLine{no: l.no, indent: inner, text: content}
+			v, err := p.mapping(inner)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, v)
+			continue
+		}
+		v, err := scalar(content, l.no)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+		p.pos++
+	}
+	return out, nil
+}
+
+// splitKey splits "key: value" or "key:", honouring a quoted key.
+func splitKey(text string) (string, string, bool) {
+	if text[0] == '"' || text[0] == '\'' {
+		end := strings.IndexByte(text[1:], text[0])
+		if end < 0 {
+			return "", "", false
+		}
+		rest := text[end+2:]
+		if rest != ":" && !strings.HasPrefix(rest, ": ") {
+			return "", "", false
+		}
+		return text[1 : end+1], strings.TrimSpace(rest[1:]), true
+	}
+	if strings.HasSuffix(text, ":") {
+		return text[:len(text)-1], "", !strings.ContainsAny(text[:len(text)-1], " \"'")
+	}
+	i := strings.Index(text, ": ")
+	if i <= 0 || strings.ContainsAny(text[:i], "\"'[{") {
+		return "", "", false
+	}
+	return text[:i], strings.TrimSpace(text[i+2:]), true
+}
+
+// stripComment drops a # comment that starts the line or follows a space,
+// outside quotes.
+func stripComment(s string) string {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || s[i-1] == ' ' || s[i-1] == '\t'):
+			return s[:i]
+		}
+	}
+	return s
+}
+
+func scalar(s string, line int) (any, error) {
+	switch {
+	case s == "":
+		return nil, nil
+	case s[0] == '"':
+		v, err := strconv.Unquote(s)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid quoted string %s", line, s)
+		}
+		return v, nil
+	case s[0] == '\'':
+		if len(s) < 2 || s[len(s)-1] != '\'' {
+			return nil, fmt.Errorf("line %d: unterminated string %s", line, s)
+		}
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	case s[0] == '[':
+		if s[len(s)-1] != ']' {
+			return nil, fmt.Errorf("line %d: unterminated list %s", line, s)
+		}
+		out := []any{}
+		if inner := strings.TrimSpace(s[1 : len(s)-1]); inner != "" {
+			for _, part := range strings.Split(inner, ",") {
+				v, err := scalar(strings.TrimSpace(part), line)
+				if err != nil {
+					return nil, err
+				}
+				out = append(out, v)
+			}
+		}
+		return out, nil
+	case s == "{}":
+		return map[string]any{}, nil
+	case s[0] == '{' || s[0] == '&' || s[0] == '*' || s[0] == '|' || s[0] == '>':
+		return nil, fmt.Errorf("line %d: %q is YAML that fixtures do not support", line, s)
+	}
+	switch s {
+	case "~", "null":
+		return nil, nil
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return n, nil
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f, nil
+	}
+	return s, nil
+}
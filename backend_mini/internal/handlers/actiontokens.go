@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend_mini/internal/config"
+	"backend_mini/internal/db"
+)
+
+type createActionTokenRequest struct {
+	ParentEmail string `json:"parent_email"`
+	Action      string `json:"action"`
+	ChoreID     string `json:"chore_id,omitempty"`
+	KidEmail    string `json:"kid_email,omitempty"`
+	// Amount is in EURC micro-units, as for /eurc_tx.
+	Amount           string `json:"amount,omitempty"`
+	ExpiresInMinutes int    `json:"expires_in_minutes,omitempty"`
+}
+
+// CreateActionToken mints a token for one action the app can hand to a
+// system shortcut (Siri, App Intents): approving one chore, or sending one
+// amount to one kid. Whoever holds it can do that once with /run_action
+// and nothing else.
+func (a *API) CreateActionToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req createActionTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" || strings.TrimSpace(req.Action) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email and action are required")
+		return
+	}
+	ttl := config.ActionTokenTTL()
+	if req.ExpiresInMinutes != 0 {
+		ttl = time.Duration(req.ExpiresInMinutes) * time.Minute
+	}
+	if ttl <= 0 || ttl > config.ActionTokenMaxTTL() {
+		writeError(w, http.StatusBadRequest, "expires_in_minutes must be positive and at most "+config.ActionTokenMaxTTL().String())
+		return
+	}
+	ctx := r.Context()
+	p, found, err := a.db.GetParentByEmail(ctx, req.ParentEmail)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "parent not found")
+		return
+	}
+	if p.Wallet == "" {
+		writeError(w, http.StatusConflict, "parent has no wallet")
+		return
+	}
+	t := db.ActionToken{ParentEmail: p.Email, Action: req.Action}
+	switch req.Action {
+	case db.ActionApproveChore:
+		c, found, err := a.db.GetChore(ctx, req.ChoreID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if !found || c.ParentWallet != p.Wallet {
+			writeError(w, http.StatusNotFound, "chore not found")
+			return
+		}
+		if c.Kind != db.ChoreKindChore {
+			writeError(w, http.StatusBadRequest, "only chores can be approved with an action token")
+			return
+		}
+		t.ChoreID = c.ChoreID
+	case db.ActionSend:
+		amount, err := strconv.ParseUint(req.Amount, 10, 64)
+		if err != nil || amount == 0 {
+			writeError(w, http.StatusBadRequest, "invalid amount")
+			return
+		}
+		kid, ok := a.kidOfParent(w, r, p.Email, req.KidEmail)
+		if !ok {
+			return
+		}
+		if kid.Wallet == "" {
+			writeError(w, http.StatusConflict, "kid has no wallet")
+			return
+		}
+		t.KidEmail, t.Amount = kid.Email, amount
+	default:
+		writeError(w, http.StatusBadRequest, "action must be approve_chore or send")
+		return
+	}
+	out, raw, err := a.db.CreateActionToken(ctx, t, ttl)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	// the raw token is only ever shown here
+	writeJSON(w, http.StatusOK, map[string]any{"token": raw, "details": out})
+}
+
+// RunAction does what the bearer action token stands for, burning it
+// first so it can never run twice. The action goes through the same
+// handler, and so the same policy, hold and duplicate checks, as when the
+// app does it, and answers the same way.
+func (a *API) RunAction(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	raw, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || !strings.HasPrefix(raw, db.ActionTokenPrefix) {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	ctx := r.Context()
+	t, err := a.db.UseActionToken(ctx, raw, time.Now())
+	if errors.Is(err, db.ErrActionTokenNotFound) {
+		writeError(w, http.StatusUnauthorized, "action token is unknown, expired or already used")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	p, found, err := a.db.GetParentByEmail(ctx, t.ParentEmail)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found || p.Wallet == "" {
+		writeError(w, http.StatusConflict, "the token's family no longer has a wallet")
+		return
+	}
+	switch t.Action {
+	case db.ActionApproveChore:
+		// the chore may have been reassigned since the token was minted
+		if owner, found, err := a.db.GetChoreParentWallet(ctx, t.ChoreID); err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		} else if !found || owner != p.Wallet {
+			writeError(w, http.StatusNotFound, "chore not found")
+			return
+		}
+		runWithBody(w, r, a.UpdateChore, updateChoreRequest{ChoreID: t.ChoreID, NewStatus: 3})
+	case db.ActionSend:
+		kid, ok := a.kidOfParent(w, r, p.Email, t.KidEmail)
+		if !ok {
+			return
+		}
+		runWithBody(w, r, a.EurcTx, eurcTxRequest{WalletFrom: p.Wallet, WalletTo: kid.Wallet, Amount: strconv.FormatUint(t.Amount, 10)})
+	default:
+		writeError(w, http.StatusInternalServerError, "unknown action "+t.Action)
+	}
+}
+
+// runWithBody calls h as if r had carried body.
+func runWithBody(w http.ResponseWriter, r *http.Request, h http.HandlerFunc, body any) {
+	raw, err := json.Marshal(body)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	r2 := r.Clone(r.Context())
+	r2.Body, r2.ContentLength = io.NopCloser(bytes.NewReader(raw)), int64(len(raw))
+	h(w, r2)
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"backend_mini/internal/db"
+)
+
+type alertRuleRequest struct {
+	Direction string `json:"direction"`
+	Threshold string `json:"threshold"`
+}
+
+type setAlertsRequest struct {
+	ParentEmail string             `json:"parent_email"`
+	KidEmail    string             `json:"kid_email"`
+	Alerts      []alertRuleRequest `json:"alerts"`
+}
+
+type listAlertsRequest struct {
+	ParentEmail string `json:"parent_email"`
+	KidEmail    string `json:"kid_email,omitempty"`
+}
+
+func (a *API) SetAlerts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req setAlertsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" || strings.TrimSpace(req.KidEmail) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email and kid_email are required")
+		return
+	}
+	rules := make([]db.AlertRule, 0, len(req.Alerts))
+	for _, ar := range req.Alerts {
+		if ar.Direction != db.AlertBelow && ar.Direction != db.AlertAbove {
+			writeError(w, http.StatusBadRequest, "direction must be below or above")
+			return
+		}
+		threshold, err := strconv.ParseUint(ar.Threshold, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid threshold")
+			return
+		}
+		rules = append(rules, db.AlertRule{Direction: ar.Direction, Threshold: threshold})
+	}
+	ctx := r.Context()
+	p, found, err := a.db.GetParentByEmail(ctx, req.ParentEmail)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "parent not found")
+		return
+	}
+	c, found, err := a.db.GetChildByEmail(ctx, req.KidEmail)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found || c.ParentID != p.ID {
+		writeError(w, http.StatusNotFound, "kid not found for this parent")
+		return
+	}
+	alerts, err := a.db.SetBalanceAlerts(ctx, p.Email, c.Email, rules)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, alerts)
+}
+
+func (a *API) ListAlerts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req listAlertsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email is required")
+		return
+	}
+	alerts, err := a.db.ListBalanceAlerts(r.Context(), req.ParentEmail, strings.TrimSpace(req.KidEmail))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, alerts)
+}
@@ -0,0 +1,9 @@
+package handlers
+
+import "net/http"
+
+// AnalyticsStatus shows which snapshot partner statistics and the
+// warehouse export are reading, and whether it is fresh enough to use.
+func (a *API) AnalyticsStatus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.db.AnalyticsStatus())
+}
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"backend_mini/internal/db"
+)
+
+type anomalySettingsRequest struct {
+	ParentEmail       string   `json:"parent_email"`
+	BurstCount        *int     `json:"burst_count,omitempty"`
+	BurstMinutes      *int     `json:"burst_minutes,omitempty"`
+	LargeMultiplier   *float64 `json:"large_multiplier,omitempty"`
+	FlagNewRecipients *bool    `json:"flag_new_recipients,omitempty"`
+	BlockOnFlag       *bool    `json:"block_on_flag,omitempty"`
+}
+
+type listFlagsRequest struct {
+	Status      string `json:"status,omitempty"`
+	ParentEmail string `json:"parent_email,omitempty"`
+	Limit       int    `json:"limit,omitempty"`
+}
+
+type resolveFlagRequest struct {
+	FlagID     string `json:"flag_id"`
+	Status     string `json:"status"`
+	Note       string `json:"note"`
+	ResolvedBy string `json:"resolved_by"`
+}
+
+// AnomalySettings reads the family's detection settings, or updates the
+// fields present in the body.
+func (a *API) AnomalySettings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req anomalySettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email is required")
+		return
+	}
+	ctx := r.Context()
+	if _, found, err := a.db.GetParentByEmail(ctx, req.ParentEmail); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	} else if !found {
+		writeError(w, http.StatusNotFound, "parent not found")
+		return
+	}
+	s, err := a.db.GetAnomalySettings(ctx, req.ParentEmail)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if req.BurstCount == nil && req.BurstMinutes == nil && req.LargeMultiplier == nil && req.FlagNewRecipients == nil && req.BlockOnFlag == nil {
+		writeJSON(w, http.StatusOK, s)
+		return
+	}
+	if req.BurstCount != nil {
+		s.BurstCount = *req.BurstCount
+	}
+	if req.BurstMinutes != nil {
+		s.BurstMinutes = *req.BurstMinutes
+	}
+	if req.LargeMultiplier != nil {
+		s.LargeMultiplier = *req.LargeMultiplier
+	}
+	if req.FlagNewRecipients != nil {
+		s.FlagNewRecipients = *req.FlagNewRecipients
+	}
+	if req.BlockOnFlag != nil {
+		s.BlockOnFlag = *req.BlockOnFlag
+	}
+	if s.BurstCount < 0 || s.BurstMinutes < 1 || s.BurstMinutes > 1440 {
+		writeError(w, http.StatusBadRequest, "burst_count must be >= 0 (0 disables) and burst_minutes between 1 and 1440")
+		return
+	}
+	if s.LargeMultiplier != 0 && s.LargeMultiplier < 1 {
+		writeError(w, http.StatusBadRequest, "large_multiplier must be 0 (disabled) or at least 1")
+		return
+	}
+	s, err = a.db.SetAnomalySettings(ctx, s)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, s)
+}
+
+// ListFlags is the admin review queue.
+func (a *API) ListFlags(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req listFlagsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if req.Status == "" {
+		req.Status = db.FlagOpen
+	}
+	if req.Status == "all" {
+		req.Status = ""
+	}
+	if req.Limit <= 0 || req.Limit > 500 {
+		req.Limit = 100
+	}
+	flags, err := a.db.ListTransferFlags(r.Context(), req.Status, req.ParentEmail, req.Limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, flags)
+}
+
+func (a *API) ResolveFlag(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req resolveFlagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.FlagID) == "" || strings.TrimSpace(req.ResolvedBy) == "" {
+		writeError(w, http.StatusBadRequest, "flag_id and resolved_by are required")
+		return
+	}
+	if req.Status != db.FlagResolved && req.Status != db.FlagDismissed {
+		writeError(w, http.StatusBadRequest, "status must be resolved or dismissed")
+		return
+	}
+	f, err := a.db.ResolveTransferFlag(r.Context(), req.FlagID, req.Status, req.Note, req.ResolvedBy)
+	if errors.Is(err, db.ErrFlagNotFound) {
+		writeError(w, http.StatusNotFound, "no open flag with that id")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, f)
+}
+
+// heldForReview returns the open flags holding transfers from wallet, which
+// is only the case when its family blocks on flag.
+func (a *API) heldForReview(ctx context.Context, wallet string) ([]db.TransferFlag, error) {
+	parentEmail, _, found, err := a.db.FamilyOfWallet(ctx, wallet)
+	if err != nil || !found {
+		return nil, err
+	}
+	s, err := a.db.GetAnomalySettings(ctx, parentEmail)
+	if err != nil || !s.BlockOnFlag {
+		return nil, err
+	}
+	return a.db.OpenFlagsForWallet(ctx, wallet)
+}
+
+// checkHeld writes 423 and returns false when transfers from wallet are held.
+func (a *API) checkHeld(w http.ResponseWriter, r *http.Request, wallet string) bool {
+	flags, err := a.heldForReview(r.Context(), wallet)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return false
+	}
+	if len(flags) > 0 {
+		writeJSON(w, http.StatusLocked, map[string]interface{}{
+			"error": "transfers from this wallet are held for review",
+			"flags": flags,
+		})
+		return false
+	}
+	return true
+}
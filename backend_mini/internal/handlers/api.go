@@ -4,19 +4,46 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
+	"backend_mini/internal/choretext"
+	"backend_mini/internal/config"
 	"backend_mini/internal/db"
+	"backend_mini/internal/iap"
+	"backend_mini/internal/notify"
+	"backend_mini/internal/policy"
+	"backend_mini/internal/state"
 	"backend_mini/internal/util"
 )
 
 type API struct {
-	db *db.DB
+	db          *db.DB
+	notifier    *notify.Notifier
+	hub         *notify.Hub
+	pollers     *pollLimiter
+	tokenLimits state.Limiter
+	buildLocks  *walletLocks
+	playStore   *iap.PlayStore
+	choreParser choretext.Parser
 }
 
-func NewAPI(d *db.DB) *API { return &API{db: d} }
+// NewAPI serves requests from d. limits counts personal token requests.
+func NewAPI(d *db.DB, n *notify.Notifier, limits state.Limiter) *API {
+	return &API{
+		db:          d,
+		notifier:    n,
+		hub:         n.Hub(),
+		pollers:     newPollLimiter(maxPollers, maxPollersPerParent),
+		tokenLimits: limits,
+		buildLocks:  newWalletLocks(),
+		playStore:   newPlayStore(),
+		choreParser: newChoreParser(),
+	}
+}
 
 type parentRequest struct {
 	Email  string  `json:"email"`
@@ -31,12 +58,19 @@ type childRequest struct {
 	ParentID *string `json:"parent_id,omitempty"`
 	Wallet   *string `json:"wallet,omitempty"`
 	Upd      bool    `json:"upd,omitempty"`
+	// Shared marks Email as an address siblings share, so the kid is
+	// identified by name within the family instead.
+	Shared    bool `json:"shared,omitempty"`
+	BirthYear *int `json:"birth_year,omitempty"`
 }
 
 type eurcTxRequest struct {
 	WalletFrom string `json:"wallet_from"`
 	WalletTo   string `json:"wallet_to"`
 	Amount     string `json:"amount"`
+	DryRun     bool   `json:"dry_run"`
+	Force      bool   `json:"force"`
+	PIN        string `json:"pin,omitempty"`
 }
 
 type generateMerkleTreeRequest struct {
@@ -70,15 +104,33 @@ type createChoreRequest struct {
 	ChoreName        string `json:"chore_name"`
 	ChoreDescription string `json:"chore_description"`
 	BountyAmount     string `json:"bounty_amount"`
+	DueDate          string `json:"due_date,omitempty"`
+	Open             bool   `json:"open,omitempty"`
+	Kind             string `json:"kind,omitempty"`
 }
 
 type updateChoreRequest struct {
 	ChoreID   string `json:"chore_id"`
 	NewStatus int    `json:"new_status"`
+	DryRun    bool   `json:"dry_run"`
+	Force     bool   `json:"force"`
+	PIN       string `json:"pin,omitempty"`
+	// Note is the kid's message when submitting (status 1). It goes
+	// through the family's content filter.
+	Note string `json:"note,omitempty"`
+	// Reason is the parent's explanation when rejecting (status 4). It is
+	// shown on the chore's timeline.
+	Reason string `json:"reason,omitempty"`
 }
 
 type getChoresRequest struct {
 	Wallet string `json:"wallet"`
+	// Optional filters: any of these statuses, due between due_from and
+	// due_to (YYYY-MM-DD, inclusive), and one kind.
+	Statuses []int  `json:"statuses,omitempty"`
+	DueFrom  string `json:"due_from,omitempty"`
+	DueTo    string `json:"due_to,omitempty"`
+	Kind     string `json:"kind,omitempty"`
 }
 
 type setLimitRequest struct {
@@ -87,10 +139,14 @@ type setLimitRequest struct {
 	App          string `json:"app"`
 	TimePerDay   int    `json:"time_per_day"`
 	FeeExtraHour string `json:"fee_extra_hour"`
+	EffectiveAt  string `json:"effective_at,omitempty"`
 }
 
 type getLimitsRequest struct {
 	KidEmail string `json:"kid_email"`
+	DeviceID string `json:"device_id,omitempty"`
+	// the device's local date; defaults to today in UTC
+	Date string `json:"date,omitempty"`
 }
 
 func (a *API) GetParent(w http.ResponseWriter, r *http.Request) {
@@ -127,6 +183,10 @@ func (a *API) GetParent(w http.ResponseWriter, r *http.Request) {
 
 	if req.Name != nil && strings.TrimSpace(*req.Name) != "" {
 		created, err := a.db.CreateParent(ctx, *req.Name, req.Email)
+		if errors.Is(err, db.ErrEmailTaken) {
+			writeError(w, http.StatusConflict, err.Error())
+			return
+		}
 		if err != nil {
 			writeError(w, http.StatusInternalServerError, err.Error())
 			return
@@ -147,8 +207,12 @@ func (a *API) GetChild(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, "invalid json")
 		return
 	}
-	if strings.TrimSpace(req.Email) == "" {
-		writeError(w, http.StatusBadRequest, "email is required")
+	if req.BirthYear != nil && *req.BirthYear != 0 && (*req.BirthYear < 1900 || *req.BirthYear > time.Now().Year()) {
+		writeError(w, http.StatusBadRequest, "birth_year must be a year such as 2015, or 0 to clear it")
+		return
+	}
+	if strings.TrimSpace(req.Email) == "" || req.Shared {
+		a.getChildByName(w, r, req)
 		return
 	}
 	ctx := r.Context()
@@ -162,25 +226,96 @@ func (a *API) GetChild(w http.ResponseWriter, r *http.Request) {
 				writeError(w, http.StatusBadRequest, err.Error())
 				return
 			}
-			writeJSON(w, http.StatusOK, updated)
+			a.writeChild(w, r, updated, req.BirthYear)
 			return
 		}
-		writeJSON(w, http.StatusOK, c)
+		a.writeChild(w, r, c, nil)
 		return
 	}
 
 	if req.Name != nil && req.ParentID != nil && strings.TrimSpace(*req.Name) != "" && strings.TrimSpace(*req.ParentID) != "" {
 		created, err := a.db.CreateChild(ctx, *req.Name, req.Email, *req.ParentID)
+		if quotaExceeded(w, err) {
+			return
+		}
+		if errors.Is(err, db.ErrEmailTaken) {
+			writeError(w, http.StatusConflict, err.Error())
+			return
+		}
 		if err != nil {
 			writeError(w, http.StatusBadRequest, err.Error())
 			return
 		}
-		writeJSON(w, http.StatusOK, created)
+		a.writeChild(w, r, created, req.BirthYear)
 		return
 	}
 	writeError(w, http.StatusBadRequest, "for user creation you need all: email, name, parent_id")
 }
 
+// getChildByName gets, updates or creates a kid without an email of their
+// own, keyed by name within the parent's family.
+func (a *API) getChildByName(w http.ResponseWriter, r *http.Request, req childRequest) {
+	if req.Name == nil || req.ParentID == nil || strings.TrimSpace(*req.Name) == "" || strings.TrimSpace(*req.ParentID) == "" {
+		writeError(w, http.StatusBadRequest, "name and parent_id are required for a kid without their own email")
+		return
+	}
+	ctx := r.Context()
+	c, found, err := a.db.GetChildByName(ctx, *req.ParentID, *req.Name)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if found {
+		if req.Upd {
+			updated, err := a.db.UpdateChildByEmail(ctx, c.Email, nil, req.ParentID, req.Wallet)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			a.writeChild(w, r, updated, req.BirthYear)
+			return
+		}
+		a.writeChild(w, r, c, nil)
+		return
+	}
+	contact := ""
+	if req.Shared {
+		contact = req.Email
+	}
+	created, err := a.db.CreateChildByName(ctx, *req.Name, *req.ParentID, contact)
+	if quotaExceeded(w, err) {
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	a.writeChild(w, r, created, req.BirthYear)
+}
+
+// writeChild answers with the kid, first saving the birth year when the
+// request carried one, and shows whether a pause covers them.
+func (a *API) writeChild(w http.ResponseWriter, r *http.Request, c *db.Child, birthYear *int) {
+	ctx := r.Context()
+	if birthYear != nil {
+		if err := a.db.SetChildBirthYear(ctx, c.Email, *birthYear); err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		c.BirthYear = *birthYear
+	}
+	if p, found, err := a.db.GetParentByID(ctx, c.ParentID); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	} else if found {
+		if c.PausedUntil, err = a.db.PausedUntil(ctx, p.Email, c.Email, time.Now()); err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, c)
+}
+
 func (a *API) EurcTx(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		w.WriteHeader(http.StatusMethodNotAllowed)
@@ -200,11 +335,40 @@ func (a *API) EurcTx(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, "invalid amount")
 		return
 	}
-	txData, err := util.BuildEURCTransferTransaction(req.WalletFrom, req.WalletTo, amount)
+	if req.DryRun {
+		preview, err := a.previewIncomingTransfer(r, req.WalletFrom, req.WalletTo, amount)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, preview)
+		return
+	}
+	decision, err := a.transferPolicy(r, req.WalletFrom, req.WalletTo, amount)
 	if err != nil {
-		writeError(w, http.StatusBadRequest, err.Error())
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !decision.Allowed() {
+		writePolicyDenial(w, decision)
+		return
+	}
+	if !a.checkHeld(w, r, req.WalletFrom) {
 		return
 	}
+	if !a.checkKidPIN(w, r, req.WalletFrom, req.PIN) {
+		return
+	}
+	duplicateOf, ok := a.checkDuplicate(w, r, req.WalletFrom, req.WalletTo, amount, req.Force)
+	if !ok {
+		return
+	}
+	txData, err := a.buildIncomingTransfer(r.Context(), req.WalletFrom, req.WalletTo, amount, db.TransferKindDirect, "")
+	if err != nil {
+		writeBuildError(w, err, http.StatusBadRequest)
+		return
+	}
+	txData.DuplicateOf = duplicateOf
 	writeJSON(w, http.StatusOK, txData)
 }
 
@@ -246,6 +410,11 @@ func (a *API) MintNFT(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, "owner_wallet, name, send_to, and tree_id are required")
 		return
 	}
+	var err error
+	if req.Name, req.Description, err = sanitizeChoreText(req.Name, req.Description); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 	txData, err := util.BuildMintNFTTransaction(req.OwnerWallet, req.Name, req.Price, req.Description, req.SendTo, req.TreeId)
 	if err != nil {
 		writeError(w, http.StatusBadRequest, err.Error())
@@ -313,7 +482,29 @@ func (a *API) CreateChore(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, "invalid json")
 		return
 	}
-	if strings.TrimSpace(req.ParentWallet) == "" || strings.TrimSpace(req.ChildWallet) == "" || strings.TrimSpace(req.ChoreName) == "" {
+	switch req.Kind {
+	case "":
+		req.Kind = db.ChoreKindChore
+	case db.ChoreKindChore:
+	case db.ChoreKindPenalty:
+		if req.Open {
+			writeError(w, http.StatusBadRequest, "penalties are for a specific kid and cannot be open")
+			return
+		}
+	default:
+		writeError(w, http.StatusBadRequest, "kind must be chore or penalty")
+		return
+	}
+	if req.Open {
+		if strings.TrimSpace(req.ChildWallet) != "" {
+			writeError(w, http.StatusBadRequest, "open chores are claimed by a kid; leave child_wallet empty")
+			return
+		}
+		if strings.TrimSpace(req.ParentWallet) == "" || strings.TrimSpace(req.ChoreName) == "" {
+			writeError(w, http.StatusBadRequest, "parent_wallet and chore_name are required")
+			return
+		}
+	} else if strings.TrimSpace(req.ParentWallet) == "" || strings.TrimSpace(req.ChildWallet) == "" || strings.TrimSpace(req.ChoreName) == "" {
 		writeError(w, http.StatusBadRequest, "parent_wallet, child_wallet, and chore_name are required")
 		return
 	}
@@ -322,12 +513,42 @@ func (a *API) CreateChore(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, "invalid bounty_amount")
 		return
 	}
+	if req.ChoreName, req.ChoreDescription, err = sanitizeChoreText(req.ChoreName, req.ChoreDescription); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 	ctx := r.Context()
-	chore, err := a.db.CreateChore(ctx, req.ParentWallet, req.ChildWallet, req.ChoreName, req.ChoreDescription, bountyAmount)
+	if req.Open || req.Kind == db.ChoreKindPenalty {
+		p, found, err := a.db.GetParentByWallet(ctx, req.ParentWallet)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		feature := db.FeatureOpenChores
+		if req.Kind == db.ChoreKindPenalty {
+			feature = db.FeaturePenalties
+		}
+		if found && !a.requireFeature(w, r, p.Email, feature) {
+			return
+		}
+	}
+	dueDate, ok := a.resolveDueDate(w, r, req.ParentWallet, req.DueDate)
+	if !ok {
+		return
+	}
+	chore, err := a.db.CreateChore(ctx, req.ParentWallet, req.ChildWallet, req.ChoreName, req.ChoreDescription, bountyAmount, dueDate, req.Kind)
+	if quotaExceeded(w, err) {
+		return
+	}
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+	if chore.Kind == db.ChoreKindPenalty {
+		a.emitChoreEvent(ctx, "penalty.issued", chore)
+	} else {
+		a.emitChoreEvent(ctx, "chore.created", chore)
+	}
 	writeJSON(w, http.StatusOK, chore)
 }
 
@@ -350,7 +571,89 @@ func (a *API) UpdateChore(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	ctx := r.Context()
-	chore, err := a.db.UpdateChoreStatus(ctx, req.ChoreID, req.NewStatus)
+	if req.DryRun {
+		a.previewChoreUpdate(w, r, req)
+		return
+	}
+	var duplicateOf string
+	var current *db.Chore
+	if req.NewStatus == 1 || req.NewStatus == 3 {
+		c, found, err := a.db.GetChore(ctx, req.ChoreID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if !found {
+			writeError(w, http.StatusNotFound, "chore not found")
+			return
+		}
+		if c.ChildWallet == "" {
+			writeError(w, http.StatusConflict, "chore has not been claimed")
+			return
+		}
+		if c.Kind == db.ChoreKindPenalty && req.NewStatus == 1 {
+			writeError(w, http.StatusBadRequest, "penalties are acknowledged (3) or waived (4)")
+			return
+		}
+		current = c
+	}
+	var deviceID string
+	if req.NewStatus == 1 {
+		var ok bool
+		if deviceID, ok = a.submittingDevice(w, r, current); !ok {
+			return
+		}
+	}
+	if req.Note != "" && req.NewStatus != 1 {
+		writeError(w, http.StatusBadRequest, "note is only accepted when submitting a chore (status 1)")
+		return
+	}
+	if req.Reason != "" && req.NewStatus != 4 {
+		writeError(w, http.StatusBadRequest, "reason is only accepted when rejecting a chore (status 4)")
+		return
+	}
+	var note string
+	var noteFlag *db.ContentFlag
+	if req.Note != "" {
+		var ok bool
+		if note, noteFlag, ok = a.screenKidText(w, r, current.ChildWallet, db.ContentFieldChoreNote, current.ChoreID, req.Note); !ok {
+			return
+		}
+	}
+	if req.Reason != "" {
+		reason, err := util.SanitizeText(req.Reason, config.SubmissionNoteMaxLen(), true)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "reason "+err.Error())
+			return
+		}
+		note = reason
+	}
+	if req.NewStatus == 3 {
+		// the payout must clear the family policy before the chore is
+		// marked completed
+		from, to, _ := payoutDirection(current)
+		decision, err := a.transferPolicy(r, from, to, current.BountyAmount)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if !decision.Allowed() {
+			writePolicyDenial(w, decision)
+			return
+		}
+		if !a.checkHeld(w, r, from) {
+			return
+		}
+		if !a.checkKidPIN(w, r, from, req.PIN) {
+			return
+		}
+		dup, ok := a.checkDuplicate(w, r, from, to, current.BountyAmount, req.Force)
+		if !ok {
+			return
+		}
+		duplicateOf = dup
+	}
+	chore, err := a.db.UpdateChoreStatus(ctx, req.ChoreID, req.NewStatus, note, deviceID)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			writeError(w, http.StatusNotFound, "chore not found")
@@ -359,13 +662,19 @@ func (a *API) UpdateChore(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+	a.queueContentFlag(ctx, noteFlag)
+	if eventType, ok := choreEventType(chore, req.NewStatus); ok {
+		a.emitChoreEvent(ctx, eventType, chore)
+	}
 
 	if req.NewStatus == 3 {
-		txData, err := util.BuildEURCTransferTransaction(chore.ParentWallet, chore.ChildWallet, chore.BountyAmount)
+		from, to, kind := payoutDirection(chore)
+		txData, err := a.buildIncomingTransfer(ctx, from, to, chore.BountyAmount, kind, chore.ChoreID)
 		if err != nil {
-			writeError(w, http.StatusInternalServerError, err.Error())
+			writeBuildError(w, err, http.StatusInternalServerError)
 			return
 		}
+		txData.DuplicateOf = duplicateOf
 		writeJSON(w, http.StatusOK, map[string]interface{}{
 			"chore":       chore,
 			"transaction": txData,
@@ -390,12 +699,46 @@ func (a *API) GetChores(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, "wallet is required")
 		return
 	}
+	for _, day := range []string{req.DueFrom, req.DueTo} {
+		if _, err := time.Parse("2006-01-02", day); day != "" && err != nil {
+			writeError(w, http.StatusBadRequest, "due_from and due_to must be YYYY-MM-DD")
+			return
+		}
+	}
+	// each status once, so the IN list has at most four entries and the
+	// query text stays one of a handful of prepared statements
+	var statuses []int
+	seen := map[int]bool{}
+	for _, s := range req.Statuses {
+		if s != 0 && s != 1 && s != 3 && s != 4 {
+			writeError(w, http.StatusBadRequest, "statuses must be 0, 1, 3 or 4")
+			return
+		}
+		if !seen[s] {
+			seen[s] = true
+			statuses = append(statuses, s)
+		}
+	}
 	ctx := r.Context()
-	chores, err := a.db.GetChores(ctx, req.Wallet)
+	chores, err := a.db.GetChores(ctx, req.Wallet, db.ChoreFilter{Statuses: statuses, DueFrom: req.DueFrom, DueTo: req.DueTo, Kind: req.Kind})
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+	ids := make([]string, len(chores))
+	for i := range chores {
+		ids[i] = chores[i].ChoreID
+	}
+	summaries, err := a.db.TimelineSummaries(ctx, ids)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	for i := range chores {
+		if s, ok := summaries[chores[i].ChoreID]; ok {
+			chores[i].Timeline = &s
+		}
+	}
 	writeJSON(w, http.StatusOK, chores)
 }
 
@@ -423,12 +766,50 @@ func (a *API) SetLimit(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	ctx := r.Context()
-	limit, err := a.db.CreateOrUpdateAppLimit(ctx, req.ParentEmail, req.KidEmail, req.App, req.TimePerDay, feeExtraHour)
+	effectiveAt, err := parseEffectiveAt(req.EffectiveAt, time.Now().In(a.familyLocation(ctx, req.ParentEmail)))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	decision, err := a.checkPolicy(ctx, req.ParentEmail, policy.Input{
+		Action:    policy.ActionScreenTimeFee,
+		Actor:     requestActor(r, policy.ActorParent),
+		Amount:    feeExtraHour,
+		Recipient: strings.ToLower(req.KidEmail),
+		At:        time.Now(),
+	})
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
-	writeJSON(w, http.StatusOK, limit)
+	if !decision.Allowed() {
+		writePolicyDenial(w, decision)
+		return
+	}
+	if effectiveAt.After(time.Now()) {
+		change := &db.ScheduledLimitChange{ParentEmail: req.ParentEmail, KidEmail: req.KidEmail, App: req.App, TimePerDay: req.TimePerDay,
+			FeeExtraHour: feeExtraHour, EffectiveAt: effectiveAt.UTC().Format(time.RFC3339), CreatedBy: req.ParentEmail}
+		if err := a.db.ScheduleAppLimit(ctx, change); err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusAccepted, map[string]interface{}{"scheduled": change})
+		return
+	}
+	limit, err := a.db.CreateOrUpdateAppLimit(ctx, req.ParentEmail, req.KidEmail, req.App, req.TimePerDay, feeExtraHour, req.ParentEmail)
+	if quotaExceeded(w, err) {
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	written := []db.AppLimit{*limit}
+	if err := a.withLimitAppInfo(ctx, written); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, written[0])
 }
 
 func (a *API) GetLimits(w http.ResponseWriter, r *http.Request) {
@@ -446,12 +827,66 @@ func (a *API) GetLimits(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	ctx := r.Context()
-	limits, err := a.db.GetAppLimitsByKidEmail(ctx, req.KidEmail)
+	if req.DeviceID != "" {
+		// a paired device pulling its limits counts as a heartbeat
+		dev, found, err := a.db.GetDevice(ctx, req.DeviceID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if !found || dev.UnpairedAt != "" || dev.KidEmail != strings.ToLower(req.KidEmail) {
+			writeError(w, http.StatusNotFound, "device not paired to this kid")
+			return
+		}
+		if err := a.db.TouchDevice(ctx, dev.DeviceID); err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	limits, err := a.db.EffectiveAppLimits(ctx, req.KidEmail, time.Now())
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
-	writeJSON(w, http.StatusOK, limits)
+	if len(limits) > 0 {
+		day, err := parseDay(req.Date)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "date must be YYYY-MM-DD")
+			return
+		}
+		limits, err = a.applySchedule(r, limits, req.KidEmail, day)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		zone, err := a.currentZone(r, limits[0].ParentEmail, req.KidEmail)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		limits = db.ApplyZoneRules(limits, zone)
+	}
+	overrides, err := a.db.GetActiveOverrides(ctx, req.KidEmail, time.Now())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	effective := db.ResolveEffectiveLimits(limits, overrides)
+	if err := a.withLimitAppInfo(ctx, effective); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if len(effective) > 0 {
+		until, err := a.db.PausedUntil(ctx, effective[0].ParentEmail, req.KidEmail, time.Now())
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		for i := range effective {
+			effective[i].PausedUntil = until
+		}
+	}
+	writeJSON(w, http.StatusOK, effective)
 }
 
 func writeError(w http.ResponseWriter, status int, msg string) {
@@ -465,3 +900,45 @@ func writeJSON(w http.ResponseWriter, status int, v any) {
 	w.WriteHeader(status)
 	_ = json.NewEncoder(w).Encode(v)
 }
+
+// sanitizeChoreText cleans a chore's name and description with
+// util.SanitizeText, naming the offending field in the error.
+func sanitizeChoreText(name, description string) (string, string, error) {
+	name, err := util.SanitizeText(name, config.ChoreNameMaxLen(), false)
+	if err != nil {
+		return "", "", fmt.Errorf("chore name %w", err)
+	}
+	if name == "" {
+		return "", "", errors.New("chore name is empty after removing markup")
+	}
+	description, err = util.SanitizeText(description, config.ChoreDescriptionMaxLen(), true)
+	if err != nil {
+		return "", "", fmt.Errorf("chore description %w", err)
+	}
+	return name, description, nil
+}
+
+// kidOfParent loads the kid and checks it belongs to the parent, writing the
+// error response itself when it does not.
+func (a *API) kidOfParent(w http.ResponseWriter, r *http.Request, parentEmail, kidEmail string) (*db.Child, bool) {
+	ctx := r.Context()
+	p, found, err := a.db.GetParentByEmail(ctx, parentEmail)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return nil, false
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "parent not found")
+		return nil, false
+	}
+	c, found, err := a.db.GetChildByEmail(ctx, kidEmail)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return nil, false
+	}
+	if !found || c.ParentID != p.ID {
+		writeError(w, http.StatusNotFound, "kid not found for this parent")
+		return nil, false
+	}
+	return c, true
+}
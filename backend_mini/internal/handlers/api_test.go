@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"backend_mini/internal/db"
+	"backend_mini/internal/fixtures"
+	"backend_mini/internal/notify"
+	"backend_mini/internal/state"
+)
+
+// fuzzFamily is the family the seed bodies name, so they get past
+// validation into the database.
+const fuzzFamily = `
+families:
+  - parent:
+      email: p@example.com
+      name: Parent
+      wallet: GBu756JpQbbyhkj81Boxgd5AYh4rw2YhZLUFWUUReqTw
+    kids:
+      - email: k@example.com
+        name: Kid
+        wallet: 8SyBMpUXQdPPmUAmxEn1EE3Bvxs4Lq4TgX4BWs428rUD
+        limits:
+          - app: com.example.game
+            minutes_per_day: 60
+    chores:
+      - kid: k@example.com
+        name: Dishes
+        bounty: 5000000
+`
+
+// FuzzRequestDecoding sends arbitrary bodies to handlers that decode and
+// validate a JSON request before touching the database. Whatever the body,
+// they must answer without panicking, never with a 5xx, and in JSON.
+func FuzzRequestDecoding(f *testing.F) {
+	ctx := context.Background()
+	d, err := db.Open(ctx, filepath.Join(f.TempDir(), "fuzz.db"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Cleanup(func() { d.Close() })
+	if err := d.Migrate(ctx); err != nil {
+		f.Fatal(err)
+	}
+	family, err := fixtures.Parse([]byte(fuzzFamily))
+	if err != nil {
+		f.Fatal(err)
+	}
+	if _, err := fixtures.Load(ctx, d, family); err != nil {
+		f.Fatal(err)
+	}
+	api := NewAPI(d, notify.New(d), state.NewLocalLimiter())
+	routes := []http.HandlerFunc{api.GetChores, api.CreateChore, api.SetLimit, api.GetLimits, api.CreateThread}
+
+	for i, body := range []string{
+		`{"wallet":"GBu756JpQbbyhkj81Boxgd5AYh4rw2YhZLUFWUUReqTw","statuses":[0,1,1,4],"kind":"chore"}`,
+		`{"parent_wallet":"GBu756JpQbbyhkj81Boxgd5AYh4rw2YhZLUFWUUReqTw","chore_name":"Dishes","bounty_amount":"5000000","open":true}`,
+		`{"parent_email":"p@example.com","kid_email":"k@example.com","app":"com.example.game","time_per_day":60,"fee_extra_hour":"5","effective_at":"next_monday"}`,
+		`{"kid_email":"k@example.com"}`,
+		`{"parent_email":"p@example.com","kid_email":"k@example.com","chore_id":"c1","title":"Dishes"}`,
+	} {
+		f.Add(uint8(i), []byte(body))
+	}
+	for _, body := range []string{``, `null`, `[]`, `{"statuses":"1"}`, `{"bounty_amount":-1}`, "{\"chore_name\":\"\xff\"}", `{"due_to":"2026-02-30"}`} {
+		f.Add(uint8(0), []byte(body))
+		f.Add(uint8(1), []byte(body))
+	}
+
+	f.Fuzz(func(t *testing.T, route uint8, body []byte) {
+		rec := httptest.NewRecorder()
+		routes[int(route)%len(routes)](rec, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body)))
+		if rec.Code >= 500 {
+			t.Fatalf("status %d for %q: %s", rec.Code, body, rec.Body)
+		}
+		if !json.Valid(bytes.TrimSpace(rec.Body.Bytes())) {
+			t.Fatalf("status %d for %q is not JSON: %q", rec.Code, body, rec.Body)
+		}
+	})
+}
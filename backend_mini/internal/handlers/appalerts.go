@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend_mini/internal/db"
+	"backend_mini/internal/policy"
+)
+
+type listAppAlertsRequest struct {
+	ParentEmail string `json:"parent_email"`
+	KidEmail    string `json:"kid_email,omitempty"`
+	Status      string `json:"status,omitempty"`
+}
+
+type resolveAppAlertRequest struct {
+	ParentEmail  string `json:"parent_email"`
+	AlertID      string `json:"alert_id"`
+	Action       string `json:"action"`
+	TimePerDay   int    `json:"time_per_day"`
+	FeeExtraHour string `json:"fee_extra_hour,omitempty"`
+}
+
+// detectNewApps opens alerts for apps in a stored usage batch that none of
+// the kid's limits cover, and emits an app.detected event for each.
+// Failures are logged: the usage itself is already stored.
+func (a *API) detectNewApps(ctx context.Context, records []db.UsageRecord, devices map[string]*db.Device) {
+	byKid := map[string][]db.UsageRecord{}
+	parents := map[string]string{}
+	for _, rec := range records {
+		byKid[rec.KidEmail] = append(byKid[rec.KidEmail], rec)
+		if dev := devices[rec.DeviceID]; dev != nil {
+			parents[rec.KidEmail] = dev.ParentEmail
+		}
+	}
+	for kidEmail, used := range byKid {
+		s, err := a.db.GetFamilySettings(ctx, parents[kidEmail])
+		if err != nil {
+			log.Printf("app alerts: %s: %v", kidEmail, err)
+			continue
+		}
+		if !s.Enabled(db.FeatureAppAlerts) {
+			continue
+		}
+		opened, err := a.db.DetectNewApps(ctx, parents[kidEmail], kidEmail, used)
+		if err != nil {
+			log.Printf("app alerts: %s: %v", kidEmail, err)
+			continue
+		}
+		for _, alert := range opened {
+			if _, err := a.notifier.Emit(ctx, "app.detected", alert.ParentEmail, alert); err != nil {
+				log.Printf("app alerts: emit failed: %v", err)
+			}
+		}
+	}
+}
+
+// ListAppAlerts returns a parent's new-app alerts, open ones by default.
+func (a *API) ListAppAlerts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req listAppAlertsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email is required")
+		return
+	}
+	if req.Status == "" {
+		req.Status = db.AppAlertOpen
+	}
+	if req.Status == "all" {
+		req.Status = ""
+	}
+	ctx := r.Context()
+	alerts, err := a.db.ListAppAlerts(ctx, req.ParentEmail, req.KidEmail, req.Status)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	apps := make([]string, len(alerts))
+	for i, al := range alerts {
+		apps[i] = al.App
+	}
+	catalog, err := a.catalogFor(ctx, apps)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	for i := range alerts {
+		alerts[i].AppInfo = catalog[alerts[i].App]
+	}
+	writeJSON(w, http.StatusOK, alerts)
+}
+
+// ResolveAppAlert applies one of an alert's actions: set_limit writes the
+// given limit, block writes a zero-minute limit, and ignore adds the app to
+// the kid's allow-list so it is not reported again.
+func (a *API) ResolveAppAlert(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req resolveAppAlertRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" || strings.TrimSpace(req.AlertID) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email and alert_id are required")
+		return
+	}
+	var status string
+	var feeExtraHour uint64
+	switch req.Action {
+	case "set_limit":
+		status = db.AppAlertLimited
+		if req.TimePerDay < 0 {
+			writeError(w, http.StatusBadRequest, "time_per_day cannot be negative")
+			return
+		}
+	case "block":
+		status, req.TimePerDay = db.AppAlertBlocked, 0
+	case "ignore":
+		status = db.AppAlertIgnored
+	default:
+		writeError(w, http.StatusBadRequest, "action must be set_limit, ignore or block")
+		return
+	}
+	ctx := r.Context()
+	if status != db.AppAlertIgnored {
+		fee, err := strconv.ParseUint(req.FeeExtraHour, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid fee_extra_hour")
+			return
+		}
+		feeExtraHour = fee
+		alert, found, err := a.db.GetAppAlert(ctx, req.AlertID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if !found {
+			writeError(w, http.StatusNotFound, db.ErrAppAlertNotFound.Error())
+			return
+		}
+		decision, err := a.checkPolicy(ctx, req.ParentEmail, policy.Input{
+			Action:    policy.ActionScreenTimeFee,
+			Actor:     requestActor(r, policy.ActorParent),
+			Amount:    feeExtraHour,
+			Recipient: alert.KidEmail,
+			At:        time.Now(),
+		})
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if !decision.Allowed() {
+			writePolicyDenial(w, decision)
+			return
+		}
+	}
+	alert, limit, err := a.db.ResolveAppAlert(ctx, req.AlertID, req.ParentEmail, status, req.TimePerDay, feeExtraHour)
+	if errors.Is(err, db.ErrAppAlertNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	out := map[string]interface{}{"alert": alert}
+	if limit != nil {
+		out["limit"] = limit
+	}
+	writeJSON(w, http.StatusOK, out)
+}
@@ -0,0 +1,435 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"backend_mini/internal/auth"
+	"backend_mini/internal/balance"
+	"backend_mini/internal/config"
+	"backend_mini/internal/db"
+	"backend_mini/internal/util"
+)
+
+// assistantRole is the session role of assistant access tokens, whose
+// subject is the link rather than the parent.
+const assistantRole = "assistant"
+
+// Intents the assistant endpoint answers.
+const (
+	IntentListChores       = "list_chores"
+	IntentApproveLastChore = "approve_last_chore"
+	IntentCheckBalance     = "check_balance"
+)
+
+type assistantAuthorizeRequest struct {
+	// SessionToken is the parent's session from /oauth_exchange; the
+	// linking page in the app sends it on the parent's behalf.
+	SessionToken string `json:"session_token"`
+	ResponseType string `json:"response_type"`
+	ClientID     string `json:"client_id"`
+	RedirectURI  string `json:"redirect_uri"`
+	State        string `json:"state"`
+}
+
+type assistantIntentRequest struct {
+	Intent string `json:"intent"`
+	// Kid narrows the intent to one kid, matched by name like the
+	// email gateway does; empty means every kid.
+	Kid string `json:"kid,omitempty"`
+}
+
+type assistantLinkRequest struct {
+	ParentEmail string `json:"parent_email"`
+	LinkID      string `json:"link_id,omitempty"`
+}
+
+// AssistantAuthorize is the authorization step of account linking. The
+// skill opens the app's linking page with the OAuth query parameters; once
+// the parent is signed in the page posts them here with the parent's
+// session, and sends the browser on to the returned redirect_url, which
+// carries the authorization code back to the assistant platform.
+func (a *API) AssistantAuthorize(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req assistantAuthorizeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if req.SessionToken == "" || req.ClientID == "" || req.RedirectURI == "" {
+		writeError(w, http.StatusBadRequest, "session_token, client_id and redirect_uri are required")
+		return
+	}
+	if config.AssistantClientID() == "" || config.AssistantClientSecret() == "" {
+		writeError(w, http.StatusServiceUnavailable, "assistant linking is not configured")
+		return
+	}
+	if req.ClientID != config.AssistantClientID() || !slices.Contains(config.AssistantRedirectURIs(), req.RedirectURI) {
+		writeError(w, http.StatusBadRequest, "unknown client_id or redirect_uri")
+		return
+	}
+	if req.ResponseType != "code" {
+		writeError(w, http.StatusBadRequest, "response_type must be code")
+		return
+	}
+	claims, err := auth.ParseSession(config.SessionSecret(), req.SessionToken)
+	if err != nil || claims.Role != "parent" {
+		writeError(w, http.StatusUnauthorized, "a parent session is required")
+		return
+	}
+	code, err := a.db.CreateAssistantCode(r.Context(), claims.Email, req.ClientID, req.RedirectURI, config.AssistantCodeTTL())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	target, _ := url.Parse(req.RedirectURI)
+	q := target.Query()
+	q.Set("code", code)
+	if req.State != "" {
+		q.Set("state", req.State)
+	}
+	target.RawQuery = q.Encode()
+	writeJSON(w, http.StatusOK, map[string]string{"redirect_url": target.String()})
+}
+
+// writeOAuthError answers in the shape RFC 6749 gives token endpoints.
+func writeOAuthError(w http.ResponseWriter, status int, code, description string) {
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, status, map[string]string{"error": code, "error_description": description})
+}
+
+// AssistantToken is the OAuth token endpoint the assistant platform calls
+// with its client credentials, form encoded. It exchanges an authorization
+// code, or a refresh token, for an access token and a new refresh token.
+func (a *API) AssistantToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "body must be form encoded")
+		return
+	}
+	clientID, secret, ok := r.BasicAuth()
+	if !ok {
+		clientID, secret = r.PostFormValue("client_id"), r.PostFormValue("client_secret")
+	}
+	want := config.AssistantClientSecret()
+	if want == "" || clientID != config.AssistantClientID() || subtle.ConstantTimeCompare([]byte(secret), []byte(want)) != 1 {
+		writeOAuthError(w, http.StatusUnauthorized, "invalid_client", "unknown client or wrong secret")
+		return
+	}
+	ctx := r.Context()
+	var link *db.AssistantLink
+	var refresh string
+	var err error
+	switch r.PostFormValue("grant_type") {
+	case "authorization_code":
+		link, refresh, err = a.db.RedeemAssistantCode(ctx, r.PostFormValue("code"), clientID, r.PostFormValue("redirect_uri"), time.Now())
+	case "refresh_token":
+		link, refresh, err = a.db.RefreshAssistantLink(ctx, r.PostFormValue("refresh_token"), clientID)
+	default:
+		writeOAuthError(w, http.StatusBadRequest, "unsupported_grant_type", "grant_type must be authorization_code or refresh_token")
+		return
+	}
+	if errors.Is(err, db.ErrAssistantGrant) {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", err.Error())
+		return
+	}
+	if err != nil {
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	token, exp, err := auth.IssueSession(config.SessionSecret(), link.LinkID, link.ParentEmail, assistantRole)
+	if err != nil {
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token":  token,
+		"token_type":    "Bearer",
+		"expires_in":    int(time.Until(exp).Seconds()),
+		"refresh_token": refresh,
+	})
+}
+
+// assistantLink resolves the assistant's bearer access token to its link,
+// answering 401 itself when the token is bad or the link was revoked.
+func (a *API) assistantLink(w http.ResponseWriter, r *http.Request) (*db.AssistantLink, bool) {
+	raw, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return nil, false
+	}
+	claims, err := auth.ParseSession(config.SessionSecret(), raw)
+	if err != nil || claims.Role != assistantRole {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return nil, false
+	}
+	l, err := a.db.ActiveAssistantLink(r.Context(), claims.Subject, time.Now())
+	if errors.Is(err, db.ErrAssistantLinkNotFound) {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return nil, false
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return nil, false
+	}
+	return l, true
+}
+
+// AssistantIntent answers one intent of a linked voice assistant with a
+// sentence to speak and the data behind it. It is the only thing an
+// assistant token can call.
+func (a *API) AssistantIntent(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	l, ok := a.assistantLink(w, r)
+	if !ok {
+		return
+	}
+	var req assistantIntentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	ctx := r.Context()
+	p, found, err := a.db.GetParentByEmail(ctx, l.ParentEmail)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	kids, err := a.db.ListKids(ctx, p.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if kid := strings.TrimSpace(req.Kid); kid != "" {
+		k, err := matchKid(kids, kid)
+		if err != nil {
+			writeJSON(w, http.StatusOK, map[string]any{"speech": fmt.Sprintf("I don't know which of your kids %s is.", kid)})
+			return
+		}
+		kids = []db.KidSummary{*k}
+	}
+	switch req.Intent {
+	case IntentListChores:
+		a.assistantListChores(w, r, kids)
+	case IntentApproveLastChore:
+		a.assistantApproveLast(w, r, l, p, kids)
+	case IntentCheckBalance:
+		a.assistantBalance(w, r, kids)
+	default:
+		writeError(w, http.StatusBadRequest, "intent must be list_chores, approve_last_chore or check_balance")
+	}
+}
+
+type assistantKidChores struct {
+	KidName string   `json:"kid_name"`
+	ToDo    []string `json:"to_do"`
+	Waiting []string `json:"waiting_for_approval"`
+}
+
+func (a *API) assistantListChores(w http.ResponseWriter, r *http.Request, kids []db.KidSummary) {
+	out := []assistantKidChores{}
+	var speech []string
+	for _, k := range kids {
+		if k.Wallet == "" {
+			continue
+		}
+		chores, err := a.db.GetChores(r.Context(), k.Wallet, db.ChoreFilter{Statuses: []int{0, 1}, Kind: db.ChoreKindChore})
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		kc := assistantKidChores{KidName: k.Name, ToDo: []string{}, Waiting: []string{}}
+		for _, c := range chores {
+			switch {
+			case c.ChildWallet != k.Wallet:
+			case c.ChoreStatus == 0:
+				kc.ToDo = append(kc.ToDo, c.ChoreName)
+			default:
+				kc.Waiting = append(kc.Waiting, c.ChoreName)
+			}
+		}
+		out = append(out, kc)
+		switch {
+		case len(kc.ToDo) == 0 && len(kc.Waiting) == 0:
+			speech = append(speech, k.Name+" has no open chores.")
+		case len(kc.Waiting) == 0:
+			speech = append(speech, fmt.Sprintf("%s has %s to do: %s.", k.Name, countOf(len(kc.ToDo), "chore"), spokenList(kc.ToDo)))
+		case len(kc.ToDo) == 0:
+			speech = append(speech, fmt.Sprintf("%s has %s waiting for your approval: %s.", k.Name, countOf(len(kc.Waiting), "chore"), spokenList(kc.Waiting)))
+		default:
+			speech = append(speech, fmt.Sprintf("%s has %s to do: %s, and %d waiting for your approval: %s.", k.Name, countOf(len(kc.ToDo), "chore"), spokenList(kc.ToDo), len(kc.Waiting), spokenList(kc.Waiting)))
+		}
+	}
+	if len(speech) == 0 {
+		speech = append(speech, "None of your kids has chores set up yet.")
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"speech": strings.Join(speech, " "), "kids": out})
+}
+
+// assistantApproveLast approves the chore submitted most recently by any
+// of kids. The payout is left to the parent's app, which signs it.
+func (a *API) assistantApproveLast(w http.ResponseWriter, r *http.Request, l *db.AssistantLink, p *db.Parent, kids []db.KidSummary) {
+	ctx := r.Context()
+	if p.Wallet == "" {
+		writeJSON(w, http.StatusOK, map[string]any{"speech": "Your Sona wallet is not set up yet."})
+		return
+	}
+	names := map[string]string{}
+	for _, k := range kids {
+		if k.Wallet != "" {
+			names[k.Wallet] = k.Name
+		}
+	}
+	chores, err := a.db.GetChores(ctx, p.Wallet, db.ChoreFilter{Statuses: []int{1}, Kind: db.ChoreKindChore})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	ids := []string{}
+	for _, c := range chores {
+		if _, ok := names[c.ChildWallet]; ok {
+			ids = append(ids, c.ChoreID)
+		}
+	}
+	summaries, err := a.db.TimelineSummaries(ctx, ids)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	var last *db.Chore
+	for i := range chores {
+		c := &chores[i]
+		if _, ok := names[c.ChildWallet]; ok && (last == nil || summaries[c.ChoreID].LastAt > summaries[last.ChoreID].LastAt) {
+			last = c
+		}
+	}
+	if last == nil {
+		writeJSON(w, http.StatusOK, map[string]any{"speech": "There are no chores waiting for your approval."})
+		return
+	}
+	c, err := a.db.AssistantApproveChore(ctx, l, p.Wallet, last.ChoreID)
+	if errors.Is(err, db.ErrChoreNotSubmitted) {
+		writeJSON(w, http.StatusOK, map[string]any{"speech": "That chore was just decided in the app."})
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if _, err := a.notifier.Emit(ctx, "chore.assistant_approved", p.Email, map[string]any{"chore": c, "link_id": l.LinkID}); err != nil {
+		log.Printf("assistant approval: emit failed: %v", err)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"speech": fmt.Sprintf("Approved %s's chore %s. Open Sona to send the %s euro reward.", names[c.ChildWallet], c.ChoreName, util.FormatTokenAmount(c.BountyAmount, util.EURCDecimals)),
+		"chore":  map[string]any{"chore_id": c.ChoreID, "chore_name": c.ChoreName, "kid_name": names[c.ChildWallet], "chore_status": c.ChoreStatus},
+	})
+}
+
+func (a *API) assistantBalance(w http.ResponseWriter, r *http.Request, kids []db.KidSummary) {
+	out := []map[string]any{}
+	var speech []string
+	for _, k := range kids {
+		if k.Wallet == "" {
+			continue
+		}
+		b, err := balance.Get(r.Context(), a.db, k.Wallet)
+		if err != nil {
+			writeError(w, http.StatusBadGateway, err.Error())
+			return
+		}
+		out = append(out, map[string]any{"kid_name": k.Name, "spendable": b.Spendable, "locked_savings": b.Locked})
+		s := fmt.Sprintf("%s has %s euros to spend", k.Name, util.FormatTokenAmount(b.Spendable, util.EURCDecimals))
+		if b.Locked > 0 {
+			s += fmt.Sprintf(" and %s euros in savings", util.FormatTokenAmount(b.Locked, util.EURCDecimals))
+		}
+		speech = append(speech, s+".")
+	}
+	if len(speech) == 0 {
+		speech = append(speech, "None of your kids has a wallet yet.")
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"speech": strings.Join(speech, " "), "kids": out})
+}
+
+// spokenList joins items the way they are said: "a, b and c".
+func spokenList(items []string) string {
+	if len(items) < 2 {
+		return strings.Join(items, "")
+	}
+	return strings.Join(items[:len(items)-1], ", ") + " and " + items[len(items)-1]
+}
+
+func countOf(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+func (a *API) ListAssistantLinks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req assistantLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email is required")
+		return
+	}
+	out, err := a.db.ListAssistantLinks(r.Context(), req.ParentEmail)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (a *API) UnlinkAssistant(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req assistantLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" || strings.TrimSpace(req.LinkID) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email and link_id are required")
+		return
+	}
+	if err := a.db.RevokeAssistantLink(r.Context(), req.ParentEmail, req.LinkID); err != nil {
+		if errors.Is(err, db.ErrAssistantLinkNotFound) {
+			writeError(w, http.StatusNotFound, "no active link with that id")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "revoked"})
+}
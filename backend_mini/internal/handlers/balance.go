@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"backend_mini/internal/balance"
+)
+
+type kidBalanceRequest struct {
+	ParentEmail string `json:"parent_email"`
+	KidEmail    string `json:"kid_email"`
+}
+
+// KidBalance returns the kid's confirmed on-chain balance together with the
+// transfers to and from the kid that are built but not yet expired.
+func (a *API) KidBalance(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req kidBalanceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" || strings.TrimSpace(req.KidEmail) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email and kid_email are required")
+		return
+	}
+	kid, ok := a.kidOfParent(w, r, req.ParentEmail, req.KidEmail)
+	if !ok {
+		return
+	}
+	if kid.Wallet == "" {
+		writeError(w, http.StatusConflict, "kid has no wallet")
+		return
+	}
+	b, err := balance.Get(r.Context(), a.db, kid.Wallet)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, b)
+}
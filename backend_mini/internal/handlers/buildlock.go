@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"backend_mini/internal/util"
+)
+
+const (
+	// buildLockTTL bounds how long a crashed server can keep a wallet's
+	// database flag.
+	buildLockTTL = 30 * time.Second
+	// buildLockWait is how long a build waits for the wallet before giving up.
+	buildLockWait = 5 * time.Second
+)
+
+var errWalletBusy = errors.New("another transfer from this wallet is being built; try again")
+
+// writeBuildError answers 409 when the wallet was busy and status otherwise.
+func writeBuildError(w http.ResponseWriter, err error, status int) {
+	if errors.Is(err, errWalletBusy) {
+		status = http.StatusConflict
+	}
+	writeError(w, status, err.Error())
+}
+
+// walletLocks serializes builds per wallet inside this process. Entries are
+// dropped once nobody holds or waits for them.
+type walletLocks struct {
+	mu    sync.Mutex
+	locks map[string]*walletLock
+}
+
+type walletLock struct {
+	ch   chan struct{}
+	refs int
+}
+
+func newWalletLocks() *walletLocks {
+	return &walletLocks{locks: map[string]*walletLock{}}
+}
+
+func (l *walletLocks) acquire(ctx context.Context, wallet string) (func(), error) {
+	l.mu.Lock()
+	wl, ok := l.locks[wallet]
+	if !ok {
+		wl = &walletLock{ch: make(chan struct{}, 1)}
+		l.locks[wallet] = wl
+	}
+	wl.refs++
+	l.mu.Unlock()
+
+	done := func() {
+		l.mu.Lock()
+		if wl.refs--; wl.refs == 0 {
+			delete(l.locks, wallet)
+		}
+		l.mu.Unlock()
+	}
+	select {
+	case wl.ch <- struct{}{}:
+		return func() { <-wl.ch; done() }, nil
+	case <-ctx.Done():
+		done()
+		return nil, ctx.Err()
+	}
+}
+
+// lockWallet holds wallet for a build: first the in-process lock, then the
+// database flag shared with other servers. It gives up with errWalletBusy
+// after buildLockWait.
+func (a *API) lockWallet(ctx context.Context, wallet string) (func(), error) {
+	ctx, cancel := context.WithTimeout(ctx, buildLockWait)
+	defer cancel()
+	unlock, err := a.buildLocks.acquire(ctx, wallet)
+	if err != nil {
+		return nil, errWalletBusy
+	}
+	holder, err := util.NewID()
+	if err != nil {
+		unlock()
+		return nil, err
+	}
+	for {
+		ok, err := a.db.AcquireBuildLock(ctx, wallet, holder, buildLockTTL)
+		if err != nil {
+			unlock()
+			return nil, err
+		}
+		if ok {
+			break
+		}
+		select {
+		case <-time.After(100 * time.Millisecond):
+		case <-ctx.Done():
+			unlock()
+			return nil, errWalletBusy
+		}
+	}
+	return func() {
+		if err := a.db.ReleaseBuildLock(context.Background(), wallet, holder); err != nil {
+			log.Printf("release build lock %s: %v", wallet, err)
+		}
+		unlock()
+	}, nil
+}
@@ -0,0 +1,379 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"backend_mini/internal/db"
+	"backend_mini/internal/jobs"
+	"backend_mini/internal/netguard"
+)
+
+const maxSchoolDaysRange = 90
+
+type addCalendarRequest struct {
+	ParentEmail string `json:"parent_email"`
+	Name        string `json:"name"`
+	Kind        string `json:"kind"`
+	URL         string `json:"url,omitempty"`
+	ICS         string `json:"ics,omitempty"`
+}
+
+type calendarRequest struct {
+	ParentEmail string `json:"parent_email"`
+	CalendarID  string `json:"calendar_id,omitempty"`
+}
+
+type schoolDaysRequest struct {
+	ParentEmail string `json:"parent_email"`
+	From        string `json:"from,omitempty"`
+	Days        int    `json:"days,omitempty"`
+}
+
+type scheduleRuleRequest struct {
+	ParentEmail string `json:"parent_email"`
+	KidEmail    string `json:"kid_email,omitempty"`
+	App         string `json:"app,omitempty"`
+	DayType     string `json:"day_type,omitempty"`
+	TimePerDay  *int   `json:"time_per_day,omitempty"`
+	RuleID      string `json:"rule_id,omitempty"`
+}
+
+// parseDay reads a YYYY-MM-DD date, defaulting to today (UTC).
+func parseDay(s string) (time.Time, error) {
+	if s == "" {
+		return time.Now().UTC(), nil
+	}
+	return time.Parse("2006-01-02", s)
+}
+
+// AddCalendar registers a school or holidays calendar, either as an .ics URL
+// (Google Calendar "secret address in iCal format", webcal:// links, ...)
+// kept in sync by a job, or as a one-off upload of the .ics text.
+func (a *API) AddCalendar(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req addCalendarRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" || strings.TrimSpace(req.Name) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email and name are required")
+		return
+	}
+	if req.Kind != db.CalendarSchool && req.Kind != db.CalendarHolidays {
+		writeError(w, http.StatusBadRequest, "kind must be school or holidays")
+		return
+	}
+	if (req.URL == "") == (req.ICS == "") {
+		writeError(w, http.StatusBadRequest, "exactly one of url or ics is required")
+		return
+	}
+	if req.URL != "" {
+		req.URL = strings.TrimSpace(req.URL)
+		if strings.HasPrefix(req.URL, "webcal://") {
+			req.URL = "https://" + strings.TrimPrefix(req.URL, "webcal://")
+		}
+		u, err := url.Parse(req.URL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			writeError(w, http.StatusBadRequest, "url must be an absolute http(s) or webcal url")
+			return
+		}
+		if err := netguard.CheckURL(u); err != nil {
+			writeError(w, http.StatusBadRequest, "url "+err.Error())
+			return
+		}
+	}
+	ctx := r.Context()
+	if _, found, err := a.db.GetParentByEmail(ctx, req.ParentEmail); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	} else if !found {
+		writeError(w, http.StatusNotFound, "parent not found")
+		return
+	}
+	cal, err := a.db.CreateCalendar(ctx, db.FamilyCalendar{
+		ParentEmail: req.ParentEmail,
+		Name:        strings.TrimSpace(req.Name),
+		Kind:        req.Kind,
+		URL:         req.URL,
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if req.ICS != "" {
+		if err := jobs.ImportCalendar(ctx, a.db, cal.CalendarID, strings.NewReader(req.ICS)); err != nil {
+			_ = a.db.DeleteCalendar(ctx, cal.ParentEmail, cal.CalendarID)
+			writeError(w, http.StatusBadRequest, "invalid ics: "+err.Error())
+			return
+		}
+	} else {
+		// a failed first sync is kept in last_error and retried by the job
+		_ = jobs.SyncCalendar(ctx, a.db, cal)
+	}
+	a.writeCalendar(w, r, cal.CalendarID)
+}
+
+func (a *API) SyncCalendar(w http.ResponseWriter, r *http.Request) {
+	cal, ok := a.ownedCalendar(w, r)
+	if !ok {
+		return
+	}
+	if cal.URL == "" {
+		writeError(w, http.StatusBadRequest, "calendar was uploaded without a url; add it again to refresh")
+		return
+	}
+	_ = jobs.SyncCalendar(r.Context(), a.db, cal)
+	a.writeCalendar(w, r, cal.CalendarID)
+}
+
+func (a *API) DeleteCalendar(w http.ResponseWriter, r *http.Request) {
+	cal, ok := a.ownedCalendar(w, r)
+	if !ok {
+		return
+	}
+	if err := a.db.DeleteCalendar(r.Context(), cal.ParentEmail, cal.CalendarID); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+func (a *API) ListCalendars(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req calendarRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email is required")
+		return
+	}
+	cals, err := a.db.ListCalendars(r.Context(), req.ParentEmail)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, cals)
+}
+
+// SchoolDays exposes the resolver: how each upcoming day is classified.
+func (a *API) SchoolDays(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req schoolDaysRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email is required")
+		return
+	}
+	from, err := parseDay(req.From)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "from must be YYYY-MM-DD")
+		return
+	}
+	if req.Days <= 0 || req.Days > maxSchoolDaysRange {
+		req.Days = 14
+	}
+	days, err := a.db.ResolveDays(r.Context(), req.ParentEmail, from, req.Days)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, days)
+}
+
+// SetScheduleRule sets a kid's allowance for an app (or all apps) on
+// school days, school nights or days without school.
+func (a *API) SetScheduleRule(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req scheduleRuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" || strings.TrimSpace(req.KidEmail) == "" || req.TimePerDay == nil {
+		writeError(w, http.StatusBadRequest, "parent_email, kid_email and time_per_day are required")
+		return
+	}
+	switch req.DayType {
+	case db.DaySchool, db.DaySchoolNight, db.DayNoSchool:
+	default:
+		writeError(w, http.StatusBadRequest, "day_type must be school_day, school_night or no_school")
+		return
+	}
+	if *req.TimePerDay < 0 || *req.TimePerDay > 24*60 {
+		writeError(w, http.StatusBadRequest, "time_per_day must be between 0 and 1440")
+		return
+	}
+	if _, ok := a.kidOfParent(w, r, req.ParentEmail, req.KidEmail); !ok {
+		return
+	}
+	rule, err := a.db.SetScheduleRule(r.Context(), db.ScheduleRule{
+		ParentEmail: req.ParentEmail,
+		KidEmail:    req.KidEmail,
+		App:         strings.TrimSpace(req.App),
+		DayType:     req.DayType,
+		TimePerDay:  *req.TimePerDay,
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, rule)
+}
+
+func (a *API) DeleteScheduleRule(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req scheduleRuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" || strings.TrimSpace(req.RuleID) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email and rule_id are required")
+		return
+	}
+	deleted, err := a.db.DeleteScheduleRule(r.Context(), req.ParentEmail, req.RuleID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !deleted {
+		writeError(w, http.StatusNotFound, "rule not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+func (a *API) ListScheduleRules(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req scheduleRuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" || strings.TrimSpace(req.KidEmail) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email and kid_email are required")
+		return
+	}
+	if _, ok := a.kidOfParent(w, r, req.ParentEmail, req.KidEmail); !ok {
+		return
+	}
+	rules, err := a.db.ListScheduleRules(r.Context(), req.KidEmail)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, rules)
+}
+
+func (a *API) ownedCalendar(w http.ResponseWriter, r *http.Request) (*db.FamilyCalendar, bool) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return nil, false
+	}
+	var req calendarRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return nil, false
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" || strings.TrimSpace(req.CalendarID) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email and calendar_id are required")
+		return nil, false
+	}
+	cal, err := a.db.GetCalendar(r.Context(), req.CalendarID)
+	if errors.Is(err, db.ErrCalendarNotFound) || (err == nil && cal.ParentEmail != strings.ToLower(req.ParentEmail)) {
+		writeError(w, http.StatusNotFound, db.ErrCalendarNotFound.Error())
+		return nil, false
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return nil, false
+	}
+	return cal, true
+}
+
+func (a *API) writeCalendar(w http.ResponseWriter, r *http.Request, calendarID string) {
+	cal, err := a.db.GetCalendar(r.Context(), calendarID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, cal)
+}
+
+// applySchedule layers the kid's schedule rules for the given day over limits.
+func (a *API) applySchedule(r *http.Request, limits []db.AppLimit, kidEmail string, day time.Time) ([]db.AppLimit, error) {
+	ctx := r.Context()
+	rules, err := a.db.ListScheduleRules(ctx, kidEmail)
+	if err != nil || len(rules) == 0 {
+		return limits, err
+	}
+	days, err := a.db.ResolveDays(ctx, rules[0].ParentEmail, day, 1)
+	if err != nil {
+		return nil, err
+	}
+	return db.ApplyScheduleRules(limits, rules, days[0]), nil
+}
+
+// resolveDueDate accepts a YYYY-MM-DD due date or "next_school_day", which is
+// looked up in the parent's calendars.
+func (a *API) resolveDueDate(w http.ResponseWriter, r *http.Request, parentWallet, due string) (string, bool) {
+	due = strings.TrimSpace(due)
+	if due == "" {
+		return "", true
+	}
+	if due != "next_school_day" {
+		if _, err := time.Parse("2006-01-02", due); err != nil {
+			writeError(w, http.StatusBadRequest, "due_date must be YYYY-MM-DD or next_school_day")
+			return "", false
+		}
+		return due, true
+	}
+	p, found, err := a.db.GetParentByWallet(r.Context(), parentWallet)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return "", false
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "parent not found for parent_wallet")
+		return "", false
+	}
+	day, found, err := a.db.NextSchoolDay(r.Context(), p.Email, time.Now().In(a.familyLocation(r.Context(), p.Email)))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return "", false
+	}
+	if !found {
+		writeError(w, http.StatusUnprocessableEntity, "no school day in the next 60 days")
+		return "", false
+	}
+	return day, true
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"backend_mini/internal/db"
+)
+
+const maxCatalogImport = 5000
+
+// ageRatings are the App Store age ratings a catalog entry may carry.
+var ageRatings = map[string]bool{"": true, "4+": true, "9+": true, "12+": true, "17+": true}
+
+type importCatalogRequest struct {
+	Apps []db.CatalogApp `json:"apps"`
+}
+
+// ImportCatalog upserts app metadata by bundle ID. The whole batch is
+// validated before anything is written, so a bad entry rejects the import.
+func (a *API) ImportCatalog(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req importCatalogRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if len(req.Apps) == 0 || len(req.Apps) > maxCatalogImport {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("apps must hold 1 to %d entries", maxCatalogImport))
+		return
+	}
+	for i := range req.Apps {
+		app := &req.Apps[i]
+		app.BundleID, app.DisplayName = strings.TrimSpace(app.BundleID), strings.TrimSpace(app.DisplayName)
+		app.Category = strings.ToLower(strings.TrimSpace(app.Category))
+		if app.BundleID == "" || app.DisplayName == "" {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("apps[%d]: bundle_id and display_name are required", i))
+			return
+		}
+		if app.IconURL != "" {
+			if u, err := url.Parse(app.IconURL); err != nil || u.Scheme != "https" || u.Host == "" {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("apps[%d]: icon_url must be an https URL", i))
+				return
+			}
+		}
+		if !ageRatings[app.AgeRating] {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("apps[%d]: age_rating must be 4+, 9+, 12+ or 17+", i))
+			return
+		}
+	}
+	created, updated, err := a.db.ImportCatalog(r.Context(), req.Apps)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"created": created, "updated": updated})
+}
+
+// catalogFor looks up catalog entries for apps, ignoring duplicates.
+func (a *API) catalogFor(ctx context.Context, apps []string) (map[string]*db.CatalogApp, error) {
+	seen := map[string]bool{}
+	var ids []string
+	for _, app := range apps {
+		if app != "" && !seen[app] {
+			seen[app] = true
+			ids = append(ids, app)
+		}
+	}
+	return a.db.CatalogApps(ctx, ids)
+}
+
+// withLimitAppInfo fills in AppInfo on limits the catalog knows.
+func (a *API) withLimitAppInfo(ctx context.Context, limits []db.AppLimit) error {
+	apps := make([]string, len(limits))
+	for i, l := range limits {
+		apps[i] = l.App
+	}
+	catalog, err := a.catalogFor(ctx, apps)
+	if err != nil {
+		return err
+	}
+	for i := range limits {
+		limits[i].AppInfo = catalog[limits[i].App]
+	}
+	return nil
+}
+
+// withUsageAppInfo fills in AppInfo on usage rows the catalog knows.
+func (a *API) withUsageAppInfo(ctx context.Context, usage []db.AppUsage) error {
+	apps := make([]string, len(usage))
+	for i, u := range usage {
+		apps[i] = u.App
+	}
+	catalog, err := a.catalogFor(ctx, apps)
+	if err != nil {
+		return err
+	}
+	for i := range usage {
+		usage[i].AppInfo = catalog[usage[i].App]
+	}
+	return nil
+}
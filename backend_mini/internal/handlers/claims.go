@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"backend_mini/internal/config"
+	"backend_mini/internal/db"
+)
+
+type claimChoreRequest struct {
+	ChoreID   string `json:"chore_id"`
+	KidWallet string `json:"kid_wallet"`
+}
+
+// ClaimChore assigns an open chore to the first kid of the family who asks
+// for it. From then on it is an ordinary assignment, except that the claim
+// lapses if the kid does not move it on within CHORE_CLAIM_TTL.
+func (a *API) ClaimChore(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req claimChoreRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ChoreID) == "" || strings.TrimSpace(req.KidWallet) == "" {
+		writeError(w, http.StatusBadRequest, "chore_id and kid_wallet are required")
+		return
+	}
+	ctx := r.Context()
+	chore, found, err := a.db.GetChore(ctx, req.ChoreID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "chore not found")
+		return
+	}
+	kid, found, err := a.db.GetChildByWallet(ctx, req.KidWallet)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "kid not found")
+		return
+	}
+	parent, found, err := a.db.GetParentByID(ctx, kid.ParentID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found || parent.Wallet != chore.ParentWallet {
+		writeError(w, http.StatusForbidden, "chore belongs to another family")
+		return
+	}
+
+	claimed, err := a.db.ClaimChore(ctx, req.ChoreID, kid.Wallet, time.Now().Add(config.ChoreClaimTTL()))
+	switch {
+	case errors.Is(err, db.ErrChoreNotOpen), errors.Is(err, db.ErrChoreAlreadyTaken):
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	case errors.Is(err, sql.ErrNoRows):
+		writeError(w, http.StatusNotFound, "chore not found")
+		return
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	a.emitChoreEvent(ctx, "chore.claimed", claimed)
+	writeJSON(w, http.StatusOK, claimed)
+}
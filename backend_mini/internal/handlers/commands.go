@@ -0,0 +1,261 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"backend_mini/internal/config"
+	"backend_mini/internal/db"
+)
+
+const (
+	defaultCommandTTL = time.Hour
+	maxCommandTTL     = 24 * time.Hour
+	// stays below the server's WriteTimeout
+	maxCommandWait = 10 * time.Second
+)
+
+type sendCommandRequest struct {
+	ParentEmail string          `json:"parent_email"`
+	DeviceID    string          `json:"device_id"`
+	Type        string          `json:"type"`
+	Payload     json.RawMessage `json:"payload,omitempty"`
+	TTLMinutes  int             `json:"ttl_minutes,omitempty"`
+}
+
+type pollCommandsRequest struct {
+	DeviceID    string `json:"device_id"`
+	WaitSeconds int    `json:"wait_seconds,omitempty"`
+}
+
+type ackCommandRequest struct {
+	DeviceID  string `json:"device_id"`
+	CommandID string `json:"command_id"`
+	Status    string `json:"status"`
+	Result    string `json:"result,omitempty"`
+}
+
+type listCommandsRequest struct {
+	ParentEmail string `json:"parent_email"`
+	DeviceID    string `json:"device_id,omitempty"`
+	Limit       int    `json:"limit,omitempty"`
+}
+
+type commandPayload struct {
+	App     string `json:"app"`
+	Minutes int    `json:"minutes"`
+	Text    string `json:"text"`
+}
+
+func validateCommand(kind string, raw json.RawMessage) error {
+	var p commandPayload
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &p); err != nil {
+			return errors.New("payload must be a json object")
+		}
+	}
+	switch kind {
+	case db.CommandLockApp:
+		if strings.TrimSpace(p.App) == "" {
+			return errors.New("lock_app requires payload.app")
+		}
+		if p.Minutes < 0 {
+			return errors.New("payload.minutes must not be negative")
+		}
+	case db.CommandUnlock:
+	case db.CommandMessage:
+		if strings.TrimSpace(p.Text) == "" {
+			return errors.New("message requires payload.text")
+		}
+	default:
+		return errors.New("type must be lock_app, unlock or message")
+	}
+	return nil
+}
+
+func signWithServerKey(msg []byte) (string, error) {
+	key, err := config.GetServerWallet()
+	if err != nil {
+		return "", err
+	}
+	sig, err := key.Sign(msg)
+	if err != nil {
+		return "", err
+	}
+	return sig.String(), nil
+}
+
+// SendCommand queues a signed command for one of the parent's paired devices.
+func (a *API) SendCommand(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req sendCommandRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" || strings.TrimSpace(req.DeviceID) == "" || strings.TrimSpace(req.Type) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email, device_id and type are required")
+		return
+	}
+	if err := validateCommand(req.Type, req.Payload); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	ttl := defaultCommandTTL
+	if req.TTLMinutes != 0 {
+		ttl = time.Duration(req.TTLMinutes) * time.Minute
+		if ttl <= 0 || ttl > maxCommandTTL {
+			writeError(w, http.StatusBadRequest, "ttl_minutes must be between 1 and 1440")
+			return
+		}
+	}
+	ctx := r.Context()
+	dev, found, err := a.db.GetDevice(ctx, req.DeviceID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found || dev.UnpairedAt != "" || dev.ParentEmail != strings.ToLower(req.ParentEmail) {
+		writeError(w, http.StatusNotFound, "device not found for this parent")
+		return
+	}
+	cmd, err := a.db.CreateDeviceCommand(ctx, db.DeviceCommand{
+		DeviceID:    dev.DeviceID,
+		KidEmail:    dev.KidEmail,
+		ParentEmail: dev.ParentEmail,
+		Type:        req.Type,
+		Payload:     req.Payload,
+	}, ttl, signWithServerKey)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	a.hub.Wake(dev.DeviceID)
+	writeJSON(w, http.StatusOK, cmd)
+}
+
+// PollCommands is the device side: it returns pending commands, waiting up
+// to wait_seconds for one to arrive when none are queued.
+func (a *API) PollCommands(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req pollCommandsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.DeviceID) == "" {
+		writeError(w, http.StatusBadRequest, "device_id is required")
+		return
+	}
+	ctx := r.Context()
+	if err := a.db.TouchDevice(ctx, req.DeviceID); err != nil {
+		if errors.Is(err, db.ErrDeviceNotFound) {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	wait := time.Duration(req.WaitSeconds) * time.Second
+	if wait > maxCommandWait {
+		wait = maxCommandWait
+	}
+	deadline := time.NewTimer(wait)
+	defer deadline.Stop()
+	for {
+		// register before reading so a command queued in between still wakes us
+		woken, cancel := a.hub.Wait(req.DeviceID)
+		cmds, err := a.db.TakePendingCommands(ctx, req.DeviceID)
+		if err != nil || len(cmds) > 0 || wait <= 0 {
+			cancel()
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			writeJSON(w, http.StatusOK, map[string]any{"commands": cmds})
+			return
+		}
+		select {
+		case <-woken:
+			cancel()
+		case <-deadline.C:
+			cancel()
+			writeJSON(w, http.StatusOK, map[string]any{"commands": []db.DeviceCommand{}})
+			return
+		case <-ctx.Done():
+			cancel()
+			return
+		}
+	}
+}
+
+func (a *API) AckCommand(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req ackCommandRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.DeviceID) == "" || strings.TrimSpace(req.CommandID) == "" {
+		writeError(w, http.StatusBadRequest, "device_id and command_id are required")
+		return
+	}
+	if req.Status == "" {
+		req.Status = db.CommandAcked
+	}
+	if req.Status != db.CommandAcked && req.Status != db.CommandFailed {
+		writeError(w, http.StatusBadRequest, "status must be acked or failed")
+		return
+	}
+	cmd, err := a.db.AckCommand(r.Context(), req.DeviceID, req.CommandID, req.Status, req.Result)
+	if errors.Is(err, db.ErrCommandNotFound) {
+		writeError(w, http.StatusNotFound, "no open command with that id for this device")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if _, err := a.notifier.Emit(r.Context(), "device_command."+cmd.Status, cmd.ParentEmail, cmd); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, cmd)
+}
+
+func (a *API) ListCommands(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req listCommandsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email is required")
+		return
+	}
+	if req.Limit <= 0 || req.Limit > 200 {
+		req.Limit = 50
+	}
+	cmds, err := a.db.ListDeviceCommands(r.Context(), req.ParentEmail, req.DeviceID, req.Limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, cmds)
+}
@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"backend_mini/internal/config"
+	"backend_mini/internal/db"
+	"backend_mini/internal/util"
+)
+
+var contentStrictness = map[string]bool{db.ContentFilterOff: true, db.ContentFilterFlag: true, db.ContentFilterMask: true, db.ContentFilterBlock: true}
+
+type contentFilterRequest struct {
+	ParentEmail string `json:"parent_email"`
+	Strictness  string `json:"strictness,omitempty"`
+}
+
+type listContentFlagsRequest struct {
+	Status      string `json:"status,omitempty"`
+	ParentEmail string `json:"parent_email,omitempty"`
+	Limit       int    `json:"limit,omitempty"`
+}
+
+type reviewContentFlagRequest struct {
+	FlagID     string `json:"flag_id"`
+	Status     string `json:"status"`
+	ReviewedBy string `json:"reviewed_by"`
+}
+
+// ContentFilter reads the family's kid content filter, or sets its
+// strictness when one is given.
+func (a *API) ContentFilter(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req contentFilterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email is required")
+		return
+	}
+	ctx := r.Context()
+	if _, found, err := a.db.GetParentByEmail(ctx, req.ParentEmail); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	} else if !found {
+		writeError(w, http.StatusNotFound, "parent not found")
+		return
+	}
+	if req.Strictness == "" {
+		f, err := a.db.GetContentFilter(ctx, req.ParentEmail)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, f)
+		return
+	}
+	if !contentStrictness[req.Strictness] {
+		writeError(w, http.StatusBadRequest, "strictness must be off, flag, mask or block")
+		return
+	}
+	f, err := a.db.SetContentFilter(ctx, req.ParentEmail, req.Strictness)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, f)
+}
+
+// ListContentFlags is the admin review queue for kid-entered text.
+func (a *API) ListContentFlags(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req listContentFlagsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if req.Status == "" {
+		req.Status = db.ContentFlagOpen
+	}
+	if req.Status == "all" {
+		req.Status = ""
+	}
+	if req.Limit <= 0 || req.Limit > 500 {
+		req.Limit = 100
+	}
+	flags, err := a.db.ListContentFlags(r.Context(), req.Status, req.ParentEmail, req.Limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, flags)
+}
+
+func (a *API) ReviewContentFlag(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req reviewContentFlagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.FlagID) == "" || strings.TrimSpace(req.ReviewedBy) == "" {
+		writeError(w, http.StatusBadRequest, "flag_id and reviewed_by are required")
+		return
+	}
+	if req.Status != db.ContentFlagApproved && req.Status != db.ContentFlagRemoved {
+		writeError(w, http.StatusBadRequest, "status must be approved or removed")
+		return
+	}
+	f, err := a.db.ReviewContentFlag(r.Context(), req.FlagID, req.Status, req.ReviewedBy)
+	if errors.Is(err, db.ErrContentFlagNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, f)
+}
+
+// screenKidText sanitizes text a kid entered and runs it through the
+// family's content filter. It returns the text to store and, when the
+// filter caught something, the flag to queue once it is stored. Blocked
+// text is queued straight away and answered with 422.
+func (a *API) screenKidText(w http.ResponseWriter, r *http.Request, wallet, field, subjectID, text string) (string, *db.ContentFlag, bool) {
+	text, err := util.SanitizeText(text, config.SubmissionNoteMaxLen(), true)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "note "+err.Error())
+		return "", nil, false
+	}
+	ctx := r.Context()
+	kid, found, err := a.db.GetChildByWallet(ctx, wallet)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return "", nil, false
+	}
+	if !found || text == "" {
+		return text, nil, true
+	}
+	parentEmail, _, _, err := a.db.FamilyOfWallet(ctx, wallet)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return "", nil, false
+	}
+	filter, err := a.db.GetContentFilter(ctx, parentEmail)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return "", nil, false
+	}
+	if filter.Strictness == db.ContentFilterOff {
+		return text, nil, true
+	}
+	masked, findings := util.ScreenText(text, config.ProfanityWords())
+	if len(findings) == 0 {
+		return text, nil, true
+	}
+	flag := &db.ContentFlag{ParentEmail: parentEmail, KidEmail: kid.Email, Field: field, SubjectID: subjectID, Original: text, Findings: findings, Strictness: filter.Strictness}
+	switch filter.Strictness {
+	case db.ContentFilterBlock:
+		a.queueContentFlag(ctx, flag)
+		kinds, seen := []string{}, map[string]bool{}
+		for _, f := range findings {
+			if !seen[f.Kind] {
+				seen[f.Kind] = true
+				kinds = append(kinds, f.Kind)
+			}
+		}
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+			"error": "text was rejected by the family's content filter",
+			"kinds": kinds,
+		})
+		return "", nil, false
+	case db.ContentFilterMask:
+		flag.Stored = masked
+	default:
+		flag.Stored = text
+	}
+	return flag.Stored, flag, true
+}
+
+// queueContentFlag adds a flag to the review queue. Failures are logged:
+// the text it is about has already been handled.
+func (a *API) queueContentFlag(ctx context.Context, flag *db.ContentFlag) {
+	if flag == nil {
+		return
+	}
+	if _, err := a.db.AddContentFlag(ctx, *flag); err != nil {
+		log.Printf("content filter: queue %s %s: %v", flag.Field, flag.SubjectID, err)
+	}
+}
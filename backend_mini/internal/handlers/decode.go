@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+
+	"backend_mini/internal/util"
+)
+
+type decodeTxRequest struct {
+	Serialized string `json:"serialized"`
+}
+
+type decodeTxResponse struct {
+	*util.DecodedTransaction
+	Summary string `json:"summary"`
+}
+
+// DecodeTx breaks a serialized transaction down for display in the app,
+// naming family members where a wallet belongs to one: "Send 5 EURC to
+// Emma" rather than base64.
+func (a *API) DecodeTx(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req decodeTxRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.Serialized) == "" {
+		writeError(w, http.StatusBadRequest, "serialized is required")
+		return
+	}
+	decoded, err := util.DecodeTransaction(strings.TrimSpace(req.Serialized))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	ctx := r.Context()
+	names := map[string]string{}
+	var transfers []string
+	for i := range decoded.Instructions {
+		in := &decoded.Instructions[i]
+		if t := in.Transfer; t != nil && t.Owner == "" {
+			t.Owner = a.tokenAccountOwner(ctx, t)
+		}
+		in.Summary = a.summarize(ctx, in, names)
+		if in.Transfer != nil {
+			transfers = append(transfers, in.Summary)
+		}
+	}
+	writeJSON(w, http.StatusOK, decodeTxResponse{DecodedTransaction: decoded, Summary: strings.Join(transfers, ", ")})
+}
+
+// tokenAccountOwner finds the wallet behind a transfer's destination token
+// account: first among the EURC accounts of the sender's family, then on
+// chain. It returns "" when neither knows.
+func (a *API) tokenAccountOwner(ctx context.Context, t *util.DecodedTransfer) string {
+	if t.Authority != "" && (t.Mint == "" || t.Mint == util.EURCMintDevnet) {
+		if parentEmail, _, found, err := a.db.FamilyOfWallet(ctx, t.Authority); err == nil && found {
+			if wallets, err := a.db.FamilyWallets(ctx, parentEmail); err == nil {
+				mint := solana.MustPublicKeyFromBase58(util.EURCMintDevnet)
+				for wallet := range wallets {
+					owner, err := solana.PublicKeyFromBase58(wallet)
+					if err != nil {
+						continue
+					}
+					if ata, err := util.DeriveAssociatedTokenAddress(owner, mint); err == nil && ata.String() == t.Destination {
+						return wallet
+					}
+				}
+			}
+		}
+	}
+	lookupCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	owner, err := util.TokenAccountOwner(lookupCtx, t.Destination)
+	if err != nil {
+		return ""
+	}
+	return owner
+}
+
+func (a *API) summarize(ctx context.Context, in *util.DecodedInstruction, names map[string]string) string {
+	switch in.Type {
+	case "sol_transfer":
+		return fmt.Sprintf("Send %s SOL to %s", util.FormatTokenAmount(in.Transfer.Amount, 9), a.walletName(ctx, in.Transfer.Owner, names))
+	case "transfer_checked":
+		t := in.Transfer
+		asset := "tokens (" + shortWallet(t.Mint) + ")"
+		if t.Mint == util.EURCMintDevnet {
+			asset = "EURC"
+		}
+		return fmt.Sprintf("Send %s %s to %s", util.FormatTokenAmount(t.Amount, *t.Decimals), asset, a.recipientName(ctx, t, names))
+	case "transfer":
+		return fmt.Sprintf("Send %d token units to %s", in.Transfer.Amount, a.recipientName(ctx, in.Transfer, names))
+	case "create_associated_token_account", "create_associated_token_account_idempotent":
+		asset := "a token"
+		if in.Accounts[3] == util.EURCMintDevnet {
+			asset = "an EURC"
+		}
+		return fmt.Sprintf("Create %s account for %s", asset, a.walletName(ctx, in.Accounts[2], names))
+	case "memo":
+		return fmt.Sprintf("Memo: %q", in.Memo)
+	}
+	return "Call " + in.Program
+}
+
+func (a *API) recipientName(ctx context.Context, t *util.DecodedTransfer, names map[string]string) string {
+	if t.Owner == "" {
+		return "token account " + shortWallet(t.Destination)
+	}
+	return a.walletName(ctx, t.Owner, names)
+}
+
+// walletName is the name of the parent or kid owning wallet, or the
+// shortened address.
+func (a *API) walletName(ctx context.Context, wallet string, names map[string]string) string {
+	if n, ok := names[wallet]; ok {
+		return n
+	}
+	n := shortWallet(wallet)
+	if c, found, err := a.db.GetChildByWallet(ctx, wallet); err == nil && found && c.Name != "" {
+		n = c.Name
+	} else if p, found, err := a.db.GetParentByWallet(ctx, wallet); err == nil && found && p.Name != "" {
+		n = p.Name
+	}
+	names[wallet] = n
+	return n
+}
+
+func shortWallet(wallet string) string {
+	if len(wallet) <= 10 {
+		return wallet
+	}
+	return wallet[:4] + "…" + wallet[len(wallet)-4:]
+}
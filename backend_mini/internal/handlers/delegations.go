@@ -0,0 +1,271 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"backend_mini/internal/config"
+	"backend_mini/internal/db"
+	"backend_mini/internal/util"
+)
+
+const (
+	defaultDelegationDays = 30
+	maxDelegatedChores    = 100
+)
+
+type delegateChoresRequest struct {
+	ParentEmail   string   `json:"parent_email"`
+	DelegateName  string   `json:"delegate_name"`
+	DelegateEmail string   `json:"delegate_email,omitempty"`
+	ChoreIDs      []string `json:"chore_ids"`
+	ExpiresInDays int      `json:"expires_in_days,omitempty"`
+}
+
+type delegationRequest struct {
+	ParentEmail  string `json:"parent_email"`
+	DelegationID string `json:"delegation_id,omitempty"`
+}
+
+type verifyChoreRequest struct {
+	ChoreID string `json:"chore_id"`
+	Approve bool   `json:"approve"`
+	Note    string `json:"note,omitempty"`
+}
+
+// delegatedChore is what a delegate sees of a chore: no wallets, amounts
+// or anything else about the family.
+type delegatedChore struct {
+	ChoreID        string `json:"chore_id"`
+	Name           string `json:"chore_name"`
+	Description    string `json:"chore_description,omitempty"`
+	Status         int    `json:"chore_status"`
+	DueDate        string `json:"due_date,omitempty"`
+	SubmissionNote string `json:"submission_note,omitempty"`
+	KidName        string `json:"kid_name,omitempty"`
+}
+
+// DelegateChores lets another adult verify some of the family's chores.
+// The token it returns can only list those chores and approve or reject
+// them once submitted.
+func (a *API) DelegateChores(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req delegateChoresRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" || strings.TrimSpace(req.DelegateName) == "" || len(req.ChoreIDs) == 0 {
+		writeError(w, http.StatusBadRequest, "parent_email, delegate_name and chore_ids are required")
+		return
+	}
+	if len(req.ChoreIDs) > maxDelegatedChores {
+		writeError(w, http.StatusBadRequest, "at most 100 chores can be delegated at once")
+		return
+	}
+	days := req.ExpiresInDays
+	if days == 0 {
+		days = defaultDelegationDays
+	}
+	if days < 1 || days > maxTokenDays {
+		writeError(w, http.StatusBadRequest, "expires_in_days must be between 1 and 365")
+		return
+	}
+	name, err := util.SanitizeText(req.DelegateName, 80, false)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "delegate_name "+err.Error())
+		return
+	}
+	ctx := r.Context()
+	p, found, err := a.db.GetParentByEmail(ctx, req.ParentEmail)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "parent not found")
+		return
+	}
+	seen := map[string]bool{}
+	ids := []string{}
+	for _, id := range req.ChoreIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		wallet, found, err := a.db.GetChoreParentWallet(ctx, id)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if !found || wallet != p.Wallet {
+			writeError(w, http.StatusNotFound, "chore "+id+" not found")
+			return
+		}
+		ids = append(ids, id)
+	}
+	dl, raw, err := a.db.CreateDelegation(ctx, db.Delegation{ParentEmail: p.Email, DelegateName: name, DelegateEmail: strings.TrimSpace(req.DelegateEmail), ChoreIDs: ids}, time.Duration(days)*24*time.Hour)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	// the raw token is only ever shown here
+	writeJSON(w, http.StatusOK, map[string]any{"token": raw, "details": dl})
+}
+
+func (a *API) ListDelegations(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req delegationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email is required")
+		return
+	}
+	out, err := a.db.ListDelegations(r.Context(), req.ParentEmail)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (a *API) RevokeDelegation(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req delegationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" || strings.TrimSpace(req.DelegationID) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email and delegation_id are required")
+		return
+	}
+	if err := a.db.RevokeDelegation(r.Context(), req.ParentEmail, req.DelegationID); err != nil {
+		if errors.Is(err, db.ErrDelegationNotFound) {
+			writeError(w, http.StatusNotFound, "no active delegation with that id")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "revoked"})
+}
+
+// delegation resolves the delegate's bearer token, answering 401 itself
+// when it is missing, revoked or expired.
+func (a *API) delegation(w http.ResponseWriter, r *http.Request) (*db.Delegation, bool) {
+	raw, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || !strings.HasPrefix(raw, db.DelegationTokenPrefix) {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return nil, false
+	}
+	dl, err := a.db.LookupDelegation(r.Context(), raw, time.Now())
+	if errors.Is(err, db.ErrDelegationNotFound) {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return nil, false
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return nil, false
+	}
+	return dl, true
+}
+
+// DelegatedChores lists the chores delegated to the caller's token.
+func (a *API) DelegatedChores(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	dl, ok := a.delegation(w, r)
+	if !ok {
+		return
+	}
+	ctx := r.Context()
+	kids := map[string]string{}
+	out := []delegatedChore{}
+	for _, id := range dl.ChoreIDs {
+		c, found, err := a.db.GetChore(ctx, id)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if !found {
+			continue
+		}
+		if _, seen := kids[c.ChildWallet]; !seen && c.ChildWallet != "" {
+			kid, found, err := a.db.GetChildByWallet(ctx, c.ChildWallet)
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			if found {
+				kids[c.ChildWallet] = kid.Name
+			}
+		}
+		out = append(out, delegatedChore{ChoreID: c.ChoreID, Name: c.ChoreName, Description: c.ChoreDescription, Status: c.ChoreStatus, DueDate: c.DueDate, SubmissionNote: c.SubmissionNote, KidName: kids[c.ChildWallet]})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"delegate_name": dl.DelegateName, "expires_at": dl.ExpiresAt, "chores": out})
+}
+
+// VerifyDelegatedChore approves or rejects a submitted chore on behalf of
+// the parent, who is told with a chore.delegate_verified event and still
+// builds the payout.
+func (a *API) VerifyDelegatedChore(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	dl, ok := a.delegation(w, r)
+	if !ok {
+		return
+	}
+	var req verifyChoreRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ChoreID) == "" {
+		writeError(w, http.StatusBadRequest, "chore_id is required")
+		return
+	}
+	note, err := util.SanitizeText(req.Note, config.SubmissionNoteMaxLen(), true)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "note "+err.Error())
+		return
+	}
+	ctx := r.Context()
+	c, err := a.db.VerifyDelegatedChore(ctx, dl, req.ChoreID, req.Approve, note)
+	switch {
+	case errors.Is(err, db.ErrNotDelegated):
+		writeError(w, http.StatusForbidden, err.Error())
+		return
+	case errors.Is(err, db.ErrChoreNotSubmitted):
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	payload := map[string]any{"chore": c, "delegation_id": dl.DelegationID, "delegate_name": dl.DelegateName, "approved": req.Approve}
+	if _, err := a.notifier.Emit(ctx, "chore.delegate_verified", dl.ParentEmail, payload); err != nil {
+		log.Printf("delegated verification: emit failed: %v", err)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"chore_id": c.ChoreID, "chore_status": c.ChoreStatus})
+}
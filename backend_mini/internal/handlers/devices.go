@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"backend_mini/internal/config"
+	"backend_mini/internal/db"
+	"backend_mini/internal/util"
+)
+
+type pairDeviceRequest struct {
+	ParentEmail string `json:"parent_email"`
+	KidEmail    string `json:"kid_email"`
+}
+
+type redeemPairingRequest struct {
+	Code     string `json:"code"`
+	Name     string `json:"name"`
+	Platform string `json:"platform,omitempty"`
+	// PublicKey is the base64 ed25519 key the device generated to sign
+	// its requests; the private half never leaves the device.
+	PublicKey string `json:"public_key,omitempty"`
+}
+
+type deviceRequest struct {
+	DeviceID string `json:"device_id"`
+	Name     string `json:"name,omitempty"`
+}
+
+type listDevicesRequest struct {
+	ParentEmail string `json:"parent_email"`
+	KidEmail    string `json:"kid_email,omitempty"`
+}
+
+// PairDevice issues a short-lived one-time code the kid's device redeems.
+func (a *API) PairDevice(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req pairDeviceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" || strings.TrimSpace(req.KidEmail) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email and kid_email are required")
+		return
+	}
+	if _, ok := a.kidOfParent(w, r, req.ParentEmail, req.KidEmail); !ok {
+		return
+	}
+	pc, err := a.db.CreatePairingCode(r.Context(), req.ParentEmail, req.KidEmail)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, pc)
+}
+
+func (a *API) RedeemPairing(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req redeemPairingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.Code) == "" || strings.TrimSpace(req.Name) == "" {
+		writeError(w, http.StatusBadRequest, "code and name are required")
+		return
+	}
+	publicKey := strings.TrimSpace(req.PublicKey)
+	if publicKey == "" && config.DeviceSigningRequired() {
+		writeError(w, http.StatusBadRequest, "public_key is required")
+		return
+	}
+	if publicKey != "" {
+		if _, err := util.ParseDevicePublicKey(publicKey); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	dev, err := a.db.RedeemPairingCode(r.Context(), strings.TrimSpace(req.Code), strings.TrimSpace(req.Name), strings.TrimSpace(req.Platform), publicKey)
+	if errors.Is(err, db.ErrPairingCodeInvalid) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, dev)
+}
+
+func (a *API) ListDevices(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req listDevicesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email is required")
+		return
+	}
+	devices, err := a.db.ListDevices(r.Context(), req.ParentEmail, req.KidEmail)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, devices)
+}
+
+func (a *API) RenameDevice(w http.ResponseWriter, r *http.Request) {
+	a.updateDevice(w, r, true, func(req deviceRequest) error {
+		return a.db.RenameDevice(r.Context(), req.DeviceID, strings.TrimSpace(req.Name))
+	})
+}
+
+func (a *API) UnpairDevice(w http.ResponseWriter, r *http.Request) {
+	a.updateDevice(w, r, false, func(req deviceRequest) error {
+		return a.db.UnpairDevice(r.Context(), req.DeviceID)
+	})
+}
+
+// DeviceHeartbeat stamps last_seen_at; kid devices call it periodically.
+func (a *API) DeviceHeartbeat(w http.ResponseWriter, r *http.Request) {
+	a.updateDevice(w, r, false, func(req deviceRequest) error {
+		return a.db.TouchDevice(r.Context(), req.DeviceID)
+	})
+}
+
+func (a *API) updateDevice(w http.ResponseWriter, r *http.Request, needName bool, apply func(deviceRequest) error) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req deviceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.DeviceID) == "" {
+		writeError(w, http.StatusBadRequest, "device_id is required")
+		return
+	}
+	if needName && strings.TrimSpace(req.Name) == "" {
+		writeError(w, http.StatusBadRequest, "device_id and name are required")
+		return
+	}
+	if err := apply(req); err != nil {
+		if errors.Is(err, db.ErrDeviceNotFound) {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	dev, _, err := a.db.GetDevice(r.Context(), req.DeviceID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, dev)
+}
+
+// DeviceSeqStats totals, per stream, how many sequenced device reports
+// were accepted and how many were dropped as duplicates or stale.
+func (a *API) DeviceSeqStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := a.db.DeviceSeqStats(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
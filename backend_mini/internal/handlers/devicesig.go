@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"backend_mini/internal/config"
+	"backend_mini/internal/db"
+	"backend_mini/internal/util"
+)
+
+// Headers a paired device signs a request with. The signature covers
+// util.DeviceSignedPayload of the method, path, timestamp and body.
+const (
+	DeviceIDHeader        = "X-Sona-Device"
+	DeviceTimestampHeader = "X-Sona-Timestamp"
+	DeviceSignatureHeader = "X-Sona-Signature"
+)
+
+type signedDeviceKey struct{}
+
+// DeviceSigned checks the device signature on requests that carry one and
+// hands the signing device to the handler. A request with a bad signature
+// is refused; one without any is passed on for the handler to decide.
+func (a *API) DeviceSigned(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deviceID, unix, sig := r.Header.Get(DeviceIDHeader), r.Header.Get(DeviceTimestampHeader), r.Header.Get(DeviceSignatureHeader)
+		if deviceID == "" && unix == "" && sig == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if deviceID == "" || unix == "" || sig == "" {
+			writeError(w, http.StatusUnauthorized, fmt.Sprintf("signed requests need %s, %s and %s", DeviceIDHeader, DeviceTimestampHeader, DeviceSignatureHeader))
+			return
+		}
+		ts, err := strconv.ParseInt(unix, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusUnauthorized, DeviceTimestampHeader+" must be unix seconds")
+			return
+		}
+		if skew := time.Since(time.Unix(ts, 0)); skew > config.DeviceSignatureSkew() || -skew > config.DeviceSignatureSkew() {
+			writeError(w, http.StatusUnauthorized, "request timestamp is too far from the server clock")
+			return
+		}
+		maxBytes := config.UsageMaxBatchBytes()
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxBytes+1))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "failed reading body: "+err.Error())
+			return
+		}
+		if int64(len(body)) > maxBytes {
+			writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("body exceeds %d bytes", maxBytes))
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		dev, found, err := a.db.GetDevice(r.Context(), deviceID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if !found || dev.UnpairedAt != "" || dev.PublicKey == "" {
+			writeError(w, http.StatusUnauthorized, "device is not paired with a signing key")
+			return
+		}
+		if !util.VerifyDeviceSignature(dev.PublicKey, sig, util.DeviceSignedPayload(r.Method, r.URL.Path, unix, body)) {
+			writeError(w, http.StatusUnauthorized, "invalid device signature")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), signedDeviceKey{}, dev)))
+	})
+}
+
+// signingDevice returns the device that signed the request, nil when it
+// was not signed. With DEVICE_SIGNING=required an unsigned request is
+// answered 401 and reported as not ok.
+func signingDevice(w http.ResponseWriter, r *http.Request) (*db.Device, bool) {
+	dev, _ := r.Context().Value(signedDeviceKey{}).(*db.Device)
+	if dev == nil && config.DeviceSigningRequired() {
+		writeError(w, http.StatusUnauthorized, "this request must be signed by a paired device")
+		return nil, false
+	}
+	return dev, true
+}
+
+// submittingDevice checks that a chore submission comes from a device
+// paired to the chore's kid, and returns that device's id, or "" for an
+// unsigned submission where those are still accepted.
+func (a *API) submittingDevice(w http.ResponseWriter, r *http.Request, c *db.Chore) (string, bool) {
+	dev, ok := signingDevice(w, r)
+	if !ok || dev == nil {
+		return "", ok
+	}
+	kid, found, err := a.db.GetChildByEmail(r.Context(), dev.KidEmail)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return "", false
+	}
+	if !found || kid.Wallet != c.ChildWallet {
+		writeError(w, http.StatusForbidden, "the signing device belongs to another kid")
+		return "", false
+	}
+	return dev.DeviceID, true
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"backend_mini/internal/balance"
+	"backend_mini/internal/config"
+	"backend_mini/internal/db"
+	"backend_mini/internal/policy"
+	"backend_mini/internal/util"
+)
+
+// transferPreview is what a dry_run request returns instead of a
+// transaction: the legs that would be built and what they would cost.
+type transferPreview struct {
+	DryRun             bool              `json:"dry_run"`
+	From               string            `json:"from"`
+	Legs               []previewLeg      `json:"legs"`
+	Total              uint64            `json:"total"`
+	Split              *util.SplitInfo   `json:"split,omitempty"`
+	Policy             policy.Decision   `json:"policy"`
+	HeldBy             []db.TransferFlag `json:"held_by,omitempty"`
+	DuplicateOf        string            `json:"duplicate_of,omitempty"`
+	NetworkFeeLamports uint64            `json:"network_fee_lamports"`
+	Balance            *uint64           `json:"balance,omitempty"`
+	SufficientBalance  *bool             `json:"sufficient_balance,omitempty"`
+	BalanceError       string            `json:"balance_error,omitempty"`
+}
+
+type previewLeg struct {
+	To     string `json:"to"`
+	Amount uint64 `json:"amount"`
+}
+
+// previewIncomingTransfer runs the same checks as buildIncomingTransfer
+// (addresses, split rule, family policy, review holds, duplicates) and adds the sender's available balance,
+// without building or recording anything. A balance that cannot be fetched
+// is reported, not treated as a failure.
+func (a *API) previewIncomingTransfer(r *http.Request, from, to string, amount uint64) (*transferPreview, error) {
+	ctx := r.Context()
+	if err := util.ValidateAddress(from); err != nil {
+		return nil, err
+	}
+	decision, err := a.transferPolicy(r, from, to, amount)
+	if err != nil {
+		return nil, err
+	}
+	held, err := a.heldForReview(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+	dup, found, err := a.db.RecentDuplicate(ctx, from, to, amount, time.Now().Add(-config.DuplicateTransferWindow()))
+	if err != nil {
+		return nil, err
+	}
+	legs, split, err := a.planIncomingTransfer(ctx, to, amount)
+	if err != nil {
+		return nil, err
+	}
+	p := &transferPreview{DryRun: true, From: from, Legs: []previewLeg{}, Split: split, Policy: decision, HeldBy: held, NetworkFeeLamports: util.SignatureFeeLamports}
+	if found {
+		p.DuplicateOf = dup.TransferID
+	}
+	for _, leg := range legs {
+		if err := util.ValidateAddress(leg.To); err != nil {
+			return nil, err
+		}
+		p.Legs = append(p.Legs, previewLeg{To: leg.To, Amount: leg.Amount})
+		p.Total += leg.Amount
+	}
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	b, err := balance.Get(ctx, a.db, from)
+	if err != nil {
+		p.BalanceError = err.Error()
+		return p, nil
+	}
+	ok := b.Available >= p.Total
+	p.Balance, p.SufficientBalance = &b.Available, &ok
+	return p, nil
+}
+
+// previewChoreUpdate answers a dry_run /update_chore: the chore as it would
+// look after the change and, for completion, the payout preview.
+func (a *API) previewChoreUpdate(w http.ResponseWriter, r *http.Request, req updateChoreRequest) {
+	ctx := r.Context()
+	chore, found, err := a.db.GetChore(ctx, req.ChoreID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "chore not found")
+		return
+	}
+	chore.ChoreStatus = req.NewStatus
+	resp := map[string]interface{}{
+		"dry_run": true,
+		"chore":   chore,
+	}
+	if req.NewStatus == 3 {
+		from, to, _ := payoutDirection(chore)
+		preview, err := a.previewIncomingTransfer(r, from, to, chore.BountyAmount)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		resp["transaction"] = preview
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// checkDuplicate looks for an identical transfer built within the duplicate
+// window. In block mode it answers 409 unless force is set; otherwise it
+// returns the earlier transfer's id so the response can carry a warning.
+func (a *API) checkDuplicate(w http.ResponseWriter, r *http.Request, from, to string, amount uint64, force bool) (string, bool) {
+	dup, found, err := a.db.RecentDuplicate(r.Context(), from, to, amount, time.Now().Add(-config.DuplicateTransferWindow()))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return "", false
+	}
+	if !found {
+		return "", true
+	}
+	if config.DuplicateTransferBlocks() && !force {
+		writeJSON(w, http.StatusConflict, map[string]interface{}{
+			"error":        "an identical transfer was built moments ago; resend with force to build it again",
+			"duplicate_of": dup,
+		})
+		return "", false
+	}
+	return dup.TransferID, true
+}
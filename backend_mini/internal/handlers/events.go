@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"backend_mini/internal/db"
+	"backend_mini/internal/notify"
+)
+
+const (
+	defaultEventPage = 50
+	maxEventPage     = 200
+	// stays below the server's WriteTimeout
+	maxEventWait = 10 * time.Second
+
+	maxPollers          = 256
+	maxPollersPerParent = 4
+)
+
+type pollEventsRequest struct {
+	ParentEmail string `json:"parent_email"`
+	After       int64  `json:"after,omitempty"`
+	Limit       int    `json:"limit,omitempty"`
+	WaitSeconds int    `json:"wait_seconds,omitempty"`
+}
+
+// pollLimiter caps concurrent long-polls overall and per parent so a client
+// retrying in a tight loop cannot pin every connection.
+type pollLimiter struct {
+	mu        sync.Mutex
+	total     int
+	perKey    map[string]int
+	maxTotal  int
+	maxPerKey int
+}
+
+func newPollLimiter(maxTotal, maxPerKey int) *pollLimiter {
+	return &pollLimiter{perKey: map[string]int{}, maxTotal: maxTotal, maxPerKey: maxPerKey}
+}
+
+func (l *pollLimiter) acquire(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.total >= l.maxTotal || l.perKey[key] >= l.maxPerKey {
+		return false
+	}
+	l.total++
+	l.perKey[key]++
+	return true
+}
+
+func (l *pollLimiter) release(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.total--
+	if l.perKey[key]--; l.perKey[key] <= 0 {
+		delete(l.perKey, key)
+	}
+}
+
+// PollEvents returns the parent's events with seq > after. When there are
+// none it holds the request up to wait_seconds for the next one. Clients
+// pass the returned "next" as "after" on the following call.
+func (a *API) PollEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req pollEventsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email is required")
+		return
+	}
+	if req.After < 0 {
+		writeError(w, http.StatusBadRequest, "after must not be negative")
+		return
+	}
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultEventPage
+	}
+	if limit > maxEventPage {
+		limit = maxEventPage
+	}
+	wait := time.Duration(req.WaitSeconds) * time.Second
+	if wait > maxEventWait {
+		wait = maxEventWait
+	}
+
+	key := notify.EventsKey(req.ParentEmail)
+	if !a.pollers.acquire(key) {
+		w.Header().Set("Retry-After", "1")
+		writeError(w, http.StatusTooManyRequests, "too many concurrent polls")
+		return
+	}
+	defer a.pollers.release(key)
+
+	ctx := r.Context()
+	deadline := time.NewTimer(wait)
+	defer deadline.Stop()
+	for {
+		woken, cancel := a.hub.Wait(key)
+		// fetch one extra row to know whether more are waiting
+		events, err := a.db.GetEvents(ctx, req.ParentEmail, req.After, limit+1)
+		if err != nil {
+			cancel()
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if len(events) > 0 || wait <= 0 {
+			cancel()
+			writeEventPage(w, events, req.After, limit)
+			return
+		}
+		select {
+		case <-woken:
+			cancel()
+		case <-deadline.C:
+			cancel()
+			writeEventPage(w, events, req.After, limit)
+			return
+		case <-ctx.Done():
+			cancel()
+			return
+		}
+	}
+}
+
+func writeEventPage(w http.ResponseWriter, events []db.Event, after int64, limit int) {
+	hasMore := len(events) > limit
+	if hasMore {
+		events = events[:limit]
+	}
+	next := after
+	if len(events) > 0 {
+		next = events[len(events)-1].Seq
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"events":   events,
+		"next":     next,
+		"has_more": hasMore,
+	})
+}
@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend_mini/internal/config"
+	"backend_mini/internal/db"
+	"backend_mini/internal/util"
+)
+
+type createGiftRequest struct {
+	ParentEmail string `json:"parent_email"`
+	KidEmail    string `json:"kid_email"`
+	Amount      string `json:"amount,omitempty"`
+	Note        string `json:"note,omitempty"`
+}
+
+type giftRequest struct {
+	ParentEmail string `json:"parent_email"`
+	KidEmail    string `json:"kid_email,omitempty"`
+	GiftID      string `json:"gift_id,omitempty"`
+}
+
+// CreateGift makes a one-time link a relative without an account can use
+// to send the kid money. The link is returned once.
+func (a *API) CreateGift(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req createGiftRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" || strings.TrimSpace(req.KidEmail) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email and kid_email are required")
+		return
+	}
+	var amount uint64
+	if req.Amount != "" {
+		var err error
+		if amount, err = strconv.ParseUint(req.Amount, 10, 64); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid amount")
+			return
+		}
+	}
+	note, err := util.SanitizeText(req.Note, config.GiftMessageMaxLen(), true)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "note "+err.Error())
+		return
+	}
+	kid, ok := a.kidOfParent(w, r, req.ParentEmail, req.KidEmail)
+	if !ok {
+		return
+	}
+	if kid.Wallet == "" {
+		writeError(w, http.StatusConflict, "kid has no wallet to receive gifts")
+		return
+	}
+	g, token, err := a.db.CreateGift(r.Context(), db.Gift{ParentEmail: req.ParentEmail, KidEmail: kid.Email, Wallet: kid.Wallet, Amount: amount, Note: note}, config.GiftTTL())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"gift": g, "link": a.giftLink(r, req.ParentEmail, token)})
+}
+
+func (a *API) ListGifts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req giftRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email is required")
+		return
+	}
+	gifts, err := a.db.ListGifts(r.Context(), req.ParentEmail, req.KidEmail)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, gifts)
+}
+
+func (a *API) CancelGift(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req giftRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" || strings.TrimSpace(req.GiftID) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email and gift_id are required")
+		return
+	}
+	g, err := a.db.CancelGift(r.Context(), req.ParentEmail, req.GiftID)
+	if errors.Is(err, db.ErrGiftClosed) {
+		writeError(w, http.StatusConflict, "gift is not open or does not belong to this parent")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, g)
+}
+
+const maxGiftFromName = 80
+
+type signGiftRequest struct {
+	FromName string `json:"from_name"`
+	Message  string `json:"message"`
+}
+
+// giftView is what the relative sees: no emails, only the kid's name and
+// how to pay.
+type giftView struct {
+	KidName      string `json:"kid_name"`
+	Amount       uint64 `json:"amount"`
+	Note         string `json:"note,omitempty"`
+	FromName     string `json:"from_name,omitempty"`
+	Message      string `json:"message,omitempty"`
+	Status       string `json:"status"`
+	ExpiresAt    string `json:"expires_at"`
+	SolanaPayURL string `json:"solana_pay_url,omitempty"`
+	OnrampURL    string `json:"onramp_url,omitempty"`
+}
+
+// GiftLink serves the relative's side of a gift link at /gift/{token}. GET
+// shows the gift; POST {"from_name","message"} signs it before paying.
+// It needs no authentication: the token is the credential.
+func (a *API) GiftLink(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	ctx := r.Context()
+	g, found, err := a.db.GetGiftByToken(ctx, r.PathValue("token"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "gift not found")
+		return
+	}
+	if r.Method == http.MethodPost {
+		var req signGiftRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid json")
+			return
+		}
+		fromName, err := util.SanitizeText(req.FromName, maxGiftFromName, false)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "from_name "+err.Error())
+			return
+		}
+		if fromName == "" {
+			writeError(w, http.StatusBadRequest, "from_name is required")
+			return
+		}
+		message, err := util.SanitizeText(req.Message, config.GiftMessageMaxLen(), true)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "message "+err.Error())
+			return
+		}
+		if g, err = a.db.SignGift(ctx, g.GiftID, fromName, message); err != nil {
+			if errors.Is(err, db.ErrGiftClosed) {
+				writeError(w, http.StatusGone, err.Error())
+				return
+			}
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	view := giftView{Amount: g.Amount, Note: g.Note, FromName: g.FromName, Message: g.Message, Status: g.Status, ExpiresAt: g.ExpiresAt}
+	if g.Waiting() && g.ExpiresAt <= time.Now().UTC().Format(time.RFC3339) {
+		// the watcher closes it on its next run
+		view.Status = db.GiftExpired
+	}
+	if kid, found, err := a.db.GetChildByEmail(ctx, g.KidEmail); err == nil && found {
+		view.KidName = kid.Name
+	}
+	if view.Status == db.GiftOpen || view.Status == db.GiftPending {
+		view.SolanaPayURL = util.SolanaPayURL(g.Wallet, g.Amount, g.Reference, "Gift for "+view.KidName, g.Note)
+		if tmpl := config.GiftOnrampURL(); tmpl != "" {
+			amount := ""
+			if g.Amount > 0 {
+				amount = util.FormatTokenAmount(g.Amount, util.EURCDecimals)
+			}
+			view.OnrampURL = strings.NewReplacer("{wallet}", g.Wallet, "{amount}", amount).Replace(tmpl)
+		}
+	}
+	writeJSON(w, http.StatusOK, view)
+}
@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+
+	"backend_mini/internal/config"
+	"backend_mini/internal/db"
+	"backend_mini/internal/util"
+)
+
+// handlePattern allows 3 to 30 lower-case letters, digits and single
+// hyphens, starting and ending with a letter or digit.
+var handlePattern = regexp.MustCompile(`^[a-z0-9](?:[a-z0-9]|-[a-z0-9]){2,29}$`)
+
+type claimHandleRequest struct {
+	ParentEmail string `json:"parent_email"`
+	// Handle may carry a leading "@"; empty drops the current handle.
+	Handle string `json:"handle"`
+}
+
+type handleHistoryRequest struct {
+	ParentEmail string `json:"parent_email"`
+}
+
+// checkHandle normalizes a requested handle and says what is wrong with
+// it, if anything.
+func checkHandle(raw string) (string, string) {
+	h := strings.ToLower(strings.TrimPrefix(strings.TrimSpace(raw), "@"))
+	if h == "" {
+		return "", ""
+	}
+	if len(h) > 30 || !handlePattern.MatchString(h) {
+		return h, "handle must be 3 to 30 letters, digits or single hyphens, starting and ending with a letter or digit"
+	}
+	if slices.Contains(config.ReservedHandles(), h) {
+		return h, "that handle is reserved"
+	}
+	if _, found := util.ScreenText(strings.ReplaceAll(h, "-", " "), config.ProfanityWords()); len(found) > 0 {
+		return h, "that handle is not allowed"
+	}
+	return h, ""
+}
+
+// ClaimHandle gives the family a vanity handle for its public code. The
+// handle it had before keeps redirecting for HANDLE_HOLD.
+func (a *API) ClaimHandle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req claimHandleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email is required")
+		return
+	}
+	handle, problem := checkHandle(req.Handle)
+	if problem != "" {
+		writeError(w, http.StatusUnprocessableEntity, problem)
+		return
+	}
+	ctx := r.Context()
+	if _, found, err := a.db.GetParentByEmail(ctx, req.ParentEmail); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	} else if !found {
+		writeError(w, http.StatusNotFound, "parent not found")
+		return
+	}
+	h, err := a.db.ClaimHandle(ctx, req.ParentEmail, handle, config.HandleHold())
+	if errors.Is(err, db.ErrHandleTaken) {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, h)
+}
+
+// HandleHistory lists the handles the family has held.
+func (a *API) HandleHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req handleHistoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email is required")
+		return
+	}
+	history, err := a.db.HandleHistory(r.Context(), req.ParentEmail)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, history)
+}
+
+// resolveShare finds the family behind the {code} path segment. An old
+// handle is answered with a permanent redirect to the same path under the
+// current handle (or the public code, if the family dropped its handle),
+// and resolveShare then reports false.
+func (a *API) resolveShare(w http.ResponseWriter, r *http.Request) (*db.ShareTarget, bool) {
+	code := r.PathValue("code")
+	t, err := a.db.ResolveShareCode(r.Context(), code, config.HandleHold())
+	if errors.Is(err, db.ErrShareCodeUnknown) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return nil, false
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return nil, false
+	}
+	if t.RedirectedFrom != "" {
+		to := t.Code
+		if t.Handle != "" {
+			to = "@" + t.Handle
+		}
+		// 308 keeps the method and body, so a signed gift POST follows too
+		http.Redirect(w, r, strings.Replace(r.URL.Path, "/"+code, "/"+to, 1), http.StatusPermanentRedirect)
+		return nil, false
+	}
+	return t, true
+}
+
+// Share resolves a public code, or a handle as @handle, at /share/{code}.
+// It needs no authentication and shows only the code and handle.
+func (a *API) Share(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	t, ok := a.resolveShare(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, t)
+}
+
+// ShareGift serves a gift link under a family's code or handle at
+// /share/{code}/gift/{token}, as GiftLink does, once the gift is known to
+// be that family's.
+func (a *API) ShareGift(w http.ResponseWriter, r *http.Request) {
+	t, ok := a.resolveShare(w, r)
+	if !ok {
+		return
+	}
+	g, found, err := a.db.GetGiftByToken(r.Context(), r.PathValue("token"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found || !strings.EqualFold(g.ParentEmail, t.ParentEmail) {
+		writeError(w, http.StatusNotFound, "gift not found")
+		return
+	}
+	a.GiftLink(w, r)
+}
+
+// giftLink is the link a relative gets for token: under the family's
+// handle when it has one.
+func (a *API) giftLink(r *http.Request, parentEmail, token string) string {
+	if handle, err := a.db.FamilyHandle(r.Context(), parentEmail); err == nil && handle != "" {
+		return config.HandleLinkBase() + handle + "/gift/" + token
+	}
+	return config.GiftLinkBase() + token
+}
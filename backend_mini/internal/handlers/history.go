@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type familyAsOfRequest struct {
+	ParentEmail string `json:"parent_email"`
+	// At is an RFC 3339 timestamp.
+	At string `json:"at"`
+}
+
+type choreHistoryRequest struct {
+	ChoreID string `json:"chore_id"`
+}
+
+// FamilyAsOf shows support a family's chores and limits as they stood at a
+// past moment, for disputes about what a kid was paid or charged.
+func (a *API) FamilyAsOf(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req familyAsOfRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" || strings.TrimSpace(req.At) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email and at are required")
+		return
+	}
+	at, err := time.Parse(time.RFC3339, req.At)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "at must be an RFC 3339 timestamp")
+		return
+	}
+	ctx := r.Context()
+	p, found, err := a.db.GetParentByEmail(ctx, req.ParentEmail)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "parent not found")
+		return
+	}
+	snap, err := a.db.FamilyAsOf(ctx, p.Wallet, p.Email, at)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, snap)
+}
+
+// ChoreHistory lists every version of a chore, oldest first.
+func (a *API) ChoreHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req choreHistoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ChoreID) == "" {
+		writeError(w, http.StatusBadRequest, "chore_id is required")
+		return
+	}
+	versions, err := a.db.ChoreVersions(r.Context(), req.ChoreID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if len(versions) == 0 {
+		writeError(w, http.StatusNotFound, "chore not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, versions)
+}
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"backend_mini/internal/config"
+	"backend_mini/internal/db"
+	"backend_mini/internal/iap"
+)
+
+type validateIAPRequest struct {
+	ParentEmail string `json:"parent_email"`
+	Store       string `json:"store"`
+	// Receipt is the base64 App Store receipt; PurchaseToken the Play one.
+	Receipt       string `json:"receipt,omitempty"`
+	PurchaseToken string `json:"purchase_token,omitempty"`
+}
+
+type entitlementRequest struct {
+	ParentEmail string `json:"parent_email"`
+}
+
+// newPlayStore sets up Play validation from config, or returns nil when it
+// is not configured.
+func newPlayStore() *iap.PlayStore {
+	path := config.PlayServiceAccountFile()
+	if path == "" {
+		return nil
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		log.Printf("play store: %v; play purchases cannot be validated", err)
+		return nil
+	}
+	ps, err := iap.NewPlayStore(config.PlayPackageName(), raw, config.PlayAPIBase())
+	if err != nil {
+		log.Printf("%v; play purchases cannot be validated", err)
+		return nil
+	}
+	return ps
+}
+
+// ValidateIAP checks an in-app purchase with its store and records the
+// subscription, then returns what the family is entitled to.
+func (a *API) ValidateIAP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req validateIAPRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" || strings.TrimSpace(req.Store) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email and store are required")
+		return
+	}
+	ctx := r.Context()
+	if _, found, err := a.db.GetParentByEmail(ctx, req.ParentEmail); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	} else if !found {
+		writeError(w, http.StatusNotFound, "parent not found")
+		return
+	}
+	var p *iap.Purchase
+	var err error
+	switch req.Store {
+	case iap.StoreAppStore:
+		if req.Receipt == "" {
+			writeError(w, http.StatusBadRequest, "receipt is required for the app store")
+			return
+		}
+		p, err = iap.AppStore{
+			SharedSecret: config.AppStoreSharedSecret(),
+			BundleID:     config.AppStoreBundleID(),
+			VerifyURL:    config.AppStoreVerifyURL(),
+			SandboxURL:   config.AppStoreSandboxVerifyURL(),
+		}.Validate(ctx, req.Receipt)
+	case iap.StorePlayStore:
+		if req.PurchaseToken == "" {
+			writeError(w, http.StatusBadRequest, "purchase_token is required for the play store")
+			return
+		}
+		if a.playStore == nil {
+			writeError(w, http.StatusServiceUnavailable, "play store purchases cannot be validated right now")
+			return
+		}
+		p, err = a.playStore.Validate(ctx, req.PurchaseToken)
+	default:
+		writeError(w, http.StatusBadRequest, "store must be app_store or play_store")
+		return
+	}
+	if errors.Is(err, iap.ErrInvalidReceipt) {
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	if err != nil {
+		// the store could not be reached; the client should retry
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	sub, err := a.db.UpsertSubscription(ctx, db.Subscription{
+		ParentEmail: req.ParentEmail,
+		Source:      p.Store,
+		ExternalID:  p.ExternalID,
+		ProductID:   p.ProductID,
+		Status:      p.State,
+		ExpiresAt:   p.ExpiresAt.Format(time.RFC3339),
+		AutoRenew:   p.AutoRenew,
+	})
+	if errors.Is(err, db.ErrSubscriptionOwned) {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	ent, err := a.db.FamilyEntitlement(ctx, req.ParentEmail, time.Now())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"subscription": sub, "entitlement": ent})
+}
+
+// Entitlements shows what the family may use and the subscriptions behind
+// it.
+func (a *API) Entitlements(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req entitlementRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email is required")
+		return
+	}
+	ctx := r.Context()
+	ent, err := a.db.FamilyEntitlement(ctx, req.ParentEmail, time.Now())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	subs, err := a.db.ListSubscriptions(ctx, req.ParentEmail)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"entitlement": ent, "subscriptions": subs})
+}
+
+// requireEntitlement answers 402 unless the family has feature, and
+// reports whether it does.
+func (a *API) requireEntitlement(w http.ResponseWriter, r *http.Request, parentEmail, feature string) bool {
+	ent, err := a.db.FamilyEntitlement(r.Context(), parentEmail, time.Now())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return false
+	}
+	if !ent.Has(feature) {
+		writeJSON(w, http.StatusPaymentRequired, map[string]string{"error": "this needs a premium subscription", "feature": feature})
+		return false
+	}
+	return true
+}
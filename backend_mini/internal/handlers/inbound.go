@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"regexp"
+	"strings"
+
+	"backend_mini/internal/config"
+	"backend_mini/internal/db"
+	"backend_mini/internal/util"
+)
+
+// maxInboundEmailBytes bounds a provider post, attachments included.
+const maxInboundEmailBytes = 10 << 20
+
+const choreLineHelp = `Write one chore per line as "chore - amount - kid", e.g. "Take out trash - 2 EUR - Emma".`
+
+var (
+	choreLineSeparator = regexp.MustCompile(`\s+[-–—]\s+`)
+	choreLineAmount    = regexp.MustCompile(`(?i)^(?:€\s*)?([0-9]+(?:[.,][0-9]+)?)\s*(?:eurc?|€)?$`)
+	choreLineBullet    = regexp.MustCompile(`^[-*•]\s+`)
+	replyPrefix        = regexp.MustCompile(`(?i)^\s*((re|fwd?|aw|wg)\s*:\s*)+`)
+	quoteHeader        = regexp.MustCompile(`^On .+ wrote:$`)
+)
+
+// choreLine is one "Take out trash - 2 EUR - Emma" line of an email.
+type choreLine struct {
+	Name   string
+	Amount uint64
+	Kid    string
+}
+
+// parseChoreLine reads "chore - amount - kid". ok is false for lines not
+// meant as a chore at all; err says what is wrong with one that is.
+func parseChoreLine(line string) (c choreLine, ok bool, err error) {
+	line = choreLineBullet.ReplaceAllString(strings.TrimSpace(line), "")
+	parts := choreLineSeparator.Split(line, -1)
+	if len(parts) < 2 {
+		return c, false, nil
+	}
+	if len(parts) != 3 {
+		return c, true, errors.New(choreLineHelp)
+	}
+	m := choreLineAmount.FindStringSubmatch(strings.TrimSpace(parts[1]))
+	if m == nil {
+		return c, true, fmt.Errorf("%q is not an amount like \"2 EUR\"", parts[1])
+	}
+	if c.Amount, err = util.ParseTokenAmount(m[1], util.EURCDecimals); err != nil {
+		return c, true, err
+	}
+	c.Name, c.Kid = strings.TrimSpace(parts[0]), strings.TrimSpace(parts[2])
+	if c.Name == "" || c.Kid == "" {
+		return c, true, errors.New(choreLineHelp)
+	}
+	return c, true, nil
+}
+
+// emailChoreLines is the subject followed by the body up to the signature
+// or the quoted message being replied to.
+func emailChoreLines(subject, body string) []string {
+	lines := []string{replyPrefix.ReplaceAllString(subject, "")}
+	for _, l := range strings.Split(strings.ReplaceAll(body, "\r\n", "\n"), "\n") {
+		t := strings.TrimSpace(l)
+		if l == "-- " || t == "--" || strings.HasPrefix(t, ">") || quoteHeader.MatchString(t) {
+			break
+		}
+		lines = append(lines, t)
+	}
+	return lines
+}
+
+// senderAuthenticated reports whether the From domain passed DKIM, or SPF
+// for an envelope sender in that same domain, as the provider reported.
+// The formats are SendGrid Inbound Parse's: dkim is "{@example.com : pass}"
+// with one entry per signature, envelope is JSON with "from".
+func senderAuthenticated(from *mail.Address, spf, dkim, envelope string) bool {
+	_, domain, _ := strings.Cut(strings.ToLower(from.Address), "@")
+	for _, sig := range strings.Split(strings.Trim(dkim, "{} "), ",") {
+		d, result, _ := strings.Cut(sig, ":")
+		if strings.TrimSpace(strings.ToLower(d)) == "@"+domain && strings.TrimSpace(strings.ToLower(result)) == "pass" {
+			return true
+		}
+	}
+	var env struct {
+		From string `json:"from"`
+	}
+	if strings.EqualFold(strings.TrimSpace(spf), "pass") && json.Unmarshal([]byte(envelope), &env) == nil {
+		_, envDomain, _ := strings.Cut(strings.ToLower(env.From), "@")
+		return envDomain == domain
+	}
+	return false
+}
+
+// matchKid finds the kid a chore line names: the one with that name, or
+// the only one whose name starts with it.
+func matchKid(kids []db.KidSummary, name string) (*db.KidSummary, error) {
+	var prefixed []*db.KidSummary
+	for i := range kids {
+		if strings.EqualFold(kids[i].Name, name) {
+			return &kids[i], nil
+		}
+		if strings.HasPrefix(strings.ToLower(kids[i].Name), strings.ToLower(name)) {
+			prefixed = append(prefixed, &kids[i])
+		}
+	}
+	switch len(prefixed) {
+	case 1:
+		return prefixed[0], nil
+	case 0:
+		return nil, fmt.Errorf("no kid called %q", name)
+	}
+	return nil, fmt.Errorf("more than one kid's name starts with %q", name)
+}
+
+// InboundEmail takes mail sent to the chores address from an inbound parse
+// webhook (SendGrid's multipart format) at /inbound/email/{secret}. A
+// parent writing from their own, authenticated address gets a chore per
+// "chore - amount - kid" line and a reply saying what was created. Mail it
+// drops is still answered 200 so the provider does not retry it.
+func (a *API) InboundEmail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	secret := config.InboundEmailSecret()
+	if secret == "" || subtle.ConstantTimeCompare([]byte(r.PathValue("secret")), []byte(secret)) != 1 {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxInboundEmailBytes)
+	if err := r.ParseMultipartForm(1 << 20); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid form: "+err.Error())
+		return
+	}
+	ignore := func(why string) {
+		log.Printf("inbound email from %q dropped: %s", r.FormValue("from"), why)
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ignored", "reason": why})
+	}
+	from, err := mail.ParseAddress(r.FormValue("from"))
+	if err != nil {
+		ignore("unreadable sender")
+		return
+	}
+	subject, text := r.FormValue("subject"), r.FormValue("text")
+	msgID := ""
+	if m, err := mail.ReadMessage(strings.NewReader(strings.TrimSpace(r.FormValue("headers")) + "\r\n\r\n")); err == nil {
+		msgID = strings.TrimSpace(m.Header.Get("Message-Id"))
+	}
+	if msgID == "" {
+		sum := sha256.Sum256([]byte(from.Address + "\n" + subject + "\n" + text))
+		msgID = "sha256:" + hex.EncodeToString(sum[:])
+	}
+	ctx := r.Context()
+	if seen, err := a.db.InboundEmailSeen(ctx, msgID); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	} else if seen {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "duplicate"})
+		return
+	}
+	p, found, err := a.db.GetParentByEmail(ctx, from.Address)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	// no replies to unknown or unverified senders, which would only
+	// bounce spam at whoever it was forged as
+	if !found {
+		ignore("sender is not a parent")
+		return
+	}
+	if config.InboundEmailRequireAuth() && !senderAuthenticated(from, r.FormValue("SPF"), r.FormValue("dkim"), r.FormValue("envelope")) {
+		ignore("sender failed SPF and DKIM")
+		return
+	}
+	kids, err := a.db.ListKids(ctx, p.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var created, problems []string
+	attempted := false
+	for _, line := range emailChoreLines(subject, text) {
+		c, ok, err := parseChoreLine(line)
+		if !ok {
+			continue
+		}
+		attempted = true
+		if err == nil && len(created) >= config.InboundEmailMaxChores() {
+			problems = append(problems, fmt.Sprintf("%q: at most %d chores per email", line, config.InboundEmailMaxChores()))
+			continue
+		}
+		var kid *db.KidSummary
+		if err == nil {
+			kid, err = matchKid(kids, c.Kid)
+		}
+		if err == nil && (kid.Wallet == "" || p.Wallet == "") {
+			err = errors.New("wallets are not set up for " + kid.Name + " yet")
+		}
+		if err == nil {
+			c.Name, _, err = sanitizeChoreText(c.Name, "")
+		}
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%q: %v", line, err))
+			continue
+		}
+		chore, err := a.db.CreateChore(ctx, p.Wallet, kid.Wallet, c.Name, "", c.Amount, "", db.ChoreKindChore)
+		var qe *db.QuotaError
+		if errors.As(err, &qe) {
+			problems = append(problems, fmt.Sprintf("%q: %v", line, qe))
+			break
+		}
+		if err != nil {
+			log.Printf("inbound email: creating chore: %v", err)
+			problems = append(problems, fmt.Sprintf("%q: could not be saved, please try again", line))
+			continue
+		}
+		a.emitChoreEvent(ctx, "chore.created", chore)
+		created = append(created, fmt.Sprintf("%s, %s EUR, for %s", chore.ChoreName, util.FormatTokenAmount(chore.BountyAmount, util.EURCDecimals), kid.Name))
+	}
+	if err := a.db.RecordInboundEmail(ctx, msgID, p.Email, len(created)); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var body strings.Builder
+	switch {
+	case !attempted:
+		body.WriteString("We could not find any chores in your email. " + choreLineHelp + "\n")
+	case len(created) > 0:
+		fmt.Fprintf(&body, "Created %d chore(s):\n", len(created))
+		for _, c := range created {
+			body.WriteString("- " + c + "\n")
+		}
+	}
+	if len(problems) > 0 {
+		body.WriteString("\nThese lines were not used:\n")
+		for _, pr := range problems {
+			body.WriteString("- " + pr + "\n")
+		}
+	}
+	replySubject := "Re: " + replyPrefix.ReplaceAllString(subject, "")
+	if strings.TrimSpace(subject) == "" {
+		replySubject = "Your chores"
+	}
+	a.notifier.Email(ctx, p.Email, "chores.emailed", map[string]any{"created": created, "problems": problems}, replySubject, body.String())
+	writeJSON(w, http.StatusOK, map[string]any{"status": "ok", "created": len(created), "problems": len(problems)})
+}
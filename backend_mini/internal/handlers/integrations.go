@@ -0,0 +1,253 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"backend_mini/internal/db"
+	"backend_mini/internal/netguard"
+	"backend_mini/internal/notify"
+	"backend_mini/internal/relay"
+	"backend_mini/internal/webhook"
+)
+
+// templateRoots are the top-level fields of an event a template may refer to.
+var templateRoots = map[string]bool{"type": true, "created_at": true, "data": true, "message": true}
+
+var choreEventNames = map[int]string{0: "assigned", 1: "pending", 3: "completed", 4: "rejected"}
+
+var penaltyEventNames = map[int]string{0: "issued", 3: "acknowledged", 4: "waived"}
+
+// choreEventType names the event for a chore moving to status: chore.* for
+// chores and penalty.* for penalties.
+func choreEventType(c *db.Chore, status int) (string, bool) {
+	if c.Kind == db.ChoreKindPenalty {
+		name, ok := penaltyEventNames[status]
+		return "penalty." + name, ok
+	}
+	name, ok := choreEventNames[status]
+	return "chore." + name, ok
+}
+
+// payoutDirection is who pays whom when a chore reaches status 3: the
+// parent pays a chore's bounty, the kid pays a penalty.
+func payoutDirection(c *db.Chore) (from, to, kind string) {
+	if c.Kind == db.ChoreKindPenalty {
+		return c.ChildWallet, c.ParentWallet, db.TransferKindPenalty
+	}
+	return c.ParentWallet, c.ChildWallet, db.TransferKindChorePayout
+}
+
+type setIntegrationRequest struct {
+	ParentEmail   string            `json:"parent_email"`
+	IntegrationID string            `json:"integration_id"`
+	Name          string            `json:"name"`
+	Kind          string            `json:"kind"`
+	URL           string            `json:"url"`
+	EventTypes    []string          `json:"event_types"`
+	Template      map[string]string `json:"template"`
+}
+
+type integrationRequest struct {
+	ParentEmail   string `json:"parent_email"`
+	IntegrationID string `json:"integration_id"`
+	EventType     string `json:"event_type"`
+}
+
+func (a *API) SetIntegration(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req setIntegrationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" || strings.TrimSpace(req.URL) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email and url are required")
+		return
+	}
+	if req.Kind == "" {
+		req.Kind = relay.KindGeneric
+	}
+	if req.Kind != relay.KindZapier && req.Kind != relay.KindIFTTT && req.Kind != relay.KindGeneric {
+		writeError(w, http.StatusBadRequest, "kind must be zapier, ifttt or generic")
+		return
+	}
+	if req.Kind == relay.KindGeneric && len(req.Template) == 0 {
+		writeError(w, http.StatusBadRequest, "template is required for generic integrations")
+		return
+	}
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		writeError(w, http.StatusBadRequest, "url must be an absolute http(s) url")
+		return
+	}
+	if err := netguard.CheckURL(u); err != nil {
+		writeError(w, http.StatusBadRequest, "url "+err.Error())
+		return
+	}
+	for _, path := range relay.Placeholders(req.Template) {
+		root, _, _ := strings.Cut(path, ".")
+		if !templateRoots[root] {
+			writeError(w, http.StatusBadRequest, "template placeholder {{"+path+"}} must start with type, created_at, data or message")
+			return
+		}
+	}
+	ctx := r.Context()
+	if _, found, err := a.db.GetParentByEmail(ctx, req.ParentEmail); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	} else if !found {
+		writeError(w, http.StatusNotFound, "parent not found")
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = req.Kind
+	}
+	var tmpl map[string]string
+	if len(req.Template) > 0 {
+		tmpl = req.Template
+	}
+	in, err := a.db.SaveIntegration(ctx, db.Integration{
+		IntegrationID: req.IntegrationID,
+		ParentEmail:   req.ParentEmail,
+		Name:          name,
+		Kind:          req.Kind,
+		URL:           u.String(),
+		EventTypes:    req.EventTypes,
+		Template:      tmpl,
+	})
+	if errors.Is(err, db.ErrIntegrationNotFound) {
+		writeError(w, http.StatusNotFound, "integration not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, in)
+}
+
+func (a *API) ListIntegrations(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req integrationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email is required")
+		return
+	}
+	list, err := a.db.ListIntegrations(r.Context(), req.ParentEmail)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (a *API) DeleteIntegration(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req integrationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" || strings.TrimSpace(req.IntegrationID) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email and integration_id are required")
+		return
+	}
+	err := a.db.DeleteIntegration(r.Context(), req.ParentEmail, req.IntegrationID)
+	if errors.Is(err, db.ErrIntegrationNotFound) {
+		writeError(w, http.StatusNotFound, "integration not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{"deleted": true})
+}
+
+// TestIntegration sends a sample event through the integration's template
+// and reports both the rendered body and the receiver's answer.
+func (a *API) TestIntegration(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req integrationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" || strings.TrimSpace(req.IntegrationID) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email and integration_id are required")
+		return
+	}
+	ctx := r.Context()
+	in, err := a.db.GetIntegration(ctx, req.IntegrationID)
+	if errors.Is(err, db.ErrIntegrationNotFound) || (err == nil && in.ParentEmail != strings.ToLower(req.ParentEmail)) {
+		writeError(w, http.StatusNotFound, "integration not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	eventType := req.EventType
+	if eventType == "" {
+		eventType = "chore.completed"
+	}
+	res, body, err := notify.Relay(ctx, in, webhook.Event{
+		Type:      eventType,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+		Data: &db.Chore{
+			ChoreID:      "TEST01",
+			ChoreName:    "Test chore",
+			BountyAmount: 1000000,
+			ChoreStatus:  3,
+			Kind:         db.ChoreKindChore,
+		},
+	})
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"body":   body,
+		"result": res,
+	})
+}
+
+// emitChoreEvent publishes chore.<status> to the owning parent's events,
+// webhooks and integrations. Failures are logged and never fail the request.
+func (a *API) emitChoreEvent(ctx context.Context, eventType string, chore *db.Chore) {
+	parent, found, err := a.db.GetParentByWallet(ctx, chore.ParentWallet)
+	if err != nil {
+		log.Printf("chore %s: failed resolving parent for %s: %v", chore.ChoreID, eventType, err)
+		return
+	}
+	if !found {
+		return
+	}
+	if _, err := a.notifier.Emit(ctx, eventType, parent.Email, chore); err != nil {
+		log.Printf("chore %s: failed emitting %s: %v", chore.ChoreID, eventType, err)
+	}
+}
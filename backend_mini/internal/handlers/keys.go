@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"crypto/ecdh"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+type publishKeyRequest struct {
+	Email     string `json:"email"`
+	PublicKey string `json:"public_key"`
+}
+
+type publicKeyRequest struct {
+	Email          string `json:"email"`
+	IncludeRetired bool   `json:"include_retired,omitempty"`
+}
+
+type rotateKeysRequest struct {
+	Email        string `json:"email"`
+	NewPublicKey string `json:"new_public_key"`
+}
+
+// parseP256PublicKey accepts a base64 uncompressed P-256 point (the HPKE
+// DHKEM(P-256) public key format used by the apps).
+func parseP256PublicKey(b64 string) ([]byte, error) {
+	raw, err := base64.StdEncoding.DecodeString(b64)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := ecdh.P256().NewPublicKey(raw); err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
+
+func keyID(raw []byte) string {
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:8])
+}
+
+func (a *API) PublishKey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req publishKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.Email) == "" || strings.TrimSpace(req.PublicKey) == "" {
+		writeError(w, http.StatusBadRequest, "email and public_key are required")
+		return
+	}
+	raw, err := parseP256PublicKey(req.PublicKey)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "public_key must be a base64 uncompressed P-256 point")
+		return
+	}
+	ctx := r.Context()
+	if ok, err := a.db.UserExists(ctx, req.Email); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	} else if !ok {
+		writeError(w, http.StatusNotFound, "user not found")
+		return
+	}
+	if existing, found, err := a.db.GetUserKey(ctx, req.Email); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	} else if found && existing.KeyID != keyID(raw) {
+		writeError(w, http.StatusConflict, "a different key is already published; use /rotate_keys")
+		return
+	}
+	k, err := a.db.PublishUserKey(ctx, req.Email, keyID(raw), req.PublicKey)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, k)
+}
+
+func (a *API) PublicKey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req publicKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.Email) == "" {
+		writeError(w, http.StatusBadRequest, "email is required")
+		return
+	}
+	ctx := r.Context()
+	k, found, err := a.db.GetUserKey(ctx, req.Email)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "no public key published")
+		return
+	}
+	if !req.IncludeRetired {
+		writeJSON(w, http.StatusOK, k)
+		return
+	}
+	retired, err := a.db.GetRetiredKeys(ctx, req.Email)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"email":      k.Email,
+		"key_id":     k.KeyID,
+		"public_key": k.PublicKey,
+		"created_at": k.CreatedAt,
+		"retired":    retired,
+	})
+}
+
+func (a *API) RotateKeys(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req rotateKeysRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.Email) == "" || strings.TrimSpace(req.NewPublicKey) == "" {
+		writeError(w, http.StatusBadRequest, "email and new_public_key are required")
+		return
+	}
+	raw, err := parseP256PublicKey(req.NewPublicKey)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "new_public_key must be a base64 uncompressed P-256 point")
+		return
+	}
+	active, retired, err := a.db.RotateUserKey(r.Context(), req.Email, keyID(raw), req.NewPublicKey)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"active":  active,
+		"retired": retired,
+	})
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"backend_mini/internal/db"
+)
+
+type listKidsRequest struct {
+	ParentID    string   `json:"parent_id"`
+	ParentEmail string   `json:"parent_email"`
+	Fields      []string `json:"fields,omitempty"`
+}
+
+var kidFields = map[string]func(k db.KidSummary) any{
+	"email":             func(k db.KidSummary) any { return k.Email },
+	"parent_id":         func(k db.KidSummary) any { return k.ParentID },
+	"wallet":            func(k db.KidSummary) any { return k.Wallet },
+	"contact_email":     func(k db.KidSummary) any { return k.ContactEmail },
+	"login_code":        func(k db.KidSummary) any { return k.LoginCode },
+	"pending_chores":    func(k db.KidSummary) any { return k.PendingChores },
+	"pending_penalties": func(k db.KidSummary) any { return k.PendingPenalties },
+}
+
+func (a *API) ListKids(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req listKidsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentID) == "" && strings.TrimSpace(req.ParentEmail) == "" {
+		writeError(w, http.StatusBadRequest, "parent_id or parent_email is required")
+		return
+	}
+	for _, f := range req.Fields {
+		if _, ok := kidFields[f]; !ok && f != "id" && f != "name" {
+			writeError(w, http.StatusBadRequest, "unknown field: "+f)
+			return
+		}
+	}
+	ctx := r.Context()
+	parentID := req.ParentID
+	if parentID == "" {
+		p, found, err := a.db.GetParentByEmail(ctx, req.ParentEmail)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if !found {
+			writeError(w, http.StatusNotFound, "parent not found")
+			return
+		}
+		parentID = p.ID
+	}
+	kids, err := a.db.ListKids(ctx, parentID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if len(req.Fields) == 0 {
+		writeJSON(w, http.StatusOK, kids)
+		return
+	}
+
+	// id and name are always included so the client can key the rows
+	out := make([]map[string]any, 0, len(kids))
+	for _, k := range kids {
+		m := map[string]any{"id": k.ID, "name": k.Name}
+		for _, f := range req.Fields {
+			if get, ok := kidFields[f]; ok {
+				m[f] = get(k)
+			}
+		}
+		out = append(out, m)
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+type kidLoginRequest struct {
+	LoginCode string `json:"login_code"`
+	Email     string `json:"email"`
+}
+
+// KidLogin resolves who is signing in on a kid's device: a login code names
+// one kid, while an email lists every kid using it, so a shared device can
+// offer a picker.
+func (a *API) KidLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req kidLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	ctx := r.Context()
+	switch {
+	case strings.TrimSpace(req.LoginCode) != "":
+		c, found, err := a.db.GetChildByLoginCode(ctx, req.LoginCode)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if !found {
+			writeError(w, http.StatusNotFound, "unknown login code")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"kids": []db.Child{*c}})
+	case strings.TrimSpace(req.Email) != "":
+		kids, err := a.db.ChildrenByEmail(ctx, req.Email)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if len(kids) == 0 {
+			writeError(w, http.StatusNotFound, "no kid uses this email")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"kids": kids})
+	default:
+		writeError(w, http.StatusBadRequest, "login_code or email is required")
+	}
+}
+
+type resetLoginCodeRequest struct {
+	ParentEmail string `json:"parent_email"`
+	KidEmail    string `json:"kid_email"`
+}
+
+// ResetLoginCode gives a kid a new login code, e.g. after it leaked.
+func (a *API) ResetLoginCode(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req resetLoginCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" || strings.TrimSpace(req.KidEmail) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email and kid_email are required")
+		return
+	}
+	kid, ok := a.kidOfParent(w, r, req.ParentEmail, req.KidEmail)
+	if !ok {
+		return
+	}
+	code, err := a.db.ResetLoginCode(r.Context(), kid.Email)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"kid_email": kid.Email, "login_code": code})
+}
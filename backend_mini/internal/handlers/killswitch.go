@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"backend_mini/internal/db"
+	"backend_mini/internal/middleware"
+)
+
+type setKillSwitchRequest struct {
+	// Switch is "maintenance", "money" or a route such as "/eurc_tx"; a
+	// route ending in "/" covers everything below it.
+	Switch  string `json:"switch"`
+	On      bool   `json:"on"`
+	Message string `json:"message,omitempty"`
+	SetBy   string `json:"set_by"`
+}
+
+// SetKillSwitch turns a kill switch on or off for every server.
+func (a *API) SetKillSwitch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req setKillSwitchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	name := strings.TrimSpace(req.Switch)
+	if name == "" || strings.TrimSpace(req.SetBy) == "" {
+		writeError(w, http.StatusBadRequest, "switch and set_by are required")
+		return
+	}
+	if name != middleware.KillMaintenance && name != middleware.KillMoney && !strings.HasPrefix(name, "/") {
+		writeError(w, http.StatusBadRequest, "switch must be maintenance, money or a route starting with /")
+		return
+	}
+	if strings.HasPrefix(name, "/admin/") {
+		writeError(w, http.StatusBadRequest, "admin routes cannot be switched off")
+		return
+	}
+	f, err := a.db.SetFeatureFlag(r.Context(), db.FeatureFlag{Name: db.KillSwitchPrefix + name, Enabled: req.On, Message: strings.TrimSpace(req.Message), UpdatedBy: req.SetBy})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, f)
+}
+
+// FeatureFlags lists every server-wide flag with who set it last.
+func (a *API) FeatureFlags(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	flags, err := a.db.ListFeatureFlags(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, flags)
+}
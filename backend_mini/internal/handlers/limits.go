@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend_mini/internal/db"
+	"backend_mini/internal/policy"
+)
+
+type setLimitsBulkRequest struct {
+	ParentEmail  string   `json:"parent_email"`
+	KidEmails    []string `json:"kid_emails,omitempty"`
+	AllKids      bool     `json:"all_kids,omitempty"`
+	App          string   `json:"app"`
+	TimePerDay   int      `json:"time_per_day"`
+	FeeExtraHour string   `json:"fee_extra_hour"`
+	Override     bool     `json:"override"`
+}
+
+// SetLimitsBulk applies one app limit to several kids of a family, or all of
+// them, atomically. Kids that already limit the app keep their own limit
+// unless override is set; the response tells created, updated and skipped
+// rows apart.
+func (a *API) SetLimitsBulk(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req setLimitsBulkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" || strings.TrimSpace(req.App) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email and app are required")
+		return
+	}
+	if req.AllKids == (len(req.KidEmails) > 0) {
+		writeError(w, http.StatusBadRequest, "give either kid_emails or all_kids")
+		return
+	}
+	if req.TimePerDay < 0 {
+		writeError(w, http.StatusBadRequest, "time_per_day cannot be negative")
+		return
+	}
+	feeExtraHour, err := strconv.ParseUint(req.FeeExtraHour, 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid fee_extra_hour")
+		return
+	}
+	ctx := r.Context()
+	p, found, err := a.db.GetParentByEmail(ctx, req.ParentEmail)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "parent not found")
+		return
+	}
+	kids, err := a.db.ListKids(ctx, p.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	family := make(map[string]bool, len(kids))
+	for _, k := range kids {
+		family[strings.ToLower(k.Email)] = true
+	}
+	var targets []string
+	if req.AllKids {
+		for _, k := range kids {
+			targets = append(targets, k.Email)
+		}
+	} else {
+		seen := map[string]bool{}
+		for _, e := range req.KidEmails {
+			e = strings.ToLower(strings.TrimSpace(e))
+			if !family[e] {
+				writeError(w, http.StatusNotFound, "kid not found for this parent: "+e)
+				return
+			}
+			if !seen[e] {
+				seen[e] = true
+				targets = append(targets, e)
+			}
+		}
+	}
+	if len(targets) == 0 {
+		writeError(w, http.StatusConflict, "family has no kids")
+		return
+	}
+	// every kid's fee must clear the policy before anything is written
+	for _, kidEmail := range targets {
+		decision, err := a.checkPolicy(ctx, req.ParentEmail, policy.Input{
+			Action:    policy.ActionScreenTimeFee,
+			Actor:     requestActor(r, policy.ActorParent),
+			Amount:    feeExtraHour,
+			Recipient: strings.ToLower(kidEmail),
+			At:        time.Now(),
+		})
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if !decision.Allowed() {
+			writePolicyDenial(w, decision)
+			return
+		}
+	}
+	res, err := a.db.SetAppLimitsBulk(ctx, req.ParentEmail, targets, req.App, req.TimePerDay, feeExtraHour, req.Override)
+	if quotaExceeded(w, err) {
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+type limitHistoryRequest struct {
+	ParentEmail string `json:"parent_email"`
+	KidEmail    string `json:"kid_email"`
+	App         string `json:"app,omitempty"`
+	Limit       int    `json:"limit,omitempty"`
+}
+
+type cancelScheduledLimitRequest struct {
+	ParentEmail string `json:"parent_email"`
+	ChangeID    string `json:"change_id"`
+}
+
+var weekdayNames = map[string]time.Weekday{
+	"sunday": time.Sunday, "monday": time.Monday, "tuesday": time.Tuesday, "wednesday": time.Wednesday,
+	"thursday": time.Thursday, "friday": time.Friday, "saturday": time.Saturday,
+}
+
+// parseEffectiveAt reads when a limit change should start: RFC3339, a
+// YYYY-MM-DD day, or "next_<weekday>" for the next such day after today.
+// Days start at midnight in now's location, the family's time zone. Empty
+// means now.
+func parseEffectiveAt(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return now, nil
+	}
+	if day, ok := strings.CutPrefix(s, "next_"); ok {
+		wd, ok := weekdayNames[day]
+		if !ok {
+			return time.Time{}, errors.New("effective_at weekday must be e.g. next_monday")
+		}
+		y, m, d := now.Date()
+		today := time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+		ahead := (int(wd)-int(today.Weekday())+6)%7 + 1
+		return today.AddDate(0, 0, ahead), nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, now.Location()); err == nil {
+		return t, nil
+	}
+	return time.Time{}, errors.New("effective_at must be RFC3339, YYYY-MM-DD or next_<weekday>")
+}
+
+// LimitHistory lists who changed a kid's limits and how, newest first.
+func (a *API) LimitHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req limitHistoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" || strings.TrimSpace(req.KidEmail) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email and kid_email are required")
+		return
+	}
+	if req.Limit <= 0 || req.Limit > 500 {
+		req.Limit = 100
+	}
+	kid, ok := a.kidOfParent(w, r, req.ParentEmail, req.KidEmail)
+	if !ok {
+		return
+	}
+	history, err := a.db.GetLimitHistory(r.Context(), kid.Email, req.App, req.Limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, history)
+}
+
+// ListScheduledLimits returns the kid's limit changes that have not taken
+// effect yet.
+func (a *API) ListScheduledLimits(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req limitHistoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" || strings.TrimSpace(req.KidEmail) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email and kid_email are required")
+		return
+	}
+	kid, ok := a.kidOfParent(w, r, req.ParentEmail, req.KidEmail)
+	if !ok {
+		return
+	}
+	changes, err := a.db.ListScheduledLimits(r.Context(), kid.Email)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, changes)
+}
+
+// CancelScheduledLimit drops a pending limit change.
+func (a *API) CancelScheduledLimit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req cancelScheduledLimitRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" || strings.TrimSpace(req.ChangeID) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email and change_id are required")
+		return
+	}
+	err := a.db.CancelScheduledLimit(r.Context(), req.ChangeID, req.ParentEmail)
+	if errors.Is(err, db.ErrLimitChangeNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"change_id": req.ChangeID, "status": db.LimitChangeCancelled})
+}
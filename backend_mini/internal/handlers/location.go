@@ -0,0 +1,288 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"backend_mini/internal/db"
+)
+
+const maxGeofenceRadiusM = 5000
+
+type locationSettingsRequest struct {
+	ParentEmail    string `json:"parent_email"`
+	Enabled        *bool  `json:"enabled,omitempty"`
+	RetentionHours int    `json:"retention_hours,omitempty"`
+}
+
+type setGeofenceRequest struct {
+	ParentEmail string        `json:"parent_email"`
+	GeofenceID  string        `json:"geofence_id,omitempty"`
+	Name        string        `json:"name"`
+	Lat         *float64      `json:"lat"`
+	Lng         *float64      `json:"lng"`
+	RadiusM     int           `json:"radius_m"`
+	Rules       []db.ZoneRule `json:"rules"`
+}
+
+type geofenceRequest struct {
+	ParentEmail string `json:"parent_email"`
+	GeofenceID  string `json:"geofence_id,omitempty"`
+}
+
+type reportLocationRequest struct {
+	DeviceID string   `json:"device_id"`
+	Lat      *float64 `json:"lat"`
+	Lng      *float64 `json:"lng"`
+	// Seq numbers the device's reports; when sent it must increase.
+	Seq uint64 `json:"seq,omitempty"`
+}
+
+func validLatLng(lat, lng *float64) bool {
+	return lat != nil && lng != nil && *lat >= -90 && *lat <= 90 && *lng >= -180 && *lng <= 180
+}
+
+// LocationSettings reads the family's location toggle, or updates it when
+// enabled is present in the body.
+func (a *API) LocationSettings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req locationSettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email is required")
+		return
+	}
+	ctx := r.Context()
+	_, found, err := a.db.GetParentByEmail(ctx, req.ParentEmail)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "parent not found")
+		return
+	}
+	settings, err := a.db.GetLocationSettings(ctx, req.ParentEmail)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if req.Enabled == nil {
+		writeJSON(w, http.StatusOK, settings)
+		return
+	}
+	settings.Enabled = *req.Enabled
+	if req.RetentionHours != 0 {
+		if req.RetentionHours < 1 || req.RetentionHours > db.MaxLocationRetentionHours {
+			writeError(w, http.StatusBadRequest, "retention_hours must be between 1 and 72")
+			return
+		}
+		settings.RetentionHours = req.RetentionHours
+	}
+	settings, err = a.db.SetLocationSettings(ctx, *settings)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, settings)
+}
+
+func (a *API) SetGeofence(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req setGeofenceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" || strings.TrimSpace(req.Name) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email and name are required")
+		return
+	}
+	if !validLatLng(req.Lat, req.Lng) {
+		writeError(w, http.StatusBadRequest, "lat and lng are required and must be valid coordinates")
+		return
+	}
+	if req.RadiusM <= 0 || req.RadiusM > maxGeofenceRadiusM {
+		writeError(w, http.StatusBadRequest, "radius_m must be between 1 and 5000")
+		return
+	}
+	seen := map[string]bool{}
+	for i := range req.Rules {
+		req.Rules[i].App = strings.TrimSpace(req.Rules[i].App)
+		if req.Rules[i].TimePerDay < 0 || req.Rules[i].TimePerDay > 24*60 {
+			writeError(w, http.StatusBadRequest, "rules time_per_day must be between 0 and 1440")
+			return
+		}
+		if seen[req.Rules[i].App] {
+			writeError(w, http.StatusBadRequest, "duplicate rule for app "+req.Rules[i].App)
+			return
+		}
+		seen[req.Rules[i].App] = true
+	}
+	ctx := r.Context()
+	_, found, err := a.db.GetParentByEmail(ctx, req.ParentEmail)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "parent not found")
+		return
+	}
+	g, err := a.db.SaveGeofence(ctx, db.Geofence{
+		GeofenceID:  strings.TrimSpace(req.GeofenceID),
+		ParentEmail: req.ParentEmail,
+		Name:        strings.TrimSpace(req.Name),
+		Lat:         *req.Lat,
+		Lng:         *req.Lng,
+		RadiusM:     req.RadiusM,
+		Rules:       req.Rules,
+	})
+	if errors.Is(err, db.ErrGeofenceNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, g)
+}
+
+func (a *API) DeleteGeofence(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req geofenceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" || strings.TrimSpace(req.GeofenceID) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email and geofence_id are required")
+		return
+	}
+	if err := a.db.DeleteGeofence(r.Context(), req.ParentEmail, req.GeofenceID); err != nil {
+		if errors.Is(err, db.ErrGeofenceNotFound) {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+func (a *API) ListGeofences(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req geofenceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email is required")
+		return
+	}
+	fences, err := a.db.ListGeofences(r.Context(), req.ParentEmail)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, fences)
+}
+
+// ReportLocation is called by a paired kid device. Reports are refused unless
+// the family opted in, and are stored rounded to ~110m.
+func (a *API) ReportLocation(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req reportLocationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.DeviceID) == "" {
+		writeError(w, http.StatusBadRequest, "device_id is required")
+		return
+	}
+	if !validLatLng(req.Lat, req.Lng) {
+		writeError(w, http.StatusBadRequest, "lat and lng are required and must be valid coordinates")
+		return
+	}
+	ctx := r.Context()
+	dev, found, err := a.db.GetDevice(ctx, req.DeviceID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found || dev.UnpairedAt != "" {
+		writeError(w, http.StatusNotFound, db.ErrDeviceNotFound.Error())
+		return
+	}
+	settings, err := a.db.GetLocationSettings(ctx, dev.ParentEmail)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !settings.Enabled {
+		writeError(w, http.StatusForbidden, "location module is disabled for this family")
+		return
+	}
+	rep, err := a.db.AddLocationReport(ctx, dev, *req.Lat, *req.Lng, req.Seq, settings.RetentionHours)
+	if errors.Is(err, db.ErrSeqDuplicate) || errors.Is(err, db.ErrSeqStale) {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	fences, err := a.db.ListGeofences(ctx, dev.ParentEmail)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	zone := ""
+	if g := db.ZoneAt(fences, rep.Lat, rep.Lng); g != nil {
+		zone = g.Name
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"report": rep, "zone": zone})
+}
+
+// currentZone returns the geofence the kid is in according to their latest
+// fresh report, or nil when the family has the module off.
+func (a *API) currentZone(r *http.Request, parentEmail, kidEmail string) (*db.Geofence, error) {
+	ctx := r.Context()
+	settings, err := a.db.GetLocationSettings(ctx, parentEmail)
+	if err != nil || !settings.Enabled {
+		return nil, err
+	}
+	rep, found, err := a.db.LatestLocation(ctx, kidEmail, time.Now())
+	if err != nil || !found {
+		return nil, err
+	}
+	fences, err := a.db.ListGeofences(ctx, parentEmail)
+	if err != nil {
+		return nil, err
+	}
+	return db.ZoneAt(fences, rep.Lat, rep.Lng), nil
+}
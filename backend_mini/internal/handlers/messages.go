@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+const (
+	maxCiphertextBytes = 64 * 1024
+	defaultMessagePage = 50
+	maxMessagePage     = 200
+)
+
+type createThreadRequest struct {
+	ParentEmail string `json:"parent_email"`
+	KidEmail    string `json:"kid_email"`
+	ChoreID     string `json:"chore_id,omitempty"`
+	Title       string `json:"title,omitempty"`
+}
+
+type sendMessageRequest struct {
+	ThreadID        string `json:"thread_id"`
+	SenderEmail     string `json:"sender_email"`
+	Ciphertext      string `json:"ciphertext"`
+	EncapsulatedKey string `json:"encapsulated_key"`
+}
+
+type listMessagesRequest struct {
+	ThreadID    string `json:"thread_id"`
+	ReaderEmail string `json:"reader_email"`
+	After       int64  `json:"after,omitempty"`
+	Limit       int    `json:"limit,omitempty"`
+}
+
+type markReadRequest struct {
+	ThreadID    string `json:"thread_id"`
+	ReaderEmail string `json:"reader_email"`
+	UpToSeq     int64  `json:"up_to_seq"`
+}
+
+func (a *API) CreateThread(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req createThreadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" || strings.TrimSpace(req.KidEmail) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email and kid_email are required")
+		return
+	}
+	ctx := r.Context()
+	p, found, err := a.db.GetParentByEmail(ctx, req.ParentEmail)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "parent not found")
+		return
+	}
+	c, found, err := a.db.GetChildByEmail(ctx, req.KidEmail)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found || c.ParentID != p.ID {
+		writeError(w, http.StatusNotFound, "kid not found for this parent")
+		return
+	}
+	thread, err := a.db.CreateThread(ctx, p.Email, c.Email, strings.TrimSpace(req.ChoreID), strings.TrimSpace(req.Title))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !strings.EqualFold(thread.ParentEmail, p.Email) || !strings.EqualFold(thread.KidEmail, c.Email) {
+		writeError(w, http.StatusConflict, "chore already has a thread with other members")
+		return
+	}
+	writeJSON(w, http.StatusOK, thread)
+}
+
+func (a *API) SendMessage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req sendMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ThreadID) == "" || strings.TrimSpace(req.SenderEmail) == "" || req.Ciphertext == "" || req.EncapsulatedKey == "" {
+		writeError(w, http.StatusBadRequest, "thread_id, sender_email, ciphertext, and encapsulated_key are required")
+		return
+	}
+	ct, err := base64.StdEncoding.DecodeString(req.Ciphertext)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "ciphertext must be base64")
+		return
+	}
+	if len(ct) > maxCiphertextBytes {
+		writeError(w, http.StatusBadRequest, "ciphertext too large")
+		return
+	}
+	if _, err := base64.StdEncoding.DecodeString(req.EncapsulatedKey); err != nil {
+		writeError(w, http.StatusBadRequest, "encapsulated_key must be base64")
+		return
+	}
+	ctx := r.Context()
+	thread, found, err := a.db.GetThread(ctx, req.ThreadID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "thread not found")
+		return
+	}
+	if !thread.HasMember(req.SenderEmail) {
+		writeError(w, http.StatusForbidden, "sender is not part of this thread")
+		return
+	}
+	msg, err := a.db.AddMessage(ctx, thread.ThreadID, req.SenderEmail, req.Ciphertext, req.EncapsulatedKey)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, msg)
+}
+
+func (a *API) ListMessages(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req listMessagesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ThreadID) == "" || strings.TrimSpace(req.ReaderEmail) == "" {
+		writeError(w, http.StatusBadRequest, "thread_id and reader_email are required")
+		return
+	}
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultMessagePage
+	}
+	if limit > maxMessagePage {
+		limit = maxMessagePage
+	}
+	ctx := r.Context()
+	thread, found, err := a.db.GetThread(ctx, req.ThreadID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "thread not found")
+		return
+	}
+	if !thread.HasMember(req.ReaderEmail) {
+		writeError(w, http.StatusForbidden, "reader is not part of this thread")
+		return
+	}
+	msgs, hasMore, err := a.db.ListMessages(ctx, thread.ThreadID, req.ReaderEmail, req.After, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	next := req.After
+	if len(msgs) > 0 {
+		next = msgs[len(msgs)-1].Seq
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"thread":   thread,
+		"messages": msgs,
+		"next":     next,
+		"has_more": hasMore,
+	})
+}
+
+func (a *API) MarkRead(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req markReadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ThreadID) == "" || strings.TrimSpace(req.ReaderEmail) == "" || req.UpToSeq <= 0 {
+		writeError(w, http.StatusBadRequest, "thread_id, reader_email, and up_to_seq are required")
+		return
+	}
+	ctx := r.Context()
+	thread, found, err := a.db.GetThread(ctx, req.ThreadID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "thread not found")
+		return
+	}
+	if !thread.HasMember(req.ReaderEmail) {
+		writeError(w, http.StatusForbidden, "reader is not part of this thread")
+		return
+	}
+	n, err := a.db.MarkRead(ctx, thread.ThreadID, req.ReaderEmail, req.UpToSeq)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int64{"marked": n})
+}
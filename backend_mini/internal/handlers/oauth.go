@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"backend_mini/internal/auth"
+	"backend_mini/internal/config"
+	"backend_mini/internal/db"
+)
+
+type oauthExchangeRequest struct {
+	Provider string  `json:"provider"`
+	IDToken  string  `json:"id_token"`
+	Name     *string `json:"name,omitempty"`
+}
+
+func (a *API) OAuthExchange(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req oauthExchangeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.Provider) == "" || strings.TrimSpace(req.IDToken) == "" {
+		writeError(w, http.StatusBadRequest, "provider and id_token are required")
+		return
+	}
+	ctx := r.Context()
+	claims, ok := verifiedEmailClaims(w, r, req.Provider, req.IDToken)
+	if !ok {
+		return
+	}
+
+	p, found, err := a.db.GetParentByEmail(ctx, claims.Email)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found {
+		// apple only sends the name to the app on first sign-in, so prefer the client-provided one
+		name := claims.Name
+		if req.Name != nil && strings.TrimSpace(*req.Name) != "" {
+			name = strings.TrimSpace(*req.Name)
+		}
+		if name == "" {
+			name = strings.SplitN(claims.Email, "@", 2)[0]
+		}
+		p, err = a.db.CreateParent(ctx, name, claims.Email)
+		if errors.Is(err, db.ErrEmailTaken) {
+			writeError(w, http.StatusConflict, err.Error())
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	token, exp, err := auth.IssueSession(config.SessionSecret(), p.ID, p.Email, "parent")
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"token":      token,
+		"expires_at": exp.Format(time.RFC3339),
+		"created":    !found,
+		"parent":     p,
+	})
+}
+
+// verifiedEmailClaims checks an Apple or Google ID token and that it carries
+// a verified email, writing 400 or 401 when it does not.
+func verifiedEmailClaims(w http.ResponseWriter, r *http.Request, providerName, idToken string) (*auth.IDClaims, bool) {
+	provider, ok := auth.ProviderByName(providerName)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "provider must be apple or google")
+		return nil, false
+	}
+	audiences := config.GoogleClientIDs()
+	if provider.Name == auth.Apple.Name {
+		audiences = config.AppleClientIDs()
+	}
+	claims, err := auth.VerifyIDToken(r.Context(), provider, idToken, audiences)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return nil, false
+	}
+	if claims.Email == "" || !claims.IsEmailVerified() {
+		writeError(w, http.StatusUnauthorized, "id token has no verified email")
+		return nil, false
+	}
+	return claims, true
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"backend_mini/internal/db"
+)
+
+const maxOverrideMinutes = 24 * 60
+
+type setOverrideRequest struct {
+	ParentEmail     string `json:"parent_email"`
+	KidEmail        string `json:"kid_email"`
+	Kind            string `json:"kind"`
+	App             string `json:"app,omitempty"`
+	Minutes         int    `json:"minutes,omitempty"`
+	DurationMinutes int    `json:"duration_minutes,omitempty"`
+}
+
+type clearOverrideRequest struct {
+	OverrideID string `json:"override_id"`
+}
+
+// SetOverride pushes a temporary lock ("lock" for duration_minutes) or a
+// grant ("extra_time" of minutes, valid until the end of the UTC day).
+func (a *API) SetOverride(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req setOverrideRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" || strings.TrimSpace(req.KidEmail) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email and kid_email are required")
+		return
+	}
+	now := time.Now().UTC()
+	o := db.LimitOverride{
+		ParentEmail: req.ParentEmail,
+		KidEmail:    req.KidEmail,
+		Kind:        req.Kind,
+		App:         strings.TrimSpace(req.App),
+		IssuedBy:    req.ParentEmail,
+		StartsAt:    now.Format(time.RFC3339),
+	}
+	switch req.Kind {
+	case db.OverrideLock:
+		if req.DurationMinutes <= 0 || req.DurationMinutes > maxOverrideMinutes {
+			writeError(w, http.StatusBadRequest, "duration_minutes must be between 1 and 1440")
+			return
+		}
+		o.ExpiresAt = now.Add(time.Duration(req.DurationMinutes) * time.Minute).Format(time.RFC3339)
+	case db.OverrideExtraTime:
+		if req.Minutes <= 0 || req.Minutes > maxOverrideMinutes {
+			writeError(w, http.StatusBadRequest, "minutes must be between 1 and 1440")
+			return
+		}
+		o.Minutes = req.Minutes
+		o.ExpiresAt = time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC).Format(time.RFC3339)
+	default:
+		writeError(w, http.StatusBadRequest, "kind must be lock or extra_time")
+		return
+	}
+	ctx := r.Context()
+	p, found, err := a.db.GetParentByEmail(ctx, req.ParentEmail)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "parent not found")
+		return
+	}
+	c, found, err := a.db.GetChildByEmail(ctx, req.KidEmail)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found || c.ParentID != p.ID {
+		writeError(w, http.StatusNotFound, "kid not found for this parent")
+		return
+	}
+	created, err := a.db.CreateLimitOverride(ctx, o)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, created)
+}
+
+func (a *API) ClearOverride(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req clearOverrideRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.OverrideID) == "" {
+		writeError(w, http.StatusBadRequest, "override_id is required")
+		return
+	}
+	cleared, err := a.db.ClearLimitOverride(r.Context(), req.OverrideID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !cleared {
+		writeError(w, http.StatusNotFound, "no active override with that id")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "cleared"})
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend_mini/internal/choretext"
+	"backend_mini/internal/config"
+	"backend_mini/internal/util"
+)
+
+type parseChoreRequest struct {
+	ParentEmail string `json:"parent_email"`
+	Text        string `json:"text"`
+}
+
+// newChoreParser is the rules parser, behind the LLM one when an LLM is
+// configured.
+func newChoreParser() choretext.Parser {
+	base := config.ChoreParserLLMURL()
+	if base == "" {
+		return choretext.Rules{}
+	}
+	llm := choretext.LLM{Base: base, APIKey: config.ChoreParserLLMKey(), Model: config.ChoreParserLLMModel(), Timeout: config.ChoreParserLLMTimeout()}
+	return choretext.Fallback{Primary: llm, Secondary: choretext.Rules{}}
+}
+
+// ParseChore reads free text such as "Emma: clean room by Friday for 3
+// euros" into a chore draft. Nothing is created: the answer carries the
+// draft and, under create_chore, a /create_chore body the client can let
+// the parent complete and confirm.
+func (a *API) ParseChore(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req parseChoreRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" || strings.TrimSpace(req.Text) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email and text are required")
+		return
+	}
+	text, err := util.SanitizeText(req.Text, config.ChoreDescriptionMaxLen(), true)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "text "+err.Error())
+		return
+	}
+	ctx := r.Context()
+	p, found, err := a.db.GetParentByEmail(ctx, req.ParentEmail)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "parent not found")
+		return
+	}
+	kids, err := a.db.ListKids(ctx, p.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	names := make([]string, 0, len(kids))
+	for _, k := range kids {
+		names = append(names, k.Name)
+	}
+	draft, err := a.choreParser.Parse(ctx, text, choretext.Hints{Kids: names, Now: time.Now().In(a.familyLocation(ctx, p.Email))})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if draft.ChoreName, _, err = sanitizeChoreText(draft.ChoreName, ""); err != nil && !slices.Contains(draft.Missing, "chore_name") {
+		draft.ChoreName = ""
+		draft.Missing = append(draft.Missing, "chore_name")
+	}
+
+	create := createChoreRequest{ParentWallet: p.Wallet, ChoreName: draft.ChoreName, DueDate: draft.DueDate}
+	if draft.BountyAmount > 0 {
+		create.BountyAmount = strconv.FormatUint(draft.BountyAmount, 10)
+	}
+	for _, k := range kids {
+		if k.Name == draft.KidName {
+			create.ChildWallet = k.Wallet
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"draft": draft, "create_chore": create})
+}
@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend_mini/internal/config"
+	"backend_mini/internal/db"
+)
+
+// partnerAPIVersion is the version of the partner response shapes; it is
+// part of the route, so changing a shape means a new route.
+const partnerAPIVersion = "v1"
+
+// ageBands are the bands partner statistics are grouped into, by age this
+// year. Kids outside them, or without a birth year, fall into "other" and
+// "unknown".
+var ageBands = []struct {
+	name     string
+	min, max int
+}{
+	{"6-8", 6, 8},
+	{"9-11", 9, 11},
+	{"12-14", 12, 14},
+	{"15-17", 15, 17},
+}
+
+type createPartnerRequest struct {
+	Name      string `json:"name"`
+	CreatedBy string `json:"created_by"`
+}
+
+type revokePartnerRequest struct {
+	PartnerID string `json:"partner_id"`
+	RevokedBy string `json:"revoked_by"`
+}
+
+// bandStat is one age band in a partner response. Kids is rounded to the
+// nearest five so neighbouring responses cannot be diffed down to a family.
+type bandStat struct {
+	AgeBand string  `json:"age_band"`
+	Kids    int     `json:"kids"`
+	Value   float64 `json:"value"`
+}
+
+type partnerStats struct {
+	Version      string     `json:"version"`
+	Metric       string     `json:"metric"`
+	TermsVersion string     `json:"terms_version"`
+	MinFamilies  int        `json:"min_families"`
+	Bands        []bandStat `json:"bands"`
+	Suppressed   int        `json:"suppressed_bands"`
+}
+
+// RequirePartner admits requests bearing a live partner key, rate limited
+// per partner like personal access tokens.
+func (a *API) RequirePartner(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || !strings.HasPrefix(raw, db.PartnerKeyPrefix) {
+			writeError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		ctx := r.Context()
+		p, err := a.db.LookupPartner(ctx, raw)
+		if errors.Is(err, db.ErrPartnerNotFound) {
+			writeError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if ok, retry := a.tokenLimits.Allow("partner:"+p.PartnerID, config.TokenRatePerMinute(), time.Now()); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(retry))
+			writeError(w, http.StatusTooManyRequests, "rate limit exceeded for this key")
+			return
+		}
+		if err := a.db.TouchPartner(ctx, p.PartnerID); err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// PartnerChoreCompletion returns the share of assigned chores that were
+// approved, by age band, across families that consented to data sharing.
+func (a *API) PartnerChoreCompletion(w http.ResponseWriter, r *http.Request) {
+	a.partnerStats(w, r, "chore_completion_rate", func(s db.SharedKidStats) (float64, float64) {
+		return float64(s.Approved), float64(s.Chores)
+	})
+}
+
+// PartnerScreenTime returns the average reported screen time per day, in
+// minutes, by age band, across families that consented to data sharing.
+func (a *API) PartnerScreenTime(w http.ResponseWriter, r *http.Request) {
+	a.partnerStats(w, r, "screen_minutes_per_day", func(s db.SharedKidStats) (float64, float64) {
+		return float64(s.Minutes), float64(s.DaysReported)
+	})
+}
+
+// partnerStats groups consenting kids into age bands and reports
+// sum(num)/sum(den) for each band. Kids with nothing to count are left
+// out, and bands drawn from fewer than PartnerMinFamilies families are
+// suppressed rather than reported.
+func (a *API) partnerStats(w http.ResponseWriter, r *http.Request, metric string, ratio func(db.SharedKidStats) (num, den float64)) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	now := time.Now().UTC()
+	since := now.AddDate(0, 0, -config.PartnerScreenTimeDays()).Format("2006-01-02")
+	terms := config.DataSharingTermsVersion()
+	kids, err := a.db.SharedKidStatistics(r.Context(), terms, since)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	type acc struct {
+		num, den float64
+		kids     int
+		families map[string]bool
+	}
+	byBand := map[string]*acc{}
+	for _, k := range kids {
+		num, den := ratio(k)
+		if den == 0 {
+			continue
+		}
+		band := ageBand(k.BirthYear, now.Year())
+		b := byBand[band]
+		if b == nil {
+			b = &acc{families: map[string]bool{}}
+			byBand[band] = b
+		}
+		b.num += num
+		b.den += den
+		b.kids++
+		b.families[k.FamilyID] = true
+	}
+	out := partnerStats{Version: partnerAPIVersion, Metric: metric, TermsVersion: terms, MinFamilies: config.PartnerMinFamilies(), Bands: []bandStat{}}
+	names := []string{}
+	for _, b := range ageBands {
+		names = append(names, b.name)
+	}
+	for _, name := range append(names, "other", "unknown") {
+		b := byBand[name]
+		if b == nil {
+			continue
+		}
+		if len(b.families) < out.MinFamilies {
+			out.Suppressed++
+			continue
+		}
+		out.Bands = append(out.Bands, bandStat{
+			AgeBand: name,
+			Kids:    int(math.Round(float64(b.kids)/5) * 5),
+			Value:   math.Round(b.num/b.den*100) / 100,
+		})
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func ageBand(birthYear, thisYear int) string {
+	if birthYear == 0 {
+		return "unknown"
+	}
+	age := thisYear - birthYear
+	for _, b := range ageBands {
+		if age >= b.min && age <= b.max {
+			return b.name
+		}
+	}
+	return "other"
+}
+
+// ListPartners lists partner keys, revoked ones included.
+func (a *API) ListPartners(w http.ResponseWriter, r *http.Request) {
+	partners, err := a.db.ListPartners(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, partners)
+}
+
+// CreatePartner issues a partner key. The raw key is only shown here.
+func (a *API) CreatePartner(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req createPartnerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.Name) == "" || strings.TrimSpace(req.CreatedBy) == "" {
+		writeError(w, http.StatusBadRequest, "name and created_by are required")
+		return
+	}
+	p, raw, err := a.db.CreatePartner(r.Context(), strings.TrimSpace(req.Name), req.CreatedBy)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"key": raw, "details": p})
+}
+
+// RevokePartner stops a partner key working.
+func (a *API) RevokePartner(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req revokePartnerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.PartnerID) == "" || strings.TrimSpace(req.RevokedBy) == "" {
+		writeError(w, http.StatusBadRequest, "partner_id and revoked_by are required")
+		return
+	}
+	err := a.db.RevokePartner(r.Context(), req.PartnerID, req.RevokedBy)
+	if errors.Is(err, db.ErrPartnerNotFound) {
+		writeError(w, http.StatusNotFound, "partner not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"revoked": true})
+}
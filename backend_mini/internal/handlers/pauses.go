@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"backend_mini/internal/db"
+)
+
+const maxPauseDays = 365
+
+type pauseRequest struct {
+	ParentEmail string `json:"parent_email"`
+	// KidEmail pauses one kid; empty pauses the whole family.
+	KidEmail string `json:"kid_email,omitempty"`
+	// StartsAt defaults to now.
+	StartsAt string `json:"starts_at,omitempty"`
+	EndsAt   string `json:"ends_at"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+type listPausesRequest struct {
+	ParentEmail  string `json:"parent_email"`
+	IncludeEnded bool   `json:"include_ended,omitempty"`
+}
+
+type endPauseRequest struct {
+	ParentEmail string `json:"parent_email"`
+	PauseID     string `json:"pause_id"`
+}
+
+// Pause schedules vacation mode for a kid or the whole family between
+// starts_at and ends_at (RFC 3339). It resumes by itself at ends_at.
+func (a *API) Pause(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req pauseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" || strings.TrimSpace(req.EndsAt) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email and ends_at are required")
+		return
+	}
+	now := time.Now().UTC()
+	starts := now
+	if req.StartsAt != "" {
+		t, err := time.Parse(time.RFC3339, req.StartsAt)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "starts_at must be an RFC 3339 time")
+			return
+		}
+		starts = t.UTC()
+	}
+	ends, err := time.Parse(time.RFC3339, req.EndsAt)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "ends_at must be an RFC 3339 time")
+		return
+	}
+	ends = ends.UTC()
+	if !ends.After(starts) || !ends.After(now) {
+		writeError(w, http.StatusBadRequest, "ends_at must be after starts_at and in the future")
+		return
+	}
+	if ends.Sub(starts) > maxPauseDays*24*time.Hour {
+		writeError(w, http.StatusBadRequest, "a pause can last at most 365 days")
+		return
+	}
+	ctx := r.Context()
+	if req.KidEmail != "" {
+		if _, ok := a.kidOfParent(w, r, req.ParentEmail, req.KidEmail); !ok {
+			return
+		}
+	} else if _, found, err := a.db.GetParentByEmail(ctx, req.ParentEmail); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	} else if !found {
+		writeError(w, http.StatusNotFound, "parent not found")
+		return
+	}
+	p, err := a.db.CreatePause(ctx, db.Pause{
+		ParentEmail: req.ParentEmail,
+		KidEmail:    req.KidEmail,
+		StartsAt:    starts.Format(time.RFC3339),
+		EndsAt:      ends.Format(time.RFC3339),
+		Reason:      strings.TrimSpace(req.Reason),
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, p)
+}
+
+// ListPauses lists the family's current and upcoming pauses, or every
+// pause with include_ended.
+func (a *API) ListPauses(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req listPausesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email is required")
+		return
+	}
+	pauses, err := a.db.ListPauses(r.Context(), req.ParentEmail, req.IncludeEnded, time.Now())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, pauses)
+}
+
+// EndPause resumes a running pause now, or calls off one yet to start.
+func (a *API) EndPause(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req endPauseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" || strings.TrimSpace(req.PauseID) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email and pause_id are required")
+		return
+	}
+	p, err := a.db.EndPause(r.Context(), req.ParentEmail, req.PauseID, time.Now())
+	if errors.Is(err, db.ErrPauseNotFound) {
+		writeError(w, http.StatusNotFound, "no running or upcoming pause with that id")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, p)
+}
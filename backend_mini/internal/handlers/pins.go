@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"backend_mini/internal/config"
+)
+
+type kidPINRequest struct {
+	ParentEmail string `json:"parent_email"`
+	KidEmail    string `json:"kid_email"`
+	PIN         string `json:"pin"`
+}
+
+// SetKidPIN sets or resets a kid's spending PIN. Only the parent can, so a
+// kid who forgot it or locked it out asks the parent for a new one.
+func (a *API) SetKidPIN(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req kidPINRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" || strings.TrimSpace(req.KidEmail) == "" || req.PIN == "" {
+		writeError(w, http.StatusBadRequest, "parent_email, kid_email and pin are required")
+		return
+	}
+	if !validPIN(req.PIN) {
+		writeError(w, http.StatusBadRequest, "pin must be 4 to 8 digits")
+		return
+	}
+	kid, ok := a.kidOfParent(w, r, req.ParentEmail, req.KidEmail)
+	if !ok {
+		return
+	}
+	if err := a.db.SetKidPIN(r.Context(), kid.Email, req.PIN, req.ParentEmail); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"kid_email": kid.Email, "pin_set": true})
+}
+
+// ClearKidPIN removes a kid's spending PIN.
+func (a *API) ClearKidPIN(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req kidPINRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" || strings.TrimSpace(req.KidEmail) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email and kid_email are required")
+		return
+	}
+	kid, ok := a.kidOfParent(w, r, req.ParentEmail, req.KidEmail)
+	if !ok {
+		return
+	}
+	if err := a.db.ClearKidPIN(r.Context(), kid.Email, req.ParentEmail); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"kid_email": kid.Email, "pin_set": false})
+}
+
+func validPIN(pin string) bool {
+	if len(pin) < 4 || len(pin) > 8 {
+		return false
+	}
+	for _, c := range pin {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// checkKidPIN requires the PIN of the kid owning wallet before money leaves
+// it. Wallets that are not a kid's, and kids without a PIN, pass. It writes
+// 403 for a missing or wrong PIN and 423 while the PIN is locked out, and
+// returns false in those cases.
+func (a *API) checkKidPIN(w http.ResponseWriter, r *http.Request, wallet, pin string) bool {
+	ctx := r.Context()
+	kid, found, err := a.db.GetChildByWallet(ctx, wallet)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return false
+	}
+	if !found {
+		return true
+	}
+	check, err := a.db.CheckKidPIN(ctx, kid.Email, pin, config.KidPINMaxAttempts(), config.KidPINLockout())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return false
+	}
+	switch {
+	case !check.Required || check.OK:
+		return true
+	case check.LockedUntil != "":
+		writeJSON(w, http.StatusLocked, map[string]interface{}{
+			"error":        "kid pin is locked; ask a parent to reset it",
+			"locked_until": check.LockedUntil,
+		})
+	case pin == "":
+		writeError(w, http.StatusForbidden, "kid pin required")
+	default:
+		writeJSON(w, http.StatusForbidden, map[string]interface{}{
+			"error":              "invalid kid pin",
+			"attempts_remaining": check.AttemptsRemaining,
+		})
+	}
+	return false
+}
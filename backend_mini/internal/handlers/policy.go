@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend_mini/internal/balance"
+	"backend_mini/internal/db"
+	"backend_mini/internal/policy"
+)
+
+type setPolicyRequest struct {
+	ParentEmail string          `json:"parent_email"`
+	Policy      policy.Document `json:"policy"`
+}
+
+type getPolicyRequest struct {
+	ParentEmail string `json:"parent_email"`
+	Version     int    `json:"version,omitempty"`
+}
+
+type evaluatePolicyRequest struct {
+	ParentEmail string `json:"parent_email"`
+	Action      string `json:"action"`
+	Actor       string `json:"actor"`
+	Amount      string `json:"amount"`
+	Recipient   string `json:"recipient"`
+	At          string `json:"at,omitempty"`
+}
+
+func (a *API) SetPolicy(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req setPolicyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email is required")
+		return
+	}
+	if req.Policy.Rules == nil {
+		req.Policy.Rules = []policy.Rule{}
+	}
+	if err := req.Policy.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	ctx := r.Context()
+	if _, found, err := a.db.GetParentByEmail(ctx, req.ParentEmail); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	} else if !found {
+		writeError(w, http.StatusNotFound, "parent not found")
+		return
+	}
+	pv, err := a.db.SavePolicy(ctx, req.ParentEmail, req.ParentEmail, req.Policy)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, pv)
+}
+
+func (a *API) GetPolicy(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req getPolicyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email is required")
+		return
+	}
+	pv, found, err := a.db.GetPolicy(r.Context(), req.ParentEmail, req.Version)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found {
+		if req.Version > 0 {
+			writeError(w, http.StatusNotFound, "policy version not found")
+			return
+		}
+		// no policy yet: everything is allowed
+		pv = &db.PolicyVersion{ParentEmail: strings.ToLower(req.ParentEmail), Document: policy.Document{Rules: []policy.Rule{}}}
+	}
+	writeJSON(w, http.StatusOK, pv)
+}
+
+func (a *API) PolicyHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req getPolicyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email is required")
+		return
+	}
+	versions, err := a.db.ListPolicyVersions(r.Context(), req.ParentEmail)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, versions)
+}
+
+// EvaluatePolicy lets clients ask what the current policy says about an
+// action before attempting it.
+func (a *API) EvaluatePolicy(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req evaluatePolicyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" || strings.TrimSpace(req.Action) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email and action are required")
+		return
+	}
+	in := policy.Input{Action: req.Action, Actor: req.Actor, Recipient: req.Recipient, At: time.Now()}
+	if req.Amount != "" {
+		amount, err := strconv.ParseUint(req.Amount, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid amount")
+			return
+		}
+		in.Amount = amount
+	}
+	if req.At != "" {
+		at, err := time.Parse(time.RFC3339, req.At)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "at must be RFC3339")
+			return
+		}
+		in.At = at
+	}
+	decision, err := a.checkPolicy(r.Context(), req.ParentEmail, in)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, decision)
+}
+
+// checkPolicy evaluates in against the family's latest policy.
+func (a *API) checkPolicy(ctx context.Context, parentEmail string, in policy.Input) (policy.Decision, error) {
+	pv, found, err := a.db.GetPolicy(ctx, parentEmail, 0)
+	if err != nil || !found {
+		return policy.Decision{Effect: policy.EffectAllow}, err
+	}
+	return pv.Document.Evaluate(in), nil
+}
+
+// transferPolicy evaluates a transfer against the policy of the family the
+// sending wallet belongs to. Wallets outside any family are not governed.
+func (a *API) transferPolicy(r *http.Request, from, to string, amount uint64) (policy.Decision, error) {
+	ctx := r.Context()
+	in := policy.Input{Action: policy.ActionTransfer, Actor: policy.ActorParent, Amount: amount, Recipient: to, At: time.Now()}
+	parentEmail, isKid, found, err := a.db.FamilyOfWallet(ctx, from)
+	if err != nil {
+		return policy.Decision{}, err
+	}
+	if !found {
+		return policy.Decision{Effect: policy.EffectAllow}, nil
+	}
+	if isKid {
+		in.Actor = policy.ActorKid
+	}
+	in.Actor = requestActor(r, in.Actor)
+	d, err := a.checkPolicy(ctx, parentEmail, in)
+	if err != nil || !d.Allowed() || !isKid {
+		return d, err
+	}
+	return a.savingsLockPolicy(ctx, from, amount)
+}
+
+// savingsLockPolicy denies a transfer from a kid's wallet that would spend
+// funds held by a savings lock. The balance is only read when the wallet
+// has something locked.
+func (a *API) savingsLockPolicy(ctx context.Context, wallet string, amount uint64) (policy.Decision, error) {
+	locked, err := a.db.LockedSavings(ctx, wallet, time.Now())
+	if err != nil || locked == 0 {
+		return policy.Decision{Effect: policy.EffectAllow}, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	b, err := balance.Get(ctx, a.db, wallet)
+	if err != nil {
+		return policy.Decision{}, err
+	}
+	if amount > b.Spendable {
+		return policy.Decision{Effect: policy.EffectDeny, RuleID: savingsLockRuleID,
+			Note: fmt.Sprintf("%d of %d is locked savings; %d is spendable", b.Locked, b.Available, b.Spendable)}, nil
+	}
+	return policy.Decision{Effect: policy.EffectAllow}, nil
+}
+
+// requestActor reports token callers as such; otherwise the actor is the
+// one the wallet or body implies.
+func requestActor(r *http.Request, actor string) string {
+	if strings.HasPrefix(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), db.TokenPrefix) {
+		return policy.ActorToken
+	}
+	return actor
+}
+
+// writePolicyDenial answers 403 for anything but an allow decision.
+func writePolicyDenial(w http.ResponseWriter, d policy.Decision) {
+	msg := "denied by family policy"
+	if d.Effect == policy.EffectRequireApproval {
+		msg = "family policy requires approval"
+	}
+	writeJSON(w, http.StatusForbidden, map[string]interface{}{
+		"error":    msg,
+		"decision": d,
+	})
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"backend_mini/internal/db"
+)
+
+type familyQuotasRequest struct {
+	ParentEmail string `json:"parent_email"`
+}
+
+type setQuotaRequest struct {
+	ParentEmail string `json:"parent_email"`
+	Resource    string `json:"resource"`
+	// Max is the family's own cap; zero lifts the cap for them.
+	Max   int    `json:"max"`
+	Clear bool   `json:"clear,omitempty"`
+	SetBy string `json:"set_by"`
+}
+
+// quotaExceeded answers 409 with the resource and cap when err is a quota
+// error, and reports whether it did.
+func quotaExceeded(w http.ResponseWriter, err error) bool {
+	var qe *db.QuotaError
+	if !errors.As(err, &qe) {
+		return false
+	}
+	writeJSON(w, http.StatusConflict, map[string]any{"error": qe.Error(), "quota": qe})
+	return true
+}
+
+// FamilyQuotas shows a family's use of each quota against its cap.
+func (a *API) FamilyQuotas(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req familyQuotasRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email is required")
+		return
+	}
+	quotas, err := a.db.FamilyQuotas(r.Context(), req.ParentEmail)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, quotas)
+}
+
+// SetQuota overrides one quota for a family, or clears the override.
+func (a *API) SetQuota(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req setQuotaRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" || strings.TrimSpace(req.SetBy) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email, resource and set_by are required")
+		return
+	}
+	if !slices.Contains(db.QuotaResources, req.Resource) {
+		writeError(w, http.StatusBadRequest, "resource must be one of "+strings.Join(db.QuotaResources, ", "))
+		return
+	}
+	if req.Max < 0 {
+		writeError(w, http.StatusBadRequest, "max must not be negative")
+		return
+	}
+	ctx := r.Context()
+	if err := a.db.SetQuotaOverride(ctx, req.ParentEmail, req.Resource, req.Max, req.Clear, req.SetBy); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	quotas, err := a.db.FamilyQuotas(ctx, req.ParentEmail)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, quotas)
+}
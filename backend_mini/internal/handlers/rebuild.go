@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"backend_mini/internal/db"
+)
+
+// RebuildTx serves /rebuild_tx/{transfer_id}. It rebuilds an expired
+// transfer with the same legs and a fresh blockhash and marks the original
+// superseded, so at most one build of the intent can still be signed.
+func (a *API) RebuildTx(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/rebuild_tx/")
+	if id == "" {
+		writeError(w, http.StatusBadRequest, "transfer id is required")
+		return
+	}
+	ctx := r.Context()
+	old, found, err := a.db.GetTransfer(ctx, id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "transfer not found")
+		return
+	}
+	if old.Status == db.TransferSuperseded {
+		writeJSON(w, http.StatusConflict, map[string]string{
+			"error":         "transfer was already rebuilt",
+			"superseded_by": old.SupersededBy,
+		})
+		return
+	}
+	if expires, err := time.Parse(time.RFC3339, old.ExpiresAt); err == nil && time.Now().Before(expires) {
+		writeJSON(w, http.StatusConflict, map[string]string{
+			"error":      "transaction has not expired yet",
+			"expires_at": old.ExpiresAt,
+		})
+		return
+	}
+
+	decision, err := a.transferPolicy(r, old.FromWallet, old.ToWallet, old.Total)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !decision.Allowed() {
+		writePolicyDenial(w, decision)
+		return
+	}
+	if !a.checkHeld(w, r, old.FromWallet) {
+		return
+	}
+
+	unlock, err := a.lockWallet(ctx, old.FromWallet)
+	if err != nil {
+		writeBuildError(w, err, http.StatusInternalServerError)
+		return
+	}
+	defer unlock()
+	t := &db.Transfer{FromWallet: old.FromWallet, ToWallet: old.ToWallet, Kind: old.Kind, Ref: old.Ref, Legs: old.Legs}
+	txData, err := a.buildTransfer(ctx, t)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := a.db.SupersedeTransfer(ctx, old.TransferID, t); err != nil {
+		if errors.Is(err, db.ErrTransferSuperseded) {
+			writeError(w, http.StatusConflict, "transfer was already rebuilt")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	txData.TransferID = t.TransferID
+	txData.Supersedes = old.TransferID
+	writeJSON(w, http.StatusOK, txData)
+}
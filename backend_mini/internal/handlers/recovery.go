@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"backend_mini/internal/config"
+	"backend_mini/internal/db"
+)
+
+type startRecoveryRequest struct {
+	OldEmail    string `json:"old_email"`
+	Provider    string `json:"provider"`
+	IDToken     string `json:"id_token"`
+	DocumentRef string `json:"document_ref,omitempty"`
+	Reason      string `json:"reason,omitempty"`
+}
+
+type cancelRecoveryRequest struct {
+	OldEmail   string `json:"old_email"`
+	RecoveryID string `json:"recovery_id"`
+}
+
+type listRecoveriesRequest struct {
+	Status string `json:"status,omitempty"`
+	Limit  int    `json:"limit,omitempty"`
+}
+
+type reviewRecoveryRequest struct {
+	RecoveryID string `json:"recovery_id"`
+	Approve    bool   `json:"approve"`
+	ReviewedBy string `json:"reviewed_by"`
+	Note       string `json:"note,omitempty"`
+}
+
+// StartRecovery opens a recovery for a parent who can no longer use the
+// account's email. The new email is proven with an Apple or Google ID
+// token; document_ref points support at any identity document checked
+// outside the API. The old email's owner is notified and can cancel until
+// an admin completes the recovery after the cooling-off period.
+func (a *API) StartRecovery(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req startRecoveryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.OldEmail) == "" || strings.TrimSpace(req.Provider) == "" || strings.TrimSpace(req.IDToken) == "" {
+		writeError(w, http.StatusBadRequest, "old_email, provider and id_token are required")
+		return
+	}
+	ctx := r.Context()
+	p, found, err := a.db.GetParentByEmail(ctx, req.OldEmail)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "parent not found")
+		return
+	}
+	claims, ok := verifiedEmailClaims(w, r, req.Provider, req.IDToken)
+	if !ok {
+		return
+	}
+	if !a.emailUnused(w, r, claims.Email) {
+		return
+	}
+	rec := &db.AccountRecovery{OldEmail: p.Email, NewEmail: claims.Email, VerifiedBy: strings.ToLower(req.Provider),
+		DocumentRef: strings.TrimSpace(req.DocumentRef), Reason: strings.TrimSpace(req.Reason)}
+	err = a.db.StartRecovery(ctx, rec, config.AccountRecoveryCoolingOff())
+	if errors.Is(err, db.ErrRecoveryOpen) {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	a.emitRecoveryEvent(ctx, "account.recovery_requested", rec.OldEmail, rec)
+	writeJSON(w, http.StatusOK, rec)
+}
+
+// emailUnused writes 409 and returns false when email already belongs to a
+// parent or kid, since a recovery cannot merge two accounts.
+func (a *API) emailUnused(w http.ResponseWriter, r *http.Request, email string) bool {
+	ctx := r.Context()
+	_, parent, err := a.db.GetParentByEmail(ctx, email)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return false
+	}
+	_, kid, err := a.db.GetChildByEmail(ctx, email)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return false
+	}
+	if parent || kid {
+		writeError(w, http.StatusConflict, "new email already belongs to an account")
+		return false
+	}
+	return true
+}
+
+// CancelRecovery stops a pending recovery of the caller's account.
+func (a *API) CancelRecovery(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req cancelRecoveryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.OldEmail) == "" || strings.TrimSpace(req.RecoveryID) == "" {
+		writeError(w, http.StatusBadRequest, "old_email and recovery_id are required")
+		return
+	}
+	rec, err := a.db.CancelRecovery(r.Context(), req.RecoveryID, req.OldEmail)
+	if errors.Is(err, db.ErrRecoveryNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, rec)
+}
+
+// ListRecoveries is the admin review queue for account recoveries.
+func (a *API) ListRecoveries(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req listRecoveriesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if req.Status == "" {
+		req.Status = db.RecoveryPending
+	}
+	if req.Status == "all" {
+		req.Status = ""
+	}
+	if req.Limit <= 0 || req.Limit > 500 {
+		req.Limit = 100
+	}
+	recs, err := a.db.ListRecoveries(r.Context(), req.Status, req.Limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, recs)
+}
+
+// ReviewRecovery rejects a pending recovery or, once its cooling-off period
+// is over, approves it and moves the account onto the new email.
+func (a *API) ReviewRecovery(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req reviewRecoveryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.RecoveryID) == "" || strings.TrimSpace(req.ReviewedBy) == "" {
+		writeError(w, http.StatusBadRequest, "recovery_id and reviewed_by are required")
+		return
+	}
+	ctx := r.Context()
+	if !req.Approve {
+		rec, err := a.db.RejectRecovery(ctx, req.RecoveryID, req.ReviewedBy, req.Note)
+		if errors.Is(err, db.ErrRecoveryNotFound) {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		a.emitRecoveryEvent(ctx, "account.recovery_rejected", rec.OldEmail, rec)
+		writeJSON(w, http.StatusOK, rec)
+		return
+	}
+	pending, found, err := a.db.GetRecovery(ctx, req.RecoveryID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found || pending.Status != db.RecoveryPending {
+		writeError(w, http.StatusNotFound, db.ErrRecoveryNotFound.Error())
+		return
+	}
+	// the new email may have signed up while the recovery waited
+	if !a.emailUnused(w, r, pending.NewEmail) {
+		return
+	}
+	rec, err := a.db.CompleteRecovery(ctx, req.RecoveryID, req.ReviewedBy, req.Note, time.Now())
+	switch {
+	case errors.Is(err, db.ErrRecoveryNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, db.ErrRecoveryCooling):
+		writeJSON(w, http.StatusConflict, map[string]interface{}{
+			"error":             err.Error(),
+			"cooling_off_until": pending.CoolingOffEnd,
+		})
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	default:
+		a.emitRecoveryEvent(ctx, "account.recovered", rec.NewEmail, rec)
+		writeJSON(w, http.StatusOK, rec)
+	}
+}
+
+// emitRecoveryEvent notifies a parent about a recovery of their account.
+// Failures are logged: the recovery itself is already recorded.
+func (a *API) emitRecoveryEvent(ctx context.Context, eventType, parentEmail string, rec *db.AccountRecovery) {
+	if _, err := a.notifier.Emit(ctx, eventType, parentEmail, rec); err != nil {
+		log.Printf("recovery %s: emit %s failed: %v", rec.RecoveryID, eventType, err)
+	}
+}
@@ -0,0 +1,345 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+
+	"backend_mini/internal/config"
+	"backend_mini/internal/db"
+	"backend_mini/internal/policy"
+	"backend_mini/internal/util"
+)
+
+type reverseTxRequest struct {
+	TransferID string `json:"transfer_id"`
+	// RequestedBy is the email of the parent, or of the kid sending or
+	// receiving the transfer.
+	RequestedBy string `json:"requested_by"`
+	Reason      string `json:"reason,omitempty"`
+	// Signature is the one the transfer landed with, needed unless it
+	// was verified with /verify_signed before it was submitted.
+	Signature string `json:"signature,omitempty"`
+	// PIN is the paying kid's, when the reversal is built right away.
+	PIN string `json:"pin,omitempty"`
+}
+
+type acknowledgeReversalRequest struct {
+	ReversalID string `json:"reversal_id"`
+	Email      string `json:"email"`
+	Accept     bool   `json:"accept"`
+	PIN        string `json:"pin,omitempty"`
+}
+
+type listReversalsRequest struct {
+	ParentEmail string `json:"parent_email"`
+}
+
+// walletOwner returns the email of the parent or kid whose wallet it is
+// and the email of their family's parent.
+func (a *API) walletOwner(ctx context.Context, wallet string) (owner, parentEmail string, found bool, err error) {
+	if p, ok, err := a.db.GetParentByWallet(ctx, wallet); err != nil || ok {
+		if ok {
+			return strings.ToLower(p.Email), strings.ToLower(p.Email), true, nil
+		}
+		return "", "", false, err
+	}
+	kid, ok, err := a.db.GetChildByWallet(ctx, wallet)
+	if err != nil || !ok {
+		return "", "", false, err
+	}
+	parentEmail, _, found, err = a.db.FamilyOfWallet(ctx, wallet)
+	return strings.ToLower(kid.Email), strings.ToLower(parentEmail), found, err
+}
+
+// ReverseTx undoes a mistaken transfer between members of a family by
+// building the compensating transfer from its recipient back to its
+// sender. Only a transfer confirmed on chain can be reversed. When the family policy asks for approval of the reversal, the
+// other party to the transfer has to accept it with /acknowledge_reversal
+// first.
+func (a *API) ReverseTx(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req reverseTxRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.TransferID) == "" || strings.TrimSpace(req.RequestedBy) == "" {
+		writeError(w, http.StatusBadRequest, "transfer_id and requested_by are required")
+		return
+	}
+	reason, err := util.SanitizeText(req.Reason, config.SubmissionNoteMaxLen(), true)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "reason "+err.Error())
+		return
+	}
+	ctx := r.Context()
+	t, found, err := a.db.GetTransfer(ctx, req.TransferID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "transfer not found")
+		return
+	}
+	now := time.Now()
+	switch {
+	case t.Status == db.TransferSuperseded:
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "transfer was rebuilt; reverse the rebuilt one", "superseded_by": t.SupersededBy})
+		return
+	case t.Kind == db.TransferKindReversal:
+		writeError(w, http.StatusUnprocessableEntity, "a reversal cannot be reversed")
+		return
+	case t.CreatedAt < now.Add(-config.ReversalWindow()).UTC().Format(time.RFC3339):
+		writeError(w, http.StatusUnprocessableEntity, "transfer is too old to reverse")
+		return
+	case len(t.Legs) != 1 || t.Legs[0].ToWallet != t.ToWallet:
+		writeError(w, http.StatusUnprocessableEntity, "transfers split across wallets cannot be reversed")
+		return
+	}
+	if !a.checkSettled(w, r, t, req.Signature) {
+		return
+	}
+	sender, family, found, err := a.walletOwner(ctx, t.FromWallet)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	payer, payerFamily, payerFound, err := a.walletOwner(ctx, t.ToWallet)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found || !payerFound || family != payerFamily {
+		writeError(w, http.StatusUnprocessableEntity, "only transfers between members of one family can be reversed")
+		return
+	}
+	requester := strings.ToLower(strings.TrimSpace(req.RequestedBy))
+	if requester != family && requester != sender && requester != payer {
+		writeError(w, http.StatusForbidden, "only the parent or a party to the transfer can reverse it")
+		return
+	}
+	actor := policy.ActorKid
+	if requester == family {
+		actor = policy.ActorParent
+	}
+	decision, err := a.checkPolicy(ctx, family, policy.Input{Action: policy.ActionReversal, Actor: requestActor(r, actor), Amount: t.Total, Recipient: t.FromWallet, At: now})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	rv := &db.Reversal{TransferID: t.TransferID, ParentEmail: family, RequestedBy: requester, Reason: reason, Amount: t.Total}
+	switch decision.Effect {
+	case policy.EffectRequireApproval:
+		// the other party accepts: whoever pays back, unless they asked
+		rv.AckEmail = payer
+		if requester == payer {
+			rv.AckEmail = sender
+		}
+		if err := a.db.RequestReversal(ctx, rv); err != nil {
+			if errors.Is(err, db.ErrReversalExists) {
+				writeError(w, http.StatusConflict, err.Error())
+				return
+			}
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if _, err := a.notifier.Emit(ctx, "transfer.reversal_requested", family, rv); err != nil {
+			log.Printf("reverse tx: emit failed: %v", err)
+		}
+		writeJSON(w, http.StatusAccepted, map[string]any{"reversal": rv, "decision": decision})
+	case policy.EffectAllow:
+		a.buildReversal(w, r, rv, t, requester, req.PIN)
+	default:
+		writePolicyDenial(w, decision)
+	}
+}
+
+// AcknowledgeReversal lets the party a reversal waits for accept it, which
+// builds the compensating transfer, or decline it.
+func (a *API) AcknowledgeReversal(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req acknowledgeReversalRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ReversalID) == "" || strings.TrimSpace(req.Email) == "" {
+		writeError(w, http.StatusBadRequest, "reversal_id and email are required")
+		return
+	}
+	ctx := r.Context()
+	rv, err := a.db.GetReversal(ctx, req.ReversalID)
+	if errors.Is(err, db.ErrReversalNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if rv.Status != db.ReversalPending {
+		writeError(w, http.StatusConflict, db.ErrReversalDecided.Error())
+		return
+	}
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+	if email != rv.AckEmail {
+		writeError(w, http.StatusForbidden, "the reversal is waiting for someone else")
+		return
+	}
+	if !req.Accept {
+		if err := a.db.DeclineReversal(ctx, rv, email); err != nil {
+			if errors.Is(err, db.ErrReversalDecided) {
+				writeError(w, http.StatusConflict, err.Error())
+				return
+			}
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if _, err := a.notifier.Emit(ctx, "transfer.reversal_declined", rv.ParentEmail, rv); err != nil {
+			log.Printf("acknowledge reversal: emit failed: %v", err)
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"reversal": rv})
+		return
+	}
+	t, found, err := a.db.GetTransfer(ctx, rv.TransferID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "transfer not found")
+		return
+	}
+	a.buildReversal(w, r, rv, t, email, req.PIN)
+}
+
+// buildReversal builds the transfer paying orig back and records it as
+// rv's, answering with both. Money leaves the payer's wallet under the
+// same guards as /eurc_tx: holds, savings locks and the kid's PIN.
+func (a *API) buildReversal(w http.ResponseWriter, r *http.Request, rv *db.Reversal, orig *db.Transfer, actor, pin string) {
+	if !a.checkHeld(w, r, orig.ToWallet) {
+		return
+	}
+	ctx := r.Context()
+	decision, err := a.savingsLockPolicy(ctx, orig.ToWallet, orig.Total)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !decision.Allowed() {
+		writePolicyDenial(w, decision)
+		return
+	}
+	if !a.checkKidPIN(w, r, orig.ToWallet, pin) {
+		return
+	}
+	unlock, err := a.lockWallet(ctx, orig.ToWallet)
+	if err != nil {
+		writeBuildError(w, err, http.StatusInternalServerError)
+		return
+	}
+	defer unlock()
+	t := &db.Transfer{FromWallet: orig.ToWallet, ToWallet: orig.FromWallet, Kind: db.TransferKindReversal, Ref: orig.TransferID,
+		Legs: []db.TransferLeg{{ToWallet: orig.FromWallet, Amount: orig.Total}}}
+	txData, err := a.buildTransfer(ctx, t)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := a.db.CompleteReversal(ctx, rv, t, actor); err != nil {
+		if errors.Is(err, db.ErrReversalExists) || errors.Is(err, db.ErrReversalDecided) {
+			writeError(w, http.StatusConflict, err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	txData.TransferID = t.TransferID
+	txData.Reverses = orig.TransferID
+	if _, err := a.notifier.Emit(ctx, "transfer.reversed", rv.ParentEmail, rv); err != nil {
+		log.Printf("reverse tx: emit failed: %v", err)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"reversal": rv, "tx": txData})
+}
+
+// checkSettled confirms on chain that t landed before it is reversed, so
+// nobody pays back money they never received. The signature is the one
+// given, or else the one /verify_signed recorded; the transaction it names
+// must be t's. It writes the error and returns false otherwise.
+func (a *API) checkSettled(w http.ResponseWriter, r *http.Request, t *db.Transfer, signature string) bool {
+	if t.SettledAt != "" {
+		return true
+	}
+	if signature = strings.TrimSpace(signature); signature == "" {
+		signature = t.Signature
+	}
+	if signature == "" {
+		writeError(w, http.StatusConflict, "transfer has no known signature; pass the signature it landed with")
+		return false
+	}
+	sig, err := solana.SignatureFromBase58(signature)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid signature")
+		return false
+	}
+	if t.MessageHash == "" {
+		writeError(w, http.StatusUnprocessableEntity, "transfer was built before message hashes were recorded; its settlement cannot be confirmed")
+		return false
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	tx, err := util.LandedTransaction(ctx, sig)
+	if errors.Is(err, util.ErrNotLanded) {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "transfer has not settled on chain: " + err.Error(), "signature": signature})
+		return false
+	}
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, "could not confirm settlement: "+err.Error())
+		return false
+	}
+	if hash, err := util.MessageHash(tx, blockhashOverride(t)); err != nil || hash != t.MessageHash {
+		writeError(w, http.StatusConflict, "signature is of a different transaction")
+		return false
+	}
+	if err := a.db.SettleTransfer(r.Context(), t, signature); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return false
+	}
+	return true
+}
+
+func (a *API) ListReversals(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req listReversalsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email is required")
+		return
+	}
+	out, err := a.db.ListReversals(r.Context(), req.ParentEmail)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, out)
+}
@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"backend_mini/internal/db"
+)
+
+// savingsLockRuleID is the rule a transfer denied for dipping into locked
+// savings is reported under, next to the family policy's own rules.
+const savingsLockRuleID = "savings_lock"
+
+type lockSavingsRequest struct {
+	ParentEmail string `json:"parent_email"`
+	KidEmail    string `json:"kid_email"`
+	Amount      uint64 `json:"amount"`
+	UnlockOn    string `json:"unlock_on,omitempty"`
+	UntilAge    int    `json:"until_age,omitempty"`
+	BirthDate   string `json:"birth_date,omitempty"`
+	Note        string `json:"note,omitempty"`
+}
+
+type listSavingsLocksRequest struct {
+	ParentEmail string `json:"parent_email"`
+	KidEmail    string `json:"kid_email"`
+}
+
+type requestUnlockRequest struct {
+	KidEmail string `json:"kid_email"`
+	LockID   string `json:"lock_id"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+type decideUnlockRequest struct {
+	ParentEmail string `json:"parent_email"`
+	LockID      string `json:"lock_id"`
+	Approve     bool   `json:"approve"`
+}
+
+// LockSavings sets aside part of a kid's funds until a date, given directly
+// or as the day the kid reaches an age. Transfers from the kid's wallet that
+// would spend locked funds are denied.
+func (a *API) LockSavings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req lockSavingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" || strings.TrimSpace(req.KidEmail) == "" || req.Amount == 0 {
+		writeError(w, http.StatusBadRequest, "parent_email, kid_email and amount are required")
+		return
+	}
+	unlockOn, err := savingsUnlockDate(req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !unlockOn.After(time.Now().UTC()) {
+		writeError(w, http.StatusBadRequest, "unlock date must be in the future")
+		return
+	}
+	kid, ok := a.kidOfParent(w, r, req.ParentEmail, req.KidEmail)
+	if !ok {
+		return
+	}
+	if kid.Wallet == "" {
+		writeError(w, http.StatusConflict, "kid has no wallet")
+		return
+	}
+	if !a.requireFeature(w, r, req.ParentEmail, db.FeatureSavingsLocks) {
+		return
+	}
+	l := &db.SavingsLock{ParentEmail: req.ParentEmail, KidEmail: kid.Email, Wallet: kid.Wallet, Amount: req.Amount,
+		UnlockOn: unlockOn.Format("2006-01-02"), UntilAge: req.UntilAge, Note: strings.TrimSpace(req.Note)}
+	if err := a.db.CreateSavingsLock(r.Context(), l); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, l)
+}
+
+// savingsUnlockDate resolves the request's unlock_on, or until_age counted
+// from birth_date, to a UTC day.
+func savingsUnlockDate(req lockSavingsRequest) (time.Time, error) {
+	switch {
+	case req.UnlockOn != "" && req.UntilAge != 0:
+		return time.Time{}, errors.New("give either unlock_on or until_age, not both")
+	case req.UnlockOn != "":
+		d, err := time.Parse("2006-01-02", req.UnlockOn)
+		if err != nil {
+			return time.Time{}, errors.New("unlock_on must be YYYY-MM-DD")
+		}
+		return d, nil
+	case req.UntilAge != 0:
+		if req.UntilAge < 0 || req.UntilAge > 25 {
+			return time.Time{}, errors.New("until_age must be between 1 and 25")
+		}
+		born, err := time.Parse("2006-01-02", req.BirthDate)
+		if err != nil {
+			return time.Time{}, errors.New("until_age needs birth_date as YYYY-MM-DD")
+		}
+		return born.AddDate(req.UntilAge, 0, 0), nil
+	}
+	return time.Time{}, errors.New("unlock_on or until_age is required")
+}
+
+// ListSavingsLocks returns the kid's savings locks and how much they hold
+// today.
+func (a *API) ListSavingsLocks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req listSavingsLocksRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" || strings.TrimSpace(req.KidEmail) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email and kid_email are required")
+		return
+	}
+	kid, ok := a.kidOfParent(w, r, req.ParentEmail, req.KidEmail)
+	if !ok {
+		return
+	}
+	locks, err := a.db.ListSavingsLocks(r.Context(), kid.Email)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	var locked uint64
+	now := time.Now()
+	for _, l := range locks {
+		if l.Active(now) {
+			locked += l.Amount
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"locks":          locks,
+		"locked_savings": locked,
+	})
+}
+
+// RequestUnlock asks the kid's parent to release a lock before its date.
+// Nothing is released until the parent approves through /decide_unlock.
+func (a *API) RequestUnlock(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req requestUnlockRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.KidEmail) == "" || strings.TrimSpace(req.LockID) == "" {
+		writeError(w, http.StatusBadRequest, "kid_email and lock_id are required")
+		return
+	}
+	ctx := r.Context()
+	l, found, err := a.db.GetSavingsLock(ctx, req.LockID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found || !strings.EqualFold(l.KidEmail, req.KidEmail) {
+		writeError(w, http.StatusNotFound, "savings lock not found")
+		return
+	}
+	if !l.Active(time.Now()) {
+		writeError(w, http.StatusConflict, "savings lock is no longer holding funds")
+		return
+	}
+	l, err = a.db.RequestEarlyUnlock(ctx, req.LockID, strings.TrimSpace(req.Reason))
+	if err != nil {
+		writeSavingsLockError(w, err)
+		return
+	}
+	if err := a.db.Audit(ctx, req.KidEmail, "savings_lock.unlock_requested", l.KidEmail, l.LockID); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, l)
+}
+
+// DecideUnlock approves or denies a kid's pending early-unlock request.
+// Approval releases the lock at once; denial leaves it locked.
+func (a *API) DecideUnlock(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req decideUnlockRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" || strings.TrimSpace(req.LockID) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email and lock_id are required")
+		return
+	}
+	ctx := r.Context()
+	l, found, err := a.db.GetSavingsLock(ctx, req.LockID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found || !strings.EqualFold(l.ParentEmail, req.ParentEmail) {
+		writeError(w, http.StatusNotFound, "savings lock not found")
+		return
+	}
+	l, err = a.db.DecideEarlyUnlock(ctx, req.LockID, req.ParentEmail, req.Approve)
+	if err != nil {
+		writeSavingsLockError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, l)
+}
+
+func writeSavingsLockError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, db.ErrSavingsLockNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, db.ErrSavingsLockReleased), errors.Is(err, db.ErrNoUnlockRequested):
+		writeError(w, http.StatusConflict, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
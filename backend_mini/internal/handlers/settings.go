@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"backend_mini/internal/config"
+	"backend_mini/internal/db"
+)
+
+var currencyCode = regexp.MustCompile(`^[A-Z]{3,4}$`)
+
+type settingsRequest struct {
+	ParentEmail           string                `json:"parent_email"`
+	Timezone              *string               `json:"timezone,omitempty"`
+	Currency              *string               `json:"currency,omitempty"`
+	Notifications         *db.NotificationPrefs `json:"notifications,omitempty"`
+	AutoApproveBelow      *uint64               `json:"auto_approve_below,omitempty"`
+	AutoApproveAfterHours *int                  `json:"auto_approve_after_hours,omitempty"`
+	ContentFilter         *string               `json:"content_filter,omitempty"`
+	Features              map[string]bool       `json:"features,omitempty"`
+	// DataSharingConsent is the current terms version to opt in, or ""
+	// to opt out.
+	DataSharingConsent *string `json:"data_sharing_consent,omitempty"`
+}
+
+// Settings reads the family's settings, or updates the fields present in
+// the body. Features are merged, so one toggle can be sent on its own.
+func (a *API) Settings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req settingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email is required")
+		return
+	}
+	ctx := r.Context()
+	if _, found, err := a.db.GetParentByEmail(ctx, req.ParentEmail); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	} else if !found {
+		writeError(w, http.StatusNotFound, "parent not found")
+		return
+	}
+	s, err := a.db.GetFamilySettings(ctx, req.ParentEmail)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if req.Timezone == nil && req.Currency == nil && req.Notifications == nil && req.AutoApproveBelow == nil &&
+		req.AutoApproveAfterHours == nil && req.ContentFilter == nil && len(req.Features) == 0 && req.DataSharingConsent == nil {
+		writeJSON(w, http.StatusOK, s)
+		return
+	}
+	if req.Timezone != nil {
+		if _, err := time.LoadLocation(*req.Timezone); err != nil || *req.Timezone == "" || *req.Timezone == "Local" {
+			writeError(w, http.StatusBadRequest, "timezone must be an IANA zone such as Europe/Berlin")
+			return
+		}
+		s.Timezone = *req.Timezone
+	}
+	if req.Currency != nil {
+		c := strings.ToUpper(strings.TrimSpace(*req.Currency))
+		if !currencyCode.MatchString(c) {
+			writeError(w, http.StatusBadRequest, "currency must be a currency code such as EUR or EURC")
+			return
+		}
+		s.Currency = c
+	}
+	if req.Notifications != nil {
+		s.Notifications = *req.Notifications
+	}
+	if req.AutoApproveBelow != nil {
+		s.AutoApproveBelow = *req.AutoApproveBelow
+	}
+	if req.AutoApproveAfterHours != nil {
+		s.AutoApproveAfterHours = *req.AutoApproveAfterHours
+	}
+	if s.AutoApproveAfterHours < 1 || s.AutoApproveAfterHours > 24*14 {
+		writeError(w, http.StatusBadRequest, "auto_approve_after_hours must be between 1 and 336")
+		return
+	}
+	if req.ContentFilter != nil {
+		if !contentStrictness[*req.ContentFilter] {
+			writeError(w, http.StatusBadRequest, "content_filter must be off, flag, mask or block")
+			return
+		}
+		s.ContentFilter = *req.ContentFilter
+	}
+	if req.DataSharingConsent != nil {
+		if v := *req.DataSharingConsent; v != "" && v != config.DataSharingTermsVersion() {
+			writeError(w, http.StatusBadRequest, "data_sharing_consent must be the current terms version "+config.DataSharingTermsVersion()+", or empty to opt out")
+			return
+		}
+		s.DataSharingConsent = *req.DataSharingConsent
+	}
+	for f, on := range req.Features {
+		if !slices.Contains(db.Features, f) {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("unknown feature %q; features are %s", f, strings.Join(db.Features, ", ")))
+			return
+		}
+		s.Features[f] = on
+	}
+	s, err = a.db.SetFamilySettings(ctx, s)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, s)
+}
+
+// familyLocation is the family's time zone. Lookup failures are logged and
+// fall back to UTC, which is what every family had before settings.
+func (a *API) familyLocation(ctx context.Context, parentEmail string) *time.Location {
+	s, err := a.db.GetFamilySettings(ctx, parentEmail)
+	if err != nil {
+		log.Printf("settings: %s: %v", parentEmail, err)
+		return time.UTC
+	}
+	return s.Location()
+}
+
+// requireFeature writes 403 and returns false when the family has turned
+// feature off.
+func (a *API) requireFeature(w http.ResponseWriter, r *http.Request, parentEmail, feature string) bool {
+	s, err := a.db.GetFamilySettings(r.Context(), parentEmail)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return false
+	}
+	if !s.Enabled(feature) {
+		writeError(w, http.StatusForbidden, fmt.Sprintf("%s is turned off in this family's settings", feature))
+		return false
+	}
+	return true
+}
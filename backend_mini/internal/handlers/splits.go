@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+
+	"backend_mini/internal/config"
+	"backend_mini/internal/db"
+	"backend_mini/internal/util"
+)
+
+type setSplitRuleRequest struct {
+	ParentEmail   string `json:"parent_email"`
+	KidEmail      string `json:"kid_email"`
+	Percent       int    `json:"percent"`
+	SavingsWallet string `json:"savings_wallet"`
+}
+
+type getSplitRuleRequest struct {
+	KidEmail string `json:"kid_email"`
+}
+
+// buildIncomingTransfer builds a transfer to wallet, applying the
+// recipient kid's split rule if one is configured, and records it in the
+// ledger under kind and ref.
+func (a *API) buildIncomingTransfer(ctx context.Context, from, to string, amount uint64, kind, ref string) (*util.TransactionData, error) {
+	legs, split, err := a.planIncomingTransfer(ctx, to, amount)
+	if err != nil {
+		return nil, err
+	}
+	recorded := make([]db.TransferLeg, len(legs))
+	for i, l := range legs {
+		recorded[i] = db.TransferLeg{ToWallet: l.To, Amount: l.Amount}
+	}
+	unlock, err := a.lockWallet(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	t := &db.Transfer{FromWallet: from, ToWallet: to, Kind: kind, Ref: ref, Legs: recorded}
+	txData, err := a.buildTransfer(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.db.RecordTransfer(ctx, t); err != nil {
+		return nil, err
+	}
+	txData.Split = split
+	txData.TransferID = t.TransferID
+	return txData, nil
+}
+
+// buildTransfer builds t's legs against a fresh blockhash and sets its
+// blockhash, expiry and the token accounts it creates. When the RPC cannot
+// be reached the placeholder hash is used and the client has to set a real
+// one before signing. Callers hold the sender's wallet lock so that
+// accounts created by its other pending builds are left out.
+func (a *API) buildTransfer(ctx context.Context, t *db.Transfer) (*util.TransactionData, error) {
+	pending, err := a.db.PendingATACreates(ctx, t.FromWallet, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	hashCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	blockhash, err := util.LatestBlockhash(hashCtx)
+	cancel()
+	if err != nil {
+		log.Printf("build transfer: %v; using placeholder blockhash", err)
+		blockhash = util.PlaceholderBlockhash
+	}
+	legs := make([]util.TransferLeg, len(t.Legs))
+	for i, l := range t.Legs {
+		legs[i] = util.TransferLeg{To: l.ToWallet, Amount: l.Amount}
+	}
+	txData, err := util.BuildEURCMultiTransferTransactionWithOptions(t.FromWallet, legs, util.BuildOptions{Blockhash: blockhash, SkipATACreate: pending})
+	if err != nil {
+		return nil, err
+	}
+	t.Blockhash = blockhash
+	t.ExpiresAt = time.Now().Add(config.TransactionValidity()).UTC().Format(time.RFC3339)
+	t.ATACreates = txData.CreatedATAs()
+	if t.MessageHash, err = util.SerializedMessageHash(txData.Serialized, ""); err != nil {
+		return nil, err
+	}
+	txData.ExpiresAt = t.ExpiresAt
+	return txData, nil
+}
+
+// planIncomingTransfer decides the legs of a transfer to wallet. split is
+// nil unless the recipient kid's split rule divides the amount.
+func (a *API) planIncomingTransfer(ctx context.Context, to string, amount uint64) ([]util.TransferLeg, *util.SplitInfo, error) {
+	whole := []util.TransferLeg{{To: to, Amount: amount}}
+	kid, found, err := a.db.GetChildByWallet(ctx, to)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !found {
+		return whole, nil, nil
+	}
+	rule, found, err := a.db.GetSplitRule(ctx, kid.Email)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !found || rule.Percent <= 0 {
+		return whole, nil, nil
+	}
+	savings := amount * uint64(rule.Percent) / 100
+	split := &util.SplitInfo{Percent: rule.Percent, KidWallet: to, KidAmount: amount - savings, SavingsWallet: rule.SavingsWallet, SavingsAmount: savings}
+	var legs []util.TransferLeg
+	if split.KidAmount > 0 {
+		legs = append(legs, util.TransferLeg{To: to, Amount: split.KidAmount})
+	}
+	if split.SavingsAmount > 0 {
+		legs = append(legs, util.TransferLeg{To: rule.SavingsWallet, Amount: split.SavingsAmount})
+	}
+	return legs, split, nil
+}
+
+func (a *API) SetSplitRule(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req setSplitRuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" || strings.TrimSpace(req.KidEmail) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email and kid_email are required")
+		return
+	}
+	if req.Percent < 0 || req.Percent > 100 {
+		writeError(w, http.StatusBadRequest, "percent must be between 0 and 100")
+		return
+	}
+	ctx := r.Context()
+	p, found, err := a.db.GetParentByEmail(ctx, req.ParentEmail)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "parent not found")
+		return
+	}
+	c, found, err := a.db.GetChildByEmail(ctx, req.KidEmail)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found || c.ParentID != p.ID {
+		writeError(w, http.StatusNotFound, "kid not found for this parent")
+		return
+	}
+	if req.Percent == 0 {
+		if err := a.db.DeleteSplitRule(ctx, c.Email); err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "removed"})
+		return
+	}
+	if _, err := solana.PublicKeyFromBase58(req.SavingsWallet); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid savings_wallet")
+		return
+	}
+	if req.SavingsWallet == c.Wallet {
+		writeError(w, http.StatusBadRequest, "savings_wallet must differ from the kid wallet")
+		return
+	}
+	rule, err := a.db.SetSplitRule(ctx, p.Email, c.Email, req.Percent, req.SavingsWallet)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, rule)
+}
+
+func (a *API) GetSplitRule(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req getSplitRuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.KidEmail) == "" {
+		writeError(w, http.StatusBadRequest, "kid_email is required")
+		return
+	}
+	rule, found, err := a.db.GetSplitRule(r.Context(), req.KidEmail)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "no split rule")
+		return
+	}
+	writeJSON(w, http.StatusOK, rule)
+}
@@ -0,0 +1,476 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"backend_mini/internal/config"
+	"backend_mini/internal/db"
+	"backend_mini/internal/stripe"
+)
+
+// maxStripeEventBytes bounds a webhook body; Stripe events are a few KB.
+const maxStripeEventBytes = 1 << 20
+
+type billingCheckoutRequest struct {
+	ParentEmail string `json:"parent_email"`
+	// PriceID defaults to the first of STRIPE_PRICES.
+	PriceID string `json:"price_id,omitempty"`
+}
+
+type changePlanRequest struct {
+	ParentEmail string `json:"parent_email"`
+	PriceID     string `json:"price_id"`
+}
+
+type cancelBillingRequest struct {
+	ParentEmail string `json:"parent_email"`
+	// Immediately ends premium now with a prorated credit; otherwise it
+	// lasts until the paid period ends.
+	Immediately bool `json:"immediately,omitempty"`
+	// Resume undoes a cancellation that has not taken effect yet.
+	Resume bool `json:"resume,omitempty"`
+}
+
+// stripeClient is the configured Stripe client, or false when web billing
+// is off.
+func stripeClient() (stripe.Client, bool) {
+	key := config.StripeSecretKey()
+	return stripe.Client{SecretKey: key, Base: config.StripeAPIBase()}, key != ""
+}
+
+// stripeState maps a Stripe subscription onto our statuses. Stripe keeps
+// retrying a past_due card for a while, so those families keep premium as
+// a grace period; unpaid and never-paid ones do not.
+func stripeState(sub *stripe.Subscription) (string, bool) {
+	switch sub.Status {
+	case stripe.StatusActive, stripe.StatusTrialing:
+		if sub.CancelAtPeriodEnd {
+			return db.SubscriptionCanceled, false
+		}
+		return db.SubscriptionActive, true
+	case stripe.StatusPastDue:
+		return db.SubscriptionGrace, true
+	case stripe.StatusUnpaid, stripe.StatusIncomplete, stripe.StatusPaused:
+		return db.SubscriptionPastDue, false
+	default:
+		return db.SubscriptionExpired, false
+	}
+}
+
+// syncStripeSubscription records what Stripe says about a subscription in
+// the same table IAP purchases go to. The family is the one named in its
+// metadata, else parentEmail, else whoever already has it; a subscription
+// no family can be found for is skipped with a nil result.
+func (a *API) syncStripeSubscription(ctx context.Context, sub *stripe.Subscription, parentEmail string) (*db.Subscription, error) {
+	if e := sub.Metadata[stripe.MetadataParentEmail]; e != "" {
+		parentEmail = e
+	}
+	if parentEmail == "" {
+		cur, found, err := a.db.GetSubscription(ctx, db.SourceStripe, sub.ID)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			log.Printf("stripe: subscription %s has no family, skipped", sub.ID)
+			return nil, nil
+		}
+		parentEmail = cur.ParentEmail
+	}
+	status, autoRenew := stripeState(sub)
+	expires := sub.PeriodEnd()
+	if sub.Status == stripe.StatusCanceled && expires.After(time.Now()) {
+		expires = time.Now().UTC()
+	}
+	product := ""
+	if it := sub.Item(); it != nil {
+		product = it.Price.ID
+	}
+	out, err := a.db.UpsertSubscription(ctx, db.Subscription{
+		ParentEmail: parentEmail,
+		Source:      db.SourceStripe,
+		ExternalID:  sub.ID,
+		ProductID:   product,
+		Status:      status,
+		ExpiresAt:   expires.Format(time.RFC3339),
+		AutoRenew:   autoRenew,
+	})
+	if errors.Is(err, db.ErrSubscriptionOwned) {
+		log.Printf("stripe: subscription %s is another family's, not moved to %s", sub.ID, parentEmail)
+		return nil, nil
+	}
+	return out, err
+}
+
+// webSubscription is the family's Stripe subscription that still entitles
+// it, answering 404 itself when there is none.
+func (a *API) webSubscription(w http.ResponseWriter, r *http.Request, parentEmail string) (*db.Subscription, bool) {
+	sub, found, err := a.db.LatestSubscription(r.Context(), parentEmail, db.SourceStripe)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return nil, false
+	}
+	if !found || sub.Status == db.SubscriptionExpired || sub.Status == db.SubscriptionRevoked || sub.ExpiresAt <= time.Now().UTC().Format(time.RFC3339) {
+		writeError(w, http.StatusNotFound, "the family has no web subscription")
+		return nil, false
+	}
+	return sub, true
+}
+
+// writeStripeError answers a failed Stripe call: its 4xx answers are the
+// caller's problem, anything else a bad gateway worth retrying.
+func writeStripeError(w http.ResponseWriter, err error) {
+	var apiErr *stripe.APIError
+	if errors.As(err, &apiErr) && apiErr.Status >= 400 && apiErr.Status < 500 {
+		writeError(w, http.StatusUnprocessableEntity, apiErr.Message)
+		return
+	}
+	writeError(w, http.StatusBadGateway, err.Error())
+}
+
+// BillingCheckout starts a Stripe Checkout for a web subscription and
+// returns the page to send the parent to. The subscription itself is
+// recorded when Stripe's events come in.
+func (a *API) BillingCheckout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req billingCheckoutRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email is required")
+		return
+	}
+	sc, ok := stripeClient()
+	prices := config.StripePrices()
+	if !ok || len(prices) == 0 {
+		writeError(w, http.StatusServiceUnavailable, "web billing is not available")
+		return
+	}
+	price := req.PriceID
+	if price == "" {
+		price = prices[0]
+	}
+	if !slices.Contains(prices, price) {
+		writeError(w, http.StatusBadRequest, "unknown price_id")
+		return
+	}
+	ctx := r.Context()
+	p, found, err := a.db.GetParentByEmail(ctx, req.ParentEmail)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "parent not found")
+		return
+	}
+	if cur, found, err := a.db.LatestSubscription(ctx, p.Email, db.SourceStripe); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	} else if found && (cur.Status == db.SubscriptionActive || cur.Status == db.SubscriptionGrace) && cur.ExpiresAt > time.Now().UTC().Format(time.RFC3339) {
+		writeError(w, http.StatusConflict, "the family already has a web subscription; change or cancel it instead")
+		return
+	}
+	sess, err := sc.CreateCheckoutSession(ctx, stripe.CheckoutParams{
+		ParentEmail: strings.ToLower(p.Email),
+		PriceID:     price,
+		SuccessURL:  config.StripeSuccessURL(),
+		CancelURL:   config.StripeCancelURL(),
+	})
+	if err != nil {
+		writeStripeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"session_id": sess.ID, "checkout_url": sess.URL})
+}
+
+// ChangeBillingPlan switches the family's web subscription to another
+// price. Stripe invoices the prorated difference straight away.
+func (a *API) ChangeBillingPlan(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req changePlanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" || strings.TrimSpace(req.PriceID) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email and price_id are required")
+		return
+	}
+	sc, ok := stripeClient()
+	if !ok {
+		writeError(w, http.StatusServiceUnavailable, "web billing is not available")
+		return
+	}
+	if !slices.Contains(config.StripePrices(), req.PriceID) {
+		writeError(w, http.StatusBadRequest, "unknown price_id")
+		return
+	}
+	cur, ok := a.webSubscription(w, r, req.ParentEmail)
+	if !ok {
+		return
+	}
+	if cur.ProductID == req.PriceID {
+		writeError(w, http.StatusConflict, "the subscription is already on that price")
+		return
+	}
+	ctx := r.Context()
+	sub, err := sc.GetSubscription(ctx, cur.ExternalID)
+	if err == nil {
+		sub, err = sc.ChangePrice(ctx, sub, req.PriceID)
+	}
+	if err != nil {
+		writeStripeError(w, err)
+		return
+	}
+	out, err := a.syncStripeSubscription(ctx, sub, cur.ParentEmail)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// CancelBilling cancels the family's web subscription, at the end of the
+// paid period unless asked to end it now, or resumes one set to cancel.
+func (a *API) CancelBilling(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req cancelBillingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email is required")
+		return
+	}
+	if req.Immediately && req.Resume {
+		writeError(w, http.StatusBadRequest, "immediately and resume cannot both be set")
+		return
+	}
+	sc, ok := stripeClient()
+	if !ok {
+		writeError(w, http.StatusServiceUnavailable, "web billing is not available")
+		return
+	}
+	cur, ok := a.webSubscription(w, r, req.ParentEmail)
+	if !ok {
+		return
+	}
+	ctx := r.Context()
+	var sub *stripe.Subscription
+	var err error
+	if req.Resume {
+		sub, err = sc.Resume(ctx, cur.ExternalID)
+	} else {
+		sub, err = sc.Cancel(ctx, cur.ExternalID, req.Immediately)
+	}
+	if err != nil {
+		writeStripeError(w, err)
+		return
+	}
+	out, err := a.syncStripeSubscription(ctx, sub, cur.ParentEmail)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// StripeWebhook takes Stripe's signed events. Each is handled once; an
+// error answers 500 so Stripe delivers it again later.
+func (a *API) StripeWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	secret := config.StripeWebhookSecret()
+	sc, ok := stripeClient()
+	if secret == "" || !ok {
+		writeError(w, http.StatusServiceUnavailable, "web billing is not available")
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxStripeEventBytes))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	ev, err := stripe.ParseEvent(secret, r.Header.Get(stripe.SignatureHeader), body, config.StripeWebhookTolerance())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	ctx := r.Context()
+	if seen, err := a.db.StripeEventSeen(ctx, ev.ID); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	} else if seen {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "duplicate"})
+		return
+	}
+	if err := a.handleStripeEvent(ctx, sc, ev); err != nil {
+		log.Printf("stripe: event %s (%s): %v", ev.ID, ev.Type, err)
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := a.db.RecordStripeEvent(ctx, ev.ID, ev.Type); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// handleStripeEvent reconciles the subscription an event is about and
+// tells the family about what matters to them. Events can arrive out of
+// order, so the subscription is always fetched fresh rather than taken
+// from the event.
+func (a *API) handleStripeEvent(ctx context.Context, sc stripe.Client, ev *stripe.Event) error {
+	sync := func(subID, parentEmail string) (*db.Subscription, error) {
+		sub, err := sc.GetSubscription(ctx, subID)
+		if err != nil {
+			return nil, err
+		}
+		return a.syncStripeSubscription(ctx, sub, parentEmail)
+	}
+	switch ev.Type {
+	case "checkout.session.completed":
+		var sess stripe.CheckoutSession
+		if err := json.Unmarshal(ev.Data.Object, &sess); err != nil {
+			return err
+		}
+		if sess.Subscription == "" {
+			return nil
+		}
+		s, err := sync(sess.Subscription, sess.ClientReferenceID)
+		if err != nil || s == nil {
+			return err
+		}
+		a.billingNotice(ctx, "billing.subscription_started", s, nil,
+			"Welcome to Sona Premium",
+			"Thanks for subscribing. Premium features are unlocked for your family until "+day(s.ExpiresAt)+", and your subscription renews automatically.")
+
+	case "customer.subscription.created", "customer.subscription.updated", "customer.subscription.deleted":
+		var obj stripe.Subscription
+		if err := json.Unmarshal(ev.Data.Object, &obj); err != nil {
+			return err
+		}
+		s, err := sync(obj.ID, "")
+		if err != nil || s == nil {
+			return err
+		}
+		if ev.Type == "customer.subscription.deleted" {
+			a.billingNotice(ctx, "billing.subscription_ended", s, nil,
+				"Your Sona Premium subscription has ended",
+				"Your family is back on the free plan. You can subscribe again at any time.")
+			return nil
+		}
+		if ev.Type != "customer.subscription.updated" || len(ev.Data.PreviousAttributes) == 0 {
+			return nil
+		}
+		var prev struct {
+			CancelAtPeriodEnd *bool           `json:"cancel_at_period_end"`
+			Items             json.RawMessage `json:"items"`
+		}
+		if err := json.Unmarshal(ev.Data.PreviousAttributes, &prev); err != nil {
+			return err
+		}
+		switch {
+		case prev.CancelAtPeriodEnd != nil && obj.CancelAtPeriodEnd:
+			a.billingNotice(ctx, "billing.subscription_canceling", s, nil,
+				"Your Sona Premium subscription is canceled",
+				"It will not renew. Premium stays on until "+day(s.ExpiresAt)+".")
+		case prev.CancelAtPeriodEnd != nil:
+			a.billingNotice(ctx, "billing.subscription_resumed", s, nil, "", "")
+		}
+		if len(prev.Items) > 0 {
+			a.billingNotice(ctx, "billing.plan_changed", s, nil, "", "")
+		}
+
+	case "invoice.payment_failed", "invoice.paid":
+		var inv stripe.Invoice
+		if err := json.Unmarshal(ev.Data.Object, &inv); err != nil {
+			return err
+		}
+		if inv.SubscriptionID() == "" {
+			return nil
+		}
+		s, err := sync(inv.SubscriptionID(), "")
+		if err != nil || s == nil {
+			return err
+		}
+		detail := map[string]any{
+			"invoice_id":    inv.ID,
+			"amount":        money(inv.AmountDue, inv.Currency),
+			"attempt_count": inv.AttemptCount,
+			"invoice_url":   inv.HostedInvoiceURL,
+		}
+		switch {
+		case ev.Type == "invoice.payment_failed" && inv.NextPaymentAttempt > 0:
+			next := time.Unix(inv.NextPaymentAttempt, 0).UTC().Format("2006-01-02")
+			detail["next_attempt"] = next
+			a.billingNotice(ctx, "billing.payment_failed", s, detail,
+				"We couldn't take your Sona Premium payment",
+				fmt.Sprintf("Charging %s failed (attempt %d). We'll try again on %s; to keep premium, update your payment details at %s", money(inv.AmountDue, inv.Currency), inv.AttemptCount, next, inv.HostedInvoiceURL))
+		case ev.Type == "invoice.payment_failed":
+			a.billingNotice(ctx, "billing.payment_failed", s, detail,
+				"Last reminder: your Sona Premium payment failed",
+				fmt.Sprintf("We could not charge %s and will not try again. Pay at %s to keep premium.", money(inv.AmountDue, inv.Currency), inv.HostedInvoiceURL))
+		case inv.BillingReason == "subscription_update":
+			detail["amount"] = money(inv.AmountPaid, inv.Currency)
+			a.billingNotice(ctx, "billing.proration_invoiced", s, detail,
+				"Your Sona Premium plan changed",
+				fmt.Sprintf("You were charged %s for the rest of this billing period on the new plan. Invoice: %s", money(inv.AmountPaid, inv.Currency), inv.HostedInvoiceURL))
+		case inv.AttemptCount > 1:
+			detail["amount"] = money(inv.AmountPaid, inv.Currency)
+			a.billingNotice(ctx, "billing.payment_recovered", s, detail,
+				"Your Sona Premium payment went through",
+				"Thanks, your payment of "+money(inv.AmountPaid, inv.Currency)+" succeeded and premium continues.")
+		}
+	}
+	return nil
+}
+
+// billingNotice emits a billing event for the family and, when it has
+// copy, emails the parent about it too.
+func (a *API) billingNotice(ctx context.Context, eventType string, s *db.Subscription, detail map[string]any, subject, body string) {
+	payload := map[string]any{"subscription": s}
+	for k, v := range detail {
+		payload[k] = v
+	}
+	if _, err := a.notifier.Emit(ctx, eventType, s.ParentEmail, payload); err != nil {
+		log.Printf("stripe: emit %s failed: %v", eventType, err)
+	}
+	if subject != "" {
+		a.notifier.Email(ctx, s.ParentEmail, eventType, payload, subject, body)
+	}
+}
+
+// money formats an amount in the currency's minor unit, e.g. "4.99 EUR".
+func money(minor int64, currency string) string {
+	return fmt.Sprintf("%d.%02d %s", minor/100, minor%100, strings.ToUpper(currency))
+}
+
+// day is the date part of an RFC 3339 timestamp.
+func day(ts string) string {
+	d, _, _ := strings.Cut(ts, "T")
+	return d
+}
@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode"
+
+	"backend_mini/internal/config"
+	"backend_mini/internal/db"
+)
+
+// minChoreSimilarity is how alike two chore names must be for the older
+// bounty to count as evidence.
+const minChoreSimilarity = 0.5
+
+type suggestBountyRequest struct {
+	ParentEmail string `json:"parent_email"`
+	ChoreName   string `json:"chore_name"`
+	Age         int    `json:"age,omitempty"`
+}
+
+type bountySuggestion struct {
+	Suggested uint64          `json:"suggested"`
+	Min       uint64          `json:"min"`
+	Max       uint64          `json:"max"`
+	Basis     string          `json:"basis"`
+	Rationale bountyRationale `json:"rationale"`
+}
+
+type bountyRationale struct {
+	SimilarChores []similarChore      `json:"similar_chores"`
+	Baseline      *config.AgeBaseline `json:"baseline,omitempty"`
+	FamilyMedian  uint64              `json:"family_median,omitempty"`
+	HistorySize   int                 `json:"history_size"`
+}
+
+type similarChore struct {
+	ChoreID    string  `json:"chore_id"`
+	ChoreName  string  `json:"chore_name"`
+	Bounty     uint64  `json:"bounty_amount"`
+	Similarity float64 `json:"similarity"`
+}
+
+// SuggestBounty proposes a bounty for a new chore from the family's past
+// bounties on similarly named chores, falling back to the age baseline and
+// then to the family's median bounty.
+func (a *API) SuggestBounty(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req suggestBountyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" || strings.TrimSpace(req.ChoreName) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email and chore_name are required")
+		return
+	}
+	if req.Age < 0 || req.Age > 25 {
+		writeError(w, http.StatusBadRequest, "age must be between 0 and 25")
+		return
+	}
+	ctx := r.Context()
+	p, found, err := a.db.GetParentByEmail(ctx, req.ParentEmail)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "parent not found")
+		return
+	}
+	var bounties []uint64
+	out := bountySuggestion{Rationale: bountyRationale{SimilarChores: []similarChore{}}}
+	if p.Wallet != "" {
+		chores, err := a.db.GetChores(ctx, p.Wallet, db.ChoreFilter{})
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		for _, c := range chores {
+			if c.ParentWallet != p.Wallet || c.Kind == db.ChoreKindPenalty {
+				continue
+			}
+			bounties = append(bounties, c.BountyAmount)
+			if sim := choreSimilarity(req.ChoreName, c.ChoreName); sim >= minChoreSimilarity {
+				out.Rationale.SimilarChores = append(out.Rationale.SimilarChores, similarChore{ChoreID: c.ChoreID, ChoreName: c.ChoreName, Bounty: c.BountyAmount, Similarity: sim})
+			}
+		}
+	}
+	out.Rationale.HistorySize = len(bounties)
+	if len(bounties) > 0 {
+		out.Rationale.FamilyMedian = median(bounties)
+	}
+	sort.Slice(out.Rationale.SimilarChores, func(i, j int) bool {
+		return out.Rationale.SimilarChores[i].Similarity > out.Rationale.SimilarChores[j].Similarity
+	})
+	if req.Age > 0 {
+		b := ageBaseline(req.Age)
+		out.Rationale.Baseline = &b
+	}
+
+	switch {
+	case len(out.Rationale.SimilarChores) > 0:
+		// similarity-weighted mean, bounded by what was actually paid
+		var sum, weights float64
+		out.Min, out.Max = ^uint64(0), 0
+		for _, s := range out.Rationale.SimilarChores {
+			sum += float64(s.Bounty) * s.Similarity
+			weights += s.Similarity
+			out.Min = min(out.Min, s.Bounty)
+			out.Max = max(out.Max, s.Bounty)
+		}
+		out.Suggested, out.Basis = uint64(sum/weights), "similar_chores"
+	case out.Rationale.Baseline != nil:
+		out.Suggested, out.Basis = out.Rationale.Baseline.Amount, "age_baseline"
+	case out.Rationale.FamilyMedian > 0:
+		out.Suggested, out.Basis = out.Rationale.FamilyMedian, "family_median"
+	default:
+		out.Suggested, out.Basis = config.BountyBaselines()[0].Amount, "default"
+	}
+	if out.Basis != "similar_chores" {
+		out.Min, out.Max = out.Suggested*3/4, out.Suggested*5/4
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func ageBaseline(age int) config.AgeBaseline {
+	baselines := config.BountyBaselines()
+	b := baselines[0]
+	for _, c := range baselines {
+		if age >= c.MinAge {
+			b = c
+		}
+	}
+	return b
+}
+
+func median(v []uint64) uint64 {
+	s := append([]uint64(nil), v...)
+	sort.Slice(s, func(i, j int) bool { return s[i] < s[j] })
+	if len(s)%2 == 1 {
+		return s[len(s)/2]
+	}
+	return (s[len(s)/2-1] + s[len(s)/2]) / 2
+}
+
+// choreSimilarity scores two chore names in [0, 1]: the better of word
+// overlap (so "wash the dishes" matches "dishes") and edit distance (so
+// typos and plurals still match).
+func choreSimilarity(a, b string) float64 {
+	wa, wb := choreWords(a), choreWords(b)
+	if len(wa) == 0 || len(wb) == 0 {
+		return 0
+	}
+	shared := 0
+	for w := range wa {
+		if wb[w] {
+			shared++
+		}
+	}
+	jaccard := float64(shared) / float64(len(wa)+len(wb)-shared)
+	na, nb := strings.Join(sortedKeys(wa), " "), strings.Join(sortedKeys(wb), " ")
+	longest := max(len([]rune(na)), len([]rune(nb)))
+	edit := 1 - float64(levenshtein(na, nb))/float64(longest)
+	return float64(int(max(jaccard, edit)*100)) / 100
+}
+
+var choreStopWords = map[string]bool{"the": true, "a": true, "an": true, "and": true, "my": true, "your": true, "of": true, "to": true, "up": true}
+
+func choreWords(s string) map[string]bool {
+	out := map[string]bool{}
+	for _, w := range strings.FieldsFunc(strings.ToLower(s), func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }) {
+		if !choreStopWords[w] {
+			out[strings.TrimSuffix(w, "s")] = true
+		}
+	}
+	return out
+}
+
+func sortedKeys(m map[string]bool) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur := make([]int, len(rb)+1)
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(rb)]
+}
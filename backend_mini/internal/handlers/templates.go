@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"backend_mini/internal/db"
+	"backend_mini/internal/notify"
+	"backend_mini/internal/relay"
+	"backend_mini/internal/webhook"
+)
+
+const (
+	maxTemplateTitle = 200
+	maxTemplateBody  = 4000
+)
+
+var templateChannels = map[string]bool{db.ChannelPush: true, db.ChannelEmail: true}
+
+type listTemplatesRequest struct {
+	Name    string `json:"name,omitempty"`
+	Channel string `json:"channel,omitempty"`
+}
+
+type saveTemplateRequest struct {
+	Name      string `json:"name"`
+	Channel   string `json:"channel"`
+	Title     string `json:"title,omitempty"`
+	Body      string `json:"body"`
+	CreatedBy string `json:"created_by"`
+}
+
+type previewTemplateRequest struct {
+	Name    string `json:"name"`
+	Channel string `json:"channel"`
+	// Version 0 previews the active version.
+	Version int             `json:"version,omitempty"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+type promoteTemplateRequest struct {
+	Name       string `json:"name"`
+	Channel    string `json:"channel"`
+	Version    int    `json:"version"`
+	PromotedBy string `json:"promoted_by"`
+}
+
+// ListTemplates returns message template versions, newest first.
+func (a *API) ListTemplates(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req listTemplatesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	out, err := a.db.ListTemplates(r.Context(), strings.TrimSpace(req.Name), strings.TrimSpace(req.Channel))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// SaveTemplate stores new copy as the next version of a template. It does
+// not go out until the version is promoted.
+func (a *API) SaveTemplate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req saveTemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	t := &db.MessageTemplate{Name: strings.TrimSpace(req.Name), Channel: strings.TrimSpace(req.Channel),
+		Title: strings.TrimSpace(req.Title), Body: strings.TrimSpace(req.Body), CreatedBy: strings.TrimSpace(req.CreatedBy)}
+	if t.Name == "" || t.Body == "" || t.CreatedBy == "" {
+		writeError(w, http.StatusBadRequest, "name, body and created_by are required")
+		return
+	}
+	if !templateChannels[t.Channel] {
+		writeError(w, http.StatusBadRequest, "channel must be push or email")
+		return
+	}
+	if len(t.Title) > maxTemplateTitle || len(t.Body) > maxTemplateBody {
+		writeError(w, http.StatusBadRequest, "title is limited to 200 bytes and body to 4000")
+		return
+	}
+	if err := a.db.SaveTemplate(r.Context(), t); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, t)
+}
+
+// PreviewTemplate renders a template version against sample event data,
+// listing any placeholders the data leaves empty.
+func (a *API) PreviewTemplate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req previewTemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.Name) == "" || strings.TrimSpace(req.Channel) == "" {
+		writeError(w, http.StatusBadRequest, "name and channel are required")
+		return
+	}
+	t, found, err := a.db.GetTemplate(r.Context(), req.Name, req.Channel, req.Version)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, db.ErrTemplateNotFound.Error())
+		return
+	}
+	var data any = map[string]any{}
+	if len(req.Data) > 0 {
+		if err := json.Unmarshal(req.Data, &data); err != nil {
+			writeError(w, http.StatusBadRequest, "data must be valid json")
+			return
+		}
+	}
+	ev := webhook.Event{Type: t.Name, CreatedAt: time.Now().UTC().Format(time.RFC3339), Data: data}
+	rendered, err := notify.RenderTemplate(t, ev)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	unresolved, err := relay.Unresolved(notify.TemplateFields(t), ev)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"template":   t,
+		"rendered":   rendered,
+		"unresolved": unresolved,
+	})
+}
+
+// PromoteTemplate makes a version the one that goes out. Promoting an
+// earlier version rolls a copy change back.
+func (a *API) PromoteTemplate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req promoteTemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.Name) == "" || strings.TrimSpace(req.Channel) == "" || req.Version <= 0 || strings.TrimSpace(req.PromotedBy) == "" {
+		writeError(w, http.StatusBadRequest, "name, channel, version and promoted_by are required")
+		return
+	}
+	t, err := a.db.PromoteTemplate(r.Context(), req.Name, req.Channel, req.Version, req.PromotedBy)
+	if errors.Is(err, db.ErrTemplateNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, t)
+}
@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"net/http"
+
+	"backend_mini/internal/db"
+)
+
+// ChoreTimeline serves GET /chore/{id}/timeline: every step of the chore's
+// history in order, so both apps render the same view.
+func (a *API) ChoreTimeline(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	ctx := r.Context()
+	chore, found, err := a.db.GetChore(ctx, r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "chore not found")
+		return
+	}
+	entries, err := a.db.ChoreTimeline(ctx, chore.ChoreID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, struct {
+		Chore    *db.Chore       `json:"chore"`
+		Timeline []db.ChoreEntry `json:"timeline"`
+	}{chore, entries})
+}
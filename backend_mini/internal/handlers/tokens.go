@@ -0,0 +1,307 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend_mini/internal/config"
+	"backend_mini/internal/db"
+	"backend_mini/internal/middleware"
+)
+
+// Scopes a personal access token can carry.
+const (
+	ScopeChoresRead  = "chores:read"
+	ScopeChoresWrite = "chores:write"
+	ScopeLimitsRead  = "limits:read"
+	ScopeLimitsWrite = "limits:write"
+	ScopeEventsRead  = "events:read"
+)
+
+var validScopes = map[string]bool{
+	ScopeChoresRead:  true,
+	ScopeChoresWrite: true,
+	ScopeLimitsRead:  true,
+	ScopeLimitsWrite: true,
+	ScopeEventsRead:  true,
+}
+
+const (
+	defaultTokenDays = 90
+	maxTokenDays     = 365
+)
+
+type createTokenRequest struct {
+	ParentEmail   string   `json:"parent_email"`
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expires_in_days,omitempty"`
+}
+
+type tokenRequest struct {
+	ParentEmail string `json:"parent_email"`
+	TokenID     string `json:"token_id,omitempty"`
+}
+
+func (a *API) CreateToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req createTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" || strings.TrimSpace(req.Name) == "" || len(req.Scopes) == 0 {
+		writeError(w, http.StatusBadRequest, "parent_email, name and scopes are required")
+		return
+	}
+	seen := map[string]bool{}
+	scopes := []string{}
+	for _, s := range req.Scopes {
+		if !validScopes[s] {
+			writeError(w, http.StatusBadRequest, "unknown scope "+s)
+			return
+		}
+		if !seen[s] {
+			seen[s] = true
+			scopes = append(scopes, s)
+		}
+	}
+	days := req.ExpiresInDays
+	if days == 0 {
+		days = defaultTokenDays
+	}
+	if days < 1 || days > maxTokenDays {
+		writeError(w, http.StatusBadRequest, "expires_in_days must be between 1 and 365")
+		return
+	}
+	ctx := r.Context()
+	if _, found, err := a.db.GetParentByEmail(ctx, req.ParentEmail); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	} else if !found {
+		writeError(w, http.StatusNotFound, "parent not found")
+		return
+	}
+	t, raw, err := a.db.CreateAPIToken(ctx, req.ParentEmail, strings.TrimSpace(req.Name), scopes, time.Duration(days)*24*time.Hour)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	// the raw token is only ever shown here
+	writeJSON(w, http.StatusOK, map[string]any{"token": raw, "details": t})
+}
+
+func (a *API) ListTokens(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req tokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email is required")
+		return
+	}
+	tokens, err := a.db.ListAPITokens(r.Context(), req.ParentEmail)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, tokens)
+}
+
+func (a *API) RevokeToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req tokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" || strings.TrimSpace(req.TokenID) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email and token_id are required")
+		return
+	}
+	if err := a.db.RevokeAPIToken(r.Context(), req.ParentEmail, req.TokenID); err != nil {
+		if errors.Is(err, db.ErrTokenNotFound) {
+			writeError(w, http.StatusNotFound, "no active token with that id")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "revoked"})
+}
+
+// PersonalToken lets a parent's access token call a route that needs scope.
+// Besides the scope it checks that every identity in the body (parent,
+// kids, wallets, chores, overrides) belongs to the token's parent, and it
+// rate limits each token separately from the app key.
+func (a *API) PersonalToken(scope string) middleware.TokenCheck {
+	return a.personalToken(scope, bodyFields)
+}
+
+// PersonalTokenPath is PersonalToken for a route that names what it acts
+// on in its path rather than its body: the {id} wildcard is checked as the
+// body field named field would be, and the body is not read.
+func (a *API) PersonalTokenPath(scope, field string) middleware.TokenCheck {
+	return a.personalToken(scope, func(r *http.Request) (map[string]any, int, string) {
+		return map[string]any{field: r.PathValue("id")}, 0, ""
+	})
+}
+
+func (a *API) personalToken(scope string, identities func(r *http.Request) (map[string]any, int, string)) middleware.TokenCheck {
+	return func(w http.ResponseWriter, r *http.Request, raw string) bool {
+		if !strings.HasPrefix(raw, db.TokenPrefix) {
+			writeError(w, http.StatusUnauthorized, "unauthorized")
+			return false
+		}
+		ctx := r.Context()
+		t, err := a.db.LookupAPIToken(ctx, raw, time.Now())
+		if errors.Is(err, db.ErrTokenNotFound) {
+			writeError(w, http.StatusUnauthorized, "unauthorized")
+			return false
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return false
+		}
+		if ok, retry := a.tokenLimits.Allow(t.TokenID, config.TokenRatePerMinute(), time.Now()); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(retry))
+			writeError(w, http.StatusTooManyRequests, "rate limit exceeded for this token")
+			return false
+		}
+		if !t.HasScope(scope) {
+			writeError(w, http.StatusForbidden, "token lacks scope "+scope)
+			return false
+		}
+		fields, status, msg := identities(r)
+		if status == 0 {
+			status, msg = a.tokenOwns(ctx, t, fields)
+		}
+		if status != 0 {
+			writeError(w, status, msg)
+			return false
+		}
+		if err := a.db.TouchAPIToken(ctx, t.TokenID); err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return false
+		}
+		return true
+	}
+}
+
+// bodyFields peeks at the JSON body, restoring it for the handler.
+func bodyFields(r *http.Request) (map[string]any, int, string) {
+	raw, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, http.StatusBadRequest, "failed reading body"
+	}
+	r.Body = io.NopCloser(bytes.NewReader(raw))
+	var fields map[string]any
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, http.StatusBadRequest, "invalid json"
+	}
+	return fields, 0, ""
+}
+
+// tokenOwns returns a non-zero status when fields refer to anything
+// outside the token's family, or to nothing that ties them to the family
+// at all.
+func (a *API) tokenOwns(ctx context.Context, t *db.APIToken, fields map[string]any) (int, string) {
+	str := func(k string) (string, bool) {
+		v, ok := fields[k].(string)
+		return v, ok && v != ""
+	}
+
+	p, found, err := a.db.GetParentByEmail(ctx, t.ParentEmail)
+	if err != nil {
+		return http.StatusInternalServerError, err.Error()
+	}
+	if !found {
+		return http.StatusForbidden, "token owner no longer exists"
+	}
+	kids, err := a.db.ListKids(ctx, p.ID)
+	if err != nil {
+		return http.StatusInternalServerError, err.Error()
+	}
+	wallets := map[string]bool{}
+	kidEmails := map[string]bool{}
+	if p.Wallet != "" {
+		wallets[p.Wallet] = true
+	}
+	for _, k := range kids {
+		kidEmails[strings.ToLower(k.Email)] = true
+		if k.Wallet != "" {
+			wallets[k.Wallet] = true
+		}
+	}
+
+	const denied = "token cannot act outside its family"
+	anchored := false
+	if v, ok := str("parent_email"); ok {
+		if !strings.EqualFold(v, p.Email) {
+			return http.StatusForbidden, denied
+		}
+		anchored = true
+	}
+	if v, ok := str("kid_email"); ok {
+		if !kidEmails[strings.ToLower(v)] {
+			return http.StatusForbidden, denied
+		}
+		anchored = true
+	}
+	if v, ok := str("parent_wallet"); ok {
+		if p.Wallet == "" || v != p.Wallet {
+			return http.StatusForbidden, denied
+		}
+		anchored = true
+	}
+	for _, k := range []string{"child_wallet", "wallet"} {
+		if v, ok := str(k); ok {
+			if !wallets[v] {
+				return http.StatusForbidden, denied
+			}
+			anchored = true
+		}
+	}
+	if v, ok := str("chore_id"); ok {
+		owner, found, err := a.db.GetChoreParentWallet(ctx, v)
+		if err != nil {
+			return http.StatusInternalServerError, err.Error()
+		}
+		if !found || p.Wallet == "" || owner != p.Wallet {
+			return http.StatusForbidden, denied
+		}
+		anchored = true
+	}
+	if v, ok := str("override_id"); ok {
+		owner, found, err := a.db.GetOverrideParentEmail(ctx, v)
+		if err != nil {
+			return http.StatusInternalServerError, err.Error()
+		}
+		if !found || !strings.EqualFold(owner, p.Email) {
+			return http.StatusForbidden, denied
+		}
+		anchored = true
+	}
+	if !anchored {
+		return http.StatusForbidden, denied
+	}
+	return 0, ""
+}
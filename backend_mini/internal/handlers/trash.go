@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"backend_mini/internal/db"
+)
+
+type deleteChoreRequest struct {
+	ParentEmail string `json:"parent_email"`
+	ChoreID     string `json:"chore_id"`
+}
+
+type deleteLimitRequest struct {
+	ParentEmail string `json:"parent_email"`
+	LimitID     string `json:"limit_id"`
+}
+
+type trashRequest struct {
+	ParentEmail string `json:"parent_email"`
+}
+
+type restoreRequest struct {
+	ParentEmail string `json:"parent_email"`
+	TrashID     string `json:"trash_id"`
+}
+
+// DeleteChore moves a chore that has not been approved to the trash.
+func (a *API) DeleteChore(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req deleteChoreRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" || strings.TrimSpace(req.ChoreID) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email and chore_id are required")
+		return
+	}
+	ctx := r.Context()
+	p, found, err := a.db.GetParentByEmail(ctx, req.ParentEmail)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "parent not found")
+		return
+	}
+	t, err := a.db.DeleteChore(ctx, req.ChoreID, p.Email, p.Wallet)
+	switch {
+	case errors.Is(err, db.ErrChoreNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, db.ErrChoreSettled):
+		writeError(w, http.StatusConflict, err.Error())
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	default:
+		writeJSON(w, http.StatusOK, t)
+	}
+}
+
+// DeleteLimit moves one of the parent's app limits to the trash.
+func (a *API) DeleteLimit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req deleteLimitRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" || strings.TrimSpace(req.LimitID) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email and limit_id are required")
+		return
+	}
+	t, err := a.db.DeleteAppLimit(r.Context(), req.LimitID, req.ParentEmail)
+	if errors.Is(err, db.ErrLimitNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, t)
+}
+
+// Trash lists what the family deleted that can still be restored.
+func (a *API) Trash(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req trashRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email is required")
+		return
+	}
+	items, err := a.db.ListTrash(r.Context(), req.ParentEmail, time.Now())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, items)
+}
+
+// Restore puts a trashed chore or limit back as it was.
+func (a *API) Restore(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req restoreRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" || strings.TrimSpace(req.TrashID) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email and trash_id are required")
+		return
+	}
+	t, err := a.db.Restore(r.Context(), req.ParentEmail, req.TrashID, time.Now())
+	if quotaExceeded(w, err) {
+		return
+	}
+	switch {
+	case errors.Is(err, db.ErrTrashNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, db.ErrRestoreBlocked):
+		writeError(w, http.StatusConflict, err.Error())
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	default:
+		writeJSON(w, http.StatusOK, t)
+	}
+}
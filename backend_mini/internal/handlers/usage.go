@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"backend_mini/internal/config"
+	"backend_mini/internal/db"
+)
+
+const maxUsageRange = 92
+
+type usageLine struct {
+	DeviceID string `json:"device_id"`
+	App      string `json:"app"`
+	Day      string `json:"day"`
+	Minutes  *int   `json:"minutes"`
+	Seq      uint64 `json:"seq,omitempty"`
+}
+
+type usageResult struct {
+	Line   int    `json:"line"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type getUsageRequest struct {
+	ParentEmail string `json:"parent_email"`
+	KidEmail    string `json:"kid_email"`
+	From        string `json:"from,omitempty"`
+	To          string `json:"to,omitempty"`
+}
+
+// ReportUsage ingests a batch of NDJSON usage records, one
+// {"device_id","app","day","minutes","seq"?} object per line, optionally
+// sent with Content-Encoding: gzip. A device that numbers its records has
+// replays reported as duplicates and records too far out of order as stale. Every line gets its own result; valid lines are
+// stored even when others are rejected. A batch signed by a device (see
+// DeviceSigned) may only report for that device.
+func (a *API) ReportUsage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	signer, ok := signingDevice(w, r)
+	if !ok {
+		return
+	}
+	maxBytes := config.UsageMaxBatchBytes()
+	var body io.Reader = r.Body
+	if strings.EqualFold(r.Header.Get("Content-Encoding"), "gzip") {
+		zr, err := gzip.NewReader(http.MaxBytesReader(w, r.Body, maxBytes))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid gzip body")
+			return
+		}
+		defer zr.Close()
+		body = zr
+	}
+	// +1 so an oversized body is detected rather than silently truncated
+	raw, err := io.ReadAll(io.LimitReader(body, maxBytes+1))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "failed reading body: "+err.Error())
+		return
+	}
+	if int64(len(raw)) > maxBytes {
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("batch exceeds %d bytes", maxBytes))
+		return
+	}
+
+	maxRecords := config.UsageMaxBatchRecords()
+	var (
+		results []usageResult
+		records []db.UsageRecord
+		index   []int // results index of each record
+	)
+	devices := map[string]*db.Device{}
+	sc := bufio.NewScanner(strings.NewReader(string(raw)))
+	sc.Buffer(make([]byte, 64*1024), int(maxBytes)+1)
+	ctx := r.Context()
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		if len(results) >= maxRecords {
+			writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("batch exceeds %d records", maxRecords))
+			return
+		}
+		res := usageResult{Line: n}
+		rec, msg := a.parseUsageLine(r, line, signer, devices)
+		if msg != "" {
+			res.Status, res.Error = "rejected", msg
+		} else {
+			records = append(records, rec)
+			index = append(index, len(results))
+		}
+		results = append(results, res)
+	}
+	if err := sc.Err(); err != nil {
+		writeError(w, http.StatusBadRequest, "failed reading body: "+err.Error())
+		return
+	}
+	if len(results) == 0 {
+		writeError(w, http.StatusBadRequest, "batch is empty")
+		return
+	}
+	statuses, err := a.db.UpsertUsage(ctx, records)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	counts := map[string]int{}
+	var stored []db.UsageRecord
+	for i, st := range statuses {
+		results[index[i]].Status = st
+		if st == db.UsageStored {
+			stored = append(stored, records[i])
+		}
+	}
+	a.detectNewApps(ctx, stored, devices)
+	for _, res := range results {
+		counts[res.Status]++
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"received": len(results),
+		"counts":   counts,
+		"results":  results,
+	})
+}
+
+// parseUsageLine validates one record; msg is non-empty when it is rejected.
+// A signed batch may only carry records of the device that signed it.
+func (a *API) parseUsageLine(r *http.Request, line string, signer *db.Device, devices map[string]*db.Device) (rec db.UsageRecord, msg string) {
+	var in usageLine
+	if err := json.Unmarshal([]byte(line), &in); err != nil {
+		return rec, "invalid json"
+	}
+	if in.DeviceID == "" || strings.TrimSpace(in.App) == "" || in.Day == "" || in.Minutes == nil {
+		return rec, "device_id, app, day and minutes are required"
+	}
+	day, err := time.Parse("2006-01-02", in.Day)
+	if err != nil {
+		return rec, "day must be YYYY-MM-DD"
+	}
+	// allow a day of clock skew; old days are fine (offline devices)
+	if day.After(time.Now().UTC().AddDate(0, 0, 1)) {
+		return rec, "day is in the future"
+	}
+	if *in.Minutes < 0 || *in.Minutes > 24*60 {
+		return rec, "minutes must be between 0 and 1440"
+	}
+	if signer != nil && in.DeviceID != signer.DeviceID {
+		return rec, "device_id is not the device that signed the batch"
+	}
+	dev, seen := devices[in.DeviceID]
+	if !seen {
+		d, found, err := a.db.GetDevice(r.Context(), in.DeviceID)
+		if err == nil && found && d.UnpairedAt == "" {
+			dev = d
+		}
+		devices[in.DeviceID] = dev
+	}
+	if dev == nil {
+		return rec, "device not paired"
+	}
+	return db.UsageRecord{DeviceID: dev.DeviceID, KidEmail: dev.KidEmail, App: strings.TrimSpace(in.App), Day: in.Day, Minutes: *in.Minutes, Seq: in.Seq}, ""
+}
+
+// GetUsage returns a kid's daily usage per app, summed over their devices.
+func (a *API) GetUsage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req getUsageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" || strings.TrimSpace(req.KidEmail) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email and kid_email are required")
+		return
+	}
+	to, err := parseDay(req.To)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "to must be YYYY-MM-DD")
+		return
+	}
+	from := to.AddDate(0, 0, -6)
+	if req.From != "" {
+		if from, err = time.Parse("2006-01-02", req.From); err != nil {
+			writeError(w, http.StatusBadRequest, "from must be YYYY-MM-DD")
+			return
+		}
+	}
+	if from.After(to) || to.Sub(from) > maxUsageRange*24*time.Hour {
+		writeError(w, http.StatusBadRequest, "from must be before to and at most 92 days earlier")
+		return
+	}
+	if _, ok := a.kidOfParent(w, r, req.ParentEmail, req.KidEmail); !ok {
+		return
+	}
+	// longer histories are advanced analytics
+	if to.Sub(from) > time.Duration(config.FreeUsageRangeDays())*24*time.Hour && !a.requireEntitlement(w, r, req.ParentEmail, db.EntitlementAdvancedAnalytics) {
+		return
+	}
+	usage, err := a.db.GetUsage(r.Context(), req.KidEmail, from.Format("2006-01-02"), to.Format("2006-01-02"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := a.withUsageAppInfo(r.Context(), usage); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, usage)
+}
@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"backend_mini/internal/middleware"
+)
+
+// v1Error is a translation failure answered before the legacy route runs.
+type v1Error struct {
+	status int
+	msg    string
+}
+
+func (e *v1Error) Error() string { return e.msg }
+
+// V1 serves the versioned API under /v1/ in front of next, the legacy
+// routes. Each /v1 route is dispatched on method and path, then rewritten
+// into the POST and JSON body of the legacy route that implements it and
+// handed to next, so both revisions share one implementation and the same
+// policy, kill switch and shedding checks. A known path with the wrong
+// method answers 405 with an Allow header. Other paths pass straight
+// through to next. /v1 takes the app token as bearer.
+func (a *API) V1(appToken string, next http.Handler) http.Handler {
+	mux := http.NewServeMux()
+	route := func(pattern, legacyPath string, body func(r *http.Request) (any, error)) {
+		mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+			a.toLegacy(w, r, next, legacyPath, body)
+		})
+	}
+
+	route("POST /v1/parents", "/get_parent", func(r *http.Request) (any, error) {
+		req, err := v1Body(r)
+		if err != nil {
+			return nil, err
+		}
+		email, _ := req["email"].(string)
+		if name, _ := req["name"].(string); strings.TrimSpace(email) == "" || strings.TrimSpace(name) == "" {
+			return nil, &v1Error{http.StatusBadRequest, "email and name are required"}
+		}
+		delete(req, "upd")
+		return req, nil
+	})
+	route("GET /v1/parents/{id}", "/get_parent", func(r *http.Request) (any, error) {
+		p, err := a.v1Parent(r)
+		if err != nil {
+			return nil, err
+		}
+		return parentRequest{Email: p}, nil
+	})
+	route("PATCH /v1/parents/{id}", "/get_parent", func(r *http.Request) (any, error) {
+		email, err := a.v1Parent(r)
+		if err != nil {
+			return nil, err
+		}
+		req, err := v1Body(r)
+		if err != nil {
+			return nil, err
+		}
+		req["email"], req["upd"] = email, true
+		return req, nil
+	})
+	route("GET /v1/parents/{id}/children", "/list_kids", func(r *http.Request) (any, error) {
+		req := listKidsRequest{ParentID: r.PathValue("id")}
+		if fields := r.URL.Query().Get("fields"); fields != "" {
+			req.Fields = strings.Split(fields, ",")
+		}
+		return req, nil
+	})
+
+	route("POST /v1/children", "/get_child", func(r *http.Request) (any, error) {
+		req, err := v1Body(r)
+		if err != nil {
+			return nil, err
+		}
+		delete(req, "upd")
+		return req, nil
+	})
+	route("GET /v1/children/{id}", "/get_child", func(r *http.Request) (any, error) {
+		email, err := a.v1Child(r)
+		if err != nil {
+			return nil, err
+		}
+		return childRequest{Email: email}, nil
+	})
+	route("PATCH /v1/children/{id}", "/get_child", func(r *http.Request) (any, error) {
+		email, err := a.v1Child(r)
+		if err != nil {
+			return nil, err
+		}
+		req, err := v1Body(r)
+		if err != nil {
+			return nil, err
+		}
+		delete(req, "shared")
+		req["email"], req["upd"] = email, true
+		return req, nil
+	})
+
+	route("GET /v1/chores", "/get_chores", func(r *http.Request) (any, error) {
+		q := r.URL.Query()
+		req := getChoresRequest{Wallet: q.Get("wallet"), DueFrom: q.Get("due_from"), DueTo: q.Get("due_to"), Kind: q.Get("kind")}
+		for _, s := range q["status"] {
+			n, err := strconv.Atoi(s)
+			if err != nil {
+				return nil, &v1Error{http.StatusBadRequest, "status must be a number"}
+			}
+			req.Statuses = append(req.Statuses, n)
+		}
+		return req, nil
+	})
+	route("POST /v1/chores", "/create_chore", func(r *http.Request) (any, error) {
+		return v1Body(r)
+	})
+	route("PATCH /v1/chores/{id}", "/update_chore", func(r *http.Request) (any, error) {
+		req, err := v1Body(r)
+		if err != nil {
+			return nil, err
+		}
+		req["chore_id"] = r.PathValue("id")
+		return req, nil
+	})
+	route("GET /v1/chores/{id}/timeline", "/chore/{id}/timeline", nil)
+
+	// ids are resolved before the legacy route's own auth runs
+	v1 := middleware.RequireBearer(appToken, mux)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v1/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		v1.ServeHTTP(w, r)
+	})
+}
+
+// toLegacy rewrites r into a POST of body to legacyPath and serves it with
+// next. With a nil body, r is forwarded as it is, only to legacyPath.
+// "{id}" in legacyPath is filled in from the /v1 path.
+func (a *API) toLegacy(w http.ResponseWriter, r *http.Request, next http.Handler, legacyPath string, body func(r *http.Request) (any, error)) {
+	var raw []byte
+	if body != nil {
+		b, err := body(r)
+		var ve *v1Error
+		if errors.As(err, &ve) {
+			writeError(w, ve.status, ve.msg)
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if raw, err = json.Marshal(b); err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	r2 := r.Clone(r.Context())
+	r2.URL.Path = strings.ReplaceAll(legacyPath, "{id}", r.PathValue("id"))
+	r2.URL.RawPath, r2.URL.RawQuery, r2.RequestURI, r2.Pattern = "", "", r2.URL.Path, ""
+	if body != nil {
+		r2.Method = http.MethodPost
+		r2.Body, r2.ContentLength = io.NopCloser(bytes.NewReader(raw)), int64(len(raw))
+		r2.Header.Set("Content-Type", "application/json")
+	}
+	next.ServeHTTP(w, r2)
+}
+
+// v1Body decodes a JSON object body; an empty body is an empty object.
+func v1Body(r *http.Request) (map[string]any, error) {
+	req := map[string]any{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		return nil, &v1Error{http.StatusBadRequest, "invalid json"}
+	}
+	return req, nil
+}
+
+// v1Parent resolves the {id} of a /v1/parents path to the email the
+// legacy routes key parents by.
+func (a *API) v1Parent(r *http.Request) (string, error) {
+	p, found, err := a.db.GetParentByID(r.Context(), r.PathValue("id"))
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return "", &v1Error{http.StatusNotFound, "parent not found"}
+	}
+	return p.Email, nil
+}
+
+func (a *API) v1Child(r *http.Request) (string, error) {
+	c, found, err := a.db.GetChildByID(r.Context(), r.PathValue("id"))
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return "", &v1Error{http.StatusNotFound, "kid not found"}
+	}
+	return c.Email, nil
+}
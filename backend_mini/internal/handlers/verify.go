@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+
+	"backend_mini/internal/db"
+	"backend_mini/internal/util"
+)
+
+type verifySignedRequest struct {
+	TransferID string `json:"transfer_id"`
+	Signed     string `json:"signed"`
+}
+
+// verifyProblem is one reason a signed transaction should not be submitted,
+// with a stable code clients can act on.
+type verifyProblem struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type verifySignedResponse struct {
+	TransferID string          `json:"transfer_id"`
+	Valid      bool            `json:"valid"`
+	Errors     []verifyProblem `json:"errors"`
+	Warnings   []verifyProblem `json:"warnings,omitempty"`
+}
+
+// VerifySigned checks a client-signed transaction against the build recorded
+// in the ledger before it is submitted: signatures, fee payer, message and
+// blockhash. Every problem found is listed, not just the first.
+func (a *API) VerifySigned(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req verifySignedRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.TransferID) == "" || strings.TrimSpace(req.Signed) == "" {
+		writeError(w, http.StatusBadRequest, "transfer_id and signed are required")
+		return
+	}
+	tx, err := solana.TransactionFromBase64(strings.TrimSpace(req.Signed))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid transaction: "+err.Error())
+		return
+	}
+	ctx := r.Context()
+	t, found, err := a.db.GetTransfer(ctx, req.TransferID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "transfer not found")
+		return
+	}
+
+	resp := verifySignedResponse{TransferID: t.TransferID, Errors: []verifyProblem{}}
+	fail := func(code, format string, args ...any) {
+		resp.Errors = append(resp.Errors, verifyProblem{Code: code, Message: fmt.Sprintf(format, args...)})
+	}
+	warn := func(code, format string, args ...any) {
+		resp.Warnings = append(resp.Warnings, verifyProblem{Code: code, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if t.Status == db.TransferSuperseded {
+		fail("transfer_superseded", "transfer was rebuilt as %s; sign that one instead", t.SupersededBy)
+	}
+	signers := tx.Message.Signers()
+	if len(signers) == 0 || signers[0].String() != t.FromWallet {
+		fail("fee_payer_mismatch", "fee payer must be %s", t.FromWallet)
+	}
+
+	if t.MessageHash == "" {
+		warn("message_unchecked", "transfer was built before message hashes were recorded")
+	} else {
+		hash, err := util.MessageHash(tx, blockhashOverride(t))
+		if err != nil {
+			fail("invalid_transaction", "%v", err)
+		} else if hash != t.MessageHash {
+			fail("message_altered", "transaction differs from the one built for this transfer")
+		}
+	}
+
+	msg, err := tx.Message.MarshalBinary()
+	if err != nil {
+		fail("invalid_transaction", "failed to serialize message: %v", err)
+	} else {
+		for i, signer := range signers {
+			switch {
+			case i >= len(tx.Signatures) || tx.Signatures[i].IsZero():
+				fail("missing_signature", "no signature from %s", signer)
+			case !tx.Signatures[i].Verify(signer, msg):
+				fail("invalid_signature", "signature from %s does not match the message", signer)
+			}
+		}
+	}
+
+	a.checkBlockhash(ctx, tx, t, fail, warn)
+	resp.Valid = len(resp.Errors) == 0
+	if resp.Valid {
+		// kept so a later reversal can look the transfer up on chain
+		if err := a.db.RecordTransferSignature(ctx, t.TransferID, tx.Signatures[0].String()); err != nil {
+			log.Printf("verify signed: recording signature failed: %v", err)
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// blockhashOverride is the blockhash to hash a transfer's transaction
+// with: one built with the placeholder is compared as if it still had it.
+func blockhashOverride(t *db.Transfer) string {
+	if t.Blockhash == "" || t.Blockhash == util.PlaceholderBlockhash {
+		return util.PlaceholderBlockhash
+	}
+	return ""
+}
+
+// checkBlockhash asks the RPC whether the signed blockhash can still land.
+// When the RPC is unreachable it falls back to the ledger's expires_at for
+// the blockhash the transfer was built with, and only warns otherwise.
+func (a *API) checkBlockhash(ctx context.Context, tx *solana.Transaction, t *db.Transfer, fail, warn func(code, format string, args ...any)) {
+	blockhash := tx.Message.RecentBlockhash.String()
+	if blockhash == util.PlaceholderBlockhash {
+		fail("blockhash_placeholder", "set a recent blockhash before signing")
+		return
+	}
+	rebuild := fmt.Sprintf("blockhash has expired; rebuild with /rebuild_tx/%s", t.TransferID)
+	checkCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	valid, err := util.BlockhashValid(checkCtx, tx.Message.RecentBlockhash)
+	if err == nil {
+		if !valid {
+			fail("blockhash_expired", "%s", rebuild)
+		}
+		return
+	}
+	if blockhash == t.Blockhash {
+		if expires, perr := time.Parse(time.RFC3339, t.ExpiresAt); perr == nil && time.Now().After(expires) {
+			fail("blockhash_expired", "%s", rebuild)
+			return
+		}
+	}
+	warn("blockhash_unverified", "%v", err)
+}
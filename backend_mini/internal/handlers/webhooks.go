@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"backend_mini/internal/db"
+	"backend_mini/internal/eventfilter"
+	"backend_mini/internal/netguard"
+	"backend_mini/internal/notify"
+	"backend_mini/internal/relay"
+	"backend_mini/internal/webhook"
+)
+
+type setWebhookRequest struct {
+	ParentEmail string            `json:"parent_email"`
+	URL         string            `json:"url"`
+	Filter      string            `json:"filter,omitempty"`
+	Transform   map[string]string `json:"transform,omitempty"`
+}
+
+type updateWebhookRequest struct {
+	ParentEmail string            `json:"parent_email"`
+	WebhookID   string            `json:"webhook_id"`
+	Filter      string            `json:"filter"`
+	Transform   map[string]string `json:"transform"`
+}
+
+type getWebhooksRequest struct {
+	ParentEmail string `json:"parent_email"`
+}
+
+type webhookTestRequest struct {
+	WebhookID string `json:"webhook_id"`
+	// Event, when given, is a sample sent through the webhook's filter and
+	// transform instead of a ping.
+	Event *webhook.Event `json:"event,omitempty"`
+}
+
+func (a *API) SetWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req setWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" || strings.TrimSpace(req.URL) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email and url are required")
+		return
+	}
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		writeError(w, http.StatusBadRequest, "url must be an absolute http(s) url")
+		return
+	}
+	if err := netguard.CheckURL(u); err != nil {
+		writeError(w, http.StatusBadRequest, "url "+err.Error())
+		return
+	}
+	if !validWebhookShaping(w, req.Filter, req.Transform) {
+		return
+	}
+	ctx := r.Context()
+	if _, found, err := a.db.GetParentByEmail(ctx, req.ParentEmail); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	} else if !found {
+		writeError(w, http.StatusNotFound, "parent not found")
+		return
+	}
+	secret, err := webhook.NewSecret()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	wh, err := a.db.CreateWebhook(ctx, req.ParentEmail, u.String(), secret, strings.TrimSpace(req.Filter), req.Transform)
+	if quotaExceeded(w, err) {
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, wh)
+}
+
+// UpdateWebhook replaces a webhook's filter and transform. Leaving either
+// out clears it, so the webhook gets every event, or events as they are.
+func (a *API) UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req updateWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" || strings.TrimSpace(req.WebhookID) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email and webhook_id are required")
+		return
+	}
+	if !validWebhookShaping(w, req.Filter, req.Transform) {
+		return
+	}
+	wh, err := a.db.SetWebhookShaping(r.Context(), req.ParentEmail, req.WebhookID, strings.TrimSpace(req.Filter), req.Transform)
+	if errors.Is(err, db.ErrWebhookNotFound) {
+		writeError(w, http.StatusNotFound, "webhook not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	wh.Secret = ""
+	writeJSON(w, http.StatusOK, wh)
+}
+
+// validWebhookShaping checks that the filter compiles and that both it and
+// the transform only read the fields events have.
+func validWebhookShaping(w http.ResponseWriter, filter string, transform map[string]string) bool {
+	f, err := eventfilter.Compile(filter)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid filter: "+err.Error())
+		return false
+	}
+	for _, path := range f.Paths() {
+		root, _, _ := strings.Cut(path, ".")
+		if !templateRoots[root] {
+			writeError(w, http.StatusBadRequest, "filter path "+path+" must start with type, created_at, data or message")
+			return false
+		}
+	}
+	for _, path := range relay.Placeholders(transform) {
+		root, _, _ := strings.Cut(path, ".")
+		if !templateRoots[root] {
+			writeError(w, http.StatusBadRequest, "transform placeholder {{"+path+"}} must start with type, created_at, data or message")
+			return false
+		}
+	}
+	return true
+}
+
+func (a *API) GetWebhooks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req getWebhooksRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.ParentEmail) == "" {
+		writeError(w, http.StatusBadRequest, "parent_email is required")
+		return
+	}
+	hooks, err := a.db.GetWebhooksByParentEmail(r.Context(), req.ParentEmail)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	// the secret is only shown when the webhook is created
+	for i := range hooks {
+		hooks[i].Secret = ""
+	}
+	writeJSON(w, http.StatusOK, hooks)
+}
+
+func (a *API) WebhookTest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var req webhookTestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if strings.TrimSpace(req.WebhookID) == "" {
+		writeError(w, http.StatusBadRequest, "webhook_id is required")
+		return
+	}
+	ctx := r.Context()
+	wh, found, err := a.db.GetWebhook(ctx, req.WebhookID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "webhook not found")
+		return
+	}
+	if req.Event != nil {
+		a.testWebhookEvent(w, r, wh, *req.Event)
+		return
+	}
+	res, err := webhook.Send(ctx, wh.URL, wh.Secret, webhook.Event{
+		Type: "ping",
+		Data: map[string]string{"webhook_id": wh.WebhookID},
+	})
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// testWebhookEvent sends a sample event the way Emit would, reporting
+// whether the filter let it through and what was delivered.
+func (a *API) testWebhookEvent(w http.ResponseWriter, r *http.Request, wh *db.Webhook, ev webhook.Event) {
+	if ev.Type == "" {
+		writeError(w, http.StatusBadRequest, "event.type is required")
+		return
+	}
+	if ev.CreatedAt == "" {
+		ev.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+	}
+	shaped, ok, err := notify.ShapeWebhookEvent(wh, ev)
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	if !ok {
+		writeJSON(w, http.StatusOK, map[string]any{"matched": false})
+		return
+	}
+	res, err := webhook.Send(r.Context(), wh.URL, wh.Secret, shaped)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"matched": true, "delivered": shaped, "result": res})
+}
@@ -0,0 +1,137 @@
+package iap
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	AppStoreVerifyURL        = "https://buy.itunes.apple.com/verifyReceipt"
+	AppStoreSandboxVerifyURL = "https://sandbox.itunes.apple.com/verifyReceipt"
+
+	// appStoreSandboxReceipt is the status production answers for a
+	// receipt from the sandbox, which App Review uses.
+	appStoreSandboxReceipt = 21007
+)
+
+// AppStore validates App Store receipts with verifyReceipt. Empty URLs
+// mean Apple's.
+type AppStore struct {
+	SharedSecret string
+	BundleID     string
+	VerifyURL    string
+	SandboxURL   string
+}
+
+type appStoreResponse struct {
+	Status  int `json:"status"`
+	Receipt struct {
+		BundleID string `json:"bundle_id"`
+	} `json:"receipt"`
+	LatestReceiptInfo []struct {
+		ProductID             string `json:"product_id"`
+		OriginalTransactionID string `json:"original_transaction_id"`
+		ExpiresDateMs         string `json:"expires_date_ms"`
+		CancellationDateMs    string `json:"cancellation_date_ms"`
+	} `json:"latest_receipt_info"`
+	PendingRenewalInfo []struct {
+		OriginalTransactionID    string `json:"original_transaction_id"`
+		AutoRenewStatus          string `json:"auto_renew_status"`
+		IsInBillingRetryPeriod   string `json:"is_in_billing_retry_period"`
+		GracePeriodExpiresDateMs string `json:"grace_period_expires_date_ms"`
+	} `json:"pending_renewal_info"`
+}
+
+// Validate checks a base64 receipt and returns its latest subscription,
+// trying the sandbox when production says the receipt is from there.
+func (s AppStore) Validate(ctx context.Context, receipt string) (*Purchase, error) {
+	prod, sandbox := s.VerifyURL, s.SandboxURL
+	if prod == "" {
+		prod = AppStoreVerifyURL
+	}
+	if sandbox == "" {
+		sandbox = AppStoreSandboxVerifyURL
+	}
+	res, err := s.verify(ctx, prod, receipt)
+	if err == nil && res.Status == appStoreSandboxReceipt {
+		res, err = s.verify(ctx, sandbox, receipt)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if res.Status != 0 {
+		return nil, fmt.Errorf("%w: app store status %d", ErrInvalidReceipt, res.Status)
+	}
+	if s.BundleID != "" && res.Receipt.BundleID != s.BundleID {
+		return nil, fmt.Errorf("%w: receipt is for %s", ErrInvalidReceipt, res.Receipt.BundleID)
+	}
+	var p *Purchase
+	for _, t := range res.LatestReceiptInfo {
+		exp, _ := strconv.ParseInt(t.ExpiresDateMs, 10, 64)
+		if exp == 0 || (p != nil && !msTime(exp).After(p.ExpiresAt)) {
+			continue
+		}
+		p = &Purchase{Store: StoreAppStore, ExternalID: t.OriginalTransactionID, ProductID: t.ProductID, State: StateActive, ExpiresAt: msTime(exp)}
+		if t.CancellationDateMs != "" {
+			// refunded by Apple support
+			p.State = StateRevoked
+		}
+	}
+	if p == nil {
+		return nil, fmt.Errorf("%w: receipt has no subscription", ErrInvalidReceipt)
+	}
+	now := time.Now()
+	for _, r := range res.PendingRenewalInfo {
+		if r.OriginalTransactionID != p.ExternalID {
+			continue
+		}
+		p.AutoRenew = r.AutoRenewStatus == "1"
+		if p.State != StateActive || p.ExpiresAt.After(now) {
+			break
+		}
+		if grace, _ := strconv.ParseInt(r.GracePeriodExpiresDateMs, 10, 64); grace > 0 && msTime(grace).After(now) {
+			p.State, p.ExpiresAt = StateGrace, msTime(grace)
+		} else if r.IsInBillingRetryPeriod == "1" {
+			p.State = StatePastDue
+		}
+	}
+	if p.State == StateActive {
+		switch {
+		case !p.ExpiresAt.After(now):
+			p.State = StateExpired
+		case !p.AutoRenew:
+			p.State = StateCanceled
+		}
+	}
+	return p, nil
+}
+
+func (s AppStore) verify(ctx context.Context, url, receipt string) (*appStoreResponse, error) {
+	body, err := json.Marshal(map[string]any{"receipt-data": receipt, "password": s.SharedSecret, "exclude-old-transactions": true})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("app store: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("app store: http %d", resp.StatusCode)
+	}
+	var out appStoreResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("app store: %w", err)
+	}
+	return &out, nil
+}
@@ -0,0 +1,48 @@
+// Package iap checks App Store and Play Store subscription purchases with
+// the stores themselves, so a client cannot claim premium it did not buy.
+package iap
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+// Stores a purchase can come from.
+const (
+	StoreAppStore  = "app_store"
+	StorePlayStore = "play_store"
+)
+
+// Purchase states as the stores report them, reduced to what entitlements
+// need.
+const (
+	StateActive   = "active"
+	StateGrace    = "grace"
+	StatePastDue  = "past_due"
+	StateCanceled = "canceled"
+	StateRevoked  = "revoked"
+	StateExpired  = "expired"
+)
+
+// ErrInvalidReceipt means the store did not recognise the receipt or
+// token, or it is for another app.
+var ErrInvalidReceipt = errors.New("the store did not accept this purchase")
+
+var client = &http.Client{Timeout: 15 * time.Second}
+
+// Purchase is a subscription as the store sees it. ExternalID identifies
+// it across renewals: the original transaction id on the App Store, the
+// purchase token on Play.
+type Purchase struct {
+	Store      string
+	ExternalID string
+	ProductID  string
+	State      string
+	ExpiresAt  time.Time
+	AutoRenew  bool
+}
+
+func msTime(ms int64) time.Time {
+	return time.UnixMilli(ms).UTC()
+}
@@ -0,0 +1,196 @@
+package iap
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	PlayAPIBase        = "https://androidpublisher.googleapis.com/androidpublisher/v3"
+	playPublisherScope = "https://www.googleapis.com/auth/androidpublisher"
+)
+
+// PlayStore validates Play subscription purchase tokens with the Android
+// Publisher API, as a service account with access to the app.
+type PlayStore struct {
+	PackageName string
+	APIBase     string
+	account     serviceAccount
+
+	mu          sync.Mutex
+	accessToken string
+	tokenExpiry time.Time
+}
+
+type serviceAccount struct {
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+	key         *rsa.PrivateKey
+}
+
+// NewPlayStore reads the service account key file Google issues as JSON.
+// An empty apiBase means Google's.
+func NewPlayStore(packageName string, serviceAccountJSON []byte, apiBase string) (*PlayStore, error) {
+	if apiBase == "" {
+		apiBase = PlayAPIBase
+	}
+	var sa serviceAccount
+	if err := json.Unmarshal(serviceAccountJSON, &sa); err != nil {
+		return nil, fmt.Errorf("play service account: %w", err)
+	}
+	block, _ := pem.Decode([]byte(sa.PrivateKey))
+	if block == nil {
+		return nil, errors.New("play service account: private_key is not PEM")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("play service account: %w", err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("play service account: private_key is not RSA")
+	}
+	sa.key = rsaKey
+	if sa.TokenURI == "" {
+		sa.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+	return &PlayStore{PackageName: packageName, APIBase: apiBase, account: sa}, nil
+}
+
+type playSubscription struct {
+	SubscriptionState string `json:"subscriptionState"`
+	LineItems         []struct {
+		ProductID        string `json:"productId"`
+		ExpiryTime       string `json:"expiryTime"`
+		AutoRenewingPlan *struct {
+			AutoRenewEnabled bool `json:"autoRenewEnabled"`
+		} `json:"autoRenewingPlan"`
+	} `json:"lineItems"`
+}
+
+var playStates = map[string]string{
+	"SUBSCRIPTION_STATE_ACTIVE":          StateActive,
+	"SUBSCRIPTION_STATE_IN_GRACE_PERIOD": StateGrace,
+	"SUBSCRIPTION_STATE_ON_HOLD":         StatePastDue,
+	"SUBSCRIPTION_STATE_PAUSED":          StatePastDue,
+	"SUBSCRIPTION_STATE_CANCELED":        StateCanceled,
+	"SUBSCRIPTION_STATE_EXPIRED":         StateExpired,
+}
+
+// Validate looks up a purchase token with subscriptionsv2.get.
+func (s *PlayStore) Validate(ctx context.Context, purchaseToken string) (*Purchase, error) {
+	access, err := s.token(ctx)
+	if err != nil {
+		return nil, err
+	}
+	u := fmt.Sprintf("%s/applications/%s/purchases/subscriptionsv2/tokens/%s", s.APIBase, url.PathEscape(s.PackageName), url.PathEscape(purchaseToken))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+access)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("play store: %w", err)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusGone:
+		return nil, fmt.Errorf("%w: play store http %d", ErrInvalidReceipt, resp.StatusCode)
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("play store: http %d", resp.StatusCode)
+	}
+	var sub playSubscription
+	if err := json.NewDecoder(resp.Body).Decode(&sub); err != nil {
+		return nil, fmt.Errorf("play store: %w", err)
+	}
+	state, ok := playStates[sub.SubscriptionState]
+	if !ok || len(sub.LineItems) == 0 {
+		return nil, fmt.Errorf("%w: subscription state %s", ErrInvalidReceipt, sub.SubscriptionState)
+	}
+	p := &Purchase{Store: StorePlayStore, ExternalID: purchaseToken, State: state}
+	for _, li := range sub.LineItems {
+		exp, err := time.Parse(time.RFC3339Nano, li.ExpiryTime)
+		if err != nil || !exp.After(p.ExpiresAt) {
+			continue
+		}
+		p.ProductID, p.ExpiresAt = li.ProductID, exp.UTC()
+		p.AutoRenew = li.AutoRenewingPlan != nil && li.AutoRenewingPlan.AutoRenewEnabled
+	}
+	return p, nil
+}
+
+// token returns a cached OAuth access token, fetching a new one with a
+// signed JWT assertion when it is about to run out.
+func (s *PlayStore) token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.accessToken != "" && time.Until(s.tokenExpiry) > time.Minute {
+		return s.accessToken, nil
+	}
+	assertion, err := s.account.assertion(time.Now())
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"}, "assertion": {assertion}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.account.TokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("play store token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("play store token: http %d", resp.StatusCode)
+	}
+	var out struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("play store token: %w", err)
+	}
+	s.accessToken, s.tokenExpiry = out.AccessToken, time.Now().Add(time.Duration(out.ExpiresIn)*time.Second)
+	return s.accessToken, nil
+}
+
+// assertion is the RS256 JWT a service account trades for an access token.
+func (sa serviceAccount) assertion(now time.Time) (string, error) {
+	enc := base64.RawURLEncoding
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, err := json.Marshal(map[string]any{
+		"iss":   sa.ClientEmail,
+		"scope": playPublisherScope,
+		"aud":   sa.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	signing := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	sum := sha256.Sum256([]byte(signing))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, sa.key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", err
+	}
+	return signing + "." + enc.EncodeToString(sig), nil
+}
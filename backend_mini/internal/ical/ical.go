@@ -0,0 +1,147 @@
+// Package ical reads the subset of RFC 5545 needed to turn school and holiday
+// calendars into a set of dates: VEVENT blocks with DTSTART, DTEND and SUMMARY.
+// Recurrence rules are not expanded.
+package ical
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+// maxEventDays caps how many days a single event may cover.
+const maxEventDays = 366
+
+type Event struct {
+	Summary string
+	Start   time.Time
+	// End is exclusive, as in DTEND.
+	End    time.Time
+	AllDay bool
+}
+
+// Days returns the dates (YYYY-MM-DD) the event touches.
+func (e Event) Days() []string {
+	var out []string
+	day := time.Date(e.Start.Year(), e.Start.Month(), e.Start.Day(), 0, 0, 0, 0, e.Start.Location())
+	end := e.End
+	if !end.After(e.Start) {
+		end = e.Start.Add(time.Nanosecond)
+	}
+	for i := 0; i < maxEventDays && day.Before(end); i++ {
+		out = append(out, day.Format("2006-01-02"))
+		day = day.AddDate(0, 0, 1)
+	}
+	return out
+}
+
+// Parse reads all VEVENTs from an iCalendar stream.
+func Parse(r io.Reader) ([]Event, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		events []Event
+		cur    *Event
+		sawCal bool
+	)
+	for _, line := range lines {
+		name, params, value := splitLine(line)
+		switch {
+		case name == "BEGIN" && value == "VCALENDAR":
+			sawCal = true
+		case name == "BEGIN" && value == "VEVENT":
+			cur = &Event{}
+		case name == "END" && value == "VEVENT":
+			if cur != nil && !cur.Start.IsZero() {
+				if cur.End.IsZero() {
+					cur.End = cur.Start
+					if cur.AllDay {
+						cur.End = cur.Start.AddDate(0, 0, 1)
+					}
+				}
+				events = append(events, *cur)
+			}
+			cur = nil
+		case cur == nil:
+		case name == "SUMMARY":
+			cur.Summary = unescape(value)
+		case name == "DTSTART":
+			t, allDay, err := parseTime(params, value)
+			if err != nil {
+				return nil, err
+			}
+			cur.Start, cur.AllDay = t, allDay
+		case name == "DTEND":
+			t, _, err := parseTime(params, value)
+			if err != nil {
+				return nil, err
+			}
+			cur.End = t
+		}
+	}
+	if !sawCal {
+		return nil, errors.New("ical: missing BEGIN:VCALENDAR")
+	}
+	return events, nil
+}
+
+// unfold joins continuation lines (those starting with a space or tab).
+func unfold(r io.Reader) ([]string, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	var lines []string
+	for sc.Scan() {
+		l := strings.TrimRight(sc.Text(), "\r")
+		if (strings.HasPrefix(l, " ") || strings.HasPrefix(l, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += l[1:]
+			continue
+		}
+		lines = append(lines, l)
+	}
+	return lines, sc.Err()
+}
+
+func splitLine(line string) (name string, params map[string]string, value string) {
+	i := strings.IndexByte(line, ':')
+	if i < 0 {
+		return strings.ToUpper(line), nil, ""
+	}
+	head, value := line[:i], line[i+1:]
+	parts := strings.Split(head, ";")
+	name = strings.ToUpper(parts[0])
+	params = map[string]string{}
+	for _, p := range parts[1:] {
+		if k, v, ok := strings.Cut(p, "="); ok {
+			params[strings.ToUpper(k)] = strings.Trim(v, `"`)
+		}
+	}
+	return name, params, value
+}
+
+func parseTime(params map[string]string, v string) (time.Time, bool, error) {
+	if params["VALUE"] == "DATE" || len(v) == 8 {
+		t, err := time.Parse("20060102", v)
+		return t, true, err
+	}
+	if strings.HasSuffix(v, "Z") {
+		t, err := time.Parse("20060102T150405Z", v)
+		return t, false, err
+	}
+	loc := time.UTC
+	if tz := params["TZID"]; tz != "" {
+		if l, err := time.LoadLocation(tz); err == nil {
+			loc = l
+		}
+	}
+	t, err := time.ParseInLocation("20060102T150405", v, loc)
+	return t, false, err
+}
+
+func unescape(s string) string {
+	r := strings.NewReplacer(`\n`, " ", `\N`, " ", `\,`, ",", `\;`, ";", `\\`, `\`)
+	return r.Replace(s)
+}
@@ -0,0 +1,64 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"backend_mini/internal/balance"
+	"backend_mini/internal/db"
+	"backend_mini/internal/notify"
+)
+
+// CheckBalanceAlerts evaluates every balance alert against the kid's
+// available EURC balance. Alerts of a paused kid or family wait for the
+// pause to end.
+func CheckBalanceAlerts(ctx context.Context, d *db.DB, n *notify.Notifier) error {
+	alerts, err := d.AllBalanceAlerts(ctx)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	balances := map[string]uint64{}
+	for i := range alerts {
+		a := &alerts[i]
+		if until, err := d.PausedUntil(ctx, a.ParentEmail, a.KidEmail, now); err != nil {
+			return err
+		} else if until != "" {
+			continue
+		}
+		kid, found, err := d.GetChildByEmail(ctx, a.KidEmail)
+		if err != nil {
+			return err
+		}
+		if !found || kid.Wallet == "" {
+			continue
+		}
+		bal, ok := balances[kid.Wallet]
+		if !ok {
+			b, err := balance.Get(ctx, d, kid.Wallet)
+			if err != nil {
+				log.Printf("balance alerts: %s: %v", kid.Wallet, err)
+				continue
+			}
+			bal = b.Available
+			balances[kid.Wallet] = bal
+		}
+		fired, err := d.RecordAlertCheck(ctx, a, bal, a.Breached(bal))
+		if err != nil {
+			return err
+		}
+		if fired {
+			if _, err := n.Emit(ctx, "balance_alert.triggered", a.ParentEmail, map[string]interface{}{
+				"alert_id":  a.AlertID,
+				"kid_email": a.KidEmail,
+				"direction": a.Direction,
+				"threshold": a.Threshold,
+				"balance":   bal,
+			}); err != nil {
+				log.Printf("balance alerts: emit failed: %v", err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"backend_mini/internal/db"
+	"backend_mini/internal/notify"
+)
+
+const (
+	anomalyBatch = 200
+	// largeAmountHistory is how many earlier transfers make up the baseline
+	// for the large-amount rule, and largeAmountMinHistory how many it needs.
+	largeAmountHistory    = 20
+	largeAmountMinHistory = 3
+)
+
+// ScanTransfers checks every unscanned transfer against its family's rules
+// and files flags for review. Families that block on flag cannot build
+// further transfers from a flagged wallet until its flags are resolved.
+func ScanTransfers(ctx context.Context, d *db.DB, n *notify.Notifier) error {
+	for {
+		batch, err := d.UnscannedTransfers(ctx, anomalyBatch)
+		if err != nil || len(batch) == 0 {
+			return err
+		}
+		for i := range batch {
+			t := &batch[i]
+			if err := scanTransfer(ctx, d, n, t); err != nil {
+				return fmt.Errorf("transfer %s: %w", t.TransferID, err)
+			}
+			if err := d.MarkTransferScanned(ctx, t.TransferID); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func scanTransfer(ctx context.Context, d *db.DB, n *notify.Notifier, t *db.Transfer) error {
+	parentEmail, _, found, err := d.FamilyOfWallet(ctx, t.FromWallet)
+	if err != nil || !found {
+		return err
+	}
+	s, err := d.GetAnomalySettings(ctx, parentEmail)
+	if err != nil {
+		return err
+	}
+	created, err := time.Parse(time.RFC3339, t.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	var flags []db.TransferFlag
+	flag := func(rule, detail string) {
+		flags = append(flags, db.TransferFlag{TransferID: t.TransferID, ParentEmail: parentEmail, FromWallet: t.FromWallet, Rule: rule, Detail: detail})
+	}
+
+	if s.BurstCount > 0 {
+		since := created.Add(-time.Duration(s.BurstMinutes) * time.Minute).Format(time.RFC3339)
+		count, err := d.CountTransfersFrom(ctx, t.FromWallet, since, t.CreatedAt)
+		if err != nil {
+			return err
+		}
+		if count >= s.BurstCount {
+			// one open burst flag per window is enough for a reviewer
+			open, err := d.HasOpenFlag(ctx, t.FromWallet, db.FlagBurst, time.Now().Add(-time.Duration(s.BurstMinutes)*time.Minute).UTC().Format(time.RFC3339))
+			if err != nil {
+				return err
+			}
+			if !open {
+				flag(db.FlagBurst, fmt.Sprintf("%d transfers within %d minutes", count, s.BurstMinutes))
+			}
+		}
+	}
+
+	if s.FlagNewRecipients {
+		family, err := d.FamilyWallets(ctx, parentEmail)
+		if err != nil {
+			return err
+		}
+		for _, leg := range t.Legs {
+			if family[leg.ToWallet] {
+				continue
+			}
+			paid, err := d.PaidBefore(ctx, t.FromWallet, leg.ToWallet, t)
+			if err != nil {
+				return err
+			}
+			if !paid {
+				flag(db.FlagNewRecipient, "first transfer to "+leg.ToWallet+", which is outside the family")
+			}
+		}
+	}
+
+	if s.LargeMultiplier > 0 {
+		history, err := d.RecentTransferTotals(ctx, t.FromWallet, t, largeAmountHistory)
+		if err != nil {
+			return err
+		}
+		if len(history) >= largeAmountMinHistory {
+			sort.Slice(history, func(i, j int) bool { return history[i] < history[j] })
+			typical := history[len(history)/2]
+			if float64(t.Total) > s.LargeMultiplier*float64(typical) {
+				flag(db.FlagLargeAmount, fmt.Sprintf("%d is over %gx the typical %d", t.Total, s.LargeMultiplier, typical))
+			}
+		}
+	}
+
+	for _, f := range flags {
+		stored, added, err := d.AddTransferFlag(ctx, f)
+		if err != nil {
+			return err
+		}
+		if !added {
+			continue
+		}
+		if _, err := n.Emit(ctx, "transfer.flagged", parentEmail, stored); err != nil {
+			log.Printf("anomaly detection: emit for %s: %v", stored.FlagID, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"backend_mini/internal/db"
+	"backend_mini/internal/notify"
+)
+
+// AutoApproveChores approves submitted chores under their family's
+// auto_approve_below threshold once the parent has let
+// auto_approve_after_hours pass, and tells the parent with a
+// chore.auto_approved event. The payout is not built here: the parent's
+// app builds it with /update_chore status 3, where the family policy and
+// holds still apply.
+func AutoApproveChores(ctx context.Context, d *db.DB, n *notify.Notifier) error {
+	due, err := d.AutoApprovalCandidates(ctx)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, a := range due {
+		if !a.Due(now) {
+			continue
+		}
+		chore, ok, err := d.AutoApproveChore(ctx, a.Chore.ChoreID, fmt.Sprintf("auto-approved after %dh", a.AfterHours))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		if _, err := n.Emit(ctx, "chore.auto_approved", a.ParentEmail, chore); err != nil {
+			log.Printf("chore auto-approval: emit failed: %v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+
+	"backend_mini/internal/db"
+	"backend_mini/internal/util"
+)
+
+// ProvisionATAs creates missing EURC token accounts for every family
+// wallet, paid by the server wallet, so transfers to them need no
+// create instruction.
+func ProvisionATAs(ctx context.Context, d *db.DB, payer *solana.PrivateKey) error {
+	wallets, err := d.AllFamilyWallets(ctx)
+	if err != nil {
+		return err
+	}
+	mint := solana.MustPublicKeyFromBase58(util.EURCMintDevnet)
+	var missing []solana.PublicKey
+	for _, w := range wallets {
+		owner, err := solana.PublicKeyFromBase58(w)
+		if err != nil {
+			continue
+		}
+		exists, err := util.ATAExists(ctx, owner, mint)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			missing = append(missing, owner)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	runCtx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	defer cancel()
+	sigs, err := util.CreateATAs(runCtx, payer, missing)
+	if len(sigs) > 0 {
+		log.Printf("ata provisioning: created token accounts in %v", sigs)
+	}
+	return err
+}
@@ -0,0 +1,85 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"backend_mini/internal/db"
+	"backend_mini/internal/ical"
+	"backend_mini/internal/netguard"
+)
+
+// maxCalendarBytes bounds a downloaded .ics feed.
+const maxCalendarBytes = 5 << 20
+
+// calendarClient only dials public addresses: feed URLs are user input.
+// Feeds are often served behind a redirect, which it follows, since every
+// hop is dialed through the same check.
+var calendarClient = func() *http.Client {
+	c := netguard.Client(20 * time.Second)
+	c.CheckRedirect = nil
+	return c
+}()
+
+// SyncCalendars refreshes every URL-backed family calendar.
+func SyncCalendars(ctx context.Context, d *db.DB) error {
+	cals, err := d.ListCalendars(ctx, "")
+	if err != nil {
+		return err
+	}
+	for _, c := range cals {
+		if err := SyncCalendar(ctx, d, &c); err != nil {
+			log.Printf("calendar sync: %s: %v", c.CalendarID, err)
+		}
+	}
+	return nil
+}
+
+// SyncCalendar downloads the calendar's feed and replaces its days. Failures
+// are recorded on the calendar so parents can see them.
+func SyncCalendar(ctx context.Context, d *db.DB, c *db.FamilyCalendar) error {
+	err := fetchCalendar(ctx, d, c)
+	if err != nil {
+		if rerr := d.RecordCalendarSyncError(ctx, c.CalendarID, err); rerr != nil {
+			log.Printf("calendar sync: recording error: %v", rerr)
+		}
+	}
+	return err
+}
+
+func fetchCalendar(ctx context.Context, d *db.DB, c *db.FamilyCalendar) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.URL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := calendarClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("feed answered %d", resp.StatusCode)
+	}
+	return ImportCalendar(ctx, d, c.CalendarID, io.LimitReader(resp.Body, maxCalendarBytes))
+}
+
+// ImportCalendar parses an .ics stream into the calendar's days.
+func ImportCalendar(ctx context.Context, d *db.DB, calendarID string, r io.Reader) error {
+	events, err := ical.Parse(r)
+	if err != nil {
+		return err
+	}
+	days := map[string]string{}
+	for _, ev := range events {
+		for _, day := range ev.Days() {
+			if _, ok := days[day]; !ok {
+				days[day] = ev.Summary
+			}
+		}
+	}
+	return d.ReplaceCalendarDays(ctx, calendarID, days)
+}
@@ -0,0 +1,30 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"backend_mini/internal/db"
+	"backend_mini/internal/notify"
+)
+
+// ReleaseClaims reopens open chores whose claim lapsed before the kid
+// started them, telling the parent with a chore.claim_expired event.
+func ReleaseClaims(ctx context.Context, d *db.DB, n *notify.Notifier) error {
+	released, err := d.ReleaseExpiredClaims(ctx, time.Now())
+	if err != nil {
+		return err
+	}
+	for i := range released {
+		c := &released[i]
+		parent, found, err := d.GetParentByWallet(ctx, c.ParentWallet)
+		if err != nil || !found {
+			continue
+		}
+		if _, err := n.Emit(ctx, "chore.claim_expired", parent.Email, c); err != nil {
+			log.Printf("chore claims: emit failed: %v", err)
+		}
+	}
+	return nil
+}
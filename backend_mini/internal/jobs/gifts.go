@@ -0,0 +1,48 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"backend_mini/internal/db"
+	"backend_mini/internal/notify"
+	"backend_mini/internal/util"
+)
+
+// WatchGifts looks on chain for payments to waiting gift links by their
+// Solana Pay reference. A paid gift is marked received and the parent gets
+// a gift.received event; links past their expiry are closed.
+func WatchGifts(ctx context.Context, d *db.DB, n *notify.Notifier) error {
+	gifts, err := d.WaitingGifts(ctx)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	for _, g := range gifts {
+		sig, amount, found, err := util.FindReferencedPayment(ctx, g.Reference, g.Wallet)
+		if err != nil {
+			log.Printf("gifts: checking %s: %v", g.GiftID, err)
+			continue
+		}
+		if !found {
+			if g.ExpiresAt <= now {
+				if err := d.ExpireGift(ctx, g.GiftID); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		received, ok, err := d.ReceiveGift(ctx, g.GiftID, sig, amount)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		if _, err := n.Emit(ctx, "gift.received", received.ParentEmail, received); err != nil {
+			log.Printf("gifts: emit failed: %v", err)
+		}
+	}
+	return nil
+}
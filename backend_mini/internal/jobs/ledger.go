@@ -0,0 +1,39 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+
+	"backend_mini/internal/db"
+	"backend_mini/internal/util"
+)
+
+// AnchorLedger publishes the head of the ledger chain in a memo
+// transaction from the server wallet, so the chain up to it can be shown
+// unchanged later. It does nothing while the head has not moved since the
+// last anchor.
+func AnchorLedger(ctx context.Context, d *db.DB, payer *solana.PrivateKey) error {
+	seq, hash, found, err := d.LedgerHead(ctx)
+	if err != nil || !found {
+		return err
+	}
+	last, anchored, err := d.LastLedgerAnchor(ctx)
+	if err != nil {
+		return err
+	}
+	if anchored && last.Seq == seq {
+		return nil
+	}
+	runCtx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	defer cancel()
+	sig, err := util.SubmitMemo(runCtx, payer, fmt.Sprintf("sona-ledger:%d:%s", seq, hash))
+	if err != nil {
+		return err
+	}
+	log.Printf("ledger anchor: published seq %d in %s", seq, sig)
+	return d.RecordLedgerAnchor(ctx, &db.LedgerAnchor{Seq: seq, Hash: hash, Signature: sig})
+}
@@ -0,0 +1,19 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"backend_mini/internal/db"
+)
+
+// PurgeLocations deletes location reports past their family's retention
+// window, so nothing outlives it even when no new reports arrive.
+func PurgeLocations(ctx context.Context, d *db.DB) error {
+	n, err := d.PurgeLocationReports(ctx, time.Now())
+	if n > 0 {
+		log.Printf("location purge: removed %d reports", n)
+	}
+	return err
+}
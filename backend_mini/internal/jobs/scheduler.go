@@ -0,0 +1,213 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"backend_mini/internal/cron"
+)
+
+// Scheduler runs background jobs on cron or interval schedules, one
+// goroutine per job, so a slow job never delays another. A job never
+// overlaps itself: a manual trigger while it runs queues one more run.
+type Scheduler struct {
+	mu   sync.Mutex
+	jobs map[string]*job
+	wg   sync.WaitGroup
+}
+
+type job struct {
+	name     string
+	schedule cron.Schedule
+	run      func(context.Context) error
+	trigger  chan struct{}
+
+	next, lastRun time.Time
+	lastTook      time.Duration
+	lastErr       string
+	running       bool
+	runs          int
+}
+
+// JobStatus is one job as reported by /admin/schedules.
+type JobStatus struct {
+	Name       string `json:"name"`
+	Schedule   string `json:"schedule"`
+	NextRun    string `json:"next_run,omitempty"`
+	LastRun    string `json:"last_run,omitempty"`
+	LastTookMS int64  `json:"last_took_ms"`
+	LastError  string `json:"last_error,omitempty"`
+	Running    bool   `json:"running"`
+	Runs       int    `json:"runs"`
+}
+
+func NewScheduler() *Scheduler {
+	return &Scheduler{jobs: map[string]*job{}}
+}
+
+// Add registers a job. spec is a cron expression (see package cron); when
+// empty the job runs every interval instead, starting right away as the
+// interval jobs always have. Add must be called before Run.
+func (s *Scheduler) Add(name, spec string, interval time.Duration, run func(context.Context) error) error {
+	var sched cron.Schedule = cron.Every(interval)
+	if spec != "" {
+		var err error
+		if sched, err = cron.Parse(spec); err != nil {
+			return fmt.Errorf("job %s: %w", name, err)
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs[name] = &job{name: name, schedule: sched, run: run, trigger: make(chan struct{}, 1)}
+	return nil
+}
+
+// Run starts every job and returns; jobs stop when ctx is done. A running
+// job gets the same ctx, so it can give up early and roll back.
+func (s *Scheduler) Run(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, j := range s.jobs {
+		s.wg.Add(1)
+		go func(j *job) {
+			defer s.wg.Done()
+			s.loop(ctx, j)
+		}(j)
+	}
+}
+
+// Wait blocks until every job has stopped after Run's ctx is done, or
+// until ctx is done, in which case it returns ctx's error.
+func (s *Scheduler) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *Scheduler) loop(ctx context.Context, j *job) {
+	next := time.Now()
+	if _, interval := j.schedule.(cron.Every); !interval {
+		next = j.schedule.Next(next)
+	}
+	for {
+		s.mu.Lock()
+		j.next = next
+		s.mu.Unlock()
+		// a schedule that never fires again only runs when triggered
+		var fire <-chan time.Time
+		var timer *time.Timer
+		if !next.IsZero() {
+			timer = time.NewTimer(time.Until(next))
+			fire = timer.C
+		}
+		select {
+		case <-ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		case <-fire:
+		case <-j.trigger:
+			if timer != nil {
+				timer.Stop()
+			}
+		}
+		s.runOnce(ctx, j)
+		next = j.schedule.Next(time.Now())
+	}
+}
+
+func (s *Scheduler) runOnce(ctx context.Context, j *job) {
+	s.mu.Lock()
+	j.running = true
+	s.mu.Unlock()
+	start := time.Now()
+	err := j.run(ctx)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j.running, j.lastRun, j.lastTook, j.runs = false, start, time.Since(start), j.runs+1
+	j.lastErr = ""
+	if err != nil {
+		j.lastErr = err.Error()
+		log.Printf("%s: %v", j.name, err)
+	}
+}
+
+// Trigger queues an immediate run of the named job. It reports false for
+// an unknown job.
+func (s *Scheduler) Trigger(name string) bool {
+	s.mu.Lock()
+	j := s.jobs[name]
+	s.mu.Unlock()
+	if j == nil {
+		return false
+	}
+	select {
+	case j.trigger <- struct{}{}:
+	default: // a run is already queued
+	}
+	return true
+}
+
+// Status reports every job, sorted by name.
+func (s *Scheduler) Status() []JobStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]JobStatus, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		st := JobStatus{Name: j.name, Schedule: j.schedule.String(), LastTookMS: j.lastTook.Milliseconds(),
+			LastError: j.lastErr, Running: j.running, Runs: j.runs}
+		if !j.next.IsZero() {
+			st.NextRun = j.next.UTC().Format(time.RFC3339)
+		}
+		if !j.lastRun.IsZero() {
+			st.LastRun = j.lastRun.UTC().Format(time.RFC3339)
+		}
+		out = append(out, st)
+	}
+	sort.Slice(out, func(a, b int) bool { return out[a].Name < out[b].Name })
+	return out
+}
+
+// ServeHTTP lists the jobs, or with {"run":"<job>"} triggers one and
+// returns 202.
+func (s *Scheduler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Run string `json:"run"`
+	}
+	if r.Method == http.MethodPost && r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+			return
+		}
+	}
+	if req.Run == "" {
+		writeJSON(w, http.StatusOK, s.Status())
+		return
+	}
+	if !s.Trigger(req.Run) {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": fmt.Sprintf("unknown job %q", req.Run)})
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]interface{}{"job": req.Run, "triggered": true})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
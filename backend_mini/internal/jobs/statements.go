@@ -0,0 +1,35 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"backend_mini/internal/db"
+)
+
+// CloseStatements finalizes every ended month that has no statement yet,
+// so statements exist even for kids nobody asked about.
+func CloseStatements(ctx context.Context, d *db.DB) error {
+	now := time.Now()
+	kids, err := d.KidsWithLedgerActivity(ctx)
+	if err != nil {
+		return err
+	}
+	for i := range kids {
+		periods, err := d.ListStatementPeriods(ctx, &kids[i], now)
+		if err != nil {
+			log.Printf("statement close: %s: %v", kids[i].Email, err)
+			continue
+		}
+		for _, p := range periods {
+			if p.Status != db.StatementPending {
+				continue
+			}
+			if _, err := d.FinalizeStatement(ctx, &kids[i], p.Period, now); err != nil {
+				log.Printf("statement close: %s %s: %v", kids[i].Email, p.Period, err)
+			}
+		}
+	}
+	return nil
+}
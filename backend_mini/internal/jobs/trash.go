@@ -0,0 +1,18 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"backend_mini/internal/db"
+)
+
+// PurgeTrash drops deleted items whose restore window has closed.
+func PurgeTrash(ctx context.Context, d *db.DB) error {
+	n, err := d.PurgeTrash(ctx, time.Now())
+	if n > 0 {
+		log.Printf("trash purge: removed %d items", n)
+	}
+	return err
+}
@@ -0,0 +1,168 @@
+package jobs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"backend_mini/internal/db"
+)
+
+// bqField is a column in BigQuery's JSON schema format, so a file can be
+// loaded with bq load --source_format=NEWLINE_DELIMITED_JSON --schema=...
+type bqField struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	Mode string `json:"mode"`
+}
+
+// ExportWarehouse writes what changed in each warehouse table since the
+// last run to dir as gzipped newline-delimited JSON, one file per table per
+// run under <table>/dt=<day>/. Every record carries _op ("upsert" or
+// "delete") and _exported_at; the warehouse keeps the latest per key.
+// A table's rows are only marked exported once its file is on disk, so a
+// failed run is repeated rather than lost. An empty dir turns the export
+// off.
+func ExportWarehouse(ctx context.Context, d *db.DB, dir string) error {
+	if dir == "" {
+		return nil
+	}
+	now := time.Now().UTC()
+	var failed []string
+	for _, t := range db.WarehouseTables {
+		n, err := exportTable(ctx, d, dir, t, now)
+		if err != nil {
+			log.Printf("warehouse: %s: %v", t.Name, err)
+			failed = append(failed, t.Name)
+			continue
+		}
+		if n > 0 {
+			log.Printf("warehouse: exported %d %s records", n, t.Name)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("warehouse export failed for %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func exportTable(ctx context.Context, d *db.DB, dir string, t db.WarehouseTable, now time.Time) (int, error) {
+	b, err := d.WarehouseChanges(ctx, t)
+	if err != nil {
+		return 0, err
+	}
+	if err := updateSchema(filepath.Join(dir, t.Name, "schema.json"), b.Columns); err != nil {
+		return 0, err
+	}
+	n := len(b.Rows) + len(b.Deleted)
+	if n == 0 {
+		return 0, nil
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	enc := json.NewEncoder(zw)
+	stamp := now.Format(time.RFC3339)
+	for _, rec := range b.Rows {
+		rec["_op"], rec["_exported_at"] = "upsert", stamp
+		if err := enc.Encode(rec); err != nil {
+			return 0, err
+		}
+	}
+	for _, rec := range b.Deleted {
+		rec["_op"], rec["_exported_at"] = "delete", stamp
+		if err := enc.Encode(rec); err != nil {
+			return 0, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return 0, err
+	}
+	name := filepath.Join(dir, t.Name, "dt="+now.Format("2006-01-02"), t.Name+"-"+now.Format("150405.000000")+".ndjson.gz")
+	if err := writeFileAtomic(name, buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return n, d.CommitWarehouseBatch(ctx, b)
+}
+
+// updateSchema keeps the table's BigQuery schema in step with SQLite.
+// Columns are only ever added: one dropped from SQLite stays in the schema
+// (and is simply absent from new records), since the warehouse keeps it.
+func updateSchema(path string, cols []db.WarehouseColumn) error {
+	var fields []bqField
+	if buf, err := os.ReadFile(path); err == nil {
+		if err := json.Unmarshal(buf, &fields); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	known := map[string]bool{}
+	for _, f := range fields {
+		known[f.Name] = true
+	}
+	added := []string{}
+	for _, c := range append(cols, db.WarehouseColumn{Name: "_op", Type: "TEXT"}, db.WarehouseColumn{Name: "_exported_at", Type: "TIMESTAMP"}) {
+		if known[c.Name] {
+			continue
+		}
+		fields = append(fields, bqField{Name: c.Name, Type: bqType(c.Type), Mode: "NULLABLE"})
+		added = append(added, c.Name)
+	}
+	if len(added) == 0 {
+		return nil
+	}
+	if len(known) > 0 {
+		log.Printf("warehouse: %s gained columns %s", path, strings.Join(added, ", "))
+	}
+	buf, err := json.MarshalIndent(fields, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, append(buf, '\n'))
+}
+
+// bqType maps a SQLite declared type to a BigQuery type by SQLite's own
+// affinity rules.
+func bqType(decl string) string {
+	decl = strings.ToUpper(decl)
+	switch {
+	case decl == "TIMESTAMP":
+		return "TIMESTAMP"
+	case strings.Contains(decl, "INT"):
+		return "INTEGER"
+	case strings.Contains(decl, "REAL"), strings.Contains(decl, "FLOA"), strings.Contains(decl, "DOUB"):
+		return "FLOAT"
+	}
+	return "STRING"
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,172 @@
+// Package metrics keeps request, database and upstream timings in process
+// and serves them in the Prometheus text format, so a scraper can follow
+// what the logs only show one line at a time.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// buckets are the histogram upper bounds in seconds, Prometheus' defaults.
+// Long polls land in +Inf.
+var buckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+var started = time.Now()
+
+var (
+	requests = &family{
+		name:   "sona_http_requests_total",
+		help:   "HTTP requests served, by route pattern, method and status.",
+		kind:   "counter",
+		labels: []string{"route", "method", "status"},
+	}
+	requestDuration = &family{
+		name:   "sona_http_request_duration_seconds",
+		help:   "Time to serve an HTTP request, by route pattern and method.",
+		kind:   "histogram",
+		labels: []string{"route", "method"},
+	}
+	queryDuration = &family{
+		name:   "sona_db_query_duration_seconds",
+		help:   "Time to run a SQLite statement, by pool and operation.",
+		kind:   "histogram",
+		labels: []string{"pool", "op"},
+	}
+	upstreamDuration = &family{
+		name:   "sona_upstream_request_duration_seconds",
+		help:   "Time to call an upstream service, by upstream, method and outcome.",
+		kind:   "histogram",
+		labels: []string{"upstream", "method", "outcome"},
+	}
+	families = []*family{requests, requestDuration, queryDuration, upstreamDuration}
+)
+
+// ObserveRequest records one served request. route is the pattern that
+// matched, not the path, so ids in paths do not make new series.
+func ObserveRequest(route, method string, status int, took time.Duration) {
+	requests.inc(route, method, strconv.Itoa(status))
+	requestDuration.observe(took, route, method)
+}
+
+// ObserveQuery records one statement on pool ("reader" or "writer").
+func ObserveQuery(pool, op string, took time.Duration) {
+	queryDuration.observe(took, pool, op)
+}
+
+// ObserveUpstream records one call to an upstream service.
+func ObserveUpstream(upstream, method string, err error, took time.Duration) {
+	outcome := "ok"
+	if err != nil {
+		outcome = "error"
+	}
+	upstreamDuration.observe(took, upstream, method, outcome)
+}
+
+// Handler serves every metric in the Prometheus text format.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		for _, f := range families {
+			f.write(w)
+		}
+		fmt.Fprintf(w, "# HELP sona_goroutines Goroutines that currently exist.\n# TYPE sona_goroutines gauge\nsona_goroutines %d\n", runtime.NumGoroutine())
+		fmt.Fprintf(w, "# HELP sona_start_time_seconds When the process started, in Unix seconds.\n# TYPE sona_start_time_seconds gauge\nsona_start_time_seconds %d\n", started.Unix())
+	})
+}
+
+type series struct {
+	values []string
+	count  uint64
+	sum    float64
+	// counts holds a histogram's per-bucket counts; the last is +Inf
+	counts []uint64
+}
+
+type family struct {
+	name, help, kind string
+	labels           []string
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+// get returns the series for values; f.mu must be held.
+func (f *family) get(values []string) *series {
+	key := strings.Join(values, "\xff")
+	s := f.series[key]
+	if s == nil {
+		if f.series == nil {
+			f.series = map[string]*series{}
+		}
+		s = &series{values: values}
+		if f.kind == "histogram" {
+			s.counts = make([]uint64, len(buckets)+1)
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+func (f *family) inc(values ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.get(values).count++
+}
+
+func (f *family) observe(took time.Duration, values ...string) {
+	secs := took.Seconds()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s := f.get(values)
+	s.count++
+	s.sum += secs
+	s.counts[sort.SearchFloat64s(buckets, secs)]++
+}
+
+func (f *family) write(w io.Writer) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.kind)
+	keys := make([]string, 0, len(f.series))
+	for k := range f.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		s := f.series[k]
+		labels := f.labelPairs(s.values)
+		if f.kind != "histogram" {
+			fmt.Fprintf(w, "%s{%s} %d\n", f.name, labels, s.count)
+			continue
+		}
+		var cum uint64
+		for i, n := range s.counts {
+			cum += n
+			le := "+Inf"
+			if i < len(buckets) {
+				le = strconv.FormatFloat(buckets[i], 'g', -1, 64)
+			}
+			fmt.Fprintf(w, "%s_bucket{%s,le=%q} %d\n", f.name, labels, le, cum)
+		}
+		fmt.Fprintf(w, "%s_sum{%s} %s\n", f.name, labels, strconv.FormatFloat(s.sum, 'g', -1, 64))
+		fmt.Fprintf(w, "%s_count{%s} %d\n", f.name, labels, s.count)
+	}
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func (f *family) labelPairs(values []string) string {
+	pairs := make([]string, len(values))
+	for i, v := range values {
+		pairs[i] = f.labels[i] + `="` + labelEscaper.Replace(v) + `"`
+	}
+	return strings.Join(pairs, ",")
+}
@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"net/http"
+	"strings"
 )
 
 func RequireBearer(token string, next http.Handler) http.Handler {
@@ -27,3 +28,25 @@ func RequireBearer(token string, next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// TokenCheck validates a bearer token that is not the app key. It writes the
+// error response itself and reports whether the request may proceed.
+type TokenCheck func(w http.ResponseWriter, r *http.Request, token string) bool
+
+// RequireBearerOr accepts the app key like RequireBearer, and hands any other
+// bearer token to check.
+func RequireBearerOr(token string, check TokenCheck, next http.Handler) http.Handler {
+	app := RequireBearer(token, next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		other, ok := strings.CutPrefix(auth, "Bearer ")
+		if r.Method == "OPTIONS" || !ok || other == token || other == "" {
+			app.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		if check(w, r, other) {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
@@ -0,0 +1,144 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Kill switches other than a single route.
+const (
+	KillMaintenance = "maintenance"
+	KillMoney       = "money"
+)
+
+// KillSwitches turn routes away with 503 during an incident. "money" takes
+// down the money routes, "maintenance" everything but the read routes, and
+// a route path just that route. /admin/ is never switched off, and GET and
+// HEAD pass so links keep showing what they point at.
+type KillSwitches struct {
+	load        func(context.Context) (map[string]string, error)
+	moneyRoutes []string
+	readRoutes  []string
+	message     string
+
+	on     atomic.Pointer[map[string]string]
+	turned atomic.Int64
+}
+
+// NewKillSwitches reads the switches that are on, with their messages,
+// from load. message is used for switches without one.
+func NewKillSwitches(load func(context.Context) (map[string]string, error), moneyRoutes, readRoutes []string, message string) *KillSwitches {
+	k := &KillSwitches{load: load, moneyRoutes: moneyRoutes, readRoutes: readRoutes, message: message}
+	k.on.Store(&map[string]string{})
+	return k
+}
+
+// Reload rereads the switches. On error the last ones read stay in force.
+func (k *KillSwitches) Reload(ctx context.Context) error {
+	on, err := k.load(ctx)
+	if err != nil {
+		return err
+	}
+	k.on.Store(&on)
+	return nil
+}
+
+// Run rereads the switches every interval until ctx is done, so a switch
+// flipped on one server reaches all of them.
+func (k *KillSwitches) Run(ctx context.Context, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := k.Reload(ctx); err != nil {
+				log.Printf("kill switches: reload: %v", err)
+			}
+		}
+	}
+}
+
+// ReloadAfter runs next, then rereads the switches, so a flag changed
+// through next applies on this server at once.
+func (k *KillSwitches) ReloadAfter(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r)
+		if err := k.Reload(r.Context()); err != nil {
+			log.Printf("kill switches: reload: %v", err)
+		}
+	})
+}
+
+// blocking returns the switch that takes path down, if any.
+func (k *KillSwitches) blocking(path string) (string, string, bool) {
+	on := *k.on.Load()
+	if len(on) == 0 || strings.HasPrefix(path, "/admin/") {
+		return "", "", false
+	}
+	for name, msg := range on {
+		if name == path || (strings.HasSuffix(name, "/") && strings.HasPrefix(path, name)) {
+			return name, msg, true
+		}
+	}
+	if msg, ok := on[KillMoney]; ok && matchRoute(path, k.moneyRoutes) {
+		return KillMoney, msg, true
+	}
+	if msg, ok := on[KillMaintenance]; ok && !matchRoute(path, k.readRoutes) {
+		return KillMaintenance, msg, true
+	}
+	return "", "", false
+}
+
+func (k *KillSwitches) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		name, msg, blocked := k.blocking(r.URL.Path)
+		if !blocked {
+			next.ServeHTTP(w, r)
+			return
+		}
+		k.turned.Add(1)
+		if msg == "" {
+			msg = k.message
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": msg, "kill_switch": name})
+	})
+}
+
+// ServeHTTP reports the switches that are on and how many requests they
+// turned away since start.
+func (k *KillSwitches) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	on := *k.on.Load()
+	names := make([]string, 0, len(on))
+	for name := range on {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"on": names, "turned_away": k.turned.Load()})
+}
+
+// matchRoute reports whether path is one of routes, where a route ending
+// in "/" covers everything below it.
+func matchRoute(path string, routes []string) bool {
+	for _, p := range routes {
+		if path == p || (strings.HasSuffix(p, "/") && strings.HasPrefix(path, p)) {
+			return true
+		}
+	}
+	return false
+}
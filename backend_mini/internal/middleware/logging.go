@@ -2,12 +2,96 @@ package middleware
 
 import (
 	"bytes"
+	"encoding/json"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
 	"time"
 )
 
+const redacted = "[redacted]"
+
+// credentials must never reach the logs, in either direction: tokens and
+// keys the server issues are masked wherever they appear
+var secretPattern = regexp.MustCompile(`\b(sona_(?:pat|dlg|act|partner|ast)_|whsec_)[A-Za-z0-9_]+`)
+
+// secretFields are body fields whose values are masked whole: issued
+// tokens and keys, session JWTs, ID tokens, webhook secrets, gift links
+// and kid PINs.
+var secretFields = map[string]bool{
+	"token":         true,
+	"secret":        true,
+	"key":           true,
+	"link":          true,
+	"pin":           true,
+	"id_token":      true,
+	"session_token": true,
+	"access_token":  true,
+	"refresh_token": true,
+	"client_secret": true,
+}
+
+// sensitiveHeaders are masked whole, whatever their scheme.
+var sensitiveHeaders = []string{"Authorization", "Cookie"}
+
+func redact(s string) string {
+	return secretPattern.ReplaceAllString(s, "${1}"+redacted)
+}
+
+// redactBody masks secretFields in a JSON or form body, then any issued
+// credential left anywhere else in it.
+func redactBody(body []byte, contentType string) string {
+	var doc any
+	if err := json.Unmarshal(body, &doc); err == nil {
+		if out, err := json.Marshal(redactJSON(doc)); err == nil {
+			return redact(string(out))
+		}
+	}
+	if strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		if form, err := url.ParseQuery(string(body)); err == nil {
+			for k := range form {
+				if secretFields[k] {
+					form.Set(k, redacted)
+				}
+			}
+			return redact(form.Encode())
+		}
+	}
+	return redact(string(body))
+}
+
+func redactJSON(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, x := range v {
+			if secretFields[k] {
+				v[k] = redacted
+				continue
+			}
+			v[k] = redactJSON(x)
+		}
+	case []any:
+		for i, x := range v {
+			v[i] = redactJSON(x)
+		}
+	}
+	return v
+}
+
+func redactHeaders(h http.Header) http.Header {
+	h = h.Clone()
+	for _, name := range sensitiveHeaders {
+		if h.Get(name) != "" {
+			h.Set(name, redacted)
+		}
+	}
+	return h
+}
+
 type responseRecorder struct {
 	http.ResponseWriter
 	status int
@@ -24,7 +108,19 @@ func (rr *responseRecorder) Write(b []byte) (int, error) {
 	return rr.ResponseWriter.Write(b)
 }
 
-func LogRequests(next http.Handler) http.Handler {
+// LogRequests logs each request and response with credentials masked. The
+// route is the pattern that matched rather than the path, since some paths
+// carry secrets (gift tokens, the inbound mail secret). Each of secrets,
+// such as the admin key, is masked wherever it appears.
+func LogRequests(next http.Handler, secrets ...string) http.Handler {
+	var pairs []string
+	for _, s := range secrets {
+		if s != "" {
+			pairs = append(pairs, s, redacted)
+		}
+	}
+	known := strings.NewReplacer(pairs...)
+
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 
@@ -38,7 +134,11 @@ func LogRequests(next http.Handler) http.Handler {
 		next.ServeHTTP(recorder, r)
 
 		dur := time.Since(start)
-		log.Printf("REQ %s %s from %s\nHeaders: %v\nBody: %s", r.Method, r.URL.Path, r.RemoteAddr, r.Header, string(reqBody))
-		log.Printf("RESP %s %s status=%d duration=%s\nBody: %s", r.Method, r.URL.Path, recorder.status, dur, recorder.buf.String())
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		log.Print(known.Replace(fmt.Sprintf("REQ %s %s from %s\nHeaders: %v\nBody: %s", r.Method, route, r.RemoteAddr, redactHeaders(r.Header), redactBody(reqBody, r.Header.Get("Content-Type")))))
+		log.Print(known.Replace(fmt.Sprintf("RESP %s %s status=%d duration=%s\nBody: %s", r.Method, route, recorder.status, dur, redactBody(recorder.buf.Bytes(), recorder.Header().Get("Content-Type")))))
 	})
 }
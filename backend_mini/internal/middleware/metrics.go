@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"backend_mini/internal/metrics"
+)
+
+// Instrument reports each request's count, status and latency to the
+// metrics package, labelled by the pattern the mux matched. Paths nothing
+// matched share one label, as do unknown methods, so scans add no series.
+func Instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		metrics.ObserveRequest(route, methodLabel(r.Method), recorder.status, time.Since(start))
+	})
+}
+
+// knownMethods are the methods that get their own label. The method is
+// whatever the client sent, so anything else shares "other" and made-up
+// methods add no series.
+var knownMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+}
+
+func methodLabel(m string) string {
+	if knownMethods[m] {
+		return m
+	}
+	return "other"
+}
@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"backend_mini/internal/metrics"
+)
+
+func TestInstrumentFoldsUnknownMethods(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/instrument_test", func(w http.ResponseWriter, r *http.Request) {})
+	h := Instrument(mux)
+	for _, m := range []string{"BREW", "PROPFIND", "X-JUNK-1234", http.MethodPost} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(m, "/instrument_test", nil))
+	}
+
+	rec := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	var got []string
+	for _, line := range strings.Split(rec.Body.String(), "\n") {
+		if strings.HasPrefix(line, "sona_http_requests_total{") && strings.Contains(line, `route="/instrument_test"`) {
+			got = append(got, line)
+		}
+	}
+	want := []string{
+		`sona_http_requests_total{route="/instrument_test",method="POST",status="200"} 1`,
+		`sona_http_requests_total{route="/instrument_test",method="other",status="200"} 3`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("series:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
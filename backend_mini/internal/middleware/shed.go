@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// Shedder turns away low-priority requests with 503 while the server is
+// overloaded, so money movement keeps its share of the single writer.
+// Overload is too many requests in flight, or the database making queries
+// wait for a connection too often.
+type Shedder struct {
+	maxInFlight int64
+	maxDBWaits  int64
+	lowPriority []string
+	dbWaits     func() int64
+
+	inFlight   atomic.Int64
+	dbWaitRate atomic.Int64
+	shed       atomic.Int64
+}
+
+// NewShedder sheds the given routes. dbWaits is a cumulative count of
+// connection waits; Run turns it into a rate.
+func NewShedder(maxInFlight, maxDBWaits int, lowPriority []string, dbWaits func() int64) *Shedder {
+	return &Shedder{maxInFlight: int64(maxInFlight), maxDBWaits: int64(maxDBWaits), lowPriority: lowPriority, dbWaits: dbWaits}
+}
+
+// Run samples the database wait rate once a second until ctx is done.
+func (s *Shedder) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	last := s.dbWaits()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			now := s.dbWaits()
+			s.dbWaitRate.Store(now - last)
+			last = now
+		}
+	}
+}
+
+func (s *Shedder) isLowPriority(path string) bool {
+	return matchRoute(path, s.lowPriority)
+}
+
+// overloaded reports whether the server is past either threshold.
+func (s *Shedder) overloaded() bool {
+	return s.inFlight.Load() > s.maxInFlight || s.dbWaitRate.Load() > s.maxDBWaits
+}
+
+func (s *Shedder) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.inFlight.Add(1)
+		defer s.inFlight.Add(-1)
+		if s.isLowPriority(r.URL.Path) && s.overloaded() {
+			s.shed.Add(1)
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte(`{"error":"server is busy, retry shortly"}`))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ServeHTTP reports the current load and how many requests were shed
+// since start.
+func (s *Shedder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]int64{
+		"in_flight":           s.inFlight.Load(),
+		"db_waits_per_second": s.dbWaitRate.Load(),
+		"shed":                s.shed.Load(),
+	})
+}
@@ -0,0 +1,74 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"backend_mini/internal/config"
+	"backend_mini/internal/db"
+	"backend_mini/internal/webhook"
+)
+
+// Email sends the parent an email about an event, in the background. Its
+// copy comes from the active email template named after the event type,
+// or subject and body when there is none. Emails are transactional, so
+// muted types and pauses do not hold them back.
+func (n *Notifier) Email(ctx context.Context, to, eventType string, data any, subject, body string) {
+	ev := webhook.Event{Type: eventType, CreatedAt: time.Now().UTC().Format(time.RFC3339), Data: data}
+	t, found, err := n.db.GetTemplate(ctx, eventType, db.ChannelEmail, 0)
+	if err != nil {
+		log.Printf("notify: failed loading email template for %s: %v", eventType, err)
+	} else if found {
+		if msg, err := RenderTemplate(t, ev); err != nil {
+			log.Printf("notify: template %s v%d: %v", t.Name, t.Version, err)
+		} else {
+			if s, ok := msg["title"].(string); ok && s != "" {
+				subject = s
+			}
+			if s, ok := msg["body"].(string); ok && s != "" {
+				body = s
+			}
+		}
+	}
+	n.deliveries.Add(1)
+	go func() {
+		defer n.deliveries.Done()
+		if err := sendMail(to, subject, body); err != nil {
+			log.Printf("notify: email %s to %s failed: %v", eventType, to, err)
+		}
+	}()
+}
+
+// sendMail delivers a plain-text email through SMTP_ADDR, or only logs it
+// when no relay is configured.
+func sendMail(to, subject, body string) error {
+	addr := config.SMTPAddr()
+	if addr == "" {
+		log.Printf("email to %s (no SMTP_ADDR, not sent): %s", to, subject)
+		return nil
+	}
+	from, err := mail.ParseAddress(config.SMTPFrom())
+	if err != nil {
+		return fmt.Errorf("SMTP_FROM: %w", err)
+	}
+	var auth smtp.Auth
+	if user := config.SMTPUsername(); user != "" {
+		host, _, _ := net.SplitHostPort(addr)
+		auth = smtp.PlainAuth("", user, config.SMTPPassword(), host)
+	}
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", from.String())
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	return smtp.SendMail(addr, auth, from.Address, []string{to}, []byte(msg.String()))
+}
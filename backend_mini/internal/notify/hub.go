@@ -0,0 +1,66 @@
+package notify
+
+import "sync"
+
+// Hub wakes in-process long-pollers waiting on a key (e.g. a device id).
+// With a broadcaster set, Wake also reaches the hubs of other instances.
+type Hub struct {
+	mu        sync.Mutex
+	waiters   map[string]map[chan struct{}]struct{}
+	broadcast func(key string)
+}
+
+func NewHub() *Hub {
+	return &Hub{waiters: map[string]map[chan struct{}]struct{}{}}
+}
+
+// Wait registers interest in key. The returned channel is closed on the next
+// Wake for key; call cancel when done waiting.
+func (h *Hub) Wait(key string) (<-chan struct{}, func()) {
+	ch := make(chan struct{})
+	h.mu.Lock()
+	if h.waiters[key] == nil {
+		h.waiters[key] = map[chan struct{}]struct{}{}
+	}
+	h.waiters[key][ch] = struct{}{}
+	h.mu.Unlock()
+	return ch, func() {
+		h.mu.Lock()
+		if _, ok := h.waiters[key][ch]; ok {
+			delete(h.waiters[key], ch)
+			if len(h.waiters[key]) == 0 {
+				delete(h.waiters, key)
+			}
+		}
+		h.mu.Unlock()
+	}
+}
+
+// SetBroadcast makes every Wake also call fn, which should end in WakeLocal
+// on the other instances.
+func (h *Hub) SetBroadcast(fn func(key string)) {
+	h.mu.Lock()
+	h.broadcast = fn
+	h.mu.Unlock()
+}
+
+// Wake wakes waiters on key here and, with a broadcaster, everywhere else.
+func (h *Hub) Wake(key string) {
+	h.WakeLocal(key)
+	h.mu.Lock()
+	fn := h.broadcast
+	h.mu.Unlock()
+	if fn != nil {
+		fn(key)
+	}
+}
+
+// WakeLocal wakes only this process's waiters on key.
+func (h *Hub) WakeLocal(key string) {
+	h.mu.Lock()
+	for ch := range h.waiters[key] {
+		close(ch)
+	}
+	delete(h.waiters, key)
+	h.mu.Unlock()
+}
@@ -0,0 +1,257 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"backend_mini/internal/config"
+	"backend_mini/internal/db"
+	"backend_mini/internal/eventfilter"
+	"backend_mini/internal/relay"
+	"backend_mini/internal/webhook"
+)
+
+type Notifier struct {
+	db  *db.DB
+	hub *Hub
+	// deliveries tracks webhook, integration and email sends still going
+	deliveries sync.WaitGroup
+}
+
+func New(d *db.DB) *Notifier { return &Notifier{db: d, hub: NewHub()} }
+
+// Hub is woken on every emitted event under EventsKey(parent email).
+func (n *Notifier) Hub() *Hub { return n.hub }
+
+// EventsKey is the hub key long-pollers of a parent's events wait on.
+func EventsKey(parentEmail string) string {
+	return "events:" + strings.ToLower(parentEmail)
+}
+
+// Emit stores a domain event for the parent, wakes their long-pollers and
+// fans it out to their webhooks and integrations in the background. Events
+// of a muted type, or about a paused family or kid, are only stored.
+func (n *Notifier) Emit(ctx context.Context, eventType, parentEmail string, data any) (*db.Event, error) {
+	ev, err := n.db.AddEvent(ctx, eventType, parentEmail, data)
+	if err != nil {
+		return nil, err
+	}
+	n.hub.Wake(EventsKey(parentEmail))
+	settings, err := n.db.GetFamilySettings(ctx, parentEmail)
+	if err != nil {
+		log.Printf("notify: failed loading settings for %s: %v", parentEmail, err)
+	} else if settings.Notifications.Muted(ev.Type) {
+		// still stored above, so pollers see it
+		return ev, nil
+	}
+	if n.paused(ctx, parentEmail, data) {
+		return ev, nil
+	}
+	out := webhook.Event{Type: ev.Type, CreatedAt: ev.CreatedAt, Data: data}
+	out.Message = n.message(ctx, out)
+	n.relay(ctx, parentEmail, out)
+	hooks, err := n.db.GetWebhooksByParentEmail(ctx, parentEmail)
+	if err != nil {
+		log.Printf("notify: failed loading webhooks for %s: %v", parentEmail, err)
+		return ev, nil
+	}
+	for _, wh := range hooks {
+		n.deliveries.Add(1)
+		go func(wh db.Webhook) {
+			defer n.deliveries.Done()
+			shaped, ok, err := ShapeWebhookEvent(&wh, out)
+			if err != nil {
+				log.Printf("notify: webhook %s: %v", wh.WebhookID, err)
+				return
+			}
+			if !ok {
+				return
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+			defer cancel()
+			res, err := webhook.Send(ctx, wh.URL, wh.Secret, shaped)
+			if err != nil {
+				log.Printf("notify: webhook %s delivery failed: %v", wh.WebhookID, err)
+				return
+			}
+			if res.StatusCode >= 300 {
+				log.Printf("notify: webhook %s answered %d", wh.WebhookID, res.StatusCode)
+			}
+		}(wh)
+	}
+	return ev, nil
+}
+
+// ShapeWebhookEvent applies the webhook's filter and transform to ev. ok
+// is false when the filter leaves the event out. A filter that cannot be
+// evaluated against the event is an error and the event is not delivered.
+func ShapeWebhookEvent(wh *db.Webhook, ev webhook.Event) (webhook.Event, bool, error) {
+	if wh.Filter == "" && len(wh.Transform) == 0 {
+		return ev, true, nil
+	}
+	f, err := eventfilter.Compile(wh.Filter)
+	if err != nil {
+		return ev, false, fmt.Errorf("filter: %w", err)
+	}
+	doc, err := relay.Document(ev)
+	if err != nil {
+		return ev, false, err
+	}
+	if ok, err := f.Match(doc); err != nil || !ok {
+		if err != nil {
+			err = fmt.Errorf("filter on %s: %w", ev.Type, err)
+		}
+		return ev, false, err
+	}
+	if len(wh.Transform) == 0 {
+		return ev, true, nil
+	}
+	data, err := relay.Render(wh.Transform, ev)
+	if err != nil {
+		return ev, false, err
+	}
+	// the transform decides everything the receiver sees besides the envelope
+	return webhook.Event{Type: ev.Type, CreatedAt: ev.CreatedAt, Data: data}, true, nil
+}
+
+// Wait blocks until deliveries already started have finished, or until
+// ctx is done, in which case it returns ctx's error. Sends started while it
+// waits are waited for too.
+func (n *Notifier) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		n.deliveries.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// paused reports whether a pause covers the family, or the kid the event
+// is about: the one named by its kid_email or, for chores, child_wallet.
+func (n *Notifier) paused(ctx context.Context, parentEmail string, data any) bool {
+	var about struct {
+		KidEmail    string `json:"kid_email"`
+		ChildWallet string `json:"child_wallet"`
+	}
+	if buf, err := json.Marshal(data); err == nil {
+		_ = json.Unmarshal(buf, &about)
+	}
+	if about.KidEmail == "" && about.ChildWallet != "" {
+		if kid, found, err := n.db.GetChildByWallet(ctx, about.ChildWallet); err == nil && found {
+			about.KidEmail = kid.Email
+		}
+	}
+	until, err := n.db.PausedUntil(ctx, parentEmail, about.KidEmail, time.Now())
+	if err != nil {
+		log.Printf("notify: failed checking pauses for %s: %v", parentEmail, err)
+		return false
+	}
+	return until != ""
+}
+
+// message renders the active push template for the event's type. Events
+// without one, or whose template fails to render, go out without copy.
+func (n *Notifier) message(ctx context.Context, ev webhook.Event) map[string]any {
+	t, found, err := n.db.GetTemplate(ctx, ev.Type, db.ChannelPush, 0)
+	if err != nil {
+		log.Printf("notify: failed loading template for %s: %v", ev.Type, err)
+		return nil
+	}
+	if !found {
+		return nil
+	}
+	msg, err := RenderTemplate(t, ev)
+	if err != nil {
+		log.Printf("notify: template %s v%d: %v", t.Name, t.Version, err)
+		return nil
+	}
+	return msg
+}
+
+// RenderTemplate fills the template's title and body from ev, with the
+// same {{path}} placeholders as integration templates.
+func RenderTemplate(t *db.MessageTemplate, ev webhook.Event) (map[string]any, error) {
+	return relay.Render(TemplateFields(t), ev)
+}
+
+// TemplateFields is the template as a relay template.
+func TemplateFields(t *db.MessageTemplate) map[string]string {
+	fields := map[string]string{"body": t.Body}
+	if t.Title != "" {
+		fields["title"] = t.Title
+	}
+	return fields
+}
+
+// relay delivers the event to the parent's Zapier/IFTTT integrations that
+// subscribe to its type, rendered through each integration's template.
+func (n *Notifier) relay(ctx context.Context, parentEmail string, ev webhook.Event) {
+	integrations, err := n.db.ListIntegrations(ctx, parentEmail)
+	if err != nil {
+		log.Printf("notify: failed loading integrations for %s: %v", parentEmail, err)
+		return
+	}
+	for _, in := range integrations {
+		if !in.Wants(ev.Type) {
+			continue
+		}
+		n.deliveries.Add(1)
+		go func(in db.Integration) {
+			defer n.deliveries.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+			defer cancel()
+			res, _, err := Relay(ctx, &in, ev)
+			if err != nil {
+				log.Printf("notify: integration %s delivery failed: %v", in.IntegrationID, err)
+				return
+			}
+			if res.StatusCode >= 300 {
+				log.Printf("notify: integration %s answered %d", in.IntegrationID, res.StatusCode)
+			}
+		}(in)
+	}
+}
+
+// Relay renders ev for the integration and posts it, returning the body sent.
+func Relay(ctx context.Context, in *db.Integration, ev webhook.Event) (*webhook.Result, map[string]any, error) {
+	tmpl := in.Template
+	if tmpl == nil {
+		tmpl = relay.DefaultTemplate(in.Kind)
+	}
+	body, err := relay.Render(tmpl, ev)
+	if err != nil {
+		return nil, nil, err
+	}
+	res, err := relay.Send(ctx, in.URL, body)
+	return res, body, err
+}
+
+// OpsAlert logs an operational alert and, when OPS_WEBHOOK_URL is set,
+// sends it there as a signed webhook event.
+func OpsAlert(eventType string, data any) {
+	log.Printf("ops alert %s: %+v", eventType, data)
+	url := config.OpsWebhookURL()
+	if url == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	res, err := webhook.SendOps(ctx, url, config.OpsWebhookSecret(), webhook.Event{Type: eventType, Data: data})
+	if err != nil {
+		log.Printf("notify: ops alert delivery failed: %v", err)
+		return
+	}
+	if res.StatusCode >= 300 {
+		log.Printf("notify: ops webhook answered %d", res.StatusCode)
+	}
+}
@@ -0,0 +1,78 @@
+// Package ops serves diagnostics (pprof, runtime stats and Prometheus
+// metrics) on a listener of its own, kept off the public API port and
+// behind its own key.
+package ops
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"strconv"
+	"time"
+
+	"backend_mini/internal/metrics"
+)
+
+const maxProfileSeconds = 120
+
+var started = time.Now()
+
+// Handler serves /debug/pprof/*, /runtime, /cpu_profile and /metrics.
+// dbs are reported by name in /runtime.
+func Handler(dbs map[string]*sql.DB) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("/runtime", func(w http.ResponseWriter, r *http.Request) {
+		writeRuntime(w, dbs)
+	})
+	mux.HandleFunc("/cpu_profile", cpuProfile)
+	mux.Handle("/metrics", metrics.Handler())
+	return mux
+}
+
+// cpuProfile captures a CPU profile for ?seconds= (default 30, at most
+// 120) and returns it for `go tool pprof`.
+func cpuProfile(w http.ResponseWriter, r *http.Request) {
+	seconds := 30
+	if v := r.URL.Query().Get("seconds"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxProfileSeconds {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"seconds must be between 1 and 120"}`))
+			return
+		}
+		seconds = n
+	}
+	q := r.URL.Query()
+	q.Set("seconds", strconv.Itoa(seconds))
+	r.URL.RawQuery = q.Encode()
+	pprof.Profile(w, r)
+}
+
+func writeRuntime(w http.ResponseWriter, dbs map[string]*sql.DB) {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	pools := map[string]sql.DBStats{}
+	for name, d := range dbs {
+		pools[name] = d.Stats()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"uptime_seconds":   int64(time.Since(started).Seconds()),
+		"goroutines":       runtime.NumGoroutine(),
+		"heap_alloc_bytes": m.HeapAlloc,
+		"heap_inuse_bytes": m.HeapInuse,
+		"heap_objects":     m.HeapObjects,
+		"sys_bytes":        m.Sys,
+		"num_gc":           m.NumGC,
+		"gc_pause_total":   time.Duration(m.PauseTotalNs).String(),
+		"db_pools":         pools,
+	})
+}
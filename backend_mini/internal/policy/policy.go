@@ -0,0 +1,202 @@
+// Package policy evaluates a family's rules document: an ordered list of
+// rules, each a set of conditions on an action (amount, recipient, actor,
+// time) and the effect to apply when they all hold. The first matching rule
+// decides; when none matches the action is allowed.
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Actions that are checked against the policy.
+const (
+	ActionTransfer      = "transfer"
+	ActionScreenTimeFee = "screen_time_fee"
+	ActionReversal      = "reversal"
+)
+
+// Effects a rule can have.
+const (
+	EffectAllow           = "allow"
+	EffectDeny            = "deny"
+	EffectRequireApproval = "require_approval"
+)
+
+// Actors an input can come from.
+const (
+	ActorParent = "parent"
+	ActorKid    = "kid"
+	ActorToken  = "token"
+)
+
+const maxRules = 100
+
+var (
+	validActions = map[string]bool{ActionTransfer: true, ActionScreenTimeFee: true, ActionReversal: true}
+	validEffects = map[string]bool{EffectAllow: true, EffectDeny: true, EffectRequireApproval: true}
+	validActors  = map[string]bool{ActorParent: true, ActorKid: true, ActorToken: true}
+	weekdays     = map[string]time.Weekday{"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday, "thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday}
+)
+
+type Document struct {
+	Rules []Rule `json:"rules"`
+}
+
+type Rule struct {
+	ID     string    `json:"id"`
+	Effect string    `json:"effect"`
+	When   Condition `json:"when"`
+	Note   string    `json:"note,omitempty"`
+}
+
+// Condition fields left empty match anything. Amounts are EURC micro-units;
+// hours are UTC, From inclusive and To exclusive, and may wrap midnight.
+type Condition struct {
+	Action        string   `json:"action,omitempty"`
+	Actors        []string `json:"actors,omitempty"`
+	AmountOver    *uint64  `json:"amount_over,omitempty"`
+	AmountAtMost  *uint64  `json:"amount_at_most,omitempty"`
+	RecipientIn   []string `json:"recipient_in,omitempty"`
+	RecipientNot  []string `json:"recipient_not_in,omitempty"`
+	Weekdays      []string `json:"weekdays,omitempty"`
+	HoursFromUTC  *int     `json:"hours_from_utc,omitempty"`
+	HoursUntilUTC *int     `json:"hours_until_utc,omitempty"`
+}
+
+type Input struct {
+	Action    string    `json:"action"`
+	Actor     string    `json:"actor"`
+	Amount    uint64    `json:"amount"`
+	Recipient string    `json:"recipient,omitempty"`
+	At        time.Time `json:"at"`
+}
+
+type Decision struct {
+	Effect string `json:"effect"`
+	RuleID string `json:"rule_id,omitempty"`
+	Note   string `json:"note,omitempty"`
+}
+
+// Allowed reports whether the action may go ahead without anyone's approval.
+func (d Decision) Allowed() bool { return d.Effect == EffectAllow }
+
+// Validate checks the document and fills in missing rule ids.
+func (doc *Document) Validate() error {
+	if len(doc.Rules) > maxRules {
+		return fmt.Errorf("at most %d rules are allowed", maxRules)
+	}
+	seen := map[string]bool{}
+	for i := range doc.Rules {
+		r := &doc.Rules[i]
+		if r.ID == "" {
+			r.ID = fmt.Sprintf("rule-%d", i+1)
+		}
+		if seen[r.ID] {
+			return fmt.Errorf("duplicate rule id %q", r.ID)
+		}
+		seen[r.ID] = true
+		if !validEffects[r.Effect] {
+			return fmt.Errorf("rule %s: effect must be allow, deny or require_approval", r.ID)
+		}
+		if err := r.When.validate(); err != nil {
+			return fmt.Errorf("rule %s: %w", r.ID, err)
+		}
+	}
+	return nil
+}
+
+func (c *Condition) validate() error {
+	if c.Action != "" && !validActions[c.Action] {
+		return errors.New("action must be transfer or screen_time_fee")
+	}
+	for _, a := range c.Actors {
+		if !validActors[a] {
+			return fmt.Errorf("unknown actor %q", a)
+		}
+	}
+	for _, d := range c.Weekdays {
+		if _, ok := weekdays[strings.ToLower(d)]; !ok {
+			return fmt.Errorf("unknown weekday %q", d)
+		}
+	}
+	if (c.HoursFromUTC == nil) != (c.HoursUntilUTC == nil) {
+		return errors.New("hours_from_utc and hours_until_utc go together")
+	}
+	if c.HoursFromUTC != nil && (*c.HoursFromUTC < 0 || *c.HoursFromUTC > 23 || *c.HoursUntilUTC < 0 || *c.HoursUntilUTC > 24) {
+		return errors.New("hours must be between 0 and 24")
+	}
+	if c.AmountOver != nil && c.AmountAtMost != nil && *c.AmountAtMost <= *c.AmountOver {
+		return errors.New("amount_at_most must be greater than amount_over")
+	}
+	return nil
+}
+
+// Evaluate returns the effect of the first rule matching in.
+func (doc *Document) Evaluate(in Input) Decision {
+	if doc == nil {
+		return Decision{Effect: EffectAllow}
+	}
+	for _, r := range doc.Rules {
+		if r.When.matches(in) {
+			return Decision{Effect: r.Effect, RuleID: r.ID, Note: r.Note}
+		}
+	}
+	return Decision{Effect: EffectAllow}
+}
+
+func (c *Condition) matches(in Input) bool {
+	if c.Action != "" && c.Action != in.Action {
+		return false
+	}
+	if len(c.Actors) > 0 && !contains(c.Actors, in.Actor) {
+		return false
+	}
+	if c.AmountOver != nil && in.Amount <= *c.AmountOver {
+		return false
+	}
+	if c.AmountAtMost != nil && in.Amount > *c.AmountAtMost {
+		return false
+	}
+	if len(c.RecipientIn) > 0 && !contains(c.RecipientIn, in.Recipient) {
+		return false
+	}
+	if len(c.RecipientNot) > 0 && contains(c.RecipientNot, in.Recipient) {
+		return false
+	}
+	at := in.At.UTC()
+	if len(c.Weekdays) > 0 {
+		ok := false
+		for _, d := range c.Weekdays {
+			if weekdays[strings.ToLower(d)] == at.Weekday() {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	if c.HoursFromUTC != nil {
+		from, until, h := *c.HoursFromUTC, *c.HoursUntilUTC, at.Hour()
+		if from <= until {
+			if h < from || h >= until {
+				return false
+			}
+		} else if h < from && h >= until {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
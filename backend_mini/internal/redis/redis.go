@@ -0,0 +1,259 @@
+// Package redis is a small RESP2 client covering what shared state needs:
+// plain commands, pipelines and pub/sub. Connections are pooled; a
+// connection that saw an error is dropped instead of returned.
+package redis
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	dialTimeout = 3 * time.Second
+	ioTimeout   = 3 * time.Second
+	maxIdle     = 8
+)
+
+// Error is an error reply from the server.
+type Error string
+
+func (e Error) Error() string { return "redis: " + string(e) }
+
+// ErrNil is returned by the typed helpers for a nil reply.
+var ErrNil = errors.New("redis: nil")
+
+type Client struct {
+	addr     string
+	password string
+	db       int
+	idle     chan *conn
+}
+
+type conn struct {
+	net.Conn
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+// New parses redis://[:password@]host[:port][/db]. It does not connect.
+func New(rawURL string) (*Client, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "redis" || u.Hostname() == "" {
+		return nil, fmt.Errorf("redis: url must look like redis://[:password@]host:port/db")
+	}
+	c := &Client{addr: u.Host, idle: make(chan *conn, maxIdle)}
+	if u.Port() == "" {
+		c.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		c.password, _ = u.User.Password()
+	}
+	if p := strings.Trim(u.Path, "/"); p != "" {
+		if c.db, err = strconv.Atoi(p); err != nil || c.db < 0 {
+			return nil, fmt.Errorf("redis: invalid database %q", p)
+		}
+	}
+	return c, nil
+}
+
+func (c *Client) dial(ctx context.Context) (*conn, error) {
+	d := net.Dialer{Timeout: dialTimeout}
+	nc, err := d.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return nil, err
+	}
+	cn := &conn{Conn: nc, r: bufio.NewReader(nc), w: bufio.NewWriter(nc)}
+	var setup [][]string
+	if c.password != "" {
+		setup = append(setup, []string{"AUTH", c.password})
+	}
+	if c.db != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(c.db)})
+	}
+	if len(setup) > 0 {
+		if _, err := cn.roundTrip(setup); err != nil {
+			nc.Close()
+			return nil, err
+		}
+	}
+	return cn, nil
+}
+
+func (c *Client) get(ctx context.Context) (*conn, error) {
+	select {
+	case cn := <-c.idle:
+		return cn, nil
+	default:
+		return c.dial(ctx)
+	}
+}
+
+func (c *Client) put(cn *conn, err error) {
+	var reply Error
+	if err != nil && !errors.As(err, &reply) {
+		cn.Close()
+		return
+	}
+	select {
+	case c.idle <- cn:
+	default:
+		cn.Close()
+	}
+}
+
+// Do runs one command and returns its reply: string, int64, nil, []any or
+// an Error.
+func (c *Client) Do(ctx context.Context, args ...string) (any, error) {
+	replies, err := c.Pipeline(ctx, [][]string{args})
+	if err != nil {
+		return nil, err
+	}
+	return replies[0], nil
+}
+
+// Pipeline sends the commands in one write and reads every reply. The
+// first error reply is returned alongside all replies.
+func (c *Client) Pipeline(ctx context.Context, cmds [][]string) ([]any, error) {
+	cn, err := c.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	replies, err := cn.roundTrip(cmds)
+	c.put(cn, err)
+	return replies, err
+}
+
+// Ping checks the server is reachable.
+func (c *Client) Ping(ctx context.Context) error {
+	_, err := c.Do(ctx, "PING")
+	return err
+}
+
+// Subscribe delivers messages published to channel until ctx is done or
+// the connection fails, and returns the reason. Callers resubscribe.
+func (c *Client) Subscribe(ctx context.Context, channel string, fn func(payload string)) error {
+	cn, err := c.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer cn.Close()
+	stop := context.AfterFunc(ctx, func() { cn.Close() })
+	defer stop()
+	if err := cn.write([][]string{{"SUBSCRIBE", channel}}); err != nil {
+		return err
+	}
+	for {
+		// pub/sub connections sit idle, so no read deadline here
+		cn.SetReadDeadline(time.Time{})
+		v, err := cn.read()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		msg, ok := v.([]any)
+		if !ok || len(msg) != 3 {
+			continue
+		}
+		if kind, _ := msg[0].(string); kind == "message" {
+			payload, _ := msg[2].(string)
+			fn(payload)
+		}
+	}
+}
+
+func (cn *conn) roundTrip(cmds [][]string) ([]any, error) {
+	if err := cn.write(cmds); err != nil {
+		return nil, err
+	}
+	cn.SetReadDeadline(time.Now().Add(ioTimeout))
+	replies := make([]any, len(cmds))
+	var firstErr error
+	for i := range cmds {
+		v, err := cn.read()
+		if err != nil {
+			return nil, err
+		}
+		if e, ok := v.(Error); ok && firstErr == nil {
+			firstErr = e
+		}
+		replies[i] = v
+	}
+	return replies, firstErr
+}
+
+func (cn *conn) write(cmds [][]string) error {
+	cn.SetWriteDeadline(time.Now().Add(ioTimeout))
+	for _, args := range cmds {
+		fmt.Fprintf(cn.w, "*%d\r\n", len(args))
+		for _, a := range args {
+			fmt.Fprintf(cn.w, "$%d\r\n%s\r\n", len(a), a)
+		}
+	}
+	return cn.w.Flush()
+}
+
+func (cn *conn) read() (any, error) {
+	line, err := cn.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return Error(line[1:]), nil
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(cn.r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		out := make([]any, n)
+		for i := range out {
+			if out[i], err = cn.read(); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("redis: unexpected reply %q", line)
+}
+
+// Int reads an integer reply.
+func Int(v any, err error) (int64, error) {
+	if err != nil {
+		return 0, err
+	}
+	switch v := v.(type) {
+	case int64:
+		return v, nil
+	case nil:
+		return 0, ErrNil
+	}
+	return 0, fmt.Errorf("redis: expected integer, got %T", v)
+}
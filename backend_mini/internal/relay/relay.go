@@ -0,0 +1,179 @@
+// Package relay reshapes domain events into the flat JSON bodies that
+// Zapier "Catch Hook" and IFTTT Maker webhooks expect.
+package relay
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"backend_mini/internal/netguard"
+	"backend_mini/internal/webhook"
+)
+
+const (
+	KindZapier  = "zapier"
+	KindIFTTT   = "ifttt"
+	KindGeneric = "generic"
+)
+
+// client only reaches public addresses: hook URLs are user input.
+var client = netguard.Client(10 * time.Second)
+
+var placeholder = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_.]+)\s*\}\}`)
+
+// DefaultTemplate is used when an integration has no template of its own.
+// Zapier gets every field flattened, so it returns nil for it.
+func DefaultTemplate(kind string) map[string]string {
+	if kind == KindIFTTT {
+		// Maker webhooks only pass value1..value3 on to applets
+		return map[string]string{
+			"value1": "{{type}}",
+			"value2": "{{data.chore_name}}",
+			"value3": "{{created_at}}",
+		}
+	}
+	return nil
+}
+
+// Flatten turns the event into a single-level object with keys joined by
+// underscores, e.g. data.chore.name becomes data_chore_name.
+func Flatten(ev webhook.Event) (map[string]any, error) {
+	doc, err := Document(ev)
+	if err != nil {
+		return nil, err
+	}
+	out := map[string]any{}
+	var walk func(prefix string, v any)
+	walk = func(prefix string, v any) {
+		if m, ok := v.(map[string]any); ok {
+			for k, child := range m {
+				key := k
+				if prefix != "" {
+					key = prefix + "_" + k
+				}
+				walk(key, child)
+			}
+			return
+		}
+		out[prefix] = v
+	}
+	walk("", doc)
+	return out, nil
+}
+
+// Render fills each template value from the event. "{{path}}" looks up a
+// dotted path (type, created_at, data.kid_email, ...). A value that is a
+// single placeholder keeps the field's JSON type; placeholders inside
+// longer strings are interpolated as text. Unknown paths render empty.
+func Render(tmpl map[string]string, ev webhook.Event) (map[string]any, error) {
+	if tmpl == nil {
+		return Flatten(ev)
+	}
+	doc, err := Document(ev)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]any, len(tmpl))
+	for key, t := range tmpl {
+		if m := placeholder.FindStringSubmatch(t); m != nil && m[0] == strings.TrimSpace(t) {
+			out[key] = lookup(doc, m[1])
+			continue
+		}
+		out[key] = placeholder.ReplaceAllStringFunc(t, func(s string) string {
+			v := lookup(doc, placeholder.FindStringSubmatch(s)[1])
+			switch v := v.(type) {
+			case nil:
+				return ""
+			case string:
+				return v
+			default:
+				b, _ := json.Marshal(v)
+				return string(b)
+			}
+		})
+	}
+	return out, nil
+}
+
+// Placeholders lists the paths a template refers to, for validation.
+func Placeholders(tmpl map[string]string) []string {
+	var out []string
+	for _, t := range tmpl {
+		for _, m := range placeholder.FindAllStringSubmatch(t, -1) {
+			out = append(out, m[1])
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Unresolved lists the paths a template refers to that ev has no value for.
+func Unresolved(tmpl map[string]string, ev webhook.Event) ([]string, error) {
+	doc, err := Document(ev)
+	if err != nil {
+		return nil, err
+	}
+	out := []string{}
+	for _, p := range Placeholders(tmpl) {
+		if lookup(doc, p) == nil && (len(out) == 0 || out[len(out)-1] != p) {
+			out = append(out, p)
+		}
+	}
+	return out, nil
+}
+
+// Send posts the rendered body to the integration's hook URL. The
+// receiver's answer is reported without its body.
+func Send(ctx context.Context, url string, body map[string]any) (*webhook.Result, error) {
+	buf, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(buf))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Sona-Relay/1")
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("delivery failed: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 2048))
+	return &webhook.Result{StatusCode: resp.StatusCode, DurationMs: time.Since(start).Milliseconds()}, nil
+}
+
+// Document round-trips the event through JSON so lookups see plain maps.
+func Document(ev webhook.Event) (map[string]any, error) {
+	buf, err := json.Marshal(ev)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(buf, &doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+func lookup(doc map[string]any, path string) any {
+	var cur any = doc
+	for _, part := range strings.Split(path, ".") {
+		m, ok := cur.(map[string]any)
+		if !ok {
+			return nil
+		}
+		cur = m[part]
+	}
+	return cur
+}
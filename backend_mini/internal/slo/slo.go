@@ -0,0 +1,157 @@
+// Package slo tracks per-route latency objectives in process. Each route
+// keeps an hour of per-minute counts of good and bad requests, from which
+// compliance and error-budget burn rates are derived for a short and a
+// long window.
+package slo
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"backend_mini/internal/config"
+)
+
+const (
+	minutes = 60
+	// minAlertRequests keeps a handful of slow requests on a quiet route
+	// from paging anyone.
+	minAlertRequests = 20
+	alertCooldown    = 15 * time.Minute
+)
+
+// Windows the burn rate is reported over. Alerts need both to burn, so a
+// short spike alone does not alert and an old one stops alerting.
+var windows = []struct {
+	name    string
+	minutes int
+}{{"5m", 5}, {"1h", 60}}
+
+type bucket struct {
+	minute     int64
+	total, bad int
+}
+
+type route struct {
+	target    config.SLOTarget
+	buckets   [minutes]bucket
+	lastAlert time.Time
+}
+
+// Alert is sent when a route burns its error budget faster than allowed.
+type Alert struct {
+	Route       string             `json:"route"`
+	Percentile  float64            `json:"percentile"`
+	ThresholdMS int64              `json:"threshold_ms"`
+	BurnRates   map[string]float64 `json:"burn_rates"`
+	AlertAt     float64            `json:"alert_burn_rate"`
+}
+
+type Window struct {
+	Total      int     `json:"total"`
+	Bad        int     `json:"bad"`
+	Compliance float64 `json:"compliance"`
+	BurnRate   float64 `json:"burn_rate"`
+}
+
+type RouteStatus struct {
+	Route       string            `json:"route"`
+	Percentile  float64           `json:"percentile"`
+	ThresholdMS int64             `json:"threshold_ms"`
+	Windows     map[string]Window `json:"windows"`
+}
+
+type Tracker struct {
+	mu        sync.Mutex
+	routes    map[string]*route
+	alertBurn float64
+	onAlert   func(Alert)
+	now       func() time.Time
+}
+
+// New tracks the given targets. onAlert is called in its own goroutine.
+func New(targets []config.SLOTarget, alertBurn float64, onAlert func(Alert)) *Tracker {
+	t := &Tracker{routes: map[string]*route{}, alertBurn: alertBurn, onAlert: onAlert, now: time.Now}
+	for _, target := range targets {
+		t.routes[target.Route] = &route{target: target}
+	}
+	return t
+}
+
+// Observe records one finished request. Routes without a target are ignored.
+func (t *Tracker) Observe(path string, status int, took time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	r := t.routes[path]
+	if r == nil {
+		return
+	}
+	now := t.now()
+	minute := now.Unix() / 60
+	b := &r.buckets[minute%minutes]
+	if b.minute != minute {
+		*b = bucket{minute: minute}
+	}
+	b.total++
+	if status >= 500 || took > r.target.Threshold {
+		b.bad++
+	}
+	if t.onAlert == nil || now.Sub(r.lastAlert) < alertCooldown {
+		return
+	}
+	burns := map[string]float64{}
+	for _, w := range windows {
+		win := r.window(minute, w.minutes)
+		if win.BurnRate < t.alertBurn || (w.minutes == 5 && win.Total < minAlertRequests) {
+			return
+		}
+		burns[w.name] = win.BurnRate
+	}
+	r.lastAlert = now
+	go t.onAlert(Alert{Route: r.target.Route, Percentile: r.target.Percentile, ThresholdMS: r.target.Threshold.Milliseconds(), BurnRates: burns, AlertAt: t.alertBurn})
+}
+
+// window sums the last n minutes up to and including minute. Burn rate is
+// the bad fraction over the fraction the objective allows.
+func (r *route) window(minute int64, n int) Window {
+	var w Window
+	for i := 0; i < n; i++ {
+		b := r.buckets[(minute-int64(i))%minutes]
+		if b.minute == minute-int64(i) {
+			w.Total += b.total
+			w.Bad += b.bad
+		}
+	}
+	w.Compliance = 1
+	if w.Total > 0 {
+		badRatio := float64(w.Bad) / float64(w.Total)
+		w.Compliance = 1 - badRatio
+		w.BurnRate = badRatio / (1 - r.target.Percentile/100)
+	}
+	return w
+}
+
+// Status reports every tracked route, sorted by route.
+func (t *Tracker) Status() []RouteStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	minute := t.now().Unix() / 60
+	out := make([]RouteStatus, 0, len(t.routes))
+	for _, r := range t.routes {
+		s := RouteStatus{Route: r.target.Route, Percentile: r.target.Percentile, ThresholdMS: r.target.Threshold.Milliseconds(), Windows: map[string]Window{}}
+		for _, w := range windows {
+			s.Windows[w.name] = r.window(minute, w.minutes)
+		}
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Route < out[j].Route })
+	return out
+}
+
+// ServeHTTP writes Status as JSON.
+func (t *Tracker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(t.Status())
+}
@@ -0,0 +1,52 @@
+package state
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"backend_mini/internal/notify"
+	"backend_mini/internal/redis"
+	"backend_mini/internal/util"
+)
+
+const wakeChannel = "sona:wake"
+
+// RunRedisBus relays hub wakes between instances over Redis pub/sub until
+// ctx is done, so a long poll on one instance returns as soon as another
+// instance emits. A lost wake only delays a poll until its timeout, since
+// events themselves are stored.
+func RunRedisBus(ctx context.Context, c *redis.Client, hub *notify.Hub) {
+	self, err := util.NewID()
+	if err != nil {
+		log.Printf("state: event bus disabled: %v", err)
+		return
+	}
+	hub.SetBroadcast(func(key string) {
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			if _, err := c.Do(ctx, "PUBLISH", wakeChannel, self+" "+key); err != nil {
+				log.Printf("state: publish wake failed: %v", err)
+			}
+		}()
+	})
+	for {
+		err := c.Subscribe(ctx, wakeChannel, func(payload string) {
+			// our own wakes were already delivered locally
+			if from, key, ok := strings.Cut(payload, " "); ok && from != self {
+				hub.WakeLocal(key)
+			}
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("state: event bus subscription lost, retrying: %v", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
@@ -0,0 +1,82 @@
+// Package state holds the per-instance state that multiple instances need
+// to share: request rate limits and long-poll wakeups. The in-process
+// implementations are the default; Redis shares them across instances.
+package state
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"backend_mini/internal/redis"
+)
+
+// Limiter counts requests per key in fixed one-minute windows.
+type Limiter interface {
+	// Allow reports whether key may make another request this minute and,
+	// if not, how many seconds until the next window.
+	Allow(key string, perMinute int, now time.Time) (bool, int)
+}
+
+// LocalLimiter counts in this process. Counters are dropped wholesale when
+// the window rolls over.
+type LocalLimiter struct {
+	mu     sync.Mutex
+	window int64
+	counts map[string]int
+}
+
+func NewLocalLimiter() *LocalLimiter {
+	return &LocalLimiter{counts: map[string]int{}}
+}
+
+func (l *LocalLimiter) Allow(key string, perMinute int, now time.Time) (bool, int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if w := now.Unix() / 60; w != l.window {
+		l.window = w
+		l.counts = map[string]int{}
+	}
+	if l.counts[key] >= perMinute {
+		return false, retryAfter(now)
+	}
+	l.counts[key]++
+	return true, 0
+}
+
+// RedisLimiter counts in Redis, one key per window that expires after it.
+// While Redis is unreachable it counts locally, so a Redis outage loosens
+// limits to per instance rather than failing requests.
+type RedisLimiter struct {
+	client   *redis.Client
+	fallback *LocalLimiter
+}
+
+func NewRedisLimiter(c *redis.Client) *RedisLimiter {
+	return &RedisLimiter{client: c, fallback: NewLocalLimiter()}
+}
+
+func (l *RedisLimiter) Allow(key string, perMinute int, now time.Time) (bool, int) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	k := "sona:ratelimit:" + key + ":" + strconv.FormatInt(now.Unix()/60, 10)
+	replies, err := l.client.Pipeline(ctx, [][]string{{"INCR", k}, {"EXPIRE", k, "120"}})
+	var n int64
+	if err == nil {
+		n, err = redis.Int(replies[0], nil)
+	}
+	if err != nil {
+		log.Printf("state: rate limit counted locally: %v", err)
+		return l.fallback.Allow(key, perMinute, now)
+	}
+	if n > int64(perMinute) {
+		return false, retryAfter(now)
+	}
+	return true, 0
+}
+
+func retryAfter(now time.Time) int {
+	return int(60 - now.Unix()%60)
+}
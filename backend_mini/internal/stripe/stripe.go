@@ -0,0 +1,266 @@
+// Package stripe talks to the parts of the Stripe API web subscriptions
+// need: Checkout to start one, the subscriptions endpoint to change or
+// cancel it, and signed webhook events to learn what happened since.
+package stripe
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"backend_mini/internal/webhook"
+)
+
+const (
+	APIBase = "https://api.stripe.com"
+
+	// SignatureHeader carries "t=<unix>,v1=<hmac>", the same scheme
+	// webhook.Sign uses for our own deliveries.
+	SignatureHeader = "Stripe-Signature"
+
+	// MetadataParentEmail is the subscription metadata key naming the
+	// family, set at checkout so later events can be matched to it.
+	MetadataParentEmail = "parent_email"
+)
+
+// Subscription statuses Stripe reports.
+const (
+	StatusActive            = "active"
+	StatusTrialing          = "trialing"
+	StatusPastDue           = "past_due"
+	StatusUnpaid            = "unpaid"
+	StatusIncomplete        = "incomplete"
+	StatusIncompleteExpired = "incomplete_expired"
+	StatusPaused            = "paused"
+	StatusCanceled          = "canceled"
+)
+
+var client = &http.Client{Timeout: 15 * time.Second}
+
+// APIError is an error answer from Stripe. Status 4xx means the request
+// itself was wrong, e.g. an unknown price or subscription.
+type APIError struct {
+	Status  int
+	Type    string
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("stripe: http %d: %s", e.Status, e.Message)
+}
+
+// Client calls Stripe with a secret key. An empty Base means Stripe's.
+type Client struct {
+	SecretKey string
+	Base      string
+}
+
+// CheckoutParams describe a hosted Checkout page for one subscription.
+type CheckoutParams struct {
+	ParentEmail string
+	PriceID     string
+	SuccessURL  string
+	CancelURL   string
+}
+
+type CheckoutSession struct {
+	ID                string `json:"id"`
+	URL               string `json:"url"`
+	ClientReferenceID string `json:"client_reference_id"`
+	Subscription      string `json:"subscription"`
+}
+
+type Subscription struct {
+	ID                string            `json:"id"`
+	Status            string            `json:"status"`
+	CancelAtPeriodEnd bool              `json:"cancel_at_period_end"`
+	CurrentPeriodEnd  int64             `json:"current_period_end"`
+	Metadata          map[string]string `json:"metadata"`
+	Items             struct {
+		Data []SubscriptionItem `json:"data"`
+	} `json:"items"`
+}
+
+type SubscriptionItem struct {
+	ID    string `json:"id"`
+	Price struct {
+		ID string `json:"id"`
+	} `json:"price"`
+	CurrentPeriodEnd int64 `json:"current_period_end"`
+}
+
+// Item is the subscription's single item, which carries its price.
+func (s *Subscription) Item() *SubscriptionItem {
+	if len(s.Items.Data) == 0 {
+		return nil
+	}
+	return &s.Items.Data[0]
+}
+
+// PeriodEnd is when the paid period ends. Newer API versions report it
+// per item rather than on the subscription.
+func (s *Subscription) PeriodEnd() time.Time {
+	end := s.CurrentPeriodEnd
+	if it := s.Item(); end == 0 && it != nil {
+		end = it.CurrentPeriodEnd
+	}
+	return time.Unix(end, 0).UTC()
+}
+
+type Invoice struct {
+	ID                 string `json:"id"`
+	Subscription       string `json:"subscription"`
+	BillingReason      string `json:"billing_reason"`
+	AttemptCount       int    `json:"attempt_count"`
+	AmountDue          int64  `json:"amount_due"`
+	AmountPaid         int64  `json:"amount_paid"`
+	Currency           string `json:"currency"`
+	NextPaymentAttempt int64  `json:"next_payment_attempt"`
+	HostedInvoiceURL   string `json:"hosted_invoice_url"`
+	Parent             struct {
+		SubscriptionDetails struct {
+			Subscription string `json:"subscription"`
+		} `json:"subscription_details"`
+	} `json:"parent"`
+}
+
+// SubscriptionID is the subscription the invoice bills, wherever the
+// API version puts it.
+func (in *Invoice) SubscriptionID() string {
+	if in.Subscription != "" {
+		return in.Subscription
+	}
+	return in.Parent.SubscriptionDetails.Subscription
+}
+
+// Event is a webhook event. Object is the resource it is about, and
+// PreviousAttributes what changed, on *.updated events.
+type Event struct {
+	ID      string `json:"id"`
+	Type    string `json:"type"`
+	Created int64  `json:"created"`
+	Data    struct {
+		Object             json.RawMessage `json:"object"`
+		PreviousAttributes json.RawMessage `json:"previous_attributes"`
+	} `json:"data"`
+}
+
+// ParseEvent checks the Stripe-Signature header against the endpoint's
+// signing secret before decoding the event.
+func ParseEvent(secret, header string, body []byte, tolerance time.Duration) (*Event, error) {
+	if err := webhook.Verify(secret, header, body, tolerance); err != nil {
+		return nil, err
+	}
+	var ev Event
+	if err := json.Unmarshal(body, &ev); err != nil {
+		return nil, err
+	}
+	if ev.ID == "" || ev.Type == "" {
+		return nil, errors.New("event has no id or type")
+	}
+	return &ev, nil
+}
+
+// CreateCheckoutSession starts a subscription Checkout for the family. The
+// parent email goes on the subscription's metadata.
+func (c Client) CreateCheckoutSession(ctx context.Context, p CheckoutParams) (*CheckoutSession, error) {
+	form := url.Values{
+		"mode":                    {"subscription"},
+		"line_items[0][price]":    {p.PriceID},
+		"line_items[0][quantity]": {"1"},
+		"customer_email":          {p.ParentEmail},
+		"client_reference_id":     {p.ParentEmail},
+		"success_url":             {p.SuccessURL},
+		"cancel_url":              {p.CancelURL},
+		"metadata[parent_email]":  {p.ParentEmail},
+		"subscription_data[metadata][parent_email]": {p.ParentEmail},
+	}
+	var out CheckoutSession
+	return &out, c.do(ctx, http.MethodPost, "/v1/checkout/sessions", form, &out)
+}
+
+func (c Client) GetSubscription(ctx context.Context, id string) (*Subscription, error) {
+	var out Subscription
+	return &out, c.do(ctx, http.MethodGet, "/v1/subscriptions/"+url.PathEscape(id), nil, &out)
+}
+
+// ChangePrice moves the subscription to another price straight away and
+// invoices the prorated difference now rather than on the next renewal.
+func (c Client) ChangePrice(ctx context.Context, sub *Subscription, priceID string) (*Subscription, error) {
+	it := sub.Item()
+	if it == nil {
+		return nil, errors.New("stripe: subscription has no items")
+	}
+	form := url.Values{
+		"items[0][id]":       {it.ID},
+		"items[0][price]":    {priceID},
+		"proration_behavior": {"always_invoice"},
+	}
+	var out Subscription
+	return &out, c.do(ctx, http.MethodPost, "/v1/subscriptions/"+url.PathEscape(sub.ID), form, &out)
+}
+
+// Cancel stops the subscription renewing, keeping it until the paid period
+// ends, or ends it now with a prorated credit when immediately is set.
+func (c Client) Cancel(ctx context.Context, id string, immediately bool) (*Subscription, error) {
+	var out Subscription
+	if immediately {
+		return &out, c.do(ctx, http.MethodDelete, "/v1/subscriptions/"+url.PathEscape(id), url.Values{"prorate": {"true"}}, &out)
+	}
+	return &out, c.do(ctx, http.MethodPost, "/v1/subscriptions/"+url.PathEscape(id), url.Values{"cancel_at_period_end": {"true"}}, &out)
+}
+
+// Resume undoes a cancellation at period end.
+func (c Client) Resume(ctx context.Context, id string) (*Subscription, error) {
+	var out Subscription
+	return &out, c.do(ctx, http.MethodPost, "/v1/subscriptions/"+url.PathEscape(id), url.Values{"cancel_at_period_end": {"false"}}, &out)
+}
+
+func (c Client) do(ctx context.Context, method, path string, form url.Values, out any) error {
+	base := c.Base
+	if base == "" {
+		base = APIBase
+	}
+	target := strings.TrimRight(base, "/") + path
+	var body *strings.Reader
+	if method == http.MethodGet {
+		if len(form) > 0 {
+			target += "?" + form.Encode()
+		}
+		body = strings.NewReader("")
+	} else {
+		body = strings.NewReader(form.Encode())
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.SecretKey)
+	if method != http.MethodGet {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("stripe: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		var e struct {
+			Error struct {
+				Type    string `json:"type"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&e)
+		return &APIError{Status: resp.StatusCode, Type: e.Error.Type, Message: e.Error.Message}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("stripe: %w", err)
+	}
+	return nil
+}
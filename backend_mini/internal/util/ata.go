@@ -0,0 +1,157 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// ataMissingTTL is how long a missing token account is remembered. Accounts
+// that exist are remembered until the process restarts: they are only closed
+// by their owner, and a stale entry just means a transfer builds without the
+// idempotent create.
+const ataMissingTTL = 30 * time.Second
+
+// maxATACreatesPerTx keeps provisioning transactions well under the size limit.
+const maxATACreatesPerTx = 8
+
+type ataEntry struct {
+	exists    bool
+	checkedAt time.Time
+}
+
+var ataCache = struct {
+	sync.Mutex
+	entries map[string]ataEntry
+}{entries: map[string]ataEntry{}}
+
+func ataCacheKey(owner, mint solana.PublicKey) string {
+	return owner.String() + ":" + mint.String()
+}
+
+// ATAExists reports whether owner has a token account for mint, asking the
+// RPC only when the cache has no usable answer.
+func ATAExists(ctx context.Context, owner, mint solana.PublicKey) (bool, error) {
+	key := ataCacheKey(owner, mint)
+	ataCache.Lock()
+	e, ok := ataCache.entries[key]
+	ataCache.Unlock()
+	if ok && (e.exists || time.Since(e.checkedAt) < ataMissingTTL) {
+		return e.exists, nil
+	}
+
+	ata, err := DeriveAssociatedTokenAddress(owner, mint)
+	if err != nil {
+		return false, fmt.Errorf("failed to derive ATA: %w", err)
+	}
+	info, err := newRPC().GetAccountInfoWithOpts(ctx, ata, &rpc.GetAccountInfoOpts{Commitment: rpc.CommitmentConfirmed})
+	exists := err == nil && info != nil && info.Value != nil
+	if err != nil && !errors.Is(err, rpc.ErrNotFound) {
+		return false, fmt.Errorf("failed to fetch token account: %w", err)
+	}
+	ataCache.Lock()
+	ataCache.entries[key] = ataEntry{exists: exists, checkedAt: time.Now()}
+	ataCache.Unlock()
+	return exists, nil
+}
+
+// MarkATACreated records that owner's token account for mint exists, once
+// its creation is confirmed.
+func MarkATACreated(owner, mint solana.PublicKey) {
+	ataCache.Lock()
+	ataCache.entries[ataCacheKey(owner, mint)] = ataEntry{exists: true, checkedAt: time.Now()}
+	ataCache.Unlock()
+}
+
+// CreateATAs creates EURC token accounts for owners, paid and signed by
+// payer, a batch per transaction. Each batch is waited on until confirmed
+// and its owners marked in the cache. It returns the signatures of the
+// confirmed batches.
+func CreateATAs(ctx context.Context, payer *solana.PrivateKey, owners []solana.PublicKey) ([]string, error) {
+	mint := solana.MustPublicKeyFromBase58(EURCMintDevnet)
+	tokenProgramID := solana.MustPublicKeyFromBase58(TokenProgram)
+	ataProgramID := solana.MustPublicKeyFromBase58(AssociatedTokenProgram)
+	client := newRPC()
+
+	var sigs []string
+	for start := 0; start < len(owners); start += maxATACreatesPerTx {
+		batch := owners[start:min(start+maxATACreatesPerTx, len(owners))]
+		var ixs []solana.Instruction
+		for _, owner := range batch {
+			ata, err := DeriveAssociatedTokenAddress(owner, mint)
+			if err != nil {
+				return sigs, fmt.Errorf("failed to derive ATA: %w", err)
+			}
+			ixs = append(ixs, &simpleInstruction{
+				programID: ataProgramID,
+				accounts: solana.AccountMetaSlice{
+					{PublicKey: payer.PublicKey(), IsSigner: true, IsWritable: true},
+					{PublicKey: ata, IsSigner: false, IsWritable: true},
+					{PublicKey: owner, IsSigner: false, IsWritable: false},
+					{PublicKey: mint, IsSigner: false, IsWritable: false},
+					{PublicKey: solana.SystemProgramID, IsSigner: false, IsWritable: false},
+					{PublicKey: tokenProgramID, IsSigner: false, IsWritable: false},
+				},
+				data: []byte{1}, // CreateIdempotent discriminator
+			})
+		}
+
+		latest, err := client.GetLatestBlockhash(ctx, rpc.CommitmentFinalized)
+		if err != nil {
+			return sigs, fmt.Errorf("failed to get latest blockhash: %w", err)
+		}
+		tx, err := solana.NewTransaction(ixs, latest.Value.Blockhash, solana.TransactionPayer(payer.PublicKey()))
+		if err != nil {
+			return sigs, fmt.Errorf("failed to create transaction: %w", err)
+		}
+		if _, err := tx.Sign(func(key solana.PublicKey) *solana.PrivateKey {
+			if key.Equals(payer.PublicKey()) {
+				return payer
+			}
+			return nil
+		}); err != nil {
+			return sigs, fmt.Errorf("failed to sign transaction: %w", err)
+		}
+		sig, err := client.SendTransaction(ctx, tx)
+		if err != nil {
+			return sigs, fmt.Errorf("failed to send transaction: %w", err)
+		}
+		if err := waitConfirmed(ctx, client, sig); err != nil {
+			return sigs, fmt.Errorf("transaction %s: %w", sig, err)
+		}
+		for _, owner := range batch {
+			MarkATACreated(owner, mint)
+		}
+		sigs = append(sigs, sig.String())
+	}
+	return sigs, nil
+}
+
+// waitConfirmed polls the signature's status until it is confirmed, fails
+// or ctx is done.
+func waitConfirmed(ctx context.Context, client *rpc.Client, sig solana.Signature) error {
+	t := time.NewTicker(time.Second)
+	defer t.Stop()
+	for {
+		out, err := client.GetSignatureStatuses(ctx, false, sig)
+		if err == nil && out != nil && len(out.Value) == 1 && out.Value[0] != nil {
+			st := out.Value[0]
+			if st.Err != nil {
+				return fmt.Errorf("failed on chain: %v", st.Err)
+			}
+			if st.ConfirmationStatus == rpc.ConfirmationStatusConfirmed || st.ConfirmationStatus == rpc.ConfirmationStatusFinalized {
+				return nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
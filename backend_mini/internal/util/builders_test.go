@@ -0,0 +1,138 @@
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// update rewrites the golden files from the builders' current output:
+//
+//	go test ./internal/util -run TestBuildersGolden -update
+var update = flag.Bool("update", false, "rewrite testdata/golden from the current builders")
+
+const (
+	goldenParent  = "GBu756JpQbbyhkj81Boxgd5AYh4rw2YhZLUFWUUReqTw"
+	goldenKid     = "8SyBMpUXQdPPmUAmxEn1EE3Bvxs4Lq4TgX4BWs428rUD"
+	goldenSavings = "354chkxFKNFcH6npm8ihnVM2Nd8N2EodqJW9W9wieRfC"
+	goldenTree    = "9xQeWvG816bUx9EPjHmaT23yvVM2ZWbrrpZb9PusVFin"
+	goldenHash    = "4sGjMW1sUnHzSxGspuhpqLDx6wiyjntZAqNpfGRvNSJS"
+)
+
+// goldenSnapshot is what a golden file holds: the builder's output as the
+// API returns it, and the serialized bytes decoded independently of it.
+type goldenSnapshot struct {
+	Transaction *TransactionData    `json:"transaction"`
+	Decoded     *DecodedTransaction `json:"decoded"`
+}
+
+// TestBuildersGolden builds each TransactionData builder's transaction for
+// fixed inputs and compares it with testdata/golden. Whether recipients
+// have token accounts is seeded into the ATA cache, so no RPC is asked.
+func TestBuildersGolden(t *testing.T) {
+	defer withATAs(map[string]bool{goldenKid: false, goldenSavings: true})()
+	defer withTreeKey(solana.MustPublicKeyFromBase58(goldenTree))()
+
+	for _, tc := range []struct {
+		name  string
+		build func() (*TransactionData, error)
+	}{
+		{"eurc_transfer", func() (*TransactionData, error) {
+			return BuildEURCTransferTransaction(goldenParent, goldenKid, 2_500_000)
+		}},
+		{"eurc_transfer_existing_ata", func() (*TransactionData, error) {
+			return BuildEURCTransferTransaction(goldenParent, goldenSavings, 1)
+		}},
+		{"eurc_multi_transfer", func() (*TransactionData, error) {
+			return BuildEURCMultiTransferTransaction(goldenParent, []TransferLeg{
+				{To: goldenKid, Amount: 7_000_000},
+				{To: goldenSavings, Amount: 3_000_000},
+				{To: goldenKid, Amount: 10},
+			})
+		}},
+		{"eurc_multi_transfer_options", func() (*TransactionData, error) {
+			kidATA, err := DeriveAssociatedTokenAddress(solana.MustPublicKeyFromBase58(goldenKid), solana.MustPublicKeyFromBase58(EURCMintDevnet))
+			if err != nil {
+				return nil, err
+			}
+			return BuildEURCMultiTransferTransactionWithOptions(goldenKid, []TransferLeg{{To: goldenParent, Amount: 42}, {To: goldenKid, Amount: 1}}, BuildOptions{
+				Blockhash:     goldenHash,
+				SkipATACreate: map[string]bool{kidATA.String(): true},
+			})
+		}},
+		{"merkle_tree", func() (*TransactionData, error) {
+			return BuildMerkleTreeTransaction(goldenParent, MaxDepth, MaxBufferSize)
+		}},
+		{"mint_nft", func() (*TransactionData, error) {
+			return BuildMintNFTTransaction(goldenParent, "Dishes", "5", "Wash \"all\" of them", goldenKid, goldenTree)
+		}},
+		{"update_nft", func() (*TransactionData, error) {
+			return BuildUpdateNFTTransaction(goldenTree, "completed", goldenKid)
+		}},
+		{"accept_nft", func() (*TransactionData, error) {
+			return BuildAcceptNFTTransaction(goldenTree, goldenParent, 5_000_000)
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := tc.build()
+			if err != nil {
+				t.Fatal(err)
+			}
+			decoded, err := DecodeTransaction(data.Serialized)
+			if err != nil {
+				t.Fatalf("decoding the built transaction: %v", err)
+			}
+			got, err := json.MarshalIndent(goldenSnapshot{data, decoded}, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, '\n')
+
+			path := filepath.Join("testdata", "golden", tc.name+".json")
+			if *update {
+				if err := os.WriteFile(path, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("%v (run with -update to create it)", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("%s changed; if that is intended, run with -update and review the diff.\ngot:\n%s", path, got)
+			}
+		})
+	}
+}
+
+// withATAs seeds the ATA cache with whether each owner has a EURC token
+// account, and returns a func restoring it.
+func withATAs(owners map[string]bool) func() {
+	mint := solana.MustPublicKeyFromBase58(EURCMintDevnet)
+	ataCache.Lock()
+	saved := ataCache.entries
+	ataCache.entries = map[string]ataEntry{}
+	for owner, exists := range owners {
+		// dated ahead, so missing accounts outlive ataMissingTTL
+		ataCache.entries[ataCacheKey(solana.MustPublicKeyFromBase58(owner), mint)] = ataEntry{exists: exists, checkedAt: time.Now().Add(time.Hour)}
+	}
+	ataCache.Unlock()
+	return func() {
+		ataCache.Lock()
+		ataCache.entries = saved
+		ataCache.Unlock()
+	}
+}
+
+func withTreeKey(key solana.PublicKey) func() {
+	saved := newTreeKey
+	newTreeKey = func() solana.PublicKey { return key }
+	return func() { newTreeKey = saved }
+}
@@ -0,0 +1,81 @@
+package util
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Kinds of content the kid text filter detects.
+const (
+	ContentProfanity = "profanity"
+	ContentEmail     = "email"
+	ContentPhone     = "phone"
+)
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`)
+	phonePattern = regexp.MustCompile(`\+?[0-9][0-9 ().-]{6,}[0-9]`)
+	wordPattern  = regexp.MustCompile(`[\p{L}0-9@$]+`)
+	leet         = strings.NewReplacer("0", "o", "1", "i", "3", "e", "4", "a", "5", "s", "7", "t", "@", "a", "$", "s")
+)
+
+// profanitySuffixes let "shitty" or "fucking" match the stem in the list
+// without prefix matching, which would catch "class" or "dickens".
+var profanitySuffixes = []string{"", "s", "es", "ed", "er", "ers", "ing", "y", "ty"}
+
+// ContentFinding is one match of the kid text filter.
+type ContentFinding struct {
+	Kind  string `json:"kind"`
+	Match string `json:"match"`
+}
+
+// ScreenText looks for profanity from words, email addresses and phone
+// numbers in s. It returns s with every match masked, and the matches.
+// Emails become "[email]", phone numbers "[phone]" and profane words are
+// starred out. Words are compared case-insensitively after undoing common
+// digit-for-letter swaps.
+func ScreenText(s string, words []string) (string, []ContentFinding) {
+	var found []ContentFinding
+	s = emailPattern.ReplaceAllStringFunc(s, func(m string) string {
+		found = append(found, ContentFinding{Kind: ContentEmail, Match: m})
+		return "[email]"
+	})
+	s = phonePattern.ReplaceAllStringFunc(s, func(m string) string {
+		if digits(m) < 9 {
+			return m
+		}
+		found = append(found, ContentFinding{Kind: ContentPhone, Match: m})
+		return "[phone]"
+	})
+	list := make(map[string]bool, len(words))
+	for _, w := range words {
+		list[w] = true
+	}
+	s = wordPattern.ReplaceAllStringFunc(s, func(m string) string {
+		if !profane(leet.Replace(strings.ToLower(m)), list) {
+			return m
+		}
+		found = append(found, ContentFinding{Kind: ContentProfanity, Match: m})
+		return strings.Repeat("*", len([]rune(m)))
+	})
+	return s, found
+}
+
+func profane(w string, list map[string]bool) bool {
+	for _, suffix := range profanitySuffixes {
+		if stem, ok := strings.CutSuffix(w, suffix); ok && list[stem] {
+			return true
+		}
+	}
+	return false
+}
+
+func digits(s string) int {
+	n := 0
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,228 @@
+package util
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+const (
+	MemoProgram          = "MemoSq4gqABAXKb96qnH8TysNcWxMyWCqXgDLGmfcHr"
+	ComputeBudgetProgram = "ComputeBudget111111111111111111111111111111"
+)
+
+var programNames = map[string]string{
+	solana.SystemProgramID.String(): "System Program",
+	TokenProgram:                    "SPL Token",
+	AssociatedTokenProgram:          "Associated Token Account",
+	BubblegumProgram:                "Bubblegum",
+	SPLAccountCompression:           "SPL Account Compression",
+	SPLNoopProgram:                  "SPL Noop",
+	MemoProgram:                     "Memo",
+	ComputeBudgetProgram:            "Compute Budget",
+}
+
+// DecodedTransaction is a serialized transaction broken down for display.
+type DecodedTransaction struct {
+	FeePayer        string               `json:"fee_payer"`
+	RecentBlockhash string               `json:"recent_blockhash"`
+	Signers         []string             `json:"signers"`
+	Signed          int                  `json:"signed"`
+	Instructions    []DecodedInstruction `json:"instructions"`
+}
+
+type DecodedInstruction struct {
+	ProgramID string           `json:"program_id"`
+	Program   string           `json:"program"`
+	Type      string           `json:"type"`
+	Accounts  []string         `json:"accounts"`
+	Transfer  *DecodedTransfer `json:"transfer,omitempty"`
+	Memo      string           `json:"memo,omitempty"`
+	Data      string           `json:"data,omitempty"`
+	Summary   string           `json:"summary,omitempty"`
+}
+
+// DecodedTransfer is a SOL or token movement. For token transfers Source
+// and Destination are token accounts and Authority is the signing wallet;
+// Mint and Decimals are only known for transfer_checked.
+type DecodedTransfer struct {
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	Authority   string `json:"authority,omitempty"`
+	Mint        string `json:"mint,omitempty"`
+	Amount      uint64 `json:"amount"`
+	Decimals    *uint8 `json:"decimals,omitempty"`
+	// Owner is the wallet owning Destination, when it can be told from
+	// the transaction itself (an ATA created in it) or is filled in later.
+	Owner string `json:"owner,omitempty"`
+}
+
+// DecodeTransaction parses a base64 transaction, ours or anyone's.
+// Instructions of unknown programs keep their raw data in hex. Versioned
+// transactions using address lookup tables are refused, since their accounts
+// cannot be resolved offline.
+func DecodeTransaction(serialized string) (*DecodedTransaction, error) {
+	tx, err := solana.TransactionFromBase64(serialized)
+	if err != nil {
+		return nil, fmt.Errorf("invalid transaction: %w", err)
+	}
+	if tx.Message.NumLookups() > 0 {
+		return nil, errors.New("transactions using address lookup tables are not supported")
+	}
+	metas, err := tx.Message.AccountMetaList()
+	if err != nil {
+		return nil, fmt.Errorf("invalid transaction: %w", err)
+	}
+	out := &DecodedTransaction{
+		RecentBlockhash: tx.Message.RecentBlockhash.String(),
+		Signers:         []string{},
+		Instructions:    []DecodedInstruction{},
+	}
+	for i, s := range tx.Message.Signers() {
+		out.Signers = append(out.Signers, s.String())
+		if i < len(tx.Signatures) && !tx.Signatures[i].IsZero() {
+			out.Signed++
+		}
+	}
+	if len(out.Signers) > 0 {
+		out.FeePayer = out.Signers[0]
+	}
+
+	// token account -> owner, from ATA creations in this transaction
+	owners := map[string]string{}
+	for _, ci := range tx.Message.Instructions {
+		programID, err := tx.Message.ResolveProgramIDIndex(ci.ProgramIDIndex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid transaction: %w", err)
+		}
+		in := DecodedInstruction{ProgramID: programID.String(), Program: programNames[programID.String()], Accounts: []string{}}
+		if in.Program == "" {
+			in.Program = "Unknown"
+		}
+		for _, idx := range ci.Accounts {
+			if int(idx) >= len(metas) {
+				return nil, errors.New("invalid transaction: account index out of range")
+			}
+			in.Accounts = append(in.Accounts, metas[idx].PublicKey.String())
+		}
+		decodeInstruction(&in, ci.Data, owners)
+		out.Instructions = append(out.Instructions, in)
+	}
+	for i := range out.Instructions {
+		if t := out.Instructions[i].Transfer; t != nil && t.Owner == "" {
+			t.Owner = owners[t.Destination]
+		}
+	}
+	return out, nil
+}
+
+func decodeInstruction(in *DecodedInstruction, data []byte, owners map[string]string) {
+	acc := in.Accounts
+	switch in.ProgramID {
+	case solana.SystemProgramID.String():
+		if len(data) == 12 && binary.LittleEndian.Uint32(data[:4]) == 2 && len(acc) >= 2 {
+			in.Type = "sol_transfer"
+			in.Transfer = &DecodedTransfer{Source: acc[0], Destination: acc[1], Owner: acc[1], Amount: binary.LittleEndian.Uint64(data[4:12])}
+			return
+		}
+	case TokenProgram:
+		if len(data) == 9 && data[0] == 3 && len(acc) >= 3 {
+			in.Type = "transfer"
+			in.Transfer = &DecodedTransfer{Source: acc[0], Destination: acc[1], Authority: acc[2], Amount: binary.LittleEndian.Uint64(data[1:9])}
+			return
+		}
+		if len(data) == 10 && data[0] == 12 && len(acc) >= 4 {
+			decimals := data[9]
+			in.Type = "transfer_checked"
+			in.Transfer = &DecodedTransfer{Source: acc[0], Mint: acc[1], Destination: acc[2], Authority: acc[3], Amount: binary.LittleEndian.Uint64(data[1:9]), Decimals: &decimals}
+			return
+		}
+	case AssociatedTokenProgram:
+		if (len(data) == 0 || (len(data) == 1 && data[0] <= 1)) && len(acc) >= 4 {
+			in.Type = "create_associated_token_account"
+			if len(data) == 1 && data[0] == 1 {
+				in.Type = "create_associated_token_account_idempotent"
+			}
+			owners[acc[1]] = acc[2]
+			return
+		}
+	case MemoProgram:
+		if utf8.Valid(data) {
+			in.Type = "memo"
+			in.Memo = string(data)
+			return
+		}
+	}
+	in.Type = "unknown"
+	in.Data = hex.EncodeToString(data)
+}
+
+// TokenAccountOwner returns the wallet owning a token account.
+func TokenAccountOwner(ctx context.Context, account string) (string, error) {
+	pk, err := solana.PublicKeyFromBase58(account)
+	if err != nil {
+		return "", fmt.Errorf("invalid token account: %w", err)
+	}
+	info, err := newRPC().GetAccountInfoWithOpts(ctx, pk, &rpc.GetAccountInfoOpts{Commitment: rpc.CommitmentConfirmed})
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch token account: %w", err)
+	}
+	if info == nil || info.Value == nil {
+		return "", errors.New("token account not found")
+	}
+	data := info.Value.Data.GetBinary()
+	// SPL token account layout: mint(32) owner(32) amount(u64 LE)
+	if len(data) < 64 {
+		return "", fmt.Errorf("unexpected token account size %d", len(data))
+	}
+	return solana.PublicKeyFromBytes(data[32:64]).String(), nil
+}
+
+// FormatTokenAmount renders micro-units with the given decimals, dropping
+// trailing zeros: 5000000 with 6 decimals is "5", 1500000 is "1.5".
+func FormatTokenAmount(amount uint64, decimals uint8) string {
+	s := fmt.Sprintf("%d", amount)
+	d := int(decimals)
+	if d == 0 {
+		return s
+	}
+	for len(s) <= d {
+		s = "0" + s
+	}
+	whole, frac := s[:len(s)-d], s[len(s)-d:]
+	for len(frac) > 0 && frac[len(frac)-1] == '0' {
+		frac = frac[:len(frac)-1]
+	}
+	if frac == "" {
+		return whole
+	}
+	return whole + "." + frac
+}
+
+// ParseTokenAmount is the reverse of FormatTokenAmount: "1.5" with 6
+// decimals is 1500000. A comma works as the decimal mark too; more
+// fraction digits than decimals is an error rather than rounded away.
+func ParseTokenAmount(s string, decimals uint8) (uint64, error) {
+	s = strings.ReplaceAll(strings.TrimSpace(s), ",", ".")
+	whole, frac, _ := strings.Cut(s, ".")
+	if whole == "" && frac == "" || len(frac) > int(decimals) || strings.ContainsAny(whole+frac, "+-") {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	frac += strings.Repeat("0", int(decimals)-len(frac))
+	if whole == "" {
+		whole = "0"
+	}
+	n, err := strconv.ParseUint(whole+frac, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	return n, nil
+}
@@ -0,0 +1,27 @@
+package util
+
+import "testing"
+
+// FuzzParseTokenAmount checks ParseTokenAmount never panics and that what
+// it accepts survives a trip through FormatTokenAmount.
+func FuzzParseTokenAmount(f *testing.F) {
+	for _, s := range []string{"0", "1", "1.5", "0,25", ".5", "5.", "12.345678", "18446744073709.551615", "18446744073709.551616", "-1", "+1", "1e6", " 2.50 ", "", ".", "1.2.3"} {
+		f.Add(s, uint8(EURCDecimals))
+	}
+	f.Add("255", uint8(0))
+	f.Fuzz(func(t *testing.T, s string, decimals uint8) {
+		decimals %= 20
+		n, err := ParseTokenAmount(s, decimals)
+		if err != nil {
+			return
+		}
+		formatted := FormatTokenAmount(n, decimals)
+		back, err := ParseTokenAmount(formatted, decimals)
+		if err != nil {
+			t.Fatalf("ParseTokenAmount(%q) = %d, but its formatting %q does not parse: %v", s, n, formatted, err)
+		}
+		if back != n {
+			t.Fatalf("ParseTokenAmount(%q) = %d, but its formatting %q parses as %d", s, n, formatted, back)
+		}
+	})
+}
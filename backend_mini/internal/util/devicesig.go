@@ -0,0 +1,39 @@
+package util
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+)
+
+// DeviceSignedPayload is what a paired device signs for a request: the
+// method, the path, the unix timestamp it sends and the hex SHA-256 of the
+// body as sent, one per line.
+func DeviceSignedPayload(method, path, unix string, body []byte) []byte {
+	sum := sha256.Sum256(body)
+	return []byte(method + "\n" + path + "\n" + unix + "\n" + hex.EncodeToString(sum[:]))
+}
+
+// ParseDevicePublicKey decodes a base64 ed25519 public key.
+func ParseDevicePublicKey(s string) (ed25519.PublicKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(s)
+	if err != nil || len(raw) != ed25519.PublicKeySize {
+		return nil, errors.New("public_key must be a base64 ed25519 public key")
+	}
+	return ed25519.PublicKey(raw), nil
+}
+
+// VerifyDeviceSignature checks a base64 ed25519 signature of payload.
+func VerifyDeviceSignature(publicKey, signature string, payload []byte) bool {
+	pub, err := ParseDevicePublicKey(publicKey)
+	if err != nil {
+		return false
+	}
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return false
+	}
+	return ed25519.Verify(pub, payload, sig)
+}
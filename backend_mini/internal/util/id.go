@@ -2,18 +2,89 @@ package util
 
 import (
 	"crypto/rand"
+	"encoding/binary"
+	"sync"
+	"time"
 )
 
 const alphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
 
+// crockford is the ULID alphabet: no I, L, O or U.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// GenerateShortID returns a 6-character public code. Codes are short
+// enough to collide, so store them under a unique index and retry on a
+// collision; key rows with NewID instead.
 func GenerateShortID() (string, error) {
-	b := make([]byte, 6)
-	// crypto/rand for production-safe randomness
-	if _, err := rand.Read(b); err != nil {
+	return GenerateCode(6)
+}
+
+// GenerateCode returns n random characters from the id alphabet.
+func GenerateCode(n int) (string, error) {
+	b := make([]byte, 0, n)
+	buf := make([]byte, n)
+	for len(b) < n {
+		// crypto/rand for production-safe randomness
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		for _, c := range buf {
+			// bytes past the last whole multiple of the alphabet would
+			// make its first letters likelier, so draw again instead
+			if int(c) >= 256/len(alphabet)*len(alphabet) || len(b) == n {
+				continue
+			}
+			b = append(b, alphabet[int(c)%len(alphabet)])
+		}
+	}
+	return string(b), nil
+}
+
+var ulidState struct {
+	sync.Mutex
+	ms   uint64
+	rand [10]byte
+}
+
+// NewID returns a ULID: 26 characters that sort by creation time, with 80
+// random bits per millisecond. IDs made in the same millisecond by this
+// process count up from the first, so they stay unique and in order.
+func NewID() (string, error) {
+	ms := uint64(time.Now().UnixMilli())
+	ulidState.Lock()
+	defer ulidState.Unlock()
+	if ms <= ulidState.ms {
+		ms = ulidState.ms
+		// increment the 80-bit random part; wrapping means 2^80 ids in
+		// one millisecond, so move on to the next one
+		i := len(ulidState.rand) - 1
+		for ; i >= 0; i-- {
+			ulidState.rand[i]++
+			if ulidState.rand[i] != 0 {
+				break
+			}
+		}
+		if i < 0 {
+			ms++
+		}
+	} else if _, err := rand.Read(ulidState.rand[:]); err != nil {
 		return "", err
 	}
-	for i := 0; i < 6; i++ {
-		b[i] = alphabet[int(b[i])%len(alphabet)]
+	ulidState.ms = ms
+
+	var raw [16]byte
+	binary.BigEndian.PutUint16(raw[0:2], uint16(ms>>32))
+	binary.BigEndian.PutUint32(raw[2:6], uint32(ms))
+	copy(raw[6:], ulidState.rand[:])
+
+	// 128 bits as 26 base32 digits, the first carrying only 3 bits
+	hi := binary.BigEndian.Uint64(raw[0:8])
+	lo := binary.BigEndian.Uint64(raw[8:16])
+	var out [26]byte
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
 	}
-	return string(b), nil
+	return string(out[:]), nil
 }
@@ -0,0 +1,46 @@
+package util
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// SubmitMemo writes memo on-chain with the memo program, paid and signed
+// by payer, and waits until it is confirmed. It returns the signature.
+func SubmitMemo(ctx context.Context, payer *solana.PrivateKey, memo string) (string, error) {
+	client := newRPC()
+	ix := &simpleInstruction{
+		programID: solana.MustPublicKeyFromBase58(MemoProgram),
+		accounts: solana.AccountMetaSlice{
+			{PublicKey: payer.PublicKey(), IsSigner: true, IsWritable: false},
+		},
+		data: []byte(memo),
+	}
+	latest, err := client.GetLatestBlockhash(ctx, rpc.CommitmentFinalized)
+	if err != nil {
+		return "", fmt.Errorf("failed to get latest blockhash: %w", err)
+	}
+	tx, err := solana.NewTransaction([]solana.Instruction{ix}, latest.Value.Blockhash, solana.TransactionPayer(payer.PublicKey()))
+	if err != nil {
+		return "", fmt.Errorf("failed to create transaction: %w", err)
+	}
+	if _, err := tx.Sign(func(key solana.PublicKey) *solana.PrivateKey {
+		if key.Equals(payer.PublicKey()) {
+			return payer
+		}
+		return nil
+	}); err != nil {
+		return "", fmt.Errorf("failed to sign transaction: %w", err)
+	}
+	sig, err := client.SendTransaction(ctx, tx)
+	if err != nil {
+		return "", fmt.Errorf("failed to send transaction: %w", err)
+	}
+	if err := waitConfirmed(ctx, client, sig); err != nil {
+		return "", fmt.Errorf("transaction %s: %w", sig, err)
+	}
+	return sig.String(), nil
+}
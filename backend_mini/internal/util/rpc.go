@@ -0,0 +1,48 @@
+package util
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gagliardetto/solana-go/rpc"
+	"github.com/gagliardetto/solana-go/rpc/jsonrpc"
+
+	"backend_mini/internal/metrics"
+)
+
+// rpcTimeout matches the one rpc.New gives its own client.
+const rpcTimeout = 5 * time.Minute
+
+// newRPC is rpc.New(DevnetRPC) with each call timed into the metrics, as
+// the "solana_rpc" upstream labelled by JSON-RPC method.
+func newRPC() *rpc.Client {
+	return rpc.NewWithCustomRPCClient(timedRPC{jsonrpc.NewClientWithOpts(DevnetRPC, &jsonrpc.RPCClientOpts{
+		HTTPClient: &http.Client{Timeout: rpcTimeout},
+	})})
+}
+
+type timedRPC struct {
+	jsonrpc.RPCClient
+}
+
+func (c timedRPC) CallForInto(ctx context.Context, out interface{}, method string, params []interface{}) error {
+	start := time.Now()
+	err := c.RPCClient.CallForInto(ctx, out, method, params)
+	metrics.ObserveUpstream("solana_rpc", method, err, time.Since(start))
+	return err
+}
+
+func (c timedRPC) CallWithCallback(ctx context.Context, method string, params []interface{}, callback func(*http.Request, *http.Response) error) error {
+	start := time.Now()
+	err := c.RPCClient.CallWithCallback(ctx, method, params, callback)
+	metrics.ObserveUpstream("solana_rpc", method, err, time.Since(start))
+	return err
+}
+
+func (c timedRPC) CallBatch(ctx context.Context, requests jsonrpc.RPCRequests) (jsonrpc.RPCResponses, error) {
+	start := time.Now()
+	out, err := c.RPCClient.CallBatch(ctx, requests)
+	metrics.ObserveUpstream("solana_rpc", "batch", err, time.Since(start))
+	return out, err
+}
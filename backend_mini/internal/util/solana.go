@@ -5,6 +5,7 @@ import (
 	"encoding/base64"
 	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
@@ -24,11 +25,16 @@ const (
 	SPLAccountCompression  = "cmtDvXumGCrqC1Age74AVPhSRVXJMd8PJS91L8KbNCK"
 	SPLNoopProgram         = "noopb9bkMVfRPU8AsbpTUg8AQkHtKwMYZiFUjNRtMmV"
 
+	DevnetRPC = "https://api.devnet.solana.com"
+
 	MaxDepth         uint8  = 14
 	MaxBufferSize    uint8  = 64
 	CanopyDepth      uint8  = 0
 	TreeSpaceBytes   uint64 = 3364864
 	TreeRentLamports uint64 = 6000000
+
+	// SignatureFeeLamports is the base network fee per required signature.
+	SignatureFeeLamports uint64 = 5000
 )
 
 type TransactionData struct {
@@ -37,6 +43,32 @@ type TransactionData struct {
 	RecentBlockhash    string            `json:"recent_blockhash"`
 	FeePayer           string            `json:"fee_payer"`
 	RequiredSignatures []string          `json:"required_signatures"`
+	Split              *SplitInfo        `json:"split,omitempty"`
+	TransferID         string            `json:"transfer_id,omitempty"`
+	DuplicateOf        string            `json:"duplicate_of,omitempty"`
+	ExpiresAt          string            `json:"expires_at,omitempty"`
+	Supersedes         string            `json:"supersedes,omitempty"`
+	Reverses           string            `json:"reverses,omitempty"`
+}
+
+// CreatedATAs lists the token accounts the transaction creates.
+func (t *TransactionData) CreatedATAs() []string {
+	var out []string
+	for _, in := range t.Instructions {
+		if in.InstructionType == "create_associated_token_account_idempotent" && len(in.Accounts) > 1 {
+			out = append(out, in.Accounts[1].Pubkey)
+		}
+	}
+	return out
+}
+
+// SplitInfo describes how an incoming transfer was divided by a kid's split rule.
+type SplitInfo struct {
+	Percent       int    `json:"percent"`
+	KidWallet     string `json:"kid_wallet"`
+	KidAmount     uint64 `json:"kid_amount"`
+	SavingsWallet string `json:"savings_wallet"`
+	SavingsAmount uint64 `json:"savings_amount"`
 }
 
 type InstructionData struct {
@@ -63,15 +95,60 @@ func (s *simpleInstruction) ProgramID() solana.PublicKey     { return s.programI
 func (s *simpleInstruction) Accounts() []*solana.AccountMeta { return s.accounts }
 func (s *simpleInstruction) Data() ([]byte, error)           { return s.data, nil }
 
+type TransferLeg struct {
+	To     string
+	Amount uint64
+}
+
+// ValidateAddress reports whether addr is a base58 Solana public key.
+func ValidateAddress(addr string) error {
+	if _, err := solana.PublicKeyFromBase58(addr); err != nil {
+		return fmt.Errorf("invalid address %q: %w", addr, err)
+	}
+	return nil
+}
+
 func BuildEURCTransferTransaction(from, to string, amount uint64) (*TransactionData, error) {
-	fromPubkey, err := solana.PublicKeyFromBase58(from)
+	return BuildEURCMultiTransferTransaction(from, []TransferLeg{{To: to, Amount: amount}})
+}
+
+// PlaceholderBlockhash is used when a transaction is built without a recent
+// blockhash; the signing client has to set one.
+const PlaceholderBlockhash = "11111111111111111111111111111111"
+
+// BuildEURCMultiTransferTransaction builds one transaction paying every leg
+// from the same wallet, creating recipient ATAs where missing.
+func BuildEURCMultiTransferTransaction(from string, legs []TransferLeg) (*TransactionData, error) {
+	return BuildEURCMultiTransferTransactionWithOptions(from, legs, BuildOptions{})
+}
+
+// BuildOptions adjusts how a multi-transfer transaction is built.
+type BuildOptions struct {
+	// Blockhash is a recent blockhash, after which the transaction expires.
+	// Empty means PlaceholderBlockhash.
+	Blockhash string
+	// SkipATACreate lists recipient token accounts that another pending
+	// transaction already creates.
+	SkipATACreate map[string]bool
+}
+
+// BuildEURCMultiTransferTransactionWithOptions is BuildEURCMultiTransferTransaction
+// with a real blockhash and ATA creation left to other transactions.
+func BuildEURCMultiTransferTransactionWithOptions(from string, legs []TransferLeg, opts BuildOptions) (*TransactionData, error) {
+	blockhash := opts.Blockhash
+	if blockhash == "" {
+		blockhash = PlaceholderBlockhash
+	}
+	recent, err := solana.HashFromBase58(blockhash)
 	if err != nil {
-		return nil, fmt.Errorf("invalid from address: %w", err)
+		return nil, fmt.Errorf("invalid blockhash: %w", err)
 	}
-
-	toPubkey, err := solana.PublicKeyFromBase58(to)
+	if len(legs) == 0 {
+		return nil, fmt.Errorf("no transfers to build")
+	}
+	fromPubkey, err := solana.PublicKeyFromBase58(from)
 	if err != nil {
-		return nil, fmt.Errorf("invalid to address: %w", err)
+		return nil, fmt.Errorf("invalid from address: %w", err)
 	}
 
 	eurcMint, err := solana.PublicKeyFromBase58(EURCMintDevnet)
@@ -101,97 +178,97 @@ func BuildEURCTransferTransaction(from, to string, amount uint64) (*TransactionD
 		return nil, fmt.Errorf("failed to derive from ATA: %w", err)
 	}
 
-	toATA, _, err := solana.FindProgramAddress(
-		[][]byte{
-			toPubkey.Bytes(),
-			tokenProgramID.Bytes(),
-			eurcMint.Bytes(),
-		},
-		ataProgramID,
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to derive to ATA: %w", err)
-	}
+	var instructions []InstructionData
+	var txInstructions []solana.Instruction
+	creating := map[string]bool{}
 
-	// systemProgramID := solana.SystemProgramID
+	for _, leg := range legs {
+		toPubkey, err := solana.PublicKeyFromBase58(leg.To)
+		if err != nil {
+			return nil, fmt.Errorf("invalid to address: %w", err)
+		}
 
-	var instructions []InstructionData
+		toATA, _, err := solana.FindProgramAddress(
+			[][]byte{
+				toPubkey.Bytes(),
+				tokenProgramID.Bytes(),
+				eurcMint.Bytes(),
+			},
+			ataProgramID,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to derive to ATA: %w", err)
+		}
 
-	// Optionally include ATA creation if missing (safe to omit if already exists)
-	includeCreateATA := false
-	{
-		client := rpc.New("https://api.devnet.solana.com")
-		info, err := client.GetAccountInfoWithOpts(context.Background(), toATA, &rpc.GetAccountInfoOpts{Commitment: rpc.CommitmentConfirmed})
-		if err != nil || info == nil || info.Value == nil {
-			includeCreateATA = true
+		// Optionally include ATA creation if missing (safe to omit if already exists)
+		includeCreateATA := false
+		if !creating[toATA.String()] && !opts.SkipATACreate[toATA.String()] {
+			exists, err := ATAExists(context.Background(), toPubkey, eurcMint)
+			includeCreateATA = err != nil || !exists
+		}
+
+		if includeCreateATA {
+			creating[toATA.String()] = true
+			instructions = append(instructions, InstructionData{
+				ProgramID:       AssociatedTokenProgram,
+				InstructionType: "create_associated_token_account_idempotent",
+				Accounts: []AccountMeta{
+					{Pubkey: fromPubkey.String(), IsSigner: true, IsWritable: true, IsPayer: true},
+					{Pubkey: toATA.String(), IsSigner: false, IsWritable: true, IsPayer: false},
+					{Pubkey: toPubkey.String(), IsSigner: false, IsWritable: false, IsPayer: false},
+					{Pubkey: eurcMint.String(), IsSigner: false, IsWritable: false, IsPayer: false},
+					{Pubkey: solana.SystemProgramID.String(), IsSigner: false, IsWritable: false, IsPayer: false},
+					{Pubkey: tokenProgramID.String(), IsSigner: false, IsWritable: false, IsPayer: false},
+				},
+				Data: "",
+			})
+			txInstructions = append(txInstructions, &simpleInstruction{
+				programID: ataProgramID,
+				accounts: solana.AccountMetaSlice{
+					{PublicKey: fromPubkey, IsSigner: true, IsWritable: true},
+					{PublicKey: toATA, IsSigner: false, IsWritable: true},
+					{PublicKey: toPubkey, IsSigner: false, IsWritable: false},
+					{PublicKey: eurcMint, IsSigner: false, IsWritable: false},
+					{PublicKey: solana.SystemProgramID, IsSigner: false, IsWritable: false},
+					{PublicKey: tokenProgramID, IsSigner: false, IsWritable: false},
+				},
+				data: []byte{1}, // CreateIdempotent discriminator
+			})
 		}
-	}
 
-	if includeCreateATA {
 		instructions = append(instructions, InstructionData{
-			ProgramID:       AssociatedTokenProgram,
-			InstructionType: "create_associated_token_account_idempotent",
+			ProgramID:       TokenProgram,
+			InstructionType: "transfer_checked",
 			Accounts: []AccountMeta{
-				{Pubkey: fromPubkey.String(), IsSigner: true, IsWritable: true, IsPayer: true},
-				{Pubkey: toATA.String(), IsSigner: false, IsWritable: true, IsPayer: false},
-				{Pubkey: toPubkey.String(), IsSigner: false, IsWritable: false, IsPayer: false},
+				{Pubkey: fromATA.String(), IsSigner: false, IsWritable: true, IsPayer: false},
 				{Pubkey: eurcMint.String(), IsSigner: false, IsWritable: false, IsPayer: false},
-				{Pubkey: solana.SystemProgramID.String(), IsSigner: false, IsWritable: false, IsPayer: false},
-				{Pubkey: tokenProgramID.String(), IsSigner: false, IsWritable: false, IsPayer: false},
+				{Pubkey: toATA.String(), IsSigner: false, IsWritable: true, IsPayer: false},
+				{Pubkey: fromPubkey.String(), IsSigner: true, IsWritable: false, IsPayer: true},
 			},
-			Data: "",
+			Data: fmt.Sprintf("%x", leg.Amount),
 		})
-	}
 
-	instructions = append(instructions, InstructionData{
-		ProgramID:       TokenProgram,
-		InstructionType: "transfer_checked",
-		Accounts: []AccountMeta{
-			{Pubkey: fromATA.String(), IsSigner: false, IsWritable: true, IsPayer: false},
-			{Pubkey: eurcMint.String(), IsSigner: false, IsWritable: false, IsPayer: false},
-			{Pubkey: toATA.String(), IsSigner: false, IsWritable: true, IsPayer: false},
-			{Pubkey: fromPubkey.String(), IsSigner: true, IsWritable: false, IsPayer: true},
-		},
-		Data: fmt.Sprintf("%x", amount),
-	})
-
-	binaryData := make([]byte, 10)
-	binaryData[0] = 12
-	binary.LittleEndian.PutUint64(binaryData[1:9], amount)
-	binaryData[9] = EURCDecimals
+		binaryData := make([]byte, 10)
+		binaryData[0] = 12
+		binary.LittleEndian.PutUint64(binaryData[1:9], leg.Amount)
+		binaryData[9] = EURCDecimals
 
-	dummyBlockhash := solana.MustHashFromBase58("11111111111111111111111111111111")
-
-	var txInstructions []solana.Instruction
-	if includeCreateATA {
 		txInstructions = append(txInstructions, &simpleInstruction{
-			programID: ataProgramID,
+			programID: tokenProgramID,
 			accounts: solana.AccountMetaSlice{
-				{PublicKey: solana.MustPublicKeyFromBase58(fromPubkey.String()), IsSigner: true, IsWritable: true},
-				{PublicKey: solana.MustPublicKeyFromBase58(toATA.String()), IsSigner: false, IsWritable: true},
-				{PublicKey: solana.MustPublicKeyFromBase58(toPubkey.String()), IsSigner: false, IsWritable: false},
-				{PublicKey: solana.MustPublicKeyFromBase58(eurcMint.String()), IsSigner: false, IsWritable: false},
-				{PublicKey: solana.SystemProgramID, IsSigner: false, IsWritable: false},
-				{PublicKey: solana.MustPublicKeyFromBase58(tokenProgramID.String()), IsSigner: false, IsWritable: false},
+				{PublicKey: fromATA, IsSigner: false, IsWritable: true},
+				{PublicKey: eurcMint, IsSigner: false, IsWritable: false},
+				{PublicKey: toATA, IsSigner: false, IsWritable: true},
+				{PublicKey: fromPubkey, IsSigner: true, IsWritable: false},
 			},
-			data: []byte{1}, // CreateIdempotent discriminator
+			data: binaryData,
 		})
 	}
-	txInstructions = append(txInstructions, &simpleInstruction{
-		programID: tokenProgramID,
-		accounts: solana.AccountMetaSlice{
-			{PublicKey: solana.MustPublicKeyFromBase58(fromATA.String()), IsSigner: false, IsWritable: true},
-			{PublicKey: solana.MustPublicKeyFromBase58(eurcMint.String()), IsSigner: false, IsWritable: false},
-			{PublicKey: solana.MustPublicKeyFromBase58(toATA.String()), IsSigner: false, IsWritable: true},
-			{PublicKey: solana.MustPublicKeyFromBase58(fromPubkey.String()), IsSigner: true, IsWritable: false},
-		},
-		data: binaryData,
-	})
 
 	tx, err := solana.NewTransaction(
 		txInstructions,
-		dummyBlockhash,
-		solana.TransactionPayer(solana.MustPublicKeyFromBase58(fromPubkey.String())),
+		recent,
+		solana.TransactionPayer(fromPubkey),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create transaction: %w", err)
@@ -205,19 +282,23 @@ func BuildEURCTransferTransaction(from, to string, amount uint64) (*TransactionD
 	return &TransactionData{
 		Serialized:         base64.StdEncoding.EncodeToString(signedTx),
 		Instructions:       instructions,
-		RecentBlockhash:    "11111111111111111111111111111111",
+		RecentBlockhash:    recent.String(),
 		FeePayer:           fromPubkey.String(),
 		RequiredSignatures: []string{fromPubkey.String()},
 	}, nil
 }
 
+// newTreeKey picks the address of a new Merkle tree account. Tests fix it
+// so the built transaction is the same every run.
+var newTreeKey = func() solana.PublicKey { return solana.NewWallet().PublicKey() }
+
 func BuildMerkleTreeTransaction(ownerWallet string, depth uint8, maxBufferSize uint8) (*TransactionData, error) {
 	ownerPubkey, err := solana.PublicKeyFromBase58(ownerWallet)
 	if err != nil {
 		return nil, fmt.Errorf("invalid owner address: %w", err)
 	}
 
-	treePubkey := solana.NewWallet().PublicKey()
+	treePubkey := newTreeKey()
 
 	var spaceBytes uint64 = TreeSpaceBytes
 	var rentLamports uint64 = TreeRentLamports
@@ -306,10 +387,16 @@ func BuildMintNFTTransaction(ownerWallet, name, price, description, sendTo, tree
 
 	treeAuthority := DeriveTreeAuthority(treePubkey, bubblegumProgram)
 
+	// the uri claims JSON, so the description goes in as an encoded field
+	// rather than as the document itself
+	offChain, err := json.Marshal(map[string]string{"name": name, "description": description})
+	if err != nil {
+		return nil, err
+	}
 	metadata := map[string]interface{}{
 		"name":                    name,
 		"symbol":                  "CHORE",
-		"uri":                     fmt.Sprintf("data:application/json;base64,%s", base64.StdEncoding.EncodeToString([]byte(description))),
+		"uri":                     fmt.Sprintf("data:application/json;base64,%s", base64.StdEncoding.EncodeToString(offChain)),
 		"seller_fee_basis_points": 0,
 		"is_mutable":              true,
 	}
@@ -504,6 +591,45 @@ func DeriveAssociatedTokenAddress(owner solana.PublicKey, mint solana.PublicKey)
 	return ata, err
 }
 
+// LatestBlockhash fetches a recent finalized blockhash for new transactions.
+func LatestBlockhash(ctx context.Context) (string, error) {
+	latest, err := newRPC().GetLatestBlockhash(ctx, rpc.CommitmentFinalized)
+	if err != nil {
+		return "", fmt.Errorf("failed to get latest blockhash: %w", err)
+	}
+	return latest.Value.Blockhash.String(), nil
+}
+
+// GetEURCBalance returns the wallet's EURC balance in micro-units; a
+// missing token account counts as zero.
+func GetEURCBalance(ctx context.Context, wallet string) (uint64, error) {
+	owner, err := solana.PublicKeyFromBase58(wallet)
+	if err != nil {
+		return 0, fmt.Errorf("invalid wallet address: %w", err)
+	}
+	ata, err := DeriveAssociatedTokenAddress(owner, solana.MustPublicKeyFromBase58(EURCMintDevnet))
+	if err != nil {
+		return 0, fmt.Errorf("failed to derive ATA: %w", err)
+	}
+	client := newRPC()
+	info, err := client.GetAccountInfoWithOpts(ctx, ata, &rpc.GetAccountInfoOpts{Commitment: rpc.CommitmentConfirmed})
+	if err != nil {
+		if errors.Is(err, rpc.ErrNotFound) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to fetch token account: %w", err)
+	}
+	if info == nil || info.Value == nil {
+		return 0, nil
+	}
+	data := info.Value.Data.GetBinary()
+	// SPL token account layout: mint(32) owner(32) amount(u64 LE)
+	if len(data) < 72 {
+		return 0, fmt.Errorf("unexpected token account size %d", len(data))
+	}
+	return binary.LittleEndian.Uint64(data[64:72]), nil
+}
+
 func DeriveTreeAuthority(treeID solana.PublicKey, programID solana.PublicKey) solana.PublicKey {
 	treeAuthority, _, err := solana.FindProgramAddress(
 		[][]byte{treeID.Bytes()},
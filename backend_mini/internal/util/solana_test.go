@@ -0,0 +1,32 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/gagliardetto/solana-go"
+)
+
+// FuzzValidateAddress checks ValidateAddress never panics and only accepts
+// strings that are the canonical base58 form of a 32-byte key.
+func FuzzValidateAddress(f *testing.F) {
+	for _, s := range []string{
+		"GBu756JpQbbyhkj81Boxgd5AYh4rw2YhZLUFWUUReqTw",
+		"11111111111111111111111111111111",
+		EURCMintDevnet,
+		"GBu756JpQbbyhkj81Boxgd5AYh4rw2YhZLUFWUUReqT",
+		"GBu756JpQbbyhkj81Boxgd5AYh4rw2YhZLUFWUUReqTw1",
+		"0OIl",
+		"",
+	} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		if err := ValidateAddress(s); err != nil {
+			return
+		}
+		pk := solana.MustPublicKeyFromBase58(s)
+		if pk.String() != s {
+			t.Fatalf("ValidateAddress accepted %q, which is %s", s, pk)
+		}
+	})
+}
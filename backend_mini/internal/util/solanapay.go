@@ -0,0 +1,98 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// NewPaymentReference returns a fresh public key to use as a Solana Pay
+// reference. Wallets add it to the transfer as a read-only account, which
+// makes the payment findable by that key alone.
+func NewPaymentReference() (string, error) {
+	key, err := solana.NewRandomPrivateKey()
+	if err != nil {
+		return "", err
+	}
+	return key.PublicKey().String(), nil
+}
+
+// SolanaPayURL is a Solana Pay transfer request for EURC to recipient. A
+// zero amount lets the payer choose.
+func SolanaPayURL(recipient string, amount uint64, reference, label, message string) string {
+	q := url.Values{}
+	if amount > 0 {
+		q.Set("amount", FormatTokenAmount(amount, EURCDecimals))
+	}
+	q.Set("spl-token", EURCMintDevnet)
+	q.Set("reference", reference)
+	if label != "" {
+		q.Set("label", label)
+	}
+	if message != "" {
+		q.Set("message", message)
+	}
+	return "solana:" + recipient + "?" + q.Encode()
+}
+
+// FindReferencedPayment looks for a successful transaction carrying
+// reference and returns its signature and the EURC it moved to
+// recipient's wallet. found is false until such a transaction confirms.
+func FindReferencedPayment(ctx context.Context, reference, recipient string) (sig string, amount uint64, found bool, err error) {
+	ref, err := solana.PublicKeyFromBase58(reference)
+	if err != nil {
+		return "", 0, false, fmt.Errorf("invalid reference: %w", err)
+	}
+	owner, err := solana.PublicKeyFromBase58(recipient)
+	if err != nil {
+		return "", 0, false, fmt.Errorf("invalid recipient: %w", err)
+	}
+	client := newRPC()
+	sigs, err := client.GetSignaturesForAddressWithOpts(ctx, ref, &rpc.GetSignaturesForAddressOpts{Commitment: rpc.CommitmentConfirmed})
+	if err != nil {
+		return "", 0, false, err
+	}
+	mint := solana.MustPublicKeyFromBase58(EURCMintDevnet)
+	version := uint64(0)
+	// oldest first, so the first payment made with the link is the one kept
+	for i := len(sigs) - 1; i >= 0; i-- {
+		if sigs[i].Err != nil {
+			continue
+		}
+		tx, err := client.GetTransaction(ctx, sigs[i].Signature, &rpc.GetTransactionOpts{
+			Encoding:                       solana.EncodingBase64,
+			Commitment:                     rpc.CommitmentConfirmed,
+			MaxSupportedTransactionVersion: &version,
+		})
+		if err != nil {
+			return "", 0, false, err
+		}
+		if tx.Meta == nil || tx.Meta.Err != nil {
+			continue
+		}
+		received := tokenTotal(tx.Meta.PostTokenBalances, owner, mint) - tokenTotal(tx.Meta.PreTokenBalances, owner, mint)
+		if received > 0 {
+			return sigs[i].Signature.String(), uint64(received), true, nil
+		}
+	}
+	return "", 0, false, nil
+}
+
+// tokenTotal sums owner's balances of mint in a transaction's pre or post
+// token balances.
+func tokenTotal(balances []rpc.TokenBalance, owner, mint solana.PublicKey) int64 {
+	var total int64
+	for _, b := range balances {
+		if b.Owner == nil || !b.Owner.Equals(owner) || !b.Mint.Equals(mint) || b.UiTokenAmount == nil {
+			continue
+		}
+		if n, err := strconv.ParseInt(b.UiTokenAmount.Amount, 10, 64); err == nil {
+			total += n
+		}
+	}
+	return total
+}
@@ -0,0 +1,63 @@
+package util
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	scriptBlock   = regexp.MustCompile(`(?is)<script\b.*?</script\s*>|<style\b.*?</style\s*>`)
+	htmlTag       = regexp.MustCompile(`(?s)<!--.*?-->|</?[A-Za-z][^<>]*>`)
+	markdownLink  = regexp.MustCompile(`(!?)\[([^\]]*)\]\(((?:[^()]|\([^()]*\))*)\)`)
+	blankLineRuns = regexp.MustCompile(`\n{3,}`)
+)
+
+// SanitizeText normalizes user-entered free text before it is stored or
+// put into NFT metadata: HTML tags (and script and style blocks) are
+// stripped and entities decoded,
+// markdown links other than http(s) and mailto are reduced to their text,
+// and line endings and surrounding whitespace are normalized. Control and
+// bidi-override characters are rejected rather than removed, as is text
+// longer than maxRunes after normalization. Single-line text may not
+// contain newlines at all.
+func SanitizeText(s string, maxRunes int, multiline bool) (string, error) {
+	if !utf8.ValidString(s) {
+		return "", fmt.Errorf("is not valid UTF-8")
+	}
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = strings.ReplaceAll(s, "\r", "\n")
+	for _, r := range s {
+		switch {
+		case r == '\n' && multiline, r == '\t':
+		case r == '\n':
+			return "", fmt.Errorf("must be a single line")
+		case unicode.IsControl(r), unicode.Is(unicode.Cf, r) && r != '\u200d': // ZWJ joins emoji
+			return "", fmt.Errorf("contains control character %U", r)
+		}
+	}
+	s = htmlTag.ReplaceAllString(scriptBlock.ReplaceAllString(s, ""), "")
+	s = html.UnescapeString(s)
+	// decoding can reveal tags that were escaped
+	s = htmlTag.ReplaceAllString(scriptBlock.ReplaceAllString(s, ""), "")
+	s = markdownLink.ReplaceAllStringFunc(s, func(m string) string {
+		parts := markdownLink.FindStringSubmatch(m)
+		target := strings.ToLower(strings.TrimSpace(parts[3]))
+		if parts[1] == "" && (strings.HasPrefix(target, "https://") || strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "mailto:")) {
+			return m
+		}
+		return parts[2]
+	})
+	lines := strings.Split(s, "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimRightFunc(l, unicode.IsSpace)
+	}
+	s = strings.TrimSpace(blankLineRuns.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+	if n := utf8.RuneCountInString(s); n > maxRunes {
+		return "", fmt.Errorf("is %d characters long; the limit is %d", n, maxRunes)
+	}
+	return s, nil
+}
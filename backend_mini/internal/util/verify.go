@@ -0,0 +1,78 @@
+package util
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/gagliardetto/solana-go/rpc"
+)
+
+// MessageHash hashes the transaction's message as it would be signed. A
+// non-empty blockhash replaces the message's own first, so a transaction
+// built with the placeholder still matches once the client sets a real one.
+func MessageHash(tx *solana.Transaction, blockhash string) (string, error) {
+	msg := tx.Message
+	if blockhash != "" {
+		h, err := solana.HashFromBase58(blockhash)
+		if err != nil {
+			return "", fmt.Errorf("invalid blockhash: %w", err)
+		}
+		msg.RecentBlockhash = h
+	}
+	buf, err := msg.MarshalBinary()
+	if err != nil {
+		return "", fmt.Errorf("failed to serialize message: %w", err)
+	}
+	sum := sha256.Sum256(buf)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// SerializedMessageHash is MessageHash for a base64 transaction.
+func SerializedMessageHash(serialized, blockhash string) (string, error) {
+	tx, err := solana.TransactionFromBase64(serialized)
+	if err != nil {
+		return "", fmt.Errorf("invalid transaction: %w", err)
+	}
+	return MessageHash(tx, blockhash)
+}
+
+// BlockhashValid asks the RPC whether a blockhash can still land.
+func BlockhashValid(ctx context.Context, blockhash solana.Hash) (bool, error) {
+	out, err := newRPC().IsBlockhashValid(ctx, blockhash, rpc.CommitmentProcessed)
+	if err != nil {
+		return false, fmt.Errorf("failed to check blockhash: %w", err)
+	}
+	return out.Value, nil
+}
+
+// ErrNotLanded is returned by LandedTransaction for a signature with no
+// confirmed, successful transaction on chain.
+var ErrNotLanded = errors.New("transaction has not landed")
+
+// LandedTransaction fetches the transaction with signature sig once it is
+// confirmed. A transaction that failed on chain has not landed either.
+func LandedTransaction(ctx context.Context, sig solana.Signature) (*solana.Transaction, error) {
+	version := uint64(0)
+	out, err := newRPC().GetTransaction(ctx, sig, &rpc.GetTransactionOpts{
+		Encoding:                       solana.EncodingBase64,
+		Commitment:                     rpc.CommitmentConfirmed,
+		MaxSupportedTransactionVersion: &version,
+	})
+	if errors.Is(err, rpc.ErrNotFound) {
+		return nil, ErrNotLanded
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch transaction: %w", err)
+	}
+	if out.Transaction == nil {
+		return nil, ErrNotLanded
+	}
+	if out.Meta != nil && out.Meta.Err != nil {
+		return nil, fmt.Errorf("%w: it failed on chain", ErrNotLanded)
+	}
+	return out.Transaction.GetTransaction()
+}
@@ -0,0 +1,149 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend_mini/internal/netguard"
+)
+
+const (
+	SignatureHeader = "X-Sona-Signature"
+	TimestampHeader = "X-Sona-Timestamp"
+	EventHeader     = "X-Sona-Event"
+
+	// DefaultTolerance is how old a delivery may be before receivers should reject it.
+	DefaultTolerance = 5 * time.Minute
+)
+
+// client delivers to the URLs families register; opsClient to the one the
+// operator configures, which may well be internal.
+var (
+	client    = netguard.Client(10 * time.Second)
+	opsClient = &http.Client{Timeout: 10 * time.Second}
+)
+
+type Event struct {
+	Type      string `json:"type"`
+	CreatedAt string `json:"created_at"`
+	Data      any    `json:"data"`
+	// Message is the event's title and body rendered from the active push
+	// template for its type, when there is one.
+	Message map[string]any `json:"message,omitempty"`
+}
+
+// Result is how a receiver answered. Its body is not kept: echoing it back
+// would let a URL read whatever it points at.
+type Result struct {
+	StatusCode int   `json:"status_code"`
+	DurationMs int64 `json:"duration_ms"`
+}
+
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// Sign returns the signature header value for body sent at ts:
+// "t=<unix>,v1=<hex hmac-sha256 of "<unix>.<body>">".
+func Sign(secret string, ts time.Time, body []byte) string {
+	unix := strconv.FormatInt(ts.Unix(), 10)
+	return "t=" + unix + ",v1=" + compute(secret, unix, body)
+}
+
+func compute(secret, unix string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unix))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify is the receiver-side check: constant-time signature comparison plus
+// rejection of deliveries outside tolerance, which stops replays. Any of
+// several v1 signatures may match, as senders rolling their secret send one
+// per secret.
+func Verify(secret, header string, body []byte, tolerance time.Duration) error {
+	var unix string
+	var sigs []string
+	for _, part := range strings.Split(header, ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch k {
+		case "t":
+			unix = v
+		case "v1":
+			sigs = append(sigs, v)
+		}
+	}
+	if unix == "" || len(sigs) == 0 {
+		return errors.New("malformed signature header")
+	}
+	ts, err := strconv.ParseInt(unix, 10, 64)
+	if err != nil {
+		return errors.New("malformed signature timestamp")
+	}
+	if age := time.Since(time.Unix(ts, 0)); age > tolerance || age < -tolerance {
+		return errors.New("signature timestamp outside tolerance")
+	}
+	want := []byte(compute(secret, unix, body))
+	for _, sig := range sigs {
+		if hmac.Equal([]byte(sig), want) {
+			return nil
+		}
+	}
+	return errors.New("signature mismatch")
+}
+
+// Send delivers a signed event to url, which must be a public address.
+func Send(ctx context.Context, url, secret string, ev Event) (*Result, error) {
+	return send(ctx, client, url, secret, ev)
+}
+
+// SendOps is Send for the operator's alert URL, which may be internal.
+func SendOps(ctx context.Context, url, secret string, ev Event) (*Result, error) {
+	return send(ctx, opsClient, url, secret, ev)
+}
+
+func send(ctx context.Context, c *http.Client, url, secret string, ev Event) (*Result, error) {
+	if ev.CreatedAt == "" {
+		ev.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+	}
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Sona-Webhooks/1")
+	req.Header.Set(EventHeader, ev.Type)
+	req.Header.Set(TimestampHeader, strconv.FormatInt(now.Unix(), 10))
+	req.Header.Set(SignatureHeader, Sign(secret, now, body))
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("delivery failed: %w", err)
+	}
+	defer resp.Body.Close()
+	// read a little so the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 2048))
+	return &Result{StatusCode: resp.StatusCode, DurationMs: time.Since(now).Milliseconds()}, nil
+}